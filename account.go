@@ -1,15 +1,24 @@
 package staticbackend
 
 import (
+	crand "crypto/rand"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"io"
 	"log"
-	"math/rand"
+	"math/big"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/staticbackendhq/core/cache"
 	"github.com/staticbackendhq/core/config"
 	emailFuncs "github.com/staticbackendhq/core/email"
+	"github.com/staticbackendhq/core/events"
 	"github.com/staticbackendhq/core/internal"
 	"github.com/staticbackendhq/core/middleware"
 
@@ -21,40 +30,82 @@ import (
 
 var (
 	letterRunes = []rune("abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ2345679")
+
+	// randSource is read by randStringRunes, tests can replace it with a
+	// seeded math/rand source to get deterministic values.
+	randSource io.Reader = crand.Reader
 )
 
 type accounts struct {
 	membership *membership
 }
 
+// createAccountRequest is posted as a form by the web UI, the CLI and the
+// marketing website send it as query string.
+type createAccountRequest struct {
+	Email  string `json:"email"`
+	Invite string `json:"invite"`
+	// UI is set by the marketing website
+	UI  string `json:"ui"`
+	Mem string `json:"mem"`
+	// Currency of the subscription price, the default one when empty
+	Currency string `json:"currency"`
+}
+
+func (req *createAccountRequest) Validate() error {
+	// TODO: cheap email validation
+	email := req.Email
+	if len(email) < 4 || strings.Index(email, "@") == -1 || strings.Index(email, ".") == -1 {
+		return errors.New("invalid email")
+	}
+	return nil
+}
+
 func (a *accounts) create(w http.ResponseWriter, r *http.Request) {
-	var email string
+	var memDBName, memPassword string
 	fromCLI := true
 	memoryMode := false
 
+	var req createAccountRequest
+	if err := decodeRequest(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	email := strings.ToLower(req.Email)
+	inviteCode := req.Invite
+
 	// the CLI do a GET for the account initialization, we can then
 	// base the rest of the flow on the fact that the web UI POST data
 	if r.Method == http.MethodPost {
 		fromCLI = false
-
-		r.ParseForm()
-
-		email = strings.ToLower(r.Form.Get("email"))
 	} else {
-		email = strings.ToLower(r.URL.Query().Get("email"))
+		if memoryModeAllowed() {
+			memoryMode = req.Mem == "1"
+		}
 
-		if config.Current.AppEnv != AppEnvProd {
-			memoryMode = r.URL.Query().Get("mem") == "1"
+		if memoryMode {
+			var err error
+			memDBName, memPassword, err = memoryModeCredentials(r.URL.Query())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 		}
 
 		// the marketing website uses a query string ?ui=true
-		if len(r.URL.Query().Get("ui")) > 0 {
+		if len(req.UI) > 0 {
 			fromCLI = false
 		}
 	}
-	// TODO: cheap email validation
-	if len(email) < 4 || strings.Index(email, "@") == -1 || strings.Index(email, ".") == -1 {
-		http.Error(w, "invalid email", http.StatusBadRequest)
+	if err := canCreateAccount(inviteCode); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if !allowSignup(r, email) {
+		http.Error(w, "too many accounts created, please try again later", http.StatusTooManyRequests)
+		return
+	} else if isDisposableEmail(email) {
+		http.Error(w, "disposable email addresses are not accepted, please use a permanent one", http.StatusBadRequest)
 		return
 	}
 
@@ -84,16 +135,8 @@ func (a *accounts) create(w http.ResponseWriter, r *http.Request) {
 
 		stripeCustomerID = cus.ID
 
-		subParams := &stripe.SubscriptionParams{
-			Customer: stripe.String(cus.ID),
-			Items: []*stripe.SubscriptionItemsParams{
-				{
-					Price: stripe.String(config.Current.StripePriceIDIdea),
-				},
-			},
-			TrialPeriodDays: stripe.Int64(60),
-		}
-		newSub, err := sub.New(subParams)
+		priceID := planPriceID(internal.PlanIdea, requestCurrency(r, req.Currency))
+		newSub, err := sub.New(newSubscriptionParams(cus.ID, priceID))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -105,7 +148,6 @@ func (a *accounts) create(w http.ResponseWriter, r *http.Request) {
 	// create the account
 
 	cust := internal.Customer{
-		ID:             "cust-local-dev", // easier for CLI/memory flow
 		Email:          email,
 		StripeID:       stripeCustomerID,
 		SubscriptionID: subID,
@@ -114,53 +156,61 @@ func (a *accounts) create(w http.ResponseWriter, r *http.Request) {
 		Created:        time.Now(),
 	}
 
+	// the datastore generates the id, the memory mode uses a fixed one
+	// easier for the CLI flow
+	if memoryMode {
+		cust.ID = devCustomerID
+	}
+
 	cust, err = datastore.CreateCustomer(cust)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// make sure the DB name is unique
+	// make sure the DB name is unique, CreateBase is atomic and returns
+	// ErrBaseNameTaken when another base won the name, we retry with a new one
 	retry := 10
 	dbName := randStringRunes(12)
 	if memoryMode {
-		dbName = "dev-memory-pk"
+		dbName = memDBName
 	}
+
+	var bc internal.BaseConfig
 	for {
-		exists, err = datastore.DatabaseExists(dbName)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		} else if exists {
+		base := internal.BaseConfig{
+			CustomerID:    cust.ID,
+			Name:          dbName,
+			IsActive:      active,
+			AllowedDomain: []string{"localhost"},
+		}
+
+		// the datastore generates the id, the memory mode uses the requested
+		// database name as public key, easier for the CLI flow
+		if memoryMode {
+			base.ID = dbName
+		}
+
+		bc, err = datastore.CreateBase(base)
+		if errors.Is(err, internal.ErrBaseNameTaken) && retry > 0 {
 			retry--
 			dbName = randStringRunes(12)
 			continue
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 		break
 	}
 
-	base := internal.BaseConfig{
-		ID:            dbName, // easier for CLI/memory flow
-		CustomerID:    cust.ID,
-		Name:          dbName,
-		IsActive:      active,
-		AllowedDomain: []string{"localhost"},
-	}
-
-	bc, err := datastore.CreateBase(base)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
 	// we create an admin user
 	// we make sure to switch DB
 	pw := randStringRunes(6)
 	if memoryMode {
-		pw = "devpw1234"
+		pw = memPassword
 	}
 
-	if _, _, err := a.membership.createAccountAndUser(dbName, email, pw, 100); err != nil {
+	if _, _, err := a.membership.createAccountAndUser(bc, email, pw, 100, ""); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -169,7 +219,7 @@ func (a *accounts) create(w http.ResponseWriter, r *http.Request) {
 	if config.Current.AppEnv == AppEnvProd && len(config.Current.StripeKey) > 0 {
 		params := &stripe.BillingPortalSessionParams{
 			Customer:  stripe.String(stripeCustomerID),
-			ReturnURL: stripe.String("https://staticbackend.com/stripe"),
+			ReturnURL: stripe.String(config.BillingReturnLink(config.Current)),
 		}
 		s, err := session.New(params)
 		if err != nil {
@@ -186,39 +236,11 @@ func (a *accounts) create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rootToken := fmt.Sprintf("%s|%s|%s", token.ID, token.AccountID, token.Token)
-
-	//TODO: Have html template for those
-	body := fmt.Sprintf(`
-	<p>Hey there,</p>
-	<p>Thanks for creating your account.</p>
-	<p>Your SB-PUBLIC-KEY is required on all your API requests:</p>
-	<p>SB-PUBLIC-KEY: <strong>%s</strong></p>
-	<p>We've created an admin user for your new database:</p>
-	<p>email: %s<br />
-	password: %s</p>
-	<p>This is your root token key. You'll need this to manage your database and 
-	execute "sudo" commands from your backend functions</p>
-	<p>ROOT TOKEN: <strong>%s</strong></p>
-	<p>Make sure you complete your account creation by entering a valid credit 
-	card via the link you got when issuing the account create command.</p>
-	<p>If you have any questions, please reply to this email.</p>
-	<p>Good luck with your projects.</p>
-	<p>Dominic<br />Founder</p>
-	`, bc.ID, email, pw, rootToken)
-
-	ed := internal.SendMailData{
-		From:     config.Current.FromEmail,
-		FromName: config.Current.FromName,
-		To:       email,
-		ToName:   "",
-		Subject:  "Your StaticBackend account",
-		HTMLBody: body,
-		TextBody: emailFuncs.StripHTML(body),
-	}
+	rootToken := internal.RootToken{ID: token.ID, AccountID: token.AccountID, Token: token.Token}.String()
 
 	if memoryMode {
-		fmt.Printf(`
+		if len(r.URL.Query().Get("verbose")) > 0 {
+			fmt.Printf(`
 Start sending requests with the following credentials:
 
 
@@ -236,15 +258,30 @@ Root token:		%s
 Refer to the documentation at https://staticbackend.com/docs\n
 
 `,
-			bc.ID, email, pw, rootToken,
-		)
-	} else {
-		err = emailer.Send(ed)
-		if err != nil {
-			log.Println("error sending email", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+				bc.ID, email, pw, rootToken,
+			)
 		}
+
+		respond(w, http.StatusOK, memoryModeResult{
+			PublicKey: bc.ID,
+			Email:     email,
+			Password:  pw,
+			RootToken: rootToken,
+		})
+		return
+	}
+
+	ev := events.AccountCreated{
+		Base:      bc.Name,
+		PublicKey: bc.ID,
+		Email:     email,
+		Password:  pw,
+		RootToken: rootToken,
+	}
+	if err := events.Emit(ev); err != nil {
+		log.Println("error handling account created", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	if fromCLI {
@@ -260,6 +297,240 @@ Refer to the documentation at https://staticbackend.com/docs\n
 	render(w, r, "login.html", nil, &Flash{Type: "sucess", Message: "We've emailed you all the information you need to get started."})
 }
 
+// trialDays is the length of the trial of a new subscription.
+const trialDays = 60
+
+// newSubscriptionParams returns the subscription of a new account. It has a
+// trial unless SIGNUP_MODE is "card", the subscription is then incomplete
+// until a payment method is attached.
+func newSubscriptionParams(customerID, priceID string) *stripe.SubscriptionParams {
+	params := &stripe.SubscriptionParams{
+		Customer: stripe.String(customerID),
+		Items: []*stripe.SubscriptionItemsParams{
+			{
+				Price: stripe.String(priceID),
+			},
+		},
+	}
+
+	if strings.EqualFold(config.Current.SignupMode, config.SignupModeCard) {
+		params.PaymentBehavior = stripe.String("default_incomplete")
+	} else {
+		params.TrialPeriodDays = stripe.Int64(trialDays)
+	}
+	return params
+}
+
+// sendAccountCreatedEmail emails the account information to its owner when
+// an account is created.
+func sendAccountCreatedEmail(e events.Event) error {
+	ev := e.(events.AccountCreated)
+
+	data := map[string]string{
+		"PublicKey": ev.PublicKey,
+		"Email":     ev.Email,
+		"Password":  ev.Password,
+		"RootToken": ev.RootToken,
+	}
+
+	htmlBody, textBody, err := accountCreatedEmail.Render(data)
+	if err != nil {
+		return err
+	}
+
+	subject, fromName, err := mailBranding(accountCreatedEmail, ev.Base, data)
+	if err != nil {
+		return err
+	}
+
+	ed := internal.SendMailData{
+		From:     config.Current.FromEmail,
+		FromName: fromName,
+		To:       ev.Email,
+		ToName:   "",
+		Subject:  subject,
+		HTMLBody: htmlBody,
+		TextBody: textBody,
+		ReplyTo:  supportEmail(),
+	}
+	return emailer.Send(withMailDefaults(ed))
+}
+
+// canCreateAccount checks the registration gate configured via
+// ACCOUNT_CREATION for both the CLI and web UI flows.
+func canCreateAccount(inviteCode string) error {
+	switch strings.ToLower(config.Current.AccountCreation) {
+	case config.AccountCreationDisabled:
+		return errors.New("account creation is disabled on this instance")
+	case config.AccountCreationInvite:
+		code := config.Current.AccountInviteCode
+		if len(code) == 0 || subtle.ConstantTimeCompare([]byte(code), []byte(inviteCode)) != 1 {
+			return errors.New("a valid invite code is required to create an account")
+		}
+	}
+	return nil
+}
+
+// signupLimiter counts the account creations per IP and email domain.
+var signupLimiter = cache.NewRateLimiter(100000)
+
+// allowSignup returns if an account can be created from the IP of r for
+// email, see SIGNUP_RATE_LIMIT and SIGNUP_DOMAIN_RATE_LIMIT.
+func allowSignup(r *http.Request, email string) bool {
+	ip, domain := config.Current.Settings.SignupRateLimit, config.Current.Settings.SignupDomainRateLimit
+
+	if !signupLimiter.Allow("ip:"+middleware.RemoteIP(r), ip.Limit, ip.Window) {
+		return false
+	}
+
+	if _, host, ok := strings.Cut(email, "@"); ok && len(host) > 0 {
+		return signupLimiter.Allow("domain:"+host, domain.Limit, domain.Window)
+	}
+	return true
+}
+
+// disposableDomains is the DISPOSABLE_EMAIL_DOMAINS_FILE list.
+var disposableDomains = &emailFuncs.DomainFile{}
+
+// isDisposableEmail returns if the domain of email is one of the
+// DISPOSABLE_EMAIL_DOMAINS or listed in DISPOSABLE_EMAIL_DOMAINS_FILE. A file
+// that can't be read does not prevent signups.
+func isDisposableEmail(email string) bool {
+	if emailFuncs.MatchDomain(email, config.Current.Settings.DisposableDomains) {
+		return true
+	}
+
+	path := config.Current.DisposableDomainsFile
+	if len(path) == 0 {
+		return false
+	}
+
+	disposable, err := disposableDomains.Match(path, email)
+	if err != nil {
+		log.Println("error reading the disposable email domains", err)
+		return false
+	}
+	return disposable
+}
+
+// memoryModeAllowed returns if the ?mem=1 provisioning is permitted. The
+// ALLOW_MEMORY_MODE flag takes precedence over the AppEnv default.
+func memoryModeAllowed() bool {
+	switch strings.ToLower(config.Current.AllowMemoryMode) {
+	case "yes":
+		return true
+	case "no":
+		return false
+	}
+	return config.Current.AppEnv != AppEnvProd
+}
+
+// memoryModeResult is returned by the ?mem=1 account creation so tooling
+// can consume the credentials.
+type memoryModeResult struct {
+	PublicKey string `json:"publicKey"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	RootToken string `json:"rootToken"`
+}
+
+const (
+	defaultMemoryModeDBName   = "dev-memory-pk"
+	defaultMemoryModePassword = "devpw1234"
+)
+
+var memoryModeDBNameRe = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]{2,62}$`)
+
+// memoryModeCredentials returns the database name and admin password for
+// the ?mem=1 flow. The ?db= and ?pw= query string take precedence over
+// MEMORY_MODE_DB_NAME and MEMORY_MODE_PASSWORD so parallel dev instances
+// don't clash on the same database name.
+func memoryModeCredentials(qs url.Values) (dbName, pw string, err error) {
+	dbName, pw = defaultMemoryModeDBName, defaultMemoryModePassword
+
+	if v := config.Current.MemoryModeDBName; len(v) > 0 {
+		dbName = v
+	}
+	if v := config.Current.MemoryModePassword; len(v) > 0 {
+		pw = v
+	}
+
+	if v := qs.Get("db"); len(v) > 0 {
+		dbName = v
+	}
+	if v := qs.Get("pw"); len(v) > 0 {
+		pw = v
+	}
+
+	if !memoryModeDBNameRe.MatchString(dbName) {
+		err = fmt.Errorf("invalid database name %q, it must start with a letter and contain 3 to 63 letters, digits, - or _", dbName)
+	} else if len(pw) < 6 {
+		err = errors.New("the password must be at least 6 characters")
+	}
+	return
+}
+
+// devCustomerID is the customer id used in memory mode.
+const devCustomerID = "cust-local-dev"
+
+var accountCreatedEmail = emailFuncs.Template{
+	Name:    "account-created",
+	Subject: "Your StaticBackend account",
+	HTML: `
+	<p>Hey there,</p>
+	<p>Thanks for creating your account.</p>
+	<p>Your SB-PUBLIC-KEY is required on all your API requests:</p>
+	<p>SB-PUBLIC-KEY: <strong>{{.PublicKey}}</strong></p>
+	<p>We've created an admin user for your new database:</p>
+	<p>email: {{.Email}}<br />
+	password: {{.Password}}</p>
+	<p>This is your root token key. You'll need this to manage your database and 
+	execute "sudo" commands from your backend functions</p>
+	<p>ROOT TOKEN: <strong>{{.RootToken}}</strong></p>
+	<p>Make sure you complete your account creation by entering a valid credit 
+	card via the link you got when issuing the account create command.</p>
+	<p>If you have any questions, please reply to this email.</p>
+	<p>Good luck with your projects.</p>
+	<p>Dominic<br />Founder</p>
+	`,
+	Text: `Hey there,
+
+Thanks for creating your account.
+
+Your SB-PUBLIC-KEY is required on all your API requests:
+
+SB-PUBLIC-KEY: {{.PublicKey}}
+
+We've created an admin user for your new database:
+
+email: {{.Email}}
+password: {{.Password}}
+
+This is your root token key. You'll need this to manage your database and
+execute "sudo" commands from your backend functions:
+
+ROOT TOKEN: {{.RootToken}}
+
+Make sure you complete your account creation by entering a valid credit
+card via the link you got when issuing the account create command.
+
+If you have any questions, please reply to this email.
+
+Good luck with your projects.
+
+Dominic
+Founder
+`,
+}
+
+// supportEmail is the Reply-To of the emails sent to customers.
+func supportEmail() string {
+	if len(config.Current.SupportEmail) > 0 {
+		return config.Current.SupportEmail
+	}
+	return config.Current.FromEmail
+}
+
 func (a *accounts) auth(w http.ResponseWriter, r *http.Request) {
 	_, auth, err := middleware.Extract(r, true)
 	if err != nil {
@@ -270,6 +541,312 @@ func (a *accounts) auth(w http.ResponseWriter, r *http.Request) {
 	respond(w, http.StatusOK, auth.Email)
 }
 
+func (a *accounts) info(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cus, err := datastore.FindAccount(conf.CustomerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := new(struct {
+		Customer internal.Customer   `json:"customer"`
+		Base     internal.BaseConfig `json:"base"`
+	})
+	data.Customer = cus
+	data.Base = conf
+
+	respond(w, http.StatusOK, data)
+}
+
+// rename changes the display name of the base, its ID and physical database
+// name are not affected.
+func (a *accounts) rename(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := new(struct {
+		Name string `json:"name"`
+	})
+	if err := parseBody(r.Body, data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(data.Name)
+	if len(name) == 0 {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := datastore.RenameBase(conf.ID, name); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	middleware.Bases.Invalidate(conf.Key())
+
+	respond(w, http.StatusOK, true)
+}
+
+// sessionBinding returns or sets how the user tokens of the base are bound
+// to the client they were issued to: "ip", "ua", "ip+ua" or "" to disable.
+// It applies to the tokens issued after the change, the others are rejected
+// once a binding is set.
+func (a *accounts) sessionBinding(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := new(struct {
+		Binding string `json:"binding"`
+	})
+
+	if r.Method == http.MethodGet {
+		data.Binding = conf.SessionBinding
+		respond(w, http.StatusOK, data)
+		return
+	} else if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := parseBody(r.Body, data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	binding := strings.ToLower(strings.TrimSpace(data.Binding))
+	if !internal.ValidSessionBinding(binding) {
+		http.Error(w, "binding must be one of ip, ua, ip+ua or empty", http.StatusBadRequest)
+		return
+	}
+
+	if err := datastore.SetSessionBinding(conf.ID, binding); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	middleware.Bases.Invalidate(conf.Key())
+
+	respond(w, http.StatusOK, true)
+}
+
+// features returns or sets which features are enabled for the base, see
+// internal.FeatureRealtime and friends. The features omitted from a change
+// keep their current state.
+func (a *accounts) features(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		respond(w, http.StatusOK, baseFeatures(conf))
+		return
+	} else if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var changes map[string]bool
+	if err := parseBody(r.Body, &changes); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	features := make(map[string]bool)
+	for name, enabled := range conf.Features {
+		features[name] = enabled
+	}
+	for name, enabled := range changes {
+		if !internal.ValidFeature(name) {
+			http.Error(w, fmt.Sprintf("unknown feature %s", name), http.StatusBadRequest)
+			return
+		}
+		features[name] = enabled
+	}
+
+	if err := datastore.SetFeatures(conf.ID, features); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	middleware.Bases.Invalidate(conf.Key())
+
+	conf.Features = features
+	respond(w, http.StatusOK, baseFeatures(conf))
+}
+
+// baseFeatures returns if each feature is enabled for the base.
+func baseFeatures(conf internal.BaseConfig) map[string]bool {
+	features := make(map[string]bool)
+	for _, name := range []string{internal.FeatureRealtime, internal.FeatureFunctions, internal.FeaturePublicCollections} {
+		features[name] = conf.FeatureEnabled(name)
+	}
+	return features
+}
+
+// publicAliases returns or replaces the public aliases of the base, the
+// friendly collection names resolved to public collections on the /db and
+// /query routes, i.e. {"posts": "pub_posts"}.
+func (a *accounts) publicAliases(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		aliases := conf.PublicAliases
+		if aliases == nil {
+			aliases = make(map[string]string)
+		}
+		respond(w, http.StatusOK, aliases)
+		return
+	} else if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	aliases := make(map[string]string)
+	if err := parseBody(r.Body, &aliases); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err := internal.ValidatePublicAliases(aliases); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := datastore.SetPublicAliases(conf.ID, aliases); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	middleware.Bases.Invalidate(conf.Key())
+
+	respond(w, http.StatusOK, aliases)
+}
+
+// billingDone is the page the Stripe billing portal returns to when
+// BILLING_RETURN_URL is not set.
+func (a *accounts) billingDone(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("Your billing information is saved, you may close this window."))
+}
+
+// rotateKey issues a new public key for the base. The previous key keeps
+// working for graceSeconds, 0 revokes it right away.
+func (a *accounts) rotateKey(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := new(struct {
+		GraceSeconds int64 `json:"graceSeconds"`
+	})
+	if err := parseBody(r.Body, data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if data.GraceSeconds < 0 {
+		http.Error(w, "graceSeconds cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	oldKey := conf.Key()
+	newKey := datastore.NewID()
+	expires := time.Now().Add(time.Duration(data.GraceSeconds) * time.Second)
+
+	if err := datastore.RotatePublicKey(conf.ID, newKey, expires); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the public websocket resolves the base from the shared cache, the
+	// previous key's entry is kept until its grace period is over
+	middleware.Bases.Invalidate(oldKey)
+	if err := expirePreviousKey(a.membership.volatile, oldKey, expires); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := new(struct {
+		PublicKey          string    `json:"publicKey"`
+		PreviousKeyExpires time.Time `json:"previousKeyExpires"`
+	})
+	result.PublicKey = newKey
+	result.PreviousKeyExpires = expires
+
+	respond(w, http.StatusOK, result)
+}
+
+// expirePreviousKey records when the rotated key stops resolving from the
+// shared cache, without a grace period its entry is dropped right away.
+func expirePreviousKey(volatile internal.PubSuber, key string, expires time.Time) error {
+	if err := volatile.Set("keyexpires:"+key, strconv.FormatInt(expires.Unix(), 10)); err != nil {
+		return err
+	} else if !time.Now().Before(expires) {
+		return volatile.Set(key, "")
+	}
+	return nil
+}
+
+// previousKeyExpired returns true once the grace period of a rotated key
+// is over.
+func previousKeyExpired(volatile internal.PubSuber, key string) bool {
+	s, err := volatile.Get("keyexpires:" + key)
+	if err != nil || len(s) == 0 {
+		return false
+	}
+
+	unix, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return false
+	}
+	return time.Now().Unix() >= unix
+}
+
+// rotateRootToken regenerates the secret of the calling root token, the new
+// composite token is only returned by this call.
+func (a *accounts) rotateRootToken(w http.ResponseWriter, r *http.Request) {
+	conf, auth, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newToken := datastore.NewID()
+	if err := datastore.SetUserToken(conf.Name, auth.UserID, newToken); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// sessions and scheduled tasks cached the previous token
+	if err := middleware.AuthTokens(a.membership.volatile).DeleteAuth(auth.ReconstructToken()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if err := a.membership.volatile.Set("root:"+conf.Name, ""); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rootToken := internal.RootToken{ID: auth.UserID, AccountID: auth.AccountID, Token: newToken}.String()
+	respond(w, http.StatusOK, map[string]string{"rootToken": rootToken})
+}
+
 func (a *accounts) portal(w http.ResponseWriter, r *http.Request) {
 	conf, _, err := middleware.Extract(r, true)
 	if err != nil {
@@ -285,7 +862,7 @@ func (a *accounts) portal(w http.ResponseWriter, r *http.Request) {
 
 	params := &stripe.BillingPortalSessionParams{
 		Customer:  stripe.String(cus.StripeID),
-		ReturnURL: stripe.String("https://staticbackend.com/stripe"),
+		ReturnURL: stripe.String(config.BillingReturnLink(config.Current)),
 	}
 	s, err := session.New(params)
 	if err != nil {
@@ -296,10 +873,96 @@ func (a *accounts) portal(w http.ResponseWriter, r *http.Request) {
 	respond(w, http.StatusOK, s.URL)
 }
 
+// changePlan moves the customer's subscription to the requested plan,
+// Stripe prorates the difference on the next invoice.
+func (a *accounts) changePlan(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := new(struct {
+		Plan     string `json:"plan"`
+		Currency string `json:"currency"`
+	})
+	if err := parseBody(r.Body, data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	plan, ok := planNames[strings.ToLower(data.Plan)]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown plan %q", data.Plan), http.StatusBadRequest)
+		return
+	}
+
+	priceID := planPriceID(plan, requestCurrency(r, data.Currency))
+	if len(priceID) == 0 {
+		http.Error(w, fmt.Sprintf("the %s plan is not available", data.Plan), http.StatusBadRequest)
+		return
+	}
+
+	cus, err := datastore.FindAccount(conf.CustomerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if len(cus.SubscriptionID) == 0 {
+		http.Error(w, "this account has no subscription", http.StatusBadRequest)
+		return
+	}
+
+	if err := changeSubscriptionPlan(cus, plan, priceID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, http.StatusOK, true)
+}
+
+// changeSubscriptionPlan updates the subscription item of cus to priceID
+// with proration and stores the new plan.
+func changeSubscriptionPlan(cus internal.Customer, plan int, priceID string) error {
+	s, err := sub.Get(cus.SubscriptionID, nil)
+	if err != nil {
+		return err
+	} else if len(s.Items.Data) == 0 {
+		return fmt.Errorf("subscription %s has no item", cus.SubscriptionID)
+	}
+
+	params := &stripe.SubscriptionParams{
+		Items: []*stripe.SubscriptionItemsParams{
+			{
+				ID:    stripe.String(s.Items.Data[0].ID),
+				Price: stripe.String(priceID),
+			},
+		},
+		ProrationBehavior: stripe.String(string(stripe.SubscriptionProrationBehaviorCreateProrations)),
+	}
+	if _, err := sub.Update(cus.SubscriptionID, params); err != nil {
+		return err
+	}
+
+	if err := datastore.ChangeCustomerPlan(cus.ID, plan); err != nil {
+		return err
+	}
+
+	// the cached bases are refreshed with the customer's new plan
+	middleware.Bases.InvalidateCustomer(cus.ID)
+	return nil
+}
+
+// randStringRunes returns n random letters read from randSource.
 func randStringRunes(n int) string {
+	max := big.NewInt(int64(len(letterRunes)))
+
 	b := make([]rune, n)
 	for i := range b {
-		b[i] = letterRunes[rand.Intn(len(letterRunes))]
+		idx, err := crand.Int(randSource, max)
+		if err != nil {
+			panic(fmt.Sprintf("unable to read random source: %v", err))
+		}
+		b[i] = letterRunes[idx.Int64()]
 	}
 
 	// due to PostgreSQL schema requiring letter start.
@@ -0,0 +1,685 @@
+package staticbackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/cache"
+	"github.com/staticbackendhq/core/config"
+	"github.com/staticbackendhq/core/events"
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+	"github.com/stripe/stripe-go/v72"
+)
+
+func TestCanCreateAccount(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.AccountInviteCode = "let-me-in"
+
+	tests := []struct {
+		mode    string
+		code    string
+		allowed bool
+	}{
+		{"", "", true},
+		{config.AccountCreationOpen, "", true},
+		{config.AccountCreationInvite, "let-me-in", true},
+		{config.AccountCreationInvite, "wrong-code", false},
+		{config.AccountCreationInvite, "", false},
+		{config.AccountCreationDisabled, "let-me-in", false},
+	}
+
+	for _, tc := range tests {
+		config.Current.AccountCreation = tc.mode
+
+		err := canCreateAccount(tc.code)
+		if tc.allowed && err != nil {
+			t.Errorf("mode %q code %q: expected to be allowed, got %v", tc.mode, tc.code, err)
+		} else if !tc.allowed && err == nil {
+			t.Errorf("mode %q code %q: expected to be refused", tc.mode, tc.code)
+		}
+	}
+}
+
+func TestCreateAccountGateReturnsForbidden(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	acct := &accounts{membership: &membership{volatile: volatile}}
+
+	config.Current.AccountCreation = config.AccountCreationDisabled
+
+	req := httptest.NewRequest("GET", "/account/init?email=gate@test.com", nil)
+	w := httptest.NewRecorder()
+	acct.create(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("disabled: expected status 403 got %d", w.Code)
+	}
+
+	config.Current.AccountCreation = config.AccountCreationInvite
+	config.Current.AccountInviteCode = "let-me-in"
+
+	req = httptest.NewRequest("GET", "/account/init?email=gate@test.com&ui=true&invite=nope", nil)
+	w = httptest.NewRecorder()
+	acct.create(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("invalid invite: expected status 403 got %d", w.Code)
+	}
+}
+
+func TestCreateAccountRateLimit(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+	defer func(l *cache.RateLimiter) { signupLimiter = l }(signupLimiter)
+
+	signupLimiter = cache.NewRateLimiter(100)
+	config.Current.SignupRateLimit = "3/1h"
+	config.Current.SignupDomainRateLimit = "0"
+	parseSettings(t)
+
+	acct := &accounts{membership: &membership{volatile: volatile}}
+
+	signup := func(email, ip string) int {
+		req := httptest.NewRequest("GET", "/account/init?email="+email, nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		acct.create(w, req)
+		return w.Code
+	}
+
+	// the existing email is refused after being counted, no account is
+	// created by the test
+	for i := 0; i < 3; i++ {
+		if code := signup(admEmail, "10.0.0.1"); code == http.StatusTooManyRequests {
+			t.Fatalf("signup %d: expected to be under the cap", i+1)
+		}
+	}
+
+	if code := signup(admEmail, "10.0.0.1"); code != http.StatusTooManyRequests {
+		t.Errorf("expected status 429 past the cap got %d", code)
+	} else if code := signup(admEmail, "10.0.0.2"); code == http.StatusTooManyRequests {
+		t.Errorf("expected another IP to have its own cap")
+	}
+
+	config.Current.SignupRateLimit = "0"
+	config.Current.SignupDomainRateLimit = "1/1h"
+	parseSettings(t)
+
+	if code := signup(admEmail, "10.0.0.3"); code == http.StatusTooManyRequests {
+		t.Fatal("expected the first signup of the domain to be under the cap")
+	} else if code := signup(admEmail, "10.0.0.4"); code != http.StatusTooManyRequests {
+		t.Errorf("expected status 429 past the domain cap got %d", code)
+	}
+}
+
+func TestCreateAccountDisposableEmail(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+	defer func(l *cache.RateLimiter) { signupLimiter = l }(signupLimiter)
+
+	signupLimiter = cache.NewRateLimiter(100)
+
+	acct := &accounts{membership: &membership{volatile: volatile}}
+
+	signup := func(email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/account/init?email="+email, nil)
+		w := httptest.NewRecorder()
+		acct.create(w, req)
+		return w
+	}
+
+	// off by default, the existing email is refused after the check so no
+	// account is created by the test
+	if isDisposableEmail("bot@mailinator.com") {
+		t.Errorf("expected no domain to be refused by default")
+	}
+
+	config.Current.DisposableDomains = "mailinator.com"
+	parseSettings(t)
+
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	if err := os.WriteFile(path, []byte("yopmail.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config.Current.DisposableDomainsFile = path
+
+	for _, email := range []string{"bot@mailinator.com", "bot@yopmail.com"} {
+		w := signup(email)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "disposable") {
+			t.Errorf("%s: expected status 400 got %d %s", email, w.Code, w.Body.String())
+		}
+	}
+
+	if w := signup(admEmail); w.Code == http.StatusBadRequest {
+		t.Errorf("expected %s to be allowed got %s", admEmail, w.Body.String())
+	}
+}
+
+func TestMemoryModeAllowed(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	tests := []struct {
+		env     string
+		flag    string
+		allowed bool
+	}{
+		{AppEnvDev, "", true},
+		{AppEnvProd, "", false},
+		{AppEnvDev, "no", false},
+		{AppEnvProd, "yes", true},
+		{AppEnvProd, "no", false},
+		{AppEnvDev, "yes", true},
+	}
+
+	for _, tc := range tests {
+		config.Current.AppEnv = tc.env
+		config.Current.AllowMemoryMode = tc.flag
+
+		if allowed := memoryModeAllowed(); allowed != tc.allowed {
+			t.Errorf("env %q flag %q: expected %v got %v", tc.env, tc.flag, tc.allowed, allowed)
+		}
+	}
+}
+
+func TestMemoryModeCredentials(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.MemoryModeDBName = ""
+	config.Current.MemoryModePassword = ""
+
+	dbName, pw, err := memoryModeCredentials(url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	} else if dbName != "dev-memory-pk" || pw != "devpw1234" {
+		t.Errorf("expected defaults got %s / %s", dbName, pw)
+	}
+
+	config.Current.MemoryModeDBName = "dev-config-db"
+	config.Current.MemoryModePassword = "configpw"
+
+	dbName, pw, err = memoryModeCredentials(url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	} else if dbName != "dev-config-db" || pw != "configpw" {
+		t.Errorf("expected config overrides got %s / %s", dbName, pw)
+	}
+
+	qs := url.Values{}
+	qs.Set("db", "dev-second")
+	qs.Set("pw", "querypw1")
+
+	dbName, pw, err = memoryModeCredentials(qs)
+	if err != nil {
+		t.Fatal(err)
+	} else if dbName != "dev-second" || pw != "querypw1" {
+		t.Errorf("expected query string overrides got %s / %s", dbName, pw)
+	}
+
+	qs.Set("db", "1; DROP SCHEMA")
+	if _, _, err := memoryModeCredentials(qs); err == nil {
+		t.Errorf("expected invalid database name to be rejected")
+	}
+
+	qs.Set("db", "dev-second")
+	qs.Set("pw", "123")
+	if _, _, err := memoryModeCredentials(qs); err == nil {
+		t.Errorf("expected short password to be rejected")
+	}
+}
+
+func TestCreateAccountMemoryModeReturnsCredentials(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.AccountCreation = config.AccountCreationOpen
+	config.Current.AllowMemoryMode = "yes"
+
+	acct := &accounts{membership: &membership{volatile: volatile}}
+
+	req := httptest.NewRequest("GET", "/account/init?email=memmode@test.com&mem=1&db=devmemjson&pw=jsonpw123", nil)
+	w := httptest.NewRecorder()
+	acct.create(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+
+	var result memoryModeResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Email != "memmode@test.com" || result.Password != "jsonpw123" {
+		t.Errorf("unexpected credentials %v", result)
+	} else if len(result.PublicKey) == 0 || len(result.RootToken) == 0 {
+		t.Errorf("expected public key and root token in %v", result)
+	}
+}
+
+func TestSupportEmailReplyTo(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.FromEmail = "noreply@test.com"
+	config.Current.SupportEmail = ""
+	if got := supportEmail(); got != "noreply@test.com" {
+		t.Errorf("expected the from email as fallback got %s", got)
+	}
+
+	config.Current.SupportEmail = "support@test.com"
+	if got := supportEmail(); got != "support@test.com" {
+		t.Errorf("expected support@test.com got %s", got)
+	}
+}
+
+func TestRotateRootToken(t *testing.T) {
+	conf, err := datastore.FindDatabaseByKey(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &membership{volatile: volatile}
+	_, tok, err := m.createAccountAndUser(conf, "rotateroot@test.com", password, 100, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken := fmt.Sprintf("%s|%s|%s", tok.ID, tok.AccountID, tok.Token)
+
+	acct := &accounts{membership: m}
+	h := middleware.Chain(
+		http.HandlerFunc(acct.rotateRootToken),
+		middleware.RequireActiveBase(datastore, volatile),
+		middleware.RequireRoot(datastore),
+	)
+
+	rotate := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/account/rotatetoken", nil)
+		req.Header.Set("SB-PUBLIC-KEY", pubKey)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := rotate(oldToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+
+	var result struct {
+		RootToken string `json:"rootToken"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	} else if result.RootToken == oldToken {
+		t.Fatal("expected a new root token")
+	}
+
+	if _, err := middleware.ValidateRootToken(datastore, conf.Name, oldToken); err == nil {
+		t.Error("expected the old root token to be rejected")
+	}
+	if _, err := middleware.ValidateRootToken(datastore, conf.Name, result.RootToken); err != nil {
+		t.Errorf("expected the new root token to be valid got %v", err)
+	}
+
+	if w := rotate(oldToken); w.Code == http.StatusOK {
+		t.Error("expected rotation with the old root token to be rejected")
+	}
+}
+
+func TestRotatedKeyGracePeriod(t *testing.T) {
+	key := datastore.NewID()
+	if err := volatile.SetTyped(key, internal.BaseConfig{ID: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := expirePreviousKey(volatile, key, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if previousKeyExpired(volatile, key) {
+		t.Errorf("expected the previous key to resolve during its grace period")
+	}
+
+	var conf internal.BaseConfig
+	if err := volatile.GetTyped(key, &conf); err != nil {
+		t.Fatal(err)
+	} else if conf.ID != key {
+		t.Errorf("expected the cached base to be kept got %v", conf)
+	}
+
+	if err := expirePreviousKey(volatile, key, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	} else if !previousKeyExpired(volatile, key) {
+		t.Errorf("expected the previous key to be expired")
+	}
+}
+
+func TestChangePlan(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+	config.Current.StripePriceIDTraction = "price_traction"
+
+	var updated url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			if err := r.ParseForm(); err != nil {
+				t.Error(err)
+			}
+			updated = r.PostForm
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"id": "sub_plan",
+			"object": "subscription",
+			"items": {"object": "list", "data": [{"id": "si_plan", "object": "subscription_item"}]}
+		}`))
+	}))
+	defer srv.Close()
+
+	defer func(b stripe.Backend) { stripe.SetBackend(stripe.APIBackend, b) }(stripe.GetBackend(stripe.APIBackend))
+	stripe.SetBackend(stripe.APIBackend, newStripeBackend(stripe.APIVersion, stripe.String(srv.URL)))
+
+	cus, err := datastore.CreateCustomer(internal.Customer{
+		Email:          fmt.Sprintf("plan-%s@test.com", datastore.NewID()),
+		StripeID:       "cus_plan",
+		SubscriptionID: "sub_plan",
+		Plan:           internal.PlanIdea,
+		IsActive:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := changeSubscriptionPlan(cus, internal.PlanTraction, planPriceID(internal.PlanTraction, "")); err != nil {
+		t.Fatal(err)
+	}
+
+	if updated.Get("items[0][id]") != "si_plan" || updated.Get("items[0][price]") != "price_traction" {
+		t.Errorf("expected the subscription item to use the new price got %v", updated)
+	} else if updated.Get("proration_behavior") != "create_prorations" {
+		t.Errorf("expected the change to be prorated got %v", updated)
+	}
+
+	cus, err = datastore.FindAccount(cus.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if cus.Plan != internal.PlanTraction {
+		t.Errorf("expected plan %d got %d", internal.PlanTraction, cus.Plan)
+	}
+
+	acct := &accounts{}
+	resp := dbReq(t, acct.changePlan, "POST", "/account/plan", map[string]string{"plan": "unknown"}, true)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an unknown plan got %d", resp.StatusCode)
+	}
+
+	// the test account has no subscription
+	resp = dbReq(t, acct.changePlan, "POST", "/account/plan", map[string]string{"plan": "traction"}, true)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 without a subscription got %d", resp.StatusCode)
+	}
+}
+
+func TestAccountCreatedSendsEmail(t *testing.T) {
+	defer func(m internal.Mailer) { emailer = m }(emailer)
+
+	mm := &mockMailer{}
+	emailer = mm
+
+	ev := events.AccountCreated{PublicKey: "pk_123", Email: "created@test.com", Password: "pw", RootToken: "a|b|c"}
+	if err := events.Emit(ev); err != nil {
+		t.Fatal(err)
+	} else if len(mm.sent) != 1 {
+		t.Fatalf("expected 1 email sent got %d", len(mm.sent))
+	}
+
+	sent := mm.sent[0]
+	if sent.To != "created@test.com" || sent.Subject != accountCreatedEmail.Subject {
+		t.Errorf("unexpected email %v", sent)
+	} else if !strings.Contains(sent.TextBody, "pk_123") {
+		t.Errorf("expected the public key in the email got %s", sent.TextBody)
+	}
+}
+
+func TestAccountCreatedEmailBranding(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+	defer func(m internal.Mailer) { emailer = m }(emailer)
+
+	mm := &mockMailer{}
+	emailer = mm
+
+	config.Current.FromName = "StaticBackend"
+	config.Current.EmailSubjects = "account-created=Your account;acme/account-created=Welcome to {{.Base}}, {{.Email}}"
+	config.Current.EmailFromNames = "acme=Acme"
+	parseSettings(t)
+
+	for _, base := range []string{"acme", "other"} {
+		ev := events.AccountCreated{Base: base, PublicKey: "pk_123", Email: "branded@test.com", Password: "pw", RootToken: "a|b|c"}
+		if err := events.Emit(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(mm.sent) != 2 {
+		t.Fatalf("expected 2 emails sent got %d", len(mm.sent))
+	} else if sent := mm.sent[0]; sent.Subject != "Welcome to acme, branded@test.com" || sent.FromName != "Acme" {
+		t.Errorf("expected the branding of the base got %q from %q", sent.Subject, sent.FromName)
+	} else if sent := mm.sent[1]; sent.Subject != "Your account" || sent.FromName != "StaticBackend" {
+		t.Errorf("expected the email type subject and default from-name got %q from %q", sent.Subject, sent.FromName)
+	}
+}
+
+func TestCreateAccountCardRequired(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.AppEnv = AppEnvProd
+	config.Current.StripeKey = "sk_live_123"
+	config.Current.StripePriceIDIdea = "price_idea"
+	config.Current.SignupMode = config.SignupModeCard
+
+	stripeID := "cus_" + datastore.NewID()
+
+	var subscription url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if r.URL.Path == "/v1/subscriptions" {
+			subscription = r.PostForm
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id": "%s", "url": "https://billing.test/session"}`, stripeID)
+	}))
+	defer srv.Close()
+
+	defer func(b stripe.Backend) { stripe.SetBackend(stripe.APIBackend, b) }(stripe.GetBackend(stripe.APIBackend))
+	stripe.SetBackend(stripe.APIBackend, newStripeBackend(stripe.APIVersion, stripe.String(srv.URL)))
+
+	acct := &accounts{membership: &membership{volatile: volatile}}
+
+	email := fmt.Sprintf("card-%s@test.com", randStringRunes(8))
+	w := httptest.NewRecorder()
+	acct.create(w, httptest.NewRequest("GET", "/account/init?email="+email, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+
+	if subscription.Get("trial_period_days") != "" {
+		t.Errorf("expected no trial got %v", subscription)
+	} else if subscription.Get("payment_behavior") != "default_incomplete" {
+		t.Errorf("expected an incomplete subscription got %v", subscription)
+	}
+
+	cus, err := datastore.GetCustomerByStripeID(stripeID)
+	if err != nil {
+		t.Fatal(err)
+	} else if cus.IsActive {
+		t.Fatal("expected the account to be inactive until a payment method is attached")
+	}
+
+	wh := &stripeWebhook{}
+	wh.handlePaymentMethodAttached(stripe.PaymentMethod{Customer: &stripe.Customer{ID: stripeID}})
+
+	cus, err = datastore.FindAccount(cus.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if !cus.IsActive {
+		t.Errorf("expected the account to be activated once a payment method is attached")
+	}
+}
+
+func TestNewSubscriptionParamsTrial(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.SignupMode = ""
+	params := newSubscriptionParams("cus_trial", "price_idea")
+	if params.TrialPeriodDays == nil || *params.TrialPeriodDays != trialDays {
+		t.Errorf("expected a %d days trial by default", trialDays)
+	} else if params.PaymentBehavior != nil {
+		t.Errorf("expected the default payment behavior got %s", *params.PaymentBehavior)
+	}
+}
+
+func TestRandStringRunesSource(t *testing.T) {
+	defer func(src io.Reader) { randSource = src }(randSource)
+
+	randSource = rand.New(rand.NewSource(42))
+
+	expected := []string{"anx2MCyGm53R", "aCve3t"}
+	for _, want := range expected {
+		if got := randStringRunes(len(want)); got != want {
+			t.Errorf("expected %s got %s", want, got)
+		}
+	}
+
+	// the same seed produces the same values
+	randSource = rand.New(rand.NewSource(42))
+	if got := randStringRunes(12); got != expected[0] {
+		t.Errorf("expected %s with the same seed got %s", expected[0], got)
+	}
+}
+
+func TestBaseFeatures(t *testing.T) {
+	acct := &accounts{}
+
+	h := middleware.Chain(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		middleware.RequireActiveBase(datastore, volatile),
+		middleware.RequireFeature(internal.FeatureFunctions),
+	)
+	call := func() int {
+		req := httptest.NewRequest("POST", "/fn/exec/", nil)
+		req.Header.Set("SB-PUBLIC-KEY", pubKey)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	resp := dbReq(t, acct.features, "POST", "/account/features", map[string]bool{"unknown": false}, true)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an unknown feature got %d", resp.StatusCode)
+	}
+
+	resp = dbReq(t, acct.features, "POST", "/account/features", map[string]bool{internal.FeatureFunctions: false}, true)
+	defer dbReq(t, acct.features, "POST", "/account/features", map[string]bool{internal.FeatureFunctions: true}, true)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	var features map[string]bool
+	if err := parseBody(resp.Body, &features); err != nil {
+		t.Fatal(err)
+	} else if features[internal.FeatureFunctions] || !features[internal.FeatureRealtime] {
+		t.Errorf("expected only functions to be disabled got %v", features)
+	}
+
+	if code := call(); code != http.StatusForbidden {
+		t.Errorf("expected status 403 for a disabled feature got %d", code)
+	}
+
+	resp = dbReq(t, acct.features, "POST", "/account/features", map[string]bool{internal.FeatureFunctions: true}, true)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	if code := call(); code != http.StatusOK {
+		t.Errorf("expected status 200 for an enabled feature got %d", code)
+	}
+}
+
+func TestExecEnvFeatureDisabled(t *testing.T) {
+	acct := &accounts{}
+
+	base, err := datastore.FindDatabaseByKey(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a session cached before the feature is disabled
+	token := datastore.NewID()
+	if err := volatile.SetTyped("base:"+token, base); err != nil {
+		t.Fatal(err)
+	} else if err := middleware.AuthTokens(volatile).SetAuth(token, internal.Auth{AccountID: base.CustomerID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := execEnv(token); err != nil {
+		t.Fatalf("expected the functions to run got %v", err)
+	}
+
+	resp := dbReq(t, acct.features, "POST", "/account/features", map[string]bool{internal.FeatureFunctions: false}, true)
+	defer dbReq(t, acct.features, "POST", "/account/features", map[string]bool{internal.FeatureFunctions: true}, true)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	if _, err := execEnv(token); err == nil {
+		t.Errorf("expected the functions to be refused once disabled")
+	}
+}
+
+func TestBasePublicAliases(t *testing.T) {
+	acct := &accounts{}
+
+	resp := dbReq(t, acct.publicAliases, "POST", "/account/aliases", map[string]string{"posts": "posts"}, true)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a private collection got %d", resp.StatusCode)
+	}
+
+	resp = dbReq(t, acct.publicAliases, "POST", "/account/aliases", map[string]string{"posts": "pub_posts"}, true)
+	defer dbReq(t, acct.publicAliases, "POST", "/account/aliases", map[string]string{}, true)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	h := middleware.Chain(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			respond(w, http.StatusOK, r.URL.Path)
+		}),
+		middleware.RequireActiveBase(datastore, volatile),
+		middleware.ResolveAliases(),
+	)
+
+	req := httptest.NewRequest("GET", "/db/posts", nil)
+	req.Header.Set("SB-PUBLIC-KEY", pubKey)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	var path string
+	if err := json.NewDecoder(w.Body).Decode(&path); err != nil {
+		t.Fatal(err)
+	} else if path != "/db/pub_posts" {
+		t.Errorf("expected the alias of the base to resolve to /db/pub_posts got %s", path)
+	}
+}
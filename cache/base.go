@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+type baseEntry struct {
+	conf    internal.BaseConfig
+	expires time.Time
+}
+
+// BaseCache is a bounded in-process cache of public key to BaseConfig
+// lookups. Entries expire after the TTL so a change made by another
+// instance is picked up, local changes should call Invalidate.
+type BaseCache struct {
+	maxEntries int
+	ttl        time.Duration
+
+	mu      sync.Mutex
+	entries map[string]baseEntry
+}
+
+// NewBaseCache returns a BaseCache holding at most maxEntries bases for ttl.
+func NewBaseCache(maxEntries int, ttl time.Duration) *BaseCache {
+	return &BaseCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		entries:    make(map[string]baseEntry),
+	}
+}
+
+// Get returns the cached base for the public key pk.
+func (c *BaseCache) Get(pk string) (internal.BaseConfig, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[pk]
+	if !ok {
+		return internal.BaseConfig{}, false
+	} else if time.Now().After(e.expires) {
+		delete(c.entries, pk)
+		return internal.BaseConfig{}, false
+	}
+	return e.conf, true
+}
+
+// Set caches conf for the public key pk, the entry closest to expiration
+// is evicted when the cache is full.
+func (c *BaseCache) Set(pk string, conf internal.BaseConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[pk]; !ok && len(c.entries) >= c.maxEntries {
+		c.evict()
+	}
+
+	c.entries[pk] = baseEntry{conf: conf, expires: time.Now().Add(c.ttl)}
+}
+
+// Invalidate removes the public key pk from the cache.
+func (c *BaseCache) Invalidate(pk string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, pk)
+}
+
+// InvalidateCustomer removes all bases of a customer, used when the
+// customer is (de)activated.
+func (c *BaseCache) InvalidateCustomer(customerID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for pk, e := range c.entries {
+		if e.conf.CustomerID == customerID {
+			delete(c.entries, pk)
+		}
+	}
+}
+
+func (c *BaseCache) evict() {
+	oldest := ""
+	var expires time.Time
+	for pk, e := range c.entries {
+		if len(oldest) == 0 || e.expires.Before(expires) {
+			oldest, expires = pk, e.expires
+		}
+	}
+	delete(c.entries, oldest)
+}
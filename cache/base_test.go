@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestBaseCache(t *testing.T) {
+	c := NewBaseCache(2, time.Hour)
+
+	c.Set("pk1", internal.BaseConfig{ID: "pk1", CustomerID: "cus1"})
+	c.Set("pk2", internal.BaseConfig{ID: "pk2", CustomerID: "cus2"})
+
+	if conf, ok := c.Get("pk1"); !ok || conf.ID != "pk1" {
+		t.Errorf("expected pk1 to be cached")
+	}
+
+	// full, the entry closest to expiration (pk1) is evicted
+	c.Set("pk3", internal.BaseConfig{ID: "pk3", CustomerID: "cus1"})
+	if _, ok := c.Get("pk1"); ok {
+		t.Errorf("expected pk1 to be evicted")
+	}
+
+	c.Invalidate("pk2")
+	if _, ok := c.Get("pk2"); ok {
+		t.Errorf("expected pk2 to be invalidated")
+	}
+
+	c.InvalidateCustomer("cus1")
+	if _, ok := c.Get("pk3"); ok {
+		t.Errorf("expected pk3 to be invalidated with its customer")
+	}
+}
+
+func TestBaseCacheExpiration(t *testing.T) {
+	c := NewBaseCache(10, time.Millisecond)
+
+	c.Set("pk", internal.BaseConfig{ID: "pk"})
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := c.Get("pk"); ok {
+		t.Errorf("expected entry to be expired")
+	}
+}
@@ -79,7 +79,10 @@ func (c *Cache) Dec(key string, by int64) (int64, error) {
 	return c.Rdb.DecrBy(c.Ctx, key, by).Result()
 }
 
-func (c *Cache) Subscribe(send chan internal.Command, token, channel string, close chan bool) {
+// Subscribe sends the messages of channel to send until close receives. With
+// a resume position the retained messages published after it are sent
+// first, a message is never sent twice.
+func (c *Cache) Subscribe(send chan internal.Command, token, channel, resume string, close chan bool) {
 	pubsub := c.Rdb.Subscribe(c.Ctx, channel)
 
 	if _, err := pubsub.Receive(c.Ctx); err != nil {
@@ -89,6 +92,14 @@ func (c *Cache) Subscribe(send chan internal.Command, token, channel string, clo
 
 	ch := pubsub.Channel()
 
+	// the messages published from now on are received on ch, the retained
+	// ones are the messages missed since resume
+	last, err := c.resume(send, token, channel, resume)
+	if err != nil {
+		log.Println("error resuming the subscription", err)
+		send <- internal.Command{Type: internal.MsgTypeError, Channel: channel, Data: "unable to resume the subscription"}
+	}
+
 	for {
 		select {
 		case m := <-ch:
@@ -99,15 +110,14 @@ func (c *Cache) Subscribe(send chan internal.Command, token, channel string, clo
 				return
 			}
 
-			// TODO: this will need more thinking
-			if msg.Type == internal.MsgTypeChanIn {
-				msg.Type = internal.MsgTypeChanOut
-			} else if msg.IsSystemEvent {
-
-			} else if msg.IsDBEvent() && c.HasPermission(token, channel, msg.Data) == false {
+			// already sent by resume
+			if len(msg.Resume) > 0 && len(last) > 0 && !streamIDAfter(msg.Resume, last) {
 				continue
 			}
-			send <- msg
+
+			if c.allowed(&msg, token, channel) {
+				send <- msg
+			}
 		case <-close:
 			_ = pubsub.Close()
 			return
@@ -115,12 +125,56 @@ func (c *Cache) Subscribe(send chan internal.Command, token, channel string, clo
 	}
 }
 
-func (c *Cache) Publish(msg internal.Command) error {
-	b, err := json.Marshal(msg)
+// resume sends the messages retained since the resume position and the
+// MsgTypeResume message. It returns the last position sent when resuming,
+// the messages received by the subscription up to it are duplicates.
+// Nothing is sent when the channel's messages are not retained.
+func (c *Cache) resume(send chan internal.Command, token, channel, resume string) (string, error) {
+	if config.Current.Settings.RealtimeHistorySize == 0 {
+		return "", nil
+	}
+
+	last, err := c.position(channel)
 	if err != nil {
-		return err
+		return "", err
+	} else if len(resume) == 0 {
+		send <- internal.Command{Type: internal.MsgTypeResume, Channel: channel, Resume: last}
+		return "", nil
+	}
+
+	msgs, err := c.replay(channel, resume)
+	if err != nil {
+		return "", err
+	}
+
+	for _, msg := range msgs {
+		if c.allowed(&msg, token, channel) {
+			send <- msg
+		}
+		if streamIDAfter(msg.Resume, last) {
+			last = msg.Resume
+		}
+	}
+
+	send <- internal.Command{Type: internal.MsgTypeResume, Channel: channel, Resume: last}
+	return last, nil
+}
+
+// allowed returns if msg can be sent to the subscriber of channel having
+// token, a chan_in message is sent as chan_out.
+func (c *Cache) allowed(msg *internal.Command, token, channel string) bool {
+	// TODO: this will need more thinking
+	if msg.Type == internal.MsgTypeChanIn {
+		msg.Type = internal.MsgTypeChanOut
+	} else if msg.IsSystemEvent {
+
+	} else if msg.IsDBEvent() && c.HasPermission(token, channel, msg.Data) == false {
+		return false
 	}
+	return true
+}
 
+func (c *Cache) Publish(msg internal.Command) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
 	defer cancel()
 
@@ -140,6 +194,15 @@ func (c *Cache) Publish(msg internal.Command) error {
 		}
 	}(msg)
 
+	msg = msg.ClientVisible()
+	if err := c.retain(ctx, &msg); err != nil {
+		log.Println("error retaining the message: ", err)
+	}
+
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
 	return c.Rdb.Publish(ctx, msg.Channel, string(b)).Err()
 }
 
@@ -154,7 +217,8 @@ func (c *Cache) PublishDocument(channel, typ string, v interface{}) {
 	if !ok {
 		fmt.Println("cannot find channel in subs", channel)
 		return
-	} else if count == 0 {
+	} else if count == 0 && config.Current.Settings.RealtimeHistorySize == 0 {
+		// retained events are published for the resumed subscriptions
 		return
 	}
 
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type collectionEntry struct {
+	names   []string
+	expires time.Time
+}
+
+// CollectionCache is an in-process cache of the collection names of each
+// base so the collection limit is not checked against the datastore on
+// every insert. Entries expire after the TTL so the collections created by
+// another instance are picked up, local changes should call Invalidate.
+type CollectionCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]collectionEntry
+}
+
+// NewCollectionCache returns a CollectionCache holding the names for ttl.
+func NewCollectionCache(ttl time.Duration) *CollectionCache {
+	return &CollectionCache{
+		ttl:     ttl,
+		entries: make(map[string]collectionEntry),
+	}
+}
+
+// Get returns the cached collection names of the base dbName.
+func (c *CollectionCache) Get(dbName string) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[dbName]
+	if !ok {
+		return nil, false
+	} else if time.Now().After(e.expires) {
+		delete(c.entries, dbName)
+		return nil, false
+	}
+	return e.names, true
+}
+
+// Set caches the collection names of the base dbName.
+func (c *CollectionCache) Set(dbName string, names []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[dbName] = collectionEntry{names: names, expires: time.Now().Add(c.ttl)}
+}
+
+// Invalidate removes the collection names of the base dbName from the
+// cache.
+func (c *CollectionCache) Invalidate(dbName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, dbName)
+}
@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCollectionCache(t *testing.T) {
+	c := NewCollectionCache(time.Hour)
+
+	if _, ok := c.Get("base"); ok {
+		t.Fatal("expected an empty cache")
+	}
+
+	c.Set("base", []string{"tasks"})
+	if names, ok := c.Get("base"); !ok || len(names) != 1 {
+		t.Errorf("expected the collections to be cached got %v", names)
+	}
+
+	c.Invalidate("base")
+	if _, ok := c.Get("base"); ok {
+		t.Errorf("expected the collections to be invalidated")
+	}
+
+	c = NewCollectionCache(-time.Second)
+	c.Set("base", []string{"tasks"})
+	if _, ok := c.Get("base"); ok {
+		t.Errorf("expected the collections to expire")
+	}
+}
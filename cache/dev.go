@@ -60,7 +60,7 @@ func (d *CacheDev) Dec(key string, by int64) (int64, error) {
 	return d.Inc(key, -1*by)
 }
 
-func (d *CacheDev) Subscribe(send chan internal.Command, token, channel string, close chan bool) {
+func (d *CacheDev) Subscribe(send chan internal.Command, token, channel, resume string, close chan bool) {
 	//TODO: implement this
 }
 
@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/staticbackendhq/core/config"
+	"github.com/staticbackendhq/core/internal"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// The messages of a channel are retained in a Redis stream, the id of their
+// entry is their Resume position.
+
+func historyKey(channel string) string {
+	return "history:" + channel
+}
+
+// retain adds msg to the history of its channel and sets its Resume
+// position, see REALTIME_HISTORY.
+func (c *Cache) retain(ctx context.Context, msg *internal.Command) error {
+	size, ttl := config.Current.Settings.RealtimeHistorySize, config.Current.Settings.RealtimeHistoryTTL
+	if size == 0 || msg.Type == internal.MsgTypeJoined {
+		return nil
+	}
+
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	key := historyKey(msg.Channel)
+	id, err := c.Rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		MaxLen: int64(size),
+		Values: map[string]interface{}{"msg": string(b)},
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	msg.Resume = id
+	return c.Rdb.Expire(ctx, key, ttl).Err()
+}
+
+// position returns the Resume position of the last message retained on
+// channel, "0-0" when there's none.
+func (c *Cache) position(channel string) (string, error) {
+	entries, err := c.Rdb.XRevRangeN(c.Ctx, historyKey(channel), "+", "-", 1).Result()
+	if err != nil {
+		return "", err
+	} else if len(entries) == 0 {
+		return "0-0", nil
+	}
+	return entries[0].ID, nil
+}
+
+// replay returns the messages retained on channel after the resume position,
+// the ones older than REALTIME_HISTORY_TTL are skipped.
+func (c *Cache) replay(channel, resume string) ([]internal.Command, error) {
+	if _, _, ok := parseStreamID(resume); !ok {
+		return nil, errors.New("invalid resume position")
+	}
+
+	entries, err := c.Rdb.XRange(c.Ctx, historyKey(channel), resume, "+").Result()
+	if err != nil {
+		return nil, err
+	}
+
+	oldest := time.Now().Add(-config.Current.Settings.RealtimeHistoryTTL)
+
+	var msgs []internal.Command
+	for _, e := range entries {
+		if !streamIDAfter(e.ID, resume) || streamIDTime(e.ID).Before(oldest) {
+			continue
+		}
+
+		s, _ := e.Values["msg"].(string)
+
+		var msg internal.Command
+		if err := json.Unmarshal([]byte(s), &msg); err != nil {
+			return nil, err
+		}
+
+		msg.Resume = e.ID
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// parseStreamID parses a Redis stream id, "milliseconds-sequence".
+func parseStreamID(id string) (ms, seq uint64, ok bool) {
+	a, b, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	ms, err := strconv.ParseUint(a, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	seq, err = strconv.ParseUint(b, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return ms, seq, true
+}
+
+// streamIDAfter returns if the stream id a comes after b.
+func streamIDAfter(a, b string) bool {
+	ams, aseq, _ := parseStreamID(a)
+	bms, bseq, _ := parseStreamID(b)
+	return ams > bms || (ams == bms && aseq > bseq)
+}
+
+func streamIDTime(id string) time.Time {
+	ms, _, _ := parseStreamID(id)
+	return time.UnixMilli(int64(ms))
+}
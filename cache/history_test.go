@@ -0,0 +1,28 @@
+package cache
+
+import "testing"
+
+func TestStreamIDAfter(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		after bool
+	}{
+		{"1700000000001-0", "1700000000000-5", true},
+		{"1700000000000-6", "1700000000000-5", true},
+		{"1700000000000-5", "1700000000000-5", false},
+		{"1700000000000-4", "1700000000000-5", false},
+		{"1700000000000-0", "0-0", true},
+	}
+
+	for _, tc := range tests {
+		if got := streamIDAfter(tc.a, tc.b); got != tc.after {
+			t.Errorf("%s after %s: expected %v got %v", tc.a, tc.b, tc.after, got)
+		}
+	}
+
+	for _, id := range []string{"", "12", "a-1", "1-b"} {
+		if _, _, ok := parseStreamID(id); ok {
+			t.Errorf("expected %q to be an invalid stream id", id)
+		}
+	}
+}
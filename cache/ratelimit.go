@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type rateWindow struct {
+	count   int
+	expires time.Time
+}
+
+// RateLimiter counts events per key in fixed windows. The counts are kept
+// in-process so each instance enforces its own limits.
+type RateLimiter struct {
+	maxKeys int
+	// now is replaced by the tests
+	now func() time.Time
+
+	mu      sync.Mutex
+	windows map[string]rateWindow
+}
+
+// NewRateLimiter returns a RateLimiter tracking at most maxKeys keys.
+func NewRateLimiter(maxKeys int) *RateLimiter {
+	return &RateLimiter{
+		maxKeys: maxKeys,
+		now:     time.Now,
+		windows: make(map[string]rateWindow),
+	}
+}
+
+// Allow counts an event for key and returns false once more than limit
+// events happened in its window, a zero limit allows everything.
+func (l *RateLimiter) Allow(key string, limit int, window time.Duration) bool {
+	if limit <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	w, ok := l.windows[key]
+	if !ok || !now.Before(w.expires) {
+		if !ok && len(l.windows) >= l.maxKeys {
+			l.evict(now)
+		}
+		w = rateWindow{expires: now.Add(window)}
+	}
+
+	w.count++
+	l.windows[key] = w
+	return w.count <= limit
+}
+
+// evict removes the expired windows or the one closest to expiration when
+// none are.
+func (l *RateLimiter) evict(now time.Time) {
+	oldest := ""
+	var expires time.Time
+	for key, w := range l.windows {
+		if !now.Before(w.expires) {
+			delete(l.windows, key)
+		} else if len(oldest) == 0 || w.expires.Before(expires) {
+			oldest, expires = key, w.expires
+		}
+	}
+
+	if len(l.windows) >= l.maxKeys {
+		delete(l.windows, oldest)
+	}
+}
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	l := NewRateLimiter(2)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow("a", 3, time.Minute) {
+			t.Fatalf("expected event %d to be allowed", i+1)
+		}
+	}
+	if l.Allow("a", 3, time.Minute) {
+		t.Errorf("expected the 4th event to exceed the limit")
+	} else if !l.Allow("b", 3, time.Minute) {
+		t.Errorf("expected another key to have its own count")
+	}
+
+	now = now.Add(time.Minute)
+	if !l.Allow("a", 3, time.Minute) {
+		t.Errorf("expected a new window once the previous one expired")
+	}
+
+	if !l.Allow("c", 0, time.Minute) {
+		t.Errorf("expected a zero limit to allow everything")
+	}
+}
+
+func TestRateLimiterEvicts(t *testing.T) {
+	now := time.Now()
+	l := NewRateLimiter(2)
+	l.now = func() time.Time { return now }
+
+	l.Allow("a", 1, time.Minute)
+	l.Allow("b", 1, 2*time.Minute)
+	l.Allow("c", 1, 2*time.Minute)
+
+	if len(l.windows) != 2 {
+		t.Fatalf("expected at most 2 keys got %d", len(l.windows))
+	} else if _, ok := l.windows["a"]; ok {
+		t.Errorf("expected the window closest to expiration to be evicted")
+	}
+}
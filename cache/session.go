@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+type issuedSession struct {
+	ID      string    `json:"id"`
+	Expires time.Time `json:"expires"`
+}
+
+// SessionStore tracks the JWTs issued to each user by their JWT ID so their
+// number can be capped, see MAX_TOKENS_PER_USER. The sessions are kept in
+// the shared cache (Redis) so they're the same across instances.
+type SessionStore struct {
+	Volatile internal.PubSuber
+
+	// now is replaced by the tests
+	now func() time.Time
+}
+
+// sessionsMu serializes the read-modify-write of the sessions in this
+// instance.
+var sessionsMu sync.Mutex
+
+// NewSessionStore returns a SessionStore using volatile.
+func NewSessionStore(volatile internal.PubSuber) SessionStore {
+	return SessionStore{Volatile: volatile, now: time.Now}
+}
+
+// Open adds the session id expiring at expires to the sessions of user.
+// When the user already has max sessions it returns internal.ErrTokenLimit,
+// or with evict ends their oldest sessions to make room.
+func (s SessionStore) Open(user, id string, expires time.Time, max int, evict bool) error {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	sessions := s.active(user)
+	if len(sessions) >= max {
+		if !evict {
+			return internal.ErrTokenLimit
+		}
+		sessions = sessions[len(sessions)-max+1:]
+	}
+
+	sessions = append(sessions, issuedSession{ID: id, Expires: expires})
+	return s.Volatile.SetTyped(sessionsKey(user), sessions)
+}
+
+// Active returns if the session id of user was opened and is not expired
+// nor evicted.
+func (s SessionStore) Active(user, id string) bool {
+	for _, sess := range s.active(user) {
+		if sess.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// active returns the non-expired sessions of user, oldest first.
+func (s SessionStore) active(user string) []issuedSession {
+	var sessions []issuedSession
+	if err := s.Volatile.GetTyped(sessionsKey(user), &sessions); err != nil {
+		return nil
+	}
+
+	now := s.now()
+	active := sessions[:0]
+	for _, sess := range sessions {
+		if now.Before(sess.Expires) {
+			active = append(active, sess)
+		}
+	}
+	return active
+}
+
+func sessionsKey(user string) string {
+	return "sessions:" + user
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestSessionStoreReject(t *testing.T) {
+	s := NewSessionStore(NewDevCache())
+	expires := time.Now().Add(time.Hour)
+
+	for _, id := range []string{"a", "b"} {
+		if err := s.Open("user", id, expires, 2, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Open("user", "c", expires, 2, false); !errors.Is(err, internal.ErrTokenLimit) {
+		t.Fatalf("expected ErrTokenLimit got %v", err)
+	}
+
+	for id, active := range map[string]bool{"a": true, "b": true, "c": false} {
+		if s.Active("user", id) != active {
+			t.Errorf("expected session %s active to be %v", id, active)
+		}
+	}
+
+	// other users have their own sessions
+	if err := s.Open("other", "d", expires, 2, false); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSessionStoreEvictOldest(t *testing.T) {
+	s := NewSessionStore(NewDevCache())
+	expires := time.Now().Add(time.Hour)
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := s.Open("user", id, expires, 2, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for id, active := range map[string]bool{"a": false, "b": true, "c": true} {
+		if s.Active("user", id) != active {
+			t.Errorf("expected session %s active to be %v", id, active)
+		}
+	}
+}
+
+func TestSessionStoreExpired(t *testing.T) {
+	s := NewSessionStore(NewDevCache())
+
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	if err := s.Open("user", "a", now.Add(time.Minute), 1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// the expired sessions are not counted
+	now = now.Add(2 * time.Minute)
+	if s.Active("user", "a") {
+		t.Error("expected the expired session to be inactive")
+	} else if err := s.Open("user", "b", now.Add(time.Minute), 1, false); err != nil {
+		t.Errorf("expected room once the session expired got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+// MemoryTokenStore is an in-process TokenStore holding at most maxEntries
+// tokens, the oldest token is evicted when it's full. Each instance has its
+// own cache.
+type MemoryTokenStore struct {
+	maxEntries int
+
+	mu     sync.RWMutex
+	tokens map[string]internal.Auth
+	order  []string
+
+	evictions int64
+}
+
+// NewMemoryTokenStore returns an in-process TokenStore.
+func NewMemoryTokenStore(maxEntries int) *MemoryTokenStore {
+	return &MemoryTokenStore{
+		maxEntries: maxEntries,
+		tokens:     make(map[string]internal.Auth),
+	}
+}
+
+func (m *MemoryTokenStore) GetAuth(token string) (internal.Auth, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	auth, ok := m.tokens[token]
+	if !ok {
+		return auth, errors.New("token not found in cache")
+	}
+	return auth, nil
+}
+
+func (m *MemoryTokenStore) SetAuth(token string, auth internal.Auth) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tokens[token]; !ok {
+		if len(m.tokens) >= m.maxEntries && len(m.order) > 0 {
+			delete(m.tokens, m.order[0])
+			m.order = m.order[1:]
+			atomic.AddInt64(&m.evictions, 1)
+		}
+		m.order = append(m.order, token)
+	}
+
+	m.tokens[token] = auth
+	return nil
+}
+
+func (m *MemoryTokenStore) DeleteAuth(token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tokens[token]; !ok {
+		return nil
+	}
+
+	delete(m.tokens, token)
+	for i, t := range m.order {
+		if t == token {
+			m.order = append(m.order[:i], m.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Evictions returns the number of tokens evicted because the store was full.
+func (m *MemoryTokenStore) Evictions() int64 {
+	return atomic.LoadInt64(&m.evictions)
+}
+
+// VolatileTokenStore is a TokenStore backed by the shared cache (Redis), the
+// cached tokens are shared across instances.
+type VolatileTokenStore struct {
+	Volatile internal.PubSuber
+}
+
+// NewVolatileTokenStore returns a TokenStore using volatile.
+func NewVolatileTokenStore(volatile internal.PubSuber) VolatileTokenStore {
+	return VolatileTokenStore{Volatile: volatile}
+}
+
+func (v VolatileTokenStore) GetAuth(token string) (auth internal.Auth, err error) {
+	err = v.Volatile.GetTyped(token, &auth)
+	return
+}
+
+func (v VolatileTokenStore) SetAuth(token string, auth internal.Auth) error {
+	return v.Volatile.SetTyped(token, auth)
+}
+
+// DeleteAuth overwrites the cached token, the shared cache has no delete and
+// an empty value fails to decode in GetAuth.
+func (v VolatileTokenStore) DeleteAuth(token string) error {
+	return v.Volatile.Set(token, "")
+}
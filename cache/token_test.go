@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestMemoryTokenStoreEvictsOldest(t *testing.T) {
+	ts := NewMemoryTokenStore(2)
+
+	for _, tok := range []string{"a", "b", "c"} {
+		if err := ts.SetAuth(tok, internal.Auth{Token: tok}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := ts.GetAuth("a"); err == nil {
+		t.Error("expected oldest token to be evicted")
+	}
+	for _, tok := range []string{"b", "c"} {
+		if auth, err := ts.GetAuth(tok); err != nil {
+			t.Error(err)
+		} else if auth.Token != tok {
+			t.Errorf("expected token %s got %s", tok, auth.Token)
+		}
+	}
+
+	if n := ts.Evictions(); n != 1 {
+		t.Errorf("expected 1 eviction got %d", n)
+	}
+}
+
+func TestTokenStoresDeleteAuth(t *testing.T) {
+	stores := map[string]internal.TokenStore{
+		"memory": NewMemoryTokenStore(10),
+		"redis":  NewVolatileTokenStore(NewDevCache()),
+	}
+
+	for name, ts := range stores {
+		if err := ts.SetAuth("tok", internal.Auth{Token: "tok"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ts.DeleteAuth("tok"); err != nil {
+			t.Fatal(err)
+		} else if _, err := ts.GetAuth("tok"); err == nil {
+			t.Errorf("%s: expected deleted token to be a cache miss", name)
+		}
+	}
+}
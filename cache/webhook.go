@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+type webhookEntry struct {
+	list    []internal.Webhook
+	expires time.Time
+}
+
+// WebhookCache is an in-process cache of the webhooks of each base so a
+// document write does not list them every time. Entries expire after the
+// TTL so a change made by another instance is picked up, local changes
+// should call Invalidate.
+type WebhookCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]webhookEntry
+}
+
+// NewWebhookCache returns a WebhookCache holding the webhooks for ttl.
+func NewWebhookCache(ttl time.Duration) *WebhookCache {
+	return &WebhookCache{
+		ttl:     ttl,
+		entries: make(map[string]webhookEntry),
+	}
+}
+
+// Get returns the cached webhooks of the base dbName.
+func (c *WebhookCache) Get(dbName string) ([]internal.Webhook, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[dbName]
+	if !ok {
+		return nil, false
+	} else if time.Now().After(e.expires) {
+		delete(c.entries, dbName)
+		return nil, false
+	}
+	return e.list, true
+}
+
+// Set caches the webhooks of the base dbName.
+func (c *WebhookCache) Set(dbName string, list []internal.Webhook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[dbName] = webhookEntry{list: list, expires: time.Now().Add(c.ttl)}
+}
+
+// Invalidate removes the webhooks of the base dbName from the cache.
+func (c *WebhookCache) Invalidate(dbName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, dbName)
+}
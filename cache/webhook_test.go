@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestWebhookCache(t *testing.T) {
+	c := NewWebhookCache(time.Hour)
+
+	if _, ok := c.Get("base"); ok {
+		t.Fatal("expected an empty cache")
+	}
+
+	// a base without webhooks is cached too
+	c.Set("empty", nil)
+	if _, ok := c.Get("empty"); !ok {
+		t.Errorf("expected the empty list to be cached")
+	}
+
+	c.Set("base", []internal.Webhook{{ID: "wh1"}})
+	if list, ok := c.Get("base"); !ok || len(list) != 1 {
+		t.Errorf("expected the webhooks to be cached got %v", list)
+	}
+
+	c.Invalidate("base")
+	if _, ok := c.Get("base"); ok {
+		t.Errorf("expected the webhooks to be invalidated")
+	}
+
+	c = NewWebhookCache(-time.Second)
+	c.Set("base", []internal.Webhook{{ID: "wh1"}})
+	if _, ok := c.Get("base"); ok {
+		t.Errorf("expected the webhooks to expire")
+	}
+}
@@ -0,0 +1,238 @@
+// Package client is a typed Go client for the StaticBackend HTTP API.
+//
+// It handles the SB-PUBLIC-KEY and Authorization headers so callers only
+// deal with typed requests and responses.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+// Those aliases make the internal types usable outside of this module.
+type (
+	Customer    = internal.Customer
+	BaseConfig  = internal.BaseConfig
+	PagedResult = internal.PagedResult
+	Command     = internal.Command
+)
+
+// AccountInfo is returned by the account info endpoint.
+type AccountInfo struct {
+	Customer Customer   `json:"customer"`
+	Base     BaseConfig `json:"base"`
+}
+
+// KeyInfo is returned by VerifyKey for a valid public key.
+type KeyInfo struct {
+	Valid       bool      `json:"valid"`
+	DisplayName string    `json:"displayName"`
+	Created     time.Time `json:"created"`
+}
+
+// ListParams controls paging and sorting for List and Query.
+type ListParams struct {
+	Page       int64
+	Size       int64
+	SortBy     string
+	Descending bool
+	// SkipCount asks the server not to compute the total
+	SkipCount bool
+	// Fields restricts the returned fields, the id is always included
+	Fields []string
+}
+
+// Client calls a StaticBackend instance on behalf of a user. Token is set
+// by Login and Register, it can also be set directly with a root token.
+type Client struct {
+	BaseURL    string
+	PublicKey  string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// New returns a Client for the instance at baseURL using the public key pk.
+func New(baseURL, pk string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		PublicKey:  pk,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// APIError is returned when the server responds with a non 2xx status.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("staticbackend: %d %s", e.StatusCode, e.Message)
+}
+
+func (c *Client) request(method, path string, body, v any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, r)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("SB-PUBLIC-KEY", c.PublicKey)
+	if len(c.Token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(resp.Body)
+		return &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(b))}
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// CreateAccount initializes a new account, it returns the sign up URL.
+func (c *Client) CreateAccount(email string) (signUpURL string, err error) {
+	qs := url.Values{}
+	qs.Set("email", email)
+
+	err = c.request(http.MethodGet, "/account/init?"+qs.Encode(), nil, &signUpURL)
+	return
+}
+
+// AccountInfo returns the customer and base of the current root token.
+func (c *Client) AccountInfo() (info AccountInfo, err error) {
+	err = c.request(http.MethodGet, "/account/info", nil, &info)
+	return
+}
+
+// VerifyKey confirms the public key before authenticating a user, an
+// unknown key returns a 404 APIError and an inactive one a 403.
+func (c *Client) VerifyKey() (info KeyInfo, err error) {
+	err = c.request(http.MethodGet, "/verifykey", nil, &info)
+	return
+}
+
+// Login authenticates a user and keeps the returned token for next calls.
+func (c *Client) Login(email, password string) error {
+	return c.authenticate("/login", email, password)
+}
+
+// Register creates a user and keeps the returned token for next calls.
+func (c *Client) Register(email, password string) error {
+	return c.authenticate("/register", email, password)
+}
+
+func (c *Client) authenticate(path, email, password string) error {
+	l := internal.Login{Email: email, Password: password}
+
+	var token string
+	if err := c.request(http.MethodPost, path, l, &token); err != nil {
+		return err
+	}
+
+	c.Token = token
+	return nil
+}
+
+// Create adds doc to the collection col, the created document is decoded
+// into v.
+func (c *Client) Create(col string, doc, v any) error {
+	return c.request(http.MethodPost, "/db/"+col, doc, v)
+}
+
+// CreateIfAbsent adds doc to col unless a document matches the clauses,
+// the created document is decoded into v. A match returns a 409 APIError
+// holding the existing document when the user can read it.
+func (c *Client) CreateIfAbsent(col string, clauses [][]any, doc, v any) error {
+	body := map[string]any{"clauses": clauses, "doc": doc}
+	return c.request(http.MethodPost, "/db/"+col+"?ifabsent=true", body, v)
+}
+
+// List returns a page of documents from col.
+func (c *Client) List(col string, params ListParams) (result PagedResult, err error) {
+	err = c.request(http.MethodGet, "/db/"+col+"?"+params.encode(), nil, &result)
+	return
+}
+
+// Get decodes the document id of col into v.
+func (c *Client) Get(col, id string, v any) error {
+	return c.request(http.MethodGet, fmt.Sprintf("/db/%s/%s", col, id), nil, v)
+}
+
+// Query returns documents of col matching the clauses, each clause being a
+// field, operator and value, i.e. []any{"done", "=", true}.
+func (c *Client) Query(col string, clauses [][]any, params ListParams) (result PagedResult, err error) {
+	err = c.request(http.MethodPost, "/query/"+col+"?"+params.encode(), clauses, &result)
+	return
+}
+
+// Update replaces the document id of col by doc, the fields doc omits are
+// removed. The updated document is decoded into v.
+func (c *Client) Update(col, id string, doc, v any) error {
+	return c.request(http.MethodPut, fmt.Sprintf("/db/%s/%s", col, id), doc, v)
+}
+
+// Patch merges the fields of doc into the document id of col, the other
+// fields are kept. The updated document is decoded into v.
+func (c *Client) Patch(col, id string, doc, v any) error {
+	return c.request(http.MethodPatch, fmt.Sprintf("/db/%s/%s", col, id), doc, v)
+}
+
+// Delete removes the document id of col.
+func (c *Client) Delete(col, id string) error {
+	return c.request(http.MethodDelete, fmt.Sprintf("/db/%s/%s", col, id), nil, nil)
+}
+
+// Send publishes a realtime message via the SSE message endpoint.
+func (c *Client) Send(msg Command) error {
+	return c.request(http.MethodPost, "/sse/msg", msg, nil)
+}
+
+func (p ListParams) encode() string {
+	qs := url.Values{}
+	if p.Page > 0 {
+		qs.Set("page", fmt.Sprintf("%d", p.Page))
+	}
+	if p.Size > 0 {
+		qs.Set("size", fmt.Sprintf("%d", p.Size))
+	}
+	if len(p.SortBy) > 0 {
+		qs.Set("sort", p.SortBy)
+	}
+	if p.Descending {
+		qs.Set("desc", "1")
+	}
+	if p.SkipCount {
+		qs.Set("nocount", "1")
+	}
+	if len(p.Fields) > 0 {
+		qs.Set("fields", strings.Join(p.Fields, ","))
+	}
+	return qs.Encode()
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+// Connect opens a Server-Sent Events connection and returns the received
+// messages. The first message is of type init and carries the connection
+// id to use as Command.SID when calling Send. The channel is closed when
+// ctx is cancelled or the connection drops.
+func (c *Client) Connect(ctx context.Context) (<-chan Command, error) {
+	qs := url.Values{}
+	qs.Set("sbpk", c.PublicKey)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/sse/connect?"+qs.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	} else if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: "unable to connect"}
+	}
+
+	messages := make(chan Command)
+
+	go func() {
+		defer resp.Body.Close()
+		defer close(messages)
+
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			line := sc.Text()
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+
+			var msg Command
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &msg); err != nil {
+				msg = Command{Type: internal.MsgTypeError, Data: fmt.Sprintf("invalid message: %v", err)}
+			}
+
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return messages, nil
+}
@@ -0,0 +1,201 @@
+package staticbackend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/client"
+	"github.com/staticbackendhq/core/config"
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+	"github.com/staticbackendhq/core/realtime"
+)
+
+func newClientTestServer() *httptest.Server {
+	m := &membership{volatile: volatile}
+	acct := &accounts{membership: m}
+
+	pubWithDB := []middleware.Middleware{
+		middleware.WithDB(datastore, volatile),
+	}
+	stdAuth := []middleware.Middleware{
+		middleware.WithDB(datastore, volatile),
+		middleware.RequireAuth(datastore, volatile),
+	}
+	stdRoot := []middleware.Middleware{
+		middleware.WithDB(datastore, volatile),
+		middleware.RequireRoot(datastore),
+	}
+
+	b := realtime.NewBroker(func(ctx context.Context, key string) (string, error) {
+		return "", errors.New("not used by the tests")
+	}, volatile)
+
+	mux := http.NewServeMux()
+	mux.Handle("/sse/connect", middleware.Chain(http.HandlerFunc(b.Accept), append(pubWithDB, limitRealtimeConnections)...))
+	mux.Handle("/login", middleware.Chain(http.HandlerFunc(m.login), pubWithDB...))
+	mux.Handle("/verifykey", middleware.Chain(http.HandlerFunc(verifyKey), pubWithDB...))
+	mux.Handle("/db/", middleware.Chain(http.HandlerFunc(database.dbreq), stdAuth...))
+	mux.Handle("/query/", middleware.Chain(http.HandlerFunc(database.query), stdAuth...))
+	mux.Handle("/account/info", middleware.Chain(http.HandlerFunc(acct.info), stdRoot...))
+
+	return httptest.NewServer(mux)
+}
+
+func TestClientCRUD(t *testing.T) {
+	ts := newClientTestServer()
+	defer ts.Close()
+
+	cl := client.New(ts.URL, pubKey)
+	if err := cl.Login(userEmail, userPassword); err != nil {
+		t.Fatal(err)
+	}
+
+	task := Task{Title: "from the client", Done: false}
+
+	var created Task
+	if err := cl.Create("clienttasks", task, &created); err != nil {
+		t.Fatal(err)
+	} else if len(created.ID) == 0 {
+		t.Fatal("expected created task to have an id")
+	}
+
+	var fetched Task
+	if err := cl.Get("clienttasks", created.ID, &fetched); err != nil {
+		t.Fatal(err)
+	} else if fetched.Title != task.Title {
+		t.Errorf("expected title %s got %s", task.Title, fetched.Title)
+	}
+
+	task.Done = true
+	var updated Task
+	if err := cl.Update("clienttasks", created.ID, task, &updated); err != nil {
+		t.Fatal(err)
+	} else if !updated.Done {
+		t.Errorf("expected task to be done")
+	}
+
+	result, err := cl.Query("clienttasks", [][]any{{"done", "=", true}}, client.ListParams{})
+	if err != nil {
+		t.Fatal(err)
+	} else if result.Total == 0 {
+		t.Errorf("expected query to return at least 1 task")
+	}
+
+	list, err := cl.List("clienttasks", client.ListParams{Page: 1, Size: 10})
+	if err != nil {
+		t.Fatal(err)
+	} else if list.Total == 0 {
+		t.Errorf("expected list to return at least 1 task")
+	}
+
+	if err := cl.Delete("clienttasks", created.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cl.Get("clienttasks", created.ID, &fetched); err == nil {
+		t.Errorf("expected deleted task to not be found")
+	}
+}
+
+func TestClientAccountInfo(t *testing.T) {
+	ts := newClientTestServer()
+	defer ts.Close()
+
+	cl := client.New(ts.URL, pubKey)
+	cl.Token = rootToken
+
+	info, err := cl.AccountInfo()
+	if err != nil {
+		t.Fatal(err)
+	} else if info.Base.ID != pubKey {
+		t.Errorf("expected base id %s got %s", pubKey, info.Base.ID)
+	} else if info.Customer.Email != admEmail {
+		t.Errorf("expected customer email %s got %s", admEmail, info.Customer.Email)
+	}
+}
+
+func TestClientVerifyKey(t *testing.T) {
+	ts := newClientTestServer()
+	defer ts.Close()
+
+	info, err := client.New(ts.URL, pubKey).VerifyKey()
+	if err != nil {
+		t.Fatal(err)
+	} else if !info.Valid {
+		t.Errorf("expected the public key to be valid got %v", info)
+	}
+
+	cus, err := datastore.CreateCustomer(internal.Customer{Email: fmt.Sprintf("verifykey-%d@test.com", time.Now().UnixNano())})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inactive, err := datastore.CreateBase(internal.BaseConfig{
+		CustomerID: cus.ID,
+		Name:       fmt.Sprintf("verifykey%d", time.Now().UnixNano()),
+		IsActive:   false,
+		Created:    time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]int{
+		"unknown-public-key": http.StatusNotFound,
+		inactive.ID:          http.StatusForbidden,
+	}
+	for key, status := range tests {
+		var apiErr *client.APIError
+		if _, err := client.New(ts.URL, key).VerifyKey(); !errors.As(err, &apiErr) || apiErr.StatusCode != status {
+			t.Errorf("%s: expected status %d got %v", key, status, err)
+		}
+	}
+}
+
+func TestClientRealtimeConnectionLimit(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.MaxRealtimeConnections = "default:2"
+	parseSettings(t)
+
+	ts := newClientTestServer()
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cl := client.New(ts.URL, pubKey)
+	for i := 0; i < 2; i++ {
+		messages, err := cl.Connect(ctx)
+		if err != nil {
+			t.Fatalf("connection %d: %v", i+1, err)
+		}
+		// the connection is counted once it's initialized
+		<-messages
+	}
+
+	var apiErr *client.APIError
+	if _, err := cl.Connect(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected status 429 past the limit got %v", err)
+	}
+
+	resp := dbReq(t, realtimeStats, "GET", "/sudo/realtime", nil, true)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+	defer resp.Body.Close()
+
+	var stats map[string]int
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	} else if stats["connections"] != 2 || stats["limit"] != 2 {
+		t.Errorf("expected 2 connections and a limit of 2 got %v", stats)
+	}
+}
@@ -1,13 +1,28 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"log"
+
 	backend "github.com/staticbackendhq/core"
 	"github.com/staticbackendhq/core/config"
 )
 
 func main() {
+	testEmail := flag.String("test-email", "", "send a test email to this address and exit")
+	flag.Parse()
+
 	c := config.LoadConfig()
 
+	if len(*testEmail) > 0 {
+		if err := backend.SendTestEmail(c, *testEmail); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("test email sent to", *testEmail)
+		return
+	}
+
 	if len(c.Port) == 0 {
 		c.Port = "8099"
 	}
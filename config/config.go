@@ -1,6 +1,52 @@
 package config
 
-import "os"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	AppEnvDev  = "dev"
+	AppEnvProd = "prod"
+)
+
+const (
+	AccountCreationOpen     = "open"
+	AccountCreationInvite   = "invite"
+	AccountCreationDisabled = "disabled"
+)
+
+const (
+	TokenCacheRedis  = "redis"
+	TokenCacheMemory = "memory"
+)
+
+const (
+	SignupModeTrial = "trial"
+	SignupModeCard  = "card"
+)
+
+const (
+	JSONNumbersInt   = "int"
+	JSONNumbersFloat = "float"
+)
+
+const (
+	StripeKeyMismatchRefuse = "refuse"
+	StripeKeyMismatchWarn   = "warn"
+)
+
+// MinJWTSecretLength is the minimum length of JWT_SECRET accepted in prod.
+const MinJWTSecretLength = 32
 
 var Current AppConfig
 
@@ -12,6 +58,56 @@ type AppConfig struct {
 	AppEnv string
 	// FromCLI if we're running in the CLI
 	FromCLI string
+	// PublicURL base URL used to build the links sent to users i.e.
+	// https://api.example.com, defaults to http://localhost:PORT
+	PublicURL string
+
+	// JWTSecret used to sign and verify the JWT
+	JWTSecret string
+	// TokenVersion format of the issued tokens, 1 (default) is "id|token"
+	// and 2 is "v2.id.token", the tokens of all versions are accepted
+	TokenVersion string
+
+	// DefaultUserRole is the role of the users signing up to a base, 0 by
+	// default, it must be below the root role 100
+	DefaultUserRole string
+	// MaxTokensPerUser maximum active JWTs (sessions) of a user, empty or 0
+	// means no limit
+	MaxTokensPerUser string
+	// TokenLimitPolicy what happens past MaxTokensPerUser, reject (default)
+	// refuses the new JWT, evict ends the oldest sessions of the user
+	TokenLimitPolicy string
+
+	// AccountCreation controls new account sign up: open (default), invite
+	// or disabled
+	AccountCreation string
+	// AccountInviteCode is the invite code required when AccountCreation is
+	// invite
+	AccountInviteCode string
+	// SignupRateLimit account creations allowed per IP as count/window
+	// i.e. "10/1h", disabled by default. The IP is the peer of the
+	// connection, it's shared by all clients behind a proxy
+	SignupRateLimit string
+	// SignupDomainRateLimit account creations allowed per email domain as
+	// count/window, disabled by default
+	SignupDomainRateLimit string
+	// DisposableDomains comma separated email domains refused at
+	// signup i.e. "mailinator.com,yopmail.com", their subdomains are
+	// refused too
+	DisposableDomains string
+	// DisposableDomainsFile path of a file listing the refused email
+	// domains one per line, it's read again once modified
+	DisposableDomainsFile string
+
+	// AllowMemoryMode if "yes" or "no" enables or disables the ?mem=1 account
+	// creation, when empty it's allowed outside of prod
+	AllowMemoryMode string
+	// MemoryModeDBName overrides the dev-memory-pk database name used by
+	// the ?mem=1 account creation
+	MemoryModeDBName string
+	// MemoryModePassword overrides the devpw1234 admin password used by
+	// the ?mem=1 account creation
+	MemoryModePassword string
 
 	// DataStore used as the data store implementation
 	DataStore string
@@ -20,7 +116,8 @@ type AppConfig struct {
 
 	// StorageProvider used as the file storage implementation
 	StorageProvider string
-	// LocalStorageURLURL for files when using local storage provider
+	// LocalStorageURLURL for files when using local storage provider,
+	// defaults to PublicURL
 	LocalStorageURL string
 
 	// MailProvider used as the sending mails implementeation
@@ -29,6 +126,23 @@ type AppConfig struct {
 	FromEmail string
 	// FromName used when SB sends email
 	FromName string
+	// SupportEmail is the Reply-To of the emails sent to customers, defaults
+	// to FromEmail
+	SupportEmail string
+	// MailReturnPath address receiving the bounces
+	MailReturnPath string
+	// MailHeaders semicolon separated headers added to every email i.e.
+	// "X-Campaign:signup;List-Unsubscribe:<mailto:unsub@example.com>"
+	MailHeaders string
+	// EmailSubjects semicolon separated subjects per email type, prefixed by
+	// a base name to only apply to it i.e. "account-created=Welcome to Acme;
+	// mybase/login-alert=New sign-in to {{.Base}}", subjects are templates
+	// executed with the data of the email
+	EmailSubjects string
+	// EmailFromNames semicolon separated from-names per email type, base or
+	// base/type i.e. "mybase=Acme;mybase/login-alert=Acme Security",
+	// FromName is used otherwise
+	EmailFromNames string
 
 	// StripeKey used for Stripe communication
 	StripeKey string
@@ -42,6 +156,58 @@ type AppConfig struct {
 	StripePriceIDGrowth string
 	// StripeWebhookSecret used when Stripe sends a webhook
 	StripeWebhookSecret string
+	// WebhookAllowPrivate if "yes" lets the webhooks be delivered to the
+	// loopback and private network addresses, i.e. on a self-hosted server
+	WebhookAllowPrivate string
+	// BillingReturnURL is the page the Stripe billing portal returns to,
+	// required in prod with a Stripe key, see BillingReturnLink
+	BillingReturnURL string
+	// StripePriceCurrencies per currency price of the plans i.e.
+	// "idea:eur:price_123,growth:eur:price_456", the StripePriceID* are the
+	// default prices
+	StripePriceCurrencies string
+	// StripeCountryCurrencies currency of the country hinted by a request
+	// i.e. "FR:eur,GB:gbp"
+	StripeCountryCurrencies string
+	// StripeAPIVersion pins the Stripe API version i.e. "2020-08-27", the
+	// version of the Stripe library is used when empty
+	StripeAPIVersion string
+	// LoginHistory number of logins kept per user, defaults to 20 and 0
+	// disables the login history
+	LoginHistory string
+	// LoginAlerts if "yes" emails the users signing in from an IP address
+	// that's not in their login history, users can opt out
+	LoginAlerts string
+	// EmailOTP if "yes" lets the users sign in with a single-use code sent
+	// to their email instead of their password
+	EmailOTP string
+	// EmailOTPTTL lifetime of the emailed login codes, defaults to 10m
+	EmailOTPTTL string
+	// EmailOTPRateLimit codes requested and verification attempts allowed
+	// per email as count/window, defaults to "5/15m"
+	EmailOTPRateLimit string
+	// EmailRecipientRateLimit emails sent to a recipient as count/window
+	// i.e. "5/1h", the emails past the limit are not sent. Empty (default)
+	// disables it
+	EmailRecipientRateLimit string
+	// MaxPageSize the largest page size of the list and query endpoints,
+	// bigger requested sizes are clamped, defaults to 1000
+	MaxPageSize string
+	// DisabledJobs names of the background jobs that must not run i.e.
+	// "ttl-sweep"
+	DisabledJobs string
+	// DatastoreReadTimeout and DatastoreWriteTimeout are the durations
+	// after which a datastore operation is canceled i.e. "10s", they
+	// default to 30s and 60s, 0 disables them
+	DatastoreReadTimeout  string
+	DatastoreWriteTimeout string
+	// SignupMode "trial" (default) starts the subscription with a 60 days
+	// trial, "card" has no trial and the account stays inactive until a
+	// payment method is attached
+	SignupMode string
+	// StripeKeyMismatch is either "refuse" (default) or "warn" when the
+	// StripeKey mode does not match AppEnv, see CheckStripeKey
+	StripeKeyMismatch string
 
 	// TwilioAccountID used when sending SMS text messages via Twilio API
 	TwilioAccountID string
@@ -52,6 +218,23 @@ type AppConfig struct {
 	// TwilioNumber is the Twilio phone number used to send SMS text messages
 	TwilioNumber string
 
+	// APIKeyHeader HTTP header accepted in addition to "Authorization: Bearer"
+	// for the token, defaults to X-API-Key
+	APIKeyHeader string
+
+	// CaptchaProvider verifies anonymous writes to CaptchaCollections, either
+	// recaptcha or hcaptcha
+	CaptchaProvider string
+	// CaptchaSecret secret key of the CAPTCHA provider
+	CaptchaSecret string
+	// CaptchaCollections comma separated public collections requiring a
+	// CAPTCHA for anonymous writes i.e. "pub_contacts,pub_signups"
+	CaptchaCollections string
+
+	// TokenCache where validated tokens are cached: redis (default) shares
+	// them across instances, memory keeps them in-process
+	TokenCache string
+
 	// RedisURL URL for Redis
 	RedisURL string
 	// RedisHost if RedisURL is not used, host for Redis
@@ -68,36 +251,1133 @@ type AppConfig struct {
 
 	// KeepPermissionInName if "yes" will keep the repo permission in repo name
 	KeepPermissionInName string
+
+	// DocumentPutMerge if "yes" PUT /db/col/id merges the fields of the
+	// request body like PATCH instead of replacing the document, for the
+	// clients written before PUT replaced the document
+	DocumentPutMerge string
+
+	// MaxDocumentSize maximum size in bytes of a document on create/update,
+	// empty or 0 means no limit
+	MaxDocumentSize string
+	// DocumentSizeOverrides per collection limits i.e. "files:5000000,logs:0"
+	DocumentSizeOverrides string
+	// CollectionTTL per collection expiry i.e. "sessions:lastSeen:24h", the
+	// documents are removed once the timestamp field is older than the TTL
+	CollectionTTL string
+	// CollectionDefaults per collection values set on insert when missing
+	// i.e. "tasks:status:new,tasks:slug:slug(title)"
+	CollectionDefaults string
+	// CollectionRelations reference fields that can be expanded on read i.e.
+	// "tasks:projectId:projects", the field holds the id of a document of
+	// the target collection
+	CollectionRelations string
+	// MaxCollections per plan limit of collections a base can create i.e.
+	// "default:20,growth:100", 0 or a missing plan means no limit
+	MaxCollections string
+	// MaxRealtimeConnections per plan limit of open realtime connections,
+	// SSE and websocket, of a base i.e. "default:100,growth:1000", 0 or a
+	// missing plan means no limit
+	MaxRealtimeConnections string
+	// RealtimeHistory number of messages retained per channel so a
+	// reconnecting client resumes its subscription without missing any, 0
+	// (default) disables it
+	RealtimeHistory string
+	// RealtimeHistoryTTL duration the messages are retained i.e. "5m"
+	// (default)
+	RealtimeHistoryTTL string
+	// RealtimeCheckOrigin if "yes" refuses the realtime connections whose
+	// Origin is not one of the allowed domains of the base
+	RealtimeCheckOrigin string
+
+	// UploadAllowedTypes comma separated MIME types accepted by the file
+	// upload i.e. "image/*,application/pdf", empty allows all types
+	UploadAllowedTypes string
+	// UploadMaxSize maximum size in bytes of an uploaded file, defaults to
+	// 150MB. Each base can override both limits.
+	UploadMaxSize string
+
+	// RequestLogging if "yes" logs every HTTP request with secrets redacted
+	RequestLogging string
+	// SlowQueryThreshold logs the document queries taking longer i.e.
+	// "500ms" with their values redacted, empty (default) disables it
+	SlowQueryThreshold string
+	// DebugQueryHeaders if "yes" adds the number and total time of the
+	// datastore operations of each database request as the X-Query-Count
+	// and X-Query-Time response headers
+	DebugQueryHeaders string
+	// JSONNumbers how the numbers of documents are decoded, "int" (default)
+	// keeps integers as integers, "float" decodes all numbers as floats
+	JSONNumbers string
+	// ResponseEnvelope if "yes" wraps the success responses as {"data": ...}
+	ResponseEnvelope string
+	// LogSensitiveKeys comma separated keys redacted in addition to the
+	// Authorization header, password and token i.e. "apiKey,ssn"
+	LogSensitiveKeys string
+	// Compression if "yes" compresses the responses with gzip or deflate
+	// when the client accepts it
+	Compression string
+	// CompressionMinSize smallest response body in bytes that is
+	// compressed, defaults to 1024
+	CompressionMinSize string
+	// CompressionTypes comma separated content types that are compressed,
+	// defaults to JSON, HTML, CSS, JavaScript, CSV and plain text
+	CompressionTypes string
+	// NormalizePaths if "yes" canonicalizes the request paths before they
+	// are routed, i.e. /db/posts/ and /DB//posts become /db/posts
+	NormalizePaths string
+
+	// CSRFProtection if "yes" the form posts of the web UI and the account
+	// creation require a CSRF token, the token-authenticated API calls are
+	// not affected
+	CSRFProtection string
+	// CSRFTrustedOrigins comma separated origins allowed to post the forms
+	// without a token i.e. "https://www.example.com" for a marketing site
+	// posting the sign-up form
+	CSRFTrustedOrigins string
+
+	// Settings are the parsed values of the settings above, see
+	// ParseSettings
+	Settings Settings
+}
+
+// Settings holds the typed values of the AppConfig settings that need
+// parsing. They're parsed once at startup, by Validate, and read as is.
+type Settings struct {
+	PlanPrices               map[string]map[string]string
+	CountryCurrencies        map[string]string
+	DocumentSizeLimits       map[string]int64
+	CollectionTTLs           map[string]TTL
+	CollectionRelations      map[string]map[string]string
+	CollectionDefaults       map[string][]FieldDefault
+	CollectionLimits         map[string]int
+	RealtimeConnectionLimits map[string]int
+	RealtimeHistorySize      int
+	RealtimeHistoryTTL       time.Duration
+	SlowQueryThreshold       time.Duration
+	LoginHistorySize         int
+	MaxPageSize              int64
+	DatastoreReadTimeout     time.Duration
+	DatastoreWriteTimeout    time.Duration
+	TokenVersion             int
+	DefaultUserRole          int
+	MaxTokensPerUser         int
+	EvictTokens              bool
+	SignupRateLimit          RateLimit
+	SignupDomainRateLimit    RateLimit
+	EmailOTPTTL              time.Duration
+	EmailOTPRateLimit        RateLimit
+	EmailRecipientRateLimit  RateLimit
+	CSRFTrustedOrigins       []string
+	DisposableDomains        map[string]bool
+	CompressionMinSize       int
+	CompressionTypes         []string
+	UploadAllowedTypes       []string
+	UploadMaxSize            int64
+	MailHeaders              map[string]string
+	EmailSubjects            map[string]string
+	EmailFromNames           map[string]string
 }
 
 func LoadConfig() AppConfig {
 	return AppConfig{
-		Port:                  os.Getenv("PORT"),
-		AppEnv:                os.Getenv("APP_ENV"),
-		FromCLI:               os.Getenv("SB_FROM_CLI"),
-		DataStore:             os.Getenv("DATA_STORE"),
-		DatabaseURL:           os.Getenv("DATABASE_URL"),
-		MailProvider:          os.Getenv("MAIL_PROVIDER"),
-		FromEmail:             os.Getenv("FROM_EMAIL"),
-		FromName:              os.Getenv("FROM_NAME"),
-		StorageProvider:       os.Getenv("STORAGE_PROVIDER"),
-		LocalStorageURL:       os.Getenv("LOCAL_STORAGE_URL"),
-		RedisURL:              os.Getenv("REDIS_URL"),
-		RedisHost:             os.Getenv("REDIS_HOST"),
-		RedisPassword:         os.Getenv("REDIS_PASSWORD"),
-		StripeKey:             os.Getenv("STRIPE_KEY"),
-		StripePriceIDIdea:     os.Getenv("STRIPE_PRICEID_IDEA"),
-		StripePriceIDLaunch:   os.Getenv("STRIPE_PRICEID_LAUNCH"),
-		StripePriceIDTraction: os.Getenv("STRIPE_PRICEID_TRACTION"),
-		StripePriceIDGrowth:   os.Getenv("STRIPE_PRICEID_GROWTH"),
-		StripeWebhookSecret:   os.Getenv("STRIPE_WEBHOOK_SECRET"),
-		TwilioAccountID:       os.Getenv("TWILIO_ACCOUNTSID"),
-		TwilioAuthToken:       os.Getenv("TWILIO_AUTHTOKEN"),
-		TwilioTestCellNumber:  os.Getenv("MY_CELL"),
-		TwilioNumber:          os.Getenv("TWILIO_NUMBER"),
-		AWSRegion:             os.Getenv("AWS_REGION"),
-		AWSCDNURL:             os.Getenv("AWS_CDN_URL"),
-		AWSS3Bucket:           os.Getenv("AWS_S3_BUCKET"),
-		KeepPermissionInName:  os.Getenv("KEEP_PERM_COL_NAME"),
+		Port:                    os.Getenv("PORT"),
+		AppEnv:                  os.Getenv("APP_ENV"),
+		FromCLI:                 os.Getenv("SB_FROM_CLI"),
+		PublicURL:               os.Getenv("PUBLIC_URL"),
+		JWTSecret:               os.Getenv("JWT_SECRET"),
+		TokenVersion:            os.Getenv("TOKEN_VERSION"),
+		DefaultUserRole:         os.Getenv("DEFAULT_USER_ROLE"),
+		MaxTokensPerUser:        os.Getenv("MAX_TOKENS_PER_USER"),
+		TokenLimitPolicy:        os.Getenv("TOKEN_LIMIT_POLICY"),
+		AccountCreation:         os.Getenv("ACCOUNT_CREATION"),
+		AccountInviteCode:       os.Getenv("ACCOUNT_INVITE_CODE"),
+		AllowMemoryMode:         os.Getenv("ALLOW_MEMORY_MODE"),
+		MemoryModeDBName:        os.Getenv("MEMORY_MODE_DB_NAME"),
+		MemoryModePassword:      os.Getenv("MEMORY_MODE_PASSWORD"),
+		DataStore:               os.Getenv("DATA_STORE"),
+		DatabaseURL:             os.Getenv("DATABASE_URL"),
+		MailProvider:            os.Getenv("MAIL_PROVIDER"),
+		FromEmail:               os.Getenv("FROM_EMAIL"),
+		FromName:                os.Getenv("FROM_NAME"),
+		SupportEmail:            os.Getenv("SUPPORT_EMAIL"),
+		MailReturnPath:          os.Getenv("MAIL_RETURN_PATH"),
+		MailHeaders:             os.Getenv("MAIL_HEADERS"),
+		EmailSubjects:           os.Getenv("EMAIL_SUBJECTS"),
+		EmailFromNames:          os.Getenv("EMAIL_FROM_NAMES"),
+		StorageProvider:         os.Getenv("STORAGE_PROVIDER"),
+		LocalStorageURL:         os.Getenv("LOCAL_STORAGE_URL"),
+		APIKeyHeader:            os.Getenv("API_KEY_HEADER"),
+		CaptchaProvider:         os.Getenv("CAPTCHA_PROVIDER"),
+		CaptchaSecret:           os.Getenv("CAPTCHA_SECRET"),
+		CaptchaCollections:      os.Getenv("CAPTCHA_COLLECTIONS"),
+		TokenCache:              os.Getenv("TOKEN_CACHE"),
+		RedisURL:                os.Getenv("REDIS_URL"),
+		RedisHost:               os.Getenv("REDIS_HOST"),
+		RedisPassword:           os.Getenv("REDIS_PASSWORD"),
+		StripeKey:               os.Getenv("STRIPE_KEY"),
+		StripePriceIDIdea:       os.Getenv("STRIPE_PRICEID_IDEA"),
+		StripePriceIDLaunch:     os.Getenv("STRIPE_PRICEID_LAUNCH"),
+		StripePriceIDTraction:   os.Getenv("STRIPE_PRICEID_TRACTION"),
+		StripePriceIDGrowth:     os.Getenv("STRIPE_PRICEID_GROWTH"),
+		StripeWebhookSecret:     os.Getenv("STRIPE_WEBHOOK_SECRET"),
+		WebhookAllowPrivate:     os.Getenv("WEBHOOK_ALLOW_PRIVATE"),
+		BillingReturnURL:        os.Getenv("BILLING_RETURN_URL"),
+		StripeAPIVersion:        os.Getenv("STRIPE_API_VERSION"),
+		StripePriceCurrencies:   os.Getenv("STRIPE_PRICE_CURRENCIES"),
+		StripeCountryCurrencies: os.Getenv("STRIPE_COUNTRY_CURRENCIES"),
+		StripeKeyMismatch:       os.Getenv("STRIPE_KEY_MISMATCH"),
+		SignupMode:              os.Getenv("SIGNUP_MODE"),
+		SignupRateLimit:         os.Getenv("SIGNUP_RATE_LIMIT"),
+		SignupDomainRateLimit:   os.Getenv("SIGNUP_DOMAIN_RATE_LIMIT"),
+		DisposableDomains:       os.Getenv("DISPOSABLE_EMAIL_DOMAINS"),
+		DisposableDomainsFile:   os.Getenv("DISPOSABLE_EMAIL_DOMAINS_FILE"),
+		LoginHistory:            os.Getenv("LOGIN_HISTORY"),
+		LoginAlerts:             os.Getenv("LOGIN_ALERTS"),
+		EmailOTP:                os.Getenv("EMAIL_OTP"),
+		EmailOTPTTL:             os.Getenv("EMAIL_OTP_TTL"),
+		EmailOTPRateLimit:       os.Getenv("EMAIL_OTP_RATE_LIMIT"),
+		EmailRecipientRateLimit: os.Getenv("EMAIL_RECIPIENT_RATE_LIMIT"),
+		MaxPageSize:             os.Getenv("MAX_PAGE_SIZE"),
+		DisabledJobs:            os.Getenv("DISABLED_JOBS"),
+		DatastoreReadTimeout:    os.Getenv("DATASTORE_READ_TIMEOUT"),
+		DatastoreWriteTimeout:   os.Getenv("DATASTORE_WRITE_TIMEOUT"),
+		TwilioAccountID:         os.Getenv("TWILIO_ACCOUNTSID"),
+		TwilioAuthToken:         os.Getenv("TWILIO_AUTHTOKEN"),
+		TwilioTestCellNumber:    os.Getenv("MY_CELL"),
+		TwilioNumber:            os.Getenv("TWILIO_NUMBER"),
+		AWSRegion:               os.Getenv("AWS_REGION"),
+		AWSCDNURL:               os.Getenv("AWS_CDN_URL"),
+		AWSS3Bucket:             os.Getenv("AWS_S3_BUCKET"),
+		KeepPermissionInName:    os.Getenv("KEEP_PERM_COL_NAME"),
+		DocumentPutMerge:        os.Getenv("DOCUMENT_PUT_MERGE"),
+		MaxDocumentSize:         os.Getenv("MAX_DOC_SIZE"),
+		DocumentSizeOverrides:   os.Getenv("DOC_SIZE_OVERRIDES"),
+		CollectionTTL:           os.Getenv("COLLECTION_TTL"),
+		CollectionDefaults:      os.Getenv("COLLECTION_DEFAULTS"),
+		CollectionRelations:     os.Getenv("COLLECTION_RELATIONS"),
+		MaxCollections:          os.Getenv("MAX_COLLECTIONS"),
+		MaxRealtimeConnections:  os.Getenv("MAX_REALTIME_CONNECTIONS"),
+		RealtimeHistory:         os.Getenv("REALTIME_HISTORY"),
+		RealtimeHistoryTTL:      os.Getenv("REALTIME_HISTORY_TTL"),
+		RealtimeCheckOrigin:     os.Getenv("REALTIME_CHECK_ORIGIN"),
+		UploadAllowedTypes:      os.Getenv("UPLOAD_ALLOWED_TYPES"),
+		UploadMaxSize:           os.Getenv("UPLOAD_MAX_SIZE"),
+		RequestLogging:          os.Getenv("REQUEST_LOGGING"),
+		SlowQueryThreshold:      os.Getenv("SLOW_QUERY_THRESHOLD"),
+		DebugQueryHeaders:       os.Getenv("DEBUG_QUERY_HEADERS"),
+		JSONNumbers:             os.Getenv("JSON_NUMBERS"),
+		ResponseEnvelope:        os.Getenv("RESPONSE_ENVELOPE"),
+		LogSensitiveKeys:        os.Getenv("LOG_SENSITIVE_KEYS"),
+		Compression:             os.Getenv("COMPRESSION"),
+		NormalizePaths:          os.Getenv("NORMALIZE_PATHS"),
+		CSRFProtection:          os.Getenv("CSRF_PROTECTION"),
+		CSRFTrustedOrigins:      os.Getenv("CSRF_TRUSTED_ORIGINS"),
+		CompressionMinSize:      os.Getenv("COMPRESSION_MIN_SIZE"),
+		CompressionTypes:        os.Getenv("COMPRESSION_TYPES"),
+	}
+}
+
+// ValidationError aggregates all configuration problems found by Validate.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration:\n\t- %s", strings.Join(e.Problems, "\n\t- "))
+}
+
+var stripeAPIVersionRe = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// Validate checks that the required configuration fields for the current
+// AppEnv are present and sets the Settings of c. It returns a
+// ValidationError listing every problem.
+func Validate(c *AppConfig) error {
+	var problems []string
+
+	missing := func(v, name string) {
+		if len(v) == 0 {
+			problems = append(problems, fmt.Sprintf("%s is required", name))
+		}
+	}
+
+	missing(c.DatabaseURL, "DATABASE_URL")
+
+	if err := CheckJWTSecret(c.JWTSecret); err != nil {
+		if c.AppEnv == AppEnvProd {
+			problems = append(problems, err.Error())
+		} else {
+			log.Println("WARNING:", err)
+		}
+	}
+
+	switch strings.ToLower(c.AccountCreation) {
+	case "", AccountCreationOpen, AccountCreationDisabled:
+	case AccountCreationInvite:
+		missing(c.AccountInviteCode, "ACCOUNT_INVITE_CODE")
+	default:
+		problems = append(problems, fmt.Sprintf("ACCOUNT_CREATION has an invalid value: %s", c.AccountCreation))
+	}
+
+	if len(c.CaptchaCollections) > 0 {
+		switch strings.ToLower(c.CaptchaProvider) {
+		case "recaptcha", "hcaptcha":
+			missing(c.CaptchaSecret, "CAPTCHA_SECRET")
+		default:
+			problems = append(problems, fmt.Sprintf("CAPTCHA_PROVIDER has an invalid value: %s", c.CaptchaProvider))
+		}
+	}
+
+	switch strings.ToLower(c.TokenCache) {
+	case "", TokenCacheRedis, TokenCacheMemory:
+	default:
+		problems = append(problems, fmt.Sprintf("TOKEN_CACHE has an invalid value: %s", c.TokenCache))
+	}
+
+	switch strings.ToLower(c.SignupMode) {
+	case "", SignupModeTrial, SignupModeCard:
+	default:
+		problems = append(problems, fmt.Sprintf("SIGNUP_MODE has an invalid value: %s", c.SignupMode))
+	}
+
+	switch strings.ToLower(c.JSONNumbers) {
+	case "", JSONNumbersInt, JSONNumbersFloat:
+	default:
+		problems = append(problems, fmt.Sprintf("JSON_NUMBERS has an invalid value: %s", c.JSONNumbers))
+	}
+
+	switch strings.ToLower(c.StripeKeyMismatch) {
+	case "", StripeKeyMismatchRefuse:
+		if err := CheckStripeKey(*c); err != nil {
+			problems = append(problems, err.Error())
+		}
+	case StripeKeyMismatchWarn:
+		if err := CheckStripeKey(*c); err != nil {
+			log.Println("WARNING:", err)
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("STRIPE_KEY_MISMATCH has an invalid value: %s", c.StripeKeyMismatch))
+	}
+
+	if len(c.StripeAPIVersion) > 0 && !stripeAPIVersionRe.MatchString(c.StripeAPIVersion) {
+		problems = append(problems, fmt.Sprintf("STRIPE_API_VERSION must be a date i.e. 2020-08-27: %s", c.StripeAPIVersion))
+	}
+
+	settings, err := ParseSettings(*c)
+	if ve, ok := err.(ValidationError); ok {
+		problems = append(problems, ve.Problems...)
+	}
+	c.Settings = settings
+
+	if len(c.PublicURL) > 0 {
+		if u, err := url.Parse(c.PublicURL); err != nil || len(u.Host) == 0 || (u.Scheme != "http" && u.Scheme != "https") {
+			problems = append(problems, fmt.Sprintf("PUBLIC_URL must be an absolute http(s) URL: %s", c.PublicURL))
+		}
+	}
+
+	if len(c.BillingReturnURL) > 0 {
+		if u, err := url.Parse(c.BillingReturnURL); err != nil || len(u.Host) == 0 || (u.Scheme != "http" && u.Scheme != "https") {
+			problems = append(problems, fmt.Sprintf("BILLING_RETURN_URL must be an absolute http(s) URL: %s", c.BillingReturnURL))
+		}
+	}
+
+	if c.AppEnv == AppEnvProd {
+		missing(c.FromEmail, "FROM_EMAIL")
+
+		if strings.EqualFold(c.MailProvider, "ses") {
+			missing(c.AWSRegion, "AWS_REGION")
+		}
+
+		if strings.EqualFold(c.StorageProvider, "s3") {
+			missing(c.AWSRegion, "AWS_REGION")
+			missing(c.AWSS3Bucket, "AWS_S3_BUCKET")
+		}
+
+		if len(c.StripeKey) > 0 {
+			missing(c.StripePriceIDIdea, "STRIPE_PRICEID_IDEA")
+			missing(c.StripePriceIDLaunch, "STRIPE_PRICEID_LAUNCH")
+			missing(c.StripePriceIDTraction, "STRIPE_PRICEID_TRACTION")
+			missing(c.StripePriceIDGrowth, "STRIPE_PRICEID_GROWTH")
+			missing(c.StripeWebhookSecret, "STRIPE_WEBHOOK_SECRET")
+			missing(c.BillingReturnURL, "BILLING_RETURN_URL")
+		}
+	}
+
+	if len(problems) > 0 {
+		return ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ParseSettings parses the settings of c. It returns a ValidationError
+// listing the invalid ones, they keep their zero value.
+func ParseSettings(c AppConfig) (Settings, error) {
+	var s Settings
+	var problems []string
+
+	check := func(err error) {
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	var err error
+
+	s.DocumentSizeLimits, err = DocumentSizeLimits(c)
+	check(err)
+	s.PlanPrices, err = PlanPrices(c)
+	check(err)
+	s.CountryCurrencies, err = CountryCurrencies(c)
+	check(err)
+	s.CollectionTTLs, err = CollectionTTLs(c)
+	check(err)
+	s.CollectionRelations, err = CollectionRelations(c)
+	check(err)
+	s.CollectionDefaults, err = CollectionDefaults(c)
+	check(err)
+	s.CollectionLimits, err = CollectionLimits(c)
+	check(err)
+	s.RealtimeConnectionLimits, err = RealtimeConnectionLimits(c)
+	check(err)
+	s.RealtimeHistorySize, s.RealtimeHistoryTTL, err = RealtimeHistory(c)
+	check(err)
+	s.SlowQueryThreshold, err = SlowQueryThreshold(c)
+	check(err)
+	s.LoginHistorySize, err = LoginHistorySize(c)
+	check(err)
+	s.MaxPageSize, err = PageSizeLimit(c)
+	check(err)
+	s.DatastoreReadTimeout, s.DatastoreWriteTimeout, err = DatastoreTimeouts(c)
+	check(err)
+	s.CompressionMinSize, s.CompressionTypes, err = CompressionSettings(c)
+	check(err)
+	s.SignupRateLimit, s.SignupDomainRateLimit, err = SignupRateLimits(c)
+	check(err)
+	s.DisposableDomains, err = DisposableDomains(c)
+	check(err)
+	s.TokenVersion, err = TokenVersion(c)
+	check(err)
+	s.DefaultUserRole, err = DefaultUserRole(c)
+	check(err)
+	s.MaxTokensPerUser, s.EvictTokens, err = TokenLimit(c)
+	check(err)
+	s.EmailOTPTTL, s.EmailOTPRateLimit, err = EmailOTP(c)
+	check(err)
+	s.EmailRecipientRateLimit, err = EmailRecipientRateLimit(c)
+	check(err)
+	s.UploadAllowedTypes, s.UploadMaxSize, err = UploadLimits(c)
+	check(err)
+	s.MailHeaders, err = MailHeaders(c)
+	check(err)
+	s.EmailSubjects, s.EmailFromNames, err = EmailBranding(c)
+	check(err)
+	s.CSRFTrustedOrigins, err = CSRFTrustedOrigins(c)
+	check(err)
+
+	if len(problems) > 0 {
+		return s, ValidationError{Problems: problems}
+	}
+	return s, nil
+}
+
+// CheckJWTSecret returns an error when the secret is empty or too short to
+// be safely used for signing tokens.
+func CheckJWTSecret(secret string) error {
+	if len(secret) == 0 {
+		return errors.New("JWT_SECRET is empty, tokens would be forgeable")
+	} else if len(secret) < MinJWTSecretLength {
+		return fmt.Errorf("JWT_SECRET is too weak, it must be at least %d characters", MinJWTSecretLength)
+	}
+	return nil
+}
+
+// CheckStripeKey returns an error when the mode of StripeKey does not match
+// AppEnv: a test key in prod would create test customers on signup and a
+// live key outside of prod would charge real customers.
+func CheckStripeKey(c AppConfig) error {
+	live := strings.HasPrefix(c.StripeKey, "sk_live_") || strings.HasPrefix(c.StripeKey, "rk_live_")
+	test := strings.HasPrefix(c.StripeKey, "sk_test_") || strings.HasPrefix(c.StripeKey, "rk_test_")
+
+	if c.AppEnv == AppEnvProd && test {
+		return errors.New("STRIPE_KEY is a test mode key while APP_ENV is prod")
+	} else if c.AppEnv != AppEnvProd && live {
+		return fmt.Errorf("STRIPE_KEY is a live mode key while APP_ENV is %q", c.AppEnv)
+	}
+	return nil
+}
+
+var currencyRe = regexp.MustCompile(`^[a-z]{3}$`)
+
+// PlanPrices parses STRIPE_PRICE_CURRENCIES, the price ids are keyed by plan
+// name then by lower case ISO currency code.
+func PlanPrices(c AppConfig) (map[string]map[string]string, error) {
+	prices := make(map[string]map[string]string)
+
+	for _, entry := range strings.Split(c.StripePriceCurrencies, ",") {
+		if len(strings.TrimSpace(entry)) == 0 {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || len(strings.TrimSpace(parts[0])) == 0 || len(strings.TrimSpace(parts[2])) == 0 {
+			return nil, fmt.Errorf("STRIPE_PRICE_CURRENCIES invalid entry %s, expected plan:currency:priceID", entry)
+		}
+
+		plan := strings.ToLower(strings.TrimSpace(parts[0]))
+		currency := strings.ToLower(strings.TrimSpace(parts[1]))
+		if !currencyRe.MatchString(currency) {
+			return nil, fmt.Errorf("STRIPE_PRICE_CURRENCIES invalid currency for %s: %s", plan, parts[1])
+		}
+
+		if prices[plan] == nil {
+			prices[plan] = make(map[string]string)
+		}
+		prices[plan][currency] = strings.TrimSpace(parts[2])
+	}
+
+	return prices, nil
+}
+
+// CountryCurrencies parses STRIPE_COUNTRY_CURRENCIES, the lower case ISO
+// currency codes are keyed by upper case ISO country code.
+func CountryCurrencies(c AppConfig) (map[string]string, error) {
+	currencies := make(map[string]string)
+
+	for _, pair := range strings.Split(c.StripeCountryCurrencies, ",") {
+		if len(strings.TrimSpace(pair)) == 0 {
+			continue
+		}
+
+		parts := strings.Split(pair, ":")
+		if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 {
+			return nil, fmt.Errorf("STRIPE_COUNTRY_CURRENCIES invalid entry %s, expected country:currency", pair)
+		}
+
+		currency := strings.ToLower(strings.TrimSpace(parts[1]))
+		if !currencyRe.MatchString(currency) {
+			return nil, fmt.Errorf("STRIPE_COUNTRY_CURRENCIES invalid currency for %s: %s", parts[0], parts[1])
+		}
+		currencies[strings.ToUpper(strings.TrimSpace(parts[0]))] = currency
+	}
+
+	return currencies, nil
+}
+
+// DocumentSizeLimits parses MAX_DOC_SIZE and DOC_SIZE_OVERRIDES. The "" key
+// holds the default limit.
+func DocumentSizeLimits(c AppConfig) (map[string]int64, error) {
+	limits := make(map[string]int64)
+
+	if len(c.MaxDocumentSize) > 0 {
+		n, err := strconv.ParseInt(c.MaxDocumentSize, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("MAX_DOC_SIZE must be a number of bytes: %v", err)
+		}
+		limits[""] = n
+	}
+
+	for _, pair := range strings.Split(c.DocumentSizeOverrides, ",") {
+		if len(strings.TrimSpace(pair)) == 0 {
+			continue
+		}
+
+		parts := strings.Split(pair, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("DOC_SIZE_OVERRIDES invalid entry %s, expected collection:bytes", pair)
+		}
+
+		n, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("DOC_SIZE_OVERRIDES invalid size for %s: %v", parts[0], err)
+		}
+		limits[strings.TrimSpace(parts[0])] = n
+	}
+
+	return limits, nil
+}
+
+// TTL is the expiry of a collection's documents. The field holds an RFC 3339
+// timestamp, stored in UTC, the document expires once it's older than
+// Duration.
+type TTL struct {
+	Field    string
+	Duration time.Duration
+}
+
+// CollectionTTLs parses COLLECTION_TTL, the keys are the collection names.
+func CollectionTTLs(c AppConfig) (map[string]TTL, error) {
+	ttls := make(map[string]TTL)
+
+	for _, entry := range strings.Split(c.CollectionTTL, ",") {
+		if len(strings.TrimSpace(entry)) == 0 {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || len(strings.TrimSpace(parts[1])) == 0 {
+			return nil, fmt.Errorf("COLLECTION_TTL invalid entry %s, expected collection:field:duration", entry)
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(parts[2]))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("COLLECTION_TTL invalid duration for %s: %s", parts[0], parts[2])
+		}
+
+		ttls[strings.TrimSpace(parts[0])] = TTL{Field: strings.TrimSpace(parts[1]), Duration: d}
+	}
+
+	return ttls, nil
+}
+
+// CollectionRelations parses COLLECTION_RELATIONS, the keys are the
+// collection names then their relation fields and the values the target
+// collections.
+func CollectionRelations(c AppConfig) (map[string]map[string]string, error) {
+	relations := make(map[string]map[string]string)
+
+	for _, entry := range strings.Split(c.CollectionRelations, ",") {
+		if len(strings.TrimSpace(entry)) == 0 {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("COLLECTION_RELATIONS invalid entry %s, expected collection:field:target", entry)
+		}
+
+		col, field, target := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), strings.TrimSpace(parts[2])
+		if len(col) == 0 || len(field) == 0 || len(target) == 0 {
+			return nil, fmt.Errorf("COLLECTION_RELATIONS invalid entry %s, expected collection:field:target", entry)
+		} else if strings.Contains(field, ".") {
+			return nil, fmt.Errorf("COLLECTION_RELATIONS field %s of %s cannot be a path", field, col)
+		}
+
+		if _, ok := relations[col]; !ok {
+			relations[col] = make(map[string]string)
+		}
+		relations[col][field] = target
+	}
+
+	return relations, nil
+}
+
+// FieldDefault is the value of a field set on insert when it's missing.
+// SlugOf names the field the value is the slug of, otherwise Value is used.
+type FieldDefault struct {
+	Field  string
+	Value  interface{}
+	SlugOf string
+}
+
+var slugDefaultRe = regexp.MustCompile(`^slug\(([^()]+)\)$`)
+
+// CollectionDefaults parses COLLECTION_DEFAULTS, the keys are the collection
+// names and the defaults are in declaration order. A value is JSON when
+// valid, i.e. a number or a boolean, a string otherwise.
+func CollectionDefaults(c AppConfig) (map[string][]FieldDefault, error) {
+	defaults := make(map[string][]FieldDefault)
+
+	for _, entry := range strings.Split(c.CollectionDefaults, ",") {
+		if len(strings.TrimSpace(entry)) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || len(strings.TrimSpace(parts[1])) == 0 {
+			return nil, fmt.Errorf("COLLECTION_DEFAULTS invalid entry %s, expected collection:field:value", entry)
+		}
+
+		def := FieldDefault{Field: strings.TrimSpace(parts[1])}
+
+		value := strings.TrimSpace(parts[2])
+		if m := slugDefaultRe.FindStringSubmatch(value); m != nil {
+			def.SlugOf = strings.TrimSpace(m[1])
+		} else if err := json.Unmarshal([]byte(value), &def.Value); err != nil {
+			def.Value = value
+		}
+
+		col := strings.TrimSpace(parts[0])
+		defaults[col] = append(defaults[col], def)
+	}
+
+	return defaults, nil
+}
+
+// PlanLimitDefault is the entry of the per plan limits used for the plans
+// without their own limit.
+const PlanLimitDefault = "default"
+
+// CollectionLimitDefault is the MAX_COLLECTIONS entry used for the plans
+// without their own limit.
+const CollectionLimitDefault = PlanLimitDefault
+
+// CollectionLimits parses MAX_COLLECTIONS, the keys are the lower case plan
+// names or CollectionLimitDefault.
+func CollectionLimits(c AppConfig) (map[string]int, error) {
+	return planLimits("MAX_COLLECTIONS", c.MaxCollections)
+}
+
+// RealtimeConnectionLimits parses MAX_REALTIME_CONNECTIONS, the keys are the
+// lower case plan names or PlanLimitDefault.
+func RealtimeConnectionLimits(c AppConfig) (map[string]int, error) {
+	return planLimits("MAX_REALTIME_CONNECTIONS", c.MaxRealtimeConnections)
+}
+
+// DefaultRealtimeHistoryTTL is the duration the realtime messages are
+// retained when REALTIME_HISTORY_TTL is not set.
+const DefaultRealtimeHistoryTTL = 5 * time.Minute
+
+// RealtimeHistory parses REALTIME_HISTORY and REALTIME_HISTORY_TTL, the
+// number of messages retained per channel and for how long.
+func RealtimeHistory(c AppConfig) (size int, ttl time.Duration, err error) {
+	ttl = DefaultRealtimeHistoryTTL
+
+	if len(c.RealtimeHistory) > 0 {
+		size, err = strconv.Atoi(c.RealtimeHistory)
+		if err != nil || size < 0 {
+			return 0, 0, fmt.Errorf("REALTIME_HISTORY must be a positive number of messages: %s", c.RealtimeHistory)
+		}
+	}
+
+	if len(c.RealtimeHistoryTTL) > 0 {
+		ttl, err = time.ParseDuration(c.RealtimeHistoryTTL)
+		if err != nil || ttl <= 0 {
+			return 0, 0, fmt.Errorf("REALTIME_HISTORY_TTL must be a positive duration i.e. 5m: %s", c.RealtimeHistoryTTL)
+		}
+	}
+	return size, ttl, nil
+}
+
+// SlowQueryThreshold parses SLOW_QUERY_THRESHOLD, 0 when the slow query
+// log is disabled.
+func SlowQueryThreshold(c AppConfig) (time.Duration, error) {
+	if len(c.SlowQueryThreshold) == 0 {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(c.SlowQueryThreshold)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("SLOW_QUERY_THRESHOLD must be a positive duration i.e. 500ms: %s", c.SlowQueryThreshold)
+	}
+	return d, nil
+}
+
+// planLimits parses the "plan:limit" comma separated entries of the
+// setting name.
+func planLimits(name, value string) (map[string]int, error) {
+	limits := make(map[string]int)
+
+	for _, pair := range strings.Split(value, ",") {
+		if len(strings.TrimSpace(pair)) == 0 {
+			continue
+		}
+
+		parts := strings.Split(pair, ":")
+		if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 {
+			return nil, fmt.Errorf("%s invalid entry %s, expected plan:limit", name, pair)
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s invalid limit for %s: %s", name, parts[0], parts[1])
+		}
+		limits[strings.ToLower(strings.TrimSpace(parts[0]))] = n
+	}
+
+	return limits, nil
+}
+
+// DefaultLoginHistory is the number of logins kept per user when
+// LOGIN_HISTORY is not set.
+const DefaultLoginHistory = 20
+
+// LoginHistorySize parses LOGIN_HISTORY, 0 means the logins are not
+// recorded.
+func LoginHistorySize(c AppConfig) (int, error) {
+	if len(c.LoginHistory) == 0 {
+		return DefaultLoginHistory, nil
+	}
+
+	n, err := strconv.Atoi(c.LoginHistory)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("LOGIN_HISTORY must be a positive number of logins: %s", c.LoginHistory)
+	}
+	return n, nil
+}
+
+// DefaultMaxPageSize is the largest page size when MAX_PAGE_SIZE is not
+// set.
+const DefaultMaxPageSize = 1000
+
+// PageSizeLimit parses MAX_PAGE_SIZE.
+func PageSizeLimit(c AppConfig) (int64, error) {
+	if len(c.MaxPageSize) == 0 {
+		return DefaultMaxPageSize, nil
+	}
+
+	n, err := strconv.ParseInt(c.MaxPageSize, 10, 64)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("MAX_PAGE_SIZE must be a number of documents greater than 0: %s", c.MaxPageSize)
+	}
+	return n, nil
+}
+
+// Default datastore timeouts when DATASTORE_READ_TIMEOUT and
+// DATASTORE_WRITE_TIMEOUT are not set.
+const (
+	DefaultDatastoreReadTimeout  = 30 * time.Second
+	DefaultDatastoreWriteTimeout = 60 * time.Second
+)
+
+// DatastoreTimeouts parses DATASTORE_READ_TIMEOUT and
+// DATASTORE_WRITE_TIMEOUT, 0 means no timeout.
+func DatastoreTimeouts(c AppConfig) (read, write time.Duration, err error) {
+	read, write = DefaultDatastoreReadTimeout, DefaultDatastoreWriteTimeout
+
+	if len(c.DatastoreReadTimeout) > 0 {
+		read, err = time.ParseDuration(c.DatastoreReadTimeout)
+		if err != nil || read < 0 {
+			return 0, 0, fmt.Errorf("DATASTORE_READ_TIMEOUT must be a positive duration i.e. 10s: %s", c.DatastoreReadTimeout)
+		}
+	}
+
+	if len(c.DatastoreWriteTimeout) > 0 {
+		write, err = time.ParseDuration(c.DatastoreWriteTimeout)
+		if err != nil || write < 0 {
+			return 0, 0, fmt.Errorf("DATASTORE_WRITE_TIMEOUT must be a positive duration i.e. 10s: %s", c.DatastoreWriteTimeout)
+		}
+	}
+	return read, write, nil
+}
+
+// TokenVersion parses TOKEN_VERSION, 1 when it's not set.
+func TokenVersion(c AppConfig) (int, error) {
+	switch strings.TrimPrefix(strings.ToLower(c.TokenVersion), "v") {
+	case "", "1":
+		return 1, nil
+	case "2":
+		return 2, nil
+	}
+	return 0, fmt.Errorf("TOKEN_VERSION must be 1 or 2: %s", c.TokenVersion)
+}
+
+// DefaultUserRole parses DEFAULT_USER_ROLE, 0 when it's not set. Signing
+// up must never grant the root role so it's refused.
+func DefaultUserRole(c AppConfig) (int, error) {
+	if len(c.DefaultUserRole) == 0 {
+		return 0, nil
+	}
+
+	role, err := strconv.Atoi(c.DefaultUserRole)
+	if err != nil || role < 0 || role >= 100 {
+		return 0, fmt.Errorf("DEFAULT_USER_ROLE must be a number from 0 to 99: %s", c.DefaultUserRole)
+	}
+	return role, nil
+}
+
+// TokenLimit parses MAX_TOKENS_PER_USER and TOKEN_LIMIT_POLICY, a max of 0
+// means no limit. When evict is false the tokens past the limit are
+// rejected.
+func TokenLimit(c AppConfig) (max int, evict bool, err error) {
+	if len(c.MaxTokensPerUser) > 0 {
+		max, err = strconv.Atoi(c.MaxTokensPerUser)
+		if err != nil || max < 0 {
+			return 0, false, fmt.Errorf("MAX_TOKENS_PER_USER must be a positive number: %s", c.MaxTokensPerUser)
+		}
+	}
+
+	switch strings.ToLower(c.TokenLimitPolicy) {
+	case "", "reject":
+		return max, false, nil
+	case "evict":
+		return max, true, nil
+	}
+	return 0, false, fmt.Errorf("TOKEN_LIMIT_POLICY must be reject or evict: %s", c.TokenLimitPolicy)
+}
+
+// RateLimit is the number of events allowed per Window, a zero Limit
+// disables it.
+type RateLimit struct {
+	Limit  int
+	Window time.Duration
+}
+
+// SignupRateLimits parses SIGNUP_RATE_LIMIT and SIGNUP_DOMAIN_RATE_LIMIT,
+// the account creations allowed per IP and per email domain.
+func SignupRateLimits(c AppConfig) (ip, domain RateLimit, err error) {
+	if len(c.SignupRateLimit) > 0 {
+		ip, err = parseRateLimit("SIGNUP_RATE_LIMIT", c.SignupRateLimit)
+		if err != nil {
+			return RateLimit{}, RateLimit{}, err
+		}
+	}
+
+	if len(c.SignupDomainRateLimit) > 0 {
+		domain, err = parseRateLimit("SIGNUP_DOMAIN_RATE_LIMIT", c.SignupDomainRateLimit)
+		if err != nil {
+			return RateLimit{}, RateLimit{}, err
+		}
+	}
+	return ip, domain, nil
+}
+
+// DefaultEmailOTPTTL and DefaultEmailOTPRateLimit apply when EMAIL_OTP_TTL
+// and EMAIL_OTP_RATE_LIMIT are not set.
+var (
+	DefaultEmailOTPTTL       = 10 * time.Minute
+	DefaultEmailOTPRateLimit = RateLimit{Limit: 5, Window: 15 * time.Minute}
+)
+
+// EmailOTP parses EMAIL_OTP_TTL and EMAIL_OTP_RATE_LIMIT, the lifetime of
+// the login codes and how many codes and attempts are allowed per email.
+func EmailOTP(c AppConfig) (ttl time.Duration, limit RateLimit, err error) {
+	ttl, limit = DefaultEmailOTPTTL, DefaultEmailOTPRateLimit
+
+	if len(c.EmailOTPTTL) > 0 {
+		ttl, err = time.ParseDuration(c.EmailOTPTTL)
+		if err != nil || ttl <= 0 {
+			return 0, RateLimit{}, fmt.Errorf("EMAIL_OTP_TTL must be a positive duration i.e. 10m: %s", c.EmailOTPTTL)
+		}
+	}
+
+	if len(c.EmailOTPRateLimit) > 0 {
+		limit, err = parseRateLimit("EMAIL_OTP_RATE_LIMIT", c.EmailOTPRateLimit)
+		if err != nil {
+			return 0, RateLimit{}, err
+		}
+	}
+	return ttl, limit, nil
+}
+
+// EmailRecipientRateLimit parses EMAIL_RECIPIENT_RATE_LIMIT, the emails
+// sent to a recipient per window. A zero Limit means no limit.
+func EmailRecipientRateLimit(c AppConfig) (RateLimit, error) {
+	if len(c.EmailRecipientRateLimit) == 0 {
+		return RateLimit{}, nil
+	}
+	return parseRateLimit("EMAIL_RECIPIENT_RATE_LIMIT", c.EmailRecipientRateLimit)
+}
+
+// CSRFTrustedOrigins returns the origins allowed to post the forms without
+// a CSRF token, i.e. "https://www.example.com", see CSRF_TRUSTED_ORIGINS.
+func CSRFTrustedOrigins(c AppConfig) ([]string, error) {
+	var origins []string
+	for _, v := range strings.Split(c.CSRFTrustedOrigins, ",") {
+		v = strings.TrimSpace(v)
+		if len(v) == 0 {
+			continue
+		}
+
+		u, err := url.Parse(v)
+		if err != nil || len(u.Host) == 0 || (u.Scheme != "http" && u.Scheme != "https") || strings.Trim(u.Path, "/") != "" {
+			return nil, fmt.Errorf("CSRF_TRUSTED_ORIGINS must be http(s) origins i.e. https://www.example.com: %s", v)
+		}
+		origins = append(origins, u.Scheme+"://"+strings.ToLower(u.Host))
+	}
+	return origins, nil
+}
+
+// parseRateLimit parses a count/window rate limit i.e. "10/1h", "0" is
+// accepted without window to disable it.
+func parseRateLimit(name, v string) (RateLimit, error) {
+	if strings.TrimSpace(v) == "0" {
+		return RateLimit{}, nil
+	}
+
+	count, window, ok := strings.Cut(v, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("%s must be count/window i.e. 10/1h: %s", name, v)
+	}
+
+	limit, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || limit < 0 {
+		return RateLimit{}, fmt.Errorf("%s count must be a positive number: %s", name, v)
+	}
+
+	d, err := time.ParseDuration(strings.TrimSpace(window))
+	if err != nil || d <= 0 {
+		return RateLimit{}, fmt.Errorf("%s window must be a positive duration i.e. 1h: %s", name, v)
+	}
+	return RateLimit{Limit: limit, Window: d}, nil
+}
+
+// DisposableDomains parses DISPOSABLE_EMAIL_DOMAINS, the domains are
+// lowercased.
+func DisposableDomains(c AppConfig) (map[string]bool, error) {
+	domains := make(map[string]bool)
+	for _, d := range strings.Split(c.DisposableDomains, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if len(d) == 0 {
+			continue
+		} else if strings.ContainsAny(d, "@ /") {
+			return nil, fmt.Errorf("DISPOSABLE_EMAIL_DOMAINS invalid domain %s", d)
+		}
+		domains[d] = true
+	}
+	return domains, nil
+}
+
+// DefaultCompressionMinSize is the smallest compressed response body when
+// COMPRESSION_MIN_SIZE is not set.
+const DefaultCompressionMinSize = 1024
+
+// DefaultCompressionTypes are the compressed content types when
+// COMPRESSION_TYPES is not set.
+var DefaultCompressionTypes = []string{
+	"application/json",
+	"application/javascript",
+	"text/html",
+	"text/css",
+	"text/csv",
+	"text/plain",
+}
+
+// CompressionSettings parses COMPRESSION_MIN_SIZE and COMPRESSION_TYPES.
+func CompressionSettings(c AppConfig) (minSize int, types []string, err error) {
+	minSize = DefaultCompressionMinSize
+	if len(c.CompressionMinSize) > 0 {
+		minSize, err = strconv.Atoi(c.CompressionMinSize)
+		if err != nil || minSize < 0 {
+			return 0, nil, fmt.Errorf("COMPRESSION_MIN_SIZE must be a positive number of bytes: %s", c.CompressionMinSize)
+		}
+	}
+
+	for _, t := range strings.Split(c.CompressionTypes, ",") {
+		if t = strings.TrimSpace(t); len(t) > 0 {
+			types = append(types, strings.ToLower(t))
+		}
+	}
+	if len(types) == 0 {
+		types = DefaultCompressionTypes
+	}
+	return minSize, types, nil
+}
+
+// JobEnabled returns if the background job name is not in DISABLED_JOBS.
+func JobEnabled(c AppConfig, name string) bool {
+	for _, job := range strings.Split(c.DisabledJobs, ",") {
+		if strings.EqualFold(strings.TrimSpace(job), name) {
+			return false
+		}
+	}
+	return true
+}
+
+// DefaultUploadMaxSize is the upload limit when UPLOAD_MAX_SIZE is not set.
+const DefaultUploadMaxSize = 150 * 1000 * 1000
+
+// UploadLimits parses UPLOAD_ALLOWED_TYPES and UPLOAD_MAX_SIZE, the global
+// limits used by bases not defining their own.
+func UploadLimits(c AppConfig) (types []string, maxSize int64, err error) {
+	for _, t := range strings.Split(c.UploadAllowedTypes, ",") {
+		if t = strings.TrimSpace(t); len(t) > 0 {
+			types = append(types, strings.ToLower(t))
+		}
+	}
+
+	maxSize = DefaultUploadMaxSize
+	if len(c.UploadMaxSize) > 0 {
+		maxSize, err = strconv.ParseInt(c.UploadMaxSize, 10, 64)
+		if err != nil {
+			err = fmt.Errorf("UPLOAD_MAX_SIZE must be a number of bytes: %v", err)
+		}
+	}
+	return
+}
+
+// MailHeaders parses MAIL_HEADERS, the headers added to every email.
+func MailHeaders(c AppConfig) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(c.MailHeaders, ";") {
+		if len(strings.TrimSpace(pair)) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("MAIL_HEADERS invalid entry %s, expected Name:value", pair)
+		}
+
+		name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if len(name) == 0 || strings.ContainsAny(name+value, "\r\n") {
+			return nil, fmt.Errorf("MAIL_HEADERS invalid header %s", pair)
+		}
+		headers[name] = value
+	}
+	return headers, nil
+}
+
+// EmailBranding parses EMAIL_SUBJECTS and EMAIL_FROM_NAMES, the keys are
+// an email type, a base or base/type.
+func EmailBranding(c AppConfig) (subjects, fromNames map[string]string, err error) {
+	subjects, err = brandingEntries(c.EmailSubjects, "EMAIL_SUBJECTS")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for key, subject := range subjects {
+		if _, err := template.New(key).Parse(subject); err != nil {
+			return nil, nil, fmt.Errorf("EMAIL_SUBJECTS invalid subject template for %s: %v", key, err)
+		}
+	}
+
+	fromNames, err = brandingEntries(c.EmailFromNames, "EMAIL_FROM_NAMES")
+	if err != nil {
+		return nil, nil, err
+	}
+	return subjects, fromNames, nil
+}
+
+func brandingEntries(value, name string) (map[string]string, error) {
+	entries := make(map[string]string)
+	for _, pair := range strings.Split(value, ";") {
+		if len(strings.TrimSpace(pair)) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s invalid entry %s, expected key=value", name, pair)
+		}
+
+		key, v := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if len(key) == 0 || len(v) == 0 || strings.ContainsAny(v, "\r\n") {
+			return nil, fmt.Errorf("%s invalid entry %s", name, pair)
+		}
+		entries[key] = v
+	}
+	return entries, nil
+}
+
+// PublicURL returns PUBLIC_URL without trailing slash, http://localhost:PORT
+// when it's not set.
+func PublicURL(c AppConfig) string {
+	if len(c.PublicURL) > 0 {
+		return strings.TrimRight(c.PublicURL, "/")
+	}
+
+	port := c.Port
+	if len(port) == 0 {
+		port = "8099"
+	}
+	return "http://localhost:" + port
+}
+
+// BillingReturnLink returns the page the Stripe billing portal returns to,
+// the billing page of the server when BILLING_RETURN_URL is not set.
+func BillingReturnLink(c AppConfig) string {
+	if len(c.BillingReturnURL) > 0 {
+		return c.BillingReturnURL
+	}
+	return Link(c, "account/billing", nil)
+}
+
+// Link returns the absolute URL of p on the PublicURL, all links sent to
+// users must be built with it so self-hosted servers use their own domain.
+func Link(c AppConfig, p string, query url.Values) string {
+	link := PublicURL(c) + "/" + strings.TrimLeft(p, "/")
+	if len(query) > 0 {
+		link += "?" + query.Encode()
 	}
+	return link
 }
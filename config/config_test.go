@@ -0,0 +1,735 @@
+package config
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validProdConfig() AppConfig {
+	return AppConfig{
+		AppEnv:                AppEnvProd,
+		DatabaseURL:           "user=postgres password=postgres dbname=postgres sslmode=disable",
+		JWTSecret:             "a-long-enough-secret-for-production-use",
+		FromEmail:             "you@domain.com",
+		MailProvider:          "ses",
+		AWSRegion:             "us-east-1",
+		StripeKey:             "sk_live_123",
+		StripePriceIDIdea:     "price_idea",
+		StripePriceIDLaunch:   "price_launch",
+		StripePriceIDTraction: "price_traction",
+		StripePriceIDGrowth:   "price_growth",
+		StripeWebhookSecret:   "whsec_123",
+		BillingReturnURL:      "https://app.example.com/billing",
+	}
+}
+
+func TestValidateValid(t *testing.T) {
+	c := validProdConfig()
+	if err := Validate(&c); err != nil {
+		t.Errorf("expected prod config to be valid, got %v", err)
+	}
+
+	dev := AppConfig{AppEnv: AppEnvDev, DatabaseURL: "mem"}
+	if err := Validate(&dev); err != nil {
+		t.Errorf("expected dev config to be valid, got %v", err)
+	}
+}
+
+func TestValidateSetsSettings(t *testing.T) {
+	c := AppConfig{DatabaseURL: "mem", MaxPageSize: "50", TokenLimitPolicy: "evict"}
+	if err := Validate(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Settings.MaxPageSize != 50 || !c.Settings.EvictTokens {
+		t.Errorf("expected the settings to be parsed got %+v", c.Settings)
+	} else if c.Settings.LoginHistorySize != DefaultLoginHistory || c.Settings.DatastoreReadTimeout != DefaultDatastoreReadTimeout {
+		t.Errorf("expected the defaults for the unset settings got %+v", c.Settings)
+	}
+
+	c.LoginHistory = "-1"
+	if _, err := ParseSettings(c); err == nil || !strings.Contains(err.Error(), "LOGIN_HISTORY") {
+		t.Errorf("expected an invalid LOGIN_HISTORY to be reported got %v", err)
+	}
+}
+
+func TestValidateMissingDatabaseURL(t *testing.T) {
+	err := Validate(&AppConfig{AppEnv: AppEnvDev})
+	if err == nil {
+		t.Fatal("expected an error for missing DATABASE_URL")
+	} else if !strings.Contains(err.Error(), "DATABASE_URL") {
+		t.Errorf("expected error to mention DATABASE_URL, got %v", err)
+	}
+}
+
+func TestValidateProdAggregatesProblems(t *testing.T) {
+	c := validProdConfig()
+	c.JWTSecret = ""
+	c.StripePriceIDLaunch = ""
+	c.StripePriceIDGrowth = ""
+
+	err := Validate(&c)
+
+	var verr ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	} else if len(verr.Problems) != 3 {
+		t.Errorf("expected 3 problems, got %d: %v", len(verr.Problems), verr.Problems)
+	}
+
+	for _, name := range []string{"JWT_SECRET", "STRIPE_PRICEID_LAUNCH", "STRIPE_PRICEID_GROWTH"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("expected error to mention %s, got %v", name, err)
+		}
+	}
+}
+
+func TestValidateStripeWithoutKey(t *testing.T) {
+	c := validProdConfig()
+	c.StripeKey = ""
+	c.StripePriceIDIdea = ""
+
+	if err := Validate(&c); err != nil {
+		t.Errorf("price ids should not be required without a Stripe key, got %v", err)
+	}
+}
+
+func TestValidateStripeAPIVersion(t *testing.T) {
+	c := validProdConfig()
+	c.StripeAPIVersion = "2020-08-27"
+
+	if err := Validate(&c); err != nil {
+		t.Errorf("expected a dated Stripe API version to be valid, got %v", err)
+	}
+
+	c.StripeAPIVersion = "latest"
+	if err := Validate(&c); err == nil || !strings.Contains(err.Error(), "STRIPE_API_VERSION") {
+		t.Errorf("expected STRIPE_API_VERSION to be reported, got %v", err)
+	}
+}
+
+func TestCheckJWTSecret(t *testing.T) {
+	if err := CheckJWTSecret(""); err == nil {
+		t.Error("expected an error for an empty secret")
+	}
+
+	if err := CheckJWTSecret("changeMe"); err == nil {
+		t.Error("expected an error for a short secret")
+	}
+
+	if err := CheckJWTSecret(strings.Repeat("x", MinJWTSecretLength)); err != nil {
+		t.Errorf("expected secret of min length to be valid, got %v", err)
+	}
+}
+
+func TestValidateWeakJWTSecret(t *testing.T) {
+	c := validProdConfig()
+	c.JWTSecret = "changeMe"
+	if err := Validate(&c); err == nil || !strings.Contains(err.Error(), "JWT_SECRET") {
+		t.Errorf("expected weak secret to fail in prod, got %v", err)
+	}
+
+	// only a warning in dev
+	c.AppEnv = AppEnvDev
+	c.StripeKey = "sk_test_123"
+	if err := Validate(&c); err != nil {
+		t.Errorf("expected weak secret to only warn in dev, got %v", err)
+	}
+
+	c.JWTSecret = ""
+	if err := Validate(&c); err != nil {
+		t.Errorf("expected empty secret to only warn in dev, got %v", err)
+	}
+}
+
+func TestCheckStripeKey(t *testing.T) {
+	tests := []struct {
+		env      string
+		key      string
+		mismatch bool
+	}{
+		{AppEnvProd, "sk_live_123", false},
+		{AppEnvProd, "rk_live_123", false},
+		{AppEnvProd, "sk_test_123", true},
+		{AppEnvProd, "rk_test_123", true},
+		{AppEnvDev, "sk_test_123", false},
+		{AppEnvDev, "sk_live_123", true},
+		{AppEnvDev, "rk_live_123", true},
+		{"", "sk_live_123", true},
+		{AppEnvProd, "", false},
+		{AppEnvDev, "", false},
+	}
+
+	for _, tc := range tests {
+		err := CheckStripeKey(AppConfig{AppEnv: tc.env, StripeKey: tc.key})
+		if tc.mismatch && err == nil {
+			t.Errorf("env %q key %q: expected a mismatch", tc.env, tc.key)
+		} else if !tc.mismatch && err != nil {
+			t.Errorf("env %q key %q: unexpected mismatch %v", tc.env, tc.key, err)
+		}
+	}
+}
+
+func TestValidateStripeKeyMismatch(t *testing.T) {
+	prod := validProdConfig()
+	prod.StripeKey = "sk_test_123"
+
+	dev := AppConfig{AppEnv: AppEnvDev, DatabaseURL: "mem", StripeKey: "sk_live_123"}
+
+	for _, c := range []AppConfig{prod, dev} {
+		if err := Validate(&c); err == nil || !strings.Contains(err.Error(), "STRIPE_KEY") {
+			t.Errorf("env %s: expected the mismatch to be refused by default, got %v", c.AppEnv, err)
+		}
+
+		c.StripeKeyMismatch = StripeKeyMismatchWarn
+		if err := Validate(&c); err != nil {
+			t.Errorf("env %s: expected the mismatch to only warn, got %v", c.AppEnv, err)
+		}
+	}
+
+	prod.StripeKeyMismatch = "ignore"
+	if err := Validate(&prod); err == nil || !strings.Contains(err.Error(), "STRIPE_KEY_MISMATCH") {
+		t.Errorf("expected an invalid STRIPE_KEY_MISMATCH to be reported, got %v", err)
+	}
+}
+
+func TestDocumentSizeLimits(t *testing.T) {
+	c := AppConfig{MaxDocumentSize: "1024", DocumentSizeOverrides: "files:5000, logs:0"}
+
+	limits, err := DocumentSizeLimits(c)
+	if err != nil {
+		t.Fatal(err)
+	} else if limits[""] != 1024 || limits["files"] != 5000 || limits["logs"] != 0 {
+		t.Errorf("unexpected limits %v", limits)
+	}
+
+	c.DocumentSizeOverrides = "files=5000"
+	if _, err := DocumentSizeLimits(c); err == nil {
+		t.Error("expected an error for an invalid override")
+	}
+}
+
+func TestCollectionTTLs(t *testing.T) {
+	c := AppConfig{CollectionTTL: "sessions:lastSeen:24h, tokens:created:30m"}
+
+	ttls, err := CollectionTTLs(c)
+	if err != nil {
+		t.Fatal(err)
+	} else if ttls["sessions"] != (TTL{Field: "lastSeen", Duration: 24 * time.Hour}) || ttls["tokens"].Duration != 30*time.Minute {
+		t.Errorf("unexpected ttls %v", ttls)
+	}
+
+	for _, v := range []string{"sessions:24h", "sessions::24h", "sessions:lastSeen:forever", "sessions:lastSeen:-1h"} {
+		c.CollectionTTL = v
+		if _, err := CollectionTTLs(c); err == nil {
+			t.Errorf("expected an error for %q", v)
+		}
+	}
+}
+
+func TestCollectionRelations(t *testing.T) {
+	c := AppConfig{CollectionRelations: "tasks:projectId:projects, tasks:ownerId:users_600_, projects:clientId:clients"}
+
+	relations, err := CollectionRelations(c)
+	if err != nil {
+		t.Fatal(err)
+	} else if relations["tasks"]["projectId"] != "projects" || relations["tasks"]["ownerId"] != "users_600_" || relations["projects"]["clientId"] != "clients" {
+		t.Errorf("unexpected relations %v", relations)
+	}
+
+	for _, v := range []string{"tasks:projectId", "tasks::projects", "tasks:projectId:", "tasks:project.id:projects"} {
+		c.CollectionRelations = v
+		if _, err := CollectionRelations(c); err == nil {
+			t.Errorf("expected an error for %q", v)
+		}
+	}
+}
+
+func TestPlanPrices(t *testing.T) {
+	c := AppConfig{StripePriceCurrencies: "idea:EUR:price_idea_eur, launch:gbp:price_launch_gbp"}
+
+	prices, err := PlanPrices(c)
+	if err != nil {
+		t.Fatal(err)
+	} else if prices["idea"]["eur"] != "price_idea_eur" || prices["launch"]["gbp"] != "price_launch_gbp" {
+		t.Errorf("unexpected prices %v", prices)
+	}
+
+	for _, v := range []string{"idea:eur", "idea:euro:price_1", "idea:eur:", ":eur:price_1"} {
+		c.StripePriceCurrencies = v
+		if _, err := PlanPrices(c); err == nil {
+			t.Errorf("expected an error for %q", v)
+		}
+	}
+}
+
+func TestCountryCurrencies(t *testing.T) {
+	c := AppConfig{StripeCountryCurrencies: "fr:EUR, GB:gbp"}
+
+	currencies, err := CountryCurrencies(c)
+	if err != nil {
+		t.Fatal(err)
+	} else if currencies["FR"] != "eur" || currencies["GB"] != "gbp" {
+		t.Errorf("unexpected currencies %v", currencies)
+	}
+
+	for _, v := range []string{"FR", "FR:euro", ":eur"} {
+		c.StripeCountryCurrencies = v
+		if _, err := CountryCurrencies(c); err == nil {
+			t.Errorf("expected an error for %q", v)
+		}
+	}
+}
+
+func TestCollectionDefaults(t *testing.T) {
+	c := AppConfig{CollectionDefaults: "tasks:status:new, tasks:slug:slug(title), tasks:priority:3, tasks:note:a:b"}
+
+	defaults, err := CollectionDefaults(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := defaults["tasks"]
+	if len(tasks) != 4 {
+		t.Fatalf("expected 4 defaults got %v", tasks)
+	} else if tasks[0].Field != "status" || tasks[0].Value != "new" {
+		t.Errorf("expected status to default to new got %v", tasks[0])
+	} else if tasks[1].Field != "slug" || tasks[1].SlugOf != "title" {
+		t.Errorf("expected slug to be computed from title got %v", tasks[1])
+	} else if tasks[2].Value != 3.0 {
+		t.Errorf("expected priority to default to the number 3 got %v", tasks[2])
+	} else if tasks[3].Value != "a:b" {
+		t.Errorf("expected note to default to a:b got %v", tasks[3])
+	}
+
+	c.CollectionDefaults = "tasks:status"
+	if _, err := CollectionDefaults(c); err == nil {
+		t.Error("expected an error for an entry without value")
+	}
+}
+
+func TestCollectionLimits(t *testing.T) {
+	c := AppConfig{MaxCollections: "default:20, Growth:100"}
+
+	limits, err := CollectionLimits(c)
+	if err != nil {
+		t.Fatal(err)
+	} else if limits[CollectionLimitDefault] != 20 || limits["growth"] != 100 {
+		t.Errorf("unexpected limits %v", limits)
+	}
+
+	for _, v := range []string{"20", "growth:many", "growth:-1", ":20"} {
+		c.MaxCollections = v
+		if _, err := CollectionLimits(c); err == nil {
+			t.Errorf("expected an error for %q", v)
+		}
+	}
+}
+
+func TestLoginHistorySize(t *testing.T) {
+	if n, err := LoginHistorySize(AppConfig{}); err != nil || n != DefaultLoginHistory {
+		t.Errorf("expected the default %d got %d %v", DefaultLoginHistory, n, err)
+	} else if n, err := LoginHistorySize(AppConfig{LoginHistory: "0"}); err != nil || n != 0 {
+		t.Errorf("expected 0 to disable the history got %d %v", n, err)
+	}
+
+	for _, v := range []string{"-1", "many"} {
+		if _, err := LoginHistorySize(AppConfig{LoginHistory: v}); err == nil {
+			t.Errorf("expected an error for %q", v)
+		}
+	}
+}
+
+func TestPageSizeLimit(t *testing.T) {
+	if n, err := PageSizeLimit(AppConfig{}); err != nil || n != DefaultMaxPageSize {
+		t.Errorf("expected the default %d got %d %v", DefaultMaxPageSize, n, err)
+	} else if n, err := PageSizeLimit(AppConfig{MaxPageSize: "50"}); err != nil || n != 50 {
+		t.Errorf("expected 50 got %d %v", n, err)
+	}
+
+	for _, v := range []string{"0", "-1", "many"} {
+		if _, err := PageSizeLimit(AppConfig{MaxPageSize: v}); err == nil {
+			t.Errorf("expected an error for %q", v)
+		}
+	}
+}
+
+func TestDatastoreTimeouts(t *testing.T) {
+	read, write, err := DatastoreTimeouts(AppConfig{})
+	if err != nil {
+		t.Fatal(err)
+	} else if read != DefaultDatastoreReadTimeout || write != DefaultDatastoreWriteTimeout {
+		t.Errorf("expected the default timeouts got %v %v", read, write)
+	}
+
+	read, write, err = DatastoreTimeouts(AppConfig{DatastoreReadTimeout: "5s", DatastoreWriteTimeout: "0"})
+	if err != nil {
+		t.Fatal(err)
+	} else if read != 5*time.Second || write != 0 {
+		t.Errorf("expected 5s and no write timeout got %v %v", read, write)
+	}
+
+	for _, v := range []string{"-1s", "soon"} {
+		if _, _, err := DatastoreTimeouts(AppConfig{DatastoreWriteTimeout: v}); err == nil {
+			t.Errorf("expected an error for %q", v)
+		}
+	}
+}
+
+func TestJobEnabled(t *testing.T) {
+	c := AppConfig{DisabledJobs: "ttl-sweep, Trial-Reminder"}
+
+	tests := map[string]bool{
+		"ttl-sweep":      false,
+		"trial-reminder": false,
+		"token-prune":    true,
+	}
+	for name, expected := range tests {
+		if got := JobEnabled(c, name); got != expected {
+			t.Errorf("%s: expected %v got %v", name, expected, got)
+		}
+	}
+
+	if !JobEnabled(AppConfig{}, "ttl-sweep") {
+		t.Errorf("expected all jobs enabled by default")
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	types, maxSize, err := UploadLimits(AppConfig{})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(types) != 0 || maxSize != DefaultUploadMaxSize {
+		t.Errorf("expected all types up to the default size got %v %d", types, maxSize)
+	}
+
+	types, maxSize, err = UploadLimits(AppConfig{UploadAllowedTypes: "image/*, application/PDF", UploadMaxSize: "1000"})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(types) != 2 || types[1] != "application/pdf" || maxSize != 1000 {
+		t.Errorf("unexpected limits %v %d", types, maxSize)
+	}
+
+	if _, _, err := UploadLimits(AppConfig{UploadMaxSize: "big"}); err == nil {
+		t.Error("expected an invalid UPLOAD_MAX_SIZE to fail")
+	}
+}
+
+func TestEmailBranding(t *testing.T) {
+	c := AppConfig{
+		EmailSubjects:  "account-created=Welcome to Acme; mybase/login-alert=New sign-in to {{.Base}}",
+		EmailFromNames: "mybase=Acme;mybase/login-alert=Acme Security",
+	}
+
+	subjects, fromNames, err := EmailBranding(c)
+	if err != nil {
+		t.Fatal(err)
+	} else if subjects["account-created"] != "Welcome to Acme" || subjects["mybase/login-alert"] != "New sign-in to {{.Base}}" {
+		t.Errorf("unexpected subjects %v", subjects)
+	} else if fromNames["mybase"] != "Acme" || fromNames["mybase/login-alert"] != "Acme Security" {
+		t.Errorf("unexpected from-names %v", fromNames)
+	}
+
+	for _, v := range []string{"account-created", "=Welcome", "account-created=", "account-created=Welcome {{.Base"} {
+		if _, _, err := EmailBranding(AppConfig{EmailSubjects: v}); err == nil {
+			t.Errorf("expected an error for %q", v)
+		}
+	}
+	if _, _, err := EmailBranding(AppConfig{EmailFromNames: "mybase"}); err == nil {
+		t.Error("expected an error for a from-name without value")
+	}
+}
+
+func TestMailHeaders(t *testing.T) {
+	headers, err := MailHeaders(AppConfig{MailHeaders: "X-Campaign:signup; List-Unsubscribe:<mailto:unsub@example.com>"})
+	if err != nil {
+		t.Fatal(err)
+	} else if headers["X-Campaign"] != "signup" || headers["List-Unsubscribe"] != "<mailto:unsub@example.com>" {
+		t.Errorf("unexpected headers %v", headers)
+	}
+
+	if _, err := MailHeaders(AppConfig{MailHeaders: "X-Campaign"}); err == nil {
+		t.Error("expected an entry without value to fail")
+	}
+}
+
+func TestLink(t *testing.T) {
+	tests := []struct {
+		conf     AppConfig
+		path     string
+		query    url.Values
+		expected string
+	}{
+		{AppConfig{}, "stripe", nil, "http://localhost:8099/stripe"},
+		{AppConfig{Port: "8080"}, "/stripe", nil, "http://localhost:8080/stripe"},
+		{AppConfig{PublicURL: "https://api.example.com/"}, "/password/reset", url.Values{"code": {"abc"}}, "https://api.example.com/password/reset?code=abc"},
+	}
+
+	for _, tc := range tests {
+		if link := Link(tc.conf, tc.path, tc.query); link != tc.expected {
+			t.Errorf("expected %s got %s", tc.expected, link)
+		}
+	}
+
+	if err := Validate(&AppConfig{DatabaseURL: "x", PublicURL: "api.example.com"}); err == nil || !strings.Contains(err.Error(), "PUBLIC_URL") {
+		t.Errorf("expected a relative PUBLIC_URL to be rejected, got %v", err)
+	}
+}
+
+func TestBillingReturnLink(t *testing.T) {
+	if link := BillingReturnLink(AppConfig{PublicURL: "https://api.example.com"}); link != "https://api.example.com/account/billing" {
+		t.Errorf("expected the billing page of the server got %s", link)
+	} else if link := BillingReturnLink(validProdConfig()); link != "https://app.example.com/billing" {
+		t.Errorf("expected BILLING_RETURN_URL got %s", link)
+	}
+
+	c := validProdConfig()
+	c.BillingReturnURL = ""
+	if err := Validate(&c); err == nil || !strings.Contains(err.Error(), "BILLING_RETURN_URL") {
+		t.Errorf("expected BILLING_RETURN_URL to be required in prod, got %v", err)
+	}
+
+	c.BillingReturnURL = "/billing"
+	if err := Validate(&c); err == nil || !strings.Contains(err.Error(), "BILLING_RETURN_URL") {
+		t.Errorf("expected a relative BILLING_RETURN_URL to be rejected, got %v", err)
+	}
+}
+
+func TestCompressionSettings(t *testing.T) {
+	minSize, types, err := CompressionSettings(AppConfig{})
+	if err != nil {
+		t.Fatal(err)
+	} else if minSize != DefaultCompressionMinSize || len(types) != len(DefaultCompressionTypes) {
+		t.Errorf("expected the defaults got %d %v", minSize, types)
+	}
+
+	minSize, types, err = CompressionSettings(AppConfig{CompressionMinSize: "0", CompressionTypes: "application/json, Text/CSV"})
+	if err != nil {
+		t.Fatal(err)
+	} else if minSize != 0 || len(types) != 2 || types[1] != "text/csv" {
+		t.Errorf("unexpected settings %d %v", minSize, types)
+	}
+
+	for _, v := range []string{"-1", "1kb"} {
+		if _, _, err := CompressionSettings(AppConfig{CompressionMinSize: v}); err == nil {
+			t.Errorf("expected an error for %q", v)
+		}
+	}
+}
+
+func TestSignupRateLimits(t *testing.T) {
+	ip, domain, err := SignupRateLimits(AppConfig{})
+	if err != nil {
+		t.Fatal(err)
+	} else if ip.Limit != 0 || domain.Limit != 0 {
+		t.Errorf("expected the limits to be disabled by default got %v %v", ip, domain)
+	}
+
+	ip, domain, err = SignupRateLimits(AppConfig{SignupRateLimit: "10/1h", SignupDomainRateLimit: "20 / 24h"})
+	if err != nil {
+		t.Fatal(err)
+	} else if ip.Limit != 10 || ip.Window != time.Hour || domain.Limit != 20 || domain.Window != 24*time.Hour {
+		t.Errorf("unexpected limits %v %v", ip, domain)
+	}
+
+	for _, v := range []string{"10", "-1/1h", "10/0s", "ten/1h"} {
+		if _, _, err := SignupRateLimits(AppConfig{SignupRateLimit: v}); err == nil {
+			t.Errorf("expected an error for %q", v)
+		}
+	}
+}
+
+func TestEmailRecipientRateLimit(t *testing.T) {
+	if limit, err := EmailRecipientRateLimit(AppConfig{}); err != nil {
+		t.Fatal(err)
+	} else if limit.Limit != 0 {
+		t.Errorf("expected no limit by default got %v", limit)
+	}
+
+	limit, err := EmailRecipientRateLimit(AppConfig{EmailRecipientRateLimit: "3/1h"})
+	if err != nil {
+		t.Fatal(err)
+	} else if limit.Limit != 3 || limit.Window != time.Hour {
+		t.Errorf("unexpected limit %v", limit)
+	}
+
+	for _, v := range []string{"3", "3/soon", "-1/1h"} {
+		if _, err := EmailRecipientRateLimit(AppConfig{EmailRecipientRateLimit: v}); err == nil {
+			t.Errorf("expected an error for %s", v)
+		}
+	}
+}
+
+func TestEmailOTP(t *testing.T) {
+	ttl, limit, err := EmailOTP(AppConfig{})
+	if err != nil {
+		t.Fatal(err)
+	} else if ttl != DefaultEmailOTPTTL || limit != DefaultEmailOTPRateLimit {
+		t.Errorf("expected the defaults got %v %v", ttl, limit)
+	}
+
+	ttl, limit, err = EmailOTP(AppConfig{EmailOTPTTL: "5m", EmailOTPRateLimit: "3/1h"})
+	if err != nil {
+		t.Fatal(err)
+	} else if ttl != 5*time.Minute || limit.Limit != 3 || limit.Window != time.Hour {
+		t.Errorf("unexpected settings %v %v", ttl, limit)
+	}
+
+	for _, c := range []AppConfig{{EmailOTPTTL: "0s"}, {EmailOTPTTL: "soon"}, {EmailOTPRateLimit: "3"}} {
+		if _, _, err := EmailOTP(c); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+}
+
+func TestTokenLimit(t *testing.T) {
+	max, evict, err := TokenLimit(AppConfig{})
+	if err != nil {
+		t.Fatal(err)
+	} else if max != 0 || evict {
+		t.Errorf("expected no limit by default got %d %v", max, evict)
+	}
+
+	max, evict, err = TokenLimit(AppConfig{MaxTokensPerUser: "5", TokenLimitPolicy: "Evict"})
+	if err != nil {
+		t.Fatal(err)
+	} else if max != 5 || !evict {
+		t.Errorf("unexpected limit %d %v", max, evict)
+	}
+
+	for _, c := range []AppConfig{{MaxTokensPerUser: "-1"}, {MaxTokensPerUser: "many"}, {TokenLimitPolicy: "drop"}} {
+		if _, _, err := TokenLimit(c); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+}
+
+func TestCSRFTrustedOrigins(t *testing.T) {
+	origins, err := CSRFTrustedOrigins(AppConfig{})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(origins) != 0 {
+		t.Errorf("expected no origins by default got %v", origins)
+	}
+
+	origins, err = CSRFTrustedOrigins(AppConfig{CSRFTrustedOrigins: "https://WWW.example.com/, http://localhost:3000,"})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(origins) != 2 || origins[0] != "https://www.example.com" || origins[1] != "http://localhost:3000" {
+		t.Errorf("unexpected origins %v", origins)
+	}
+
+	for _, v := range []string{"www.example.com", "ftp://example.com", "https://example.com/signup"} {
+		if _, err := CSRFTrustedOrigins(AppConfig{CSRFTrustedOrigins: v}); err == nil {
+			t.Errorf("expected an error for %s", v)
+		}
+	}
+}
+
+func TestDisposableDomains(t *testing.T) {
+	domains, err := DisposableDomains(AppConfig{})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(domains) != 0 {
+		t.Errorf("expected no domains by default got %v", domains)
+	}
+
+	domains, err = DisposableDomains(AppConfig{DisposableDomains: "Mailinator.com, yopmail.com,"})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(domains) != 2 || !domains["mailinator.com"] {
+		t.Errorf("unexpected domains %v", domains)
+	}
+
+	if _, err := DisposableDomains(AppConfig{DisposableDomains: "bot@mailinator.com"}); err == nil {
+		t.Errorf("expected an error for an email address")
+	}
+}
+
+func TestTokenVersion(t *testing.T) {
+	tests := map[string]int{"": 1, "1": 1, "2": 2, "v2": 2}
+	for v, expected := range tests {
+		if got, err := TokenVersion(AppConfig{TokenVersion: v}); err != nil {
+			t.Errorf("%q: %v", v, err)
+		} else if got != expected {
+			t.Errorf("%q: expected %d got %d", v, expected, got)
+		}
+	}
+
+	if _, err := TokenVersion(AppConfig{TokenVersion: "3"}); err == nil {
+		t.Errorf("expected an error for an unknown version")
+	}
+}
+
+func TestDefaultUserRole(t *testing.T) {
+	tests := map[string]int{"": 0, "0": 0, "10": 10, "99": 99}
+	for v, expected := range tests {
+		if got, err := DefaultUserRole(AppConfig{DefaultUserRole: v}); err != nil {
+			t.Errorf("%q: %v", v, err)
+		} else if got != expected {
+			t.Errorf("%q: expected %d got %d", v, expected, got)
+		}
+	}
+
+	for _, v := range []string{"100", "-1", "admin"} {
+		if _, err := DefaultUserRole(AppConfig{DefaultUserRole: v}); err == nil {
+			t.Errorf("%q: expected an error", v)
+		}
+	}
+}
+
+func TestSlowQueryThreshold(t *testing.T) {
+	if d, err := SlowQueryThreshold(AppConfig{}); err != nil || d != 0 {
+		t.Errorf("expected the slow query log to be disabled by default got %v %v", d, err)
+	}
+
+	if d, err := SlowQueryThreshold(AppConfig{SlowQueryThreshold: "250ms"}); err != nil {
+		t.Fatal(err)
+	} else if d != 250*time.Millisecond {
+		t.Errorf("expected 250ms got %v", d)
+	}
+
+	for _, v := range []string{"fast", "0s", "-1s"} {
+		if _, err := SlowQueryThreshold(AppConfig{SlowQueryThreshold: v}); err == nil {
+			t.Errorf("%q: expected an error", v)
+		}
+	}
+}
+
+func TestRealtimeConnectionLimits(t *testing.T) {
+	limits, err := RealtimeConnectionLimits(AppConfig{MaxRealtimeConnections: "default:100, Growth:1000"})
+	if err != nil {
+		t.Fatal(err)
+	} else if limits[PlanLimitDefault] != 100 || limits["growth"] != 1000 {
+		t.Errorf("unexpected limits %v", limits)
+	}
+
+	if _, err := RealtimeConnectionLimits(AppConfig{MaxRealtimeConnections: "default:-1"}); err == nil || !strings.Contains(err.Error(), "MAX_REALTIME_CONNECTIONS") {
+		t.Errorf("expected an error naming the setting got %v", err)
+	}
+}
+
+func TestRealtimeHistory(t *testing.T) {
+	size, ttl, err := RealtimeHistory(AppConfig{})
+	if err != nil {
+		t.Fatal(err)
+	} else if size != 0 || ttl != DefaultRealtimeHistoryTTL {
+		t.Errorf("expected the history to be disabled by default got %d %v", size, ttl)
+	}
+
+	size, ttl, err = RealtimeHistory(AppConfig{RealtimeHistory: "50", RealtimeHistoryTTL: "1m"})
+	if err != nil {
+		t.Fatal(err)
+	} else if size != 50 || ttl != time.Minute {
+		t.Errorf("expected 50 messages for 1m got %d %v", size, ttl)
+	}
+
+	for _, c := range []AppConfig{{RealtimeHistory: "-1"}, {RealtimeHistoryTTL: "0s"}} {
+		if _, _, err := RealtimeHistory(c); err == nil {
+			t.Errorf("expected an error for %v", c)
+		}
+	}
+}
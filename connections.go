@@ -0,0 +1,118 @@
+package staticbackend
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/staticbackendhq/core/config"
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+	"github.com/staticbackendhq/core/realtime"
+)
+
+// realtimeConnections are the open SSE and websocket connections per base.
+var realtimeConnections = realtime.NewConnections()
+
+// realtimeConnectionLimit returns the maximum open realtime connections of
+// a base on plan, 0 means no limit.
+func realtimeConnectionLimit(plan int) int {
+	return planLimit(config.Current.Settings.RealtimeConnectionLimits, plan)
+}
+
+// baseRealtimeConnectionLimit returns the realtime connection limit of the
+// plan of the base's customer.
+func baseRealtimeConnectionLimit(conf internal.BaseConfig) (int, error) {
+	if len(config.Current.Settings.RealtimeConnectionLimits) == 0 {
+		return 0, nil
+	}
+
+	cus, err := datastore.FindAccount(conf.CustomerID)
+	if err != nil {
+		return 0, err
+	}
+	return realtimeConnectionLimit(cus.Plan), nil
+}
+
+// limitRealtimeConnections refuses a connection past the limit of the base
+// with a 429. The connection is counted until the client disconnects.
+func limitRealtimeConnections(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conf, err := middleware.BaseFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "invalid StaticBackend key", http.StatusUnauthorized)
+			return
+		} else if !openRealtimeConnection(w, conf) {
+			return
+		}
+
+		// the request context is done once the client disconnects
+		go func() {
+			<-r.Context().Done()
+			realtimeConnections.Close(conf.ID)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// openRealtimeConnection counts a connection to the base, past its limit
+// the request is refused with a 429 and false is returned. The caller
+// closes the connection once the client disconnects.
+func openRealtimeConnection(w http.ResponseWriter, conf internal.BaseConfig) bool {
+	limit, err := baseRealtimeConnectionLimit(conf)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	} else if !realtimeConnections.Open(conf.ID, limit) {
+		http.Error(w, "realtime connection limit reached for this base", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// realtimeOriginAllowed returns if a realtime connection from origin is
+// allowed for the base, see REALTIME_CHECK_ORIGIN.
+func realtimeOriginAllowed(conf internal.BaseConfig, origin string) bool {
+	if !strings.EqualFold(config.Current.RealtimeCheckOrigin, "yes") {
+		return true
+	}
+	return conf.OriginAllowed(origin)
+}
+
+// checkRealtimeOrigin refuses with a 403 the SSE connection from an origin
+// not allowed for the base.
+func checkRealtimeOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conf, err := middleware.BaseFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "invalid StaticBackend key", http.StatusUnauthorized)
+			return
+		} else if !realtimeOriginAllowed(conf, r.Header.Get("Origin")) {
+			http.Error(w, "origin not allowed for this base", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// realtimeStats returns the open realtime connections of the base and its
+// limit.
+func realtimeStats(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, "invalid StaticBackend key", http.StatusUnauthorized)
+		return
+	}
+
+	limit, err := baseRealtimeConnectionLimit(conf)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, http.StatusOK, map[string]int{
+		"connections": realtimeConnections.Count(conf.ID),
+		"limit":       limit,
+	})
+}
@@ -93,3 +93,18 @@ func (m *Memory) GetFirstTokenFromAccountID(dbName, accountID string) (tok inter
 	tok = matches[0]
 	return
 }
+
+func (m *Memory) ListTokens(dbName, accountID string) ([]internal.Token, error) {
+	tokens, err := all[internal.Token](m, dbName, "sb_tokens")
+	if err != nil {
+		return nil, err
+	}
+
+	matches := filter(tokens, func(t internal.Token) bool {
+		return t.AccountID == accountID
+	})
+
+	return sortSlice(matches, func(a, b internal.Token) bool {
+		return a.Created.Before(b.Created)
+	}), nil
+}
@@ -3,6 +3,7 @@ package memory
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -23,6 +24,11 @@ func (m *Memory) CreateDocument(auth internal.Auth, dbName, col string, doc map[
 	doc[FieldAccountID] = auth.AccountID
 	doc[FieldOwnerID] = auth.UserID
 	doc[FieldCreated] = time.Now()
+	internal.Touch(doc)
+
+	if err := m.checkUnique(dbName, col, id, doc); err != nil {
+		return nil, err
+	}
 
 	if err := create(m, dbName, col, id, doc); err != nil {
 		return nil, err
@@ -30,6 +36,30 @@ func (m *Memory) CreateDocument(auth internal.Auth, dbName, col string, doc map[
 	return doc, nil
 }
 
+func (m *Memory) CreateDocumentIfAbsent(auth internal.Auth, dbName, col string, filter map[string]any, doc map[string]any) (map[string]any, bool, error) {
+	m.createMutex.Lock()
+	defer m.createMutex.Unlock()
+
+	if _, ok := m.DB[fmt.Sprintf("%s_%s", dbName, col)]; ok {
+		list, err := all[map[string]any](m, dbName, col)
+		if err != nil {
+			return nil, false, err
+		}
+
+		for _, existing := range secureRead(auth, col, list) {
+			if matchesFilter(existing, filter) {
+				return existing, false, nil
+			}
+		}
+	}
+
+	inserted, err := m.CreateDocument(auth, dbName, col, doc)
+	if err != nil {
+		return nil, false, err
+	}
+	return inserted, true, nil
+}
+
 func (m *Memory) BulkCreateDocument(auth internal.Auth, dbName, col string, docs []interface{}) error {
 	for _, v := range docs {
 		doc, ok := v.(map[string]any)
@@ -53,11 +83,7 @@ func (m *Memory) ListDocuments(auth internal.Auth, dbName, col string, params in
 
 	list = secureRead(auth, col, list)
 
-	if params.SortDescending {
-		list = sortSlice(list, func(a, b map[string]any) bool {
-			return fmt.Sprintf("%v", a[FieldCreated]) > fmt.Sprintf("%v", b[FieldCreated])
-		})
-	}
+	list = sortDocuments(list, params)
 
 	start := (params.Page - 1) * params.Size
 	end := start + params.Size - 1
@@ -68,8 +94,13 @@ func (m *Memory) ListDocuments(auth internal.Auth, dbName, col string, params in
 
 	result.Page = params.Page
 	result.Size = params.Size
-	result.Total = int64(len(list))
-	result.Results = list[start:end]
+	result.Results = projectDocuments(list[start:end], params.Fields)
+
+	if params.SkipCount {
+		result.CountSkipped = true
+	} else {
+		result.Total = int64(len(list))
+	}
 
 	return
 }
@@ -84,42 +115,13 @@ func (m *Memory) QueryDocuments(auth internal.Auth, dbName, col string, filter m
 
 	var filtered []map[string]any
 	for _, doc := range list {
-		matches := 0
-		for k, v := range filter {
-			op, field := extractOperatorAndValue(k)
-			switch op {
-			case "=":
-				if equal(doc[field], v) {
-					matches++
-				}
-			case "!=":
-				if notEqual(doc[field], v) {
-					matches++
-				}
-			case ">":
-				if greater(doc[field], v) {
-					matches++
-				}
-			case "<":
-				if lower(doc[field], v) {
-					matches++
-				}
-			case ">=":
-				if greaterThanEqual(doc[field], v) {
-					matches++
-				}
-			case "<=":
-				if lowerThanEqual(doc[field], v) {
-					matches++
-				}
-			}
-		}
-
-		if matches == len(filter) {
+		if matchesFilter(doc, filter) {
 			filtered = append(filtered, doc)
 		}
 	}
 
+	filtered = sortDocuments(filtered, params)
+
 	start := (params.Page - 1) * params.Size
 	end := start + params.Size - 1
 
@@ -129,12 +131,33 @@ func (m *Memory) QueryDocuments(auth internal.Auth, dbName, col string, filter m
 
 	result.Page = params.Page
 	result.Size = params.Size
-	result.Total = int64(len(filtered))
-	result.Results = filtered[start:end]
+	result.Results = projectDocuments(filtered[start:end], params.Fields)
+
+	if params.SkipCount {
+		result.CountSkipped = true
+	} else {
+		result.Total = int64(len(filtered))
+	}
 
 	return
 }
 
+// ExplainQuery describes how QueryDocuments runs, the memory datastore
+// has no planner and always scans the whole collection.
+func (m *Memory) ExplainQuery(auth internal.Auth, dbName, col string, filter map[string]any, params internal.ListParams) (map[string]any, error) {
+	list, err := all[map[string]any](m, dbName, col)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"stage":    "full scan",
+		"scanned":  len(list),
+		"filtered": len(filter) > 0,
+		"sorted":   len(params.Sort) > 0,
+	}, nil
+}
+
 func (m *Memory) GetDocumentByID(auth internal.Auth, dbName, col, id string) (doc map[string]interface{}, err error) {
 	err = getByID(m, dbName, col, id, &doc)
 
@@ -147,6 +170,26 @@ func (m *Memory) GetDocumentByID(auth internal.Auth, dbName, col, id string) (do
 	return
 }
 
+func (m *Memory) GetDocumentsByIDs(auth internal.Auth, dbName, col string, ids []string) ([]map[string]any, error) {
+	list, err := all[map[string]any](m, dbName, col)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	var docs []map[string]any
+	for _, doc := range secureRead(auth, col, list) {
+		if id, ok := doc[FieldID].(string); ok && wanted[id] {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
 func (m *Memory) UpdateDocument(auth internal.Auth, dbName, col, id string, doc map[string]any) (exists map[string]any, err error) {
 	exists, err = m.GetDocumentByID(auth, dbName, col, id)
 	if err != nil {
@@ -160,14 +203,80 @@ func (m *Memory) UpdateDocument(auth internal.Auth, dbName, col, id string, doc
 	delete(doc, FieldAccountID)
 	delete(doc, FieldOwnerID)
 
+	// dot path keys update a nested field
 	for k, v := range doc {
-		exists[k] = v
+		internal.SetPath(exists, k, v)
+	}
+	internal.Touch(exists)
+
+	if err = m.checkUnique(dbName, col, id, exists); err != nil {
+		return
 	}
 
 	err = create(m, dbName, col, id, exists)
 	return
 }
 
+func (m *Memory) ReplaceDocument(auth internal.Auth, dbName, col, id string, doc map[string]any) (map[string]any, error) {
+	exists, err := m.GetDocumentByID(auth, dbName, col, id)
+	if err != nil {
+		return nil, err
+	} else if !canWrite(auth, col, exists) {
+		return nil, errors.New("not authorized")
+	}
+
+	replaced := make(map[string]any)
+	for k, v := range doc {
+		replaced[k] = v
+	}
+
+	// the system fields are kept
+	for _, k := range []string{FieldID, FieldAccountID, FieldOwnerID, FieldCreated} {
+		replaced[k] = exists[k]
+	}
+	internal.Touch(replaced)
+
+	if err := m.checkUnique(dbName, col, id, replaced); err != nil {
+		return nil, err
+	} else if err := create(m, dbName, col, id, replaced); err != nil {
+		return nil, err
+	}
+	return replaced, nil
+}
+
+func (m *Memory) UpdateByFilter(auth internal.Auth, dbName, col string, filter map[string]any, doc map[string]any) (n int64, err error) {
+	list, err := all[map[string]any](m, dbName, col)
+	if err != nil {
+		return
+	}
+
+	delete(doc, FieldID)
+	delete(doc, FieldAccountID)
+	delete(doc, FieldOwnerID)
+
+	for _, exists := range secureRead(auth, col, list) {
+		if !matchesFilter(exists, filter) || !canWrite(auth, col, exists) {
+			continue
+		}
+
+		for k, v := range doc {
+			internal.SetPath(exists, k, v)
+		}
+		internal.Touch(exists)
+
+		id := fmt.Sprintf("%v", exists[FieldID])
+		if err = m.checkUnique(dbName, col, id, exists); err != nil {
+			return
+		} else if err = create(m, dbName, col, id, exists); err != nil {
+			return
+		}
+		n++
+
+		m.PublishDocument("db-"+col, internal.MsgTypeDBUpdated, exists)
+	}
+	return
+}
+
 func (m *Memory) IncrementValue(auth internal.Auth, dbName, col, id, field string, n int) error {
 	doc, err := m.GetDocumentByID(auth, dbName, col, id)
 	if err != nil {
@@ -189,6 +298,7 @@ func (m *Memory) IncrementValue(auth internal.Auth, dbName, col, id, field strin
 	i += n
 
 	doc[field] = i
+	internal.Touch(doc)
 
 	return create(m, dbName, col, id, doc)
 }
@@ -216,6 +326,87 @@ func (m *Memory) DeleteDocument(auth internal.Auth, dbName, col, id string) (n i
 	return
 }
 
+func (m *Memory) DeleteByFilter(auth internal.Auth, dbName, col string, filter map[string]any) (n int64, err error) {
+	list, err := all[map[string]any](m, dbName, col)
+	if err != nil {
+		return
+	}
+
+	key := fmt.Sprintf("%s_%s", dbName, col)
+	docs := m.DB[key]
+
+	for _, doc := range secureRead(auth, col, list) {
+		if !matchesFilter(doc, filter) || !canWrite(auth, col, doc) {
+			continue
+		}
+
+		id := fmt.Sprintf("%v", doc[FieldID])
+		delete(docs, id)
+		n++
+
+		m.PublishDocument("db-"+col, internal.MsgTypeDBDeleted, id)
+	}
+
+	m.DB[key] = docs
+	return
+}
+
+func (m *Memory) DeleteExpired(dbName, col, field string, before time.Time) (n int64, err error) {
+	list, err := all[map[string]any](m, dbName, col)
+	if err != nil {
+		return
+	}
+
+	key := fmt.Sprintf("%s_%s", dbName, col)
+	docs := m.DB[key]
+
+	for _, doc := range list {
+		v, _ := internal.GetPath(doc, field)
+		s, ok := v.(string)
+		if !ok {
+			continue
+		} else if t, err := time.Parse(time.RFC3339, s); err != nil || t.After(before) {
+			continue
+		}
+
+		id := fmt.Sprintf("%v", doc[FieldID])
+		delete(docs, id)
+		n++
+
+		m.PublishDocument("db-"+col, internal.MsgTypeDBDeleted, id)
+	}
+
+	m.DB[key] = docs
+	return
+}
+
+func (m *Memory) TruncateCollection(dbName, col string) (int64, error) {
+	key := fmt.Sprintf("%s_%s", dbName, col)
+
+	docs, ok := m.DB[key]
+	if !ok {
+		return 0, errors.New("collection not found")
+	}
+
+	for id := range docs {
+		m.PublishDocument("db-"+col, internal.MsgTypeDBDeleted, id)
+	}
+
+	m.DB[key] = make(map[string][]byte)
+	return int64(len(docs)), nil
+}
+
+func (m *Memory) DropCollection(dbName, col string) error {
+	key := fmt.Sprintf("%s_%s", dbName, col)
+
+	delete(m.DB, key)
+
+	m.indexMutex.Lock()
+	delete(m.indexes, key)
+	m.indexMutex.Unlock()
+	return nil
+}
+
 func (m *Memory) ListCollections(dbName string) (repos []string, err error) {
 	for key := range m.DB {
 		pairs := strings.Split(key, "_")
@@ -228,6 +419,72 @@ func (m *Memory) ListCollections(dbName string) (repos []string, err error) {
 
 }
 
+// Stats sizes the encoded documents, the indexes are not stored in memory.
+func (m *Memory) Stats(dbName string) (stats internal.BaseStats, err error) {
+	cols, err := m.ListCollections(dbName)
+	if err != nil {
+		return
+	}
+	sort.Strings(cols)
+
+	for _, col := range cols {
+		docs := m.DB[fmt.Sprintf("%s_%s", dbName, col)]
+
+		cs := internal.CollectionStats{Name: col, Documents: int64(len(docs))}
+		for _, b := range docs {
+			cs.Bytes += int64(len(b))
+		}
+		stats.Add(cs)
+	}
+	return
+}
+
+// matchesFilter returns true when doc satisfies all the clauses of a
+// filter returned by ParseQuery.
+func matchesFilter(doc map[string]any, filter map[string]any) bool {
+	for k, v := range filter {
+		op, field := extractOperatorAndValue(k)
+		val, _ := internal.GetPath(doc, field)
+
+		var ok bool
+		switch op {
+		case "=":
+			ok = equal(val, v)
+		case "!=":
+			ok = notEqual(val, v)
+		case ">":
+			ok = greater(val, v)
+		case "<":
+			ok = lower(val, v)
+		case ">=":
+			ok = greaterThanEqual(val, v)
+		case "<=":
+			ok = lowerThanEqual(val, v)
+		case "in":
+			for _, candidate := range v.([]interface{}) {
+				if equal(val, candidate) {
+					ok = true
+					break
+				}
+			}
+		case "contains":
+			s, isText := val.(string)
+			ok = isText && strings.Contains(s, v.(string))
+		case "near":
+			lng, lat, isPoint := internal.GeoPoint(val)
+			ok = isPoint && v.(internal.GeoNear).Contains(lng, lat)
+		case "within":
+			lng, lat, isPoint := internal.GeoPoint(val)
+			ok = isPoint && v.(internal.GeoBox).Contains(lng, lat)
+		}
+
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
 func extractOperatorAndValue(s string) (op string, field string) {
 	parts := strings.Split(s, " ")
 	if len(parts) < 2 {
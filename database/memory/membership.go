@@ -1,6 +1,7 @@
 package memory
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -8,6 +9,12 @@ import (
 )
 
 func (m *Memory) CreateUserAccount(dbName, email string) (id string, err error) {
+	email = internal.NormalizeEmail(email)
+
+	if exists, _ := m.UserEmailExists(dbName, email); exists {
+		return "", internal.ErrEmailTaken
+	}
+
 	id = m.NewID()
 
 	acct := internal.Account{
@@ -20,6 +27,12 @@ func (m *Memory) CreateUserAccount(dbName, email string) (id string, err error)
 }
 
 func (m *Memory) CreateUserToken(dbName string, tok internal.Token) (id string, err error) {
+	tok.Email = internal.NormalizeEmail(tok.Email)
+
+	if exists, _ := m.UserEmailExists(dbName, tok.Email); exists {
+		return "", internal.ErrEmailTaken
+	}
+
 	id = m.NewID()
 	tok.ID = id
 
@@ -27,6 +40,52 @@ func (m *Memory) CreateUserToken(dbName string, tok internal.Token) (id string,
 	return
 }
 
+func (m *Memory) CreateUsers(dbName string, toks []internal.Token) ([]internal.Token, error) {
+	m.usersMutex.Lock()
+	defer m.usersMutex.Unlock()
+
+	seen := make(map[string]bool)
+	for _, tok := range toks {
+		email := internal.NormalizeEmail(tok.Email)
+		if exists, _ := m.UserEmailExists(dbName, email); exists || seen[email] {
+			return nil, internal.ErrEmailTaken
+		}
+		seen[email] = true
+	}
+
+	created := make([]internal.Token, 0, len(toks))
+	for _, tok := range toks {
+		tok.Email = internal.NormalizeEmail(tok.Email)
+		tok.AccountID = m.NewID()
+		tok.ID = m.NewID()
+
+		acct := internal.Account{
+			ID:      tok.AccountID,
+			Created: tok.Created,
+			Email:   tok.Email,
+		}
+		if err := create(m, dbName, "sb_accounts", acct.ID, acct); err != nil {
+			return nil, err
+		} else if err := create(m, dbName, "sb_tokens", tok.ID, tok); err != nil {
+			return nil, err
+		}
+
+		created = append(created, tok)
+	}
+	return created, nil
+}
+
+func (m *Memory) DeleteToken(dbName, tokenID string) error {
+	key := fmt.Sprintf("%s_sb_tokens", dbName)
+
+	if _, ok := m.DB[key][tokenID]; !ok {
+		return errors.New("token not found")
+	}
+
+	delete(m.DB[key], tokenID)
+	return nil
+}
+
 func (m *Memory) SetPasswordResetCode(dbName, tokenID, code string) error {
 	var tok internal.Token
 	if err := getByID(m, dbName, "sb_tokens", tokenID, &tok); err != nil {
@@ -59,6 +118,35 @@ func (m *Memory) SetUserRole(dbName, email string, role int) error {
 	return create(m, dbName, "sb_tokens", tok.ID, tok)
 }
 
+func (m *Memory) DemoteUser(dbName, email string, role, adminRole int) error {
+	m.usersMutex.Lock()
+	defer m.usersMutex.Unlock()
+
+	tokens, err := all[internal.Token](m, dbName, "sb_tokens")
+	if err != nil {
+		return err
+	}
+
+	admins := filter(tokens, func(t internal.Token) bool {
+		return t.Role >= adminRole
+	})
+	if len(admins) <= 1 {
+		return internal.ErrLastAdmin
+	}
+
+	return m.SetUserRole(dbName, email, role)
+}
+
+func (m *Memory) SetUserToken(dbName, tokenID, token string) error {
+	var tok internal.Token
+	if err := getByID(m, dbName, "sb_tokens", tokenID, &tok); err != nil {
+		return err
+	}
+
+	tok.Token = token
+	return create(m, dbName, "sb_tokens", tok.ID, tok)
+}
+
 func (m *Memory) UserSetPassword(dbName, tokenID, password string) error {
 	var tok internal.Token
 	if err := getByID(m, dbName, "sb_tokens", tokenID, &tok); err != nil {
@@ -68,3 +156,114 @@ func (m *Memory) UserSetPassword(dbName, tokenID, password string) error {
 	tok.Password = password
 	return create(m, dbName, "sb_tokens", tok.ID, tok)
 }
+
+func (m *Memory) UserSetEmail(dbName, tokenID, email string) error {
+	email = internal.NormalizeEmail(email)
+
+	if exists, _ := m.UserEmailExists(dbName, email); exists {
+		return internal.ErrEmailTaken
+	}
+
+	var tok internal.Token
+	if err := getByID(m, dbName, "sb_tokens", tokenID, &tok); err != nil {
+		return err
+	}
+
+	tok.Email = email
+	return create(m, dbName, "sb_tokens", tok.ID, tok)
+}
+
+func (m *Memory) AddLoginEvent(dbName string, ev internal.LoginEvent, keep int) error {
+	ev.ID = m.NewID()
+	if err := create(m, dbName, "sb_logins", ev.ID, ev); err != nil {
+		return err
+	}
+
+	if keep <= 0 {
+		return nil
+	}
+
+	events, err := m.ListLoginEvents(dbName, ev.UserID)
+	if err != nil || len(events) <= keep {
+		return err
+	}
+
+	logins := m.DB[fmt.Sprintf("%s_sb_logins", dbName)]
+	for _, old := range events[keep:] {
+		delete(logins, old.ID)
+	}
+	return nil
+}
+
+func (m *Memory) ListLoginEvents(dbName, userID string) ([]internal.LoginEvent, error) {
+	events, err := all[internal.LoginEvent](m, dbName, "sb_logins")
+	if err != nil {
+		// no login recorded yet
+		return nil, nil
+	}
+
+	events = filter(events, func(ev internal.LoginEvent) bool {
+		return ev.UserID == userID
+	})
+
+	return sortSlice(events, func(a, b internal.LoginEvent) bool {
+		return a.Created.After(b.Created)
+	}), nil
+}
+
+// loginAlertsOptOut is the opt-out of a user from the login alerts.
+type loginAlertsOptOut struct {
+	UserID string
+}
+
+func (m *Memory) SetLoginAlerts(dbName, userID string, enabled bool) error {
+	if enabled {
+		delete(m.DB[fmt.Sprintf("%s_sb_login_alerts_optout", dbName)], userID)
+		return nil
+	}
+	return create(m, dbName, "sb_login_alerts_optout", userID, loginAlertsOptOut{UserID: userID})
+}
+
+func (m *Memory) LoginAlertsEnabled(dbName, userID string) (bool, error) {
+	_, ok := m.DB[fmt.Sprintf("%s_sb_login_alerts_optout", dbName)][userID]
+	return !ok, nil
+}
+
+func (m *Memory) SetLoginCode(dbName string, code internal.LoginCode) error {
+	return create(m, dbName, "sb_login_codes", code.UserID, code)
+}
+
+func (m *Memory) UseLoginCode(dbName, userID, hash string, now time.Time) error {
+	m.codeMutex.Lock()
+	defer m.codeMutex.Unlock()
+
+	var code internal.LoginCode
+	if err := getByID(m, dbName, "sb_login_codes", userID, &code); err != nil {
+		return internal.ErrInvalidLoginCode
+	} else if code.Hash != hash || !code.Expires.After(now) {
+		return internal.ErrInvalidLoginCode
+	}
+
+	delete(m.DB[fmt.Sprintf("%s_sb_login_codes", dbName)], userID)
+	return nil
+}
+
+func (m *Memory) AddImpersonation(dbName string, imp internal.Impersonation) error {
+	imp.ID = m.NewID()
+	return create(m, dbName, "sb_impersonations", imp.ID, imp)
+}
+
+func (m *Memory) ListImpersonations(dbName string) ([]internal.Impersonation, error) {
+	if _, ok := m.DB[fmt.Sprintf("%s_sb_impersonations", dbName)]; !ok {
+		return nil, nil
+	}
+
+	list, err := all[internal.Impersonation](m, dbName, "sb_impersonations")
+	if err != nil {
+		return nil, err
+	}
+
+	return sortSlice(list, func(a, b internal.Impersonation) bool {
+		return a.Created.After(b.Created)
+	}), nil
+}
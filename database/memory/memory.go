@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -28,6 +29,22 @@ func init() {
 type Memory struct {
 	DB              map[string]map[string][]byte
 	PublishDocument internal.PublishDocumentEvent
+
+	// serializes base creation so the name check and insert are atomic
+	baseMutex sync.Mutex
+	// serializes the conditional creates, see CreateDocumentIfAbsent
+	createMutex sync.Mutex
+	// makes the login codes single-use, see UseLoginCode
+	codeMutex sync.Mutex
+	// serializes the bulk user creation so the email checks and inserts
+	// are atomic, see CreateUsers, and the demotions so the last admin is
+	// kept, see DemoteUser
+	usersMutex sync.Mutex
+
+	// indexes per dbName_col, only unique ones have an effect in memory
+	// geo queries scan the documents
+	indexes    map[string][]internal.Index
+	indexMutex sync.RWMutex
 }
 
 func New(pubdoc internal.PublishDocumentEvent) internal.Persister {
@@ -54,7 +71,111 @@ func (m *Memory) Ping() error {
 	return nil
 }
 
-func (m *Memory) CreateIndex(dbName, col, field string) error {
+func (m *Memory) CreateIndex(dbName, col, field string, unique bool) error {
+	key := fmt.Sprintf("%s_%s", dbName, col)
+	name := fmt.Sprintf("idx_%s_%s", internal.CleanCollectionName(col), field)
+
+	indexes, _ := m.ListIndexes(dbName, col)
+	for _, idx := range indexes {
+		if idx.Name == name && idx.Unique != unique {
+			return internal.ErrIndexConflict
+		}
+	}
+
+	if unique {
+		// a collection not created yet has no duplicate
+		docs, _ := all[map[string]any](m, dbName, col)
+
+		for i, doc := range docs {
+			for _, other := range docs[i+1:] {
+				if v, ok := doc[field]; ok && equal(v, other[field]) {
+					return fmt.Errorf("cannot create unique index, duplicate value for %s", field)
+				}
+			}
+		}
+	}
+
+	m.addIndex(key, internal.Index{
+		Name:   name,
+		Field:  field,
+		Unique: unique,
+	})
+	return nil
+}
+
+func (m *Memory) CreateGeoIndex(dbName, col, field string) error {
+	m.addIndex(fmt.Sprintf("%s_%s", dbName, col), internal.Index{
+		Name:  fmt.Sprintf("idx_%s_%s", internal.CleanCollectionName(col), field),
+		Field: field,
+		Geo:   true,
+	})
+	return nil
+}
+
+// addIndex adds idx to the indexes of key replacing the one having the
+// same name.
+func (m *Memory) addIndex(key string, idx internal.Index) {
+	m.indexMutex.Lock()
+	defer m.indexMutex.Unlock()
+
+	indexes := m.indexes[key]
+	for i, existing := range indexes {
+		if existing.Name == idx.Name {
+			indexes[i] = idx
+			return
+		}
+	}
+
+	if m.indexes == nil {
+		m.indexes = make(map[string][]internal.Index)
+	}
+	m.indexes[key] = append(indexes, idx)
+}
+
+func (m *Memory) ListIndexes(dbName, col string) ([]internal.Index, error) {
+	m.indexMutex.RLock()
+	defer m.indexMutex.RUnlock()
+
+	indexes := make([]internal.Index, 0)
+	return append(indexes, m.indexes[fmt.Sprintf("%s_%s", dbName, col)]...), nil
+}
+
+func (m *Memory) DropIndex(dbName, col, name string) error {
+	key := fmt.Sprintf("%s_%s", dbName, col)
+
+	m.indexMutex.Lock()
+	defer m.indexMutex.Unlock()
+
+	indexes := m.indexes[key]
+	for i, idx := range indexes {
+		if idx.Name == name {
+			m.indexes[key] = append(indexes[:i:i], indexes[i+1:]...)
+			return nil
+		}
+	}
+	return internal.ErrIndexNotFound
+}
+
+// checkUnique returns an error when doc has the same value as another
+// document for a field having a unique index.
+func (m *Memory) checkUnique(dbName, col, id string, doc map[string]any) error {
+	m.indexMutex.RLock()
+	indexes := m.indexes[fmt.Sprintf("%s_%s", dbName, col)]
+	m.indexMutex.RUnlock()
+
+	for _, idx := range indexes {
+		v, ok := doc[idx.Field]
+		if !idx.Unique || !ok {
+			continue
+		}
+
+		docs, _ := all[map[string]any](m, dbName, col)
+		for _, other := range docs {
+			if other[FieldID] != id && equal(other[idx.Field], v) {
+				return &internal.DuplicateValueError{Field: idx.Field}
+			}
+		}
+	}
 	return nil
 }
 
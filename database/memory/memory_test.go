@@ -2,6 +2,7 @@ package memory
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"os"
 	"testing"
@@ -147,7 +148,200 @@ func TestCreateIndex(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := datastore.CreateIndex(confDBName, "testindex", "idxfield"); err != nil {
+	if err := datastore.CreateIndex(confDBName, "testindex", "idxfield", false); err != nil {
 		t.Fatal(err)
 	}
 }
+
+func TestUniqueIndex(t *testing.T) {
+	col := "testuniqueindex"
+
+	data := map[string]interface{}{"username": "unique-user"}
+	if _, err := datastore.CreateDocument(adminAuth, confDBName, col, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := datastore.CreateIndex(confDBName, col, "username", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := datastore.CreateGeoIndex(confDBName, col, "location"); err != nil {
+		t.Fatal(err)
+	}
+
+	indexes, err := datastore.ListIndexes(confDBName, col)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var idx internal.Index
+	for _, i := range indexes {
+		if i.Field == "username" {
+			idx = i
+		}
+	}
+
+	if !idx.Unique {
+		t.Fatalf("expected a unique index on username in %v", indexes)
+	}
+
+	var dupErr *internal.DuplicateValueError
+
+	dup := map[string]interface{}{"username": "unique-user"}
+	if _, err := datastore.CreateDocument(adminAuth, confDBName, col, dup); !errors.As(err, &dupErr) {
+		t.Errorf("expected duplicate insert to be rejected with DuplicateValueError got %v", err)
+	} else if dupErr.Field != "username" {
+		t.Errorf("expected conflicting field to be username got %s", dupErr.Field)
+	}
+
+	if err := datastore.DropIndex(confDBName, col, idx.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	dup = map[string]interface{}{"username": "unique-user"}
+	if _, err := datastore.CreateDocument(adminAuth, confDBName, col, dup); err != nil {
+		t.Errorf("expected insert to succeed once the index is dropped: %v", err)
+	}
+
+	if err := datastore.DropIndex(confDBName, col, idx.Name); !errors.Is(err, internal.ErrIndexNotFound) {
+		t.Errorf("expected ErrIndexNotFound got %v", err)
+	}
+}
+
+func TestIndexUniquenessConflict(t *testing.T) {
+	col := "testindexconflict"
+
+	data := map[string]interface{}{"sku": "abc-123"}
+	if _, err := datastore.CreateDocument(adminAuth, confDBName, col, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := datastore.CreateIndex(confDBName, col, "sku", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// the existing non-unique index must not be reported as unique
+	if err := datastore.CreateIndex(confDBName, col, "sku", true); !errors.Is(err, internal.ErrIndexConflict) {
+		t.Errorf("expected ErrIndexConflict got %v", err)
+	}
+
+	// the same index again is fine
+	if err := datastore.CreateIndex(confDBName, col, "sku", false); err != nil {
+		t.Errorf("expected the existing index to be kept got %v", err)
+	}
+}
+
+func TestUpdatedTime(t *testing.T) {
+	col := "testupdated"
+
+	created, err := datastore.CreateDocument(adminAuth, confDBName, col, map[string]interface{}{"count": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, ok := internal.UpdatedAt(created)
+	if !ok {
+		t.Fatalf("expected an updated time on create got %v", created)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	id := fmt.Sprintf("%v", created[internal.IDField])
+	updated, err := datastore.UpdateDocument(adminAuth, confDBName, col, id, map[string]interface{}{"name": "changed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, ok := internal.UpdatedAt(updated)
+	if !ok || !second.After(first) {
+		t.Errorf("expected the update to move the updated time after %v got %v", first, second)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	if err := datastore.IncrementValue(adminAuth, confDBName, col, id, "count", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := datastore.GetDocumentByID(adminAuth, confDBName, col, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if third, ok := internal.UpdatedAt(doc); !ok || !third.After(second) {
+		t.Errorf("expected the increment to move the updated time after %v got %v", second, third)
+	}
+}
+
+func TestGeoQuery(t *testing.T) {
+	col := "places"
+
+	places := map[string][]float64{
+		"montreal": {-73.5673, 45.5017},
+		"laval":    {-73.6920, 45.6066},
+		"quebec":   {-71.2080, 46.8139},
+	}
+	for name, coords := range places {
+		doc := map[string]interface{}{
+			"name":     name,
+			"location": map[string]interface{}{"type": "Point", "coordinates": []interface{}{coords[0], coords[1]}},
+		}
+		if _, err := datastore.CreateDocument(adminAuth, confDBName, col, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a document without location never matches
+	if _, err := datastore.CreateDocument(adminAuth, confDBName, col, map[string]interface{}{"name": "nowhere"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := datastore.CreateGeoIndex(confDBName, col, "location"); err != nil {
+		t.Fatal(err)
+	}
+
+	indexes, err := datastore.ListIndexes(confDBName, col)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(indexes) != 1 || indexes[0].Field != "location" || !indexes[0].Geo {
+		t.Errorf("expected a geo index on location got %v", indexes)
+	}
+
+	tests := []struct {
+		op       string
+		value    map[string]interface{}
+		expected []string
+	}{
+		{"near", map[string]interface{}{"lng": -73.5673, "lat": 45.5017, "radius": 5000.0}, []string{"montreal"}},
+		{"near", map[string]interface{}{"lng": -73.5673, "lat": 45.5017, "radius": 20000.0}, []string{"laval", "montreal"}},
+		{"near", map[string]interface{}{"lng": -73.5673, "lat": 45.5017, "radius": 300000.0}, []string{"laval", "montreal", "quebec"}},
+		{"within", map[string]interface{}{"minLng": -74.0, "minLat": 45.0, "maxLng": -73.0, "maxLat": 45.55}, []string{"montreal"}},
+		{"within", map[string]interface{}{"minLng": -72.0, "minLat": 46.0, "maxLng": -71.0, "maxLat": 47.0}, []string{"quebec"}},
+	}
+
+	for _, tc := range tests {
+		filter, err := datastore.ParseQuery([][]interface{}{{"location", tc.op, tc.value}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		params := internal.ListParams{Page: 1, Size: 50, Sort: []internal.SortField{{Field: "name"}}}
+		res, err := datastore.QueryDocuments(adminAuth, confDBName, col, filter, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, doc := range res.Results {
+			names = append(names, fmt.Sprintf("%v", doc["name"]))
+		}
+
+		if fmt.Sprint(names) != fmt.Sprint(tc.expected) {
+			t.Errorf("%s %v: expected %v got %v", tc.op, tc.value, tc.expected, names)
+		}
+	}
+
+	if _, err := datastore.ParseQuery([][]interface{}{{"location", "near", map[string]interface{}{"lng": -73.5, "lat": 95.0, "radius": 10.0}}}); err == nil {
+		t.Errorf("expected an invalid latitude to be rejected")
+	}
+}
@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+type appliedMigration struct {
+	Version int       `json:"version"`
+	Applied time.Time `json:"applied"`
+}
+
+// BaseMigrations returns no migrations, the memory bases do not outlive
+// the process.
+func (m *Memory) BaseMigrations() []internal.BaseMigration {
+	return nil
+}
+
+func (m *Memory) AppliedMigrations(dbName string) (map[int]bool, error) {
+	applied := make(map[int]bool)
+	if _, ok := m.DB[fmt.Sprintf("%s_sb_migrations", dbName)]; !ok {
+		return applied, nil
+	}
+
+	list, err := all[appliedMigration](m, dbName, "sb_migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, am := range list {
+		applied[am.Version] = true
+	}
+	return applied, nil
+}
+
+func (m *Memory) SetMigrationApplied(dbName string, version int) error {
+	am := appliedMigration{Version: version, Applied: time.Now()}
+	return create(m, dbName, "sb_migrations", strconv.Itoa(version), am)
+}
@@ -3,6 +3,7 @@ package memory
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/staticbackendhq/core/internal"
 )
@@ -42,9 +43,30 @@ func (m *Memory) ParseQuery(clauses [][]interface{}) (filter map[string]any, err
 		case "<=":
 			filter["<= "+field] = clause[2]
 		case "in":
-			filter["in "+field] = fmt.Sprintf("in %s", clause[2])
+			values, ok := clause[2].([]interface{})
+			if !ok {
+				err = fmt.Errorf("the %d query clause's in operator requires an array of values", i+1)
+				return
+			}
+			filter["in "+field] = values
+		case "contains":
+			filter["contains "+field] = fmt.Sprintf("%v", clause[2])
 		case "!in", "nin":
 			filter[field] = clause[2]
+		case "near":
+			near, e := internal.ParseGeoNear(clause[2])
+			if e != nil {
+				err = fmt.Errorf("the %d query clause: %w", i+1, e)
+				return
+			}
+			filter["near "+field] = near
+		case "within":
+			box, e := internal.ParseGeoBox(clause[2])
+			if e != nil {
+				err = fmt.Errorf("the %d query clause: %w", i+1, e)
+				return
+			}
+			filter["within "+field] = box
 		default:
 			err = fmt.Errorf("the %d query clause's operator: %s is not supported at the moment", i+1, op)
 		}
@@ -99,3 +121,101 @@ func canWrite(auth internal.Auth, col string, doc map[string]any) bool {
 
 	return true
 }
+
+// sortDocuments orders the list by the sort keys of params, the id key
+// follows the creation order with the id as tie-breaker.
+func sortDocuments(list []map[string]any, params internal.ListParams) []map[string]any {
+	fields := params.SortFields()
+
+	return sortSlice(list, func(a, b map[string]any) bool {
+		for _, sf := range fields {
+			c := 0
+			if sf.Field == internal.SortFieldID {
+				if c = compareValues(a[FieldCreated], b[FieldCreated]); c == 0 {
+					c = compareValues(a[FieldID], b[FieldID])
+				}
+			} else {
+				va, _ := internal.GetPath(a, sf.Field)
+				vb, _ := internal.GetPath(b, sf.Field)
+				c = compareValues(va, vb)
+			}
+
+			if c == 0 {
+				continue
+			} else if sf.Descending {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+// compareValues compares numbers and dates by value and everything else by its
+// string representation, missing values are sorted first.
+func compareValues(a, b any) int {
+	if a == nil || b == nil {
+		switch {
+		case a == b:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	ta, aok := a.(time.Time)
+	tb, bok := b.(time.Time)
+	if aok && bok {
+		switch {
+		case ta.Before(tb):
+			return -1
+		case ta.After(tb):
+			return 1
+		}
+		return 0
+	}
+
+	fa, aok := toFloat(a)
+	fb, bok := toFloat(b)
+	if aok && bok {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+
+	return strings.Compare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func projectDocuments(list []map[string]any, fields []string) []map[string]any {
+	if len(fields) == 0 {
+		return list
+	}
+
+	projected := make([]map[string]any, 0, len(list))
+	for _, doc := range list {
+		projected = append(projected, internal.Project(doc, fields))
+	}
+	return projected
+}
@@ -3,16 +3,42 @@ package memory
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/staticbackendhq/core/internal"
 )
 
 func (m *Memory) CreateCustomer(customer internal.Customer) (internal.Customer, error) {
+	customer.Email = internal.NormalizeEmail(customer.Email)
+
+	if exists, err := m.EmailExists(customer.Email); err != nil {
+		return customer, err
+	} else if exists {
+		return customer, internal.ErrEmailTaken
+	}
+
+	if len(customer.ID) == 0 {
+		customer.ID = m.NewID()
+	}
+
 	err := create(m, "sb", "customers", customer.ID, customer)
 	return customer, err
 }
 
 func (m *Memory) CreateBase(base internal.BaseConfig) (internal.BaseConfig, error) {
+	m.baseMutex.Lock()
+	defer m.baseMutex.Unlock()
+
+	if len(base.ID) == 0 {
+		base.ID = m.NewID()
+	}
+
+	if exists, err := m.DatabaseExists(base.Name); err != nil {
+		return base, err
+	} else if exists {
+		return base, internal.ErrBaseNameTaken
+	}
+
 	if err := create(m, "sb", "apps", base.ID, base); err != nil {
 		return base, err
 	}
@@ -38,7 +64,7 @@ func (m *Memory) EmailExists(email string) (exists bool, err error) {
 		return strings.EqualFold(x.Email, email)
 	})
 
-	if len(results) != 1 {
+	if len(results) == 0 {
 		return
 	}
 
@@ -52,10 +78,31 @@ func (m *Memory) FindAccount(customerID string) (cus internal.Customer, err erro
 }
 
 func (m *Memory) FindDatabase(baseID string) (base internal.BaseConfig, err error) {
+	if _, ok := m.DB["sb_apps"][baseID]; !ok {
+		return base, internal.ErrBaseNotFound
+	}
+
 	err = getByID(m, "sb", "apps", baseID, &base)
 	return
 }
 
+func (m *Memory) FindDatabaseByKey(key string) (base internal.BaseConfig, err error) {
+	list, err := all[internal.BaseConfig](m, "sb", "apps")
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	results := filter(list, func(x internal.BaseConfig) bool {
+		return x.AcceptsKey(key, now)
+	})
+
+	if len(results) == 0 {
+		return base, internal.ErrBaseNotFound
+	}
+	return results[0], nil
+}
+
 func (m *Memory) DatabaseExists(name string) (exists bool, err error) {
 	list, err := all[internal.BaseConfig](m, "sb", "apps")
 	if err != nil {
@@ -86,6 +133,75 @@ func (m *Memory) IncrementMonthlyEmailSent(baseID string) error {
 	return create(m, "sb", "apps", baseID, base)
 }
 
+func (m *Memory) SetUploadLimits(baseID string, types []string, maxSize int64) error {
+	base, err := m.FindDatabase(baseID)
+	if err != nil {
+		return err
+	}
+
+	base.AllowedUploadTypes = types
+	base.MaxUploadSize = maxSize
+
+	return create(m, "sb", "apps", baseID, base)
+}
+
+func (m *Memory) SetSessionBinding(baseID, binding string) error {
+	base, err := m.FindDatabase(baseID)
+	if err != nil {
+		return err
+	}
+
+	base.SessionBinding = binding
+
+	return create(m, "sb", "apps", baseID, base)
+}
+
+func (m *Memory) SetFeatures(baseID string, features map[string]bool) error {
+	base, err := m.FindDatabase(baseID)
+	if err != nil {
+		return err
+	}
+
+	base.Features = features
+
+	return create(m, "sb", "apps", baseID, base)
+}
+
+func (m *Memory) SetPublicAliases(baseID string, aliases map[string]string) error {
+	base, err := m.FindDatabase(baseID)
+	if err != nil {
+		return err
+	}
+
+	base.PublicAliases = aliases
+
+	return create(m, "sb", "apps", baseID, base)
+}
+
+func (m *Memory) RenameBase(baseID, displayName string) error {
+	base, err := m.FindDatabase(baseID)
+	if err != nil {
+		return err
+	}
+
+	base.DisplayName = displayName
+
+	return create(m, "sb", "apps", baseID, base)
+}
+
+func (m *Memory) RotatePublicKey(baseID, key string, previousExpires time.Time) error {
+	base, err := m.FindDatabase(baseID)
+	if err != nil {
+		return err
+	}
+
+	base.PreviousPublicKey = base.Key()
+	base.PreviousKeyExpires = previousExpires
+	base.PublicKey = key
+
+	return create(m, "sb", "apps", baseID, base)
+}
+
 func (m *Memory) GetCustomerByStripeID(stripeID string) (cus internal.Customer, err error) {
 	list, err := all[internal.Customer](m, "sb", "customers")
 	if err != nil {
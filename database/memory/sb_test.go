@@ -1,7 +1,12 @@
 package memory
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/staticbackendhq/core/internal"
 )
@@ -112,3 +117,219 @@ func TestNewID(t *testing.T) {
 		t.Errorf("expected id to be different got 1: %s 2: %s", id1, id2)
 	}
 }
+
+func TestCreateBaseNameCollision(t *testing.T) {
+	name := fmt.Sprintf("collision%d", time.Now().UnixNano())
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			base := internal.BaseConfig{
+				ID:            fmt.Sprintf("%s%d", name, i),
+				CustomerID:    dbTest.CustomerID,
+				Name:          name,
+				AllowedDomain: []string{"localhost"},
+				IsActive:      true,
+				Created:       time.Now(),
+			}
+			_, err := datastore.CreateBase(base)
+			errs <- err
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		if err == nil {
+			created++
+		} else if !errors.Is(err, internal.ErrBaseNameTaken) {
+			t.Errorf("expected ErrBaseNameTaken got %v", err)
+		}
+	}
+
+	if created != 1 {
+		t.Errorf("expected exactly 1 base to be created got %d", created)
+	}
+}
+
+func TestFindDatabaseNotFound(t *testing.T) {
+	if _, err := datastore.FindDatabase(datastore.NewID()); !errors.Is(err, internal.ErrBaseNotFound) {
+		t.Errorf("expected ErrBaseNotFound got %v", err)
+	}
+}
+
+func TestSetUploadLimits(t *testing.T) {
+	if err := datastore.SetUploadLimits(dbTest.ID, []string{"image/png"}, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	base, err := datastore.FindDatabase(dbTest.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(base.AllowedUploadTypes) != 1 || base.AllowedUploadTypes[0] != "image/png" {
+		t.Errorf("expected allowed types [image/png] got %v", base.AllowedUploadTypes)
+	} else if base.MaxUploadSize != 1000 {
+		t.Errorf("expected max upload size 1000 got %d", base.MaxUploadSize)
+	}
+}
+
+func TestSetSessionBinding(t *testing.T) {
+	if err := datastore.SetSessionBinding(dbTest.ID, internal.SessionBindingBoth); err != nil {
+		t.Fatal(err)
+	}
+	defer datastore.SetSessionBinding(dbTest.ID, internal.SessionBindingNone)
+
+	base, err := datastore.FindDatabase(dbTest.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if base.SessionBinding != internal.SessionBindingBoth {
+		t.Errorf("expected session binding %s got %s", internal.SessionBindingBoth, base.SessionBinding)
+	}
+}
+
+func TestSetFeatures(t *testing.T) {
+	features := map[string]bool{internal.FeatureRealtime: false, internal.FeatureFunctions: true}
+	if err := datastore.SetFeatures(dbTest.ID, features); err != nil {
+		t.Fatal(err)
+	}
+	defer datastore.SetFeatures(dbTest.ID, nil)
+
+	base, err := datastore.FindDatabase(dbTest.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if base.FeatureEnabled(internal.FeatureRealtime) {
+		t.Errorf("expected realtime to be disabled got %v", base.Features)
+	} else if !base.FeatureEnabled(internal.FeatureFunctions) || !base.FeatureEnabled(internal.FeaturePublicCollections) {
+		t.Errorf("expected the other features to be enabled got %v", base.Features)
+	}
+}
+
+func TestSetPublicAliases(t *testing.T) {
+	aliases := map[string]string{"posts": "pub_posts"}
+	if err := datastore.SetPublicAliases(dbTest.ID, aliases); err != nil {
+		t.Fatal(err)
+	}
+	defer datastore.SetPublicAliases(dbTest.ID, nil)
+
+	base, err := datastore.FindDatabase(dbTest.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(base.PublicAliases) != 1 || base.PublicAliases["posts"] != "pub_posts" {
+		t.Errorf("expected the posts alias got %v", base.PublicAliases)
+	}
+}
+
+func TestCreateCustomerDistinctIDs(t *testing.T) {
+	c1, err := datastore.CreateCustomer(internal.Customer{Email: "distinct1@test.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c2, err := datastore.CreateCustomer(internal.Customer{Email: "distinct2@test.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c1.ID) == 0 || c1.ID == c2.ID {
+		t.Errorf("expected distinct customer ids got %q and %q", c1.ID, c2.ID)
+	}
+}
+
+func TestRenameBase(t *testing.T) {
+	base := internal.BaseConfig{
+		CustomerID:    dbTest.CustomerID,
+		Name:          fmt.Sprintf("rename%d", time.Now().UnixNano()),
+		AllowedDomain: []string{"localhost"},
+		IsActive:      true,
+		Created:       time.Now(),
+	}
+
+	base, err := datastore.CreateBase(base)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(base.ID) == 0 || base.ID == base.Name {
+		t.Fatalf("expected a generated id distinct from the name got %q", base.ID)
+	}
+
+	if err := datastore.RenameBase(base.ID, "My renamed app"); err != nil {
+		t.Fatal(err)
+	}
+
+	renamed, err := datastore.FindDatabase(base.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if renamed.ID != base.ID {
+		t.Errorf("expected id %s got %s", base.ID, renamed.ID)
+	} else if renamed.Name != base.Name {
+		t.Errorf("expected database name %s got %s", base.Name, renamed.Name)
+	} else if renamed.DisplayName != "My renamed app" {
+		t.Errorf("expected display name %q got %q", "My renamed app", renamed.DisplayName)
+	}
+}
+
+func TestRotatePublicKey(t *testing.T) {
+	base := internal.BaseConfig{
+		CustomerID:    dbTest.CustomerID,
+		Name:          fmt.Sprintf("rotate%d", time.Now().UnixNano()),
+		AllowedDomain: []string{"localhost"},
+		IsActive:      true,
+		Created:       time.Now(),
+	}
+
+	base, err := datastore.CreateBase(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := datastore.FindDatabaseByKey(base.ID); err != nil {
+		t.Fatalf("expected the id to be the public key before rotation, got %v", err)
+	}
+
+	newKey := datastore.NewID()
+	if err := datastore.RotatePublicKey(base.ID, newKey, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{newKey, base.ID} {
+		conf, err := datastore.FindDatabaseByKey(key)
+		if err != nil {
+			t.Errorf("key %s: %v", key, err)
+		} else if conf.ID != base.ID || conf.Key() != newKey {
+			t.Errorf("key %s: expected base %s with key %s got %s with %s", key, base.ID, newKey, conf.ID, conf.Key())
+		}
+	}
+
+	newerKey := datastore.NewID()
+	if err := datastore.RotatePublicKey(base.ID, newerKey, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := datastore.FindDatabaseByKey(newerKey); err != nil {
+		t.Errorf("expected newer key to be valid got %v", err)
+	}
+	for _, key := range []string{newKey, base.ID} {
+		if _, err := datastore.FindDatabaseByKey(key); !errors.Is(err, internal.ErrBaseNotFound) {
+			t.Errorf("key %s: expected ErrBaseNotFound got %v", key, err)
+		}
+	}
+}
+
+func TestCustomerEmailCaseInsensitive(t *testing.T) {
+	if exists, err := datastore.EmailExists(strings.ToUpper(adminEmail)); err != nil {
+		t.Fatal(err)
+	} else if !exists {
+		t.Errorf("expected %s to exist", strings.ToUpper(adminEmail))
+	}
+
+	_, err := datastore.CreateCustomer(internal.Customer{Email: strings.ToUpper(adminEmail), Created: time.Now()})
+	if !errors.Is(err, internal.ErrEmailTaken) {
+		t.Errorf("expected ErrEmailTaken got %v", err)
+	}
+}
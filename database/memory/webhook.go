@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+func (m *Memory) AddWebhook(dbName string, wh internal.Webhook) (id string, err error) {
+	id = m.NewID()
+
+	wh.ID = id
+	wh.Created = time.Now()
+
+	err = create(m, dbName, "sb_webhooks", id, wh)
+	return
+}
+
+func (m *Memory) ListWebhooks(dbName string) ([]internal.Webhook, error) {
+	if _, ok := m.DB[fmt.Sprintf("%s_sb_webhooks", dbName)]; !ok {
+		return nil, nil
+	}
+
+	list, err := all[internal.Webhook](m, dbName, "sb_webhooks")
+	if err != nil {
+		return nil, err
+	}
+
+	return sortSlice(list, func(a, b internal.Webhook) bool {
+		return a.Created.Before(b.Created)
+	}), nil
+}
+
+func (m *Memory) DeleteWebhook(dbName, id string) error {
+	key := fmt.Sprintf("%s_sb_webhooks", dbName)
+
+	if _, ok := m.DB[key][id]; !ok {
+		return errors.New("webhook not found")
+	}
+
+	delete(m.DB[key], id)
+	return nil
+}
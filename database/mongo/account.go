@@ -28,6 +28,7 @@ type LocalToken struct {
 	Role      int                `bson:"role" json:"role"`
 	ResetCode string             `bson:"resetCode" json:"-"`
 	Created   time.Time          `bson:"created" json:"created"`
+	Label     string             `bson:"label" json:"label"`
 }
 
 func toLocalToken(token internal.Token) LocalToken {
@@ -50,6 +51,7 @@ func toLocalToken(token internal.Token) LocalToken {
 		Role:      token.Role,
 		ResetCode: token.ResetCode,
 		Created:   token.Created,
+		Label:     token.Label,
 	}
 }
 
@@ -63,10 +65,14 @@ func fromLocalToken(tok LocalToken) internal.Token {
 		Role:      tok.Role,
 		ResetCode: tok.ResetCode,
 		Created:   tok.Created,
+		Label:     tok.Label,
 	}
 }
 
 func (mg *Mongo) FindToken(dbName, tokenID, token string) (tok internal.Token, err error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	id, err := primitive.ObjectIDFromHex(tokenID)
@@ -75,7 +81,7 @@ func (mg *Mongo) FindToken(dbName, tokenID, token string) (tok internal.Token, e
 	}
 
 	var lt LocalToken
-	sr := db.Collection("sb_tokens").FindOne(mg.Ctx, bson.M{FieldID: id, FieldToken: token})
+	sr := db.Collection("sb_tokens").FindOne(ctx, bson.M{FieldID: id, FieldToken: token})
 	err = sr.Decode(&lt)
 
 	tok = fromLocalToken(lt)
@@ -83,6 +89,9 @@ func (mg *Mongo) FindToken(dbName, tokenID, token string) (tok internal.Token, e
 }
 
 func (mg *Mongo) FindRootToken(dbName, tokenID, accountID, token string) (tok internal.Token, err error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	id, err := primitive.ObjectIDFromHex(tokenID)
@@ -103,7 +112,7 @@ func (mg *Mongo) FindRootToken(dbName, tokenID, accountID, token string) (tok in
 
 	var lt LocalToken
 
-	sr := db.Collection("sb_tokens").FindOne(mg.Ctx, filter)
+	sr := db.Collection("sb_tokens").FindOne(ctx, filter)
 	err = sr.Decode(&lt)
 
 	tok = fromLocalToken(lt)
@@ -112,6 +121,9 @@ func (mg *Mongo) FindRootToken(dbName, tokenID, accountID, token string) (tok in
 }
 
 func (mg *Mongo) GetRootForBase(dbName string) (tok internal.Token, err error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	filter := bson.M{
@@ -120,7 +132,7 @@ func (mg *Mongo) GetRootForBase(dbName string) (tok internal.Token, err error) {
 
 	var lt LocalToken
 
-	sr := db.Collection("sb_tokens").FindOne(mg.Ctx, filter)
+	sr := db.Collection("sb_tokens").FindOne(ctx, filter)
 	err = sr.Decode(&lt)
 
 	tok = fromLocalToken(lt)
@@ -129,11 +141,14 @@ func (mg *Mongo) GetRootForBase(dbName string) (tok internal.Token, err error) {
 }
 
 func (mg *Mongo) FindTokenByEmail(dbName, email string) (tok internal.Token, err error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	var lt LocalToken
 
-	sr := db.Collection("sb_tokens").FindOne(mg.Ctx, bson.M{"email": email})
+	sr := db.Collection("sb_tokens").FindOne(ctx, emailFilter(email))
 	err = sr.Decode(&lt)
 
 	tok = fromLocalToken(lt)
@@ -142,6 +157,9 @@ func (mg *Mongo) FindTokenByEmail(dbName, email string) (tok internal.Token, err
 }
 
 func (mg *Mongo) SetPasswordResetCode(dbName, tokenID, code string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	id, err := primitive.ObjectIDFromHex(tokenID)
@@ -150,18 +168,22 @@ func (mg *Mongo) SetPasswordResetCode(dbName, tokenID, code string) error {
 	}
 
 	update := bson.M{"$set": bson.M{"resetCode": code}}
-	if _, err := db.Collection("sb_tokens").UpdateByID(mg.Ctx, id, update); err != nil {
+	if _, err := db.Collection("sb_tokens").UpdateByID(ctx, id, update); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (mg *Mongo) ResetPassword(dbName, email, code, password string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
-	filter := bson.M{"email": email, "resetCode": code}
+	filter := emailFilter(email)
+	filter["resetCode"] = code
 	update := bson.M{"$set": bson.M{"pw": password}}
-	res, err := db.Collection("sb_tokens").UpdateOne(mg.Ctx, filter, update)
+	res, err := db.Collection("sb_tokens").UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	} else if res.ModifiedCount != 1 {
@@ -1,15 +1,18 @@
 package mongo
 
 import (
+	"errors"
 	"fmt"
 	"log"
-	"strings"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/staticbackendhq/core/internal"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -18,9 +21,13 @@ type Base struct {
 }
 
 func (mg *Mongo) CreateDocument(auth internal.Auth, dbName, col string, doc map[string]interface{}) (map[string]interface{}, error) {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	delete(doc, "id")
+	delete(doc, "ownerId")
 	delete(doc, FieldID)
 	delete(doc, FieldAccountID)
 	delete(doc, FieldOwnerID)
@@ -35,9 +42,10 @@ func (mg *Mongo) CreateDocument(auth internal.Auth, dbName, col string, doc map[
 	doc[FieldID] = newID
 	doc[FieldAccountID] = acctID
 	doc[FieldOwnerID] = userID
+	internal.Touch(doc)
 
-	if _, err := db.Collection(internal.CleanCollectionName(col)).InsertOne(mg.Ctx, doc); err != nil {
-		return nil, err
+	if _, err := db.Collection(internal.CleanCollectionName(col)).InsertOne(ctx, doc); err != nil {
+		return nil, duplicateValue(err)
 	}
 
 	cleanMap(doc)
@@ -49,12 +57,104 @@ func (mg *Mongo) CreateDocument(auth internal.Auth, dbName, col string, doc map[
 	return doc, nil
 }
 
+// CreateDocumentIfAbsent inserts doc with an upsert on filter so it's only
+// inserted when no document readable by auth matches. MongoDB only
+// guarantees a single insert among concurrent upserts when a field matched
+// with = has a unique index, see CreateIndex, it returns
+// internal.ErrUniqueIndexRequired otherwise.
+func (mg *Mongo) CreateDocumentIfAbsent(auth internal.Auth, dbName, col string, filter map[string]interface{}, doc map[string]interface{}) (map[string]interface{}, bool, error) {
+	if ok, err := mg.uniqueMatch(dbName, col, filter); err != nil {
+		return nil, false, err
+	} else if !ok {
+		return nil, false, internal.ErrUniqueIndexRequired
+	}
+
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	delete(doc, "id")
+	delete(doc, "ownerId")
+	delete(doc, FieldID)
+	delete(doc, FieldAccountID)
+	delete(doc, FieldOwnerID)
+
+	acctID, userID, err := parseObjectID(auth)
+	if err != nil {
+		return nil, false, err
+	}
+
+	doc[FieldID] = primitive.NewObjectID()
+	doc[FieldAccountID] = acctID
+	doc[FieldOwnerID] = userID
+	internal.Touch(doc)
+
+	// the caller's filter is left as is
+	match := bson.M{}
+	for k, v := range filter {
+		match[k] = v
+	}
+	secureRead(acctID, userID, auth.Role, col, match)
+
+	opt := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+
+	var existing map[string]interface{}
+	err = db.Collection(internal.CleanCollectionName(col)).FindOneAndUpdate(ctx, match, bson.M{"$setOnInsert": doc}, opt).Decode(&existing)
+	if err == nil {
+		cleanMap(existing)
+		return existing, false, nil
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, false, duplicateValue(err)
+	}
+
+	cleanMap(doc)
+
+	mg.PublishDocument("db-"+col, internal.MsgTypeDBCreated, doc)
+
+	go mg.ensureIndex(dbName, internal.CleanCollectionName(col))
+
+	return doc, true, nil
+}
+
+// uniqueMatch returns if one of the fields filter matches with = has a
+// unique index.
+func (mg *Mongo) uniqueMatch(dbName, col string, filter map[string]interface{}) (bool, error) {
+	indexes, err := mg.ListIndexes(dbName, col)
+	if err != nil {
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && cmdErr.Name == "NamespaceNotFound" {
+			// the collection does not exist yet
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, idx := range indexes {
+		v, ok := filter[idx.Field]
+		if !ok || !idx.Unique {
+			continue
+		}
+
+		switch v.(type) {
+		case bson.M, primitive.Regex:
+			// an operator, see ParseQuery
+		default:
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 var (
 	checkIndex = make(map[string]bool)
 	mutx       = sync.RWMutex{}
 )
 
 func (mg *Mongo) ensureIndex(dbName, col string) {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	key := fmt.Sprintf("%s_%s", dbName, col)
 
 	mutx.RLock()
@@ -67,7 +167,7 @@ func (mg *Mongo) ensureIndex(dbName, col string) {
 
 	dbCol := db.Collection(col)
 
-	cur, err := dbCol.Indexes().List(mg.Ctx)
+	cur, err := dbCol.Indexes().List(ctx)
 	if err != nil {
 		//TODO: report this error
 		log.Println("error getting col indexes: ", err)
@@ -75,7 +175,7 @@ func (mg *Mongo) ensureIndex(dbName, col string) {
 	}
 
 	found := false
-	for cur.Next(mg.Ctx) {
+	for cur.Next(ctx) {
 		var v bson.M
 		if err := cur.Decode(&v); err != nil {
 			//TODO: report this error
@@ -110,13 +210,16 @@ func (mg *Mongo) ensureIndex(dbName, col string) {
 		return
 	}
 
-	if err := mg.CreateIndex(dbName, col, FieldAccountID); err != nil {
+	if err := mg.CreateIndex(dbName, col, FieldAccountID, false); err != nil {
 		//TODO: report this error
 		log.Println("error creating accountId idx: ", err)
 	}
 }
 
 func (mg *Mongo) BulkCreateDocument(auth internal.Auth, dbName, col string, docs []interface{}) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	acctID, userID, err := parseObjectID(auth)
@@ -131,6 +234,7 @@ func (mg *Mongo) BulkCreateDocument(auth internal.Auth, dbName, col string, docs
 		}
 
 		delete(doc, "id")
+		delete(doc, "ownerId")
 		delete(doc, FieldID)
 		delete(doc, FieldAccountID)
 		delete(doc, FieldOwnerID)
@@ -138,15 +242,19 @@ func (mg *Mongo) BulkCreateDocument(auth internal.Auth, dbName, col string, docs
 		doc[FieldID] = primitive.NewObjectID()
 		doc[FieldAccountID] = acctID
 		doc[FieldOwnerID] = userID
+		internal.Touch(doc)
 	}
 
-	if _, err := db.Collection(internal.CleanCollectionName(col)).InsertMany(mg.Ctx, docs); err != nil {
+	if _, err := db.Collection(internal.CleanCollectionName(col)).InsertMany(ctx, docs); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (mg *Mongo) ListDocuments(auth internal.Auth, dbName, col string, params internal.ListParams) (internal.PagedResult, error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	result := internal.PagedResult{
@@ -163,37 +271,36 @@ func (mg *Mongo) ListDocuments(auth internal.Auth, dbName, col string, params in
 
 	secureRead(acctID, userID, auth.Role, col, filter)
 
-	count, err := db.Collection(internal.CleanCollectionName(col)).CountDocuments(mg.Ctx, filter)
-	if err != nil {
-		return result, err
-	}
+	if params.SkipCount {
+		result.CountSkipped = true
+	} else {
+		count, err := db.Collection(internal.CleanCollectionName(col)).CountDocuments(ctx, filter)
+		if err != nil {
+			return result, err
+		}
 
-	result.Total = count
+		result.Total = count
+	}
 
 	skips := params.Size * (params.Page - 1)
 
-	if len(params.SortBy) == 0 || strings.EqualFold(params.SortBy, "id") {
-		params.SortBy = FieldID
-	}
-	sortBy := bson.M{params.SortBy: 1}
-	if params.SortDescending {
-		sortBy[params.SortBy] = -1
-	}
-
 	opt := options.Find()
 	opt.SetSkip(skips)
 	opt.SetLimit(params.Size)
-	opt.SetSort(sortBy)
+	opt.SetSort(sortDocument(params))
+	if len(params.Fields) > 0 {
+		opt.SetProjection(projection(params.Fields))
+	}
 
-	cur, err := db.Collection(internal.CleanCollectionName(col)).Find(mg.Ctx, filter, opt)
+	cur, err := db.Collection(internal.CleanCollectionName(col)).Find(ctx, filter, opt)
 	if err != nil {
 		return result, err
 	}
-	defer cur.Close(mg.Ctx)
+	defer cur.Close(ctx)
 
 	var results []map[string]interface{}
 
-	for cur.Next(mg.Ctx) {
+	for cur.Next(ctx) {
 		var v map[string]interface{}
 		err := cur.Decode(&v)
 		if err != nil {
@@ -218,6 +325,9 @@ func (mg *Mongo) ListDocuments(auth internal.Auth, dbName, col string, params in
 }
 
 func (mg *Mongo) QueryDocuments(auth internal.Auth, dbName, col string, filter map[string]interface{}, params internal.ListParams) (internal.PagedResult, error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	result := internal.PagedResult{
@@ -232,41 +342,40 @@ func (mg *Mongo) QueryDocuments(auth internal.Auth, dbName, col string, filter m
 
 	secureRead(acctID, userID, auth.Role, col, filter)
 
-	count, err := db.Collection(internal.CleanCollectionName(col)).CountDocuments(mg.Ctx, filter)
-	if err != nil {
-		return result, err
-	}
+	if params.SkipCount {
+		result.CountSkipped = true
+	} else {
+		count, err := db.Collection(internal.CleanCollectionName(col)).CountDocuments(ctx, filter)
+		if err != nil {
+			return result, err
+		}
 
-	result.Total = count
+		result.Total = count
 
-	if count == 0 {
-		result.Results = make([]map[string]interface{}, 0)
-		return result, nil
+		if count == 0 {
+			result.Results = make([]map[string]interface{}, 0)
+			return result, nil
+		}
 	}
 
 	skips := params.Size * (params.Page - 1)
 
-	if len(params.SortBy) == 0 || strings.EqualFold(params.SortBy, "id") {
-		params.SortBy = FieldID
-	}
-	sortBy := bson.M{params.SortBy: 1}
-	if params.SortDescending {
-		sortBy[params.SortBy] = -1
-	}
-
 	opt := options.Find()
 	opt.SetSkip(skips)
 	opt.SetLimit(params.Size)
-	opt.SetSort(sortBy)
+	opt.SetSort(sortDocument(params))
+	if len(params.Fields) > 0 {
+		opt.SetProjection(projection(params.Fields))
+	}
 
-	cur, err := db.Collection(internal.CleanCollectionName(col)).Find(mg.Ctx, filter, opt)
+	cur, err := db.Collection(internal.CleanCollectionName(col)).Find(ctx, filter, opt)
 	if err != nil {
 		return result, err
 	}
-	defer cur.Close(mg.Ctx)
+	defer cur.Close(ctx)
 
 	var results []map[string]interface{}
-	for cur.Next(mg.Ctx) {
+	for cur.Next(ctx) {
 		var v map[string]interface{}
 		if err := cur.Decode(&v); err != nil {
 			return result, err
@@ -286,7 +395,47 @@ func (mg *Mongo) QueryDocuments(auth internal.Auth, dbName, col string, filter m
 	return result, nil
 }
 
+// ExplainQuery returns the MongoDB query planner output of the
+// QueryDocuments find, it's not executed.
+func (mg *Mongo) ExplainQuery(auth internal.Auth, dbName, col string, filter map[string]interface{}, params internal.ListParams) (map[string]interface{}, error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	acctID, userID, err := parseObjectID(auth)
+	if err != nil {
+		return nil, err
+	}
+
+	secureRead(acctID, userID, auth.Role, col, filter)
+
+	find := bson.D{
+		{Key: "find", Value: internal.CleanCollectionName(col)},
+		{Key: "filter", Value: filter},
+		{Key: "skip", Value: params.Size * (params.Page - 1)},
+		{Key: "limit", Value: params.Size},
+	}
+	if sort := sortDocument(params); len(sort) > 0 {
+		find = append(find, bson.E{Key: "sort", Value: sort})
+	}
+
+	cmd := bson.D{
+		{Key: "explain", Value: find},
+		{Key: "verbosity", Value: "queryPlanner"},
+	}
+
+	var plan map[string]interface{}
+	if err := db.RunCommand(ctx, cmd).Decode(&plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
 func (mg *Mongo) GetDocumentByID(auth internal.Auth, dbName, col, id string) (map[string]interface{}, error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	var result map[string]interface{}
@@ -305,7 +454,7 @@ func (mg *Mongo) GetDocumentByID(auth internal.Auth, dbName, col, id string) (ma
 
 	secureRead(acctID, userID, auth.Role, col, filter)
 
-	sr := db.Collection(internal.CleanCollectionName(col)).FindOne(mg.Ctx, filter)
+	sr := db.Collection(internal.CleanCollectionName(col)).FindOne(ctx, filter)
 	if err := sr.Decode(&result); err != nil {
 		return result, err
 	} else if err := sr.Err(); err != nil {
@@ -317,7 +466,57 @@ func (mg *Mongo) GetDocumentByID(auth internal.Auth, dbName, col, id string) (ma
 	return result, nil
 }
 
+func (mg *Mongo) GetDocumentsByIDs(auth internal.Auth, dbName, col string, ids []string) ([]map[string]interface{}, error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	// an invalid id cannot match a document
+	var oids []primitive.ObjectID
+	for _, id := range ids {
+		if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+			oids = append(oids, oid)
+		}
+	}
+
+	if len(oids) == 0 {
+		return nil, nil
+	}
+
+	acctID, userID, err := parseObjectID(auth)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{FieldID: bson.M{"$in": oids}}
+
+	secureRead(acctID, userID, auth.Role, col, filter)
+
+	cur, err := db.Collection(internal.CleanCollectionName(col)).Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var docs []map[string]interface{}
+	for cur.Next(ctx) {
+		var v map[string]interface{}
+		if err := cur.Decode(&v); err != nil {
+			return nil, err
+		}
+
+		cleanMap(v)
+
+		docs = append(docs, v)
+	}
+	return docs, cur.Err()
+}
+
 func (mg *Mongo) UpdateDocument(auth internal.Auth, dbName, col, id string, doc map[string]interface{}) (map[string]interface{}, error) {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	oid, err := primitive.ObjectIDFromHex(id)
@@ -331,6 +530,7 @@ func (mg *Mongo) UpdateDocument(auth internal.Auth, dbName, col, id string, doc
 	}
 
 	delete(doc, "id")
+	delete(doc, "ownerId")
 	delete(doc, FieldID)
 	delete(doc, FieldAccountID)
 	delete(doc, FieldOwnerID)
@@ -343,16 +543,17 @@ func (mg *Mongo) UpdateDocument(auth internal.Auth, dbName, col, id string, doc
 	for k, v := range doc {
 		newProps[k] = v
 	}
+	internal.Touch(newProps)
 
 	update := bson.M{"$set": newProps}
 
-	res := db.Collection(internal.CleanCollectionName(col)).FindOneAndUpdate(mg.Ctx, filter, update)
+	res := db.Collection(internal.CleanCollectionName(col)).FindOneAndUpdate(ctx, filter, update)
 	if err := res.Err(); err != nil {
-		return doc, err
+		return doc, duplicateValue(err)
 	}
 
 	var result bson.M
-	sr := db.Collection(internal.CleanCollectionName(col)).FindOne(mg.Ctx, filter)
+	sr := db.Collection(internal.CleanCollectionName(col)).FindOne(ctx, filter)
 	if err := sr.Decode(&result); err != nil {
 		return doc, err
 	} else if err := sr.Err(); err != nil {
@@ -366,7 +567,142 @@ func (mg *Mongo) UpdateDocument(auth internal.Auth, dbName, col, id string, doc
 	return result, nil
 }
 
+func (mg *Mongo) ReplaceDocument(auth internal.Auth, dbName, col, id string, doc map[string]interface{}) (map[string]interface{}, error) {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	acctID, userID, err := parseObjectID(auth)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(doc, "id")
+	delete(doc, "ownerId")
+	delete(doc, FieldID)
+	delete(doc, FieldAccountID)
+	delete(doc, FieldOwnerID)
+
+	filter := bson.M{FieldID: oid}
+
+	secureWrite(acctID, userID, auth.Role, col, filter)
+
+	// the replacement keeps the owner of the document
+	var existing bson.M
+	sr := db.Collection(internal.CleanCollectionName(col)).FindOne(ctx, filter)
+	if err := sr.Decode(&existing); err != nil {
+		return nil, err
+	}
+
+	replacement := bson.M{}
+	for k, v := range doc {
+		replacement[k] = v
+	}
+	replacement[FieldAccountID] = existing[FieldAccountID]
+	replacement[FieldOwnerID] = existing[FieldOwnerID]
+	internal.Touch(replacement)
+
+	if _, err := db.Collection(internal.CleanCollectionName(col)).ReplaceOne(ctx, filter, replacement); err != nil {
+		return nil, duplicateValue(err)
+	}
+
+	var result bson.M
+	sr = db.Collection(internal.CleanCollectionName(col)).FindOne(ctx, filter)
+	if err := sr.Decode(&result); err != nil {
+		return nil, err
+	}
+
+	cleanMap(result)
+
+	mg.PublishDocument("db-"+col, internal.MsgTypeDBUpdated, result)
+
+	return result, nil
+}
+
+func (mg *Mongo) UpdateByFilter(auth internal.Auth, dbName, col string, filter map[string]interface{}, doc map[string]interface{}) (int64, error) {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	acctID, userID, err := parseObjectID(auth)
+	if err != nil {
+		return 0, err
+	}
+
+	delete(doc, "id")
+	delete(doc, "ownerId")
+	delete(doc, FieldID)
+	delete(doc, FieldAccountID)
+	delete(doc, FieldOwnerID)
+
+	secureWrite(acctID, userID, auth.Role, col, filter)
+
+	// the matching ids are kept to publish the updated documents
+	opt := options.Find().SetProjection(bson.M{FieldID: 1})
+	cur, err := db.Collection(internal.CleanCollectionName(col)).Find(ctx, filter, opt)
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+
+	var ids []primitive.ObjectID
+	for cur.Next(ctx) {
+		var v struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cur.Decode(&v); err != nil {
+			return 0, err
+		}
+		ids = append(ids, v.ID)
+	}
+	if err := cur.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	internal.Touch(doc)
+
+	byIDs := bson.M{FieldID: bson.M{"$in": ids}}
+	update := bson.M{"$set": bson.M(doc)}
+
+	res, err := db.Collection(internal.CleanCollectionName(col)).UpdateMany(ctx, byIDs, update)
+	if err != nil {
+		return 0, duplicateValue(err)
+	}
+
+	updated, err := db.Collection(internal.CleanCollectionName(col)).Find(ctx, byIDs)
+	if err != nil {
+		return 0, err
+	}
+	defer updated.Close(ctx)
+
+	for updated.Next(ctx) {
+		var result bson.M
+		if err := updated.Decode(&result); err != nil {
+			return 0, err
+		}
+
+		cleanMap(result)
+		mg.PublishDocument("db-"+col, internal.MsgTypeDBUpdated, result)
+	}
+
+	return res.MatchedCount, nil
+}
+
 func (mg *Mongo) IncrementValue(auth internal.Auth, dbName, col, id, field string, n int) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	oid, err := primitive.ObjectIDFromHex(id)
@@ -383,9 +719,12 @@ func (mg *Mongo) IncrementValue(auth internal.Auth, dbName, col, id, field strin
 
 	secureWrite(acctID, userID, auth.Role, col, filter)
 
-	update := bson.M{"$inc": bson.M{field: n}}
+	touched := bson.M{}
+	internal.Touch(touched)
+
+	update := bson.M{"$inc": bson.M{field: n}, "$set": touched}
 
-	res := db.Collection(internal.CleanCollectionName(col)).FindOneAndUpdate(mg.Ctx, filter, update)
+	res := db.Collection(internal.CleanCollectionName(col)).FindOneAndUpdate(ctx, filter, update)
 	if err := res.Err(); err != nil {
 		return err
 	}
@@ -401,6 +740,9 @@ func (mg *Mongo) IncrementValue(auth internal.Auth, dbName, col, id, field strin
 }
 
 func (mg *Mongo) DeleteDocument(auth internal.Auth, dbName, col, id string) (int64, error) {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	oid, err := primitive.ObjectIDFromHex(id)
@@ -417,7 +759,7 @@ func (mg *Mongo) DeleteDocument(auth internal.Auth, dbName, col, id string) (int
 
 	secureWrite(acctID, userID, auth.Role, col, filter)
 
-	res, err := db.Collection(internal.CleanCollectionName(col)).DeleteOne(mg.Ctx, filter)
+	res, err := db.Collection(internal.CleanCollectionName(col)).DeleteOne(ctx, filter)
 	if err != nil {
 		return 0, err
 	}
@@ -427,17 +769,96 @@ func (mg *Mongo) DeleteDocument(auth internal.Auth, dbName, col, id string) (int
 	return res.DeletedCount, nil
 }
 
+func (mg *Mongo) DeleteByFilter(auth internal.Auth, dbName, col string, filter map[string]interface{}) (int64, error) {
+	acctID, userID, err := parseObjectID(auth)
+	if err != nil {
+		return 0, err
+	}
+
+	secureWrite(acctID, userID, auth.Role, col, filter)
+
+	return mg.deleteMany(dbName, col, filter)
+}
+
+func (mg *Mongo) DeleteExpired(dbName, col, field string, before time.Time) (int64, error) {
+	// the expiry field is stored in UTC with a fixed layout, see normalizeExpiry
+	// of the server, so it compares as a string
+	filter := bson.M{field: bson.M{"$lte": before.UTC().Format(time.RFC3339)}}
+	return mg.deleteMany(dbName, col, filter)
+}
+
+// deleteMany deletes the documents of col matching filter and publishes a
+// deleted event for each of them.
+func (mg *Mongo) deleteMany(dbName, col string, filter bson.M) (int64, error) {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	// the ids are needed to publish the deleted events
+	opt := options.Find().SetProjection(bson.M{FieldID: 1})
+	cur, err := db.Collection(internal.CleanCollectionName(col)).Find(ctx, filter, opt)
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+
+	var ids []primitive.ObjectID
+	for cur.Next(ctx) {
+		var v struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cur.Decode(&v); err != nil {
+			return 0, err
+		}
+		ids = append(ids, v.ID)
+	}
+	if err := cur.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	res, err := db.Collection(internal.CleanCollectionName(col)).DeleteMany(ctx, bson.M{FieldID: bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		mg.PublishDocument("db-"+col, internal.MsgTypeDBDeleted, id.Hex())
+	}
+
+	return res.DeletedCount, nil
+}
+
+func (mg *Mongo) TruncateCollection(dbName, col string) (int64, error) {
+	return mg.deleteMany(dbName, col, bson.M{})
+}
+
+func (mg *Mongo) DropCollection(dbName, col string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+	return db.Collection(internal.CleanCollectionName(col)).Drop(ctx)
+}
+
 func (mg *Mongo) ListCollections(dbName string) ([]string, error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
-	cur, err := db.ListCollections(mg.Ctx, bson.D{})
+	cur, err := db.ListCollections(ctx, bson.D{})
 	if err != nil {
 		return nil, err
 	}
-	defer cur.Close(mg.Ctx)
+	defer cur.Close(ctx)
 
 	var names []string
-	for cur.Next(mg.Ctx) {
+	for cur.Next(ctx) {
 		var result bson.M
 		err := cur.Decode(&result)
 		if err != nil {
@@ -450,6 +871,50 @@ func (mg *Mongo) ListCollections(dbName string) ([]string, error) {
 	return names, nil
 }
 
+// Stats returns the count, size and totalIndexSize of the collStats command
+// of the collections of the base.
+func (mg *Mongo) Stats(dbName string) (stats internal.BaseStats, err error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	names, err := db.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var result bson.M
+		if err = db.RunCommand(ctx, bson.D{{Key: "collStats", Value: name}}).Decode(&result); err != nil {
+			return
+		}
+
+		stats.Add(internal.CollectionStats{
+			Name:       name,
+			Documents:  statValue(result["count"]),
+			Bytes:      statValue(result["size"]),
+			IndexBytes: statValue(result["totalIndexSize"]),
+		})
+	}
+	return
+}
+
+// statValue converts a number of the collStats result, its type depends on
+// its magnitude.
+func statValue(v interface{}) int64 {
+	switch n := v.(type) {
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
 func parseObjectID(auth internal.Auth) (acctID, userID primitive.ObjectID, err error) {
 	acctID, err = primitive.ObjectIDFromHex(auth.AccountID)
 	if err != nil {
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/staticbackendhq/core/internal"
+
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -11,19 +13,25 @@ import (
 )
 
 func (mg *Mongo) AddFormSubmission(dbName, form string, doc map[string]interface{}) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	doc[FieldID] = primitive.NewObjectID()
 	doc[FieldFormName] = form
 	doc["sb_posted"] = time.Now()
 
-	if _, err := db.Collection("sb_forms").InsertOne(mg.Ctx, doc); err != nil {
+	if _, err := db.Collection("sb_forms").InsertOne(ctx, doc); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (mg *Mongo) ListFormSubmissions(dbName, name string) (results []map[string]interface{}, err error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	opt := options.Find()
@@ -35,13 +43,13 @@ func (mg *Mongo) ListFormSubmissions(dbName, name string) (results []map[string]
 		filter["form"] = name
 	}
 
-	cur, err := db.Collection("sb_forms").Find(mg.Ctx, filter, opt)
+	cur, err := db.Collection("sb_forms").Find(ctx, filter, opt)
 	if err != nil {
 		return
 	}
-	defer cur.Close(mg.Ctx)
+	defer cur.Close(ctx)
 
-	for cur.Next(mg.Ctx) {
+	for cur.Next(ctx) {
 		var result bson.M
 		if err := cur.Decode(&result); err != nil {
 			return nil, err
@@ -64,17 +72,20 @@ func (mg *Mongo) ListFormSubmissions(dbName, name string) (results []map[string]
 }
 
 func (mg *Mongo) GetForms(dbName string) ([]string, error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	pipeline := mongo.Pipeline{bson.D{{"$group", bson.D{{"_id", "$form"}}}}}
-	cur, err := db.Collection("sb_forms").Aggregate(mg.Ctx, pipeline)
+	cur, err := db.Collection("sb_forms").Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
-	defer cur.Close(mg.Ctx)
+	defer cur.Close(ctx)
 
 	var names []string
-	for cur.Next(mg.Ctx) {
+	for cur.Next(ctx) {
 		var form bson.M
 		if err := cur.Decode(&form); err != nil {
 			return nil, err
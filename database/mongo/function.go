@@ -96,6 +96,9 @@ func fromLocalExecHistory(lh []LocalExecHistory) []internal.ExecHistory {
 }
 
 func (mg *Mongo) AddFunction(dbName string, data internal.ExecData) (string, error) {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	data.ID = primitive.NewObjectID().Hex()
@@ -105,7 +108,7 @@ func (mg *Mongo) AddFunction(dbName string, data internal.ExecData) (string, err
 
 	lex := toLocalExecData(data)
 
-	_, err := db.Collection("sb_functions").InsertOne(mg.Ctx, lex)
+	_, err := db.Collection("sb_functions").InsertOne(ctx, lex)
 	if err != nil {
 		return "", err
 	}
@@ -119,6 +122,9 @@ func (mg *Mongo) AddFunction(dbName string, data internal.ExecData) (string, err
 }
 
 func (mg *Mongo) UpdateFunction(dbName, id, code, trigger string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	oid, err := primitive.ObjectIDFromHex(id)
@@ -132,7 +138,7 @@ func (mg *Mongo) UpdateFunction(dbName, id, code, trigger string) error {
 	}
 	filter := bson.M{FieldID: oid}
 
-	res := db.Collection("sb_functions").FindOneAndUpdate(mg.Ctx, filter, update)
+	res := db.Collection("sb_functions").FindOneAndUpdate(ctx, filter, update)
 	if err := res.Err(); err != nil {
 		return err
 	}
@@ -141,6 +147,9 @@ func (mg *Mongo) UpdateFunction(dbName, id, code, trigger string) error {
 }
 
 func (mg *Mongo) GetFunctionForExecution(dbName, name string) (result internal.ExecData, err error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	filter := bson.M{"name": name}
@@ -149,7 +158,7 @@ func (mg *Mongo) GetFunctionForExecution(dbName, name string) (result internal.E
 	opt.SetProjection(bson.M{"h": false})
 
 	var lex LocalExecData
-	sr := db.Collection("sb_functions").FindOne(mg.Ctx, filter, opt)
+	sr := db.Collection("sb_functions").FindOne(ctx, filter, opt)
 	if err := sr.Decode(&lex); err != nil {
 		return result, err
 	} else if err := sr.Err(); err != nil {
@@ -161,6 +170,9 @@ func (mg *Mongo) GetFunctionForExecution(dbName, name string) (result internal.E
 }
 
 func (mg *Mongo) GetFunctionByID(dbName, id string) (result internal.ExecData, err error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	oid, err := primitive.ObjectIDFromHex(id)
@@ -171,7 +183,7 @@ func (mg *Mongo) GetFunctionByID(dbName, id string) (result internal.ExecData, e
 	filter := bson.M{FieldID: oid}
 
 	var lex LocalExecData
-	sr := db.Collection("sb_functions").FindOne(mg.Ctx, filter)
+	sr := db.Collection("sb_functions").FindOne(ctx, filter)
 	if err = sr.Decode(&lex); err != nil {
 		return
 	} else if err = sr.Err(); err != nil {
@@ -183,12 +195,15 @@ func (mg *Mongo) GetFunctionByID(dbName, id string) (result internal.ExecData, e
 }
 
 func (mg *Mongo) GetFunctionByName(dbName, name string) (result internal.ExecData, err error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	filter := bson.M{"name": name}
 
 	var lex LocalExecData
-	sr := db.Collection("sb_functions").FindOne(mg.Ctx, filter)
+	sr := db.Collection("sb_functions").FindOne(ctx, filter)
 	if err := sr.Decode(&lex); err != nil {
 		return result, err
 	} else if err := sr.Err(); err != nil {
@@ -199,18 +214,21 @@ func (mg *Mongo) GetFunctionByName(dbName, name string) (result internal.ExecDat
 }
 
 func (mg *Mongo) ListFunctions(dbName string) (results []internal.ExecData, err error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	opt := &options.FindOptions{}
 	opt.SetProjection(bson.M{"h": 0})
 
-	cur, err := db.Collection("sb_functions").Find(mg.Ctx, bson.M{}, opt)
+	cur, err := db.Collection("sb_functions").Find(ctx, bson.M{}, opt)
 	if err != nil {
 		return
 	}
-	defer cur.Close(mg.Ctx)
+	defer cur.Close(ctx)
 
-	for cur.Next(mg.Ctx) {
+	for cur.Next(ctx) {
 		var lex LocalExecData
 		err = cur.Decode(&lex)
 		if err != nil {
@@ -224,6 +242,9 @@ func (mg *Mongo) ListFunctions(dbName string) (results []internal.ExecData, err
 }
 
 func (mg *Mongo) ListFunctionsByTrigger(dbName, trigger string) (results []internal.ExecData, err error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	opt := &options.FindOptions{}
@@ -231,13 +252,13 @@ func (mg *Mongo) ListFunctionsByTrigger(dbName, trigger string) (results []inter
 
 	filter := bson.M{"tr": trigger}
 
-	cur, err := db.Collection("sb_functions").Find(mg.Ctx, filter, opt)
+	cur, err := db.Collection("sb_functions").Find(ctx, filter, opt)
 	if err != nil {
 		return
 	}
-	defer cur.Close(mg.Ctx)
+	defer cur.Close(ctx)
 
-	for cur.Next(mg.Ctx) {
+	for cur.Next(ctx) {
 		var lex LocalExecData
 		if err = cur.Decode(&lex); err != nil {
 			return
@@ -250,17 +271,23 @@ func (mg *Mongo) ListFunctionsByTrigger(dbName, trigger string) (results []inter
 }
 
 func (mg *Mongo) DeleteFunction(dbName, name string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	filter := bson.M{"name": name}
 
-	if _, err := db.Collection("sb_functions").DeleteOne(mg.Ctx, filter); err != nil {
+	if _, err := db.Collection("sb_functions").DeleteOne(ctx, filter); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (mg *Mongo) RanFunction(dbName, id string, rh internal.ExecHistory) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	oid, err := primitive.ObjectIDFromHex(id)
@@ -276,7 +303,7 @@ func (mg *Mongo) RanFunction(dbName, id string, rh internal.ExecHistory) error {
 		"$set":  bson.M{"lr": time.Now()},
 		"$push": bson.M{"h": leh},
 	}
-	res := db.Collection("sb_functions").FindOneAndUpdate(mg.Ctx, filter, update)
+	res := db.Collection("sb_functions").FindOneAndUpdate(ctx, filter, update)
 	if err := res.Err(); err != nil {
 		return err
 	}
@@ -2,10 +2,13 @@ package mongo
 
 import (
 	"errors"
+	"regexp"
+	"time"
 
 	"github.com/staticbackendhq/core/internal"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -15,14 +18,25 @@ type LocalAccount struct {
 }
 
 func (mg *Mongo) CreateUserAccount(dbName, email string) (id string, err error) {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
+	email = internal.NormalizeEmail(email)
+
+	if exists, err := mg.UserEmailExists(dbName, email); err != nil {
+		return "", err
+	} else if exists {
+		return "", internal.ErrEmailTaken
+	}
+
 	a := LocalAccount{
 		ID:    primitive.NewObjectID(),
 		Email: email,
 	}
 
-	_, err = db.Collection("sb_accounts").InsertOne(mg.Ctx, a)
+	_, err = db.Collection("sb_accounts").InsertOne(ctx, a)
 	if err != nil {
 		return
 	}
@@ -32,14 +46,28 @@ func (mg *Mongo) CreateUserAccount(dbName, email string) (id string, err error)
 }
 
 func (mg *Mongo) CreateUserToken(dbName string, tok internal.Token) (id string, err error) {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
+	tok.Email = internal.NormalizeEmail(tok.Email)
+
+	if exists, err := mg.UserEmailExists(dbName, tok.Email); err != nil {
+		return "", err
+	} else if exists {
+		return "", internal.ErrEmailTaken
+	}
+
 	tok.ID = primitive.NewObjectID().Hex()
 
 	itok := toLocalToken(tok)
 
-	_, err = db.Collection("sb_tokens").InsertOne(mg.Ctx, itok)
-	if err != nil {
+	// the unique index catches a concurrent creation with the same email
+	_, err = db.Collection("sb_tokens").InsertOne(ctx, itok)
+	if mongo.IsDuplicateKeyError(err) {
+		return "", internal.ErrEmailTaken
+	} else if err != nil {
 		return
 	}
 
@@ -47,10 +75,77 @@ func (mg *Mongo) CreateUserToken(dbName string, tok internal.Token) (id string,
 	return
 }
 
+// CreateUsers inserts the accounts then the tokens, the accounts are
+// removed if the tokens could not be inserted since the bases don't run on
+// a replica set supporting transactions.
+func (mg *Mongo) CreateUsers(dbName string, toks []internal.Token) ([]internal.Token, error) {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	seen := make(map[string]bool)
+	accounts := make([]interface{}, 0, len(toks))
+	tokens := make([]interface{}, 0, len(toks))
+	accountIDs := make([]primitive.ObjectID, 0, len(toks))
+	created := make([]internal.Token, 0, len(toks))
+	for _, tok := range toks {
+		tok.Email = internal.NormalizeEmail(tok.Email)
+
+		if exists, err := mg.UserEmailExists(dbName, tok.Email); err != nil {
+			return nil, err
+		} else if exists || seen[tok.Email] {
+			return nil, internal.ErrEmailTaken
+		}
+		seen[tok.Email] = true
+
+		a := LocalAccount{
+			ID:    primitive.NewObjectID(),
+			Email: tok.Email,
+		}
+		tok.AccountID = a.ID.Hex()
+		tok.ID = primitive.NewObjectID().Hex()
+
+		accounts = append(accounts, a)
+		accountIDs = append(accountIDs, a.ID)
+		tokens = append(tokens, toLocalToken(tok))
+		created = append(created, tok)
+	}
+
+	if len(created) == 0 {
+		return created, nil
+	}
+
+	if _, err := db.Collection("sb_accounts").InsertMany(ctx, accounts); err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Collection("sb_tokens").InsertMany(ctx, tokens); err != nil {
+		filter := bson.M{"_id": bson.M{"$in": accountIDs}}
+		db.Collection("sb_accounts").DeleteMany(ctx, filter)
+		db.Collection("sb_tokens").DeleteMany(ctx, bson.M{"accountId": bson.M{"$in": accountIDs}})
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, internal.ErrEmailTaken
+		}
+		return nil, err
+	}
+	return created, nil
+}
+
+// emailFilter matches an email regardless of its casing, the emails stored
+// before they were normalized can be mixed-case.
+func emailFilter(email string) bson.M {
+	pattern := "^" + regexp.QuoteMeta(email) + "$"
+	return bson.M{"email": primitive.Regex{Pattern: pattern, Options: "i"}}
+}
+
 func (mg *Mongo) UserEmailExists(dbName, email string) (exists bool, err error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
-	count, err := db.Collection("sb_tokens").CountDocuments(mg.Ctx, bson.M{"email": email})
+	count, err := db.Collection("sb_tokens").CountDocuments(ctx, emailFilter(email))
 	if err != nil {
 		return
 	}
@@ -60,17 +155,54 @@ func (mg *Mongo) UserEmailExists(dbName, email string) (exists bool, err error)
 }
 
 func (mg *Mongo) SetUserRole(dbName, email string, role int) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
-	filter := bson.M{"email": email}
+	filter := emailFilter(email)
 	update := bson.M{"$set": bson.M{"role": role}}
-	if _, err := db.Collection("sb_tokens").UpdateOne(mg.Ctx, filter, update); err != nil {
+	if _, err := db.Collection("sb_tokens").UpdateOne(ctx, filter, update); err != nil {
 		return err
 	}
 	return nil
 }
 
+// DemoteUser changes the role then counts the admins left since the bases
+// don't run on a replica set supporting transactions. The change is undone
+// when no admin is left, of two concurrent demotions at least one is undone.
+func (mg *Mongo) DemoteUser(dbName, email string, role, adminRole int) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	var tok LocalToken
+	filter := emailFilter(email)
+	filter[FieldRole] = bson.M{"$gte": adminRole}
+	update := bson.M{"$set": bson.M{"role": role}}
+	if err := db.Collection("sb_tokens").FindOneAndUpdate(ctx, filter, update).Decode(&tok); err != nil {
+		return err
+	}
+
+	count, countErr := db.Collection("sb_tokens").CountDocuments(ctx, bson.M{FieldRole: bson.M{"$gte": adminRole}})
+	if countErr == nil && count > 0 {
+		return nil
+	}
+
+	undo := bson.M{"$set": bson.M{"role": tok.Role}}
+	if _, err := db.Collection("sb_tokens").UpdateOne(ctx, bson.M{FieldID: tok.ID}, undo); err != nil {
+		return err
+	} else if countErr != nil {
+		return countErr
+	}
+	return internal.ErrLastAdmin
+}
+
 func (mg *Mongo) UserSetPassword(dbName, tokenID, password string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	id, err := primitive.ObjectIDFromHex(tokenID)
@@ -80,13 +212,64 @@ func (mg *Mongo) UserSetPassword(dbName, tokenID, password string) error {
 
 	filter := bson.M{"_id": id}
 	update := bson.M{"$set": bson.M{"pw": password}}
-	if _, err := db.Collection("sb_tokens").UpdateOne(mg.Ctx, filter, update); err != nil {
+	if _, err := db.Collection("sb_tokens").UpdateOne(ctx, filter, update); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mg *Mongo) UserSetEmail(dbName, tokenID, email string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	email = internal.NormalizeEmail(email)
+
+	if exists, err := mg.UserEmailExists(dbName, email); err != nil {
+		return err
+	} else if exists {
+		return internal.ErrEmailTaken
+	}
+
+	db := mg.Client.Database(dbName)
+
+	id, err := primitive.ObjectIDFromHex(tokenID)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": id}
+	update := bson.M{"$set": bson.M{"email": email}}
+	if _, err := db.Collection("sb_tokens").UpdateOne(ctx, filter, update); mongo.IsDuplicateKeyError(err) {
+		return internal.ErrEmailTaken
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mg *Mongo) SetUserToken(dbName, tokenID, token string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	id, err := primitive.ObjectIDFromHex(tokenID)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": id}
+	update := bson.M{"$set": bson.M{"token": token}}
+	if _, err := db.Collection("sb_tokens").UpdateOne(ctx, filter, update); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (mg *Mongo) GetFirstTokenFromAccountID(dbName, accountID string) (tok internal.Token, err error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	oid, err := primitive.ObjectIDFromHex(accountID)
@@ -100,14 +283,14 @@ func (mg *Mongo) GetFirstTokenFromAccountID(dbName, accountID string) (tok inter
 	opt.SetLimit(1)
 	opt.SetSort(bson.M{FieldID: 1})
 
-	cur, err := db.Collection("sb_tokens").Find(mg.Ctx, filter, opt)
+	cur, err := db.Collection("sb_tokens").Find(ctx, filter, opt)
 	if err != nil {
 		return
 	}
-	defer cur.Close(mg.Ctx)
+	defer cur.Close(ctx)
 
 	var lt LocalToken
-	if cur.Next(mg.Ctx) {
+	if cur.Next(ctx) {
 		if err = cur.Decode(&lt); err != nil {
 			return
 		}
@@ -121,3 +304,300 @@ func (mg *Mongo) GetFirstTokenFromAccountID(dbName, accountID string) (tok inter
 
 	return
 }
+
+func (mg *Mongo) ListTokens(dbName, accountID string) ([]internal.Token, error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	opt := options.Find()
+	opt.SetSort(bson.M{FieldID: 1})
+
+	cur, err := db.Collection("sb_tokens").Find(ctx, bson.M{FieldAccountID: oid}, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var toks []internal.Token
+	for cur.Next(ctx) {
+		var lt LocalToken
+		if err := cur.Decode(&lt); err != nil {
+			return nil, err
+		}
+		toks = append(toks, fromLocalToken(lt))
+	}
+	return toks, cur.Err()
+}
+
+func (mg *Mongo) DeleteToken(dbName, tokenID string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(tokenID)
+	if err != nil {
+		return err
+	}
+
+	res, err := db.Collection("sb_tokens").DeleteOne(ctx, bson.M{FieldID: oid})
+	if err != nil {
+		return err
+	} else if res.DeletedCount == 0 {
+		return errors.New("token not found")
+	}
+	return nil
+}
+
+type LocalLoginEvent struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	IP        string             `bson:"ip" json:"ip"`
+	UserAgent string             `bson:"ua" json:"userAgent"`
+	Created   time.Time          `bson:"created" json:"created"`
+}
+
+func (mg *Mongo) AddLoginEvent(dbName string, ev internal.LoginEvent, keep int) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	userID, err := primitive.ObjectIDFromHex(ev.UserID)
+	if err != nil {
+		return err
+	}
+
+	le := LocalLoginEvent{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		IP:        ev.IP,
+		UserAgent: ev.UserAgent,
+		Created:   ev.Created,
+	}
+	if _, err := db.Collection("sb_logins").InsertOne(ctx, le); err != nil {
+		return err
+	}
+
+	if keep <= 0 {
+		return nil
+	}
+
+	opt := options.Find()
+	opt.SetSort(bson.M{"created": -1})
+	opt.SetSkip(int64(keep))
+	opt.SetProjection(bson.M{FieldID: 1})
+
+	cur, err := db.Collection("sb_logins").Find(ctx, bson.M{"userId": userID}, opt)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	var ids []primitive.ObjectID
+	for cur.Next(ctx) {
+		var old LocalLoginEvent
+		if err := cur.Decode(&old); err != nil {
+			return err
+		}
+		ids = append(ids, old.ID)
+	}
+	if err := cur.Err(); err != nil || len(ids) == 0 {
+		return err
+	}
+
+	_, err = db.Collection("sb_logins").DeleteMany(ctx, bson.M{FieldID: bson.M{"$in": ids}})
+	return err
+}
+
+func (mg *Mongo) ListLoginEvents(dbName, userID string) ([]internal.LoginEvent, error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	opt := options.Find()
+	opt.SetSort(bson.M{"created": -1})
+
+	cur, err := db.Collection("sb_logins").Find(ctx, bson.M{"userId": oid}, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var events []internal.LoginEvent
+	for cur.Next(ctx) {
+		var le LocalLoginEvent
+		if err := cur.Decode(&le); err != nil {
+			return nil, err
+		}
+
+		events = append(events, internal.LoginEvent{
+			ID:        le.ID.Hex(),
+			UserID:    le.UserID.Hex(),
+			IP:        le.IP,
+			UserAgent: le.UserAgent,
+			Created:   le.Created,
+		})
+	}
+	return events, cur.Err()
+}
+
+func (mg *Mongo) SetLoginAlerts(dbName, userID string, enabled bool) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{FieldID: oid}
+	if enabled {
+		_, err = db.Collection("sb_login_alerts_optout").DeleteOne(ctx, filter)
+		return err
+	}
+
+	opt := options.Update().SetUpsert(true)
+	_, err = db.Collection("sb_login_alerts_optout").UpdateOne(ctx, filter, bson.M{"$setOnInsert": filter}, opt)
+	return err
+}
+
+func (mg *Mongo) LoginAlertsEnabled(dbName, userID string) (bool, error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false, err
+	}
+
+	count, err := db.Collection("sb_login_alerts_optout").CountDocuments(ctx, bson.M{FieldID: oid})
+	if err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+type LocalLoginCode struct {
+	UserID  primitive.ObjectID `bson:"_id"`
+	Hash    string             `bson:"hash"`
+	Expires time.Time          `bson:"expires"`
+}
+
+func (mg *Mongo) SetLoginCode(dbName string, code internal.LoginCode) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	userID, err := primitive.ObjectIDFromHex(code.UserID)
+	if err != nil {
+		return err
+	}
+
+	lc := LocalLoginCode{UserID: userID, Hash: code.Hash, Expires: code.Expires}
+
+	opt := options.Replace().SetUpsert(true)
+	_, err = db.Collection("sb_login_codes").ReplaceOne(ctx, bson.M{FieldID: userID}, lc, opt)
+	return err
+}
+
+func (mg *Mongo) UseLoginCode(dbName, userID, hash string, now time.Time) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return internal.ErrInvalidLoginCode
+	}
+
+	// the delete makes the code single-use even for concurrent attempts
+	filter := bson.M{FieldID: id, "hash": hash, "expires": bson.M{"$gt": now}}
+	res, err := db.Collection("sb_login_codes").DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	} else if res.DeletedCount == 0 {
+		return internal.ErrInvalidLoginCode
+	}
+	return nil
+}
+
+type LocalImpersonation struct {
+	ID             primitive.ObjectID `bson:"_id" json:"id"`
+	ImpersonatedBy string             `bson:"by" json:"impersonatedBy"`
+	UserID         string             `bson:"userId" json:"userId"`
+	Email          string             `bson:"email" json:"email"`
+	Expires        time.Time          `bson:"expires" json:"expires"`
+	Created        time.Time          `bson:"created" json:"created"`
+}
+
+func (mg *Mongo) AddImpersonation(dbName string, imp internal.Impersonation) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	li := LocalImpersonation{
+		ID:             primitive.NewObjectID(),
+		ImpersonatedBy: imp.ImpersonatedBy,
+		UserID:         imp.UserID,
+		Email:          imp.Email,
+		Expires:        imp.Expires,
+		Created:        imp.Created,
+	}
+	_, err := db.Collection("sb_impersonations").InsertOne(ctx, li)
+	return err
+}
+
+func (mg *Mongo) ListImpersonations(dbName string) ([]internal.Impersonation, error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	opt := options.Find()
+	opt.SetSort(bson.M{"created": -1})
+
+	cur, err := db.Collection("sb_impersonations").Find(ctx, bson.M{}, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var list []internal.Impersonation
+	for cur.Next(ctx) {
+		var li LocalImpersonation
+		if err := cur.Decode(&li); err != nil {
+			return nil, err
+		}
+
+		list = append(list, internal.Impersonation{
+			ID:             li.ID.Hex(),
+			ImpersonatedBy: li.ImpersonatedBy,
+			UserID:         li.UserID,
+			Email:          li.Email,
+			Expires:        li.Expires,
+			Created:        li.Created,
+		})
+	}
+	return list, cur.Err()
+}
@@ -0,0 +1,92 @@
+package mongo
+
+import (
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LocalMigration struct {
+	Version int       `bson:"_id"`
+	Applied time.Time `bson:"applied"`
+}
+
+// BaseMigrations returns the indexes added to the system collections of
+// the existing bases.
+func (mg *Mongo) BaseMigrations() []internal.BaseMigration {
+	return []internal.BaseMigration{
+		{Version: 1, Description: "index the login history by user", Up: mg.indexLogins},
+		{Version: 2, Description: "make the user emails unique", Up: mg.indexUserEmails},
+	}
+}
+
+func (mg *Mongo) indexLogins(dbName string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	idx := mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "created", Value: -1}},
+	}
+
+	db := mg.Client.Database(dbName)
+	_, err := db.Collection("sb_logins").Indexes().CreateOne(ctx, idx)
+	return err
+}
+
+// indexUserEmails makes the emails of the users unique so a concurrent
+// creation or change to the same email fails. The comparison ignores the
+// casing, the emails stored before they were normalized can be mixed-case.
+func (mg *Mongo) indexUserEmails(dbName string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	idx := mongo.IndexModel{
+		Keys:    bson.M{"email": 1},
+		Options: options.Index().SetUnique(true).SetCollation(&options.Collation{Locale: "en", Strength: 2}),
+	}
+
+	db := mg.Client.Database(dbName)
+	_, err := db.Collection("sb_tokens").Indexes().CreateOne(ctx, idx)
+	return err
+}
+
+func (mg *Mongo) AppliedMigrations(dbName string) (map[int]bool, error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	cur, err := db.Collection("sb_migrations").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	applied := make(map[int]bool)
+	for cur.Next(ctx) {
+		var lm LocalMigration
+		if err := cur.Decode(&lm); err != nil {
+			return nil, err
+		}
+		applied[lm.Version] = true
+	}
+	return applied, cur.Err()
+}
+
+func (mg *Mongo) SetMigrationApplied(dbName string, version int) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	filter := bson.M{FieldID: version}
+	update := bson.M{"$setOnInsert": bson.M{"applied": time.Now()}}
+	opt := options.Update().SetUpsert(true)
+
+	_, err := db.Collection("sb_migrations").UpdateOne(ctx, filter, update, opt)
+	return err
+}
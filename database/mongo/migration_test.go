@@ -0,0 +1,45 @@
+package mongo
+
+import (
+	"testing"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestBaseMigrations(t *testing.T) {
+	calls := 0
+	migrations := append(datastore.BaseMigrations(), internal.BaseMigration{
+		Version:     9999,
+		Description: "unit test",
+		Up: func(dbName string) error {
+			calls++
+			return nil
+		},
+	})
+
+	bases := []string{confDBName}
+	if _, err := internal.RunBaseMigrations(datastore, bases, migrations); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := datastore.AppliedMigrations(confDBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			t.Errorf("expected migration %d to be recorded", m.Version)
+		}
+	}
+
+	// the applied migrations are skipped on the next run
+	ran, err := internal.RunBaseMigrations(datastore, bases, migrations)
+	if err != nil {
+		t.Fatal(err)
+	} else if ran != 0 {
+		t.Errorf("expected no migration to run got %d", ran)
+	} else if calls > 1 {
+		t.Errorf("expected the migration to run at most once got %d", calls)
+	}
+}
@@ -2,11 +2,13 @@ package mongo
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/staticbackendhq/core/internal"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
@@ -29,16 +31,104 @@ func (mg *Mongo) Ping() error {
 	return mg.Client.Ping(ctx, readpref.Primary())
 }
 
-func (mg *Mongo) CreateIndex(dbName, col, field string) error {
+func (mg *Mongo) CreateIndex(dbName, col, field string, unique bool) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	idx := mongo.IndexModel{
 		Keys: bson.M{field: 1},
 	}
+	if unique {
+		// the documents without the field don't conflict, like on PostgreSQL
+		partial := bson.M{field: bson.M{"$exists": true}}
+		idx.Options = options.Index().SetUnique(true).SetPartialFilterExpression(partial)
+	}
+
+	dbCol := db.Collection(internal.CleanCollectionName(col))
+
+	if _, err := dbCol.Indexes().CreateOne(ctx, idx); err != nil {
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && (cmdErr.Name == "IndexOptionsConflict" || cmdErr.Name == "IndexKeySpecsConflict") {
+			return internal.ErrIndexConflict
+		}
+		return err
+	}
+	return nil
+}
+
+func (mg *Mongo) CreateGeoIndex(dbName, col, field string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	idx := mongo.IndexModel{
+		Keys: bson.M{field: "2dsphere"},
+	}
 
 	dbCol := db.Collection(internal.CleanCollectionName(col))
 
-	if _, err := dbCol.Indexes().CreateOne(mg.Ctx, idx); err != nil {
+	if _, err := dbCol.Indexes().CreateOne(ctx, idx); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mg *Mongo) ListIndexes(dbName, col string) ([]internal.Index, error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	cur, err := db.Collection(internal.CleanCollectionName(col)).Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	indexes := make([]internal.Index, 0)
+	for cur.Next(ctx) {
+		var v bson.M
+		if err := cur.Decode(&v); err != nil {
+			return nil, err
+		}
+
+		keys, ok := v["key"].(bson.M)
+		if !ok {
+			continue
+		}
+
+		for field, kind := range keys {
+			// the _id index is managed by MongoDB
+			if field == FieldID {
+				continue
+			}
+
+			idx := internal.Index{Field: field}
+			idx.Name, _ = v["name"].(string)
+			idx.Unique, _ = v["unique"].(bool)
+			idx.Geo = kind == "2dsphere"
+
+			indexes = append(indexes, idx)
+		}
+	}
+
+	return indexes, cur.Err()
+}
+
+func (mg *Mongo) DropIndex(dbName, col, name string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	if _, err := db.Collection(internal.CleanCollectionName(col)).Indexes().DropOne(ctx, name); err != nil {
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && cmdErr.Name == "IndexNotFound" {
+			return internal.ErrIndexNotFound
+		}
 		return err
 	}
 	return nil
@@ -2,11 +2,13 @@ package mongo
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/staticbackendhq/core/internal"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func (mg *Mongo) ParseQuery(clauses [][]interface{}) (map[string]interface{}, error) {
@@ -43,6 +45,33 @@ func (mg *Mongo) ParseQuery(clauses [][]interface{}) (map[string]interface{}, er
 			filter[field] = bson.M{"$in": clause[2]}
 		case "!in", "nin":
 			filter[field] = bson.M{"$nin": clause[2]}
+		case "contains":
+			pattern := regexp.QuoteMeta(fmt.Sprintf("%v", clause[2]))
+			filter[field] = primitive.Regex{Pattern: pattern}
+		case "near":
+			near, err := internal.ParseGeoNear(clause[2])
+			if err != nil {
+				return filter, fmt.Errorf("The %d query clause: %w", i+1, err)
+			}
+
+			// $centerSphere does not require an index and works with counts
+			center := bson.A{bson.A{near.Lng, near.Lat}, near.Radius / internal.EarthRadius}
+			filter[field] = bson.M{"$geoWithin": bson.M{"$centerSphere": center}}
+		case "within":
+			box, err := internal.ParseGeoBox(clause[2])
+			if err != nil {
+				return filter, fmt.Errorf("The %d query clause: %w", i+1, err)
+			}
+
+			ring := bson.A{
+				bson.A{box.MinLng, box.MinLat},
+				bson.A{box.MaxLng, box.MinLat},
+				bson.A{box.MaxLng, box.MaxLat},
+				bson.A{box.MinLng, box.MaxLat},
+				bson.A{box.MinLng, box.MinLat},
+			}
+			polygon := bson.M{"type": "Polygon", "coordinates": bson.A{ring}}
+			filter[field] = bson.M{"$geoWithin": bson.M{"$geometry": polygon}}
 		default:
 			return filter, fmt.Errorf("The %d query clause's operator: %s is not supported at the moment.", i+1, op)
 		}
@@ -76,3 +105,50 @@ func secureWrite(acctID, userID primitive.ObjectID, role int, col string, filter
 		}
 	}
 }
+
+// sortDocument returns the ordered sort keys, the id maps to _id which
+// follows the creation order.
+func sortDocument(params internal.ListParams) bson.D {
+	var sort bson.D
+	for _, sf := range params.SortFields() {
+		field := sf.Field
+		if field == internal.SortFieldID {
+			field = FieldID
+		}
+
+		direction := 1
+		if sf.Descending {
+			direction = -1
+		}
+
+		sort = append(sort, bson.E{Key: field, Value: direction})
+	}
+	return sort
+}
+
+// projection returns the fields to include, _id is included by default.
+func projection(fields []string) bson.M {
+	proj := bson.M{}
+	for _, field := range fields {
+		proj[field] = 1
+	}
+	return proj
+}
+
+// the offending field is only available in the error message, i.e.
+// E11000 duplicate key error collection: db.col index: username_1 dup key: { username: "x" }
+var dupKeyRe = regexp.MustCompile(`dup key: \{ ?"?([^":\s]+)"?\s*:`)
+
+// duplicateValue returns a DuplicateValueError when err is a unique index
+// violation.
+func duplicateValue(err error) error {
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	m := dupKeyRe.FindStringSubmatch(err.Error())
+	if len(m) != 2 {
+		return err
+	}
+	return &internal.DuplicateValueError{Field: m[1]}
+}
@@ -1,11 +1,14 @@
 package mongo
 
 import (
+	"errors"
 	"time"
 
 	"github.com/staticbackendhq/core/internal"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type LocalCustomer struct {
@@ -42,12 +45,23 @@ func fromLocalCustomer(c LocalCustomer) internal.Customer {
 }
 
 func (mg *Mongo) CreateCustomer(customer internal.Customer) (internal.Customer, error) {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database("sbsys")
 
+	customer.Email = internal.NormalizeEmail(customer.Email)
+
+	if exists, err := mg.EmailExists(customer.Email); err != nil {
+		return customer, err
+	} else if exists {
+		return customer, internal.ErrEmailTaken
+	}
+
 	lc := toLocalCustomer(customer)
 	lc.ID = primitive.NewObjectID()
 
-	if _, err := db.Collection("accounts").InsertOne(mg.Ctx, lc); err != nil {
+	if _, err := db.Collection("accounts").InsertOne(ctx, lc); err != nil {
 		return customer, err
 	}
 	return fromLocalCustomer(lc), nil
@@ -60,6 +74,15 @@ type LocalBase struct {
 	Whitelist        []string           `bson:"whitelist" json:"whitelist"`
 	IsActive         bool               `bson:"active" json:"-"`
 	MonthlyEmailSent int                `bson:"mes" json:"-"`
+	UploadTypes      []string           `bson:"uploadTypes" json:"allowedUploadTypes"`
+	MaxUploadSize    int64              `bson:"uploadMax" json:"maxUploadSize"`
+	DisplayName      string             `bson:"displayName" json:"displayName"`
+	PublicKey        string             `bson:"pk" json:"publicKey"`
+	PreviousKey      string             `bson:"prevPk" json:"-"`
+	PreviousExpires  time.Time          `bson:"prevPkExp" json:"-"`
+	SessionBinding   string             `bson:"sessBind" json:"sessionBinding"`
+	Features         map[string]bool    `bson:"features" json:"features"`
+	PublicAliases    map[string]string  `bson:"aliases" json:"publicAliases"`
 }
 
 func toLocalBase(b internal.BaseConfig) LocalBase {
@@ -74,36 +97,74 @@ func toLocalBase(b internal.BaseConfig) LocalBase {
 		Whitelist:        b.AllowedDomain,
 		IsActive:         b.IsActive,
 		MonthlyEmailSent: b.MonthlySentEmail,
+		UploadTypes:      b.AllowedUploadTypes,
+		MaxUploadSize:    b.MaxUploadSize,
+		DisplayName:      b.DisplayName,
+		SessionBinding:   b.SessionBinding,
+		Features:         b.Features,
+		PublicAliases:    b.PublicAliases,
 	}
 }
 
 func fromLocalBase(b LocalBase) internal.BaseConfig {
 	return internal.BaseConfig{
-		ID:               b.ID.Hex(),
-		CustomerID:       b.SBID.Hex(),
-		Name:             b.Name,
-		AllowedDomain:    b.Whitelist,
-		IsActive:         b.IsActive,
-		MonthlySentEmail: b.MonthlyEmailSent,
+		ID:                 b.ID.Hex(),
+		CustomerID:         b.SBID.Hex(),
+		Name:               b.Name,
+		AllowedDomain:      b.Whitelist,
+		IsActive:           b.IsActive,
+		MonthlySentEmail:   b.MonthlyEmailSent,
+		AllowedUploadTypes: b.UploadTypes,
+		MaxUploadSize:      b.MaxUploadSize,
+		DisplayName:        b.DisplayName,
+		PublicKey:          b.PublicKey,
+		PreviousPublicKey:  b.PreviousKey,
+		PreviousKeyExpires: b.PreviousExpires,
+		SessionBinding:     b.SessionBinding,
+		Features:           b.Features,
+		PublicAliases:      b.PublicAliases,
 	}
 }
 
 func (mg *Mongo) CreateBase(base internal.BaseConfig) (internal.BaseConfig, error) {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database("sbsys")
 
+	// the unique index on name makes the insert fail for a concurrent
+	// creation using the same name
+	idx := mongo.IndexModel{
+		Keys:    bson.M{"name": 1},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := db.Collection("bases").Indexes().CreateOne(ctx, idx); err != nil {
+		return base, err
+	}
+
 	lb := toLocalBase(base)
 	lb.ID = primitive.NewObjectID()
 
-	if _, err := db.Collection("bases").InsertOne(mg.Ctx, lb); err != nil {
+	if _, err := db.Collection("bases").InsertOne(ctx, lb); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return base, internal.ErrBaseNameTaken
+		}
+		return base, err
+	}
+
+	if err := mg.indexUserEmails(lb.Name); err != nil {
 		return base, err
 	}
 	return fromLocalBase(lb), nil
 }
 
 func (mg *Mongo) EmailExists(email string) (bool, error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database("sbsys")
 
-	count, err := db.Collection("accounts").CountDocuments(mg.Ctx, bson.M{"email": email})
+	count, err := db.Collection("accounts").CountDocuments(ctx, emailFilter(email))
 	if err != nil {
 		return false, err
 	}
@@ -111,6 +172,9 @@ func (mg *Mongo) EmailExists(email string) (bool, error) {
 }
 
 func (mg *Mongo) FindAccount(customerID string) (cus internal.Customer, err error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database("sbsys")
 
 	accountID, err := primitive.ObjectIDFromHex(customerID)
@@ -121,31 +185,64 @@ func (mg *Mongo) FindAccount(customerID string) (cus internal.Customer, err erro
 	var lc LocalCustomer
 
 	filter := bson.M{FieldID: accountID}
-	sr := db.Collection("accounts").FindOne(mg.Ctx, filter)
+	sr := db.Collection("accounts").FindOne(ctx, filter)
 	err = sr.Decode(&lc)
 	cus = fromLocalCustomer(lc)
 	return
 }
 
 func (mg *Mongo) FindDatabase(baseID string) (conf internal.BaseConfig, err error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database("sbsys")
 
 	id, err := primitive.ObjectIDFromHex(baseID)
 	if err != nil {
-		return
+		return conf, internal.ErrBaseNotFound
 	}
 
 	var lb LocalBase
-	sr := db.Collection("bases").FindOne(mg.Ctx, bson.M{FieldID: id})
-	err = sr.Decode(&lb)
+	sr := db.Collection("bases").FindOne(ctx, bson.M{FieldID: id})
+	if err = sr.Decode(&lb); errors.Is(err, mongo.ErrNoDocuments) {
+		return conf, internal.ErrBaseNotFound
+	}
+	conf = fromLocalBase(lb)
+	return
+}
+
+func (mg *Mongo) FindDatabaseByKey(key string) (conf internal.BaseConfig, err error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database("sbsys")
+
+	or := bson.A{
+		bson.M{"pk": key},
+		bson.M{"prevPk": key, "prevPkExp": bson.M{"$gt": time.Now()}},
+	}
+	if id, err := primitive.ObjectIDFromHex(key); err == nil {
+		or = append(or, bson.M{FieldID: id, "pk": bson.M{"$in": bson.A{"", nil}}})
+	}
+
+	var lb LocalBase
+	sr := db.Collection("bases").FindOne(ctx, bson.M{"$or": or})
+	if err = sr.Decode(&lb); errors.Is(err, mongo.ErrNoDocuments) {
+		return conf, internal.ErrBaseNotFound
+	} else if err != nil {
+		return
+	}
 	conf = fromLocalBase(lb)
 	return
 }
 
 func (mg *Mongo) DatabaseExists(name string) (bool, error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database("sbsys")
 
-	count, err := db.Collection("bases").CountDocuments(mg.Ctx, bson.M{"name": name})
+	count, err := db.Collection("bases").CountDocuments(ctx, bson.M{"name": name})
 	if err != nil {
 		return false, err
 	}
@@ -153,17 +250,20 @@ func (mg *Mongo) DatabaseExists(name string) (bool, error) {
 }
 
 func (mg *Mongo) ListDatabases() (results []internal.BaseConfig, err error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database("sbsys")
 
 	filter := bson.M{FieldIsActive: true}
 
-	cur, err := db.Collection("bases").Find(mg.Ctx, filter)
+	cur, err := db.Collection("bases").Find(ctx, filter)
 	if err != nil {
 		return
 	}
-	defer cur.Close(mg.Ctx)
+	defer cur.Close(ctx)
 
-	for cur.Next(mg.Ctx) {
+	for cur.Next(ctx) {
 		var lb LocalBase
 		if err = cur.Decode(&lb); err != nil {
 			return
@@ -179,10 +279,13 @@ func (mg *Mongo) ListDatabases() (results []internal.BaseConfig, err error) {
 }
 
 func (mg *Mongo) GetCustomerByStripeID(stripeID string) (cus internal.Customer, err error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database("sbsys")
 
 	var acct LocalCustomer
-	sr := db.Collection("accounts").FindOne(mg.Ctx, bson.M{"stripeId": stripeID})
+	sr := db.Collection("accounts").FindOne(ctx, bson.M{"stripeId": stripeID})
 	if err = sr.Decode(&acct); err != nil {
 		return
 	} else if err = sr.Err(); err != nil {
@@ -194,6 +297,9 @@ func (mg *Mongo) GetCustomerByStripeID(stripeID string) (cus internal.Customer,
 }
 
 func (mg *Mongo) IncrementMonthlyEmailSent(baseID string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database("sbsys")
 
 	id, err := primitive.ObjectIDFromHex(baseID)
@@ -203,13 +309,139 @@ func (mg *Mongo) IncrementMonthlyEmailSent(baseID string) error {
 
 	filter := bson.M{FieldID: id}
 	update := bson.M{"$inc": bson.M{"mes": 1}}
-	if _, err := db.Collection("bases").UpdateOne(mg.Ctx, filter, update); err != nil {
+	if _, err := db.Collection("bases").UpdateOne(ctx, filter, update); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mg *Mongo) SetUploadLimits(baseID string, types []string, maxSize int64) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database("sbsys")
+
+	id, err := primitive.ObjectIDFromHex(baseID)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{FieldID: id}
+	update := bson.M{"$set": bson.M{"uploadTypes": types, "uploadMax": maxSize}}
+	if _, err := db.Collection("bases").UpdateOne(ctx, filter, update); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mg *Mongo) SetSessionBinding(baseID, binding string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database("sbsys")
+
+	id, err := primitive.ObjectIDFromHex(baseID)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{FieldID: id}
+	update := bson.M{"$set": bson.M{"sessBind": binding}}
+	if _, err := db.Collection("bases").UpdateOne(ctx, filter, update); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mg *Mongo) SetFeatures(baseID string, features map[string]bool) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database("sbsys")
+
+	id, err := primitive.ObjectIDFromHex(baseID)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{FieldID: id}
+	update := bson.M{"$set": bson.M{"features": features}}
+	if _, err := db.Collection("bases").UpdateOne(ctx, filter, update); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mg *Mongo) SetPublicAliases(baseID string, aliases map[string]string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database("sbsys")
+
+	id, err := primitive.ObjectIDFromHex(baseID)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{FieldID: id}
+	update := bson.M{"$set": bson.M{"aliases": aliases}}
+	if _, err := db.Collection("bases").UpdateOne(ctx, filter, update); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mg *Mongo) RenameBase(baseID, displayName string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database("sbsys")
+
+	id, err := primitive.ObjectIDFromHex(baseID)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{FieldID: id}
+	update := bson.M{"$set": bson.M{"displayName": displayName}}
+	if _, err := db.Collection("bases").UpdateOne(ctx, filter, update); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mg *Mongo) RotatePublicKey(baseID, key string, previousExpires time.Time) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database("sbsys")
+
+	conf, err := mg.FindDatabase(baseID)
+	if err != nil {
+		return err
+	}
+
+	id, err := primitive.ObjectIDFromHex(baseID)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{FieldID: id}
+	update := bson.M{"$set": bson.M{
+		"pk":        key,
+		"prevPk":    conf.Key(),
+		"prevPkExp": previousExpires,
+	}}
+	if _, err := db.Collection("bases").UpdateOne(ctx, filter, update); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (mg *Mongo) ActivateCustomer(customerID string, active bool) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database("sbsys")
 
 	oid, err := primitive.ObjectIDFromHex(customerID)
@@ -220,17 +452,20 @@ func (mg *Mongo) ActivateCustomer(customerID string, active bool) error {
 	filter := bson.M{FieldID: oid}
 	update := bson.M{"$set": bson.M{"active": active}}
 
-	res := db.Collection("accounts").FindOneAndUpdate(mg.Ctx, filter, update)
+	res := db.Collection("accounts").FindOneAndUpdate(ctx, filter, update)
 	if err := res.Err(); err != nil {
 		return err
 	}
 
 	filter = bson.M{FieldAccountID: oid}
-	res = db.Collection("bases").FindOneAndUpdate(mg.Ctx, filter, update)
+	res = db.Collection("bases").FindOneAndUpdate(ctx, filter, update)
 	return res.Err()
 }
 
 func (mg *Mongo) ChangeCustomerPlan(customerID string, plan int) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database("sbsys")
 
 	oid, err := primitive.ObjectIDFromHex(customerID)
@@ -241,7 +476,7 @@ func (mg *Mongo) ChangeCustomerPlan(customerID string, plan int) error {
 	filter := bson.M{FieldID: oid}
 	update := bson.M{"$set": bson.M{"plan": plan}}
 
-	res := db.Collection("accounts").FindOneAndUpdate(mg.Ctx, filter, update)
+	res := db.Collection("accounts").FindOneAndUpdate(ctx, filter, update)
 	if err := res.Err(); err != nil {
 		return err
 	}
@@ -253,21 +488,24 @@ func (mg *Mongo) NewID() string {
 }
 
 func (mg *Mongo) DeleteCustomer(dbName, email string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
-	if err := db.Drop(mg.Ctx); err != nil {
+	if err := db.Drop(ctx); err != nil {
 		return err
 	}
 
 	db = mg.Client.Database("sbsys")
 
-	filter := bson.M{"email": email}
-	if _, err := db.Collection("accounts").DeleteMany(mg.Ctx, filter); err != nil {
+	filter := emailFilter(email)
+	if _, err := db.Collection("accounts").DeleteMany(ctx, filter); err != nil {
 		return err
 	}
 
 	filter = bson.M{"name": dbName}
-	if _, err := db.Collection("bases").DeleteMany(mg.Ctx, filter); err != nil {
+	if _, err := db.Collection("bases").DeleteMany(ctx, filter); err != nil {
 		return err
 	}
 
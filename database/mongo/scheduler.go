@@ -27,6 +27,9 @@ type LocalMetaMessage struct {
 }
 
 func (mg *Mongo) ListTasks() ([]internal.Task, error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	bases, err := mg.ListDatabases()
 	if err != nil {
 		return nil, err
@@ -39,15 +42,15 @@ func (mg *Mongo) ListTasks() ([]internal.Task, error) {
 
 	for _, base := range bases {
 		db := mg.Client.Database(base.Name)
-		cur, err := db.Collection("sb_tasks").Find(mg.Ctx, filter)
+		cur, err := db.Collection("sb_tasks").Find(ctx, filter)
 		if err != nil {
 			return nil, err
 		}
-		defer cur.Close(mg.Ctx)
+		defer cur.Close(ctx)
 
 		var tasks []internal.Task
 
-		for cur.Next(mg.Ctx) {
+		for cur.Next(ctx) {
 			var t LocalTask
 			if err := cur.Decode(&t); err != nil {
 				return nil, err
@@ -51,13 +51,16 @@ func fromLocalFile(lf LocalFile) internal.File {
 }
 
 func (mg *Mongo) AddFile(dbName string, f internal.File) (id string, err error) {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	f.ID = primitive.NewObjectID().Hex()
 
 	lf := toLocalFile(f)
 
-	res, err := db.Collection("sb_files").InsertOne(mg.Ctx, lf)
+	res, err := db.Collection("sb_files").InsertOne(ctx, lf)
 	if err != nil {
 		return
 	}
@@ -72,6 +75,9 @@ func (mg *Mongo) AddFile(dbName string, f internal.File) (id string, err error)
 }
 
 func (mg *Mongo) GetFileByID(dbName, fileID string) (f internal.File, err error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	oid, err := primitive.ObjectIDFromHex(fileID)
@@ -83,7 +89,7 @@ func (mg *Mongo) GetFileByID(dbName, fileID string) (f internal.File, err error)
 
 	filter := bson.M{FieldID: oid}
 
-	sr := db.Collection("sb_files").FindOne(mg.Ctx, filter)
+	sr := db.Collection("sb_files").FindOne(ctx, filter)
 	if err = sr.Decode(&result); err != nil {
 		return
 	} else if err = sr.Err(); err != nil {
@@ -95,6 +101,9 @@ func (mg *Mongo) GetFileByID(dbName, fileID string) (f internal.File, err error)
 }
 
 func (mg *Mongo) DeleteFile(dbName, fileID string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
 	db := mg.Client.Database(dbName)
 
 	oid, err := primitive.ObjectIDFromHex(fileID)
@@ -103,7 +112,7 @@ func (mg *Mongo) DeleteFile(dbName, fileID string) error {
 	}
 
 	filter := bson.M{FieldID: oid}
-	if _, err := db.Collection("sb_files").DeleteOne(mg.Ctx, filter); err != nil {
+	if _, err := db.Collection("sb_files").DeleteOne(ctx, filter); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,100 @@
+package mongo
+
+import (
+	"errors"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LocalWebhook struct {
+	ID         primitive.ObjectID `bson:"_id" json:"id"`
+	Collection string             `bson:"col" json:"col"`
+	Event      string             `bson:"ev" json:"event"`
+	URL        string             `bson:"url" json:"url"`
+	Secret     string             `bson:"secret" json:"-"`
+	Fields     []string           `bson:"fields" json:"fields"`
+	Created    time.Time          `bson:"created" json:"created"`
+}
+
+func fromLocalWebhook(lw LocalWebhook) internal.Webhook {
+	return internal.Webhook{
+		ID:         lw.ID.Hex(),
+		Collection: lw.Collection,
+		Event:      lw.Event,
+		URL:        lw.URL,
+		Secret:     lw.Secret,
+		Fields:     lw.Fields,
+		Created:    lw.Created,
+	}
+}
+
+func (mg *Mongo) AddWebhook(dbName string, wh internal.Webhook) (string, error) {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	lw := LocalWebhook{
+		ID:         primitive.NewObjectID(),
+		Collection: wh.Collection,
+		Event:      wh.Event,
+		URL:        wh.URL,
+		Secret:     wh.Secret,
+		Fields:     wh.Fields,
+		Created:    time.Now(),
+	}
+
+	if _, err := db.Collection("sb_webhooks").InsertOne(ctx, lw); err != nil {
+		return "", err
+	}
+	return lw.ID.Hex(), nil
+}
+
+func (mg *Mongo) ListWebhooks(dbName string) ([]internal.Webhook, error) {
+	ctx, cancel := internal.ReadContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	opt := options.Find().SetSort(bson.M{"created": 1})
+	cur, err := db.Collection("sb_webhooks").Find(ctx, bson.M{}, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var list []internal.Webhook
+	for cur.Next(ctx) {
+		var lw LocalWebhook
+		if err := cur.Decode(&lw); err != nil {
+			return nil, err
+		}
+		list = append(list, fromLocalWebhook(lw))
+	}
+	return list, cur.Err()
+}
+
+func (mg *Mongo) DeleteWebhook(dbName, id string) error {
+	ctx, cancel := internal.WriteContext(mg.Ctx)
+	defer cancel()
+
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	res, err := db.Collection("sb_webhooks").DeleteOne(ctx, bson.M{FieldID: oid})
+	if err != nil {
+		return err
+	} else if res.DeletedCount == 0 {
+		return errors.New("webhook not found")
+	}
+	return nil
+}
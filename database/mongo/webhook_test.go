@@ -0,0 +1,48 @@
+package mongo
+
+import (
+	"testing"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestWebhooks(t *testing.T) {
+	wh := internal.Webhook{
+		Collection: "wh_tasks",
+		Event:      internal.WebhookCreate,
+		URL:        "https://example.com/hook",
+		Secret:     "s3cret",
+		Fields:     []string{"title"},
+	}
+
+	id, err := datastore.AddWebhook(confDBName, wh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := datastore.ListWebhooks(confDBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found *internal.Webhook
+	for i := range list {
+		if list[i].ID == id {
+			found = &list[i]
+		}
+	}
+
+	if found == nil {
+		t.Fatalf("expected webhook %s to be listed", id)
+	} else if found.Collection != wh.Collection || found.Event != wh.Event || found.URL != wh.URL {
+		t.Errorf("expected %v got %v", wh, *found)
+	} else if found.Secret != wh.Secret || len(found.Fields) != 1 || found.Fields[0] != "title" {
+		t.Errorf("expected the secret and fields to be kept got %v", *found)
+	}
+
+	if err := datastore.DeleteWebhook(confDBName, id); err != nil {
+		t.Fatal(err)
+	} else if err := datastore.DeleteWebhook(confDBName, id); err == nil {
+		t.Errorf("expected an error deleting a removed webhook")
+	}
+}
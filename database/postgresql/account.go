@@ -1,58 +1,71 @@
 package postgresql
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/staticbackendhq/core/internal"
 )
 
 func (pg *PostgreSQL) FindToken(dbName, tokenID, token string) (tok internal.Token, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 	SELECT * 
 	FROM %s.sb_tokens
 	WHERE id = $1 AND token = $2
 `, dbName)
 
-	row := pg.DB.QueryRow(qry, tokenID, token)
+	row := pg.DB.QueryRowContext(ctx, qry, tokenID, token)
 
 	err = scanToken(row, &tok)
 	return
 }
 
 func (pg *PostgreSQL) FindRootToken(dbName, tokenID, accountID, token string) (tok internal.Token, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		SELECT * 
 		FROM %s.sb_tokens
 		WHERE id = $1 AND account_id = $2 AND token = $3
 `, dbName)
 
-	row := pg.DB.QueryRow(qry, tokenID, accountID, token)
+	row := pg.DB.QueryRowContext(ctx, qry, tokenID, accountID, token)
 
 	err = scanToken(row, &tok)
 	return
 }
 
 func (pg *PostgreSQL) GetRootForBase(dbName string) (tok internal.Token, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 	SELECT * 
 	FROM %s.sb_tokens
 	WHERE role = 100
 `, dbName)
 
-	row := pg.DB.QueryRow(qry)
+	row := pg.DB.QueryRowContext(ctx, qry)
 
 	err = scanToken(row, &tok)
 	return
 }
 
 func (pg *PostgreSQL) FindTokenByEmail(dbName, email string) (tok internal.Token, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 	SELECT * 
 	FROM %s.sb_tokens
-	WHERE email = $1
+	WHERE LOWER(email) = LOWER($1)
 `, dbName)
 
-	row := pg.DB.QueryRow(qry, email)
+	row := pg.DB.QueryRowContext(ctx, qry, email)
 
 	err = scanToken(row, &tok)
 	return
@@ -68,5 +81,6 @@ func scanToken(rows Scanner, tok *internal.Token) error {
 		&tok.Role,
 		&tok.ResetCode,
 		&tok.Created,
+		&tok.Label,
 	)
 }
@@ -1,18 +1,25 @@
 package postgresql
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/staticbackendhq/core/internal"
 )
 
 const (
 	FieldID        = "id"
 	FieldAccountID = "accountId"
+	FieldOwnerID   = "ownerId"
 	FieldFormName  = "sb_form"
 )
 
@@ -36,12 +43,86 @@ func (j *JSONB) Scan(value interface{}) error {
 		return errors.New("type assertion to []byte failed")
 	}
 
-	return json.Unmarshal(b, &j)
+	var m map[string]interface{}
+	if err := internal.DecodeJSON(bytes.NewReader(b), &m); err != nil {
+		return err
+	}
+
+	*j = m
+	return nil
 }
 
 func (pg *PostgreSQL) CreateDocument(auth internal.Auth, dbName, col string, doc map[string]interface{}) (inserted map[string]interface{}, err error) {
-	inserted = doc
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	if err = pg.ensureCollection(ctx, dbName, col); err != nil {
+		return
+	}
+
+	inserted, err = insertDocument(ctx, pg.DB, auth, dbName, col, doc)
+	if err != nil {
+		return
+	}
+
+	pg.PublishDocument("db-"+col, internal.MsgTypeDBCreated, inserted)
+
+	return
+}
+
+// CreateDocumentIfAbsent inserts doc unless a document of the collection
+// readable by auth matches filters. The conditional creates of a collection are serialized
+// with a transaction-level advisory lock so only one of concurrent creates
+// with the same filter inserts.
+func (pg *PostgreSQL) CreateDocumentIfAbsent(auth internal.Auth, dbName, col string, filters map[string]interface{}, doc map[string]interface{}) (map[string]interface{}, bool, error) {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	if err := pg.ensureCollection(ctx, dbName, col); err != nil {
+		return nil, false, err
+	}
+
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	lock := fmt.Sprintf("%s.%s", dbName, internal.CleanCollectionName(col))
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", lock); err != nil {
+		return nil, false, err
+	}
+
+	qry := fmt.Sprintf(`
+		SELECT * 
+		FROM %s.%s 
+		%s
+		LIMIT 1
+	`, dbName, internal.CleanCollectionName(col), applyFilter(secureRead(auth, col), filters))
+
+	var existing Document
+	err = scanDocument(tx.QueryRowContext(ctx, qry, auth.AccountID, auth.UserID), &existing)
+	if err == nil {
+		existing.Data[FieldID] = existing.ID
+		existing.Data[FieldAccountID] = existing.AccountID
+		return existing.Data, false, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, err
+	}
+
+	inserted, err := insertDocument(ctx, tx, auth, dbName, col, doc)
+	if err != nil {
+		return nil, false, err
+	} else if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+
+	pg.PublishDocument("db-"+col, internal.MsgTypeDBCreated, inserted)
+	return inserted, true, nil
+}
 
+// ensureCollection creates the table of a collection on its first document.
+func (pg *PostgreSQL) ensureCollection(ctx context.Context, dbName, col string) error {
 	cleancol := internal.CleanCollectionName(col)
 
 	//TODO: find a good way to prevent doing the create
@@ -59,13 +140,23 @@ func (pg *PostgreSQL) CreateDocument(auth internal.Auth, dbName, col string, doc
 		CREATE INDEX IF NOT EXISTS %s_acctid_idx ON %s.%s (account_id);			
 	`, dbName, cleancol, dbName, dbName, cleancol, dbName, cleancol)
 
-	if _, err = pg.DB.Exec(qry); err != nil {
-		return
-	}
+	_, err := pg.DB.ExecContext(ctx, qry)
+	return err
+}
+
+// rowQuerier is a *sql.DB or a *sql.Tx.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
 
+func insertDocument(ctx context.Context, db rowQuerier, auth internal.Auth, dbName, col string, doc map[string]interface{}) (map[string]interface{}, error) {
 	var id string
 
-	qry = fmt.Sprintf(`
+	// the owner is the authenticated user, never the client-supplied one
+	removeOwnerFields(doc)
+	internal.Touch(doc)
+
+	qry := fmt.Sprintf(`
 		INSERT INTO %s.%s(account_id, owner_id, data, created)
 		VALUES($1, $2, $3, $4)
 		RETURNING id;
@@ -73,17 +164,16 @@ func (pg *PostgreSQL) CreateDocument(auth internal.Auth, dbName, col string, doc
 
 	b, err := json.Marshal(doc)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	err = pg.DB.QueryRow(qry, auth.AccountID, auth.UserID, b, time.Now()).Scan(&id)
-
-	inserted[FieldID] = id
-	inserted[FieldAccountID] = auth.AccountID
-
-	pg.PublishDocument("db-"+col, internal.MsgTypeDBCreated, inserted)
+	if err := db.QueryRowContext(ctx, qry, auth.AccountID, auth.UserID, b, time.Now()).Scan(&id); err != nil {
+		return nil, duplicateValue(err, col)
+	}
 
-	return
+	doc[FieldID] = id
+	doc[FieldAccountID] = auth.AccountID
+	return doc, nil
 }
 
 func (pg *PostgreSQL) BulkCreateDocument(auth internal.Auth, dbName, col string, docs []interface{}) error {
@@ -103,31 +193,38 @@ func (pg *PostgreSQL) BulkCreateDocument(auth internal.Auth, dbName, col string,
 }
 
 func (pg *PostgreSQL) ListDocuments(auth internal.Auth, dbName, col string, params internal.ListParams) (result internal.PagedResult, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	where := secureRead(auth, col)
 
-	paging := setPaging(params)
+	paging, err := setPaging(params)
+	if err != nil {
+		return
+	}
+
+	columns, err := selectColumns(params.Fields)
+	if err != nil {
+		return
+	}
 
 	result.Page = params.Page
 	result.Size = params.Size
 
-	qry := fmt.Sprintf(`
-		SELECT COUNT(*) 
-		FROM %s.%s 
-		%s
-	`, dbName, internal.CleanCollectionName(col), where)
-
-	if err = pg.DB.QueryRow(qry, auth.AccountID, auth.UserID).Scan(&result.Total); err != nil {
+	if params.SkipCount {
+		result.CountSkipped = true
+	} else if err = pg.countDocuments(auth, dbName, col, where, &result.Total); err != nil {
 		return
 	}
 
-	qry = fmt.Sprintf(`
-		SELECT * 
+	qry := fmt.Sprintf(`
+		SELECT %s 
 		FROM %s.%s 
 		%s
 		%s
-	`, dbName, internal.CleanCollectionName(col), where, paging)
+	`, columns, dbName, internal.CleanCollectionName(col), where, paging)
 
-	rows, err := pg.DB.Query(qry, auth.AccountID, auth.UserID)
+	rows, err := pg.DB.QueryContext(ctx, qry, auth.AccountID, auth.UserID)
 	if err != nil {
 		fmt.Println("error in select")
 		fmt.Println(qry)
@@ -142,7 +239,11 @@ func (pg *PostgreSQL) ListDocuments(auth internal.Auth, dbName, col string, para
 		}
 
 		doc.Data[FieldID] = doc.ID
-		doc.Data[FieldAccountID] = doc.AccountID
+		if len(params.Fields) == 0 {
+			doc.Data[FieldAccountID] = doc.AccountID
+		} else {
+			nestFields(doc.Data)
+		}
 
 		result.Results = append(result.Results, doc.Data)
 	}
@@ -152,32 +253,39 @@ func (pg *PostgreSQL) ListDocuments(auth internal.Auth, dbName, col string, para
 }
 
 func (pg *PostgreSQL) QueryDocuments(auth internal.Auth, dbName, col string, filters map[string]interface{}, params internal.ListParams) (result internal.PagedResult, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	where := secureRead(auth, col)
 	where = applyFilter(where, filters)
 
-	paging := setPaging(params)
+	paging, err := setPaging(params)
+	if err != nil {
+		return
+	}
+
+	columns, err := selectColumns(params.Fields)
+	if err != nil {
+		return
+	}
 
 	result.Page = params.Page
 	result.Size = params.Size
 
-	qry := fmt.Sprintf(`
-		SELECT COUNT(*) 
-		FROM %s.%s 
-		%s
-	`, dbName, internal.CleanCollectionName(col), where)
-
-	if err = pg.DB.QueryRow(qry, auth.AccountID, auth.UserID).Scan(&result.Total); err != nil {
+	if params.SkipCount {
+		result.CountSkipped = true
+	} else if err = pg.countDocuments(auth, dbName, col, where, &result.Total); err != nil {
 		return
 	}
 
-	qry = fmt.Sprintf(`
-		SELECT * 
+	qry := fmt.Sprintf(`
+		SELECT %s 
 		FROM %s.%s 
 		%s
 		%s
-	`, dbName, internal.CleanCollectionName(col), where, paging)
+	`, columns, dbName, internal.CleanCollectionName(col), where, paging)
 
-	rows, err := pg.DB.Query(qry, auth.AccountID, auth.UserID)
+	rows, err := pg.DB.QueryContext(ctx, qry, auth.AccountID, auth.UserID)
 	if err != nil {
 		return
 	}
@@ -190,7 +298,11 @@ func (pg *PostgreSQL) QueryDocuments(auth internal.Auth, dbName, col string, fil
 		}
 
 		doc.Data[FieldID] = doc.ID
-		doc.Data[FieldAccountID] = doc.AccountID
+		if len(params.Fields) == 0 {
+			doc.Data[FieldAccountID] = doc.AccountID
+		} else {
+			nestFields(doc.Data)
+		}
 
 		result.Results = append(result.Results, doc.Data)
 	}
@@ -199,7 +311,51 @@ func (pg *PostgreSQL) QueryDocuments(auth internal.Auth, dbName, col string, fil
 	return
 }
 
+// ExplainQuery returns the PostgreSQL plan of the QueryDocuments query,
+// it's not executed.
+func (pg *PostgreSQL) ExplainQuery(auth internal.Auth, dbName, col string, filters map[string]interface{}, params internal.ListParams) (map[string]interface{}, error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
+	where := secureRead(auth, col)
+	where = applyFilter(where, filters)
+
+	paging, err := setPaging(params)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := selectColumns(params.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	qry := fmt.Sprintf(`
+		EXPLAIN (FORMAT JSON)
+		SELECT %s 
+		FROM %s.%s 
+		%s
+		%s
+	`, columns, dbName, internal.CleanCollectionName(col), where, paging)
+
+	var b []byte
+	if err := pg.DB.QueryRowContext(ctx, qry, auth.AccountID, auth.UserID).Scan(&b); err != nil {
+		return nil, err
+	}
+
+	var plans []map[string]interface{}
+	if err := json.Unmarshal(b, &plans); err != nil {
+		return nil, err
+	} else if len(plans) == 0 {
+		return nil, errors.New("no query plan returned")
+	}
+	return plans[0], nil
+}
+
 func (pg *PostgreSQL) GetDocumentByID(auth internal.Auth, dbName, col, id string) (map[string]interface{}, error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	where := secureRead(auth, col)
 
 	qry := fmt.Sprintf(`
@@ -208,7 +364,7 @@ func (pg *PostgreSQL) GetDocumentByID(auth internal.Auth, dbName, col, id string
 		%s AND id = $3
 	`, dbName, internal.CleanCollectionName(col), where)
 
-	row := pg.DB.QueryRow(qry, auth.AccountID, auth.UserID, id)
+	row := pg.DB.QueryRowContext(ctx, qry, auth.AccountID, auth.UserID, id)
 
 	var doc Document
 	if err := scanDocument(row, &doc); err != nil {
@@ -221,24 +377,76 @@ func (pg *PostgreSQL) GetDocumentByID(auth internal.Auth, dbName, col, id string
 	return doc.Data, nil
 }
 
-func (pg *PostgreSQL) UpdateDocument(auth internal.Auth, dbName, col, id string, doc map[string]interface{}) (map[string]interface{}, error) {
-	where := secureWrite(auth, col)
+func (pg *PostgreSQL) GetDocumentsByIDs(auth internal.Auth, dbName, col string, ids []string) ([]map[string]interface{}, error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
+	// an invalid id cannot match a document and would fail the uuid cast
+	var valid []string
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err == nil {
+			valid = append(valid, id)
+		}
+	}
+
+	if len(valid) == 0 {
+		return nil, nil
+	}
+
+	where := secureRead(auth, col)
 
 	qry := fmt.Sprintf(`
-		UPDATE %s.%s SET
-			data = data || $4
-		%s AND id = $3
+		SELECT * 
+		FROM %s.%s 
+		%s AND id = ANY($3::uuid[])
 	`, dbName, internal.CleanCollectionName(col), where)
 
-	b, err := json.Marshal(doc)
+	rows, err := pg.DB.QueryContext(ctx, qry, auth.AccountID, auth.UserID, pq.Array(valid))
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	var docs []map[string]interface{}
+	for rows.Next() {
+		var doc Document
+		if err := scanDocument(rows, &doc); err != nil {
+			return nil, err
+		}
 
-	if _, err := pg.DB.Exec(qry, auth.AccountID, auth.UserID, id, b); err != nil {
+		doc.Data[FieldID] = doc.ID
+		doc.Data[FieldAccountID] = doc.AccountID
+
+		docs = append(docs, doc.Data)
+	}
+	return docs, rows.Err()
+}
+
+func (pg *PostgreSQL) UpdateDocument(auth internal.Auth, dbName, col, id string, doc map[string]interface{}) (map[string]interface{}, error) {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	where := secureWrite(auth, col)
+
+	removeOwnerFields(doc)
+	internal.Touch(doc)
+
+	data, values, err := updateData(doc, 4)
+	if err != nil {
 		return nil, err
 	}
 
+	qry := fmt.Sprintf(`
+		UPDATE %s.%s SET
+			data = %s
+		%s AND id = $3
+	`, dbName, internal.CleanCollectionName(col), data, where)
+
+	args := append([]interface{}{auth.AccountID, auth.UserID, id}, values...)
+	if _, err := pg.DB.ExecContext(ctx, qry, args...); err != nil {
+		return nil, duplicateValue(err, col)
+	}
+
 	updated, err := pg.GetDocumentByID(auth, dbName, col, id)
 	if err != nil {
 		return nil, err
@@ -249,16 +457,111 @@ func (pg *PostgreSQL) UpdateDocument(auth internal.Auth, dbName, col, id string,
 	return updated, nil
 }
 
+func (pg *PostgreSQL) ReplaceDocument(auth internal.Auth, dbName, col, id string, doc map[string]interface{}) (map[string]interface{}, error) {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	where := secureWrite(auth, col)
+
+	removeOwnerFields(doc)
+	internal.Touch(doc)
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	qry := fmt.Sprintf(`
+		UPDATE %s.%s SET
+			data = $4
+		%s AND id = $3
+	`, dbName, internal.CleanCollectionName(col), where)
+
+	if _, err := pg.DB.ExecContext(ctx, qry, auth.AccountID, auth.UserID, id, b); err != nil {
+		return nil, duplicateValue(err, col)
+	}
+
+	replaced, err := pg.GetDocumentByID(auth, dbName, col, id)
+	if err != nil {
+		return nil, err
+	}
+
+	pg.PublishDocument("db-"+col, internal.MsgTypeDBUpdated, replaced)
+
+	return replaced, nil
+}
+
+func (pg *PostgreSQL) UpdateByFilter(auth internal.Auth, dbName, col string, filters map[string]interface{}, doc map[string]interface{}) (int64, error) {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	where := secureWrite(auth, col)
+	where = applyFilter(where, filters)
+
+	removeOwnerFields(doc)
+	internal.Touch(doc)
+
+	data, values, err := updateData(doc, 3)
+	if err != nil {
+		return 0, err
+	}
+
+	qry := fmt.Sprintf(`
+		UPDATE %s.%s SET
+			data = %s
+		%s
+		RETURNING *
+	`, dbName, internal.CleanCollectionName(col), data, where)
+
+	args := append([]interface{}{auth.AccountID, auth.UserID}, values...)
+	rows, err := pg.DB.QueryContext(ctx, qry, args...)
+	if err != nil {
+		return 0, duplicateValue(err, col)
+	}
+	defer rows.Close()
+
+	var updated []map[string]interface{}
+	for rows.Next() {
+		var doc Document
+		if err := scanDocument(rows, &doc); err != nil {
+			return 0, err
+		}
+
+		doc.Data[FieldID] = doc.ID
+		doc.Data[FieldAccountID] = doc.AccountID
+		updated = append(updated, doc.Data)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, duplicateValue(err, col)
+	}
+
+	for _, doc := range updated {
+		pg.PublishDocument("db-"+col, internal.MsgTypeDBUpdated, doc)
+	}
+	return int64(len(updated)), nil
+}
+
 func (pg *PostgreSQL) IncrementValue(auth internal.Auth, dbName, col, id, field string, n int) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
 	where := secureWrite(auth, col)
 
 	qry := fmt.Sprintf(`
 		UPDATE %s.%s SET
-		data = jsonb_set(data, '{%s}', (COALESCE(data->>'%s','0')::int + $4)::text::jsonb)
+		data = jsonb_set(data, '{%s}', (COALESCE(data->>'%s','0')::int + $4)::text::jsonb) || $5
 		%s AND id = $3
 	`, dbName, internal.CleanCollectionName(col), field, field, where)
 
-	if _, err := pg.DB.Exec(qry, auth.AccountID, auth.UserID, id, n); err != nil {
+	touched := make(map[string]interface{})
+	internal.Touch(touched)
+
+	b, err := json.Marshal(touched)
+	if err != nil {
+		return err
+	}
+
+	if _, err := pg.DB.ExecContext(ctx, qry, auth.AccountID, auth.UserID, id, n, b); err != nil {
 		return err
 	}
 
@@ -273,6 +576,9 @@ func (pg *PostgreSQL) IncrementValue(auth internal.Auth, dbName, col, id, field
 }
 
 func (pg *PostgreSQL) DeleteDocument(auth internal.Auth, dbName, col, id string) (int64, error) {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
 	where := secureWrite(auth, col)
 
 	qry := fmt.Sprintf(`
@@ -281,7 +587,7 @@ func (pg *PostgreSQL) DeleteDocument(auth internal.Auth, dbName, col, id string)
 		%s AND id = $3
 	`, dbName, internal.CleanCollectionName(col), where)
 
-	res, err := pg.DB.Exec(qry, auth.AccountID, auth.UserID, id)
+	res, err := pg.DB.ExecContext(ctx, qry, auth.AccountID, auth.UserID, id)
 	if err != nil {
 		return 0, err
 	}
@@ -290,12 +596,91 @@ func (pg *PostgreSQL) DeleteDocument(auth internal.Auth, dbName, col, id string)
 	return res.RowsAffected()
 }
 
+func (pg *PostgreSQL) DeleteByFilter(auth internal.Auth, dbName, col string, filters map[string]interface{}) (int64, error) {
+	where := secureWrite(auth, col)
+	where = applyFilter(where, filters)
+
+	return pg.deleteWhere(dbName, col, where, auth.AccountID, auth.UserID)
+}
+
+func (pg *PostgreSQL) DeleteExpired(dbName, col, field string, before time.Time) (int64, error) {
+	expires, err := dataField(field, true)
+	if err != nil {
+		return 0, err
+	}
+
+	// the expiry field is stored in UTC with a fixed layout, see normalizeExpiry
+	// of the server, so it compares as a string
+	where := fmt.Sprintf("WHERE %s <= $1", expires)
+	return pg.deleteWhere(dbName, col, where, before.UTC().Format(time.RFC3339))
+}
+
+// deleteWhere deletes the documents of col matching where and publishes
+// a deleted event for each of them.
+func (pg *PostgreSQL) deleteWhere(dbName, col, where string, args ...interface{}) (int64, error) {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	qry := fmt.Sprintf(`
+		DELETE 
+		FROM %s 
+		%s
+		RETURNING id
+	`, quotedTable(dbName, col), where)
+
+	rows, err := pg.DB.QueryContext(ctx, qry, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		pg.PublishDocument("db-"+col, internal.MsgTypeDBDeleted, id)
+	}
+	return int64(len(ids)), nil
+}
+
+func (pg *PostgreSQL) TruncateCollection(dbName, col string) (int64, error) {
+	return pg.deleteWhere(dbName, col, "")
+}
+
+// quotedTable returns the quoted schema and table of col. The tables are
+// created with unquoted names which are folded to lower case.
+func quotedTable(dbName, col string) string {
+	return pq.QuoteIdentifier(strings.ToLower(dbName)) + "." + pq.QuoteIdentifier(strings.ToLower(internal.CleanCollectionName(col)))
+}
+
+func (pg *PostgreSQL) DropCollection(dbName, col string) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	qry := fmt.Sprintf(`DROP TABLE IF EXISTS %s`, quotedTable(dbName, col))
+
+	_, err := pg.DB.ExecContext(ctx, qry)
+	return err
+}
+
 func (pg *PostgreSQL) ListCollections(dbName string) (results []string, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		SELECT table_name FROM information_schema.tables WHERE table_schema='%s'
 	`, dbName)
 
-	rows, err := pg.DB.Query(qry)
+	rows, err := pg.DB.QueryContext(ctx, qry)
 	if err != nil {
 		return
 	}
@@ -314,6 +699,82 @@ func (pg *PostgreSQL) ListCollections(dbName string) (results []string, err erro
 	return
 }
 
+// Stats counts the rows of the tables of the base, the sizes are the ones
+// of pg_table_size and pg_indexes_size.
+func (pg *PostgreSQL) Stats(dbName string) (stats internal.BaseStats, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
+	rows, err := pg.DB.QueryContext(ctx, `
+		SELECT c.relname, pg_table_size(c.oid), pg_indexes_size(c.oid)
+		FROM pg_catalog.pg_class c
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relkind = 'r'
+		ORDER BY c.relname
+	`, dbName)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	var cols []internal.CollectionStats
+	for rows.Next() {
+		var cs internal.CollectionStats
+		if err = rows.Scan(&cs.Name, &cs.Bytes, &cs.IndexBytes); err != nil {
+			return
+		}
+		cols = append(cols, cs)
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	for _, cs := range cols {
+		qry := fmt.Sprintf(`SELECT COUNT(*) FROM %s.%s`, dbName, cs.Name)
+		if err = pg.DB.QueryRowContext(ctx, qry).Scan(&cs.Documents); err != nil {
+			return
+		}
+		stats.Add(cs)
+	}
+	return
+}
+
+func (pg *PostgreSQL) countDocuments(auth internal.Auth, dbName, col, where string, total *int64) error {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
+	qry := fmt.Sprintf(`
+		SELECT COUNT(*) 
+		FROM %s.%s 
+		%s
+	`, dbName, internal.CleanCollectionName(col), where)
+
+	return pg.DB.QueryRowContext(ctx, qry, auth.AccountID, auth.UserID).Scan(total)
+}
+
+// duplicateValue returns a DuplicateValueError when err is a unique index
+// violation, the field is taken from the index name.
+func duplicateValue(err error, col string) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "23505" {
+		return err
+	}
+
+	prefix := indexName(col, "")
+	if !strings.HasPrefix(pqErr.Constraint, prefix) {
+		return err
+	}
+	return &internal.DuplicateValueError{Field: strings.TrimPrefix(pqErr.Constraint, prefix)}
+}
+
+// removeOwnerFields deletes the fields stored in their own columns, a
+// client cannot set them in the data.
+func removeOwnerFields(doc map[string]interface{}) {
+	delete(doc, FieldID)
+	delete(doc, FieldAccountID)
+	delete(doc, FieldOwnerID)
+}
+
 func scanDocument(rows Scanner, doc *Document) error {
 	return rows.Scan(
 		&doc.ID,
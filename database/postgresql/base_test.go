@@ -3,6 +3,8 @@ package postgresql
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -88,7 +90,7 @@ func TestListDocuments(t *testing.T) {
 
 	insertedTask := dec(inserted)
 
-	lp := internal.ListParams{Page: 1, Size: 25, SortDescending: true}
+	lp := internal.ListParams{Page: 1, Size: 25, Sort: []internal.SortField{{Field: "id", Descending: true}}}
 
 	result, err := datastore.ListDocuments(adminAuth, confDBName, colName, lp)
 	if err != nil {
@@ -147,6 +149,302 @@ func TestQueryDocuments(t *testing.T) {
 	}
 }
 
+func TestQueryInAndContains(t *testing.T) {
+	col := "filtered_tasks"
+
+	var many []interface{}
+	for _, title := range []string{"write docs", "fix bug", "review 100%"} {
+		many = append(many, newTask(title, false))
+	}
+	if err := datastore.BulkCreateDocument(adminAuth, confDBName, col, many); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		clause   []interface{}
+		expected int64
+	}{
+		{[]interface{}{"title", "in", []interface{}{"fix bug", "write docs", "unknown"}}, 2},
+		{[]interface{}{"title", "contains", "docs"}, 1},
+		{[]interface{}{"title", "contains", "100%"}, 1},
+		{[]interface{}{"title", "contains", "%"}, 1},
+		{[]interface{}{"title", "contains", "' OR '1'='1"}, 0},
+	}
+	for _, tc := range tests {
+		filter, err := datastore.ParseQuery([][]interface{}{tc.clause})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := datastore.QueryDocuments(adminAuth, confDBName, col, filter, internal.ListParams{Page: 1, Size: 10})
+		if err != nil {
+			t.Fatal(err)
+		} else if result.Total != tc.expected {
+			t.Errorf("%v: expected %d documents got %d", tc.clause, tc.expected, result.Total)
+		}
+	}
+}
+
+func TestQueryInvalidField(t *testing.T) {
+	near := map[string]interface{}{"lat": 45.5, "lng": -73.5, "radius": 1000}
+	box := map[string]interface{}{"minLat": 45, "minLng": -74, "maxLat": 46, "maxLng": -73}
+
+	tests := []struct {
+		op    string
+		value interface{}
+	}{
+		{"=", "x"},
+		{">", 1},
+		{"in", []interface{}{"x"}},
+		{"contains", "x"},
+		{"near", near},
+		{"within", box},
+	}
+
+	for _, field := range []string{"x' OR '1'='1", "address.city' OR '1'='1", "a}' OR '1'='1"} {
+		for _, tc := range tests {
+			clauses := [][]interface{}{{field, tc.op, tc.value}}
+			if _, err := datastore.ParseQuery(clauses); err == nil {
+				t.Errorf("%s: expected field %q to be rejected", tc.op, field)
+			}
+		}
+	}
+
+	// the removed documents would escape the account scoping
+	task := newTask("scoped", false)
+	if _, err := datastore.CreateDocument(adminAuth, confDBName, colName, task); err != nil {
+		t.Fatal(err)
+	}
+
+	filters, err := datastore.ParseQuery([][]interface{}{{"title", "=", "nothing' OR '1'='1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := datastore.DeleteByFilter(adminAuth, confDBName, colName, filters)
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Errorf("expected the quoted value to match nothing got %d deleted", n)
+	}
+}
+
+func TestListDocumentsSort(t *testing.T) {
+	col := "sorted_tasks"
+
+	tasks := []Task{
+		{Title: "b", Likes: 1},
+		{Title: "a", Likes: 2},
+		{Title: "a", Likes: 1},
+	}
+	for _, task := range tasks {
+		if _, err := datastore.CreateDocument(adminAuth, confDBName, col, enc(task)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		spec     string
+		expected []string
+	}{
+		{"title", []string{"a:2", "a:1", "b:1"}},
+		{"-title", []string{"b:1", "a:1", "a:2"}},
+		{"title,-likes", []string{"a:2", "a:1", "b:1"}},
+		{"likes,-title", []string{"b:1", "a:1", "a:2"}},
+	}
+
+	for _, tc := range tests {
+		sort, err := internal.ParseSort(tc.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lp := internal.ListParams{Page: 1, Size: 25, Sort: sort}
+
+		result, err := datastore.ListDocuments(adminAuth, confDBName, col, lp)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(result.Results) != len(tc.expected) {
+			t.Fatalf("%s: expected %d results got %d", tc.spec, len(tc.expected), len(result.Results))
+		}
+
+		for i, res := range result.Results {
+			task := dec(res)
+			if got := fmt.Sprintf("%s:%d", task.Title, task.Likes); got != tc.expected[i] {
+				t.Errorf("%s: expected %s at position %d got %s", tc.spec, tc.expected[i], i, got)
+			}
+		}
+	}
+}
+
+func TestQueryDocumentsFields(t *testing.T) {
+	task := newTask("projected", true)
+	if _, err := datastore.CreateDocument(adminAuth, confDBName, colName, task); err != nil {
+		t.Fatal(err)
+	}
+
+	clauses := [][]interface{}{{"title", "=", "projected"}}
+	filters, err := datastore.ParseQuery(clauses)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lp := internal.ListParams{Page: 1, Size: 5, Fields: []string{"title", "done"}}
+
+	result, err := datastore.QueryDocuments(adminAuth, confDBName, colName, filters, lp)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(result.Results) != 1 {
+		t.Fatalf("expected 1 result got %d", len(result.Results))
+	}
+
+	doc := result.Results[0]
+	if len(doc) != 3 {
+		t.Errorf("expected only id, title and done got %v", doc)
+	} else if _, ok := doc["id"]; !ok {
+		t.Errorf("expected id to always be returned got %v", doc)
+	} else if doc["title"] != "projected" || doc["done"] != true {
+		t.Errorf("unexpected projected values %v", doc)
+	}
+}
+
+func TestQueryDocumentsSkipCount(t *testing.T) {
+	task := newTask("skip count", false)
+	if _, err := datastore.CreateDocument(adminAuth, confDBName, colName, task); err != nil {
+		t.Fatal(err)
+	}
+
+	clauses := [][]interface{}{{"title", "=", "skip count"}}
+	filters, err := datastore.ParseQuery(clauses)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lp := internal.ListParams{Page: 1, Size: 5, SkipCount: true}
+
+	result, err := datastore.QueryDocuments(adminAuth, confDBName, colName, filters, lp)
+	if err != nil {
+		t.Fatal(err)
+	} else if !result.CountSkipped {
+		t.Errorf("expected count to be skipped")
+	} else if result.Total != 0 {
+		t.Errorf("expected total to be 0 got %d", result.Total)
+	} else if len(result.Results) != 1 {
+		t.Errorf("expected 1 result got %d", len(result.Results))
+	}
+}
+
+func TestExplainQuery(t *testing.T) {
+	task := newTask("explain", false)
+	if _, err := datastore.CreateDocument(adminAuth, confDBName, colName, task); err != nil {
+		t.Fatal(err)
+	}
+
+	filters, err := datastore.ParseQuery([][]interface{}{{"title", "=", "explain"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lp := internal.ListParams{Page: 1, Size: 5}
+
+	plan, err := datastore.ExplainQuery(adminAuth, confDBName, colName, filters, lp)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(plan) == 0 {
+		t.Errorf("expected a query plan got %v", plan)
+	}
+}
+
+func TestStats(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		if _, err := datastore.CreateDocument(adminAuth, confDBName, "stats_fixture", newTask("stats", false)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := datastore.Stats(confDBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs, ok := stats.Collection("stats_fixture")
+	if !ok {
+		t.Fatalf("expected the fixture collection in %v", stats.Collections)
+	} else if cs.Documents != 3 {
+		t.Errorf("expected 3 documents got %d", cs.Documents)
+	} else if cs.Bytes <= 0 {
+		t.Errorf("expected the collection size got %d", cs.Bytes)
+	}
+
+	if stats.Documents < cs.Documents || stats.Bytes < cs.Bytes {
+		t.Errorf("expected the totals to include the collection got %+v", stats)
+	}
+}
+
+func TestCreateDocumentIfAbsentConcurrent(t *testing.T) {
+	filter, err := datastore.ParseQuery([][]interface{}{{"username", "=", "taken"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			doc := map[string]interface{}{"username": "taken", "attempt": i}
+			_, ok, err := datastore.CreateDocumentIfAbsent(adminAuth, confDBName, "claims", filter, doc)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if ok {
+				created++
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Fatalf("expected exactly one conditional create to win got %d", created)
+	}
+
+	existing, ok, err := datastore.CreateDocumentIfAbsent(adminAuth, confDBName, "claims", filter, map[string]interface{}{"username": "taken"})
+	if err != nil {
+		t.Fatal(err)
+	} else if ok {
+		t.Errorf("expected the document not to be created again")
+	} else if existing["username"] != "taken" || existing[FieldID] == nil {
+		t.Errorf("expected the existing document got %v", existing)
+	}
+}
+
+func TestCreateDocumentIfAbsentScoped(t *testing.T) {
+	col := "scopedclaims"
+	if _, err := datastore.CreateDocument(adminAuth, confDBName, col, map[string]interface{}{"code": "private"}); err != nil {
+		t.Fatal(err)
+	}
+
+	filter, err := datastore.ParseQuery([][]interface{}{{"code", "=", "private"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the documents of another account are not matched, the insert fails
+	// since the account does not exist
+	other := internal.Auth{AccountID: datastore.NewID(), UserID: datastore.NewID()}
+	if existing, ok, err := datastore.CreateDocumentIfAbsent(other, confDBName, col, filter, map[string]interface{}{"code": "private"}); err == nil && !ok {
+		t.Errorf("expected the document of another account not to be matched got %v", existing)
+	}
+}
+
 func TestGetDocumentByID(t *testing.T) {
 	task1 := newTask("getbyid", false)
 
@@ -168,6 +466,33 @@ func TestGetDocumentByID(t *testing.T) {
 	}
 }
 
+func TestGetDocumentsByIDs(t *testing.T) {
+	var ids []string
+	for _, title := range []string{"byids1", "byids2"} {
+		m, err := datastore.CreateDocument(adminAuth, confDBName, colName, newTask(title, false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, dec(m).ID)
+	}
+
+	// the missing and invalid ids are omitted
+	docs, err := datastore.GetDocumentsByIDs(adminAuth, confDBName, colName, append(ids, datastore.NewID(), "invalid"))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(docs) != 2 {
+		t.Fatalf("expected 2 documents got %d", len(docs))
+	}
+
+	found := make(map[string]bool)
+	for _, doc := range docs {
+		found[dec(doc).ID] = true
+	}
+	if !found[ids[0]] || !found[ids[1]] {
+		t.Errorf("expected the documents %v got %v", ids, found)
+	}
+}
+
 func TestUpdateDocument(t *testing.T) {
 	task1 := newTask("inserted", false)
 
@@ -265,3 +590,373 @@ func TestListCollections(t *testing.T) {
 		t.Errorf("expected to have at least one collection got %d", len(results))
 	}
 }
+
+func TestCreateDocumentForgedOwner(t *testing.T) {
+	task1 := newTask("forged", false)
+	task1["accountId"] = "forged-account"
+	task1["ownerId"] = "forged-owner"
+
+	m, err := datastore.CreateDocument(adminAuth, confDBName, colName, task1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := fmt.Sprintf("%v", m["id"])
+
+	assertOwner := func(doc map[string]interface{}) {
+		t.Helper()
+
+		if doc["accountId"] != adminAuth.AccountID {
+			t.Errorf("expected accountId %s got %v", adminAuth.AccountID, doc["accountId"])
+		}
+		if owner, ok := doc["ownerId"]; ok && owner != adminAuth.UserID {
+			t.Errorf("expected ownerId %s got %v", adminAuth.UserID, owner)
+		}
+	}
+
+	found, err := datastore.GetDocumentByID(adminAuth, confDBName, colName, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertOwner(found)
+
+	forged := map[string]interface{}{
+		"title":     "forged update",
+		"accountId": "forged-account",
+		"ownerId":   "forged-owner",
+	}
+	if _, err := datastore.UpdateDocument(adminAuth, confDBName, colName, id, forged); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err = datastore.GetDocumentByID(adminAuth, confDBName, colName, id)
+	if err != nil {
+		t.Fatal(err)
+	} else if found["title"] != "forged update" {
+		t.Errorf("expected title to be updated got %v", found["title"])
+	}
+	assertOwner(found)
+}
+
+func TestDeleteByFilter(t *testing.T) {
+	col := "bulkdelete"
+	for i := 0; i < 4; i++ {
+		if _, err := datastore.CreateDocument(adminAuth, confDBName, col, newTask(fmt.Sprintf("bulk %d", i), i%2 == 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter, err := datastore.ParseQuery([][]interface{}{{"done", "=", true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a user from another account cannot delete those documents
+	other := internal.Auth{AccountID: datastore.NewID(), UserID: datastore.NewID()}
+	if n, err := datastore.DeleteByFilter(other, confDBName, col, filter); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Errorf("expected other account to delete 0 documents got %d", n)
+	}
+
+	// the permission check is added to the filter, a fresh one is needed
+	filter, err = datastore.ParseQuery([][]interface{}{{"done", "=", true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := datastore.DeleteByFilter(adminAuth, confDBName, col, filter); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Errorf("expected 2 deleted documents got %d", n)
+	}
+
+	res, err := datastore.ListDocuments(adminAuth, confDBName, col, internal.ListParams{Page: 1, Size: 50})
+	if err != nil {
+		t.Fatal(err)
+	} else if res.Total != 2 {
+		t.Errorf("expected 2 remaining documents got %d", res.Total)
+	}
+
+	for _, doc := range res.Results {
+		if dec(doc).Done {
+			t.Errorf("expected only undone tasks to remain got %v", doc)
+		}
+	}
+}
+
+func TestUpdateByFilter(t *testing.T) {
+	col := "bulkupdate"
+	for i := 0; i < 4; i++ {
+		if _, err := datastore.CreateDocument(adminAuth, confDBName, col, newTask(fmt.Sprintf("bulk %d", i), i%2 == 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	update := map[string]interface{}{"title": "bulk updated"}
+
+	filter, err := datastore.ParseQuery([][]interface{}{{"done", "=", true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a user from another account cannot update those documents
+	other := internal.Auth{AccountID: datastore.NewID(), UserID: datastore.NewID()}
+	if n, err := datastore.UpdateByFilter(other, confDBName, col, filter, update); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Errorf("expected other account to update 0 documents got %d", n)
+	}
+
+	// the permission check is added to the filter, a fresh one is needed
+	filter, err = datastore.ParseQuery([][]interface{}{{"done", "=", true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := datastore.UpdateByFilter(adminAuth, confDBName, col, filter, update); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Errorf("expected 2 updated documents got %d", n)
+	}
+
+	res, err := datastore.ListDocuments(adminAuth, confDBName, col, internal.ListParams{Page: 1, Size: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, doc := range res.Results {
+		task := dec(doc)
+		if task.Done && task.Title != "bulk updated" {
+			t.Errorf("expected done task to be updated got %v", doc)
+		} else if !task.Done && task.Title == "bulk updated" {
+			t.Errorf("expected undone task to be unchanged got %v", doc)
+		}
+	}
+}
+
+func TestNestedField(t *testing.T) {
+	col := "nested"
+	for _, city := range []string{"Quebec", "Montreal"} {
+		doc := map[string]interface{}{
+			"title":   "lives in " + city,
+			"address": map[string]interface{}{"city": city, "zip": "H0H"},
+		}
+		if _, err := datastore.CreateDocument(adminAuth, confDBName, col, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter, err := datastore.ParseQuery([][]interface{}{{"address.city", "=", "Montreal"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := internal.ListParams{Page: 1, Size: 50, Fields: []string{"address.city"}}
+	res, err := datastore.QueryDocuments(adminAuth, confDBName, col, filter, params)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(res.Results) != 1 {
+		t.Fatalf("expected 1 document got %d", len(res.Results))
+	}
+
+	doc := res.Results[0]
+	address, ok := doc["address"].(map[string]interface{})
+	if !ok || len(address) != 1 || address["city"] != "Montreal" {
+		t.Errorf("expected only address.city got %v", doc)
+	} else if _, ok := doc["title"]; ok {
+		t.Errorf("expected title to be excluded got %v", doc)
+	}
+
+	params = internal.ListParams{Page: 1, Size: 50, Sort: []internal.SortField{{Field: "address.city"}}}
+	res, err = datastore.ListDocuments(adminAuth, confDBName, col, params)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(res.Results) != 2 || res.Results[0]["title"] != "lives in Montreal" {
+		t.Errorf("expected documents sorted by address.city got %v", res.Results)
+	}
+
+	id := fmt.Sprintf("%v", res.Results[0]["id"])
+	update := map[string]interface{}{"address.city": "Laval", "address.geo.lat": 45.6}
+	updated, err := datastore.UpdateDocument(adminAuth, confDBName, col, id, update)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address, ok = updated["address"].(map[string]interface{})
+	if !ok || address["city"] != "Laval" || address["zip"] != "H0H" {
+		t.Errorf("expected address.city to be updated and zip kept got %v", updated)
+	} else if geo, ok := address["geo"].(map[string]interface{}); !ok || geo["lat"] != 45.6 {
+		t.Errorf("expected address.geo.lat to be created got %v", updated)
+	}
+}
+
+func TestNestedFieldInvalidPath(t *testing.T) {
+	col := "nested"
+	field := "address.city}' OR '1'='1"
+
+	params := internal.ListParams{Page: 1, Size: 50, Fields: []string{field}}
+	if _, err := datastore.ListDocuments(adminAuth, confDBName, col, params); err == nil {
+		t.Errorf("expected the projected field %q to be rejected", field)
+	}
+
+	params = internal.ListParams{Page: 1, Size: 50, Sort: []internal.SortField{{Field: field}}}
+	if _, err := datastore.ListDocuments(adminAuth, confDBName, col, params); err == nil {
+		t.Errorf("expected the sort field %q to be rejected", field)
+	}
+
+	if _, err := datastore.DeleteExpired(confDBName, col, field, time.Now()); err == nil {
+		t.Errorf("expected the expiry field %q to be rejected", field)
+	}
+}
+
+func TestDeleteExpired(t *testing.T) {
+	col := "sessions"
+	now := time.Now()
+
+	seen := []time.Time{now.Add(-2 * time.Hour), now.Add(-90 * time.Minute), now.Add(-time.Minute)}
+	for i, at := range seen {
+		doc := map[string]interface{}{"name": fmt.Sprintf("session %d", i), "lastSeen": at.UTC().Format(time.RFC3339)}
+		if _, err := datastore.CreateDocument(adminAuth, confDBName, col, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := datastore.DeleteExpired(confDBName, col, "lastSeen", now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Errorf("expected 2 expired documents removed got %d", n)
+	}
+
+	res, err := datastore.ListDocuments(adminAuth, confDBName, col, internal.ListParams{Page: 1, Size: 50})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(res.Results) != 1 || res.Results[0]["name"] != "session 2" {
+		t.Errorf("expected only the live session to remain got %v", res.Results)
+	}
+}
+
+func TestTruncateAndDropCollection(t *testing.T) {
+	col := "wipes"
+
+	for i := 0; i < 3; i++ {
+		doc := map[string]interface{}{"name": fmt.Sprintf("wipe %d", i)}
+		if _, err := datastore.CreateDocument(adminAuth, confDBName, col, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := datastore.TruncateCollection(confDBName, col); err != nil {
+		t.Fatal(err)
+	} else if n != 3 {
+		t.Errorf("expected 3 documents removed got %d", n)
+	}
+
+	hasCollection := func() bool {
+		names, err := datastore.ListCollections(confDBName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range names {
+			if name == col {
+				return true
+			}
+		}
+		return false
+	}
+
+	res, err := datastore.ListDocuments(adminAuth, confDBName, col, internal.ListParams{Page: 1, Size: 50})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(res.Results) != 0 {
+		t.Errorf("expected no documents after truncate got %v", res.Results)
+	} else if !hasCollection() {
+		t.Errorf("expected the collection to remain after truncate")
+	}
+
+	if err := datastore.DropCollection(confDBName, col); err != nil {
+		t.Fatal(err)
+	} else if hasCollection() {
+		t.Errorf("expected the collection to be gone after drop")
+	}
+}
+
+func TestNumberTypes(t *testing.T) {
+	col := "numbers"
+
+	var doc map[string]interface{}
+	if err := internal.DecodeJSON(strings.NewReader(`{"count": 42, "ratio": 1.5}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := datastore.CreateDocument(adminAuth, confDBName, col, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := datastore.GetDocumentByID(adminAuth, confDBName, col, fmt.Sprintf("%v", created[internal.IDField]))
+	if err != nil {
+		t.Fatal(err)
+	} else if got["count"] != int64(42) {
+		t.Errorf("expected count to be int64 42 got %T %v", got["count"], got["count"])
+	} else if got["ratio"] != 1.5 {
+		t.Errorf("expected ratio to be float64 1.5 got %T %v", got["ratio"], got["ratio"])
+	}
+
+	filter, err := datastore.ParseQuery([][]interface{}{{"count", "=", int64(42)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := datastore.QueryDocuments(adminAuth, confDBName, col, filter, internal.ListParams{Page: 1, Size: 50})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(res.Results) != 1 || res.Results[0]["count"] != int64(42) {
+		t.Errorf("expected the integer document to match got %v", res.Results)
+	}
+
+	// 42 is before 9 as text
+	for _, op := range []string{">", ">="} {
+		filter, err := datastore.ParseQuery([][]interface{}{{"count", op, int64(9)}, {"ratio", "<", 2.0}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := datastore.QueryDocuments(adminAuth, confDBName, col, filter, internal.ListParams{Page: 1, Size: 50})
+		if err != nil {
+			t.Fatal(err)
+		} else if len(res.Results) != 1 {
+			t.Errorf("count %s 9: expected the document to match as a number got %v", op, res.Results)
+		}
+	}
+}
+
+func TestReplaceDocument(t *testing.T) {
+	m, err := datastore.CreateDocument(adminAuth, confDBName, colName, newTask("to replace", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inserted := dec(m)
+
+	replacement := map[string]interface{}{"title": "replaced", "likes": 3}
+	if _, err := datastore.ReplaceDocument(adminAuth, confDBName, colName, inserted.ID, replacement); err != nil {
+		t.Fatal(err)
+	}
+
+	m2, err := datastore.GetDocumentByID(adminAuth, confDBName, colName, inserted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replaced := dec(m2)
+	if replaced.ID != inserted.ID || replaced.AccountID != inserted.AccountID {
+		t.Errorf("expected the id and account to be kept got %s %s", replaced.ID, replaced.AccountID)
+	} else if replaced.Title != "replaced" || replaced.Likes != 3 {
+		t.Errorf("expected the replacement fields got %v", m2)
+	} else if _, ok := m2["done"]; ok {
+		t.Errorf("expected the omitted done field to be removed got %v", m2)
+	} else if _, ok := m2["todos"]; ok {
+		t.Errorf("expected the omitted todos field to be removed got %v", m2)
+	}
+}
@@ -1,8 +1,11 @@
 package postgresql
 
 import (
+	"context"
 	"fmt"
 	"time"
+
+	"github.com/staticbackendhq/core/internal"
 )
 
 type FormData struct {
@@ -13,6 +16,9 @@ type FormData struct {
 }
 
 func (pg *PostgreSQL) AddFormSubmission(dbName, form string, doc map[string]interface{}) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
 	var jsonb JSONB = doc
 
 	qry := fmt.Sprintf(`
@@ -20,13 +26,16 @@ func (pg *PostgreSQL) AddFormSubmission(dbName, form string, doc map[string]inte
 		VALUES($1, $2, $3)
 	`, dbName)
 
-	if _, err := pg.DB.Exec(qry, form, jsonb, time.Now()); err != nil {
+	if _, err := pg.DB.ExecContext(ctx, qry, form, jsonb, time.Now()); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (pg *PostgreSQL) ListFormSubmissions(dbName, name string) (results []map[string]interface{}, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	where := "WHERE $1=$1"
 	if len(name) > 0 {
 		where = "WHERE name = $1"
@@ -40,7 +49,7 @@ func (pg *PostgreSQL) ListFormSubmissions(dbName, name string) (results []map[st
 		LIMIT 100;
 	`, dbName, where)
 
-	rows, err := pg.DB.Query(qry, name)
+	rows, err := pg.DB.QueryContext(ctx, qry, name)
 	if err != nil {
 		return
 	}
@@ -60,13 +69,16 @@ func (pg *PostgreSQL) ListFormSubmissions(dbName, name string) (results []map[st
 }
 
 func (pg *PostgreSQL) GetForms(dbName string) (results []string, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		SELECT name 
 		FROM %s.sb_forms 
 		GROUP BY name
 	`, dbName)
 
-	rows, err := pg.DB.Query(qry)
+	rows, err := pg.DB.QueryContext(ctx, qry)
 	if err != nil {
 		return
 	}
@@ -1,6 +1,7 @@
 package postgresql
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -9,13 +10,16 @@ import (
 )
 
 func (pg *PostgreSQL) AddFunction(dbName string, data internal.ExecData) (id string, err error) {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		INSERT INTO %s.sb_functions(function_name, trigger_topic, code, version, last_updated, last_run)
 		VALUES($1, $2, $3, $4, $5, $6)
 		RETURNING id;
 	`, dbName)
 
-	err = pg.DB.QueryRow(
+	err = pg.DB.QueryRowContext(ctx,
 		qry,
 		data.FunctionName,
 		data.TriggerTopic,
@@ -27,6 +31,9 @@ func (pg *PostgreSQL) AddFunction(dbName string, data internal.ExecData) (id str
 	return
 }
 func (pg *PostgreSQL) UpdateFunction(dbName, id, code, trigger string) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		UPDATE %s.sb_functions SET
 			code = $3,
@@ -34,33 +41,39 @@ func (pg *PostgreSQL) UpdateFunction(dbName, id, code, trigger string) error {
 		WHERE id = $1 AND trigger_topic = $2
 	`, dbName)
 
-	if _, err := pg.DB.Exec(qry, id, trigger, code); err != nil {
+	if _, err := pg.DB.ExecContext(ctx, qry, id, trigger, code); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (pg *PostgreSQL) GetFunctionForExecution(dbName, name string) (result internal.ExecData, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		SELECT * 
 		FROM %s.sb_functions 
 		WHERE function_name = $1
 	`, dbName)
 
-	row := pg.DB.QueryRow(qry, name)
+	row := pg.DB.QueryRowContext(ctx, qry, name)
 
 	err = scanExecData(row, &result)
 	return
 }
 
 func (pg *PostgreSQL) GetFunctionByID(dbName, id string) (result internal.ExecData, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		SELECT * 
 		FROM %s.sb_functions 
 		WHERE id = $1
 	`, dbName)
 
-	row := pg.DB.QueryRow(qry, id)
+	row := pg.DB.QueryRowContext(ctx, qry, id)
 
 	err = scanExecData(row, &result)
 	if err != nil {
@@ -75,7 +88,7 @@ func (pg *PostgreSQL) GetFunctionByID(dbName, id string) (result internal.ExecDa
 		LIMIT 50;
 	`, dbName)
 
-	rows, err := pg.DB.Query(qry, id)
+	rows, err := pg.DB.QueryContext(ctx, qry, id)
 	if err != nil {
 		return
 	}
@@ -95,13 +108,16 @@ func (pg *PostgreSQL) GetFunctionByID(dbName, id string) (result internal.ExecDa
 }
 
 func (pg *PostgreSQL) GetFunctionByName(dbName, name string) (result internal.ExecData, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		SELECT * 
 		FROM %s.sb_functions 
 		WHERE function_name = $1
 	`, dbName)
 
-	row := pg.DB.QueryRow(qry, name)
+	row := pg.DB.QueryRowContext(ctx, qry, name)
 
 	err = scanExecData(row, &result)
 	if err != nil {
@@ -117,7 +133,7 @@ func (pg *PostgreSQL) GetFunctionByName(dbName, name string) (result internal.Ex
 		LIMIT 50;
 	`, dbName)
 
-	rows, err := pg.DB.Query(qry, result.ID)
+	rows, err := pg.DB.QueryContext(ctx, qry, result.ID)
 	if err != nil {
 		return
 	}
@@ -137,13 +153,16 @@ func (pg *PostgreSQL) GetFunctionByName(dbName, name string) (result internal.Ex
 }
 
 func (pg *PostgreSQL) ListFunctions(dbName string) (results []internal.ExecData, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		SELECT * 
 		FROM %s.sb_functions 
 		ORDER BY last_updated DESC
 	`, dbName)
 
-	rows, err := pg.DB.Query(qry)
+	rows, err := pg.DB.QueryContext(ctx, qry)
 	if err != nil {
 		return
 	}
@@ -163,6 +182,9 @@ func (pg *PostgreSQL) ListFunctions(dbName string) (results []internal.ExecData,
 }
 
 func (pg *PostgreSQL) ListFunctionsByTrigger(dbName, trigger string) (results []internal.ExecData, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		SELECT * 
 		FROM %s.sb_functions 
@@ -170,7 +192,7 @@ func (pg *PostgreSQL) ListFunctionsByTrigger(dbName, trigger string) (results []
 		ORDER BY last_updated DESC
 	`, dbName)
 
-	rows, err := pg.DB.Query(qry, trigger)
+	rows, err := pg.DB.QueryContext(ctx, qry, trigger)
 	if err != nil {
 		return
 	}
@@ -190,25 +212,31 @@ func (pg *PostgreSQL) ListFunctionsByTrigger(dbName, trigger string) (results []
 }
 
 func (pg *PostgreSQL) DeleteFunction(dbName, name string) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		DELETE FROM %s.sb_functions
 		WHERE function_name = $1
 	`, dbName)
 
-	if _, err := pg.DB.Exec(qry, name); err != nil {
+	if _, err := pg.DB.ExecContext(ctx, qry, name); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (pg *PostgreSQL) RanFunction(dbName, id string, rh internal.ExecHistory) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		UPDATE %s.sb_functions SET
 			last_run = $2
 		WHERE id = $1
 	`, dbName)
 
-	if _, err := pg.DB.Exec(qry, id, time.Now()); err != nil {
+	if _, err := pg.DB.ExecContext(ctx, qry, id, time.Now()); err != nil {
 		return err
 	}
 
@@ -217,7 +245,7 @@ func (pg *PostgreSQL) RanFunction(dbName, id string, rh internal.ExecHistory) er
 		VALUES($1, $2, $3, $4, $5, $6)
 	`, dbName)
 
-	_, err := pg.DB.Exec(
+	_, err := pg.DB.ExecContext(ctx,
 		qry,
 		id,
 		rh.Version,
@@ -1,31 +1,56 @@
 package postgresql
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/staticbackendhq/core/internal"
 )
 
 func (pg *PostgreSQL) CreateUserAccount(dbName, email string) (id string, err error) {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	email = internal.NormalizeEmail(email)
+
+	if exists, err := pg.UserEmailExists(dbName, email); err != nil {
+		return "", err
+	} else if exists {
+		return "", internal.ErrEmailTaken
+	}
+
 	qry := fmt.Sprintf(`
 		INSERT INTO %s.sb_accounts(email, created)
 		VALUES($1, $2)
 		RETURNING id;
 	`, dbName)
 
-	err = pg.DB.QueryRow(qry, email, time.Now()).Scan(&id)
+	err = pg.DB.QueryRowContext(ctx, qry, email, time.Now()).Scan(&id)
 	return
 }
 
 func (pg *PostgreSQL) CreateUserToken(dbName string, tok internal.Token) (id string, err error) {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	tok.Email = internal.NormalizeEmail(tok.Email)
+
+	if exists, err := pg.UserEmailExists(dbName, tok.Email); err != nil {
+		return "", err
+	} else if exists {
+		return "", internal.ErrEmailTaken
+	}
+
 	qry := fmt.Sprintf(`
-		INSERT INTO %s.sb_tokens(account_id, email, password, token, role, reset_code, created)
-		VALUES($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO %s.sb_tokens(account_id, email, password, token, role, reset_code, created, label)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id;
 	`, dbName)
 
-	err = pg.DB.QueryRow(
+	err = pg.DB.QueryRowContext(ctx,
 		qry,
 		tok.AccountID,
 		tok.Email,
@@ -34,49 +59,220 @@ func (pg *PostgreSQL) CreateUserToken(dbName string, tok internal.Token) (id str
 		tok.Role,
 		tok.ResetCode,
 		tok.Created,
+		tok.Label,
 	).Scan(&id)
 	return
 }
 
+func (pg *PostgreSQL) CreateUsers(dbName string, toks []internal.Token) ([]internal.Token, error) {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	exists := fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM %s.sb_tokens
+		WHERE LOWER(email) = LOWER($1);
+	`, dbName)
+
+	acctQry := fmt.Sprintf(`
+		INSERT INTO %s.sb_accounts(email, created)
+		VALUES($1, $2)
+		RETURNING id;
+	`, dbName)
+
+	tokQry := fmt.Sprintf(`
+		INSERT INTO %s.sb_tokens(account_id, email, password, token, role, reset_code, created, label)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id;
+	`, dbName)
+
+	seen := make(map[string]bool)
+	created := make([]internal.Token, 0, len(toks))
+	for _, tok := range toks {
+		tok.Email = internal.NormalizeEmail(tok.Email)
+
+		var count int
+		if err := tx.QueryRowContext(ctx, exists, tok.Email).Scan(&count); err != nil {
+			return nil, err
+		} else if count > 0 || seen[tok.Email] {
+			return nil, internal.ErrEmailTaken
+		}
+		seen[tok.Email] = true
+
+		if err := tx.QueryRowContext(ctx, acctQry, tok.Email, tok.Created).Scan(&tok.AccountID); err != nil {
+			return nil, err
+		}
+
+		err := tx.QueryRowContext(ctx,
+			tokQry,
+			tok.AccountID,
+			tok.Email,
+			tok.Password,
+			tok.Token,
+			tok.Role,
+			tok.ResetCode,
+			tok.Created,
+			tok.Label,
+		).Scan(&tok.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		created = append(created, tok)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
 func (pg *PostgreSQL) UserEmailExists(dbName, email string) (exists bool, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		SELECT COUNT(*)
 		FROM %s.sb_tokens
-		WHERE email = $1;
+		WHERE LOWER(email) = LOWER($1);
 	`, dbName)
 
 	var count int
-	err = pg.DB.QueryRow(qry, email).Scan(&count)
+	err = pg.DB.QueryRowContext(ctx, qry, email).Scan(&count)
 
 	exists = count > 0
 	return
 }
 
 func (pg *PostgreSQL) SetUserRole(dbName, email string, role int) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		UPDATE %s.sb_tokens SET role = $2
-		WHERE email = $1;
+		WHERE LOWER(email) = LOWER($1);
 	`, dbName)
 
-	if _, err := pg.DB.Exec(qry, email, role); err != nil {
+	if _, err := pg.DB.ExecContext(ctx, qry, email, role); err != nil {
 		return err
 	}
 	return nil
 }
 
+func (pg *PostgreSQL) DemoteUser(dbName, email string, role, adminRole int) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// locking the admins serializes the concurrent demotions, a waiting one
+	// only sees the admins left once the other commits
+	qry := fmt.Sprintf(`
+		SELECT id
+		FROM %s.sb_tokens
+		WHERE role >= $1
+		FOR UPDATE;
+	`, dbName)
+
+	rows, err := tx.QueryContext(ctx, qry, adminRole)
+	if err != nil {
+		return err
+	}
+
+	admins := 0
+	for rows.Next() {
+		admins++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	} else if admins <= 1 {
+		return internal.ErrLastAdmin
+	}
+
+	qry = fmt.Sprintf(`
+		UPDATE %s.sb_tokens SET role = $2
+		WHERE LOWER(email) = LOWER($1);
+	`, dbName)
+
+	if _, err := tx.ExecContext(ctx, qry, email, role); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func (pg *PostgreSQL) UserSetPassword(dbName, tokenID, password string) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		UPDATE %s.sb_tokens SET password = $2
 		WHERE id = $1;
 	`, dbName)
 
-	if _, err := pg.DB.Exec(qry, tokenID, password); err != nil {
+	if _, err := pg.DB.ExecContext(ctx, qry, tokenID, password); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *PostgreSQL) UserSetEmail(dbName, tokenID, email string) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	email = internal.NormalizeEmail(email)
+
+	if exists, err := pg.UserEmailExists(dbName, email); err != nil {
+		return err
+	} else if exists {
+		return internal.ErrEmailTaken
+	}
+
+	qry := fmt.Sprintf(`
+		UPDATE %s.sb_tokens SET email = $2
+		WHERE id = $1;
+	`, dbName)
+
+	if _, err := pg.DB.ExecContext(ctx, qry, tokenID, email); err != nil {
+		// a concurrent change to the same email hits the unique constraint
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return internal.ErrEmailTaken
+		}
+		return err
+	}
+	return nil
+}
+
+func (pg *PostgreSQL) SetUserToken(dbName, tokenID, token string) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	qry := fmt.Sprintf(`
+		UPDATE %s.sb_tokens SET token = $2
+		WHERE id = $1;
+	`, dbName)
+
+	if _, err := pg.DB.ExecContext(ctx, qry, tokenID, token); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (pg *PostgreSQL) GetFirstTokenFromAccountID(dbName, accountID string) (tok internal.Token, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		SELECT * 
 		FROM %s.sb_tokens 
@@ -85,20 +281,70 @@ func (pg *PostgreSQL) GetFirstTokenFromAccountID(dbName, accountID string) (tok
 		LIMIT 1
 	`, dbName)
 
-	row := pg.DB.QueryRow(qry, accountID)
+	row := pg.DB.QueryRowContext(ctx, qry, accountID)
 
 	err = scanToken(row, &tok)
 	return
 }
 
+func (pg *PostgreSQL) ListTokens(dbName, accountID string) ([]internal.Token, error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
+	qry := fmt.Sprintf(`
+		SELECT * 
+		FROM %s.sb_tokens 
+		WHERE account_id = $1
+		ORDER BY created ASC
+	`, dbName)
+
+	rows, err := pg.DB.QueryContext(ctx, qry, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var toks []internal.Token
+	for rows.Next() {
+		var tok internal.Token
+		if err := scanToken(rows, &tok); err != nil {
+			return nil, err
+		}
+		toks = append(toks, tok)
+	}
+	return toks, rows.Err()
+}
+
+func (pg *PostgreSQL) DeleteToken(dbName, tokenID string) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	qry := fmt.Sprintf(`DELETE FROM %s.sb_tokens WHERE id = $1`, dbName)
+
+	res, err := pg.DB.ExecContext(ctx, qry, tokenID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New("token not found")
+	}
+	return nil
+}
+
 func (pg *PostgreSQL) SetPasswordResetCode(dbName, tokenID, code string) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 	UPDATE %s.sb_tokens SET
 		reset_code = $2
 	WHERE id = $1
 `, dbName)
 
-	_, err := pg.DB.Exec(qry, tokenID, code)
+	_, err := pg.DB.ExecContext(ctx, qry, tokenID, code)
 	if err != nil {
 		return err
 	}
@@ -106,14 +352,183 @@ func (pg *PostgreSQL) SetPasswordResetCode(dbName, tokenID, code string) error {
 }
 
 func (pg *PostgreSQL) ResetPassword(dbName, email, code, password string) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		UPDATE %s.sb_tokens SET
 			password = $3
-		WHERE email = $1 AND reset_code = $2
+		WHERE LOWER(email) = LOWER($1) AND reset_code = $2
+	`, dbName)
+
+	if _, err := pg.DB.ExecContext(ctx, qry, email, code, password); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *PostgreSQL) AddLoginEvent(dbName string, ev internal.LoginEvent, keep int) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	qry := fmt.Sprintf(`
+		INSERT INTO %s.sb_logins(user_id, ip, user_agent, created)
+		VALUES($1, $2, $3, $4)
+	`, dbName)
+
+	if _, err := pg.DB.ExecContext(ctx, qry, ev.UserID, ev.IP, ev.UserAgent, ev.Created); err != nil {
+		return err
+	}
+
+	if keep <= 0 {
+		return nil
+	}
+
+	qry = fmt.Sprintf(`
+		DELETE FROM %s.sb_logins
+		WHERE user_id = $1 AND id NOT IN (
+			SELECT id FROM %s.sb_logins
+			WHERE user_id = $1
+			ORDER BY created DESC
+			LIMIT $2
+		)
+	`, dbName, dbName)
+
+	_, err := pg.DB.ExecContext(ctx, qry, ev.UserID, keep)
+	return err
+}
+
+func (pg *PostgreSQL) ListLoginEvents(dbName, userID string) ([]internal.LoginEvent, error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
+	qry := fmt.Sprintf(`
+		SELECT id, user_id, ip, user_agent, created
+		FROM %s.sb_logins
+		WHERE user_id = $1
+		ORDER BY created DESC
+	`, dbName)
+
+	rows, err := pg.DB.QueryContext(ctx, qry, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []internal.LoginEvent
+	for rows.Next() {
+		var ev internal.LoginEvent
+		if err := rows.Scan(&ev.ID, &ev.UserID, &ev.IP, &ev.UserAgent, &ev.Created); err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
+
+func (pg *PostgreSQL) SetLoginAlerts(dbName, userID string, enabled bool) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	qry := fmt.Sprintf(`
+		INSERT INTO %s.sb_login_alerts_optout(user_id) VALUES($1)
+		ON CONFLICT DO NOTHING
+	`, dbName)
+	if enabled {
+		qry = fmt.Sprintf(`DELETE FROM %s.sb_login_alerts_optout WHERE user_id = $1`, dbName)
+	}
+
+	_, err := pg.DB.ExecContext(ctx, qry, userID)
+	return err
+}
+
+func (pg *PostgreSQL) LoginAlertsEnabled(dbName, userID string) (bool, error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
+	qry := fmt.Sprintf(`
+		SELECT COUNT(*) FROM %s.sb_login_alerts_optout WHERE user_id = $1
+	`, dbName)
+
+	var count int
+	if err := pg.DB.QueryRowContext(ctx, qry, userID).Scan(&count); err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+func (pg *PostgreSQL) SetLoginCode(dbName string, code internal.LoginCode) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	qry := fmt.Sprintf(`
+		INSERT INTO %s.sb_login_codes(user_id, hash, expires) VALUES($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET hash = EXCLUDED.hash, expires = EXCLUDED.expires
+	`, dbName)
+
+	_, err := pg.DB.ExecContext(ctx, qry, code.UserID, code.Hash, code.Expires)
+	return err
+}
+
+func (pg *PostgreSQL) UseLoginCode(dbName, userID, hash string, now time.Time) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	// the delete makes the code single-use even for concurrent attempts
+	qry := fmt.Sprintf(`
+		DELETE FROM %s.sb_login_codes
+		WHERE user_id = $1 AND hash = $2 AND expires > $3
 	`, dbName)
 
-	if _, err := pg.DB.Exec(qry, email, code, password); err != nil {
+	res, err := pg.DB.ExecContext(ctx, qry, userID, hash, now)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
 		return err
+	} else if n == 0 {
+		return internal.ErrInvalidLoginCode
 	}
 	return nil
 }
+
+func (pg *PostgreSQL) AddImpersonation(dbName string, imp internal.Impersonation) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	qry := fmt.Sprintf(`
+		INSERT INTO %s.sb_impersonations(impersonated_by, user_id, email, expires, created)
+		VALUES($1, $2, $3, $4, $5)
+	`, dbName)
+
+	_, err := pg.DB.ExecContext(ctx, qry, imp.ImpersonatedBy, imp.UserID, imp.Email, imp.Expires, imp.Created)
+	return err
+}
+
+func (pg *PostgreSQL) ListImpersonations(dbName string) ([]internal.Impersonation, error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
+	qry := fmt.Sprintf(`
+		SELECT id, impersonated_by, user_id, email, expires, created
+		FROM %s.sb_impersonations
+		ORDER BY created DESC
+	`, dbName)
+
+	rows, err := pg.DB.QueryContext(ctx, qry)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []internal.Impersonation
+	for rows.Next() {
+		var imp internal.Impersonation
+		if err := rows.Scan(&imp.ID, &imp.ImpersonatedBy, &imp.UserID, &imp.Email, &imp.Expires, &imp.Created); err != nil {
+			return nil, err
+		}
+		list = append(list, imp)
+	}
+	return list, rows.Err()
+}
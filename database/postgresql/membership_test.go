@@ -1,6 +1,8 @@
 package postgresql
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -30,6 +32,106 @@ func TestCreateUserAccountAndToken(t *testing.T) {
 	}
 }
 
+func TestCreateUsers(t *testing.T) {
+	toks := []internal.Token{
+		{Email: "Bulk-1@test.com", Token: "bulk1", Role: 10, Created: time.Now()},
+		{Email: "bulk-2@test.com", Token: "bulk2", Role: 10, Created: time.Now()},
+	}
+
+	created, err := datastore.CreateUsers(confDBName, toks)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(created) != 2 {
+		t.Fatalf("expected 2 users got %d", len(created))
+	}
+
+	for _, tok := range created {
+		found, err := datastore.FindToken(confDBName, tok.ID, tok.Token)
+		if err != nil {
+			t.Fatal(err)
+		} else if found.AccountID != tok.AccountID || found.Role != 10 || found.Email != tok.Email {
+			t.Errorf("unexpected user %v", found)
+		}
+	}
+
+	// one email taken, none of them are created
+	toks = []internal.Token{
+		{Email: "bulk-3@test.com", Token: "bulk3", Created: time.Now()},
+		{Email: "bulk-1@test.com", Token: "bulk1", Created: time.Now()},
+	}
+	if _, err := datastore.CreateUsers(confDBName, toks); !errors.Is(err, internal.ErrEmailTaken) {
+		t.Fatalf("expected ErrEmailTaken got %v", err)
+	} else if exists, err := datastore.UserEmailExists(confDBName, "bulk-3@test.com"); err != nil {
+		t.Fatal(err)
+	} else if exists {
+		t.Errorf("expected no user to be created when an email is taken")
+	}
+}
+
+func TestListTokens(t *testing.T) {
+	acctID, err := datastore.CreateUserAccount(confDBName, "labels@test.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, label := range []string{"laptop", ""} {
+		tok := internal.Token{
+			AccountID: acctID,
+			Token:     fmt.Sprintf("labels-%d", i),
+			Email:     fmt.Sprintf("labels-%d@test.com", i),
+			Password:  "4321",
+			Created:   time.Now().Add(time.Duration(i) * time.Second),
+			Label:     label,
+		}
+		if _, err := datastore.CreateUserToken(confDBName, tok); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	toks, err := datastore.ListTokens(confDBName, acctID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(toks) != 2 {
+		t.Fatalf("expected 2 tokens got %d", len(toks))
+	} else if toks[0].Label != "laptop" || toks[1].Label != "" {
+		t.Errorf("expected the labels to round-trip got %q and %q", toks[0].Label, toks[1].Label)
+	}
+
+	found, err := datastore.FindTokenByEmail(confDBName, "labels-0@test.com")
+	if err != nil {
+		t.Fatal(err)
+	} else if found.Label != "laptop" {
+		t.Errorf("expected label laptop got %q", found.Label)
+	}
+}
+
+func TestDeleteToken(t *testing.T) {
+	acctID, err := datastore.CreateUserAccount(confDBName, "delete-token@test.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tok := internal.Token{
+		AccountID: acctID,
+		Token:     "delete-token",
+		Email:     "delete-token@test.com",
+		Password:  "4321",
+		Created:   time.Now(),
+	}
+	tokID, err := datastore.CreateUserToken(confDBName, tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := datastore.DeleteToken(confDBName, tokID); err != nil {
+		t.Fatal(err)
+	} else if _, err := datastore.FindToken(confDBName, tokID, tok.Token); err == nil {
+		t.Errorf("expected the deleted token to not be found")
+	} else if err := datastore.DeleteToken(confDBName, tokID); err == nil {
+		t.Errorf("expected an error deleting a missing token")
+	}
+}
+
 func TestGetFirstTokenFromAccountID(t *testing.T) {
 	tok, err := datastore.GetFirstTokenFromAccountID(confDBName, adminToken.AccountID)
 	if err != nil {
@@ -94,6 +196,63 @@ func TestSetUserRole(t *testing.T) {
 	}
 }
 
+func TestDemoteUser(t *testing.T) {
+	// a role above the other tests' admins isolates the two admins
+	const adminRole = 500
+
+	var emails []string
+	for _, name := range []string{"first", "second"} {
+		tok := internal.Token{
+			AccountID: adminAccount.ID,
+			Token:     "demote-" + name,
+			Email:     "demote-" + name + "@test.com",
+			Password:  "demote",
+			Role:      adminRole,
+			ResetCode: "none",
+			Created:   time.Now(),
+		}
+		if _, err := datastore.CreateUserToken(confDBName, tok); err != nil {
+			t.Fatal(err)
+		}
+		emails = append(emails, tok.Email)
+	}
+
+	// of two concurrent demotions at most one goes through
+	errs := make(chan error, len(emails))
+	for _, email := range emails {
+		go func(email string) {
+			errs <- datastore.DemoteUser(confDBName, email, 0, adminRole)
+		}(email)
+	}
+
+	demoted := 0
+	for range emails {
+		if err := <-errs; err == nil {
+			demoted++
+		} else if !errors.Is(err, internal.ErrLastAdmin) {
+			t.Fatal(err)
+		}
+	}
+
+	if demoted > 1 {
+		t.Errorf("expected at most one demotion got %d", demoted)
+	}
+
+	admins := 0
+	for _, email := range emails {
+		tok, err := datastore.FindTokenByEmail(confDBName, email)
+		if err != nil {
+			t.Fatal(err)
+		} else if tok.Role >= adminRole {
+			admins++
+		}
+	}
+
+	if admins != len(emails)-demoted {
+		t.Errorf("expected %d admins left got %d", len(emails)-demoted, admins)
+	}
+}
+
 func TestUserSetPassword(t *testing.T) {
 	expected := "pw_changed"
 	if err := datastore.UserSetPassword(confDBName, adminToken.ID, expected); err != nil {
@@ -107,3 +266,210 @@ func TestUserSetPassword(t *testing.T) {
 		t.Errorf("expected password to be %s got %s", expected, tok.Password)
 	}
 }
+
+func TestUserSetEmail(t *testing.T) {
+	acctID, err := datastore.CreateUserAccount(confDBName, "before@setemail.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tok := internal.Token{
+		AccountID: acctID,
+		Token:     "setemail",
+		Email:     "before@setemail.com",
+		Password:  "4321",
+		Created:   time.Now(),
+	}
+	tok.ID, err = datastore.CreateUserToken(confDBName, tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := datastore.UserSetEmail(confDBName, tok.ID, "After@SetEmail.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := datastore.FindToken(confDBName, tok.ID, tok.Token)
+	if err != nil {
+		t.Fatal(err)
+	} else if changed.Email != "after@setemail.com" {
+		t.Errorf("expected email after@setemail.com got %s", changed.Email)
+	}
+
+	if err := datastore.UserSetEmail(confDBName, tok.ID, adminEmail); !errors.Is(err, internal.ErrEmailTaken) {
+		t.Errorf("expected ErrEmailTaken got %v", err)
+	}
+}
+
+func TestSetUserToken(t *testing.T) {
+	acctID, err := datastore.CreateUserAccount(confDBName, "rotate@test.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tok := internal.Token{
+		AccountID: acctID,
+		Token:     datastore.NewID(),
+		Email:     "rotate@test.com",
+		Password:  "4321",
+		Role:      100,
+		Created:   time.Now(),
+	}
+
+	tokID, err := datastore.CreateUserToken(confDBName, tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newToken := datastore.NewID()
+	if err := datastore.SetUserToken(confDBName, tokID, newToken); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := datastore.FindRootToken(confDBName, tokID, acctID, tok.Token); err == nil {
+		t.Error("expected the previous token to be rejected")
+	}
+	if _, err := datastore.FindRootToken(confDBName, tokID, acctID, newToken); err != nil {
+		t.Errorf("expected the new token to be valid got %v", err)
+	}
+}
+
+func TestUserEmailCaseInsensitive(t *testing.T) {
+	acctID, err := datastore.CreateUserAccount(confDBName, "User@Casing.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tok := internal.Token{
+		AccountID: acctID,
+		Token:     "casing1",
+		Email:     "User@Casing.com",
+		Password:  "4321",
+		Created:   time.Now(),
+	}
+	if _, err := datastore.CreateUserToken(confDBName, tok); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, err := datastore.UserEmailExists(confDBName, "user@casing.com"); err != nil {
+		t.Fatal(err)
+	} else if !exists {
+		t.Errorf("expected user@casing.com to exist")
+	}
+
+	tok.Token = "casing2"
+	tok.Email = "user@casing.com"
+	if _, err := datastore.CreateUserToken(confDBName, tok); !errors.Is(err, internal.ErrEmailTaken) {
+		t.Errorf("expected ErrEmailTaken for a user got %v", err)
+	}
+
+	if _, err := datastore.CreateUserAccount(confDBName, "USER@casing.com"); !errors.Is(err, internal.ErrEmailTaken) {
+		t.Errorf("expected ErrEmailTaken for an account got %v", err)
+	}
+
+	found, err := datastore.FindTokenByEmail(confDBName, "USER@CASING.COM")
+	if err != nil {
+		t.Fatal(err)
+	} else if found.Email != "user@casing.com" {
+		t.Errorf("expected the normalized email to be stored got %s", found.Email)
+	}
+}
+
+func TestLoginEvents(t *testing.T) {
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		ev := internal.LoginEvent{
+			UserID:    adminToken.ID,
+			IP:        fmt.Sprintf("10.0.0.%d", i),
+			UserAgent: "unit test",
+			Created:   now.Add(time.Duration(i) * time.Minute),
+		}
+		if err := datastore.AddLoginEvent(confDBName, ev, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, err := datastore.ListLoginEvents(confDBName, adminToken.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(events) != 2 {
+		t.Fatalf("expected the history to be capped to 2 got %d", len(events))
+	} else if events[0].IP != "10.0.0.2" || events[1].IP != "10.0.0.1" {
+		t.Errorf("expected the most recent logins first got %v", events)
+	}
+}
+
+func TestImpersonations(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond)
+	for i := 0; i < 2; i++ {
+		imp := internal.Impersonation{
+			ImpersonatedBy: "root@test.com",
+			UserID:         adminToken.ID,
+			Email:          fmt.Sprintf("user%d@test.com", i),
+			Expires:        now.Add(time.Hour),
+			Created:        now.Add(time.Duration(i) * time.Minute),
+		}
+		if err := datastore.AddImpersonation(confDBName, imp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := datastore.ListImpersonations(confDBName)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(list) < 2 {
+		t.Fatalf("expected the impersonations to be recorded got %v", list)
+	} else if list[0].Email != "user1@test.com" || list[1].Email != "user0@test.com" {
+		t.Errorf("expected the most recent impersonations first got %v", list)
+	} else if list[0].ImpersonatedBy != "root@test.com" || list[0].UserID != adminToken.ID || len(list[0].ID) == 0 {
+		t.Errorf("expected the impersonation to be kept got %v", list[0])
+	}
+}
+
+func TestSetLoginAlerts(t *testing.T) {
+	enabled, err := datastore.LoginAlertsEnabled(confDBName, adminToken.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if !enabled {
+		t.Fatal("expected the login alerts to be enabled by default")
+	}
+
+	for _, expected := range []bool{false, false, true} {
+		if err := datastore.SetLoginAlerts(confDBName, adminToken.ID, expected); err != nil {
+			t.Fatal(err)
+		}
+
+		enabled, err := datastore.LoginAlertsEnabled(confDBName, adminToken.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if enabled != expected {
+			t.Errorf("expected enabled to be %t got %t", expected, enabled)
+		}
+	}
+}
+
+func TestLoginCodes(t *testing.T) {
+	now := time.Now()
+	code := internal.LoginCode{UserID: adminToken.ID, Hash: "first", Expires: now.Add(time.Minute)}
+	if err := datastore.SetLoginCode(confDBName, code); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new code replaces the previous one
+	code.Hash = "second"
+	if err := datastore.SetLoginCode(confDBName, code); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := datastore.UseLoginCode(confDBName, adminToken.ID, "first", now); !errors.Is(err, internal.ErrInvalidLoginCode) {
+		t.Errorf("expected the replaced code to be invalid got %v", err)
+	} else if err := datastore.UseLoginCode(confDBName, adminToken.ID, "second", now.Add(time.Hour)); !errors.Is(err, internal.ErrInvalidLoginCode) {
+		t.Errorf("expected the expired code to be invalid got %v", err)
+	} else if err := datastore.UseLoginCode(confDBName, adminToken.ID, "second", now); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := datastore.UseLoginCode(confDBName, adminToken.ID, "second", now); !errors.Is(err, internal.ErrInvalidLoginCode) {
+		t.Errorf("expected the used code to be invalid got %v", err)
+	}
+}
@@ -1,12 +1,16 @@
 package postgresql
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"path"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
 
 	"github.com/spf13/afero"
 )
@@ -168,3 +172,121 @@ func up(db *sql.DB, prefix string, version int) error {
 
 	return tx.Commit()
 }
+
+// BaseMigrations returns the system tables added to the existing bases, the
+// new bases have them from createSystemTables.
+func (pg *PostgreSQL) BaseMigrations() []internal.BaseMigration {
+	return []internal.BaseMigration{
+		{Version: 1, Description: "add the login history tables", Up: pg.addLoginTables},
+		{Version: 2, Description: "add the webhooks table", Up: pg.addWebhooksTable},
+		{Version: 3, Description: "add the impersonations table", Up: pg.addImpersonationsTable},
+	}
+}
+
+func (pg *PostgreSQL) addLoginTables(dbName string) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	qry := strings.Replace(`
+		CREATE TABLE IF NOT EXISTS {schema}.sb_logins (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+			user_id uuid REFERENCES {schema}.sb_tokens(id) ON DELETE CASCADE,
+			ip TEXT NOT NULL,
+			user_agent TEXT NOT NULL,
+			created timestamp NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS sb_logins_user_idx ON {schema}.sb_logins (user_id, created DESC);
+
+		CREATE TABLE IF NOT EXISTS {schema}.sb_login_alerts_optout (
+			user_id uuid PRIMARY KEY REFERENCES {schema}.sb_tokens(id) ON DELETE CASCADE
+		);
+
+		CREATE TABLE IF NOT EXISTS {schema}.sb_login_codes (
+			user_id uuid PRIMARY KEY REFERENCES {schema}.sb_tokens(id) ON DELETE CASCADE,
+			hash TEXT NOT NULL,
+			expires timestamp NOT NULL
+		);
+	`, "{schema}", dbName, -1)
+
+	_, err := pg.DB.ExecContext(ctx, qry)
+	return err
+}
+
+func (pg *PostgreSQL) addWebhooksTable(dbName string) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	qry := strings.Replace(`
+		CREATE TABLE IF NOT EXISTS {schema}.sb_webhooks (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+			col TEXT NOT NULL,
+			event TEXT NOT NULL,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			fields TEXT[] NOT NULL,
+			created timestamp NOT NULL
+		);
+	`, "{schema}", dbName, -1)
+
+	_, err := pg.DB.ExecContext(ctx, qry)
+	return err
+}
+
+// addImpersonationsTable keeps the user id as text, the audit of an
+// impersonation outlives the user.
+func (pg *PostgreSQL) addImpersonationsTable(dbName string) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	qry := strings.Replace(`
+		CREATE TABLE IF NOT EXISTS {schema}.sb_impersonations (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+			impersonated_by TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			email TEXT NOT NULL,
+			expires timestamp NOT NULL,
+			created timestamp NOT NULL
+		);
+	`, "{schema}", dbName, -1)
+
+	_, err := pg.DB.ExecContext(ctx, qry)
+	return err
+}
+
+func (pg *PostgreSQL) AppliedMigrations(dbName string) (map[int]bool, error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
+	rows, err := pg.DB.QueryContext(ctx, `
+		SELECT version 
+		FROM sb.base_migrations 
+		WHERE name = $1
+	`, dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+func (pg *PostgreSQL) SetMigrationApplied(dbName string, version int) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	qry := `
+		INSERT INTO sb.base_migrations(name, version, applied)
+		VALUES($1, $2, $3)
+		ON CONFLICT DO NOTHING;
+	`
+	_, err := pg.DB.ExecContext(ctx, qry, dbName, version, time.Now())
+	return err
+}
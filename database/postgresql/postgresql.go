@@ -1,11 +1,14 @@
 package postgresql
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 
+	"github.com/lib/pq"
 	"github.com/spf13/afero"
 	"github.com/staticbackendhq/core/internal"
 )
@@ -38,20 +41,129 @@ func (pg *PostgreSQL) Ping() error {
 	return pg.DB.Ping()
 }
 
-func (pg *PostgreSQL) CreateIndex(dbName, col, field string) error {
+func (pg *PostgreSQL) CreateIndex(dbName, col, field string, unique bool) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	// IF NOT EXISTS would silently keep an index of the other kind
+	var def string
+	err := pg.DB.QueryRowContext(ctx, `
+		SELECT indexdef FROM pg_indexes WHERE schemaname = $1 AND indexname = $2
+	`, strings.ToLower(dbName), strings.ToLower(indexName(col, field))).Scan(&def)
+	if err == nil {
+		if strings.HasPrefix(def, "CREATE UNIQUE INDEX") != unique {
+			return internal.ErrIndexConflict
+		}
+		return nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
 	qry := `
-		CREATE INDEX IF NOT EXISTS 
-			idx_{col}_{field} 
+		CREATE {unique} INDEX IF NOT EXISTS 
+			{name} 
 		ON {schema}.{col} 
-		USING btree ((data->'{col}'))
+		USING btree ((data->'{field}'))
 	`
 
+	kind := ""
+	if unique {
+		kind = "UNIQUE"
+	}
+
+	qry = strings.Replace(qry, "{unique}", kind, -1)
+	qry = strings.Replace(qry, "{name}", indexName(col, field), -1)
 	qry = strings.Replace(qry, "{col}", internal.CleanCollectionName(col), -1)
 	qry = strings.Replace(qry, "{field}", field, -1)
 	qry = strings.Replace(qry, "{schema}", dbName, -1)
 
-	if _, err := pg.DB.Exec(qry); err != nil {
+	if _, err := pg.DB.ExecContext(ctx, qry); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *PostgreSQL) CreateGeoIndex(dbName, col, field string) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	point, err := geoPoint(field)
+	if err != nil {
+		return err
+	}
+
+	qry := fmt.Sprintf(`
+		CREATE INDEX IF NOT EXISTS 
+			%s 
+		ON %s.%s 
+		USING gist (%s)
+	`, indexName(col, field), dbName, internal.CleanCollectionName(col), point)
+
+	if _, err := pg.DB.ExecContext(ctx, qry); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *PostgreSQL) ListIndexes(dbName, col string) ([]internal.Index, error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
+	prefix := indexName(col, "")
+
+	rows, err := pg.DB.QueryContext(ctx, `
+		SELECT indexname, indexdef 
+		FROM pg_indexes 
+		WHERE schemaname = $1 AND tablename = $2
+		ORDER BY indexname
+	`, dbName, internal.CleanCollectionName(col))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	indexes := make([]internal.Index, 0)
+	for rows.Next() {
+		var name, def string
+		if err := rows.Scan(&name, &def); err != nil {
+			return nil, err
+		}
+
+		// primary key and system indexes are not exposed
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		indexes = append(indexes, internal.Index{
+			Name:   name,
+			Field:  strings.TrimPrefix(name, prefix),
+			Unique: strings.HasPrefix(def, "CREATE UNIQUE"),
+			Geo:    strings.Contains(def, "USING gist"),
+		})
+	}
+
+	return indexes, rows.Err()
+}
+
+func (pg *PostgreSQL) DropIndex(dbName, col, name string) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	if !strings.HasPrefix(name, indexName(col, "")) {
+		return internal.ErrIndexNotFound
+	}
+
+	qry := fmt.Sprintf(`DROP INDEX %s.%s`, dbName, name)
+	if _, err := pg.DB.ExecContext(ctx, qry); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "42704" {
+			return internal.ErrIndexNotFound
+		}
 		return err
 	}
 	return nil
 }
+
+func indexName(col, field string) string {
+	return fmt.Sprintf("idx_%s_%s", internal.CleanCollectionName(col), field)
+}
@@ -1,7 +1,9 @@
 package postgresql
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/staticbackendhq/core/internal"
@@ -20,23 +22,98 @@ func (mg *PostgreSQL) ParseQuery(clauses [][]interface{}) (map[string]interface{
 			return filter, fmt.Errorf("The %d query clause's field parameter must be a string: %v", i+1, clause[0])
 		}
 
-		field = fmt.Sprintf(`data->>'%s'`, field)
-
 		op, ok := clause[1].(string)
 		if !ok {
 			return filter, fmt.Errorf("The %d query clause's operator must be a string: %v", i+1, clause[1])
 		}
 
+		// the field is part of the SQL condition
+		if !internal.ValidFieldPath(field) {
+			return filter, fmt.Errorf("The %d query clause's field is not a valid field name: %s", i+1, field)
+		}
+
+		switch op {
+		case "near":
+			near, err := internal.ParseGeoNear(clause[2])
+			if err != nil {
+				return filter, fmt.Errorf("The %d query clause: %w", i+1, err)
+			}
+
+			point, err := geoPoint(field)
+			if err != nil {
+				return filter, fmt.Errorf("The %d query clause: %w", i+1, err)
+			}
+
+			// the earth_box check uses the geo index, it's a square so the
+			// distance is checked as well
+			center := fmt.Sprintf("ll_to_earth(%v, %v)", near.Lat, near.Lng)
+			cond := fmt.Sprintf(
+				"earth_box(%s, %v) @> %s AND earth_distance(%s, %s) <= %v",
+				center, near.Radius, point, center, point, near.Radius,
+			)
+			filter[cond] = sqlCondition{}
+			continue
+		case "within":
+			box, err := internal.ParseGeoBox(clause[2])
+			if err != nil {
+				return filter, fmt.Errorf("The %d query clause: %w", i+1, err)
+			}
+
+			lng, lat, err := geoCoordinates(field)
+			if err != nil {
+				return filter, fmt.Errorf("The %d query clause: %w", i+1, err)
+			}
+
+			cond := fmt.Sprintf(
+				"%s BETWEEN %v AND %v AND %s BETWEEN %v AND %v",
+				lng, box.MinLng, box.MaxLng, lat, box.MinLat, box.MaxLat,
+			)
+			filter[cond] = sqlCondition{}
+			continue
+		}
+
+		// the text is compared to the values, the jsonb to the numbers
+		value, err := dataField(field, false)
+		if err != nil {
+			return filter, fmt.Errorf("The %d query clause: %w", i+1, err)
+		}
+		field, _ = dataField(field, true)
+
 		switch op {
 		case "=", "==":
 			filter[field+" = "] = clause[2]
 		case "!=", "<>":
 			filter[field+" != "] = clause[2]
 		case ">", "<", ">=", "<=":
+			if isNumber(clause[2]) {
+				// the text of numbers does not sort like the numbers
+				cond := fmt.Sprintf("jsonb_typeof(%s) = 'number' AND %s %s %s", value, value, op, jsonbLiteral(clause[2]))
+				filter[cond] = sqlCondition{}
+				continue
+			}
 			filter[field+" "+op+" "] = clause[2]
 		case "in", "!in":
-			//TODO: Implement the value in array or value not in array
-			return filter, fmt.Errorf("array lookup is not implemented yet for PostgreSQL at %d op: %s.", i+1, op)
+			values, ok := clause[2].([]interface{})
+			if !ok || len(values) == 0 {
+				return filter, fmt.Errorf("The %d query clause's %s operator requires an array of values", i+1, op)
+			}
+
+			var literals []string
+			for _, v := range values {
+				literals = append(literals, quoteLiteral(v))
+			}
+
+			not := ""
+			if op == "!in" {
+				not = "NOT "
+			}
+			cond := fmt.Sprintf("%s %sIN (%s)", field, not, strings.Join(literals, ", "))
+			filter[cond] = sqlCondition{}
+		case "contains":
+			// the LIKE wildcards of the value are matched literally
+			pattern := likeEscaper.Replace(fmt.Sprintf("%v", clause[2]))
+			cond := fmt.Sprintf(`%s LIKE %s ESCAPE '\'`, field, quoteLiteral("%"+pattern+"%"))
+			filter[cond] = sqlCondition{}
 		default:
 			return filter, fmt.Errorf("The %d query clause's operator: %s is not supported at the moment.", i+1, op)
 		}
@@ -45,13 +122,48 @@ func (mg *PostgreSQL) ParseQuery(clauses [][]interface{}) (map[string]interface{
 	return filter, nil
 }
 
+// sqlCondition marks a filter key being a complete condition without a
+// value.
+type sqlCondition struct{}
+
 func applyFilter(where string, filters map[string]interface{}) string {
 	for field, val := range filters {
-		where += fmt.Sprintf(" AND %s '%v'", field, val)
+		if _, ok := val.(sqlCondition); ok {
+			where += fmt.Sprintf(" AND (%s)", field)
+			continue
+		}
+		where += fmt.Sprintf(" AND (%s %s)", field, quoteLiteral(val))
 	}
 	return where
 }
 
+// isNumber returns if v is a number, see internal.NormalizeNumbers.
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int, int32, int64, float32, float64, json.Number:
+		return true
+	}
+	return false
+}
+
+// jsonbLiteral returns the number v as a jsonb literal, the jsonb numbers
+// are compared as numbers.
+func jsonbLiteral(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "'null'::jsonb"
+	}
+	return quoteLiteral(string(b)) + "::jsonb"
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// quoteLiteral returns v as a SQL string literal, the data fields are
+// compared as text.
+func quoteLiteral(v interface{}) string {
+	return "'" + strings.Replace(fmt.Sprintf("%v", v), "'", "''", -1) + "'"
+}
+
 func secureRead(auth internal.Auth, col string) string {
 	if strings.HasPrefix(col, "pub_") && auth.Role < 100 {
 		return "WHERE 1=1 "
@@ -88,18 +200,163 @@ func secureWrite(auth internal.Auth, col string) string {
 	}
 }
 
-func setPaging(params internal.ListParams) string {
-	if len(params.SortBy) == 0 {
-		params.SortBy = "created"
-	}
+func setPaging(params internal.ListParams) (string, error) {
+	var keys []string
+	for _, sf := range params.SortFields() {
+		direction := "ASC"
+		if sf.Descending {
+			direction = "DESC"
+		}
 
-	direction := "ASC"
-	if params.SortDescending {
-		direction = "DESC"
+		switch sf.Field {
+		case internal.SortFieldID:
+			// ids are random uuid, the creation date gives the natural order
+			keys = append(keys, "created "+direction, "id "+direction)
+		case FieldAccountID:
+			keys = append(keys, "account_id "+direction)
+		case "created":
+			keys = append(keys, "created "+direction)
+		default:
+			field, err := dataField(sf.Field, false)
+			if err != nil {
+				return "", err
+			}
+			keys = append(keys, fmt.Sprintf("%s %s", field, direction))
+		}
 	}
 
-	orderBy := fmt.Sprintf("ORDER BY %s %s", params.SortBy, direction)
+	orderBy := "ORDER BY " + strings.Join(keys, ", ")
 
 	offset := (params.Page - 1) * params.Size
-	return fmt.Sprintf("%s\nLIMIT %d OFFSET %d", orderBy, params.Size, offset)
+	return fmt.Sprintf("%s\nLIMIT %d OFFSET %d", orderBy, params.Size, offset), nil
+}
+
+// selectColumns returns the columns to select, when fields are requested
+// only those keys of the data column are returned.
+func selectColumns(fields []string) (string, error) {
+	if len(fields) == 0 {
+		return "*", nil
+	}
+
+	var pairs []string
+	for _, field := range fields {
+		value, err := dataField(field, false)
+		if err != nil {
+			return "", err
+		}
+		pairs = append(pairs, fmt.Sprintf("'%s', %s", field, value))
+	}
+
+	return fmt.Sprintf(
+		"id, account_id, owner_id, jsonb_strip_nulls(jsonb_build_object(%s)) AS data, created",
+		strings.Join(pairs, ", "),
+	), nil
+}
+
+// dataField returns the JSON operator selecting field of the data column, a
+// dot path selects a nested field. The text operator returns the value as
+// text, used for comparisons. The field is part of the SQL, an invalid field
+// path is an error.
+func dataField(field string, text bool) (string, error) {
+	if !internal.ValidFieldPath(field) {
+		return "", fmt.Errorf("invalid field name: %s", field)
+	}
+
+	if !strings.Contains(field, ".") {
+		if text {
+			return fmt.Sprintf("data->>'%s'", field), nil
+		}
+		return fmt.Sprintf("data->'%s'", field), nil
+	}
+
+	path := strings.Replace(field, ".", ",", -1)
+	if text {
+		return fmt.Sprintf("data#>>'{%s}'", path), nil
+	}
+	return fmt.Sprintf("data#>'{%s}'", path), nil
+}
+
+// geoCoordinates returns the longitude and latitude expressions of the
+// GeoJSON point stored in field. The field is part of the SQL, an invalid
+// field path is an error.
+func geoCoordinates(field string) (lng, lat string, err error) {
+	if !internal.ValidFieldPath(field) {
+		return "", "", fmt.Errorf("invalid field name: %s", field)
+	}
+
+	path := strings.Replace(field, ".", ",", -1)
+	lng = fmt.Sprintf("(data#>>'{%s,coordinates,0}')::float8", path)
+	lat = fmt.Sprintf("(data#>>'{%s,coordinates,1}')::float8", path)
+	return
+}
+
+// geoPoint returns the earthdistance point of the GeoJSON point stored in
+// field, the geo index is created on this expression.
+func geoPoint(field string) (string, error) {
+	lng, lat, err := geoCoordinates(field)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("ll_to_earth(%s, %s)", lat, lng), nil
+}
+
+// nestFields moves the dot path keys returned by selectColumns into nested
+// objects.
+func nestFields(data map[string]interface{}) {
+	for k, v := range data {
+		if strings.Contains(k, ".") {
+			delete(data, k)
+			internal.SetPath(data, k, v)
+		}
+	}
+}
+
+// updateData returns the expression merging doc into the data column, a dot
+// path key sets a nested field and creates the missing objects. The values
+// are the parameters starting at $first.
+func updateData(doc map[string]interface{}, first int) (string, []interface{}, error) {
+	top := make(map[string]interface{})
+	var paths []string
+	for k, v := range doc {
+		if strings.Contains(k, ".") {
+			paths = append(paths, k)
+		} else {
+			top[k] = v
+		}
+	}
+	sort.Strings(paths)
+
+	b, err := json.Marshal(top)
+	if err != nil {
+		return "", nil, err
+	}
+
+	expr := fmt.Sprintf("data || $%d", first)
+	args := []interface{}{b}
+
+	for _, field := range paths {
+		if !internal.ValidFieldPath(field) {
+			return "", nil, fmt.Errorf("updating field %q is not allowed", field)
+		}
+
+		b, err := json.Marshal(doc[field])
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, b)
+
+		// the sub-select references the previous expression once
+		names := strings.Split(field, ".")
+		for i := 1; i < len(names); i++ {
+			prefix := strings.Join(names[:i], ",")
+			expr = fmt.Sprintf(
+				"(SELECT jsonb_set(e, '{%s}', COALESCE(e#>'{%s}', '{}'::jsonb)) FROM (SELECT %s AS e) AS s)",
+				prefix, prefix, expr,
+			)
+		}
+
+		expr = fmt.Sprintf("jsonb_set(%s, '{%s}', $%d::jsonb)", expr, strings.Join(names, ","), first+len(args)-1)
+	}
+
+	return expr, args, nil
 }
@@ -1,23 +1,38 @@
 package postgresql
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/lib/pq"
 	"github.com/staticbackendhq/core/internal"
 )
 
 func (pg *PostgreSQL) CreateCustomer(customer internal.Customer) (c internal.Customer, err error) {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
 	var id string
 	c = customer
+	c.Email = internal.NormalizeEmail(customer.Email)
+
+	if exists, err := pg.EmailExists(c.Email); err != nil {
+		return c, err
+	} else if exists {
+		return c, internal.ErrEmailTaken
+	}
 
-	err = pg.DB.QueryRow(`
+	err = pg.DB.QueryRowContext(ctx, `
 	INSERT INTO sb.customers(email, stripe_id, sub_id, plan, is_active, created)
 	VALUES($1, $2, $3, $4, $5, $6)
 	RETURNING id;
-	`, customer.Email,
+	`, c.Email,
 		customer.StripeID,
 		customer.SubscriptionID,
 		customer.Plan,
@@ -32,17 +47,23 @@ func (pg *PostgreSQL) CreateCustomer(customer internal.Customer) (c internal.Cus
 }
 
 func (pg *PostgreSQL) CreateBase(base internal.BaseConfig) (b internal.BaseConfig, err error) {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
 	b = base
 
-	_, err = pg.DB.Exec(fmt.Sprintf("CREATE SCHEMA %s;", b.Name))
+	// the app insert, schema and tables creation are done in a transaction
+	// so a concurrent creation with the same name cannot leave a partial base
+	tx, err := pg.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return
 	}
+	defer tx.Rollback()
 
 	var id string
-	err = pg.DB.QueryRow(`
-	INSERT INTO sb.apps(customer_id, name, allowed_domain, is_active, monthly_email_sent, created)
-	VALUES($1, $2, $3, $4, $5, $6)
+	err = tx.QueryRowContext(ctx, `
+	INSERT INTO sb.apps(customer_id, name, allowed_domain, is_active, monthly_email_sent, created, allowed_upload_types, max_upload_size, display_name)
+	VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	RETURNING id;
 	`, base.CustomerID,
 		base.Name,
@@ -50,18 +71,44 @@ func (pg *PostgreSQL) CreateBase(base internal.BaseConfig) (b internal.BaseConfi
 		base.IsActive,
 		base.MonthlySentEmail,
 		base.Created,
+		pq.Array(base.AllowedUploadTypes),
+		base.MaxUploadSize,
+		base.DisplayName,
 	).Scan(&id)
 	if err != nil {
+		err = baseNameTaken(err)
 		return
 	}
 
 	b.ID = id
 
-	err = pg.createSystemTables(base.Name)
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf("CREATE SCHEMA %s;", b.Name)); err != nil {
+		err = baseNameTaken(err)
+		return
+	}
+
+	if err = pg.createSystemTables(tx, base.Name); err != nil {
+		return
+	}
+
+	err = tx.Commit()
 	return
 }
 
-func (pg *PostgreSQL) createSystemTables(schema string) error {
+// baseNameTaken converts unique violation and duplicate schema errors
+// into internal.ErrBaseNameTaken.
+func baseNameTaken(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "23505", "42P06":
+			return internal.ErrBaseNameTaken
+		}
+	}
+	return err
+}
+
+func (pg *PostgreSQL) createSystemTables(tx *sql.Tx, schema string) error {
 	qry := strings.Replace(`
 		CREATE TABLE IF NOT EXISTS {schema}.sb_accounts (
 			id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
@@ -77,7 +124,8 @@ func (pg *PostgreSQL) createSystemTables(schema string) error {
 			password TEXT NOT NULL,
 			role INTEGER NOT NULL,
 			reset_code TEXT NOT NULL,
-			created timestamp NOT NULL			
+			created timestamp NOT NULL,
+			label TEXT NOT NULL DEFAULT ''
 		);
 
 		CREATE TABLE IF NOT EXISTS {schema}.sb_forms (
@@ -128,9 +176,47 @@ func (pg *PostgreSQL) createSystemTables(schema string) error {
 			interval TEXT NOT NULL,
 			last_run timestamp NOT NULL
 		);
+
+		CREATE TABLE IF NOT EXISTS {schema}.sb_webhooks (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+			col TEXT NOT NULL,
+			event TEXT NOT NULL,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			fields TEXT[] NOT NULL,
+			created timestamp NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS {schema}.sb_logins (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+			user_id uuid REFERENCES {schema}.sb_tokens(id) ON DELETE CASCADE,
+			ip TEXT NOT NULL,
+			user_agent TEXT NOT NULL,
+			created timestamp NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS sb_logins_user_idx ON {schema}.sb_logins (user_id, created DESC);
+
+		CREATE TABLE IF NOT EXISTS {schema}.sb_login_alerts_optout (
+			user_id uuid PRIMARY KEY REFERENCES {schema}.sb_tokens(id) ON DELETE CASCADE
+		);
+
+		CREATE TABLE IF NOT EXISTS {schema}.sb_login_codes (
+			user_id uuid PRIMARY KEY REFERENCES {schema}.sb_tokens(id) ON DELETE CASCADE,
+			hash TEXT NOT NULL,
+			expires timestamp NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS {schema}.sb_impersonations (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+			impersonated_by TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			email TEXT NOT NULL,
+			expires timestamp NOT NULL,
+			created timestamp NOT NULL
+		);
 	`, "{schema}", schema, -1)
 
-	if _, err := pg.DB.Exec(qry); err != nil {
+	if _, err := tx.Exec(qry); err != nil {
 		return err
 	}
 
@@ -138,9 +224,12 @@ func (pg *PostgreSQL) createSystemTables(schema string) error {
 }
 
 func (pg *PostgreSQL) EmailExists(email string) (bool, error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	var count int
-	err := pg.DB.QueryRow(`
-		SELECT COUNT(*) FROM sb.customers WHERE email = $1
+	err := pg.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM sb.customers WHERE LOWER(email) = LOWER($1)
 	`, email).Scan(&count)
 	if err != nil {
 		return false, err
@@ -149,7 +238,10 @@ func (pg *PostgreSQL) EmailExists(email string) (bool, error) {
 }
 
 func (pg *PostgreSQL) FindAccount(customerID string) (customer internal.Customer, err error) {
-	row := pg.DB.QueryRow(`
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
+	row := pg.DB.QueryRowContext(ctx, `
 		SELECT * 
 		FROM sb.customers
 		WHERE id = $1
@@ -160,19 +252,45 @@ func (pg *PostgreSQL) FindAccount(customerID string) (customer internal.Customer
 }
 
 func (pg *PostgreSQL) FindDatabase(baseID string) (base internal.BaseConfig, err error) {
-	row := pg.DB.QueryRow(`
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
+	row := pg.DB.QueryRowContext(ctx, `
 		SELECT * 
 		FROM sb.apps 
 		WHERE id = $1
 	`, baseID)
 
-	err = scanBase(row, &base)
+	if err = scanBase(row, &base); errors.Is(err, sql.ErrNoRows) {
+		err = internal.ErrBaseNotFound
+	}
+	return
+}
+
+func (pg *PostgreSQL) FindDatabaseByKey(key string) (base internal.BaseConfig, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
+	row := pg.DB.QueryRowContext(ctx, `
+		SELECT * 
+		FROM sb.apps 
+		WHERE public_key = $1 
+		OR (public_key = '' AND id::text = $1)
+		OR (previous_public_key = $1 AND previous_key_expires > $2)
+	`, key, time.Now())
+
+	if err = scanBase(row, &base); errors.Is(err, sql.ErrNoRows) {
+		err = internal.ErrBaseNotFound
+	}
 	return
 }
 
 func (pg *PostgreSQL) DatabaseExists(name string) (exists bool, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	var count int
-	err = pg.DB.QueryRow(`
+	err = pg.DB.QueryRowContext(ctx, `
 		SELECT COUNT(*) 
 		FROM sb.apps 
 		WHERE name = $1
@@ -183,7 +301,10 @@ func (pg *PostgreSQL) DatabaseExists(name string) (exists bool, err error) {
 }
 
 func (pg *PostgreSQL) ListDatabases() (results []internal.BaseConfig, err error) {
-	rows, err := pg.DB.Query(`
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
+	rows, err := pg.DB.QueryContext(ctx, `
 		SELECT * 
 		FROM sb.apps 
 		WHERE is_active = true
@@ -207,7 +328,10 @@ func (pg *PostgreSQL) ListDatabases() (results []internal.BaseConfig, err error)
 }
 
 func (pg *PostgreSQL) IncrementMonthlyEmailSent(baseID string) error {
-	_, err := pg.DB.Exec(`
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	_, err := pg.DB.ExecContext(ctx, `
 		UPDATE sb.apps SET monthly_email_sent = monthly_email_sent + 1
 		WHERE id = $1;
 	`, baseID)
@@ -215,8 +339,96 @@ func (pg *PostgreSQL) IncrementMonthlyEmailSent(baseID string) error {
 	return err
 }
 
+func (pg *PostgreSQL) SetUploadLimits(baseID string, types []string, maxSize int64) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	_, err := pg.DB.ExecContext(ctx, `
+		UPDATE sb.apps SET allowed_upload_types = $2, max_upload_size = $3
+		WHERE id = $1;
+	`, baseID, pq.Array(types), maxSize)
+
+	return err
+}
+
+func (pg *PostgreSQL) SetSessionBinding(baseID, binding string) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	_, err := pg.DB.ExecContext(ctx, `
+		UPDATE sb.apps SET session_binding = $2
+		WHERE id = $1;
+	`, baseID, binding)
+
+	return err
+}
+
+func (pg *PostgreSQL) SetFeatures(baseID string, features map[string]bool) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	b, err := json.Marshal(features)
+	if err != nil {
+		return err
+	}
+
+	_, err = pg.DB.ExecContext(ctx, `
+		UPDATE sb.apps SET features = $2
+		WHERE id = $1;
+	`, baseID, b)
+
+	return err
+}
+
+func (pg *PostgreSQL) SetPublicAliases(baseID string, aliases map[string]string) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	b, err := json.Marshal(aliases)
+	if err != nil {
+		return err
+	}
+
+	_, err = pg.DB.ExecContext(ctx, `
+		UPDATE sb.apps SET public_aliases = $2
+		WHERE id = $1;
+	`, baseID, b)
+
+	return err
+}
+
+func (pg *PostgreSQL) RenameBase(baseID, displayName string) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	_, err := pg.DB.ExecContext(ctx, `
+		UPDATE sb.apps SET display_name = $2
+		WHERE id = $1;
+	`, baseID, displayName)
+
+	return err
+}
+
+func (pg *PostgreSQL) RotatePublicKey(baseID, key string, previousExpires time.Time) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	_, err := pg.DB.ExecContext(ctx, `
+		UPDATE sb.apps SET 
+			previous_public_key = CASE WHEN public_key = '' THEN id::text ELSE public_key END,
+			previous_key_expires = $3,
+			public_key = $2
+		WHERE id = $1;
+	`, baseID, key, previousExpires)
+
+	return err
+}
+
 func (pg *PostgreSQL) GetCustomerByStripeID(stripeID string) (cus internal.Customer, err error) {
-	row := pg.DB.QueryRow(`
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
+	row := pg.DB.QueryRowContext(ctx, `
 		SELECT * 
 		FROM sb.customers 
 		WHERE stripe_id = $1
@@ -227,16 +439,19 @@ func (pg *PostgreSQL) GetCustomerByStripeID(stripeID string) (cus internal.Custo
 }
 
 func (pg *PostgreSQL) ActivateCustomer(customerID string, active bool) error {
-	tx, err := pg.DB.Begin()
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	tx, err := pg.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
-	if _, err := tx.Exec(`UPDATE sb.customers SET is_active = $2 WHERE id = $1;`, customerID, active); err != nil {
+	if _, err := tx.ExecContext(ctx, `UPDATE sb.customers SET is_active = $2 WHERE id = $1;`, customerID, active); err != nil {
 		return err
 	}
 
-	if _, err := tx.Exec(`UPDATE sb.apps SET is_active = $2 WHERE customer_id = $1;`, customerID, active); err != nil {
+	if _, err := tx.ExecContext(ctx, `UPDATE sb.apps SET is_active = $2 WHERE customer_id = $1;`, customerID, active); err != nil {
 		return err
 	}
 
@@ -244,15 +459,21 @@ func (pg *PostgreSQL) ActivateCustomer(customerID string, active bool) error {
 }
 
 func (pg *PostgreSQL) ChangeCustomerPlan(customerID string, plan int) error {
-	if _, err := pg.DB.Exec(`UPDATE sb.customers SET plan = $2 WHERE id = $1`, customerID, plan); err != nil {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	if _, err := pg.DB.ExecContext(ctx, `UPDATE sb.customers SET plan = $2 WHERE id = $1`, customerID, plan); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (pg *PostgreSQL) NewID() string {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	var id string
-	if err := pg.DB.QueryRow(`SELECT uuid_generate_v4 ()`).Scan(&id); err != nil {
+	if err := pg.DB.QueryRowContext(ctx, `SELECT uuid_generate_v4 ()`).Scan(&id); err != nil {
 		//TODO: do something with this error
 		log.Println("error in postgresql.NewID: ", err)
 		return ""
@@ -261,13 +482,16 @@ func (pg *PostgreSQL) NewID() string {
 }
 
 func (pg *PostgreSQL) DeleteCustomer(dbName, email string) error {
-	_, err := pg.DB.Exec(fmt.Sprintf(`DROP SCHEMA IF EXISTS %s CASCADE;`, dbName))
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	_, err := pg.DB.ExecContext(ctx, fmt.Sprintf(`DROP SCHEMA IF EXISTS %s CASCADE;`, dbName))
 	if err != nil {
 		return err
 	}
 
-	_, err = pg.DB.Exec(`
-		DELETE FROM sb.customers WHERE email = $1;
+	_, err = pg.DB.ExecContext(ctx, `
+		DELETE FROM sb.customers WHERE LOWER(email) = LOWER($1);
 	`, email)
 
 	return err
@@ -286,7 +510,8 @@ func scanCustomer(rows Scanner, c *internal.Customer) error {
 }
 
 func scanBase(rows Scanner, b *internal.BaseConfig) error {
-	return rows.Scan(
+	var features, aliases []byte
+	err := rows.Scan(
 		&b.ID,
 		&b.CustomerID,
 		&b.Name,
@@ -294,7 +519,24 @@ func scanBase(rows Scanner, b *internal.BaseConfig) error {
 		&b.IsActive,
 		&b.MonthlySentEmail,
 		&b.Created,
+		pq.Array(&b.AllowedUploadTypes),
+		&b.MaxUploadSize,
+		&b.DisplayName,
+		&b.PublicKey,
+		&b.PreviousPublicKey,
+		&b.PreviousKeyExpires,
+		&b.SessionBinding,
+		&features,
+		&aliases,
 	)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(features, &b.Features); err != nil {
+		return err
+	}
+	return json.Unmarshal(aliases, &b.PublicAliases)
 }
 
 func (pg *PostgreSQL) GetAllDatabaseSizes() error {
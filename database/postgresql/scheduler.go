@@ -1,6 +1,7 @@
 package postgresql
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/staticbackendhq/core/internal"
@@ -25,12 +26,15 @@ func (pg *PostgreSQL) ListTasks() (results []internal.Task, err error) {
 }
 
 func (pg *PostgreSQL) ListTasksByBase(dbName string) (results []internal.Task, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		SELECT * 
 		FROM %s.sb_tasks 
 	`, dbName)
 
-	rows, err := pg.DB.Query(qry)
+	rows, err := pg.DB.QueryContext(ctx, qry)
 	if err != nil {
 		return
 	}
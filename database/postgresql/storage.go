@@ -1,19 +1,23 @@
 package postgresql
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/staticbackendhq/core/internal"
 )
 
 func (pg *PostgreSQL) AddFile(dbName string, f internal.File) (id string, err error) {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		INSERT INTO %s.sb_files(account_id, key, url, size, uploaded)
 		VALUES($1, $2, $3, $4, $5)
 		RETURNING id;
 	`, dbName)
 
-	err = pg.DB.QueryRow(
+	err = pg.DB.QueryRowContext(ctx,
 		qry,
 		f.AccountID,
 		f.Key,
@@ -25,13 +29,16 @@ func (pg *PostgreSQL) AddFile(dbName string, f internal.File) (id string, err er
 }
 
 func (pg *PostgreSQL) GetFileByID(dbName, fileID string) (f internal.File, err error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		SELECT * 
 		FROM %s.sb_files 
 		WHERE id = $1
 	`, dbName)
 
-	row := pg.DB.QueryRow(qry, fileID)
+	row := pg.DB.QueryRowContext(ctx, qry, fileID)
 
 	err = scanFile(row, &f)
 	return
@@ -39,12 +46,15 @@ func (pg *PostgreSQL) GetFileByID(dbName, fileID string) (f internal.File, err e
 }
 
 func (pg *PostgreSQL) DeleteFile(dbName, fileID string) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
 	qry := fmt.Sprintf(`
 		DELETE FROM %s.sb_files 
 		WHERE id = $1
 	`, dbName)
 
-	if _, err := pg.DB.Exec(qry, fileID); err != nil {
+	if _, err := pg.DB.ExecContext(ctx, qry, fileID); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,83 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/staticbackendhq/core/internal"
+)
+
+func (pg *PostgreSQL) AddWebhook(dbName string, wh internal.Webhook) (id string, err error) {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	if wh.Fields == nil {
+		wh.Fields = []string{}
+	}
+
+	qry := fmt.Sprintf(`
+		INSERT INTO %s.sb_webhooks(col, event, url, secret, fields, created)
+		VALUES($1, $2, $3, $4, $5, $6)
+		RETURNING id;
+	`, dbName)
+
+	err = pg.DB.QueryRowContext(ctx,
+		qry,
+		wh.Collection,
+		wh.Event,
+		wh.URL,
+		wh.Secret,
+		pq.Array(wh.Fields),
+		time.Now(),
+	).Scan(&id)
+	return
+}
+
+func (pg *PostgreSQL) ListWebhooks(dbName string) ([]internal.Webhook, error) {
+	ctx, cancel := internal.ReadContext(context.Background())
+	defer cancel()
+
+	qry := fmt.Sprintf(`
+		SELECT id, col, event, url, secret, fields, created
+		FROM %s.sb_webhooks
+		ORDER BY created
+	`, dbName)
+
+	rows, err := pg.DB.QueryContext(ctx, qry)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []internal.Webhook
+	for rows.Next() {
+		var wh internal.Webhook
+		if err := rows.Scan(&wh.ID, &wh.Collection, &wh.Event, &wh.URL, &wh.Secret, pq.Array(&wh.Fields), &wh.Created); err != nil {
+			return nil, err
+		}
+		list = append(list, wh)
+	}
+	return list, rows.Err()
+}
+
+func (pg *PostgreSQL) DeleteWebhook(dbName, id string) error {
+	ctx, cancel := internal.WriteContext(context.Background())
+	defer cancel()
+
+	qry := fmt.Sprintf(`DELETE FROM %s.sb_webhooks WHERE id = $1`, dbName)
+
+	res, err := pg.DB.ExecContext(ctx, qry, id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New("webhook not found")
+	}
+	return nil
+}
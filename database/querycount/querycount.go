@@ -0,0 +1,532 @@
+// Package querycount counts the datastore operations of each HTTP request
+// and the time they took, see DEBUG_QUERY_HEADERS.
+package querycount
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+// Stats are the datastore operations of a request.
+type Stats struct {
+	mu       sync.Mutex
+	count    int
+	duration time.Duration
+}
+
+// Get returns the number of operations and their total time.
+func (s *Stats) Get() (int, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count, s.duration
+}
+
+func (s *Stats) add(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	s.duration += d
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying stats.
+func NewContext(ctx context.Context, stats *Stats) context.Context {
+	return context.WithValue(ctx, contextKey{}, stats)
+}
+
+// FromContext returns the Stats carried by ctx.
+func FromContext(ctx context.Context) (*Stats, bool) {
+	stats, ok := ctx.Value(contextKey{}).(*Stats)
+	return stats, ok
+}
+
+// Persister wraps a datastore and counts its operations in the Stats of
+// the request calling them, see WithContext. NewID, ParseQuery and
+// BaseMigrations do not reach the database and are not counted.
+type Persister struct {
+	internal.Persister
+	stats *Stats
+}
+
+// New returns p counting its operations.
+func New(p internal.Persister) *Persister {
+	return &Persister{Persister: p}
+}
+
+// WithContext returns the datastore counting its operations in the Stats
+// of ctx. The Persister methods do not receive the request context so the
+// handlers need to call the returned datastore for them to be counted.
+func (p *Persister) WithContext(ctx context.Context) *Persister {
+	stats, ok := FromContext(ctx)
+	if !ok {
+		return p
+	}
+	return &Persister{Persister: p.Persister, stats: stats}
+}
+
+// track returns the func to defer adding the operation to the Stats of p
+// once it's done.
+func (p *Persister) track() func() {
+	if p.stats == nil {
+		return func() {}
+	}
+
+	start := time.Now()
+	return func() {
+		p.stats.add(time.Since(start))
+	}
+}
+
+func (p *Persister) Ping() error {
+	defer p.track()()
+	return p.Persister.Ping()
+}
+
+func (p *Persister) CreateIndex(dbName, col, field string, unique bool) error {
+	defer p.track()()
+	return p.Persister.CreateIndex(dbName, col, field, unique)
+}
+
+func (p *Persister) CreateGeoIndex(dbName, col, field string) error {
+	defer p.track()()
+	return p.Persister.CreateGeoIndex(dbName, col, field)
+}
+
+func (p *Persister) ListIndexes(dbName, col string) ([]internal.Index, error) {
+	defer p.track()()
+	return p.Persister.ListIndexes(dbName, col)
+}
+
+func (p *Persister) DropIndex(dbName, col, name string) error {
+	defer p.track()()
+	return p.Persister.DropIndex(dbName, col, name)
+}
+
+func (p *Persister) CreateCustomer(cus internal.Customer) (internal.Customer, error) {
+	defer p.track()()
+	return p.Persister.CreateCustomer(cus)
+}
+
+func (p *Persister) CreateBase(base internal.BaseConfig) (internal.BaseConfig, error) {
+	defer p.track()()
+	return p.Persister.CreateBase(base)
+}
+
+func (p *Persister) EmailExists(email string) (bool, error) {
+	defer p.track()()
+	return p.Persister.EmailExists(email)
+}
+
+func (p *Persister) FindAccount(customerID string) (internal.Customer, error) {
+	defer p.track()()
+	return p.Persister.FindAccount(customerID)
+}
+
+func (p *Persister) FindDatabase(baseID string) (internal.BaseConfig, error) {
+	defer p.track()()
+	return p.Persister.FindDatabase(baseID)
+}
+
+func (p *Persister) FindDatabaseByKey(key string) (internal.BaseConfig, error) {
+	defer p.track()()
+	return p.Persister.FindDatabaseByKey(key)
+}
+
+func (p *Persister) DatabaseExists(name string) (bool, error) {
+	defer p.track()()
+	return p.Persister.DatabaseExists(name)
+}
+
+func (p *Persister) ListDatabases() ([]internal.BaseConfig, error) {
+	defer p.track()()
+	return p.Persister.ListDatabases()
+}
+
+func (p *Persister) IncrementMonthlyEmailSent(baseID string) error {
+	defer p.track()()
+	return p.Persister.IncrementMonthlyEmailSent(baseID)
+}
+
+func (p *Persister) SetUploadLimits(baseID string, types []string, maxSize int64) error {
+	defer p.track()()
+	return p.Persister.SetUploadLimits(baseID, types, maxSize)
+}
+
+func (p *Persister) SetSessionBinding(baseID, binding string) error {
+	defer p.track()()
+	return p.Persister.SetSessionBinding(baseID, binding)
+}
+
+func (p *Persister) SetFeatures(baseID string, features map[string]bool) error {
+	defer p.track()()
+	return p.Persister.SetFeatures(baseID, features)
+}
+
+func (p *Persister) SetPublicAliases(baseID string, aliases map[string]string) error {
+	defer p.track()()
+	return p.Persister.SetPublicAliases(baseID, aliases)
+}
+
+func (p *Persister) RenameBase(baseID, displayName string) error {
+	defer p.track()()
+	return p.Persister.RenameBase(baseID, displayName)
+}
+
+func (p *Persister) RotatePublicKey(baseID, key string, previousExpires time.Time) error {
+	defer p.track()()
+	return p.Persister.RotatePublicKey(baseID, key, previousExpires)
+}
+
+func (p *Persister) GetCustomerByStripeID(stripeID string) (cus internal.Customer, err error) {
+	defer p.track()()
+	return p.Persister.GetCustomerByStripeID(stripeID)
+}
+
+func (p *Persister) ActivateCustomer(customerID string, active bool) error {
+	defer p.track()()
+	return p.Persister.ActivateCustomer(customerID, active)
+}
+
+func (p *Persister) ChangeCustomerPlan(customerID string, plan int) error {
+	defer p.track()()
+	return p.Persister.ChangeCustomerPlan(customerID, plan)
+}
+
+func (p *Persister) DeleteCustomer(dbName, email string) error {
+	defer p.track()()
+	return p.Persister.DeleteCustomer(dbName, email)
+}
+
+func (p *Persister) FindToken(dbName, tokenID, token string) (internal.Token, error) {
+	defer p.track()()
+	return p.Persister.FindToken(dbName, tokenID, token)
+}
+
+func (p *Persister) FindRootToken(dbName, tokenID, accountID, token string) (internal.Token, error) {
+	defer p.track()()
+	return p.Persister.FindRootToken(dbName, tokenID, accountID, token)
+}
+
+func (p *Persister) GetRootForBase(dbName string) (internal.Token, error) {
+	defer p.track()()
+	return p.Persister.GetRootForBase(dbName)
+}
+
+func (p *Persister) FindTokenByEmail(dbName, email string) (internal.Token, error) {
+	defer p.track()()
+	return p.Persister.FindTokenByEmail(dbName, email)
+}
+
+func (p *Persister) UserEmailExists(dbName, email string) (exists bool, err error) {
+	defer p.track()()
+	return p.Persister.UserEmailExists(dbName, email)
+}
+
+func (p *Persister) GetFirstTokenFromAccountID(dbName, accountID string) (tok internal.Token, err error) {
+	defer p.track()()
+	return p.Persister.GetFirstTokenFromAccountID(dbName, accountID)
+}
+
+func (p *Persister) ListTokens(dbName, accountID string) ([]internal.Token, error) {
+	defer p.track()()
+	return p.Persister.ListTokens(dbName, accountID)
+}
+
+func (p *Persister) CreateUserAccount(dbName, email string) (id string, err error) {
+	defer p.track()()
+	return p.Persister.CreateUserAccount(dbName, email)
+}
+
+func (p *Persister) CreateUserToken(dbName string, tok internal.Token) (id string, err error) {
+	defer p.track()()
+	return p.Persister.CreateUserToken(dbName, tok)
+}
+
+func (p *Persister) CreateUsers(dbName string, toks []internal.Token) ([]internal.Token, error) {
+	defer p.track()()
+	return p.Persister.CreateUsers(dbName, toks)
+}
+
+func (p *Persister) SetPasswordResetCode(dbName, tokenID, code string) error {
+	defer p.track()()
+	return p.Persister.SetPasswordResetCode(dbName, tokenID, code)
+}
+
+func (p *Persister) ResetPassword(dbName, email, code, password string) error {
+	defer p.track()()
+	return p.Persister.ResetPassword(dbName, email, code, password)
+}
+
+func (p *Persister) SetUserRole(dbName, email string, role int) error {
+	defer p.track()()
+	return p.Persister.SetUserRole(dbName, email, role)
+}
+
+func (p *Persister) DemoteUser(dbName, email string, role, adminRole int) error {
+	defer p.track()()
+	return p.Persister.DemoteUser(dbName, email, role, adminRole)
+}
+
+func (p *Persister) UserSetPassword(dbName, tokenID, password string) error {
+	defer p.track()()
+	return p.Persister.UserSetPassword(dbName, tokenID, password)
+}
+
+func (p *Persister) UserSetEmail(dbName, tokenID, email string) error {
+	defer p.track()()
+	return p.Persister.UserSetEmail(dbName, tokenID, email)
+}
+
+func (p *Persister) SetUserToken(dbName, tokenID, token string) error {
+	defer p.track()()
+	return p.Persister.SetUserToken(dbName, tokenID, token)
+}
+
+func (p *Persister) DeleteToken(dbName, tokenID string) error {
+	defer p.track()()
+	return p.Persister.DeleteToken(dbName, tokenID)
+}
+
+func (p *Persister) AddLoginEvent(dbName string, ev internal.LoginEvent, keep int) error {
+	defer p.track()()
+	return p.Persister.AddLoginEvent(dbName, ev, keep)
+}
+
+func (p *Persister) ListLoginEvents(dbName, userID string) ([]internal.LoginEvent, error) {
+	defer p.track()()
+	return p.Persister.ListLoginEvents(dbName, userID)
+}
+
+func (p *Persister) SetLoginAlerts(dbName, userID string, enabled bool) error {
+	defer p.track()()
+	return p.Persister.SetLoginAlerts(dbName, userID, enabled)
+}
+
+func (p *Persister) LoginAlertsEnabled(dbName, userID string) (bool, error) {
+	defer p.track()()
+	return p.Persister.LoginAlertsEnabled(dbName, userID)
+}
+
+func (p *Persister) SetLoginCode(dbName string, code internal.LoginCode) error {
+	defer p.track()()
+	return p.Persister.SetLoginCode(dbName, code)
+}
+
+func (p *Persister) UseLoginCode(dbName, userID, hash string, now time.Time) error {
+	defer p.track()()
+	return p.Persister.UseLoginCode(dbName, userID, hash, now)
+}
+
+func (p *Persister) AddImpersonation(dbName string, imp internal.Impersonation) error {
+	defer p.track()()
+	return p.Persister.AddImpersonation(dbName, imp)
+}
+
+func (p *Persister) ListImpersonations(dbName string) ([]internal.Impersonation, error) {
+	defer p.track()()
+	return p.Persister.ListImpersonations(dbName)
+}
+
+func (p *Persister) CreateDocument(auth internal.Auth, dbName, col string, doc map[string]interface{}) (map[string]interface{}, error) {
+	defer p.track()()
+	return p.Persister.CreateDocument(auth, dbName, col, doc)
+}
+
+func (p *Persister) CreateDocumentIfAbsent(auth internal.Auth, dbName, col string, filter map[string]interface{}, doc map[string]interface{}) (map[string]interface{}, bool, error) {
+	defer p.track()()
+	return p.Persister.CreateDocumentIfAbsent(auth, dbName, col, filter, doc)
+}
+
+func (p *Persister) BulkCreateDocument(auth internal.Auth, dbName, col string, docs []interface{}) error {
+	defer p.track()()
+	return p.Persister.BulkCreateDocument(auth, dbName, col, docs)
+}
+
+func (p *Persister) ListDocuments(auth internal.Auth, dbName, col string, params internal.ListParams) (internal.PagedResult, error) {
+	defer p.track()()
+	return p.Persister.ListDocuments(auth, dbName, col, params)
+}
+
+func (p *Persister) QueryDocuments(auth internal.Auth, dbName, col string, filter map[string]interface{}, params internal.ListParams) (internal.PagedResult, error) {
+	defer p.track()()
+	return p.Persister.QueryDocuments(auth, dbName, col, filter, params)
+}
+
+func (p *Persister) ExplainQuery(auth internal.Auth, dbName, col string, filter map[string]interface{}, params internal.ListParams) (map[string]interface{}, error) {
+	defer p.track()()
+	return p.Persister.ExplainQuery(auth, dbName, col, filter, params)
+}
+
+func (p *Persister) GetDocumentByID(auth internal.Auth, dbName, col, id string) (map[string]interface{}, error) {
+	defer p.track()()
+	return p.Persister.GetDocumentByID(auth, dbName, col, id)
+}
+
+func (p *Persister) GetDocumentsByIDs(auth internal.Auth, dbName, col string, ids []string) ([]map[string]interface{}, error) {
+	defer p.track()()
+	return p.Persister.GetDocumentsByIDs(auth, dbName, col, ids)
+}
+
+func (p *Persister) UpdateDocument(auth internal.Auth, dbName, col, id string, doc map[string]interface{}) (map[string]interface{}, error) {
+	defer p.track()()
+	return p.Persister.UpdateDocument(auth, dbName, col, id, doc)
+}
+
+func (p *Persister) ReplaceDocument(auth internal.Auth, dbName, col, id string, doc map[string]interface{}) (map[string]interface{}, error) {
+	defer p.track()()
+	return p.Persister.ReplaceDocument(auth, dbName, col, id, doc)
+}
+
+func (p *Persister) IncrementValue(auth internal.Auth, dbName, col, id, field string, n int) error {
+	defer p.track()()
+	return p.Persister.IncrementValue(auth, dbName, col, id, field, n)
+}
+
+func (p *Persister) DeleteDocument(auth internal.Auth, dbName, col, id string) (int64, error) {
+	defer p.track()()
+	return p.Persister.DeleteDocument(auth, dbName, col, id)
+}
+
+func (p *Persister) DeleteByFilter(auth internal.Auth, dbName, col string, filter map[string]interface{}) (int64, error) {
+	defer p.track()()
+	return p.Persister.DeleteByFilter(auth, dbName, col, filter)
+}
+
+func (p *Persister) DeleteExpired(dbName, col, field string, before time.Time) (int64, error) {
+	defer p.track()()
+	return p.Persister.DeleteExpired(dbName, col, field, before)
+}
+
+func (p *Persister) UpdateByFilter(auth internal.Auth, dbName, col string, filter map[string]interface{}, doc map[string]interface{}) (int64, error) {
+	defer p.track()()
+	return p.Persister.UpdateByFilter(auth, dbName, col, filter, doc)
+}
+
+func (p *Persister) ListCollections(dbName string) ([]string, error) {
+	defer p.track()()
+	return p.Persister.ListCollections(dbName)
+}
+
+func (p *Persister) Stats(dbName string) (internal.BaseStats, error) {
+	defer p.track()()
+	return p.Persister.Stats(dbName)
+}
+
+func (p *Persister) TruncateCollection(dbName, col string) (int64, error) {
+	defer p.track()()
+	return p.Persister.TruncateCollection(dbName, col)
+}
+
+func (p *Persister) DropCollection(dbName, col string) error {
+	defer p.track()()
+	return p.Persister.DropCollection(dbName, col)
+}
+
+func (p *Persister) AddFormSubmission(dbName, form string, doc map[string]interface{}) error {
+	defer p.track()()
+	return p.Persister.AddFormSubmission(dbName, form, doc)
+}
+
+func (p *Persister) ListFormSubmissions(dbName, name string) ([]map[string]interface{}, error) {
+	defer p.track()()
+	return p.Persister.ListFormSubmissions(dbName, name)
+}
+
+func (p *Persister) GetForms(dbName string) ([]string, error) {
+	defer p.track()()
+	return p.Persister.GetForms(dbName)
+}
+
+func (p *Persister) AddFunction(dbName string, data internal.ExecData) (string, error) {
+	defer p.track()()
+	return p.Persister.AddFunction(dbName, data)
+}
+
+func (p *Persister) UpdateFunction(dbName, id, code, trigger string) error {
+	defer p.track()()
+	return p.Persister.UpdateFunction(dbName, id, code, trigger)
+}
+
+func (p *Persister) GetFunctionForExecution(dbName, name string) (internal.ExecData, error) {
+	defer p.track()()
+	return p.Persister.GetFunctionForExecution(dbName, name)
+}
+
+func (p *Persister) GetFunctionByID(dbName, id string) (internal.ExecData, error) {
+	defer p.track()()
+	return p.Persister.GetFunctionByID(dbName, id)
+}
+
+func (p *Persister) GetFunctionByName(dbName, name string) (internal.ExecData, error) {
+	defer p.track()()
+	return p.Persister.GetFunctionByName(dbName, name)
+}
+
+func (p *Persister) ListFunctions(dbName string) ([]internal.ExecData, error) {
+	defer p.track()()
+	return p.Persister.ListFunctions(dbName)
+}
+
+func (p *Persister) ListFunctionsByTrigger(dbName, trigger string) ([]internal.ExecData, error) {
+	defer p.track()()
+	return p.Persister.ListFunctionsByTrigger(dbName, trigger)
+}
+
+func (p *Persister) DeleteFunction(dbName, name string) error {
+	defer p.track()()
+	return p.Persister.DeleteFunction(dbName, name)
+}
+
+func (p *Persister) RanFunction(dbName, id string, rh internal.ExecHistory) error {
+	defer p.track()()
+	return p.Persister.RanFunction(dbName, id, rh)
+}
+
+func (p *Persister) AddWebhook(dbName string, wh internal.Webhook) (id string, err error) {
+	defer p.track()()
+	return p.Persister.AddWebhook(dbName, wh)
+}
+
+func (p *Persister) ListWebhooks(dbName string) ([]internal.Webhook, error) {
+	defer p.track()()
+	return p.Persister.ListWebhooks(dbName)
+}
+
+func (p *Persister) DeleteWebhook(dbName, id string) error {
+	defer p.track()()
+	return p.Persister.DeleteWebhook(dbName, id)
+}
+
+func (p *Persister) ListTasks() ([]internal.Task, error) {
+	defer p.track()()
+	return p.Persister.ListTasks()
+}
+
+func (p *Persister) AppliedMigrations(dbName string) (map[int]bool, error) {
+	defer p.track()()
+	return p.Persister.AppliedMigrations(dbName)
+}
+
+func (p *Persister) SetMigrationApplied(dbName string, version int) error {
+	defer p.track()()
+	return p.Persister.SetMigrationApplied(dbName, version)
+}
+
+func (p *Persister) AddFile(dbName string, f internal.File) (id string, err error) {
+	defer p.track()()
+	return p.Persister.AddFile(dbName, f)
+}
+
+func (p *Persister) GetFileByID(dbName, fileID string) (f internal.File, err error) {
+	defer p.track()()
+	return p.Persister.GetFileByID(dbName, fileID)
+}
+
+func (p *Persister) DeleteFile(dbName, fileID string) error {
+	defer p.track()()
+	return p.Persister.DeleteFile(dbName, fileID)
+}
@@ -0,0 +1,49 @@
+package querycount
+
+import (
+	"context"
+	"testing"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+type fakeDatastore struct {
+	internal.Persister
+}
+
+func (f fakeDatastore) ListDatabases() ([]internal.BaseConfig, error) {
+	return nil, nil
+}
+
+func (f fakeDatastore) NewID() string {
+	return "id"
+}
+
+func TestWithContext(t *testing.T) {
+	p := New(fakeDatastore{})
+
+	stats := &Stats{}
+	ctx := NewContext(context.Background(), stats)
+
+	ds := p.WithContext(ctx)
+	ds.ListDatabases()
+	ds.ListDatabases()
+	// NewID does not reach the database
+	ds.NewID()
+
+	// the operations made from other goroutines are counted too
+	ch := make(chan bool)
+	go func() {
+		ds.ListDatabases()
+		close(ch)
+	}()
+	<-ch
+
+	// the operations outside the request are not counted
+	p.ListDatabases()
+	p.WithContext(context.Background()).ListDatabases()
+
+	if n, _ := stats.Get(); n != 3 {
+		t.Errorf("expected 3 operations got %d", n)
+	}
+}
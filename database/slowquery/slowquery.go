@@ -0,0 +1,129 @@
+// Package slowquery logs the document queries of a datastore taking longer
+// than a threshold, see SLOW_QUERY_THRESHOLD.
+package slowquery
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+// Persister wraps a datastore and logs its slow document queries with
+// their filter and sort. The filter values are redacted since they can hold
+// personal data, only the fields and operators are logged.
+type Persister struct {
+	internal.Persister
+
+	Threshold time.Duration
+	// Logf receives the slow queries, log.Printf by default
+	Logf func(format string, v ...interface{})
+
+	now func() time.Time
+}
+
+// New returns p logging its queries slower than threshold.
+func New(p internal.Persister, threshold time.Duration) *Persister {
+	return &Persister{
+		Persister: p,
+		Threshold: threshold,
+		Logf:      log.Printf,
+		now:       time.Now,
+	}
+}
+
+func (p *Persister) ListDocuments(auth internal.Auth, dbName, col string, params internal.ListParams) (internal.PagedResult, error) {
+	defer p.track("list", dbName, col, nil, params)()
+	return p.Persister.ListDocuments(auth, dbName, col, params)
+}
+
+func (p *Persister) QueryDocuments(auth internal.Auth, dbName, col string, filter map[string]interface{}, params internal.ListParams) (internal.PagedResult, error) {
+	defer p.track("query", dbName, col, filter, params)()
+	return p.Persister.QueryDocuments(auth, dbName, col, filter, params)
+}
+
+func (p *Persister) UpdateByFilter(auth internal.Auth, dbName, col string, filter map[string]interface{}, doc map[string]interface{}) (int64, error) {
+	defer p.track("update", dbName, col, filter, internal.ListParams{})()
+	return p.Persister.UpdateByFilter(auth, dbName, col, filter, doc)
+}
+
+func (p *Persister) DeleteByFilter(auth internal.Auth, dbName, col string, filter map[string]interface{}) (int64, error) {
+	defer p.track("delete", dbName, col, filter, internal.ListParams{})()
+	return p.Persister.DeleteByFilter(auth, dbName, col, filter)
+}
+
+// track returns the func to defer logging the query once it's done if it
+// took longer than the threshold.
+func (p *Persister) track(op, dbName, col string, filter map[string]interface{}, params internal.ListParams) func() {
+	start := p.now()
+	return func() {
+		took := p.now().Sub(start)
+		if took < p.Threshold {
+			return
+		}
+
+		p.Logf("[slow query] %s %s.%s took %v filter=%s sort=%s",
+			op, dbName, col, took, redactedFilter(filter), sortSpec(params))
+	}
+}
+
+// redactedFilter returns the JSON of filter with all its values replaced
+// by "?".
+func redactedFilter(filter map[string]interface{}) string {
+	if len(filter) == 0 {
+		return "{}"
+	}
+
+	b, err := json.Marshal(redact(filter))
+	if err != nil {
+		return fmt.Sprintf("unprintable filter: %v", err)
+	}
+	return string(b)
+}
+
+// redact keeps the keys of the maps, the fields and operators of a filter,
+// and replaces the other values by "?". The backends have their own map
+// types, i.e. bson.M, so it's done by reflection.
+func redact(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map:
+		m := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			m[fmt.Sprint(iter.Key().Interface())] = redact(iter.Value().Interface())
+		}
+		return m
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return "?"
+		}
+
+		s := make([]interface{}, rv.Len())
+		for i := range s {
+			s[i] = redact(rv.Index(i).Interface())
+		}
+		return s
+	}
+	return "?"
+}
+
+func sortSpec(params internal.ListParams) string {
+	if len(params.Sort) == 0 {
+		return "default"
+	}
+
+	var fields []string
+	for _, sf := range params.Sort {
+		if sf.Descending {
+			fields = append(fields, "-"+sf.Field)
+		} else {
+			fields = append(fields, sf.Field)
+		}
+	}
+	return strings.Join(fields, ",")
+}
@@ -0,0 +1,76 @@
+package slowquery
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+// slowDatastore takes delay to run its queries on a fake clock.
+type slowDatastore struct {
+	internal.Persister
+	clock *time.Time
+	delay time.Duration
+}
+
+func (s *slowDatastore) QueryDocuments(auth internal.Auth, dbName, col string, filter map[string]interface{}, params internal.ListParams) (internal.PagedResult, error) {
+	*s.clock = s.clock.Add(s.delay)
+	return internal.PagedResult{}, nil
+}
+
+func newTestPersister(delay time.Duration) (*Persister, *[]string) {
+	clock := time.Now()
+
+	var logs []string
+	p := New(&slowDatastore{clock: &clock, delay: delay}, 100*time.Millisecond)
+	p.now = func() time.Time { return clock }
+	p.Logf = func(format string, v ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, v...))
+	}
+	return p, &logs
+}
+
+func TestSlowQueryLogged(t *testing.T) {
+	p, logs := newTestPersister(250 * time.Millisecond)
+
+	filter := map[string]interface{}{
+		"email":  "private@example.com",
+		"$or":    []interface{}{map[string]interface{}{"age": map[string]interface{}{"$gt": 18}}},
+		"active": true,
+	}
+	params := internal.ListParams{Sort: []internal.SortField{{Field: "created", Descending: true}}}
+
+	if _, err := p.QueryDocuments(internal.Auth{}, "base", "users", filter, params); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*logs) != 1 {
+		t.Fatalf("expected the slow query to be logged once got %v", *logs)
+	}
+
+	line := (*logs)[0]
+	for _, expected := range []string{"query base.users", "250ms", `"email":"?"`, `"$gt":"?"`, "sort=-created"} {
+		if !strings.Contains(line, expected) {
+			t.Errorf("expected %q in %s", expected, line)
+		}
+	}
+
+	for _, value := range []string{"private@example.com", "18", "true"} {
+		if strings.Contains(line, value) {
+			t.Errorf("expected the value %q to be redacted in %s", value, line)
+		}
+	}
+}
+
+func TestFastQueryNotLogged(t *testing.T) {
+	p, logs := newTestPersister(50 * time.Millisecond)
+
+	if _, err := p.QueryDocuments(internal.Auth{}, "base", "users", nil, internal.ListParams{}); err != nil {
+		t.Fatal(err)
+	} else if len(*logs) != 0 {
+		t.Errorf("expected a query under the threshold not to be logged got %v", *logs)
+	}
+}
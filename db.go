@@ -1,13 +1,21 @@
 package staticbackend
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/staticbackendhq/core/cache"
+	"github.com/staticbackendhq/core/config"
 	"github.com/staticbackendhq/core/internal"
 	"github.com/staticbackendhq/core/middleware"
 )
@@ -20,14 +28,26 @@ func (database *Database) dbreq(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		if len(r.URL.Query().Get("bulk")) > 0 {
 			database.bulkAdd(w, r)
+		} else if len(r.URL.Query().Get("ifabsent")) > 0 {
+			database.addIfAbsent(w, r)
 		} else {
 			database.add(w, r)
 		}
 	} else if r.Method == http.MethodPut {
-		database.update(w, r)
+		if len(r.URL.Query().Get("bulk")) > 0 {
+			database.bulkUpdate(w, r)
+		} else {
+			database.update(w, r)
+		}
+	} else if r.Method == http.MethodPatch {
+		database.patch(w, r)
 	} else if r.Method == http.MethodDelete {
-		database.del(w, r)
-	} else if r.Method == http.MethodGet {
+		if len(r.URL.Query().Get("bulk")) > 0 {
+			database.bulkDelete(w, r)
+		} else {
+			database.del(w, r)
+		}
+	} else if r.Method == http.MethodGet || r.Method == http.MethodHead {
 		p := r.URL.Path
 		if strings.HasSuffix(p, "/") == false {
 			p += "/"
@@ -56,8 +76,8 @@ func (database *Database) add(w http.ResponseWriter, r *http.Request) {
 	col, _ := ShiftPath(r.URL.Path)
 
 	var v interface{}
-	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := readDocument(r.Body, col, &v); err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
 		return
 	}
 
@@ -67,12 +87,102 @@ func (database *Database) add(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	doc, err = datastore.CreateDocument(auth, conf.Name, col, doc)
+	internal.ApplyDefaults(doc, collectionDefaults(col))
+
+	if err := normalizeExpiry(col, doc); err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
+		return
+	}
+
+	if err := checkCollectionLimit(store(r), conf, col); err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
+		return
+	}
+
+	doc, err = store(r).CreateDocument(auth, conf.Name, col, doc)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), documentErrorStatus(err))
 		return
 	}
 
+	id, _ := doc[internal.IDField].(string)
+	emitDocumentChanged(conf.Name, col, internal.WebhookCreate, id, doc)
+
+	respond(w, http.StatusCreated, doc)
+}
+
+// addIfAbsent creates the document unless one of the collection matches
+// the query clauses, i.e. to claim a username. A match returns a 409 with
+// the existing document when the caller can read it.
+func (database *Database) addIfAbsent(w http.ResponseWriter, r *http.Request) {
+	conf, auth, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, r.URL.Path = ShiftPath(r.URL.Path)
+	col, _ := ShiftPath(r.URL.Path)
+
+	data := new(struct {
+		Clauses [][]interface{}        `json:"clauses"`
+		Doc     map[string]interface{} `json:"doc"`
+	})
+	if err := readDocument(r.Body, col, data); err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
+		return
+	} else if len(data.Clauses) == 0 {
+		http.Error(w, "a filter is required for a conditional create", http.StatusBadRequest)
+		return
+	} else if data.Doc == nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	internal.NormalizeNumbers(data.Doc)
+	for _, clause := range data.Clauses {
+		internal.NormalizeNumbers(clause)
+	}
+
+	internal.ApplyDefaults(data.Doc, collectionDefaults(col))
+
+	if err := normalizeExpiry(col, data.Doc); err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
+		return
+	}
+
+	if err := checkCollectionLimit(store(r), conf, col); err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
+		return
+	}
+
+	filter, err := store(r).ParseQuery(data.Clauses)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	doc, created, err := store(r).CreateDocumentIfAbsent(auth, conf.Name, col, filter, data.Doc)
+	if err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
+		return
+	}
+
+	id, _ := doc[internal.IDField].(string)
+
+	if !created {
+		// the match is scoped to the documents auth can read
+		if existing, err := store(r).GetDocumentByID(auth, conf.Name, col, id); err == nil {
+			respond(w, http.StatusConflict, existing)
+			return
+		}
+
+		http.Error(w, "a document matching the filter already exists", http.StatusConflict)
+		return
+	}
+
+	emitDocumentChanged(conf.Name, col, internal.WebhookCreate, id, doc)
+
 	respond(w, http.StatusCreated, doc)
 }
 
@@ -87,13 +197,43 @@ func (database *Database) bulkAdd(w http.ResponseWriter, r *http.Request) {
 	col, _ := ShiftPath(r.URL.Path)
 
 	var v []interface{}
-	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+	if err := internal.DecodeJSON(r.Body, &v); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if err := datastore.BulkCreateDocument(auth, conf.Name, col, v); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	defaults := collectionDefaults(col)
+	for _, doc := range v {
+		if doc, ok := doc.(map[string]interface{}); ok {
+			internal.ApplyDefaults(doc, defaults)
+
+			if err := normalizeExpiry(col, doc); err != nil {
+				http.Error(w, err.Error(), documentErrorStatus(err))
+				return
+			}
+		}
+	}
+
+	if limit := documentSizeLimit(col); limit > 0 {
+		for _, doc := range v {
+			b, err := json.Marshal(doc)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			} else if int64(len(b)) > limit {
+				http.Error(w, errDocumentTooLarge.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+		}
+	}
+
+	if err := checkCollectionLimit(store(r), conf, col); err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
+		return
+	}
+
+	if err := store(r).BulkCreateDocument(auth, conf.Name, col, v); err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
 		return
 	}
 
@@ -103,10 +243,30 @@ func (database *Database) bulkAdd(w http.ResponseWriter, r *http.Request) {
 func (database *Database) list(w http.ResponseWriter, r *http.Request) {
 	page, size := getPagination(r.URL)
 
+	sort, err := getSort(r.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fields, err := internal.ParseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	clauses, err := internal.ParseFilterParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	params := internal.ListParams{
-		Page:           page,
-		Size:           size,
-		SortDescending: len(r.URL.Query().Get("desc")) > 0,
+		Page:      page,
+		Size:      size,
+		Sort:      sort,
+		Fields:    fields,
+		SkipCount: len(r.URL.Query().Get("nocount")) > 0,
 	}
 
 	conf, auth, err := middleware.Extract(r, true)
@@ -118,13 +278,43 @@ func (database *Database) list(w http.ResponseWriter, r *http.Request) {
 	_, r.URL.Path = ShiftPath(r.URL.Path)
 	col, _ := ShiftPath(r.URL.Path)
 
-	result, err := datastore.ListDocuments(auth, conf.Name, col, params)
+	expand, err := parseExpand(col, r.URL.Query().Get("expand"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	respond(w, http.StatusOK, result)
+	// the expired documents are hidden until they're removed
+	if clause, ok := liveClause(col, time.Now()); ok {
+		clauses = append(clauses, clause)
+	}
+
+	var result internal.PagedResult
+	if len(clauses) > 0 {
+		var filter map[string]interface{}
+		filter, err = store(r).ParseQuery(clauses)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result, err = store(r).QueryDocuments(auth, conf.Name, col, filter, params)
+	} else {
+		result, err = store(r).ListDocuments(auth, conf.Name, col, params)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
+		return
+	}
+
+	if err := newExpander(store(r), auth, conf.Name).expand(col, result.Results, expand); err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
+		return
+	}
+
+	// a removed document doesn't change the updated time of the others,
+	// the lists are only revalidated with their ETag
+	respondCacheable(w, r, time.Time{}, result)
 }
 
 func (database *Database) get(w http.ResponseWriter, r *http.Request) {
@@ -134,30 +324,70 @@ func (database *Database) get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	fields, err := internal.ParseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	col, id := "", ""
 
 	_, r.URL.Path = ShiftPath(r.URL.Path)
 	col, r.URL.Path = ShiftPath(r.URL.Path)
 	id, r.URL.Path = ShiftPath(r.URL.Path)
 
-	result, err := datastore.GetDocumentByID(auth, conf.Name, col, id)
+	expand, err := parseExpand(col, r.URL.Query().Get("expand"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	respond(w, http.StatusOK, result)
+	result, err := store(r).GetDocumentByID(auth, conf.Name, col, id)
+	if err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
+		return
+	} else if isExpired(col, result, time.Now()) {
+		http.Error(w, "document not found", http.StatusNotFound)
+		return
+	}
+
+	docs := []map[string]interface{}{result}
+	if err := newExpander(store(r), auth, conf.Name).expand(col, docs, expand); err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
+		return
+	}
+
+	// the expanded documents change on their own
+	var modified time.Time
+	if len(expand) == 0 {
+		modified, _ = internal.UpdatedAt(result)
+	}
+
+	respondCacheable(w, r, modified, internal.Project(result, fields))
 }
 
 func (database *Database) query(w http.ResponseWriter, r *http.Request) {
 	var clauses [][]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&clauses); err != nil {
+	if err := internal.DecodeJSON(r.Body, &clauses); err != nil {
 		fmt.Println("error parsing body", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	filter, err := datastore.ParseQuery(clauses)
+	_, r.URL.Path = ShiftPath(r.URL.Path)
+	col, _ := ShiftPath(r.URL.Path)
+
+	if clause, ok := liveClause(col, time.Now()); ok {
+		clauses = append(clauses, clause)
+	}
+
+	expand, err := parseExpand(col, r.URL.Query().Get("expand"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter, err := store(r).ParseQuery(clauses)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -165,13 +395,24 @@ func (database *Database) query(w http.ResponseWriter, r *http.Request) {
 
 	page, size := getPagination(r.URL)
 
-	sort := r.URL.Query().Get("sort")
+	sort, err := getSort(r.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fields, err := internal.ParseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	params := internal.ListParams{
-		Page:           page,
-		Size:           size,
-		SortBy:         sort,
-		SortDescending: len(r.URL.Query().Get("desc")) > 0,
+		Page:      page,
+		Size:      size,
+		Sort:      sort,
+		Fields:    fields,
+		SkipCount: len(r.URL.Query().Get("nocount")) > 0,
 	}
 
 	conf, auth, err := middleware.Extract(r, true)
@@ -181,21 +422,94 @@ func (database *Database) query(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var col string
+	result, err := store(r).QueryDocuments(auth, conf.Name, col, filter, params)
+	if err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
+		return
+	}
+
+	if err := newExpander(store(r), auth, conf.Name).expand(col, result.Results, expand); err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
+		return
+	}
+
+	respond(w, http.StatusOK, result)
+}
+
+// explain returns the backend's plan of the query of the body without
+// running it, to find the queries missing an index.
+func (database *Database) explain(w http.ResponseWriter, r *http.Request) {
+	conf, auth, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var clauses [][]interface{}
+	if err := internal.DecodeJSON(r.Body, &clauses); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	_, r.URL.Path = ShiftPath(r.URL.Path)
-	col, r.URL.Path = ShiftPath(r.URL.Path)
+	col, _ := ShiftPath(r.URL.Path)
 
-	result, err := datastore.QueryDocuments(auth, conf.Name, col, filter, params)
+	filter, err := store(r).ParseQuery(clauses)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	respond(w, http.StatusOK, result)
+	page, size := getPagination(r.URL)
+
+	sort, err := getSort(r.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params := internal.ListParams{Page: page, Size: size, Sort: sort}
+
+	plan, err := store(r).ExplainQuery(auth, conf.Name, col, filter, params)
+	if err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
+		return
+	}
+
+	respond(w, http.StatusOK, plan)
 }
 
+// update replaces the document by the request body, the fields it omits
+// are removed. See patch to only change some fields. With
+// DOCUMENT_PUT_MERGE=yes it merges the fields like patch, as before the
+// replace semantics were added.
 func (database *Database) update(w http.ResponseWriter, r *http.Request) {
+	if strings.EqualFold(config.Current.DocumentPutMerge, "yes") {
+		database.patch(w, r)
+		return
+	}
+
+	replace := store(r).ReplaceDocument
+	database.writeDocument(w, r, func(auth internal.Auth, dbName, col, id string, doc map[string]interface{}) (map[string]interface{}, error) {
+		// a dot path only makes sense when merging into the existing document
+		for k := range doc {
+			if strings.Contains(k, ".") {
+				return nil, fmt.Errorf("%w: %s", errDotPathReplace, k)
+			}
+		}
+		return replace(auth, dbName, col, id, doc)
+	})
+}
+
+// patch merges the fields of the request body into the document, the
+// fields it omits are kept. A dot path key changes a nested field.
+func (database *Database) patch(w http.ResponseWriter, r *http.Request) {
+	database.writeDocument(w, r, store(r).UpdateDocument)
+}
+
+type documentWriter func(auth internal.Auth, dbName, col, id string, doc map[string]interface{}) (map[string]interface{}, error)
+
+func (database *Database) writeDocument(w http.ResponseWriter, r *http.Request, write documentWriter) {
 	conf, auth, err := middleware.Extract(r, true)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -209,8 +523,8 @@ func (database *Database) update(w http.ResponseWriter, r *http.Request) {
 	id, r.URL.Path = ShiftPath(r.URL.Path)
 
 	var v interface{}
-	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := readDocument(r.Body, col, &v); err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
 		return
 	}
 
@@ -218,17 +532,86 @@ func (database *Database) update(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		http.Error(w, "invalid body", http.StatusBadRequest)
 		return
+	} else if err := normalizeExpiry(col, doc); err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
+		return
 	}
 
-	result, err := datastore.UpdateDocument(auth, conf.Name, col, id, doc)
+	result, err := write(auth, conf.Name, col, id, doc)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), documentErrorStatus(err))
 		return
 	}
 
+	emitDocumentChanged(conf.Name, col, internal.WebhookUpdate, id, result)
+
 	respond(w, http.StatusOK, result)
 }
 
+// bulkUpdate applies the update document to all documents matching the
+// query clauses that the caller can write. Without clauses all=true is
+// required to update the whole collection.
+func (database *Database) bulkUpdate(w http.ResponseWriter, r *http.Request) {
+	conf, auth, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, r.URL.Path = ShiftPath(r.URL.Path)
+	col, _ := ShiftPath(r.URL.Path)
+
+	data := new(struct {
+		Clauses [][]interface{}        `json:"clauses"`
+		Update  map[string]interface{} `json:"update"`
+	})
+	if err := internal.DecodeJSON(r.Body, data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if len(data.Update) == 0 {
+		http.Error(w, "the update document is empty", http.StatusBadRequest)
+		return
+	}
+
+	internal.NormalizeNumbers(data.Update)
+	for _, clause := range data.Clauses {
+		internal.NormalizeNumbers(clause)
+	}
+
+	if len(data.Clauses) == 0 && r.URL.Query().Get("all") != "true" {
+		http.Error(w, "a filter is required, use all=true to update all documents", http.StatusBadRequest)
+		return
+	} else if err := normalizeExpiry(col, data.Update); err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
+		return
+	}
+
+	if limit := documentSizeLimit(col); limit > 0 {
+		b, err := json.Marshal(data.Update)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if int64(len(b)) > limit {
+			http.Error(w, errDocumentTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
+
+	filter, err := store(r).ParseQuery(data.Clauses)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	count, err := store(r).UpdateByFilter(auth, conf.Name, col, filter, data.Update)
+	if err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
+		return
+	}
+
+	respond(w, http.StatusOK, count)
+}
+
 func (database *Database) increase(w http.ResponseWriter, r *http.Request) {
 	conf, auth, err := middleware.Extract(r, true)
 	if err != nil {
@@ -249,11 +632,18 @@ func (database *Database) increase(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := datastore.IncrementValue(auth, conf.Name, col, id, v.Field, v.Range); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := store(r).IncrementValue(auth, conf.Name, col, id, v.Field, v.Range); err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
 		return
 	}
 
+	// the webhooks receive the document with its new value
+	if doc, err := store(r).GetDocumentByID(auth, conf.Name, col, id); err != nil {
+		log.Println("error getting the increased document for the webhooks", err)
+	} else {
+		emitDocumentChanged(conf.Name, col, internal.WebhookUpdate, id, doc)
+	}
+
 	respond(w, http.StatusOK, true)
 }
 
@@ -270,7 +660,50 @@ func (database *Database) del(w http.ResponseWriter, r *http.Request) {
 	col, r.URL.Path = ShiftPath(r.URL.Path)
 	id, r.URL.Path = ShiftPath(r.URL.Path)
 
-	count, err := datastore.DeleteDocument(auth, conf.Name, col, id)
+	count, err := store(r).DeleteDocument(auth, conf.Name, col, id)
+	if err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
+		return
+	}
+
+	if count > 0 {
+		emitDocumentChanged(conf.Name, col, internal.WebhookDelete, id, map[string]interface{}{internal.IDField: id})
+	}
+
+	respond(w, http.StatusOK, count)
+}
+
+// bulkDelete deletes the documents matching the query clauses of the body
+// that the caller can write. Without clauses all=true is required to empty
+// the collection.
+func (database *Database) bulkDelete(w http.ResponseWriter, r *http.Request) {
+	conf, auth, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, r.URL.Path = ShiftPath(r.URL.Path)
+	col, _ := ShiftPath(r.URL.Path)
+
+	var clauses [][]interface{}
+	if err := internal.DecodeJSON(r.Body, &clauses); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(clauses) == 0 && r.URL.Query().Get("all") != "true" {
+		http.Error(w, "a filter is required, use all=true to delete all documents", http.StatusBadRequest)
+		return
+	}
+
+	filter, err := store(r).ParseQuery(clauses)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	count, err := store(r).DeleteByFilter(auth, conf.Name, col, filter)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -280,7 +713,7 @@ func (database *Database) del(w http.ResponseWriter, r *http.Request) {
 }
 
 func (database *Database) newID(w http.ResponseWriter, r *http.Request) {
-	id := datastore.NewID()
+	id := store(r).NewID()
 	respond(w, http.StatusOK, id)
 }
 
@@ -291,7 +724,7 @@ func (database *Database) listCollections(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	names, err := datastore.ListCollections(conf.Name)
+	names, err := store(r).ListCollections(conf.Name)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -300,29 +733,408 @@ func (database *Database) listCollections(w http.ResponseWriter, r *http.Request
 	respond(w, http.StatusOK, names)
 }
 
-func (database *Database) index(w http.ResponseWriter, r *http.Request) {
+// stats returns the document counts and storage sizes of the collections
+// of the base as reported by the store(r).
+func (database *Database) stats(w http.ResponseWriter, r *http.Request) {
 	conf, _, err := middleware.Extract(r, true)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if r.Method != http.MethodPost {
-		http.Error(w, "method not implemented", http.StatusNotImplemented)
+	stats, err := store(r).Stats(conf.Name)
+	if err != nil {
+		http.Error(w, err.Error(), documentErrorStatus(err))
+		return
+	}
+
+	respond(w, http.StatusOK, stats)
+}
+
+// collectionStat is a collection of a base and its number of documents.
+type collectionStat struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// collections lists the collections of the base the caller can read with
+// their document counts and the collection limit of the plan, 0 means no
+// limit. Root users see all collections and the count of all documents.
+func (database *Database) collections(w http.ResponseWriter, r *http.Request) {
+	conf, auth, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit, err := baseCollectionLimit(store(r), conf)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	names, err := userCollections(store(r), conf.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Limit       int              `json:"limit"`
+		Collections []collectionStat `json:"collections"`
+	}{Limit: limit, Collections: []collectionStat{}}
+
+	for _, name := range names {
+		if !canListCollection(auth, name) {
+			continue
+		}
+
+		result, err := store(r).ListDocuments(auth, conf.Name, name, internal.ListParams{Page: 1, Size: 1})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.Collections = append(data.Collections, collectionStat{Name: name, Count: result.Total})
+	}
+
+	respond(w, http.StatusOK, data)
+}
+
+// dropCollection removes a collection or only its documents when
+// truncate=true. The confirm parameter must repeat the collection name to
+// prevent accidents.
+func (database *Database) dropCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	conf, _, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	col := r.URL.Query().Get("col")
-	field := r.URL.Query().Get("field")
+	if len(col) == 0 {
+		http.Error(w, "missing col parameter", http.StatusBadRequest)
+		return
+	} else if !internal.ValidCollectionName(col) {
+		http.Error(w, fmt.Sprintf("invalid collection name %q", col), http.StatusBadRequest)
+		return
+	} else if strings.HasPrefix(col, "sb_") {
+		http.Error(w, "system collections cannot be dropped", http.StatusBadRequest)
+		return
+	} else if r.URL.Query().Get("confirm") != col {
+		http.Error(w, "the confirm parameter must be the collection name", http.StatusBadRequest)
+		return
+	}
+
+	// only the collections of the base can be dropped
+	cols, err := userCollections(store(r), conf.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !hasCollection(cols, col) {
+		http.Error(w, "collection not found", http.StatusNotFound)
+		return
+	}
+
+	if r.URL.Query().Get("truncate") == "true" {
+		n, err := store(r).TruncateCollection(conf.Name, col)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		respond(w, http.StatusOK, n)
+		return
+	}
 
-	if err := datastore.CreateIndex(conf.Name, col, field); err != nil {
+	if err := store(r).DropCollection(conf.Name, col); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	collectionCache.Invalidate(conf.Name)
+
 	respond(w, http.StatusOK, true)
 }
 
+func (database *Database) index(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	col := r.URL.Query().Get("col")
+	if len(col) == 0 {
+		http.Error(w, "missing col parameter", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		indexes, err := store(r).ListIndexes(conf.Name, col)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		respond(w, http.StatusOK, indexes)
+	case http.MethodPost:
+		field := r.URL.Query().Get("field")
+		if !internal.ValidFieldName(field) {
+			http.Error(w, fmt.Sprintf("cannot index field %q", field), http.StatusBadRequest)
+			return
+		}
+
+		unique := false
+		if v := r.URL.Query().Get("unique"); len(v) > 0 {
+			unique, err = strconv.ParseBool(v)
+			if err != nil {
+				http.Error(w, "unique must be true or false", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// geo indexes are used by the near and within queries
+		geo := false
+		if v := r.URL.Query().Get("geo"); len(v) > 0 {
+			geo, err = strconv.ParseBool(v)
+			if err != nil {
+				http.Error(w, "geo must be true or false", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if geo && unique {
+			http.Error(w, "a geo index cannot be unique", http.StatusBadRequest)
+			return
+		} else if geo {
+			err = store(r).CreateGeoIndex(conf.Name, col, field)
+		} else {
+			err = store(r).CreateIndex(conf.Name, col, field, unique)
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), documentErrorStatus(err))
+			return
+		}
+
+		respond(w, http.StatusOK, true)
+	case http.MethodDelete:
+		// index names follow the same rules as field names
+		name := r.URL.Query().Get("name")
+		if !internal.ValidFieldName(name) {
+			http.Error(w, fmt.Sprintf("invalid index name %q", name), http.StatusBadRequest)
+			return
+		}
+
+		if err := store(r).DropIndex(conf.Name, col, name); errors.Is(err, internal.ErrIndexNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		respond(w, http.StatusOK, true)
+	default:
+		http.Error(w, "method not implemented", http.StatusNotImplemented)
+	}
+}
+
+var errDocumentTooLarge = errors.New("document exceeds the maximum size allowed")
+
+var errCollectionLimit = errors.New("collection limit reached")
+
+var errDotPathReplace = errors.New("dot path keys are only allowed with PATCH")
+
+// collectionLimit returns the maximum number of collections a base on plan
+// can create, 0 means no limit.
+func collectionLimit(plan int) int {
+	return planLimit(config.Current.Settings.CollectionLimits, plan)
+}
+
+// planLimit returns the limit of plan, or the default one when the plan has
+// no limit of its own, from per plan limits i.e. CollectionLimits.
+func planLimit(limits map[string]int, plan int) int {
+	for name, p := range planNames {
+		if p != plan {
+			continue
+		} else if n, ok := limits[name]; ok {
+			return n
+		}
+	}
+	return limits[config.PlanLimitDefault]
+}
+
+// baseCollectionLimit returns the collection limit of the plan of the base's
+// customer.
+func baseCollectionLimit(ds internal.Persister, conf internal.BaseConfig) (int, error) {
+	if len(config.Current.Settings.CollectionLimits) == 0 {
+		return 0, nil
+	}
+
+	cus, err := ds.FindAccount(conf.CustomerID)
+	if err != nil {
+		return 0, err
+	}
+	return collectionLimit(cus.Plan), nil
+}
+
+// userCollections returns the distinct collections of a base, the system
+// ones are excluded.
+func userCollections(ds internal.Persister, dbName string) ([]string, error) {
+	names, err := ds.ListCollections(dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var cols []string
+	for _, name := range names {
+		if strings.HasPrefix(name, "sb_") || seen[internal.CleanCollectionName(name)] {
+			continue
+		}
+
+		seen[internal.CleanCollectionName(name)] = true
+		cols = append(cols, name)
+	}
+	return cols, nil
+}
+
+// hasCollection returns if col is one of cols, the permissions in the
+// names and the case, folded by PostgreSQL, are ignored.
+func hasCollection(cols []string, col string) bool {
+	for _, name := range cols {
+		if strings.EqualFold(internal.CleanCollectionName(name), internal.CleanCollectionName(col)) {
+			return true
+		}
+	}
+	return false
+}
+
+// canListCollection returns if auth can see col when listing collections,
+// users only see the ones readable beyond their own documents.
+func canListCollection(auth internal.Auth, col string) bool {
+	if auth.Role >= middleware.RootRole || strings.HasPrefix(col, "pub_") {
+		return true
+	}
+	return internal.ReadPermission(col) != internal.PermOwner
+}
+
+// collectionCache holds the collections of the bases, they're needed on
+// every insert when the collections are limited.
+var collectionCache = cache.NewCollectionCache(time.Minute)
+
+// checkCollectionLimit returns errCollectionLimit when writing to col would
+// create a new collection past the limit of the base's plan. The plan is
+// only looked up for a new collection. Concurrent inserts creating distinct
+// collections can all pass the check, the limit may be exceeded by the
+// number of such inserts.
+func checkCollectionLimit(ds internal.Persister, conf internal.BaseConfig, col string) error {
+	if len(config.Current.Settings.CollectionLimits) == 0 {
+		return nil
+	}
+
+	cols, ok := collectionCache.Get(conf.Name)
+	if !ok {
+		var err error
+		cols, err = userCollections(ds, conf.Name)
+		if err != nil {
+			return err
+		}
+
+		collectionCache.Set(conf.Name, cols)
+	}
+
+	if hasCollection(cols, col) {
+		return nil
+	}
+
+	limit, err := baseCollectionLimit(ds, conf)
+	if err != nil || limit <= 0 {
+		return err
+	} else if len(cols) >= limit {
+		return fmt.Errorf("%w: your plan allows %d collections, %s cannot be created", errCollectionLimit, limit, col)
+	}
+
+	// the write creates col
+	collectionCache.Invalidate(conf.Name)
+	return nil
+}
+
+// documentSizeLimit returns the maximum size in bytes of a document for
+// col, 0 means no limit.
+func documentSizeLimit(col string) int64 {
+	limits := config.Current.Settings.DocumentSizeLimits
+	if n, ok := limits[col]; ok {
+		return n
+	} else if n, ok := limits[internal.CleanCollectionName(col)]; ok {
+		return n
+	}
+	return limits[""]
+}
+
+// collectionDefaults returns the values set on insert for the fields
+// missing from the documents of col.
+func collectionDefaults(col string) []config.FieldDefault {
+	defaults := config.Current.Settings.CollectionDefaults
+	if defs, ok := defaults[col]; ok {
+		return defs
+	}
+	return defaults[internal.CleanCollectionName(col)]
+}
+
+// readDocument decodes the JSON body into v enforcing the document size
+// limit of col.
+func readDocument(body io.Reader, col string, v interface{}) error {
+	limit := documentSizeLimit(col)
+	if limit <= 0 {
+		return internal.DecodeJSON(body, v)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return err
+	} else if int64(len(b)) > limit {
+		return errDocumentTooLarge
+	}
+
+	return internal.DecodeJSON(bytes.NewReader(b), v)
+}
+
+func documentErrorStatus(err error) int {
+	var dupErr *internal.DuplicateValueError
+	if errors.Is(err, context.DeadlineExceeded) {
+		// the datastore operation timed out, see DATASTORE_READ_TIMEOUT
+		return http.StatusGatewayTimeout
+	} else if errors.Is(err, errDocumentTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	} else if errors.Is(err, errCollectionLimit) {
+		return http.StatusForbidden
+	} else if errors.As(err, &dupErr) {
+		return http.StatusConflict
+	} else if errors.Is(err, internal.ErrUniqueIndexRequired) {
+		return http.StatusBadRequest
+	} else if errors.Is(err, internal.ErrIndexConflict) {
+		return http.StatusConflict
+	} else if errors.Is(err, errInvalidExpiry) {
+		return http.StatusBadRequest
+	} else if errors.Is(err, errDotPathReplace) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// defaultPageSize is used when the request has no valid size.
+const defaultPageSize = 25
+
+// getPagination parses the ?page=&size= query string. The size is clamped
+// to MAX_PAGE_SIZE, the effective size is returned in the PagedResult.
 func getPagination(u *url.URL) (page int64, size int64) {
 	var err error
 
@@ -332,9 +1144,33 @@ func getPagination(u *url.URL) (page int64, size int64) {
 	}
 
 	size, err = strconv.ParseInt(u.Query().Get("size"), 10, 64)
-	if err != nil {
-		size = 25
+	if err != nil || size < 1 {
+		size = defaultPageSize
+	}
+
+	if max := config.Current.Settings.MaxPageSize; max > 0 && size > max {
+		size = max
 	}
 
 	return
 }
+
+// getSort parses the ?sort=field,-other query string. The former ?desc=1
+// flag reverses the direction of every key.
+func getSort(u *url.URL) ([]internal.SortField, error) {
+	sort, err := internal.ParseSort(u.Query().Get("sort"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(u.Query().Get("desc")) > 0 {
+		if len(sort) == 0 {
+			sort = []internal.SortField{{Field: internal.SortFieldID}}
+		}
+
+		for i := range sort {
+			sort[i].Descending = !sort[i].Descending
+		}
+	}
+	return sort, nil
+}
@@ -2,15 +2,20 @@ package staticbackend
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/staticbackendhq/core/config"
+	"github.com/staticbackendhq/core/database/querycount"
 	"github.com/staticbackendhq/core/internal"
 	"github.com/staticbackendhq/core/middleware"
 )
@@ -144,6 +149,47 @@ func TestDBCreate(t *testing.T) {
 	}
 }
 
+func TestDBInactiveBase(t *testing.T) {
+	cus, err := datastore.CreateCustomer(internal.Customer{Email: fmt.Sprintf("inactivebase-%d@test.com", time.Now().UnixNano())})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inactive, err := datastore.CreateBase(internal.BaseConfig{
+		CustomerID: cus.ID,
+		Name:       fmt.Sprintf("inactivebase%d", time.Now().UnixNano()),
+		IsActive:   false,
+		Created:    time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]middleware.Middleware{
+		"WithDB":            middleware.WithDB(datastore, volatile),
+		"RequireActiveBase": middleware.RequireActiveBase(datastore, volatile),
+	}
+	for name, mw := range tests {
+		called := false
+		h := middleware.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}), mw, middleware.RequireAuth(datastore, volatile))
+
+		req := httptest.NewRequest("GET", "/db/tasks", nil)
+		req.Header.Set("SB-PUBLIC-KEY", inactive.ID)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", adminToken))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status 403 for an inactive base got %d", name, w.Code)
+		} else if called {
+			t.Errorf("%s: expected the handler not to be called for an inactive base", name)
+		}
+	}
+}
+
 func TestDBListCollections(t *testing.T) {
 	req := httptest.NewRequest("GET", "/sudolistall", nil)
 	w := httptest.NewRecorder()
@@ -179,6 +225,34 @@ func TestDBListCollections(t *testing.T) {
 	}
 }
 
+func TestDBStats(t *testing.T) {
+	for i := 0; i < 4; i++ {
+		resp := dbReq(t, database.add, "POST", "/db/statsfixture", Task{Title: "stats", Created: time.Now()})
+		if resp.StatusCode > 299 {
+			t.Fatal(GetResponseBody(t, resp))
+		}
+	}
+
+	resp := dbReq(t, database.stats, "GET", "/sudo/stats", nil, true)
+	if resp.StatusCode > 299 {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	var stats internal.BaseStats
+	if err := parseBody(resp.Body, &stats); err != nil {
+		t.Fatal(err)
+	}
+
+	cs, ok := stats.Collection("statsfixture")
+	if !ok {
+		t.Fatalf("expected the fixture collection in %v", stats.Collections)
+	} else if cs.Documents != 4 {
+		t.Errorf("expected 4 documents got %d", cs.Documents)
+	} else if stats.Bytes < cs.Bytes || stats.Documents < cs.Documents {
+		t.Errorf("expected the totals to include the collection got %+v", stats)
+	}
+}
+
 func TestDBIncrease(t *testing.T) {
 	task :=
 		Task{
@@ -255,3 +329,985 @@ func TestDBCreateIndex(t *testing.T) {
 	//TODO: would be nice to validate the index were created
 	// but there's no way to get a collection's indexes for now.
 }
+
+func TestDBCreateDocumentSizeLimit(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	doc := map[string]interface{}{"title": strings.Repeat("x", 100)}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// just under the limit
+	config.Current.MaxDocumentSize = fmt.Sprintf("%d", len(b))
+	parseSettings(t)
+
+	resp := dbReq(t, database.add, "POST", "/db/tasks", doc)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status 201 got %d: %s", resp.StatusCode, GetResponseBody(t, resp))
+	}
+
+	// just over the limit
+	config.Current.MaxDocumentSize = fmt.Sprintf("%d", len(b)-1)
+	parseSettings(t)
+
+	resp = dbReq(t, database.add, "POST", "/db/tasks", doc)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413 got %d: %s", resp.StatusCode, GetResponseBody(t, resp))
+	}
+
+	// per collection override allows larger documents
+	config.Current.DocumentSizeOverrides = "bigtasks:1000000"
+	parseSettings(t)
+
+	resp = dbReq(t, database.add, "POST", "/db/bigtasks", doc)
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("expected override to allow document, got %d: %s", resp.StatusCode, GetResponseBody(t, resp))
+	}
+}
+
+func TestDBCollectionTTL(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.CollectionTTL = "ttltasks:lastSeen:1h"
+	parseSettings(t)
+
+	resp := dbReq(t, database.add, "POST", "/db/ttltasks", map[string]interface{}{"title": "ttl task", "lastSeen": "yesterday"})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid expiry got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	// the offset of the expired one would make it sort after the cutoff
+	tz := time.FixedZone("", 9*60*60)
+
+	var expiredID string
+	for _, at := range []time.Time{time.Now().Add(-2 * time.Hour).In(tz), time.Now()} {
+		doc := map[string]interface{}{"title": "ttl task", "lastSeen": at.Format(time.RFC3339Nano)}
+		resp := dbReq(t, database.add, "POST", "/db/ttltasks", doc)
+		if resp.StatusCode > 299 {
+			t.Fatal(GetResponseBody(t, resp))
+		}
+
+		var created map[string]interface{}
+		if err := parseBody(resp.Body, &created); err != nil {
+			t.Fatal(err)
+		} else if len(expiredID) == 0 {
+			expiredID = fmt.Sprintf("%v", created["id"])
+		}
+	}
+
+	count := func(resp *http.Response) int {
+		if resp.StatusCode > 299 {
+			t.Fatal(GetResponseBody(t, resp))
+		}
+
+		var result internal.PagedResult
+		if err := parseBody(resp.Body, &result); err != nil {
+			t.Fatal(err)
+		}
+		return len(result.Results)
+	}
+
+	// expired documents are hidden before being removed
+	if n := count(dbReq(t, database.list, "GET", "/db/ttltasks", nil)); n != 1 {
+		t.Errorf("expected 1 live document in list got %d", n)
+	}
+
+	clauses := [][]interface{}{{"title", "=", "ttl task"}}
+	if n := count(dbReq(t, database.query, "POST", "/query/ttltasks", clauses)); n != 1 {
+		t.Errorf("expected 1 live document in query got %d", n)
+	}
+
+	resp = dbReq(t, database.get, "GET", "/db/ttltasks/"+expiredID, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status 404 for an expired document got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	if err := sweepExpired(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// without the TTL only the removal hides the document
+	config.Current.CollectionTTL = ""
+	parseSettings(t)
+
+	if n := count(dbReq(t, database.list, "GET", "/db/ttltasks", nil)); n != 1 {
+		t.Errorf("expected the expired document to be removed got %d documents", n)
+	}
+}
+
+func TestDBCollectionDefaults(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.CollectionDefaults = "deftasks:status:new,deftasks:slug:slug(title)"
+	parseSettings(t)
+
+	add := func(doc map[string]interface{}) map[string]interface{} {
+		resp := dbReq(t, database.add, "POST", "/db/deftasks", doc)
+		if resp.StatusCode > 299 {
+			t.Fatal(GetResponseBody(t, resp))
+		}
+
+		var created map[string]interface{}
+		if err := parseBody(resp.Body, &created); err != nil {
+			t.Fatal(err)
+		}
+		return created
+	}
+
+	created := add(map[string]interface{}{"title": "My First Task"})
+	if created["status"] != "new" || created["slug"] != "my-first-task" {
+		t.Errorf("expected defaults to be filled got %v", created)
+	}
+
+	created = add(map[string]interface{}{"title": "My First Task", "status": "done", "slug": "mine"})
+	if created["status"] != "done" || created["slug"] != "mine" {
+		t.Errorf("expected provided values to be kept got %v", created)
+	}
+}
+
+func TestDBCollectionLimit(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	existing, err := userCollections(datastore, dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// room for a single new collection
+	config.Current.MaxCollections = fmt.Sprintf("default:%d", len(existing)+1)
+	parseSettings(t)
+
+	suffix := strings.ToLower(randStringRunes(6))
+	doc := map[string]interface{}{"name": "limit"}
+
+	resp := dbReq(t, database.add, "POST", "/db/limita"+suffix, doc)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status 201 got %d: %s", resp.StatusCode, GetResponseBody(t, resp))
+	}
+
+	resp = dbReq(t, database.add, "POST", "/db/limitb"+suffix, doc)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status 403 past the limit got %d: %s", resp.StatusCode, GetResponseBody(t, resp))
+	}
+
+	resp = dbReq(t, database.bulkAdd, "POST", "/db/limitb"+suffix, []interface{}{doc})
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status 403 for a bulk insert past the limit got %d: %s", resp.StatusCode, GetResponseBody(t, resp))
+	}
+
+	resp = dbReq(t, database.add, "POST", "/db/limita"+suffix, doc)
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("expected writes to an existing collection to succeed got %d: %s", resp.StatusCode, GetResponseBody(t, resp))
+	}
+
+	resp = dbReq(t, database.collections, "GET", "/sudo/collections", nil, true)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	var data struct {
+		Limit       int              `json:"limit"`
+		Collections []collectionStat `json:"collections"`
+	}
+	if err := parseBody(resp.Body, &data); err != nil {
+		t.Fatal(err)
+	} else if data.Limit != len(existing)+1 {
+		t.Errorf("expected limit %d got %d", len(existing)+1, data.Limit)
+	}
+
+	found := false
+	for _, c := range data.Collections {
+		if c.Name == "limita"+suffix {
+			found = c.Count == 2
+		}
+	}
+	if !found {
+		t.Errorf("expected limita%s with 2 documents got %v", suffix, data.Collections)
+	}
+}
+
+func TestDBCollectionsExcludesPrivate(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	// the permission is part of the collection name on all data stores
+	config.Current.KeepPermissionInName = "yes"
+
+	doc := map[string]interface{}{"name": "listed"}
+	for _, col := range []string{"privnotes_700_", "sharednotes_740_"} {
+		resp := dbReq(t, database.add, "POST", "/db/"+col, doc)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("%s: %s", col, GetResponseBody(t, resp))
+		}
+	}
+
+	names := func(tok string) map[string]bool {
+		req := httptest.NewRequest("GET", "/collections", nil)
+		req.Header.Set("SB-PUBLIC-KEY", pubKey)
+		req.Header.Set("Authorization", "Bearer "+tok)
+		w := httptest.NewRecorder()
+
+		stdAuth := []middleware.Middleware{
+			middleware.RequireActiveBase(datastore, volatile),
+			middleware.RequireAuth(datastore, volatile),
+		}
+		middleware.Chain(http.HandlerFunc(database.collections), stdAuth...).ServeHTTP(w, req)
+
+		resp := w.Result()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatal(GetResponseBody(t, resp))
+		}
+
+		var data struct {
+			Collections []collectionStat `json:"collections"`
+		}
+		if err := parseBody(resp.Body, &data); err != nil {
+			t.Fatal(err)
+		}
+
+		found := make(map[string]bool)
+		for _, c := range data.Collections {
+			found[c.Name] = true
+		}
+		return found
+	}
+
+	user := names(userToken)
+	if user["privnotes_700_"] {
+		t.Errorf("expected the private collection to be excluded for a user")
+	} else if !user["sharednotes_740_"] {
+		t.Errorf("expected the group readable collection to be listed got %v", user)
+	}
+
+	if admin := names(adminToken); !admin["privnotes_700_"] {
+		t.Errorf("expected the private collection to be listed for root got %v", admin)
+	}
+}
+
+func TestDBDropCollection(t *testing.T) {
+	doc := map[string]interface{}{"name": "wipe"}
+	for i := 0; i < 2; i++ {
+		resp := dbReq(t, database.add, "POST", "/db/wipes", doc)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatal(GetResponseBody(t, resp))
+		}
+	}
+
+	hasCollection := func() bool {
+		names, err := userCollections(datastore, dbName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range names {
+			if name == "wipes" {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, col := range []string{"wipes,other.wipes", dbName + ".sb_tokens"} {
+		resp := dbReq(t, database.dropCollection, "DELETE", "/sudo/collection?col="+url.QueryEscape(col)+"&confirm="+url.QueryEscape(col), nil, true)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status 400 for %s got %d", col, resp.StatusCode)
+		}
+	}
+
+	resp := dbReq(t, database.dropCollection, "DELETE", "/sudo/collection?col=unknown&confirm=unknown", nil, true)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status 404 for a collection of another base got %d", resp.StatusCode)
+	}
+
+	resp = dbReq(t, database.dropCollection, "DELETE", "/sudo/collection?col=wipes&truncate=true", nil, true)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 without confirmation got %d", resp.StatusCode)
+	}
+
+	resp = dbReq(t, database.dropCollection, "DELETE", "/sudo/collection?col=wipes&confirm=tasks", nil, true)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a wrong confirmation got %d", resp.StatusCode)
+	} else if !hasCollection() {
+		t.Fatal("expected the collection to remain without confirmation")
+	}
+
+	resp = dbReq(t, database.dropCollection, "DELETE", "/sudo/collection?col=wipes&confirm=wipes&truncate=true", nil, true)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	var n int64
+	if err := parseBody(resp.Body, &n); err != nil {
+		t.Fatal(err)
+	} else if n < 2 {
+		t.Errorf("expected the documents to be removed got %d", n)
+	} else if !hasCollection() {
+		t.Errorf("expected the collection to remain after truncate")
+	}
+
+	resp = dbReq(t, database.dropCollection, "DELETE", "/sudo/collection?col=wipes&confirm=wipes", nil, true)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	} else if hasCollection() {
+		t.Errorf("expected the collection to be gone after drop")
+	}
+}
+
+func TestDBListRejectsInvalidSort(t *testing.T) {
+	resp := dbReq(t, database.list, "GET", "/db/tasks?sort=data.nested", nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 got %d: %s", resp.StatusCode, GetResponseBody(t, resp))
+	}
+
+	resp = dbReq(t, database.list, "GET", "/db/tasks?sort=-title,id", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200 got %d: %s", resp.StatusCode, GetResponseBody(t, resp))
+	}
+}
+
+func TestDBListFilters(t *testing.T) {
+	col := fmt.Sprintf("filtered%d", time.Now().UnixNano())
+	docs := []map[string]interface{}{
+		{"name": "alice", "age": 17, "status": "new"},
+		{"name": "bob", "age": 25, "status": "open"},
+		{"name": "carol", "age": 40, "status": "closed"},
+	}
+	for _, doc := range docs {
+		resp := dbReq(t, database.add, "POST", "/db/"+col, doc)
+		if resp.StatusCode > 299 {
+			t.Fatal(GetResponseBody(t, resp))
+		}
+		resp.Body.Close()
+	}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"name__eq=bob", []string{"bob"}},
+		{"name__ne=bob", []string{"alice", "carol"}},
+		{"age__gt=25", []string{"carol"}},
+		{"age__gt=9", []string{"alice", "bob", "carol"}},
+		{"age__lt=9", nil},
+		{"age__gte=17.5", []string{"bob", "carol"}},
+		{"age__gte=25", []string{"bob", "carol"}},
+		{"age__lt=25", []string{"alice"}},
+		{"age__lte=25", []string{"alice", "bob"}},
+		{"status__in=new,closed", []string{"alice", "carol"}},
+		{"name__contains=ro", []string{"carol"}},
+		{"age__gt=18&status__ne=closed", []string{"bob"}},
+	}
+	for _, tc := range tests {
+		resp := dbReq(t, database.list, "GET", "/db/"+col+"?sort=name&"+tc.query, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: %s", tc.query, GetResponseBody(t, resp))
+		}
+
+		var result internal.PagedResult
+		if err := parseBody(resp.Body, &result); err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, doc := range result.Results {
+			names = append(names, fmt.Sprintf("%v", doc["name"]))
+		}
+		if strings.Join(names, ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("%s: expected %v got %v", tc.query, tc.expected, names)
+		}
+	}
+
+	for _, query := range []string{"age__between=1", "sb_created__gt=1", "bad-field__eq=1"} {
+		resp := dbReq(t, database.list, "GET", "/db/"+col+"?"+query, nil)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400 got %d", query, resp.StatusCode)
+		}
+		resp.Body.Close()
+	}
+}
+
+func TestDBListClampsPageSize(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.MaxPageSize = "2"
+	parseSettings(t)
+
+	for i := 0; i < 3; i++ {
+		resp := dbReq(t, database.add, "POST", "/db/tasks", Task{Title: fmt.Sprintf("clamped %d", i)})
+		if resp.StatusCode > 299 {
+			t.Fatal(GetResponseBody(t, resp))
+		}
+	}
+
+	for _, path := range []string{"/db/tasks?size=5000", "/db/tasks?size=-1"} {
+		resp := dbReq(t, database.list, "GET", path, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatal(GetResponseBody(t, resp))
+		}
+
+		var result internal.PagedResult
+		if err := parseBody(resp.Body, &result); err != nil {
+			t.Fatal(err)
+		} else if result.Size != 2 || len(result.Results) != 2 {
+			t.Errorf("%s: expected the size clamped to 2 got %d with %d results", path, result.Size, len(result.Results))
+		}
+	}
+
+	resp := dbReq(t, database.query, "POST", "/query/tasks?size=5000", [][]interface{}{{"done", "=", false}})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	var result internal.PagedResult
+	if err := parseBody(resp.Body, &result); err != nil {
+		t.Fatal(err)
+	} else if result.Size != 2 || len(result.Results) > 2 {
+		t.Errorf("expected the query size clamped to 2 got %d with %d results", result.Size, len(result.Results))
+	}
+}
+
+func TestDocumentErrorStatusTimeout(t *testing.T) {
+	err := fmt.Errorf("error querying tasks: %w", context.DeadlineExceeded)
+	if status := documentErrorStatus(err); status != http.StatusGatewayTimeout {
+		t.Errorf("expected status 504 got %d", status)
+	}
+}
+
+func TestDBGetWithFields(t *testing.T) {
+	task := Task{Title: "projected", Done: true, Created: time.Now()}
+
+	resp := dbReq(t, database.add, "POST", "/db/tasks", task)
+	defer resp.Body.Close()
+
+	var created Task
+	if err := parseBody(resp.Body, &created); err != nil {
+		t.Fatal(err)
+	}
+
+	resp = dbReq(t, database.get, "GET", "/db/tasks/"+created.ID+"?fields=title", nil)
+	if resp.StatusCode > 299 {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	var doc map[string]interface{}
+	if err := parseBody(resp.Body, &doc); err != nil {
+		t.Fatal(err)
+	} else if len(doc) != 2 || doc["id"] != created.ID || doc["title"] != task.Title {
+		t.Errorf("expected only id and title got %v", doc)
+	}
+}
+
+func TestDBIndexManagement(t *testing.T) {
+	resp := dbReq(t, database.add, "POST", "/db/uniquetasks", Task{Title: "only once"})
+	if resp.StatusCode > 299 {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	resp = dbReq(t, database.index, "POST", "/sudo/index?col=uniquetasks&field=title&unique=true", nil, true)
+	if resp.StatusCode > 299 {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	resp = dbReq(t, database.add, "POST", "/db/uniquetasks", Task{Title: "only once"})
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected status 409 got %d", resp.StatusCode)
+	} else if body := GetResponseBody(t, resp); !strings.Contains(body, "title") {
+		t.Errorf("expected conflicting field title to be named in %q", body)
+	}
+
+	resp = dbReq(t, database.index, "GET", "/sudo/index?col=uniquetasks", nil, true)
+	if resp.StatusCode > 299 {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	var indexes []internal.Index
+	if err := parseBody(resp.Body, &indexes); err != nil {
+		t.Fatal(err)
+	}
+
+	name := ""
+	for _, idx := range indexes {
+		if idx.Field == "title" && idx.Unique {
+			name = idx.Name
+		}
+	}
+	if len(name) == 0 {
+		t.Fatalf("expected a unique index on title in %v", indexes)
+	}
+
+	resp = dbReq(t, database.index, "DELETE", "/sudo/index?col=uniquetasks&name="+name, nil, true)
+	if resp.StatusCode > 299 {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	resp = dbReq(t, database.index, "POST", "/sudo/index?col=uniquetasks&field=data.title", nil, true)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for invalid field got %d", resp.StatusCode)
+	}
+
+	resp = dbReq(t, database.index, "POST", "/sudo/index?col=uniquetasks&field=location&geo=true&unique=true", nil, true)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a unique geo index got %d", resp.StatusCode)
+	}
+}
+
+func TestDBBulkDelete(t *testing.T) {
+	for _, title := range []string{"bulk delete me", "bulk delete me", "bulk keep me"} {
+		resp := dbReq(t, database.add, "POST", "/db/bulkdeltasks", Task{Title: title, Created: time.Now()})
+		if resp.StatusCode > 299 {
+			t.Fatal(GetResponseBody(t, resp))
+		}
+		resp.Body.Close()
+	}
+
+	// an empty filter is refused unless all=true
+	resp := dbReq(t, database.dbreq, "DELETE", "/db/bulkdeltasks?bulk=1", nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an empty filter got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	clauses := [][]interface{}{{"title", "=", "bulk delete me"}}
+	resp = dbReq(t, database.dbreq, "DELETE", "/db/bulkdeltasks?bulk=1", clauses)
+	if resp.StatusCode > 299 {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	var count int64
+	if err := parseBody(resp.Body, &count); err != nil {
+		t.Fatal(err)
+	} else if count != 2 {
+		t.Errorf("expected 2 deleted documents got %d", count)
+	}
+
+	resp = dbReq(t, database.dbreq, "DELETE", "/db/bulkdeltasks?bulk=1&all=true", nil)
+	if resp.StatusCode > 299 {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	if err := parseBody(resp.Body, &count); err != nil {
+		t.Fatal(err)
+	} else if count != 1 {
+		t.Errorf("expected 1 deleted document with all=true got %d", count)
+	}
+}
+
+func TestDBBulkUpdate(t *testing.T) {
+	for _, title := range []string{"bulk update me", "bulk update me", "bulk leave me"} {
+		resp := dbReq(t, database.add, "POST", "/db/bulkupdtasks", Task{Title: title, Created: time.Now()})
+		if resp.StatusCode > 299 {
+			t.Fatal(GetResponseBody(t, resp))
+		}
+		resp.Body.Close()
+	}
+
+	data := map[string]interface{}{
+		"update": map[string]interface{}{"done": true},
+	}
+
+	// an empty filter is refused unless all=true
+	resp := dbReq(t, database.dbreq, "PUT", "/db/bulkupdtasks?bulk=1", data)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an empty filter got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	data["clauses"] = [][]interface{}{{"title", "=", "bulk update me"}}
+	resp = dbReq(t, database.dbreq, "PUT", "/db/bulkupdtasks?bulk=1", data)
+	if resp.StatusCode > 299 {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	var count int64
+	if err := parseBody(resp.Body, &count); err != nil {
+		t.Fatal(err)
+	} else if count != 2 {
+		t.Errorf("expected 2 updated documents got %d", count)
+	}
+}
+
+func TestDBExpand(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.CollectionRelations = "exptasks:projectId:expprojects,exptasks:secretId:expsecrets_600_,expprojects:clientId:expclients"
+	parseSettings(t)
+
+	create := func(col string, doc map[string]interface{}) string {
+		resp := dbReq(t, database.add, "POST", "/db/"+col, doc)
+		defer resp.Body.Close()
+		if resp.StatusCode > 299 {
+			t.Fatal(GetResponseBody(t, resp))
+		}
+
+		var created map[string]interface{}
+		if err := parseBody(resp.Body, &created); err != nil {
+			t.Fatal(err)
+		}
+		return created["id"].(string)
+	}
+
+	// the secret is only readable by its owner, the admin user
+	clientID := create("expclients", map[string]interface{}{"name": "acme"})
+	projectID := create("expprojects", map[string]interface{}{"name": "website", "clientId": clientID})
+	secretID := create("expsecrets_600_", map[string]interface{}{"value": "s3cr3t"})
+	taskID := create("exptasks", map[string]interface{}{"title": "expand me", "projectId": projectID, "secretId": secretID})
+
+	get := func(token, query string) (int, map[string]interface{}) {
+		req := httptest.NewRequest("GET", "/db/exptasks/"+taskID+query, nil)
+		req.Header.Set("SB-PUBLIC-KEY", pubKey)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+
+		h := middleware.Chain(http.HandlerFunc(database.get), middleware.RequireActiveBase(datastore, volatile), middleware.RequireAuth(datastore, volatile))
+		h.ServeHTTP(w, req)
+
+		var doc map[string]interface{}
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&doc); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, doc
+	}
+
+	status, doc := get(userToken, "?expand=projectId.clientId,secretId")
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200 got %d", status)
+	}
+
+	project, ok := doc["projectId"].(map[string]interface{})
+	if !ok || project["name"] != "website" {
+		t.Fatalf("expected the project to be expanded got %v", doc["projectId"])
+	} else if client, ok := project["clientId"].(map[string]interface{}); !ok || client["name"] != "acme" {
+		t.Errorf("expected the nested client to be expanded got %v", project["clientId"])
+	}
+
+	if doc["secretId"] != secretID {
+		t.Errorf("expected the unreadable secret to stay a reference got %v", doc["secretId"])
+	}
+
+	if _, doc := get(adminToken, "?expand=secretId"); doc == nil {
+		t.Error("expected the owner to get the task")
+	} else if secret, ok := doc["secretId"].(map[string]interface{}); !ok || secret["value"] != "s3cr3t" {
+		t.Errorf("expected the owner to get the secret expanded got %v", doc["secretId"])
+	}
+
+	for _, q := range []string{"?expand=title", "?expand=projectId.clientId.a.b"} {
+		if status, _ := get(userToken, q); status != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400 got %d", q, status)
+		}
+	}
+}
+
+func TestExplainQuery(t *testing.T) {
+	clauses := [][]interface{}{{"done", "=", false}}
+	resp := dbReq(t, database.explain, "POST", "/sudoexplain/tasks?sort=-created", clauses, true)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+	defer resp.Body.Close()
+
+	var plan map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&plan); err != nil {
+		t.Fatal(err)
+	} else if len(plan) == 0 {
+		t.Errorf("expected the query plan of the backend got %v", plan)
+	}
+}
+
+func TestAddIfAbsentConcurrent(t *testing.T) {
+	username := fmt.Sprintf("claim-%d", time.Now().UnixNano())
+	body := map[string]interface{}{
+		"clauses": [][]interface{}{{"username", "=", username}},
+		"doc":     map[string]interface{}{"username": username},
+	}
+
+	statuses := make(chan int, 5)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp := dbReq(t, database.addIfAbsent, "POST", "/db/usernames?ifabsent=true", body)
+			resp.Body.Close()
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := make(map[int]int)
+	for status := range statuses {
+		counts[status]++
+	}
+
+	if counts[http.StatusCreated] != 1 || counts[http.StatusConflict] != 4 {
+		t.Errorf("expected one create and 4 conflicts got %v", counts)
+	}
+
+	resp := dbReq(t, database.addIfAbsent, "POST", "/db/usernames?ifabsent=true", body)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected a 409 got %d", resp.StatusCode)
+	}
+	defer resp.Body.Close()
+
+	var existing map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&existing); err != nil {
+		t.Fatal(err)
+	} else if existing["username"] != username {
+		t.Errorf("expected the existing document got %v", existing)
+	}
+}
+
+func TestAddIfAbsentScoped(t *testing.T) {
+	code := fmt.Sprintf("private-%d", time.Now().UnixNano())
+	body := map[string]interface{}{
+		"clauses": [][]interface{}{{"code", "=", code}},
+		"doc":     map[string]interface{}{"code": code},
+	}
+
+	resp := dbReq(t, database.addIfAbsent, "POST", "/db/privateclaims?ifabsent=true", body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected a 201 got %d", resp.StatusCode)
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/db/privateclaims?ifabsent=true", bytes.NewReader(b))
+	req.Header.Set("SB-PUBLIC-KEY", pubKey)
+	req.Header.Set("Authorization", "Bearer "+userToken)
+	w := httptest.NewRecorder()
+
+	h := middleware.Chain(http.HandlerFunc(database.addIfAbsent), middleware.RequireActiveBase(datastore, volatile), middleware.RequireAuth(datastore, volatile))
+	h.ServeHTTP(w, req)
+
+	// the document of the admin is not readable by the user
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected the unreadable document not to be matched got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func conditionalReq(t *testing.T, method, path, header, value string) *http.Response {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("SB-PUBLIC-KEY", pubKey)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", adminToken))
+	if len(header) > 0 {
+		req.Header.Set(header, value)
+	}
+
+	w := httptest.NewRecorder()
+	h := middleware.Chain(http.HandlerFunc(database.dbreq),
+		middleware.RequireActiveBase(datastore, volatile), middleware.RequireAuth(datastore, volatile))
+	h.ServeHTTP(w, req)
+	return w.Result()
+}
+
+func TestDBGetConditional(t *testing.T) {
+	resp := dbReq(t, database.add, "POST", "/db/tasks", Task{Title: "etag", Created: time.Now()})
+	defer resp.Body.Close()
+
+	var created Task
+	if err := parseBody(resp.Body, &created); err != nil {
+		t.Fatal(err)
+	}
+
+	path := "/db/tasks/" + created.ID
+
+	resp = conditionalReq(t, "GET", path, "", "")
+	body := GetResponseBody(t, resp)
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", resp.StatusCode, body)
+	} else if !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("expected a weak ETag got %v", resp.Header)
+	}
+
+	modified, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil {
+		t.Fatalf("expected a Last-Modified got %v", resp.Header)
+	}
+
+	resp = conditionalReq(t, "GET", path, "If-Modified-Since", modified.Format(http.TimeFormat))
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("expected status 304 when unmodified since got %d", resp.StatusCode)
+	}
+
+	resp = conditionalReq(t, "GET", path, "If-Modified-Since", modified.Add(-time.Hour).Format(http.TimeFormat))
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200 when modified since got %d", resp.StatusCode)
+	}
+
+	resp = conditionalReq(t, "GET", path, "If-None-Match", etag)
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("expected status 304 for a matching ETag got %d", resp.StatusCode)
+	} else if b := GetResponseBody(t, resp); len(b) > 0 {
+		t.Errorf("expected no body for a 304 got %s", b)
+	}
+
+	resp = conditionalReq(t, "GET", path, "If-None-Match", `"stale"`)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200 for a mismatched ETag got %d", resp.StatusCode)
+	} else if b := GetResponseBody(t, resp); b != body {
+		t.Errorf("expected the full body %s got %s", body, b)
+	}
+
+	resp = dbReq(t, database.update, "PUT", path, map[string]interface{}{"title": "changed"})
+	if resp.StatusCode > 299 {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	resp = conditionalReq(t, "GET", path, "If-None-Match", etag)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200 once the document changed got %d", resp.StatusCode)
+	} else if resp.Header.Get("ETag") == etag {
+		t.Errorf("expected a new ETag once the document changed")
+	}
+}
+
+func TestDBListHead(t *testing.T) {
+	resp := conditionalReq(t, "HEAD", "/db/tasks", "", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200 got %d", resp.StatusCode)
+	} else if len(resp.Header.Get("ETag")) == 0 {
+		t.Errorf("expected an ETag for a HEAD request")
+	}
+
+	resp = conditionalReq(t, "HEAD", "/db/tasks", "If-None-Match", resp.Header.Get("ETag"))
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("expected status 304 for a matching ETag got %d", resp.StatusCode)
+	}
+}
+
+func TestQueryStatsHeader(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+	defer func(p internal.Persister) { datastore = p }(datastore)
+
+	config.Current.MaxCollections = ""
+	parseSettings(t)
+	datastore = querycount.New(datastore)
+
+	// the collections are counted with one query each
+	hf := middleware.Chain(http.HandlerFunc(database.collections), middleware.QueryStats()).ServeHTTP
+
+	resp := dbReq(t, hf, "GET", "/sudo/collections", nil, true)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	var data struct {
+		Collections []collectionStat `json:"collections"`
+	}
+	if err := parseBody(resp.Body, &data); err != nil {
+		t.Fatal(err)
+	} else if len(data.Collections) == 0 {
+		t.Fatal("expected the base to have collections")
+	}
+
+	expected := fmt.Sprintf("%d", 1+len(data.Collections))
+	if v := resp.Header.Get(middleware.QueryCountHeader); v != expected {
+		t.Errorf("expected %s queries got %q", expected, v)
+	} else if len(resp.Header.Get(middleware.QueryTimeHeader)) == 0 {
+		t.Errorf("expected the query time header to be set")
+	}
+}
+
+func TestDBPatchAndReplace(t *testing.T) {
+	task := map[string]interface{}{"title": "original", "done": true, "count": 2}
+
+	resp := dbReq(t, database.add, "POST", "/db/patchtasks", task)
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	var created map[string]interface{}
+	if err := parseBody(resp.Body, &created); err != nil {
+		t.Fatal(err)
+	}
+
+	path := fmt.Sprintf("/db/patchtasks/%v", created["id"])
+
+	resp = dbReq(t, database.dbreq, "PATCH", path, map[string]interface{}{"title": "patched"})
+	defer resp.Body.Close()
+
+	var patched map[string]interface{}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	} else if err := parseBody(resp.Body, &patched); err != nil {
+		t.Fatal(err)
+	}
+
+	if patched["title"] != "patched" {
+		t.Errorf("expected the patched title got %v", patched["title"])
+	} else if patched["done"] != true || fmt.Sprint(patched["count"]) != "2" {
+		t.Errorf("expected PATCH to keep the omitted fields got %v", patched)
+	}
+
+	resp = dbReq(t, database.dbreq, "PUT", path, map[string]interface{}{"title": "replaced"})
+	defer resp.Body.Close()
+
+	var replaced map[string]interface{}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	} else if err := parseBody(resp.Body, &replaced); err != nil {
+		t.Fatal(err)
+	}
+
+	if replaced["title"] != "replaced" || replaced["id"] != created["id"] {
+		t.Errorf("expected the replaced document with the same id got %v", replaced)
+	} else if _, ok := replaced["done"]; ok {
+		t.Errorf("expected PUT to remove the omitted done field got %v", replaced)
+	} else if _, ok := replaced["count"]; ok {
+		t.Errorf("expected PUT to remove the omitted count field got %v", replaced)
+	}
+}
+
+func TestDBReplaceOptions(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	resp := dbReq(t, database.add, "POST", "/db/patchtasks", map[string]interface{}{"title": "original", "done": true})
+	defer resp.Body.Close()
+
+	var created map[string]interface{}
+	if resp.StatusCode > 299 {
+		t.Fatal(GetResponseBody(t, resp))
+	} else if err := parseBody(resp.Body, &created); err != nil {
+		t.Fatal(err)
+	}
+
+	path := fmt.Sprintf("/db/patchtasks/%v", created["id"])
+
+	// a dot path cannot be part of a replacement document
+	resp = dbReq(t, database.dbreq, "PUT", path, map[string]interface{}{"address.city": "Montreal"})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a dot path key got %d: %s", resp.StatusCode, GetResponseBody(t, resp))
+	}
+
+	config.Current.DocumentPutMerge = "yes"
+
+	resp = dbReq(t, database.dbreq, "PUT", path, map[string]interface{}{"title": "merged"})
+	defer resp.Body.Close()
+
+	var merged map[string]interface{}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	} else if err := parseBody(resp.Body, &merged); err != nil {
+		t.Fatal(err)
+	}
+
+	if merged["title"] != "merged" || merged["done"] != true {
+		t.Errorf("expected PUT to merge the fields with DOCUMENT_PUT_MERGE got %v", merged)
+	}
+}
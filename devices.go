@@ -0,0 +1,142 @@
+package staticbackend
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+)
+
+const (
+	// maxDeviceBatch is the most devices provisioned by a request.
+	maxDeviceBatch = 1000
+	// deviceEmailDomain is the domain of the emails of the device users,
+	// the reserved .invalid TLD makes sure they are never delivered.
+	deviceEmailDomain = "devices.invalid"
+)
+
+var deviceLabel = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// provisionedDevice is returned once by provisionDevices, the token is not
+// retrievable afterwards.
+type provisionedDevice struct {
+	ID        string `json:"id"`
+	AccountID string `json:"accountId"`
+	Label     string `json:"label"`
+	Email     string `json:"email"`
+	Role      int    `json:"role"`
+	Token     string `json:"token"`
+}
+
+// provisionDevices creates a batch of users, one per device, with the role
+// of the request. Each device is identified by its label, a random one when
+// none is given, and authenticates with the returned token since it has no
+// password. Either all the devices are created or none.
+func (m *membership) provisionDevices(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, "invalid StaticBackend key", http.StatusUnauthorized)
+		return
+	}
+
+	var data = new(struct {
+		Count  int      `json:"count"`
+		Role   int      `json:"role"`
+		Labels []string `json:"labels"`
+	})
+	if err := parseBody(r.Body, &data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	labels, err := deviceLabels(data.Count, data.Labels)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if data.Role < 0 || data.Role >= middleware.RootRole {
+		http.Error(w, fmt.Sprintf("role must be between 0 and %d", middleware.RootRole-1), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	toks := make([]internal.Token, 0, len(labels))
+	for _, label := range labels {
+		toks = append(toks, internal.Token{
+			Email:   label + "@" + deviceEmailDomain,
+			Token:   datastore.NewID(),
+			Role:    data.Role,
+			Created: now,
+			Label:   label,
+		})
+	}
+
+	created, err := datastore.CreateUsers(conf.Name, toks)
+	if errors.Is(err, internal.ErrEmailTaken) {
+		http.Error(w, "a device with one of these labels already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	devices := make([]provisionedDevice, 0, len(created))
+	for i, tok := range created {
+		ut := internal.UserToken{ID: tok.ID, Token: tok.Token}
+		jwtBytes, err := m.getJWT(ut.String(), "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		devices = append(devices, provisionedDevice{
+			ID:        tok.ID,
+			AccountID: tok.AccountID,
+			Label:     labels[i],
+			Email:     tok.Email,
+			Role:      tok.Role,
+			Token:     string(jwtBytes),
+		})
+	}
+
+	respond(w, http.StatusCreated, devices)
+}
+
+// deviceLabels returns the labels of the devices to provision, random ones
+// when labels is empty.
+func deviceLabels(count int, labels []string) ([]string, error) {
+	if len(labels) == 0 {
+		if count <= 0 || count > maxDeviceBatch {
+			return nil, fmt.Errorf("count must be between 1 and %d", maxDeviceBatch)
+		}
+
+		for i := 0; i < count; i++ {
+			labels = append(labels, "device-"+strings.ToLower(randStringRunes(12)))
+		}
+		return labels, nil
+	}
+
+	if len(labels) > maxDeviceBatch {
+		return nil, fmt.Errorf("at most %d devices can be provisioned at once", maxDeviceBatch)
+	} else if count > 0 && count != len(labels) {
+		return nil, fmt.Errorf("count is %d but %d labels were given", count, len(labels))
+	}
+
+	seen := make(map[string]bool)
+	cleaned := make([]string, 0, len(labels))
+	for _, label := range labels {
+		label = strings.ToLower(strings.TrimSpace(label))
+		if !deviceLabel.MatchString(label) {
+			return nil, fmt.Errorf("invalid label %q, use up to 64 letters, digits, dots, dashes and underscores", label)
+		} else if seen[label] {
+			return nil, fmt.Errorf("duplicate label %q", label)
+		}
+		seen[label] = true
+		cleaned = append(cleaned, label)
+	}
+	return cleaned, nil
+}
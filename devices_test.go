@@ -0,0 +1,115 @@
+package staticbackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+)
+
+func TestProvisionDevices(t *testing.T) {
+	m := &membership{volatile: volatile}
+
+	prefix := fmt.Sprintf("sensor-%d", time.Now().UnixNano())
+	data := map[string]interface{}{
+		"role":   5,
+		"labels": []string{prefix + "-a", prefix + "-b", prefix + "-c"},
+	}
+
+	resp := dbReq(t, m.provisionDevices, "POST", "/sudo/devices", data, true)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+	defer resp.Body.Close()
+
+	var devices []provisionedDevice
+	if err := json.NewDecoder(resp.Body).Decode(&devices); err != nil {
+		t.Fatal(err)
+	} else if len(devices) != 3 {
+		t.Fatalf("expected 3 devices got %d", len(devices))
+	}
+
+	h := middleware.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, auth, err := middleware.Extract(r, true)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		respond(w, http.StatusOK, auth)
+	}), middleware.RequireActiveBase(datastore, volatile), middleware.RequireAuth(datastore, volatile))
+
+	for i, device := range devices {
+		if device.Label != data["labels"].([]string)[i] {
+			t.Errorf("expected label %s got %s", data["labels"].([]string)[i], device.Label)
+		} else if tok, err := datastore.FindTokenByEmail(dbName, device.Email); err != nil {
+			t.Fatal(err)
+		} else if tok.Label != device.Label {
+			t.Errorf("expected the token to be labelled %s got %s", device.Label, tok.Label)
+		}
+
+		req := httptest.NewRequest("GET", "/db/tasks", nil)
+		req.Header.Set("SB-PUBLIC-KEY", pubKey)
+		req.Header.Set("Authorization", "Bearer "+device.Token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		var auth internal.Auth
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected the device token to authenticate got %d: %s", w.Code, w.Body.String())
+		} else if err := json.NewDecoder(w.Body).Decode(&auth); err != nil {
+			t.Fatal(err)
+		} else if auth.UserID != device.ID || auth.Role != 5 {
+			t.Errorf("expected user %s with role 5 got %s with role %d", device.ID, auth.UserID, auth.Role)
+		}
+	}
+
+	// the labels are unique, the batch is rejected as a whole
+	data["labels"] = []string{prefix + "-d", prefix + "-a"}
+	resp2 := dbReq(t, m.provisionDevices, "POST", "/sudo/devices", data, true)
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 for an existing label got %d", resp2.StatusCode)
+	} else if exists, err := datastore.UserEmailExists(dbName, prefix+"-d@"+deviceEmailDomain); err != nil {
+		t.Fatal(err)
+	} else if exists {
+		t.Errorf("expected no device to be created when a label exists")
+	}
+}
+
+func TestProvisionDevicesValidation(t *testing.T) {
+	m := &membership{volatile: volatile}
+
+	tests := []map[string]interface{}{
+		{"count": 0},
+		{"count": maxDeviceBatch + 1},
+		{"count": 2, "role": middleware.RootRole},
+		{"count": 3, "labels": []string{"a", "b"}},
+		{"labels": []string{"same", "same"}},
+		{"labels": []string{"not valid"}},
+	}
+	for _, data := range tests {
+		resp := dbReq(t, m.provisionDevices, "POST", "/sudo/devices", data, true)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400 for %v got %d", data, resp.StatusCode)
+		}
+	}
+
+	resp := dbReq(t, m.provisionDevices, "POST", "/sudo/devices", map[string]interface{}{"count": 2}, true)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+	defer resp.Body.Close()
+
+	var devices []provisionedDevice
+	if err := json.NewDecoder(resp.Body).Decode(&devices); err != nil {
+		t.Fatal(err)
+	} else if len(devices) != 2 || devices[0].Label == devices[1].Label || devices[0].Role != 0 {
+		t.Errorf("unexpected devices %v", devices)
+	}
+}
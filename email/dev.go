@@ -12,9 +12,19 @@ func (d Dev) Send(data internal.SendMailData) error {
 	fmt.Println("====== SENDING EMAIL ======")
 	fmt.Println("from: ", data.From)
 	fmt.Println("ReplyTo: ", data.ReplyTo)
+	if len(data.ReturnPath) > 0 {
+		fmt.Println("ReturnPath: ", data.ReturnPath)
+	}
+	for k, v := range data.Headers {
+		fmt.Printf("%s: %s\n", k, v)
+	}
 	fmt.Println("to: ", data.To)
 	fmt.Println("subject: ", data.Subject)
 	fmt.Printf("body\n%s\n\n", data.TextBody)
 	fmt.Println("====== /SENDING EMAIL ======")
 	return nil
 }
+
+func (d Dev) Ping() error {
+	return nil
+}
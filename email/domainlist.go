@@ -0,0 +1,90 @@
+package email
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Domain returns the lowercased domain of address or empty when it has none.
+func Domain(address string) string {
+	i := strings.LastIndex(address, "@")
+	if i == -1 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(address[i+1:]))
+}
+
+// MatchDomain returns if the domain of address, or one of its parent
+// domains, is in domains.
+func MatchDomain(address string, domains map[string]bool) bool {
+	domain := Domain(address)
+	for len(domain) > 0 {
+		if domains[domain] {
+			return true
+		}
+
+		i := strings.Index(domain, ".")
+		if i == -1 {
+			break
+		}
+		domain = domain[i+1:]
+	}
+	return false
+}
+
+// DomainFile is a list of domains read from a file, one per line where #
+// starts a comment. The file is read again once modified so the list is
+// updated without a restart.
+type DomainFile struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	domains map[string]bool
+}
+
+// Match returns if the domain of address is in the file at path, see
+// MatchDomain.
+func (f *DomainFile) Match(path, address string) (bool, error) {
+	domains, err := f.load(path)
+	if err != nil {
+		return false, err
+	}
+	return MatchDomain(address, domains), nil
+}
+
+func (f *DomainFile) load(path string) (map[string]bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	} else if path == f.path && fi.ModTime().Equal(f.modTime) {
+		return f.domains, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	domains := make(map[string]bool)
+
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		if line = strings.ToLower(strings.TrimSpace(line)); len(line) > 0 {
+			domains[line] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	f.path, f.modTime, f.domains = path, fi.ModTime(), domains
+	return domains, nil
+}
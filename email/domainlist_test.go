@@ -0,0 +1,60 @@
+package email
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMatchDomain(t *testing.T) {
+	domains := map[string]bool{"mailinator.com": true}
+
+	tests := map[string]bool{
+		"bot@mailinator.com":       true,
+		"bot@MAILINATOR.com":       true,
+		"bot@eu.mailinator.com":    true,
+		"user@notmailinator.com":   false,
+		"user@mailinator.com.evil": false,
+		"mailinator.com":           false,
+		"user@example.com":         false,
+	}
+	for address, expected := range tests {
+		if got := MatchDomain(address, domains); got != expected {
+			t.Errorf("%s: expected %v got %v", address, expected, got)
+		}
+	}
+}
+
+func TestDomainFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	if err := os.WriteFile(path, []byte("# throwaway providers\nyopmail.com\n\nMailinator.com # popular\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var f DomainFile
+	if ok, err := f.Match(path, "a@mailinator.com"); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Errorf("expected mailinator.com to be listed")
+	}
+
+	if err := os.WriteFile(path, []byte("tempmail.dev\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// the modification time may not change within the same tick
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := f.Match(path, "a@mailinator.com"); ok {
+		t.Errorf("expected the list to be reloaded once modified")
+	} else if ok, _ := f.Match(path, "a@tempmail.dev"); !ok {
+		t.Errorf("expected tempmail.dev to be listed after the reload")
+	}
+
+	if _, err := f.Match(filepath.Join(t.TempDir(), "missing.txt"), "a@b.com"); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
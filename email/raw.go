@@ -0,0 +1,93 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+// rawMessage builds the MIME message of data with its text and HTML
+// alternatives, used when the provider API does not accept custom headers.
+func rawMessage(data internal.SendMailData) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	from := mail.Address{Name: data.FromName, Address: data.From}
+	to := mail.Address{Name: data.ToName, Address: data.To}
+
+	headers := map[string]string{
+		"From":         from.String(),
+		"To":           to.String(),
+		"Subject":      mime.QEncoding.Encode("UTF-8", data.Subject),
+		"MIME-Version": "1.0",
+		"Content-Type": fmt.Sprintf("multipart/alternative; boundary=%s", mw.Boundary()),
+	}
+	if len(data.ReplyTo) > 0 {
+		headers["Reply-To"] = data.ReplyTo
+	}
+	if len(data.ReturnPath) > 0 {
+		headers["Return-Path"] = data.ReturnPath
+	}
+
+	for k, v := range data.Headers {
+		k = textproto.CanonicalMIMEHeaderKey(k)
+		if _, ok := headers[k]; ok {
+			return nil, fmt.Errorf("header %s cannot be overridden", k)
+		} else if strings.ContainsAny(k+v, "\r\n") {
+			return nil, fmt.Errorf("invalid header %s", k)
+		}
+		headers[k] = v
+	}
+
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var msg bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&msg, "%s: %s\r\n", k, headers[k])
+	}
+	msg.WriteString("\r\n")
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=UTF-8", data.TextBody},
+		{"text/html; charset=UTF-8", data.HTMLBody},
+	}
+	for _, p := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write([]byte(p.body)); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	msg.Write(buf.Bytes())
+	return msg.Bytes(), nil
+}
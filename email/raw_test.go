@@ -0,0 +1,44 @@
+package email
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestRawMessageHeaders(t *testing.T) {
+	data := internal.SendMailData{
+		From:       "app@example.com",
+		FromName:   "App",
+		To:         "user@example.com",
+		Subject:    "Welcome",
+		HTMLBody:   "<p>hello</p>",
+		TextBody:   "hello",
+		ReplyTo:    "support@example.com",
+		ReturnPath: "bounces@example.com",
+		Headers:    map[string]string{"x-campaign": "signup"},
+	}
+
+	b, err := rawMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := string(b)
+	for _, h := range []string{
+		"Reply-To: support@example.com\r\n",
+		"Return-Path: bounces@example.com\r\n",
+		"X-Campaign: signup\r\n",
+		"Content-Type: multipart/alternative;",
+	} {
+		if !strings.Contains(msg, h) {
+			t.Errorf("expected %q in message:\n%s", h, msg)
+		}
+	}
+
+	data.Headers = map[string]string{"From": "spoof@example.com"}
+	if _, err := rawMessage(data); err == nil {
+		t.Error("expected overriding the From header to fail")
+	}
+}
@@ -14,6 +14,20 @@ import (
 
 type AWSSES struct{}
 
+// Ping requests the sending quota, it fails if SES cannot be reached or the
+// credentials are invalid.
+func (AWSSES) Ping() error {
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(config.Current.AWSRegion)},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = ses.New(sess).GetSendQuota(&ses.GetSendQuotaInput{})
+	return err
+}
+
 func (AWSSES) Send(data internal.SendMailData) error {
 	if len(data.To) == 0 || strings.Index(data.To, "@") == -1 {
 		return fmt.Errorf("empty To email")
@@ -35,6 +49,20 @@ func (AWSSES) Send(data internal.SendMailData) error {
 	// Create an SES session.
 	svc := ses.New(sess)
 
+	// custom headers are only supported by raw emails
+	if len(data.Headers) > 0 {
+		raw, err := rawMessage(data)
+		if err != nil {
+			return err
+		}
+
+		input := &ses.SendRawEmailInput{
+			RawMessage: &ses.RawMessage{Data: raw},
+		}
+		_, err = svc.SendRawEmail(input)
+		return err
+	}
+
 	from := fmt.Sprintf("%s <%s>", data.FromName, data.From)
 
 	// Assemble the email.
@@ -63,6 +91,7 @@ func (AWSSES) Send(data internal.SendMailData) error {
 		},
 		Source:           aws.String(from),
 		ReplyToAddresses: aws.StringSlice([]string{data.ReplyTo}),
+		ReturnPath:       returnPath(data.ReturnPath),
 		// Uncomment to use a configuration set
 		//ConfigurationSetName: aws.String(ConfigurationSet),
 	}
@@ -74,3 +103,10 @@ func (AWSSES) Send(data internal.SendMailData) error {
 
 	return nil
 }
+
+func returnPath(addr string) *string {
+	if len(addr) == 0 {
+		return nil
+	}
+	return aws.String(addr)
+}
@@ -2,15 +2,19 @@ package email
 
 import (
 	"bytes"
+	"fmt"
 	"html"
+	"regexp"
 	"strings"
-	"text/template"
+	"unicode"
 )
 
-// StripHTML returns a version of a string with no HTML tags.
+// StripHTML returns the plain text version of an HTML string, i.e. the text
+// body of an email. Tags are removed, entities decoded and whitespace is
+// collapsed like a browser would: block elements and line breaks start new
+// lines, paragraphs and headings are separated by a blank line. Links keep
+// their URL and lists their bullets or numbers.
 func StripHTML(s string) string {
-	output := ""
-
 	// if we have a full html page we only need the body
 	startBody := strings.Index(s, "<body")
 	if startBody > -1 {
@@ -18,7 +22,7 @@ func StripHTML(s string) string {
 		// try to find the end of the <body tag
 		for i := startBody; i < endBody; i++ {
 			if s[i] == '>' {
-				startBody = i
+				startBody = i + 1
 				break
 			}
 		}
@@ -28,63 +32,195 @@ func StripHTML(s string) string {
 		}
 	}
 
-	// Shortcut strings with no tags in them
+	// plain text keeps its line breaks
 	if !strings.ContainsAny(s, "<>") {
-		output = s
-	} else {
-		// Removing line feeds
-		s = strings.Replace(s, "\n", "", -1)
-
-		// Then replace line breaks with newlines, to preserve that formatting
-		s = strings.Replace(s, "</h1>", "\n\n", -1)
-		s = strings.Replace(s, "</h2>", "\n\n", -1)
-		s = strings.Replace(s, "</h3>", "\n\n", -1)
-		s = strings.Replace(s, "</h4>", "\n\n", -1)
-		s = strings.Replace(s, "</h5>", "\n\n", -1)
-		s = strings.Replace(s, "</h6>", "\n\n", -1)
-		s = strings.Replace(s, "</p>", "\n", -1)
-		s = strings.Replace(s, "<br>", "\n", -1)
-		s = strings.Replace(s, "<br/>", "\n", -1)
-		s = strings.Replace(s, "<br />", "\n", -1)
-
-		// Walk through the string removing all tags
-		b := bytes.NewBufferString("")
-		inTag := false
-		for _, r := range s {
-			switch r {
-			case '<':
-				inTag = true
-			case '>':
-				inTag = false
-			default:
-				if !inTag {
-					b.WriteRune(r)
-				}
-			}
+		return normalizeLines(html.UnescapeString(s))
+	}
+
+	b := bytes.NewBufferString("")
+	text := bytes.NewBufferString("")
+	tag := bytes.NewBufferString("")
+	st := &stripState{}
+	inTag := false
+
+	runes := []rune(s)
+	for i, r := range runes {
+		switch {
+		case inTag && r == '>':
+			inTag = false
+			st.handleTag(tag.String(), b)
+		case inTag:
+			tag.WriteRune(r)
+		case r == '<' && i+1 < len(runes) && isTagStart(runes[i+1]):
+			st.writeText(text.String(), b)
+			text.Reset()
+			inTag = true
+			tag.Reset()
+		default:
+			text.WriteRune(r)
+		}
+	}
+	st.writeText(text.String(), b)
+
+	return normalizeLines(b.String())
+}
+
+// isTagStart returns if r following a < opens a tag, a comment or a
+// doctype, otherwise the < is text.
+func isTagStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '/' || r == '!'
+}
+
+var (
+	hrefRe       = regexp.MustCompile(`(?i)href\s*=\s*["']([^"']*)["']`)
+	whitespaceRe = regexp.MustCompile(`[ \t\r\n\f\x{00a0}]+`)
+	blankLinesRe = regexp.MustCompile(`\n{3,}`)
+)
+
+// breakTags always start a new line, paragraphs end with a blank line.
+var breakTags = map[string]string{
+	"br": "\n", "/p": "\n\n", "/h1": "\n\n", "/h2": "\n\n", "/h3": "\n\n",
+	"/h4": "\n\n", "/h5": "\n\n", "/h6": "\n\n", "/blockquote": "\n\n",
+	"/table": "\n\n", "hr": "\n\n",
+}
+
+// blockTags start a new line unless already at the start of one.
+var blockTags = map[string]bool{"div": true, "/div": true, "p": true, "tr": true, "/tr": true}
+
+// skippedTags have a content that's not displayed.
+var skippedTags = map[string]bool{"head": true, "title": true, "style": true, "script": true}
+
+type stripList struct {
+	ordered bool
+	n       int
+}
+
+// stripState tracks the opened links and lists while stripping the tags.
+type stripState struct {
+	links []stripLink
+	lists []stripList
+	// skip is the tag whose content is being skipped
+	skip string
+}
+
+type stripLink struct {
+	href  string
+	start int
+}
+
+// writeText writes the decoded text with its whitespace collapsed, a line
+// does not start with a space.
+func (st *stripState) writeText(s string, b *bytes.Buffer) {
+	if len(st.skip) > 0 || len(s) == 0 {
+		return
+	}
+
+	s = whitespaceRe.ReplaceAllString(html.UnescapeString(s), " ")
+	if b.Len() == 0 || bytes.HasSuffix(b.Bytes(), []byte("\n")) || bytes.HasSuffix(b.Bytes(), []byte(" ")) {
+		s = strings.TrimLeft(s, " ")
+	}
+	b.WriteString(s)
+}
+
+// handleTag writes the text equivalent of the block, links and list tags
+// to b.
+func (st *stripState) handleTag(tag string, b *bytes.Buffer) {
+	fields := strings.Fields(tag)
+	if len(fields) == 0 {
+		return
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(fields[0], "/"))
+
+	if len(st.skip) > 0 {
+		if name == "/"+st.skip {
+			st.skip = ""
 		}
-		output = b.String()
+		return
+	} else if skippedTags[name] && !strings.HasSuffix(tag, "/") {
+		st.skip = name
+		return
 	}
 
-	// Remove a few common harmless entities, to arrive at something more like plain text
-	output = strings.Replace(output, "&#8216;", "'", -1)
-	output = strings.Replace(output, "&#8217;", "'", -1)
-	output = strings.Replace(output, "&#8220;", "\"", -1)
-	output = strings.Replace(output, "&#8221;", "\"", -1)
-	output = strings.Replace(output, "&nbsp;", " ", -1)
-	output = strings.Replace(output, "&quot;", "\"", -1)
-	output = strings.Replace(output, "&apos;", "'", -1)
+	if nl, ok := breakTags[name]; ok {
+		trimTrailingSpace(b)
+		b.WriteString(nl)
+		return
+	} else if blockTags[name] {
+		newLine(b)
+		return
+	}
 
-	// Translate some entities into their plain text equivalent (for example accents, if encoded as entities)
-	output = html.UnescapeString(output)
+	switch name {
+	case "a":
+		var href string
+		if m := hrefRe.FindStringSubmatch(tag); len(m) == 2 {
+			href = html.UnescapeString(m[1])
+		}
+		st.links = append(st.links, stripLink{href: href, start: b.Len()})
+	case "/a":
+		if len(st.links) == 0 {
+			return
+		}
 
-	// In case we have missed any tags above, escape the text - removes <, >, &, ' and ".
-	output = template.HTMLEscapeString(output)
+		link := st.links[len(st.links)-1]
+		st.links = st.links[:len(st.links)-1]
 
-	// After processing, remove some harmless entities &, ' and " which are encoded by HTMLEscapeString
-	output = strings.Replace(output, "&#34;", "\"", -1)
-	output = strings.Replace(output, "&#39;", "'", -1)
-	output = strings.Replace(output, "&amp; ", "& ", -1)     // NB space after
-	output = strings.Replace(output, "&amp;amp; ", "& ", -1) // NB space after
+		text := strings.TrimSpace(b.String()[link.start:])
+		href := strings.TrimPrefix(link.href, "mailto:")
+		if len(href) > 0 && text != href && !strings.HasPrefix(href, "#") {
+			fmt.Fprintf(b, " (%s)", href)
+		}
+	case "ul", "ol":
+		st.lists = append(st.lists, stripList{ordered: name == "ol"})
+		newLine(b)
+	case "/ul", "/ol":
+		if len(st.lists) > 0 {
+			st.lists = st.lists[:len(st.lists)-1]
+		}
+		newLine(b)
+		if len(st.lists) == 0 {
+			b.WriteString("\n")
+		}
+	case "li":
+		newLine(b)
+		if len(st.lists) == 0 {
+			b.WriteString("- ")
+			return
+		}
+
+		list := &st.lists[len(st.lists)-1]
+		b.WriteString(strings.Repeat("  ", len(st.lists)-1))
+		if list.ordered {
+			list.n++
+			fmt.Fprintf(b, "%d. ", list.n)
+		} else {
+			b.WriteString("- ")
+		}
+	case "/li":
+		newLine(b)
+	}
+}
+
+func newLine(b *bytes.Buffer) {
+	trimTrailingSpace(b)
+	if b.Len() > 0 && !bytes.HasSuffix(b.Bytes(), []byte("\n")) {
+		b.WriteString("\n")
+	}
+}
+
+func trimTrailingSpace(b *bytes.Buffer) {
+	b.Truncate(len(bytes.TrimRight(b.Bytes(), " ")))
+}
+
+// normalizeLines removes the trailing spaces of the lines, keeps at most one
+// blank line between them and trims the text.
+func normalizeLines(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
 
-	return output
+	s = blankLinesRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.Trim(s, "\n")
 }
@@ -0,0 +1,63 @@
+package email
+
+import "testing"
+
+func TestStripHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{
+			"entities",
+			`<p>Tom &amp; Jerry&nbsp;&mdash; &lt;friends&gt; &quot;forever&quot; &#8217;til &#x263A;</p>`,
+			`Tom & Jerry — <friends> "forever" ’til ☺`,
+		},
+		{
+			"double escaped entity",
+			`<p>Use &amp;amp; in HTML</p>`,
+			`Use &amp; in HTML`,
+		},
+		{
+			"nested tags",
+			`<div><p>Hello <strong>dear <em>Ada</em></strong>,</p><div><span>see <a href="https://example.com/?a=1&amp;b=2">the <b>docs</b></a></span></div></div>`,
+			"Hello dear Ada,\n\nsee the docs (https://example.com/?a=1&b=2)",
+		},
+		{
+			"whitespace",
+			"<p>\n\t  Hello\n\t  world  </p>\n\n\n<p>second\tparagraph</p><br><br><br><br>end  ",
+			"Hello world\n\nsecond paragraph\n\nend",
+		},
+		{
+			"headings and line breaks",
+			"<h1>Title</h1>line one<br/>line two<br />line three",
+			"Title\n\nline one\nline two\nline three",
+		},
+		{
+			"nested lists",
+			"<ul><li>one<ol><li>first</li><li>second</li></ol></li><li>two</li></ul>",
+			"- one\n  1. first\n  2. second\n- two",
+		},
+		{
+			"full page",
+			`<html><head><title>Ignored</title><style>p { color: red; }</style></head><body class="x"><p>Body only</p><script>alert(1)</script></body></html>`,
+			"Body only",
+		},
+		{
+			"not a tag",
+			"<p>1 < 2 and 3 > 2</p>",
+			"1 < 2 and 3 > 2",
+		},
+		{
+			"plain text",
+			"line one  \r\nline &amp; two\n\n\n\nline three",
+			"line one\nline & two\n\nline three",
+		},
+	}
+
+	for _, tc := range tests {
+		if got := StripHTML(tc.html); got != tc.expected {
+			t.Errorf("%s: expected\n%q\ngot\n%q", tc.name, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package email
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"strings"
+	"text/template"
+)
+
+// Template is an email with an HTML body and an optional purpose-built text
+// body. The text body is derived from the HTML with StripHTML when empty.
+type Template struct {
+	// Name is the email type used to configure its subject and from-name
+	// i.e. "account-created"
+	Name    string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Render executes the HTML and text templates with data.
+func (t Template) Render(data interface{}) (htmlBody, textBody string, err error) {
+	ht, err := htmltemplate.New("html").Parse(t.HTML)
+	if err != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err = ht.Execute(&buf, data); err != nil {
+		return
+	}
+	htmlBody = buf.String()
+
+	if len(strings.TrimSpace(t.Text)) == 0 {
+		textBody = StripHTML(htmlBody)
+		return
+	}
+
+	tt, err := template.New("text").Parse(t.Text)
+	if err != nil {
+		return
+	}
+
+	buf.Reset()
+	if err = tt.Execute(&buf, data); err != nil {
+		return
+	}
+	textBody = buf.String()
+	return
+}
+
+// RenderSubject executes the subject template with data, a configured
+// subject replacing the Subject of a Template can refer to its data.
+func RenderSubject(subject string, data interface{}) (string, error) {
+	tt, err := template.New("subject").Parse(subject)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tt.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,63 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+const welcomeHTML = `<p>Hi {{.Name}},</p>
+<p>Get started with the <a href="https://example.com/docs?from=email&amp;v=2">documentation</a>:</p>
+<ul><li>Create a database</li><li>Add users</li></ul>
+<ol><li>Install the CLI</li><li>Run it</li></ol>`
+
+func TestTemplateDerivedText(t *testing.T) {
+	tmpl := Template{HTML: welcomeHTML}
+
+	_, text, err := tmpl.Render(map[string]string{"Name": "Ada"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"Hi Ada,",
+		"documentation (https://example.com/docs?from=email&v=2)",
+		"- Create a database\n- Add users\n",
+		"1. Install the CLI\n2. Run it",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("expected %q in derived text:\n%s", expected, text)
+		}
+	}
+}
+
+func TestTemplateAuthoredText(t *testing.T) {
+	tmpl := Template{
+		HTML: welcomeHTML,
+		Text: "Hi {{.Name}}, read the docs at https://example.com/docs",
+	}
+
+	html, text, err := tmpl.Render(map[string]string{"Name": "Ada"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if text != "Hi Ada, read the docs at https://example.com/docs" {
+		t.Errorf("expected the authored text got %q", text)
+	}
+	if !strings.Contains(html, `<a href="https://example.com/docs?from=email&amp;v=2">`) {
+		t.Errorf("expected the link in the HTML body got %s", html)
+	}
+}
+
+func TestRenderSubject(t *testing.T) {
+	subject, err := RenderSubject("Welcome to {{.Base}}", map[string]string{"Base": "acme"})
+	if err != nil {
+		t.Fatal(err)
+	} else if subject != "Welcome to acme" {
+		t.Errorf("expected the rendered subject got %q", subject)
+	}
+
+	if _, err := RenderSubject("Welcome to {{.Base", nil); err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+}
@@ -0,0 +1,45 @@
+package email
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/staticbackendhq/core/cache"
+	"github.com/staticbackendhq/core/internal"
+)
+
+// ErrRecipientThrottled is returned by Throttled.Send when the recipient
+// already received the emails allowed in the window.
+var ErrRecipientThrottled = errors.New("too many emails sent to this recipient, try again later")
+
+// Throttled limits the emails sent to each recipient to Limit per Window,
+// the emails past the limit are not sent. It prevents flooding a user with
+// repeated requests i.e. of login codes, see EMAIL_RECIPIENT_RATE_LIMIT.
+type Throttled struct {
+	internal.Mailer
+
+	Limit  int
+	Window time.Duration
+
+	sent *cache.RateLimiter
+}
+
+// NewThrottled returns m sending at most limit emails per window to a
+// recipient.
+func NewThrottled(m internal.Mailer, limit int, window time.Duration) *Throttled {
+	return &Throttled{
+		Mailer: m,
+		Limit:  limit,
+		Window: window,
+		sent:   cache.NewRateLimiter(100000),
+	}
+}
+
+func (t *Throttled) Send(data internal.SendMailData) error {
+	to := strings.ToLower(strings.TrimSpace(data.To))
+	if !t.sent.Allow(to, t.Limit, t.Window) {
+		return ErrRecipientThrottled
+	}
+	return t.Mailer.Send(data)
+}
@@ -0,0 +1,46 @@
+package email
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+type countingMailer struct {
+	sent []string
+}
+
+func (m *countingMailer) Send(data internal.SendMailData) error {
+	m.sent = append(m.sent, data.To)
+	return nil
+}
+
+func (m *countingMailer) Ping() error {
+	return nil
+}
+
+func TestThrottled(t *testing.T) {
+	m := &countingMailer{}
+	th := NewThrottled(m, 2, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		if err := th.Send(internal.SendMailData{To: "user@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the recipient is compared case-insensitively
+	if err := th.Send(internal.SendMailData{To: "User@Example.com"}); !errors.Is(err, ErrRecipientThrottled) {
+		t.Errorf("expected the third email to be throttled got %v", err)
+	}
+
+	if err := th.Send(internal.SendMailData{To: "other@example.com"}); err != nil {
+		t.Errorf("expected another recipient to receive its email got %v", err)
+	}
+
+	if len(m.sent) != 3 {
+		t.Errorf("expected 3 emails sent got %v", m.sent)
+	}
+}
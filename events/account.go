@@ -0,0 +1,37 @@
+package events
+
+import "time"
+
+const (
+	AccountCreatedEvent = "account.created"
+	NewDeviceLoginEvent = "user.newdevicelogin"
+)
+
+// AccountCreated is emitted once a new account, its base and admin user are
+// created.
+type AccountCreated struct {
+	// Base is the name of the created base
+	Base      string
+	PublicKey string
+	Email     string
+	// Password of the admin user, it's only sent to the account owner
+	Password  string
+	RootToken string
+}
+
+func (AccountCreated) Name() string { return AccountCreatedEvent }
+
+// NewDeviceLogin is emitted when a user with a login history signs in from
+// an IP address that's not part of it.
+type NewDeviceLogin struct {
+	Base      string
+	PublicKey string
+	Email     string
+	IP        string
+	UserAgent string
+	// Country is the ISO code sent by the CDN, empty when unknown
+	Country string
+	Time    time.Time
+}
+
+func (NewDeviceLogin) Name() string { return NewDeviceLoginEvent }
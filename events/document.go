@@ -0,0 +1,19 @@
+package events
+
+const DocumentChangedEvent = "db.documentchanged"
+
+// DocumentChanged is emitted once a document is created, updated or deleted
+// through the database API.
+type DocumentChanged struct {
+	// Base is the name of the base
+	Base       string
+	Collection string
+	// Action is internal.WebhookCreate, WebhookUpdate or WebhookDelete
+	Action string
+	ID     string
+	// Document is the document as returned to the writer, only its id
+	// for a delete
+	Document map[string]interface{}
+}
+
+func (DocumentChanged) Name() string { return DocumentChangedEvent }
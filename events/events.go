@@ -0,0 +1,65 @@
+// Package events is an in-process event bus decoupling the side-effects of
+// an action, i.e. emails, webhooks, metrics or audit, from the handlers.
+package events
+
+import (
+	"sync"
+)
+
+// Event is something that happened, its Name is what subscribers listen to.
+type Event interface {
+	Name() string
+}
+
+// Subscriber handles an emitted event.
+type Subscriber func(ev Event) error
+
+// Bus dispatches the emitted events to their subscribers.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[string][]Subscriber
+}
+
+// NewBus returns a bus without subscribers.
+func NewBus() *Bus {
+	return &Bus{subs: make(map[string][]Subscriber)}
+}
+
+// Subscribe adds fn to the subscribers of the events named name.
+func (b *Bus) Subscribe(name string, fn Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subs[name] = append(b.subs[name], fn)
+}
+
+// Emit calls the subscribers of ev in their subscription order. They run
+// synchronously so the caller can report a failure, a slow side-effect
+// should start its own goroutine. All subscribers are called and the first
+// error is returned.
+func (b *Bus) Emit(ev Event) error {
+	b.mu.RLock()
+	subs := b.subs[ev.Name()]
+	b.mu.RUnlock()
+
+	var first error
+	for _, fn := range subs {
+		if err := fn(ev); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+var bus = NewBus()
+
+// Subscribe adds fn to the subscribers of the events named name on the
+// application bus.
+func Subscribe(name string, fn Subscriber) {
+	bus.Subscribe(name, fn)
+}
+
+// Emit dispatches ev on the application bus.
+func Emit(ev Event) error {
+	return bus.Emit(ev)
+}
@@ -0,0 +1,48 @@
+package events
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEmit(t *testing.T) {
+	b := NewBus()
+
+	var received []AccountCreated
+	b.Subscribe(AccountCreatedEvent, func(ev Event) error {
+		received = append(received, ev.(AccountCreated))
+		return nil
+	})
+
+	if err := b.Emit(AccountCreated{Email: "new@test.com"}); err != nil {
+		t.Fatal(err)
+	} else if len(received) != 1 || received[0].Email != "new@test.com" {
+		t.Errorf("expected the subscriber to receive the event got %v", received)
+	}
+}
+
+func TestEmitWithoutSubscribers(t *testing.T) {
+	if err := NewBus().Emit(AccountCreated{}); err != nil {
+		t.Errorf("expected no error without subscribers got %v", err)
+	}
+}
+
+func TestEmitSubscriberError(t *testing.T) {
+	b := NewBus()
+
+	calls := 0
+	b.Subscribe(AccountCreatedEvent, func(ev Event) error {
+		calls++
+		return errors.New("unable to send")
+	})
+	b.Subscribe(AccountCreatedEvent, func(ev Event) error {
+		calls++
+		return nil
+	})
+
+	if err := b.Emit(AccountCreated{}); err == nil || err.Error() != "unable to send" {
+		t.Errorf("expected the subscriber error got %v", err)
+	} else if calls != 2 {
+		t.Errorf("expected all subscribers to be called got %d", calls)
+	}
+}
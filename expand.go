@@ -0,0 +1,170 @@
+package staticbackend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/staticbackendhq/core/config"
+	"github.com/staticbackendhq/core/internal"
+)
+
+// maxExpandDepth is the number of nested relations that can be expanded,
+// "projectId.clientId" is 2 levels deep.
+const maxExpandDepth = 3
+
+// collectionRelations returns the relation fields of col and the
+// collection they reference.
+func collectionRelations(col string) map[string]string {
+	relations := config.Current.Settings.CollectionRelations
+	if rels, ok := relations[col]; ok {
+		return rels
+	}
+	return relations[internal.CleanCollectionName(col)]
+}
+
+// parseExpand reads the expand query parameter of the documents of col, a
+// comma separated list of relation fields where the nested relations of
+// the referenced documents are dot separated i.e. "projectId.clientId".
+func parseExpand(col, v string) ([][]string, error) {
+	var paths [][]string
+
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); len(p) == 0 {
+			continue
+		}
+
+		path := strings.Split(p, ".")
+		if len(path) > maxExpandDepth {
+			return nil, fmt.Errorf("expand %s is deeper than %d relations", p, maxExpandDepth)
+		}
+
+		// the relations are checked before any document is fetched
+		target := col
+		for _, field := range path {
+			next, ok := collectionRelations(target)[field]
+			if !ok {
+				return nil, fmt.Errorf("expand %s: %s is not a relation of %s", p, field, target)
+			}
+			target = next
+		}
+
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// expander embeds the referenced documents the auth can read, a reference
+// to a document that can't be read, is missing or expired stays as is.
+type expander struct {
+	ds     internal.Persister
+	auth   internal.Auth
+	dbName string
+	now    time.Time
+	// fetched documents by collection and id, nil when it can't be read
+	fetched map[string]map[string]interface{}
+}
+
+func newExpander(ds internal.Persister, auth internal.Auth, dbName string) *expander {
+	return &expander{
+		ds:      ds,
+		auth:    auth,
+		dbName:  dbName,
+		now:     time.Now(),
+		fetched: make(map[string]map[string]interface{}),
+	}
+}
+
+// expand replaces the relation fields of the docs of col following paths
+// returned by parseExpand.
+func (e *expander) expand(col string, docs []map[string]interface{}, paths [][]string) error {
+	for _, path := range paths {
+		if err := e.expandPath(col, docs, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *expander) expandPath(col string, docs []map[string]interface{}, path []string) error {
+	field := path[0]
+	target := collectionRelations(col)[field]
+
+	// the documents of a level are fetched at once
+	var ids []string
+	for _, doc := range docs {
+		if id, ok := doc[field].(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	if err := e.fetch(target, ids); err != nil {
+		return err
+	}
+
+	var refs []map[string]interface{}
+	for _, doc := range docs {
+		var ref map[string]interface{}
+		switch v := doc[field].(type) {
+		case string:
+			found := e.fetched[target+"/"+v]
+			if found == nil {
+				continue
+			}
+
+			// a copy per reference, a document referencing itself would
+			// otherwise embed itself once its nested relations are expanded
+			ref = make(map[string]interface{}, len(found))
+			for k, v := range found {
+				ref[k] = v
+			}
+		case map[string]interface{}:
+			// already expanded by another path
+			ref = v
+		default:
+			continue
+		}
+
+		doc[field] = ref
+		refs = append(refs, ref)
+	}
+
+	if len(path) == 1 || len(refs) == 0 {
+		return nil
+	}
+	return e.expandPath(target, refs, path[1:])
+}
+
+// fetch reads the documents ids of col that were not fetched yet, the
+// ones the auth can't read are recorded as nil.
+func (e *expander) fetch(col string, ids []string) error {
+	var missing []string
+	for _, id := range ids {
+		key := col + "/" + id
+		if _, ok := e.fetched[key]; !ok {
+			e.fetched[key] = nil
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	docs, err := e.ds.GetDocumentsByIDs(e.auth, e.dbName, col, missing)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return err
+	} else if err != nil {
+		// the references stay as is like the unreadable ones
+		return nil
+	}
+
+	for _, doc := range docs {
+		if isExpired(col, doc, e.now) {
+			continue
+		}
+		e.fetched[col+"/"+fmt.Sprint(doc["id"])] = doc
+	}
+	return nil
+}
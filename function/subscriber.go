@@ -19,7 +19,7 @@ func (sub *Subscriber) Start() {
 	receiver := make(chan internal.Command)
 	close := make(chan bool)
 
-	go sub.PubSub.Subscribe(receiver, "", "sbsys", close)
+	go sub.PubSub.Subscribe(receiver, "", "sbsys", "", close)
 
 	for {
 		select {
@@ -36,7 +36,8 @@ func (sub *Subscriber) process(msg internal.Command) {
 	case internal.MsgTypeChanOut,
 		internal.MsgTypeDBCreated,
 		internal.MsgTypeDBUpdated,
-		internal.MsgTypeDBDeleted:
+		internal.MsgTypeDBDeleted,
+		internal.MsgTypeUserCreated:
 		sub.handleRealtimeEvents(msg)
 	}
 }
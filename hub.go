@@ -1,12 +1,14 @@
 package staticbackend
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
 
-	"github.com/gbrlsnchs/jwt/v3"
 	"github.com/gorilla/websocket"
 )
 
@@ -22,6 +24,12 @@ type Hub struct {
 	// Socket's subscribed channels
 	channels map[*Socket][]chan bool
 
+	// Base of the sockets, counted in realtimeConnections
+	bases map[*Socket]string
+
+	// Auth of the authenticated sockets
+	auths map[*Socket]internal.Auth
+
 	// Inbound messages from the clients.
 	broadcast chan internal.Command
 
@@ -43,6 +51,8 @@ func newHub(c internal.Volatilizer) *Hub {
 		sockets:    make(map[*Socket]string),
 		ids:        make(map[string]*Socket),
 		channels:   make(map[*Socket][]chan bool),
+		bases:      make(map[*Socket]string),
+		auths:      make(map[*Socket]internal.Auth),
 		volatile:   c,
 	}
 }
@@ -53,6 +63,7 @@ func (h *Hub) run() {
 		case sck := <-h.register:
 			h.sockets[sck] = sck.id
 			h.ids[sck.id] = sck
+			h.bases[sck] = sck.base.ID
 
 			cmd := internal.Command{
 				Type: "init",
@@ -63,9 +74,11 @@ func (h *Hub) run() {
 		case sck := <-h.unregister:
 			if _, ok := h.sockets[sck]; ok {
 				h.unsub(sck)
+				h.closeConnection(sck)
 				delete(h.sockets, sck)
 				delete(h.ids, sck.id)
 				delete(h.channels, sck)
+				delete(h.auths, sck)
 				//time.AfterFunc(500*time.Millisecond, func() {
 				close(sck.send)
 				//})
@@ -77,10 +90,12 @@ func (h *Hub) run() {
 				case sck.send <- p:
 				default:
 					h.unsub(sck)
+					h.closeConnection(sck)
 					close(sck.send)
 					delete(h.ids, msg.SID)
 					delete(h.sockets, sck)
 					delete(h.channels, sck)
+					delete(h.auths, sck)
 				}
 			}
 		}
@@ -100,19 +115,22 @@ func (h *Hub) getTargets(msg internal.Command) (sockets []*Socket, payload inter
 		payload.Data = "echo: " + msg.Data
 	case internal.MsgTypeAuth:
 		sockets = append(sockets, sender)
-		var pl internal.JWTPayload
-		if _, err := jwt.Verify([]byte(msg.Data), internal.HashSecret, &pl); err != nil {
-			payload = internal.Command{Type: internal.MsgTypeError, Data: "invalid token"}
-			return
-		}
 
-		var a internal.Auth
-		if err := volatile.GetTyped(pl.Token, &a); err != nil {
+		auth, key, err := h.authenticate(sender, msg.Data)
+		if err != nil {
 			payload = internal.Command{Type: internal.MsgTypeError, Data: "invalid token"}
 		} else {
-			payload = internal.Command{Type: internal.MsgTypeToken, Data: pl.Token}
+			h.auths[sender] = auth
+			payload = internal.Command{Type: internal.MsgTypeToken, Data: key}
 		}
 	case internal.MsgTypeJoin:
+		// the user events carry the users' email, they're for root users
+		if internal.IsUserChannel(msg.Data) && h.auths[sender].Role < middleware.RootRole {
+			sockets = append(sockets, sender)
+			payload = internal.Command{Type: internal.MsgTypeError, Data: "you cannot join the users channel"}
+			return
+		}
+
 		subs, ok := h.channels[sender]
 		if !ok {
 			subs = make([]chan bool, 0)
@@ -121,7 +139,7 @@ func (h *Hub) getTargets(msg internal.Command) (sockets []*Socket, payload inter
 		closeSubChan := make(chan bool)
 		subs = append(subs, closeSubChan)
 
-		go h.volatile.Subscribe(sender.send, msg.Token, msg.Data, closeSubChan)
+		go h.volatile.Subscribe(sender.send, msg.Token, msg.Data, msg.Resume, closeSubChan)
 
 		sockets = append(sockets, sender)
 		payload = internal.Command{Type: internal.MsgTypeJoined, Data: msg.Data}
@@ -137,6 +155,12 @@ func (h *Hub) getTargets(msg internal.Command) (sockets []*Socket, payload inter
 				Data: "you cannot write to database channel",
 			}
 			return
+		} else if internal.IsUserChannel(msg.Channel) {
+			payload = internal.Command{
+				Type: internal.MsgTypeError,
+				Data: "you cannot write to the users channel",
+			}
+			return
 		}
 
 		if err := h.volatile.Publish(msg); err != nil {
@@ -155,6 +179,41 @@ func (h *Hub) getTargets(msg internal.Command) (sockets []*Socket, payload inter
 	return
 }
 
+// authenticate validates the JWT on the base of the socket like the HTTP
+// requests, including the session binding against the client of the
+// socket's handshake. It returns the auth and the key of the cached auth and
+// base.
+func (h *Hub) authenticate(sck *Socket, token string) (internal.Auth, string, error) {
+	ctx := context.WithValue(context.Background(), middleware.ContextBase, sck.base)
+	ctx = context.WithValue(ctx, middleware.ContextClient, sck.client)
+
+	auth, err := middleware.ValidateAuthKey(datastore, h.volatile, ctx, token)
+	if err != nil {
+		return auth, "", err
+	}
+
+	// the cached auth is shared by all bases, the token must be one of the
+	// socket's base
+	key := auth.ReconstructToken()
+
+	var conf internal.BaseConfig
+	if err := h.volatile.GetTyped("base:"+key, &conf); err != nil {
+		return auth, "", err
+	} else if conf.ID != sck.base.ID {
+		return auth, "", errors.New("the token is not from the base of the connection")
+	}
+	return auth, key, nil
+}
+
+// closeConnection removes the socket from the realtime connections of its
+// base.
+func (h *Hub) closeConnection(sck *Socket) {
+	if base, ok := h.bases[sck]; ok {
+		realtimeConnections.Close(base)
+		delete(h.bases, sck)
+	}
+}
+
 func (h *Hub) join(scksck *websocket.Conn, channel string) {
 
 }
@@ -2,7 +2,7 @@ package internal
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"strings"
 	"time"
 
@@ -17,19 +17,48 @@ type Auth struct {
 	Role      int
 	Token     string
 	Plan      int
+	// ImpersonatedBy is the email of the root user acting on behalf of
+	// this user, empty for normal sessions.
+	ImpersonatedBy string
 }
 
+// IsImpersonated returns true when a root user is acting as this user.
+func (auth Auth) IsImpersonated() bool {
+	return len(auth.ImpersonatedBy) > 0
+}
+
+// ReconstructToken returns the key of the cached auth and base of the
+// token, see UserToken.Key.
 func (auth Auth) ReconstructToken() string {
 	if strings.HasPrefix(auth.Token, "__tmp__experimental_public") {
 		return auth.Token
 	}
-	return fmt.Sprintf("%s|%s", auth.UserID, auth.Token)
+	return UserToken{ID: auth.UserID, Token: auth.Token}.Key()
 }
 
 // JWTPayload contains the current user token
 type JWTPayload struct {
 	jwt.Payload
 	Token string `json:"token,omitempty"`
+	// ImpersonatedBy is set when a root user minted this token to act
+	// as the user.
+	ImpersonatedBy string `json:"impersonatedBy,omitempty"`
+	// Session is the SessionFingerprint of the client the token was issued
+	// to when the base has a session binding.
+	Session string `json:"session,omitempty"`
+}
+
+// EmailChangePayload is the signed token of an email change confirmation
+// link.
+type EmailChangePayload struct {
+	jwt.Payload
+	// Base is the name of the database of the user
+	Base    string `json:"base"`
+	TokenID string `json:"tokenId"`
+	// Email is the email when the change was requested, the confirmation
+	// is rejected if it changed since
+	Email    string `json:"email"`
+	NewEmail string `json:"newEmail"`
 }
 
 var (
@@ -51,11 +80,56 @@ type Token struct {
 	Role      int       `json:"role"`
 	ResetCode string    `json:"-"`
 	Created   time.Time `json:"created"`
+	// Label optional name identifying the token i.e. "ci-deploy"
+	Label string `json:"label"`
+}
+
+// UserCreated is the data of a MsgTypeUserCreated event, sent when a user
+// registers in a base.
+type UserCreated struct {
+	ID        string `json:"id"`
+	AccountID string `json:"accountId"`
+	Email     string `json:"email"`
+	Role      int    `json:"role"`
 }
 
+// LoginEvent is a successful login of a user.
+type LoginEvent struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"-"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	Created   time.Time `json:"created"`
+}
+
+// Impersonation records a token of a user issued to a root user, the
+// requests made with it have Auth.ImpersonatedBy set.
+type Impersonation struct {
+	ID             string    `json:"id"`
+	ImpersonatedBy string    `json:"impersonatedBy"`
+	UserID         string    `json:"userId"`
+	Email          string    `json:"email"`
+	Expires        time.Time `json:"expires"`
+	Created        time.Time `json:"created"`
+}
+
+// LoginCode is the single-use code emailed to a user to sign in without
+// their password, only its hash is stored.
+type LoginCode struct {
+	UserID  string
+	Hash    string
+	Expires time.Time
+}
+
+// ErrInvalidLoginCode is returned by UseLoginCode when the code does not
+// match, expired or was already used.
+var ErrInvalidLoginCode = errors.New("invalid or expired login code")
+
 type Login struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// Label optional name of the token created on registration
+	Label string `json:"label"`
 }
 
 const (
@@ -0,0 +1,20 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidatePublicAliases returns an error when an alias of
+// BaseConfig.PublicAliases is not a plain collection name or does not
+// resolve to a public collection starting with pub_.
+func ValidatePublicAliases(aliases map[string]string) error {
+	for alias, col := range aliases {
+		if len(alias) == 0 || strings.HasPrefix(alias, "pub_") || strings.Contains(alias, "/") {
+			return fmt.Errorf("invalid alias %q, it cannot be empty, start with pub_ or contain a /", alias)
+		} else if !strings.HasPrefix(col, "pub_") || len(col) == len("pub_") || strings.Contains(col, "/") {
+			return fmt.Errorf("alias %s must resolve to a public collection starting with pub_ got %q", alias, col)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package internal
+
+import "testing"
+
+func TestValidatePublicAliases(t *testing.T) {
+	if err := ValidatePublicAliases(map[string]string{"posts": "pub_posts", "contact": "pub_contacts"}); err != nil {
+		t.Error(err)
+	}
+
+	for alias, col := range map[string]string{"posts": "posts", "pages": "pub_", "": "pub_posts", "pub_posts": "pub_posts", "a/b": "pub_posts", "docs": "pub_a/b"} {
+		if err := ValidatePublicAliases(map[string]string{alias: col}); err == nil {
+			t.Errorf("expected an error for %q:%q", alias, col)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package internal
+
+const (
+	CaptchaProviderReCaptcha = "recaptcha"
+	CaptchaProviderHCaptcha  = "hcaptcha"
+)
+
+// CaptchaVerifier verifies the CAPTCHA response token sent by a client.
+type CaptchaVerifier interface {
+	Verify(token, remoteIP string) (bool, error)
+}
@@ -1,10 +1,12 @@
 package internal
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gbrlsnchs/jwt/v3"
@@ -19,6 +21,109 @@ type BaseConfig struct {
 	IsActive         bool      `json:"-"`
 	MonthlySentEmail int       `json:"-"`
 	Created          time.Time `json:"created"`
+	// AllowedUploadTypes overrides the MIME types accepted by the upload
+	AllowedUploadTypes []string `json:"allowedUploadTypes"`
+	// MaxUploadSize overrides the upload maximum size in bytes when > 0
+	MaxUploadSize int64 `json:"maxUploadSize"`
+	// DisplayName is the human-facing name of the base. It can be changed
+	// while the ID and Name, the physical database name, stay the same.
+	DisplayName string `json:"displayName"`
+	// PublicKey is set once the key has been rotated, until then the ID is
+	// the public key, see Key.
+	PublicKey string `json:"publicKey"`
+	// PreviousPublicKey stays valid until PreviousKeyExpires after a rotation.
+	PreviousPublicKey  string    `json:"-"`
+	PreviousKeyExpires time.Time `json:"-"`
+	// SessionBinding ties the user tokens to the client they were issued
+	// to, see SessionBindingIP and friends. Empty disables it.
+	SessionBinding string `json:"sessionBinding"`
+	// Features turns the features of the base on or off, see
+	// FeatureRealtime and friends. A missing feature is enabled.
+	Features map[string]bool `json:"features"`
+	// PublicAliases maps friendly collection names to the public collections
+	// they resolve to on the /db and /query routes, i.e. posts: pub_posts.
+	PublicAliases map[string]string `json:"publicAliases"`
+}
+
+// Key returns the public key clients use to reach the base.
+func (b BaseConfig) Key() string {
+	if len(b.PublicKey) > 0 {
+		return b.PublicKey
+	}
+	return b.ID
+}
+
+// AcceptsKey returns true when key is the current public key or the previous
+// one while its grace period is not over.
+func (b BaseConfig) AcceptsKey(key string, now time.Time) bool {
+	if len(key) == 0 {
+		return false
+	} else if key == b.Key() {
+		return true
+	}
+	return key == b.PreviousPublicKey && now.Before(b.PreviousKeyExpires)
+}
+
+// ErrBaseNameTaken is returned by CreateBase when another base already uses
+// the same name. Callers can safely retry with a different name.
+var ErrBaseNameTaken = errors.New("a database with this name already exists")
+
+// ErrEmailTaken is returned when creating a customer or a user with an
+// email already in use, emails are compared case-insensitively.
+var ErrEmailTaken = errors.New("this email is already in use")
+
+// ErrTokenLimit is returned when issuing a JWT to a user that has reached
+// MAX_TOKENS_PER_USER active sessions.
+var ErrTokenLimit = errors.New("the maximum number of tokens for this user has been reached")
+
+// ErrLastAdmin is returned by DemoteUser to prevent a base from being left
+// without an admin.
+var ErrLastAdmin = errors.New("the last admin of a base cannot be demoted")
+
+// NormalizeEmail returns the stored form of an email, emails are unique
+// regardless of their casing.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// ErrBaseNotFound is returned by FindDatabase and FindDatabaseByKey when no
+// base matches.
+var ErrBaseNotFound = errors.New("base not found")
+
+// ErrInactiveAccount is returned when the base or its customer is inactive,
+// i.e. its payment failed. Only the billing routes accept inactive bases.
+var ErrInactiveAccount = errors.New("your account is inactive, please update your billing information or contact us support@staticbackend.com")
+
+// ErrIndexNotFound is returned by DropIndex when the index does not exist.
+var ErrIndexNotFound = errors.New("index not found")
+
+// ErrIndexConflict is returned by CreateIndex when the field already has
+// an index that is unique, or not, unlike the one requested.
+var ErrIndexConflict = errors.New("the field already has an index with a different uniqueness, drop it first")
+
+// ErrUniqueIndexRequired is returned by CreateDocumentIfAbsent when the
+// backend needs a unique index to insert atomically and none of the fields
+// matched with = have one.
+var ErrUniqueIndexRequired = errors.New("a conditional create requires a unique index on a field matched with =")
+
+// Index describes an index on a collection field. The name is backend
+// specific and is the one to use to drop the index. Geo indexes speed up
+// the near and within queries on GeoJSON points.
+type Index struct {
+	Name   string `json:"name"`
+	Field  string `json:"field"`
+	Unique bool   `json:"unique"`
+	Geo    bool   `json:"geo"`
+}
+
+// DuplicateValueError is returned on write when a document has the same
+// value as another one for a field with a unique index.
+type DuplicateValueError struct {
+	Field string
+}
+
+func (e *DuplicateValueError) Error() string {
+	return fmt.Sprintf("a document with the same %s already exists", e.Field)
 }
 
 type PagedResult struct {
@@ -26,27 +131,64 @@ type PagedResult struct {
 	Size    int64                    `json:"size"`
 	Total   int64                    `json:"total"`
 	Results []map[string]interface{} `json:"results"`
+	// CountSkipped is true when the total was not computed, the total
+	// field is then omitted from the JSON
+	CountSkipped bool `json:"-"`
+}
+
+// MarshalJSON omits the total when the count was skipped.
+func (p PagedResult) MarshalJSON() ([]byte, error) {
+	type paged PagedResult
+	if !p.CountSkipped {
+		return json.Marshal(paged(p))
+	}
+
+	return json.Marshal(struct {
+		Page    int64                    `json:"page"`
+		Size    int64                    `json:"size"`
+		Results []map[string]interface{} `json:"results"`
+	}{p.Page, p.Size, p.Results})
 }
 
 type ListParams struct {
-	Page           int64
-	Size           int64
-	SortBy         string
-	SortDescending bool
+	Page int64
+	Size int64
+	// Sort is the sort specification, see ParseSort and SortFields
+	Sort []SortField
+	// Fields restricts the returned fields, the id is always included
+	Fields []string
+	// SkipCount prevents counting all matching documents, useful on
+	// huge collections
+	SkipCount bool
 }
 
 var (
 	//Tokens     map[string]Auth       = make(map[string]Auth)
 	//Bases      map[string]BaseConfig = make(map[string]BaseConfig)
-	HashSecret *jwt.HMACSHA
+	hashSecret       *jwt.HMACSHA
+	hashSecretSource string
+	hashSecretMutex  sync.Mutex
+
+	// used when no JWT_SECRET is configured, tokens won't survive a restart
+	fallbackSecret = fmt.Sprintf("%d", time.Now().UnixNano())
 )
 
-func init() {
-	secret := os.Getenv("JWT_SECRET")
+// HashSecret returns the JWT algorithm for config.Current.JWTSecret. It's
+// re-created when the secret changes so it can be set programmatically.
+func HashSecret() *jwt.HMACSHA {
+	secret := config.Current.JWTSecret
 	if len(secret) == 0 {
-		secret = fmt.Sprintf("%d", time.Now().UnixNano())
+		secret = fallbackSecret
 	}
-	HashSecret = jwt.NewHS256([]byte(secret))
+
+	hashSecretMutex.Lock()
+	defer hashSecretMutex.Unlock()
+
+	if hashSecret == nil || hashSecretSource != secret {
+		hashSecret = jwt.NewHS256([]byte(secret))
+		hashSecretSource = secret
+	}
+	return hashSecret
 }
 
 const (
@@ -66,14 +208,39 @@ const (
 	MsgTypeDBCreated = "db_created"
 	MsgTypeDBUpdated = "db_updated"
 	MsgTypeDBDeleted = "db_deleted"
+
+	MsgTypeUserCreated = "user_created"
+
+	// MsgTypeResume is sent once subscribed to a channel with retained
+	// messages, its Resume is the position to send when joining again
+	MsgTypeResume = "resume"
+
+	// UserChannelPrefix starts the name of the channels receiving the
+	// MsgTypeUserCreated events of a base, see UserChannel
+	UserChannelPrefix = "sb-users"
 )
 
+// UserChannel returns the channel receiving the MsgTypeUserCreated events
+// of the base.
+func UserChannel(baseID string) string {
+	return UserChannelPrefix + "-" + baseID
+}
+
+// IsUserChannel returns if the channel receives MsgTypeUserCreated events,
+// only root users can join it.
+func IsUserChannel(channel string) bool {
+	return strings.HasPrefix(strings.ToLower(channel), UserChannelPrefix)
+}
+
 type Command struct {
-	SID           string `json:"sid"`
-	Type          string `json:"type"`
-	Data          string `json:"data"`
-	Channel       string `json:"channel"`
-	Token         string `json:"token"`
+	SID     string `json:"sid"`
+	Type    string `json:"type"`
+	Data    string `json:"data"`
+	Channel string `json:"channel"`
+	Token   string `json:"token"`
+	// Resume is the position of a retained message in its channel. It's
+	// sent with a MsgTypeJoin to receive the messages published after it.
+	Resume        string `json:"resume,omitempty"`
 	IsSystemEvent bool   `json:"-"`
 }
 
@@ -85,6 +252,24 @@ func (msg Command) IsDBEvent() bool {
 	return false
 }
 
+// ClientVisible returns the message as sent to the channel subscribers. The
+// token of a MsgTypeUserCreated is the new user's session, it's only for the
+// server-side functions.
+func (msg Command) ClientVisible() Command {
+	if msg.Type == MsgTypeUserCreated {
+		msg.Token = ""
+	}
+	return msg
+}
+
+var collectionNameRe = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// ValidCollectionName returns if col can be used as a table or collection
+// name, i.e. it cannot reference another schema or database.
+func ValidCollectionName(col string) bool {
+	return collectionNameRe.MatchString(col)
+}
+
 func CleanCollectionName(col string) string {
 	if strings.EqualFold(config.Current.KeepPermissionInName, "yes") {
 		return col
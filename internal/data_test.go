@@ -1,7 +1,11 @@
 package internal
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
+
+	"github.com/staticbackendhq/core/config"
 )
 
 func TestCleanCollectionName(t *testing.T) {
@@ -10,3 +14,175 @@ func TestCleanCollectionName(t *testing.T) {
 		t.Errorf("expected col to be tasks got %s", col)
 	}
 }
+
+func TestValidCollectionName(t *testing.T) {
+	for _, col := range []string{"tasks", "pub_posts", "tasks_770_"} {
+		if !ValidCollectionName(col) {
+			t.Errorf("expected %s to be valid", col)
+		}
+	}
+
+	for _, col := range []string{"", "tasks,other.tasks", "mybase.sb_tokens", "tasks;drop", "1tasks", `"tasks"`} {
+		if ValidCollectionName(col) {
+			t.Errorf("expected %s to be invalid", col)
+		}
+	}
+}
+
+func TestPagedResultOmitsSkippedTotal(t *testing.T) {
+	b, err := json.Marshal(PagedResult{Page: 1, Size: 25, Total: 3})
+	if err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(string(b), `"total":3`) {
+		t.Errorf("expected total in %s", b)
+	}
+
+	b, err = json.Marshal(PagedResult{Page: 1, Size: 25, CountSkipped: true})
+	if err != nil {
+		t.Fatal(err)
+	} else if strings.Contains(string(b), "total") {
+		t.Errorf("expected total to be omitted from %s", b)
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	sort, err := ParseSort("title, -likes")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(sort) != 2 {
+		t.Fatalf("expected 2 keys got %d", len(sort))
+	} else if sort[0] != (SortField{Field: "title"}) || sort[1] != (SortField{Field: "likes", Descending: true}) {
+		t.Errorf("unexpected sort %v", sort)
+	}
+
+	if _, err := ParseSort("address.city"); err != nil {
+		t.Errorf("expected nested field to be accepted got %v", err)
+	}
+
+	rejected := []string{
+		"data._nested",
+		"data..nested",
+		"_id",
+		"sb_created",
+		"title;DROP TABLE x",
+		"title,title",
+		"a,b,c,d",
+	}
+	for _, spec := range rejected {
+		if _, err := ParseSort(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestSortFieldsDefaultsToID(t *testing.T) {
+	fields := ListParams{}.SortFields()
+	if len(fields) != 1 || fields[0] != (SortField{Field: SortFieldID}) {
+		t.Errorf("expected default sort by id got %v", fields)
+	}
+
+	fields = ListParams{Sort: []SortField{{Field: "title", Descending: true}}}.SortFields()
+	if len(fields) != 2 || fields[1] != (SortField{Field: SortFieldID, Descending: true}) {
+		t.Errorf("expected id as tie-breaker got %v", fields)
+	}
+}
+
+func TestProject(t *testing.T) {
+	doc := map[string]interface{}{"id": "1", "title": "t", "done": true, "secret": "x"}
+
+	projected := Project(doc, []string{"title", "missing"})
+	if len(projected) != 2 || projected["id"] != "1" || projected["title"] != "t" {
+		t.Errorf("expected only id and title got %v", projected)
+	}
+
+	if all := Project(doc, nil); len(all) != len(doc) {
+		t.Errorf("expected all fields without projection got %v", all)
+	}
+
+	if _, err := ParseFields("title,data.sb_nested"); err == nil {
+		t.Errorf("expected nested system field to be rejected")
+	}
+}
+
+func TestProjectNestedField(t *testing.T) {
+	doc := map[string]interface{}{
+		"id":      "1",
+		"title":   "t",
+		"address": map[string]interface{}{"city": "Montreal", "zip": "H0H"},
+	}
+
+	fields, err := ParseFields("address.city")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	projected := Project(doc, fields)
+	address, ok := projected["address"].(map[string]interface{})
+	if !ok || len(address) != 1 || address["city"] != "Montreal" {
+		t.Errorf("expected only address.city got %v", projected)
+	} else if _, ok := projected["title"]; ok {
+		t.Errorf("expected title to be excluded got %v", projected)
+	}
+
+	SetPath(doc, "address.geo.lat", 45.5)
+	if v, ok := GetPath(doc, "address.geo.lat"); !ok || v != 45.5 {
+		t.Errorf("expected address.geo.lat to be 45.5 got %v", v)
+	}
+	if _, ok := GetPath(doc, "title.missing"); ok {
+		t.Errorf("expected a path through a non object to be missing")
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	defaults := []config.FieldDefault{
+		{Field: "status", Value: "new"},
+		{Field: "slug", SlugOf: "title"},
+		{Field: "meta.views", Value: 0.0},
+	}
+
+	doc := map[string]interface{}{"title": "Hello, World!"}
+	ApplyDefaults(doc, defaults)
+
+	if doc["status"] != "new" || doc["slug"] != "hello-world" {
+		t.Errorf("expected defaults to be filled got %v", doc)
+	} else if v, _ := GetPath(doc, "meta.views"); v != 0.0 {
+		t.Errorf("expected meta.views to default to 0 got %v", doc)
+	}
+
+	doc = map[string]interface{}{"title": "Hello", "status": "done", "slug": "custom"}
+	ApplyDefaults(doc, defaults)
+
+	if doc["status"] != "done" || doc["slug"] != "custom" {
+		t.Errorf("expected provided values to be kept got %v", doc)
+	}
+}
+
+func TestSlug(t *testing.T) {
+	tests := map[string]string{
+		"Hello, World!":  "hello-world",
+		"  --Trim me-- ": "trim-me",
+		"Café au lait":   "café-au-lait",
+		"2023 Q4 report": "2023-q4-report",
+	}
+	for s, expected := range tests {
+		if slug := Slug(s); slug != expected {
+			t.Errorf("slug of %q: expected %q got %q", s, expected, slug)
+		}
+	}
+}
+
+func TestClientVisibleUserCreated(t *testing.T) {
+	msg := Command{Type: MsgTypeUserCreated, Channel: UserChannel("base-id"), Token: "session-key"}
+	if tok := msg.ClientVisible().Token; len(tok) > 0 {
+		t.Errorf("expected the user created token to be removed got %s", tok)
+	}
+
+	msg = Command{Type: MsgTypeChanIn, Channel: "chat", Token: "session-key"}
+	if tok := msg.ClientVisible().Token; tok != "session-key" {
+		t.Errorf("expected the other messages to be unchanged got %s", tok)
+	}
+
+	if !IsUserChannel(UserChannel("base-id")) || !IsUserChannel("SB-USERS") || IsUserChannel("chat") {
+		t.Error("unexpected user channel detection")
+	}
+}
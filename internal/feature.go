@@ -0,0 +1,25 @@
+package internal
+
+// Features of a base that can be turned off per tenant, see
+// BaseConfig.Features.
+const (
+	FeatureRealtime          = "realtime"
+	FeatureFunctions         = "functions"
+	FeaturePublicCollections = "publicCollections"
+)
+
+// ValidFeature returns if name is one of the features that can be toggled.
+func ValidFeature(name string) bool {
+	switch name {
+	case FeatureRealtime, FeatureFunctions, FeaturePublicCollections:
+		return true
+	}
+	return false
+}
+
+// FeatureEnabled returns if the feature is enabled for the base, the
+// features are enabled unless they're turned off.
+func (b BaseConfig) FeatureEnabled(name string) bool {
+	enabled, ok := b.Features[name]
+	return !ok || enabled
+}
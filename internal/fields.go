@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/staticbackendhq/core/config"
+)
+
+// IDField is the document id key returned by all backends.
+const IDField = "id"
+
+// UpdatedField is the system field holding when a document was last
+// written, the backends set it on every write.
+const UpdatedField = "sb_updated"
+
+// system fields (prefixed by _ or sb_) are not handled the same way on all
+// backends, they cannot be sorted, projected or indexed.
+var fieldNameRe = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// ValidFieldName returns if field can be used to index. Sorts and
+// projections also accept nested fields, see ValidFieldPath.
+func ValidFieldName(field string) bool {
+	return fieldNameRe.MatchString(field) && !strings.HasPrefix(field, "sb_")
+}
+
+// ValidFieldPath returns if field is a valid field name or a dot path of
+// valid field names to a nested field i.e. address.city.
+func ValidFieldPath(field string) bool {
+	for _, name := range strings.Split(field, ".") {
+		if !ValidFieldName(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetPath returns the value of the field at the dot path of doc.
+func GetPath(doc map[string]interface{}, field string) (interface{}, bool) {
+	var v interface{} = doc
+	for _, name := range strings.Split(field, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		} else if v, ok = m[name]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// SetPath sets the field at the dot path of doc to v, the missing
+// intermediate objects are created.
+func SetPath(doc map[string]interface{}, field string, v interface{}) {
+	names := strings.Split(field, ".")
+	for _, name := range names[:len(names)-1] {
+		next, ok := doc[name].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			doc[name] = next
+		}
+		doc = next
+	}
+	doc[names[len(names)-1]] = v
+}
+
+// Touch sets the UpdatedField of doc to now. It's stored as an RFC 3339
+// string so it reads back the same from all backends.
+func Touch(doc map[string]interface{}) {
+	doc[UpdatedField] = time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+// UpdatedAt returns when doc was last written. It's false for documents
+// written before their updated time was recorded.
+func UpdatedAt(doc map[string]interface{}) (time.Time, bool) {
+	s, ok := doc[UpdatedField].(string)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// ParseFields parses a projection like "title,done". An empty spec returns
+// nil which means all fields.
+func ParseFields(spec string) ([]string, error) {
+	if len(strings.TrimSpace(spec)) == 0 {
+		return nil, nil
+	}
+
+	var fields []string
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if !ValidFieldPath(field) {
+			return nil, fmt.Errorf("selecting field %q is not allowed", field)
+		}
+
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// Project returns a document with only the id and the requested fields.
+// It's applied on documents that passed the read permissions, so a
+// projection can only narrow what a caller sees. No fields returns doc as is.
+func Project(doc map[string]interface{}, fields []string) map[string]interface{} {
+	if len(fields) == 0 || doc == nil {
+		return doc
+	}
+
+	projected := map[string]interface{}{IDField: doc[IDField]}
+	for _, field := range fields {
+		if v, ok := GetPath(doc, field); ok {
+			SetPath(projected, field, v)
+		}
+	}
+	return projected
+}
+
+// ApplyDefaults sets the fields of defaults missing from doc. A computed
+// slug is skipped when its source field is not a string.
+func ApplyDefaults(doc map[string]interface{}, defaults []config.FieldDefault) {
+	for _, def := range defaults {
+		if _, ok := GetPath(doc, def.Field); ok {
+			continue
+		}
+
+		if len(def.SlugOf) == 0 {
+			SetPath(doc, def.Field, def.Value)
+		} else if s, ok := GetPath(doc, def.SlugOf); ok {
+			if str, ok := s.(string); ok {
+				SetPath(doc, def.Field, Slug(str))
+			}
+		}
+	}
+}
+
+// Slug returns s in lower case with the runs of characters other than
+// letters and digits replaced by a dash, i.e. "Hello, World!" is
+// "hello-world".
+func Slug(s string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && sb.Len() > 0 {
+				sb.WriteByte('-')
+			}
+			sb.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxFilterParams is the maximum number of filters of a list request.
+	MaxFilterParams = 10
+	// MaxFilterValues is the maximum number of values of an in filter.
+	MaxFilterValues = 50
+)
+
+// filterOperators maps the operator suffixes of the list filters to the
+// ParseQuery operators.
+var filterOperators = map[string]string{
+	"eq":       "=",
+	"ne":       "!=",
+	"gt":       ">",
+	"gte":      ">=",
+	"lt":       "<",
+	"lte":      "<=",
+	"in":       "in",
+	"contains": "contains",
+}
+
+// ParseFilterParams returns the query clauses of the filters of a list
+// request. A filter is a query string parameter made of a field, a double
+// underscore and an operator, i.e. age__gt=18 or status__in=new,open:
+//
+//	eq, ne             equal or not equal to the value
+//	gt, gte, lt, lte   greater or lower than the value
+//	in                 equal to one of the comma separated values
+//	contains           a text field containing the value
+//
+// The values are numbers or booleans when they parse as such, a value in
+// double quotes is always text i.e. zip__eq="01234". The parameters
+// without a double underscore are not filters and are ignored.
+func ParseFilterParams(q url.Values) ([][]interface{}, error) {
+	var keys []string
+	for key := range q {
+		if strings.Contains(key, "__") {
+			keys = append(keys, key)
+		}
+	}
+	// the clauses are in a stable order
+	sort.Strings(keys)
+
+	if len(keys) > MaxFilterParams {
+		return nil, fmt.Errorf("cannot filter on more than %d fields", MaxFilterParams)
+	}
+
+	var clauses [][]interface{}
+	for _, key := range keys {
+		i := strings.LastIndex(key, "__")
+		field, suffix := key[:i], key[i+2:]
+
+		op, ok := filterOperators[suffix]
+		if !ok {
+			return nil, fmt.Errorf("unknown filter operator %q in %s, use one of eq, ne, gt, gte, lt, lte, in or contains", suffix, key)
+		} else if !ValidFieldPath(field) {
+			return nil, fmt.Errorf("filtering on field %q is not allowed", field)
+		} else if len(q[key]) > 1 {
+			return nil, fmt.Errorf("the filter %s is repeated, use the in operator for multiple values", key)
+		}
+
+		raw := q.Get(key)
+
+		var value interface{}
+		switch op {
+		case "in":
+			parts := strings.Split(raw, ",")
+			if len(parts) > MaxFilterValues {
+				return nil, fmt.Errorf("the filter %s has more than %d values", key, MaxFilterValues)
+			}
+
+			values := make([]interface{}, 0, len(parts))
+			for _, part := range parts {
+				values = append(values, filterValue(strings.TrimSpace(part)))
+			}
+			value = values
+		case "contains":
+			value = strings.Trim(raw, `"`)
+		default:
+			value = filterValue(raw)
+		}
+
+		clauses = append(clauses, []interface{}{field, op, value})
+	}
+	return clauses, nil
+}
+
+// filterValue returns v as a number or a boolean when it parses as such,
+// the quotes of a quoted value are removed and it stays a string.
+func filterValue(v string) interface{} {
+	if len(v) >= 2 && strings.HasPrefix(v, `"`) && strings.HasSuffix(v, `"`) {
+		return v[1 : len(v)-1]
+	}
+
+	if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return i
+	} else if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f
+	} else if v == "true" || v == "false" {
+		return v == "true"
+	}
+	return v
+}
@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseFilterParams(t *testing.T) {
+	q, err := url.ParseQuery(`age__gt=18&age__lte=65.5&status__in=new,open&title__contains=go&done__eq=true&zip__ne="01234"&page=2&sort=title`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clauses, err := ParseFilterParams(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]interface{}{
+		{"age", ">", int64(18)},
+		{"age", "<=", 65.5},
+		{"done", "=", true},
+		{"status", "in", []interface{}{"new", "open"}},
+		{"title", "contains", "go"},
+		{"zip", "!=", "01234"},
+	}
+	if !reflect.DeepEqual(clauses, expected) {
+		t.Errorf("expected %v got %v", expected, clauses)
+	}
+}
+
+func TestParseFilterParamsOperators(t *testing.T) {
+	for suffix, op := range filterOperators {
+		q := url.Values{"price__" + suffix: {"10"}}
+		clauses, err := ParseFilterParams(q)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(clauses) != 1 || clauses[0][1] != op {
+			t.Errorf("expected %s to be parsed as %s got %v", suffix, op, clauses)
+		}
+	}
+}
+
+func TestParseFilterParamsRejected(t *testing.T) {
+	rejected := []string{
+		"age__between=1",
+		"age__=1",
+		"sb_created__gt=1",
+		"__gt=1",
+		"bad-field__eq=1",
+		"age__gt=1&age__gt=2",
+	}
+	for _, raw := range rejected {
+		q, err := url.ParseQuery(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ParseFilterParams(q); err == nil {
+			t.Errorf("expected %s to be rejected", raw)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+)
+
+// EarthRadius is the radius of the Earth in meters used to compute
+// distances, it matches the one of PostgreSQL earthdistance.
+const EarthRadius = 6378168.0
+
+// GeoNear matches the points within Radius meters of a location.
+type GeoNear struct {
+	Lng    float64
+	Lat    float64
+	Radius float64
+}
+
+// GeoBox matches the points within a longitude / latitude bounding box.
+type GeoBox struct {
+	MinLng float64
+	MinLat float64
+	MaxLng float64
+	MaxLat float64
+}
+
+// ParseGeoNear reads the value of a near query clause in the form
+// {"lng": -73.56, "lat": 45.50, "radius": 1000}.
+func ParseGeoNear(v interface{}) (near GeoNear, err error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return near, fmt.Errorf("near expects an object with lng, lat and radius got %v", v)
+	}
+
+	if near.Lng, err = geoNumber(m, "lng"); err != nil {
+		return
+	} else if near.Lat, err = geoNumber(m, "lat"); err != nil {
+		return
+	} else if near.Radius, err = geoNumber(m, "radius"); err != nil {
+		return
+	}
+
+	if err = validLngLat(near.Lng, near.Lat); err != nil {
+		return
+	} else if near.Radius < 0 {
+		err = fmt.Errorf("near radius must be positive got %v", near.Radius)
+	}
+	return
+}
+
+// ParseGeoBox reads the value of a within query clause in the form
+// {"minLng": -74, "minLat": 45, "maxLng": -73, "maxLat": 46}.
+func ParseGeoBox(v interface{}) (box GeoBox, err error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return box, fmt.Errorf("within expects an object with minLng, minLat, maxLng and maxLat got %v", v)
+	}
+
+	if box.MinLng, err = geoNumber(m, "minLng"); err != nil {
+		return
+	} else if box.MinLat, err = geoNumber(m, "minLat"); err != nil {
+		return
+	} else if box.MaxLng, err = geoNumber(m, "maxLng"); err != nil {
+		return
+	} else if box.MaxLat, err = geoNumber(m, "maxLat"); err != nil {
+		return
+	}
+
+	if err = validLngLat(box.MinLng, box.MinLat); err != nil {
+		return
+	} else if err = validLngLat(box.MaxLng, box.MaxLat); err != nil {
+		return
+	} else if box.MinLng > box.MaxLng || box.MinLat > box.MaxLat {
+		err = fmt.Errorf("within minimum coordinates must be lower than the maximum ones")
+	}
+	return
+}
+
+// GeoPoint returns the coordinates of a GeoJSON point value, i.e.
+// {"type": "Point", "coordinates": [lng, lat]}.
+func GeoPoint(v interface{}) (lng, lat float64, ok bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok || m["type"] != "Point" {
+		return 0, 0, false
+	}
+
+	coords, ok := m["coordinates"].([]interface{})
+	if !ok || len(coords) != 2 {
+		return 0, 0, false
+	}
+
+	lng, lngOK := coords[0].(float64)
+	lat, latOK := coords[1].(float64)
+	return lng, lat, lngOK && latOK
+}
+
+// Contains returns if the point is within the radius using the haversine
+// distance.
+func (n GeoNear) Contains(lng, lat float64) bool {
+	rad := math.Pi / 180
+	dLat := (lat - n.Lat) * rad
+	dLng := (lng - n.Lng) * rad
+
+	a := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(n.Lat*rad)*math.Cos(lat*rad)*math.Pow(math.Sin(dLng/2), 2)
+	d := 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+	return d <= n.Radius
+}
+
+// Contains returns if the point is within the box.
+func (b GeoBox) Contains(lng, lat float64) bool {
+	return lng >= b.MinLng && lng <= b.MaxLng && lat >= b.MinLat && lat <= b.MaxLat
+}
+
+func geoNumber(m map[string]interface{}, key string) (float64, error) {
+	switch n := m[key].(type) {
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	}
+	return 0, fmt.Errorf("%s must be a number got %v", key, m[key])
+}
+
+func validLngLat(lng, lat float64) error {
+	if lng < -180 || lng > 180 {
+		return fmt.Errorf("longitude must be between -180 and 180 got %v", lng)
+	} else if lat < -90 || lat > 90 {
+		return fmt.Errorf("latitude must be between -90 and 90 got %v", lat)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package internal
+
+import "testing"
+
+func TestParseGeoNear(t *testing.T) {
+	near, err := ParseGeoNear(map[string]interface{}{"lng": -73.5673, "lat": 45.5017, "radius": 20000.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Laval is about 14 km from Montreal, Quebec about 233 km
+	if !near.Contains(-73.6920, 45.6066) {
+		t.Errorf("expected Laval to be within 20 km")
+	} else if near.Contains(-71.2080, 46.8139) {
+		t.Errorf("expected Quebec not to be within 20 km")
+	}
+
+	rejected := []interface{}{
+		"montreal",
+		map[string]interface{}{"lng": -73.5, "lat": 45.5},
+		map[string]interface{}{"lng": -190.0, "lat": 45.5, "radius": 10.0},
+		map[string]interface{}{"lng": -73.5, "lat": 45.5, "radius": -1.0},
+	}
+	for _, v := range rejected {
+		if _, err := ParseGeoNear(v); err == nil {
+			t.Errorf("expected %v to be rejected", v)
+		}
+	}
+}
+
+func TestParseGeoBox(t *testing.T) {
+	box, err := ParseGeoBox(map[string]interface{}{"minLng": -74.0, "minLat": 45.0, "maxLng": -73.0, "maxLat": 46.0})
+	if err != nil {
+		t.Fatal(err)
+	} else if !box.Contains(-73.5673, 45.5017) || box.Contains(-71.2080, 46.8139) {
+		t.Errorf("unexpected box result for %v", box)
+	}
+
+	if _, err := ParseGeoBox(map[string]interface{}{"minLng": -73.0, "minLat": 45.0, "maxLng": -74.0, "maxLat": 46.0}); err == nil {
+		t.Errorf("expected inverted box to be rejected")
+	}
+}
+
+func TestGeoPoint(t *testing.T) {
+	point := map[string]interface{}{"type": "Point", "coordinates": []interface{}{-73.5673, 45.5017}}
+	if lng, lat, ok := GeoPoint(point); !ok || lng != -73.5673 || lat != 45.5017 {
+		t.Errorf("expected point coordinates got %v %v %v", lng, lat, ok)
+	}
+
+	if _, _, ok := GeoPoint(map[string]interface{}{"coordinates": []interface{}{1.0, 2.0}}); ok {
+		t.Errorf("expected a value without type Point to be rejected")
+	}
+}
@@ -15,6 +15,10 @@ type SendMailData struct {
 	HTMLBody string `json:"htmlBody"`
 	TextBody string `json:"textBody"`
 	ReplyTo  string `json:"replyTo"`
+	// ReturnPath receives the bounces, the provider's default when empty
+	ReturnPath string `json:"returnPath"`
+	// Headers are added to the message i.e. List-Unsubscribe
+	Headers map[string]string `json:"headers"`
 
 	Body string `json:"body"`
 }
@@ -22,4 +26,6 @@ type SendMailData struct {
 // Mailer is used to have different implementation for sending email
 type Mailer interface {
 	Send(SendMailData) error
+	// Ping verifies the provider is reachable with the configured credentials
+	Ping() error
 }
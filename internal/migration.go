@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+)
+
+// BaseMigration is a versioned change a backend applies to each base, i.e.
+// a table or an index added in a release. Up must be idempotent, the
+// version is only recorded once it succeeded.
+type BaseMigration struct {
+	Version     int
+	Description string
+	Up          func(dbName string) error
+}
+
+// MigrationStore records the migrations applied to each base.
+type MigrationStore interface {
+	// AppliedMigrations returns the versions applied to the base
+	AppliedMigrations(dbName string) (map[int]bool, error)
+	// SetMigrationApplied records that version was applied to the base
+	SetMigrationApplied(dbName string, version int) error
+}
+
+// RunBaseMigrations applies the pending migrations to the bases in version
+// order and returns how many ran. The applied versions are skipped, so it's
+// run at every startup. It stops at the first failing migration.
+func RunBaseMigrations(store MigrationStore, bases []string, migrations []BaseMigration) (int, error) {
+	sorted := make([]BaseMigration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return 0, fmt.Errorf("migration %q must have a positive version", m.Description)
+		} else if i > 0 && sorted[i-1].Version == m.Version {
+			return 0, fmt.Errorf("migration version %d is used more than once", m.Version)
+		}
+	}
+
+	ran := 0
+	for _, dbName := range bases {
+		applied, err := store.AppliedMigrations(dbName)
+		if err != nil {
+			return ran, fmt.Errorf("reading the migrations of %s: %w", dbName, err)
+		}
+
+		for _, m := range sorted {
+			if applied[m.Version] {
+				continue
+			}
+
+			if err := m.Up(dbName); err != nil {
+				return ran, fmt.Errorf("migration %d (%s) of %s: %w", m.Version, m.Description, dbName, err)
+			} else if err := store.SetMigrationApplied(dbName, m.Version); err != nil {
+				return ran, fmt.Errorf("recording migration %d of %s: %w", m.Version, dbName, err)
+			}
+			ran++
+		}
+	}
+	return ran, nil
+}
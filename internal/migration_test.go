@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type memMigrations map[string]map[int]bool
+
+func (s memMigrations) AppliedMigrations(dbName string) (map[int]bool, error) {
+	return s[dbName], nil
+}
+
+func (s memMigrations) SetMigrationApplied(dbName string, version int) error {
+	if s[dbName] == nil {
+		s[dbName] = make(map[int]bool)
+	}
+	s[dbName][version] = true
+	return nil
+}
+
+func TestRunBaseMigrations(t *testing.T) {
+	var calls []string
+	up := func(name string) func(string) error {
+		return func(dbName string) error {
+			calls = append(calls, dbName+":"+name)
+			return nil
+		}
+	}
+
+	migrations := []BaseMigration{
+		{Version: 2, Description: "second", Up: up("second")},
+		{Version: 1, Description: "first", Up: up("first")},
+	}
+
+	store := memMigrations{}
+	ran, err := RunBaseMigrations(store, []string{"a", "b"}, migrations)
+	if err != nil {
+		t.Fatal(err)
+	} else if ran != 4 {
+		t.Errorf("expected 4 migrations to run got %d", ran)
+	}
+
+	expected := []string{"a:first", "a:second", "b:first", "b:second"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected %v got %v", expected, calls)
+	}
+
+	// the next startup skips the applied migrations and runs the new ones
+	calls = nil
+	migrations = append(migrations, BaseMigration{Version: 3, Description: "third", Up: up("third")})
+	ran, err = RunBaseMigrations(store, []string{"a", "b"}, migrations)
+	if err != nil {
+		t.Fatal(err)
+	} else if ran != 2 || !reflect.DeepEqual(calls, []string{"a:third", "b:third"}) {
+		t.Errorf("expected only the new migration to run got %d %v", ran, calls)
+	}
+
+	calls = nil
+	if ran, err := RunBaseMigrations(store, []string{"a", "b"}, migrations); err != nil {
+		t.Fatal(err)
+	} else if ran != 0 || len(calls) != 0 {
+		t.Errorf("expected no migration to run got %d %v", ran, calls)
+	}
+}
+
+func TestRunBaseMigrationsFailure(t *testing.T) {
+	errFailed := errors.New("failed")
+	migrations := []BaseMigration{
+		{Version: 1, Description: "ok", Up: func(string) error { return nil }},
+		{Version: 2, Description: "failing", Up: func(string) error { return errFailed }},
+	}
+
+	store := memMigrations{}
+	if _, err := RunBaseMigrations(store, []string{"a"}, migrations); !errors.Is(err, errFailed) {
+		t.Fatalf("expected the migration error got %v", err)
+	} else if !store["a"][1] || store["a"][2] {
+		t.Errorf("expected only the successful migration to be recorded got %v", store["a"])
+	}
+
+	dup := []BaseMigration{{Version: 1, Up: migrations[0].Up}, {Version: 1, Up: migrations[0].Up}}
+	if _, err := RunBaseMigrations(store, []string{"a"}, dup); err == nil {
+		t.Errorf("expected an error for duplicate versions")
+	}
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/staticbackendhq/core/config"
+)
+
+// DecodeJSON decodes a JSON document into v. Unless JSON_NUMBERS is
+// "float", integers are decoded as int64 and the other numbers as float64
+// so integers round-trip as integers on all backends.
+func DecodeJSON(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	if strings.EqualFold(config.Current.JSONNumbers, config.JSONNumbersFloat) {
+		return dec.Decode(v)
+	}
+
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+
+	switch x := v.(type) {
+	case *interface{}:
+		*x = NormalizeNumbers(*x)
+	case *map[string]interface{}:
+		NormalizeNumbers(*x)
+	case *[]interface{}:
+		NormalizeNumbers(*x)
+	case *[][]interface{}:
+		for _, clause := range *x {
+			NormalizeNumbers(clause)
+		}
+	}
+	return nil
+}
+
+// NormalizeNumbers replaces the json.Number of v by an int64 when it's an
+// integer, a float64 otherwise. Maps and slices are changed in place.
+func NormalizeNumbers(v interface{}) interface{} {
+	switch x := v.(type) {
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			return n
+		}
+		f, _ := x.Float64()
+		return f
+	case map[string]interface{}:
+		for k, val := range x {
+			x[k] = NormalizeNumbers(val)
+		}
+	case []interface{}:
+		for i, val := range x {
+			x[i] = NormalizeNumbers(val)
+		}
+	}
+	return v
+}
@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/staticbackendhq/core/config"
+)
+
+func TestDecodeJSONNumbers(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	body := `{"count": 42, "ratio": 1.5, "big": 9007199254740993, "nested": {"n": 7}, "list": [1, 2.5]}`
+
+	var doc map[string]interface{}
+	if err := DecodeJSON(strings.NewReader(body), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc["count"] != int64(42) {
+		t.Errorf("expected count to be int64 42 got %T %v", doc["count"], doc["count"])
+	} else if doc["ratio"] != 1.5 {
+		t.Errorf("expected ratio to be float64 1.5 got %T %v", doc["ratio"], doc["ratio"])
+	} else if doc["big"] != int64(9007199254740993) {
+		t.Errorf("expected big to keep its precision got %v", doc["big"])
+	} else if doc["nested"].(map[string]interface{})["n"] != int64(7) {
+		t.Errorf("expected nested n to be int64 got %v", doc["nested"])
+	} else if list := doc["list"].([]interface{}); list[0] != int64(1) || list[1] != 2.5 {
+		t.Errorf("expected list [1 2.5] got %v", list)
+	}
+
+	var clauses [][]interface{}
+	if err := DecodeJSON(strings.NewReader(`[["count", "=", 42]]`), &clauses); err != nil {
+		t.Fatal(err)
+	} else if clauses[0][2] != int64(42) {
+		t.Errorf("expected clause value to be int64 got %T", clauses[0][2])
+	}
+
+	config.Current.JSONNumbers = config.JSONNumbersFloat
+
+	doc = nil
+	if err := DecodeJSON(strings.NewReader(body), &doc); err != nil {
+		t.Fatal(err)
+	} else if doc["count"] != 42.0 {
+		t.Errorf("expected count to be float64 in float mode got %T", doc["count"])
+	}
+}
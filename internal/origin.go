@@ -0,0 +1,39 @@
+package internal
+
+import (
+	"net/url"
+	"strings"
+)
+
+// OriginAllowed returns if origin, the Origin header of a request, is one
+// of the allowed domains of the base. A domain matches the host of the
+// origin, "*.example.com" matches its subdomains and "*" any origin. A
+// request without an origin, i.e. from a server, is allowed.
+func (b BaseConfig) OriginAllowed(origin string) bool {
+	if len(origin) == 0 {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || len(u.Hostname()) == 0 {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+
+	for _, domain := range b.AllowedDomain {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		// the domains can be saved as origins i.e. https://example.com
+		if strings.Contains(domain, "://") {
+			if du, err := url.Parse(domain); err == nil {
+				domain = du.Hostname()
+			}
+		}
+
+		if domain == "*" || host == domain {
+			return true
+		} else if strings.HasPrefix(domain, "*.") && strings.HasSuffix(host, domain[1:]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package internal
+
+import "testing"
+
+func TestOriginAllowed(t *testing.T) {
+	conf := BaseConfig{AllowedDomain: []string{"localhost", "*.example.com", "https://App.test"}}
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"", true},
+		{"http://localhost:3000", true},
+		{"https://www.example.com", true},
+		{"https://example.com", false},
+		{"https://app.test", true},
+		{"https://evil.test", false},
+		{"https://localhost.evil.test", false},
+		{"null", false},
+	}
+
+	for _, tc := range tests {
+		if got := conf.OriginAllowed(tc.origin); got != tc.allowed {
+			t.Errorf("%q: expected %v got %v", tc.origin, tc.allowed, got)
+		}
+	}
+
+	conf.AllowedDomain = []string{"*"}
+	if !conf.OriginAllowed("https://anywhere.test") {
+		t.Errorf("expected * to allow any origin")
+	}
+}
@@ -1,5 +1,7 @@
 package internal
 
+import "time"
+
 const (
 	DataStorePostgreSQL = "postgresql"
 	DataStoreMongoDB    = "mongo"
@@ -8,7 +10,10 @@ const (
 
 type Persister interface {
 	Ping() error
-	CreateIndex(dbName, col, field string) error
+	CreateIndex(dbName, col, field string, unique bool) error
+	CreateGeoIndex(dbName, col, field string) error
+	ListIndexes(dbName, col string) ([]Index, error)
+	DropIndex(dbName, col, name string) error
 
 	// customer / app related
 	CreateCustomer(Customer) (Customer, error)
@@ -16,9 +21,16 @@ type Persister interface {
 	EmailExists(email string) (bool, error)
 	FindAccount(customerID string) (Customer, error)
 	FindDatabase(baseID string) (BaseConfig, error)
+	FindDatabaseByKey(key string) (BaseConfig, error)
 	DatabaseExists(name string) (bool, error)
 	ListDatabases() ([]BaseConfig, error)
 	IncrementMonthlyEmailSent(baseID string) error
+	SetUploadLimits(baseID string, types []string, maxSize int64) error
+	SetSessionBinding(baseID, binding string) error
+	SetFeatures(baseID string, features map[string]bool) error
+	SetPublicAliases(baseID string, aliases map[string]string) error
+	RenameBase(baseID, displayName string) error
+	RotatePublicKey(baseID, key string, previousExpires time.Time) error
 	GetCustomerByStripeID(stripeID string) (cus Customer, err error)
 	ActivateCustomer(customerID string, active bool) error
 	ChangeCustomerPlan(customerID string, plan int) error
@@ -32,25 +44,82 @@ type Persister interface {
 	FindTokenByEmail(dbName, email string) (Token, error)
 	UserEmailExists(dbName, email string) (exists bool, err error)
 	GetFirstTokenFromAccountID(dbName, accountID string) (tok Token, err error)
+	// ListTokens returns the tokens of the account, oldest first
+	ListTokens(dbName, accountID string) ([]Token, error)
 
 	// membership / account & user functions
 	CreateUserAccount(dbName, email string) (id string, err error)
 	CreateUserToken(dbName string, tok Token) (id string, err error)
+	// CreateUsers creates an account and a user for each token, all of them
+	// or none. It returns ErrEmailTaken when an email is already used, the
+	// tokens are returned with their ID and AccountID set.
+	CreateUsers(dbName string, toks []Token) ([]Token, error)
 	SetPasswordResetCode(dbName, tokenID, code string) error
 	ResetPassword(dbName, email, code, password string) error
 	SetUserRole(dbName, email string, role int) error
+	// DemoteUser sets the role of the admin with email, a user having at
+	// least adminRole, unless they're the last one. It returns ErrLastAdmin
+	// then, the check and the change are atomic.
+	DemoteUser(dbName, email string, role, adminRole int) error
 	UserSetPassword(dbName, tokenID, password string) error
+	// UserSetEmail returns ErrEmailTaken when another user has email
+	UserSetEmail(dbName, tokenID, email string) error
+	SetUserToken(dbName, tokenID, token string) error
+	// DeleteToken removes the token, the documents it owns are removed in
+	// PostgreSQL
+	DeleteToken(dbName, tokenID string) error
+	// AddLoginEvent keeps the keep most recent logins of the user, all
+	// logins when keep is 0
+	AddLoginEvent(dbName string, ev LoginEvent, keep int) error
+	// ListLoginEvents returns the logins of a user, most recent first
+	ListLoginEvents(dbName, userID string) ([]LoginEvent, error)
+	// SetLoginAlerts opts the user in or out of the new device login
+	// emails, users are opted in by default
+	SetLoginAlerts(dbName, userID string, enabled bool) error
+	LoginAlertsEnabled(dbName, userID string) (bool, error)
+	// SetLoginCode replaces the login code of the user
+	SetLoginCode(dbName string, code LoginCode) error
+	// UseLoginCode removes the login code of the user if it matches hash
+	// and expires after now, it returns ErrInvalidLoginCode otherwise
+	UseLoginCode(dbName, userID, hash string, now time.Time) error
+	// AddImpersonation records a token of a user issued to a root user
+	AddImpersonation(dbName string, imp Impersonation) error
+	// ListImpersonations returns the impersonations of the base, most
+	// recent first
+	ListImpersonations(dbName string) ([]Impersonation, error)
 
 	// base CRUD
 	CreateDocument(auth Auth, dbName, col string, doc map[string]interface{}) (map[string]interface{}, error)
+	// CreateDocumentIfAbsent atomically inserts doc unless a document of the
+	// collection readable by auth matches filter. It returns the inserted
+	// document and true or the existing one and false. The backends without
+	// a lock return ErrUniqueIndexRequired when no unique index makes the
+	// insert atomic
+	CreateDocumentIfAbsent(auth Auth, dbName, col string, filter map[string]interface{}, doc map[string]interface{}) (map[string]interface{}, bool, error)
 	BulkCreateDocument(auth Auth, dbName, col string, docs []interface{}) error
 	ListDocuments(auth Auth, dbName, col string, params ListParams) (PagedResult, error)
 	QueryDocuments(auth Auth, dbName, col string, filter map[string]interface{}, params ListParams) (PagedResult, error)
+	// ExplainQuery returns the backend's plan of QueryDocuments
+	ExplainQuery(auth Auth, dbName, col string, filter map[string]interface{}, params ListParams) (map[string]interface{}, error)
 	GetDocumentByID(auth Auth, dbName, col, id string) (map[string]interface{}, error)
+	// GetDocumentsByIDs returns the documents of ids that auth can read in
+	// no particular order, the missing ones are omitted
+	GetDocumentsByIDs(auth Auth, dbName, col string, ids []string) ([]map[string]interface{}, error)
 	UpdateDocument(auth Auth, dbName, col, id string, doc map[string]interface{}) (map[string]interface{}, error)
+	// ReplaceDocument replaces the fields of the document by the ones of
+	// doc, the fields doc omits are removed. The owner stays the same.
+	ReplaceDocument(auth Auth, dbName, col, id string, doc map[string]interface{}) (map[string]interface{}, error)
 	IncrementValue(auth Auth, dbName, col, id, field string, n int) error
 	DeleteDocument(auth Auth, dbName, col, id string) (int64, error)
+	DeleteByFilter(auth Auth, dbName, col string, filter map[string]interface{}) (int64, error)
+	DeleteExpired(dbName, col, field string, before time.Time) (int64, error)
+	UpdateByFilter(auth Auth, dbName, col string, filter map[string]interface{}, doc map[string]interface{}) (int64, error)
 	ListCollections(dbName string) ([]string, error)
+	// Stats returns the document count and sizes of the collections of the
+	// base
+	Stats(dbName string) (BaseStats, error)
+	TruncateCollection(dbName, col string) (int64, error)
+	DropCollection(dbName, col string) error
 	ParseQuery(clauses [][]interface{}) (map[string]interface{}, error)
 
 	// form functions
@@ -69,9 +138,20 @@ type Persister interface {
 	DeleteFunction(dbName, name string) error
 	RanFunction(dbName, id string, rh ExecHistory) error
 
+	// webhooks
+	AddWebhook(dbName string, wh Webhook) (id string, err error)
+	ListWebhooks(dbName string) ([]Webhook, error)
+	DeleteWebhook(dbName, id string) error
+
 	// schedule tasks
 	ListTasks() ([]Task, error)
 
+	// per-base migrations
+	// BaseMigrations returns the migrations the backend applies to each base
+	BaseMigrations() []BaseMigration
+	AppliedMigrations(dbName string) (map[int]bool, error)
+	SetMigrationApplied(dbName string, version int) error
+
 	// Files / storage
 	AddFile(dbName string, f File) (id string, err error)
 	GetFileByID(dbName, fileID string) (f File, err error)
@@ -8,7 +8,7 @@ type PubSuber interface {
 	SetTyped(key string, v interface{}) error
 	Inc(key string, by int64) (int64, error)
 	Dec(key string, by int64) (int64, error)
-	Subscribe(send chan Command, token, channel string, close chan bool)
+	Subscribe(send chan Command, token, channel, resume string, close chan bool)
 	Publish(msg Command) error
 	PublishDocument(channel, typ string, v interface{})
 }
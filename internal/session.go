@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Session bindings of a base, tokens issued to a client are rejected when
+// used from another IP address and/or user-agent.
+const (
+	SessionBindingNone      = ""
+	SessionBindingIP        = "ip"
+	SessionBindingUserAgent = "ua"
+	SessionBindingBoth      = "ip+ua"
+)
+
+// ValidSessionBinding returns if binding is one of the supported bindings.
+func ValidSessionBinding(binding string) bool {
+	switch binding {
+	case SessionBindingNone, SessionBindingIP, SessionBindingUserAgent, SessionBindingBoth:
+		return true
+	}
+	return false
+}
+
+// SessionFingerprint returns the hash of the client attributes covered by
+// binding, it's empty when there's no binding.
+func SessionFingerprint(binding, ip, userAgent string) string {
+	var s string
+	switch binding {
+	case SessionBindingIP:
+		s = ip
+	case SessionBindingUserAgent:
+		s = userAgent
+	case SessionBindingBoth:
+		s = ip + "\n" + userAgent
+	default:
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(binding + "\n" + s))
+	return hex.EncodeToString(sum[:])
+}
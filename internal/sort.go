@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// SortFieldID is the default sort key, it orders documents by
+	// creation with the id as tie-breaker on all backends.
+	SortFieldID = IDField
+
+	// MaxSortFields is the maximum number of keys accepted in a sort
+	// specification.
+	MaxSortFields = 3
+)
+
+// SortField is one key of a sort specification.
+type SortField struct {
+	Field      string
+	Descending bool
+}
+
+// ParseSort parses a sort specification like "title,-created" where a
+// leading - sorts the field descending. An empty spec returns nil.
+func ParseSort(spec string) ([]SortField, error) {
+	if len(strings.TrimSpace(spec)) == 0 {
+		return nil, nil
+	}
+
+	keys := strings.Split(spec, ",")
+	if len(keys) > MaxSortFields {
+		return nil, fmt.Errorf("cannot sort on more than %d fields", MaxSortFields)
+	}
+
+	var fields []SortField
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+
+		sf := SortField{Field: strings.TrimPrefix(key, "-")}
+		sf.Descending = len(sf.Field) != len(key)
+
+		if !ValidFieldPath(sf.Field) {
+			return nil, fmt.Errorf("sorting on field %q is not allowed", sf.Field)
+		} else if seen[sf.Field] {
+			return nil, fmt.Errorf("field %q appears more than once in sort", sf.Field)
+		}
+
+		seen[sf.Field] = true
+		fields = append(fields, sf)
+	}
+	return fields, nil
+}
+
+// SortFields returns the sort keys to apply. It defaults to the id and
+// always ends with the id so the ordering is stable between pages.
+func (p ListParams) SortFields() []SortField {
+	fields := append([]SortField{}, p.Sort...)
+	for _, sf := range fields {
+		if sf.Field == SortFieldID {
+			return fields
+		}
+	}
+
+	desc := false
+	if len(fields) > 0 {
+		desc = fields[len(fields)-1].Descending
+	}
+	return append(fields, SortField{Field: SortFieldID, Descending: desc})
+}
@@ -0,0 +1,37 @@
+package internal
+
+// CollectionStats is the storage used by a collection, the sizes in bytes
+// are the ones reported by the backend.
+type CollectionStats struct {
+	Name       string `json:"name"`
+	Documents  int64  `json:"documents"`
+	Bytes      int64  `json:"bytes"`
+	IndexBytes int64  `json:"indexBytes"`
+}
+
+// BaseStats is the storage used by the collections of a base, including
+// the system ones prefixed by sb_.
+type BaseStats struct {
+	Collections []CollectionStats `json:"collections"`
+	Documents   int64             `json:"documents"`
+	Bytes       int64             `json:"bytes"`
+	IndexBytes  int64             `json:"indexBytes"`
+}
+
+// Add appends the stats of a collection and adds them to the totals.
+func (s *BaseStats) Add(cs CollectionStats) {
+	s.Collections = append(s.Collections, cs)
+	s.Documents += cs.Documents
+	s.Bytes += cs.Bytes
+	s.IndexBytes += cs.IndexBytes
+}
+
+// Collection returns the stats of the collection name.
+func (s BaseStats) Collection(name string) (CollectionStats, bool) {
+	for _, cs := range s.Collections {
+		if cs.Name == name {
+			return cs, true
+		}
+	}
+	return CollectionStats{}, false
+}
@@ -0,0 +1,27 @@
+package internal
+
+import (
+	"context"
+	"time"
+
+	"github.com/staticbackendhq/core/config"
+)
+
+// ReadContext returns a context canceled after DATASTORE_READ_TIMEOUT, the
+// datastores use it for the operations reading data.
+func ReadContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(parent, config.Current.Settings.DatastoreReadTimeout)
+}
+
+// WriteContext returns a context canceled after DATASTORE_WRITE_TIMEOUT, the
+// datastores use it for the operations changing data.
+func WriteContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(parent, config.Current.Settings.DatastoreWriteTimeout)
+}
+
+func withTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, timeout)
+}
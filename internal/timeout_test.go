@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/config"
+)
+
+func TestDatastoreContexts(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.Settings.DatastoreReadTimeout = 10 * time.Millisecond
+	config.Current.Settings.DatastoreWriteTimeout = 0
+
+	ctx, cancel := ReadContext(context.Background())
+	defer cancel()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected the read context to be canceled after its timeout")
+	}
+
+	ctx, cancel = WriteContext(context.Background())
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("expected no deadline when the write timeout is 0")
+	}
+
+	cancel()
+	if ctx.Err() == nil {
+		t.Errorf("expected the write context to be canceled by its cancel func")
+	}
+}
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/staticbackendhq/core/config"
+)
+
+// The token formats, a format other than TokenV1 starts with its version so
+// the formats can coexist while the issued tokens are migrated.
+const (
+	// TokenV1 is the unversioned "id|token" format
+	TokenV1 = 1
+	// TokenV2 is the "v2.id.token" format, it's safe in URLs
+	TokenV2 = 2
+)
+
+type tokenFormat struct {
+	prefix    string
+	separator string
+}
+
+var tokenFormats = map[int]tokenFormat{
+	TokenV1: {separator: "|"},
+	TokenV2: {prefix: "v2.", separator: "."},
+}
+
+// idRe matches the ids generated by the persisters, i.e. UUID for
+// PostgreSQL and hex ObjectID for Mongo.
+var idRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// UserToken is a session token in the "id|token" format.
+type UserToken struct {
+	ID    string
+	Token string
+}
+
+// String returns the token in the TOKEN_VERSION format, the one issued.
+func (t UserToken) String() string {
+	return t.Format(issuedVersion())
+}
+
+// Format returns the token in the version format.
+func (t UserToken) Format(version int) string {
+	f := tokenFormats[version]
+	return f.prefix + t.ID + f.separator + t.Token
+}
+
+// Key returns the token in the TokenV1 format, the cached Auth and base of
+// a token are keyed by it whatever the format the token is sent in.
+func (t UserToken) Key() string {
+	return t.Format(TokenV1)
+}
+
+// RootToken is a root token in the "id|accountId|token" format.
+type RootToken struct {
+	ID        string
+	AccountID string
+	Token     string
+}
+
+// String returns the root token in the TOKEN_VERSION format.
+func (t RootToken) String() string {
+	return t.Format(issuedVersion())
+}
+
+// Format returns the root token in the version format.
+func (t RootToken) Format(version int) string {
+	f := tokenFormats[version]
+	return f.prefix + t.ID + f.separator + t.AccountID + f.separator + t.Token
+}
+
+func issuedVersion() int {
+	if version := config.Current.Settings.TokenVersion; version > 0 {
+		return version
+	}
+	return TokenV1
+}
+
+// ParseToken parses a session token in any of the token formats.
+func ParseToken(s string) (tok UserToken, err error) {
+	parts, err := splitToken(s, 2)
+	if err != nil {
+		return
+	}
+
+	tok = UserToken{ID: parts[0], Token: parts[1]}
+	return
+}
+
+// ParseRootToken parses a root token in any of the token formats.
+func ParseRootToken(s string) (tok RootToken, err error) {
+	parts, err := splitToken(s, 3)
+	if err != nil {
+		return
+	}
+
+	if !idRe.MatchString(parts[1]) {
+		err = fmt.Errorf("invalid account id in token: %s", parts[1])
+		return
+	}
+
+	tok = RootToken{ID: parts[0], AccountID: parts[1], Token: parts[2]}
+	return
+}
+
+// tokenVersion returns the format of s from its version prefix, a token
+// without prefix is a TokenV1.
+func tokenVersion(s string) int {
+	for version, f := range tokenFormats {
+		if len(f.prefix) > 0 && strings.HasPrefix(s, f.prefix) {
+			return version
+		}
+	}
+	return TokenV1
+}
+
+func splitToken(s string, segments int) ([]string, error) {
+	if len(s) == 0 {
+		return nil, fmt.Errorf("empty token")
+	}
+
+	f := tokenFormats[tokenVersion(s)]
+
+	parts := strings.Split(strings.TrimPrefix(s, f.prefix), f.separator)
+	if len(parts) != segments {
+		return nil, fmt.Errorf("token must have %d segments separated by %s, got %d", segments, f.separator, len(parts))
+	}
+
+	for i, p := range parts {
+		if len(p) == 0 {
+			return nil, fmt.Errorf("token segment %d is empty", i+1)
+		}
+	}
+
+	if !idRe.MatchString(parts[0]) {
+		return nil, fmt.Errorf("invalid id in token: %s", parts[0])
+	}
+	return parts, nil
+}
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/staticbackendhq/core/config"
+)
+
+func TestParseToken(t *testing.T) {
+	tests := []struct {
+		input string
+		want  UserToken
+		err   string
+	}{
+		{"", UserToken{}, "empty token"},
+		{"abc123", UserToken{}, "2 segments"},
+		{"abc123|secret", UserToken{ID: "abc123", Token: "secret"}, ""},
+		{"abc123|acct|secret", UserToken{}, "2 segments"},
+		{"|secret", UserToken{}, "segment 1 is empty"},
+		{"abc123|", UserToken{}, "segment 2 is empty"},
+		{"abc 123|secret", UserToken{}, "invalid id"},
+		{"v2.abc123.secret", UserToken{ID: "abc123", Token: "secret"}, ""},
+		{"v2.abc123|secret", UserToken{}, "2 segments"},
+		{"v2..secret", UserToken{}, "segment 1 is empty"},
+	}
+
+	for _, tc := range tests {
+		tok, err := ParseToken(tc.input)
+		if len(tc.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected error containing %q got %v", tc.input, tc.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: %v", tc.input, err)
+		} else if tok != tc.want {
+			t.Errorf("%q: expected %v got %v", tc.input, tc.want, tok)
+		}
+	}
+}
+
+func TestParseRootToken(t *testing.T) {
+	tests := []struct {
+		input string
+		want  RootToken
+		err   string
+	}{
+		{"", RootToken{}, "empty token"},
+		{"abc123", RootToken{}, "3 segments"},
+		{"abc123|secret", RootToken{}, "3 segments"},
+		{"abc123|acct1|secret", RootToken{ID: "abc123", AccountID: "acct1", Token: "secret"}, ""},
+		{"abc123|acct1|secret|extra", RootToken{}, "3 segments"},
+		{"abc123||secret", RootToken{}, "segment 2 is empty"},
+		{"abc123|acct 1|secret", RootToken{}, "invalid account id"},
+		{"v2.abc123.acct1.secret", RootToken{ID: "abc123", AccountID: "acct1", Token: "secret"}, ""},
+		{"v2.abc123.secret", RootToken{}, "3 segments"},
+	}
+
+	for _, tc := range tests {
+		tok, err := ParseRootToken(tc.input)
+		if len(tc.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected error containing %q got %v", tc.input, tc.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: %v", tc.input, err)
+		} else if tok != tc.want {
+			t.Errorf("%q: expected %v got %v", tc.input, tc.want, tok)
+		}
+	}
+}
+
+func TestTokenFormats(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	ut := UserToken{ID: "abc123", Token: "secret"}
+	rt := RootToken{ID: "abc123", AccountID: "acct1", Token: "secret"}
+
+	if s := ut.String(); s != "abc123|secret" {
+		t.Errorf("expected the v1 format by default got %s", s)
+	} else if s := rt.String(); s != "abc123|acct1|secret" {
+		t.Errorf("expected the v1 root format by default got %s", s)
+	}
+
+	config.Current.Settings.TokenVersion = 2
+
+	if s := ut.String(); s != "v2.abc123.secret" {
+		t.Errorf("expected the v2 format got %s", s)
+	} else if s := rt.String(); s != "v2.abc123.acct1.secret" {
+		t.Errorf("expected the v2 root format got %s", s)
+	} else if k := ut.Key(); k != "abc123|secret" {
+		t.Errorf("expected the key in the v1 format got %s", k)
+	}
+
+	// the tokens issued before the migration stay valid
+	for _, s := range []string{ut.Format(TokenV1), ut.Format(TokenV2)} {
+		if tok, err := ParseToken(s); err != nil {
+			t.Errorf("%s: %v", s, err)
+		} else if tok != ut {
+			t.Errorf("%s: expected %v got %v", s, ut, tok)
+		}
+	}
+
+	for _, s := range []string{rt.Format(TokenV1), rt.Format(TokenV2)} {
+		if tok, err := ParseRootToken(s); err != nil {
+			t.Errorf("%s: %v", s, err)
+		} else if tok != rt {
+			t.Errorf("%s: expected %v got %v", s, rt, tok)
+		}
+	}
+}
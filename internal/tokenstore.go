@@ -0,0 +1,9 @@
+package internal
+
+// TokenStore caches the Auth resolved from a session token so it's not
+// loaded from the database on every request.
+type TokenStore interface {
+	GetAuth(token string) (Auth, error)
+	SetAuth(token string, auth Auth) error
+	DeleteAuth(token string) error
+}
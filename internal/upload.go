@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"mime"
+	"strings"
+)
+
+// UploadLimits returns the MIME types and maximum size accepted for uploads
+// to the base, falling back to the defaults when the base does not define
+// its own.
+func (b BaseConfig) UploadLimits(defaultTypes []string, defaultMaxSize int64) ([]string, int64) {
+	types, maxSize := defaultTypes, defaultMaxSize
+	if len(b.AllowedUploadTypes) > 0 {
+		types = b.AllowedUploadTypes
+	}
+	if b.MaxUploadSize > 0 {
+		maxSize = b.MaxUploadSize
+	}
+	return types, maxSize
+}
+
+// ContentTypeAllowed returns true when contentType matches one of the allowed
+// types, "image/*" matches all images. An empty list allows all types.
+func ContentTypeAllowed(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, a := range allowed {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if a == mt || a == "*/*" {
+			return true
+		} else if strings.HasSuffix(a, "/*") && strings.HasPrefix(mt, strings.TrimSuffix(a, "*")) {
+			return true
+		}
+	}
+	return false
+}
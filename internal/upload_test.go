@@ -0,0 +1,44 @@
+package internal
+
+import "testing"
+
+func TestContentTypeAllowed(t *testing.T) {
+	tests := []struct {
+		contentType string
+		allowed     []string
+		expected    bool
+	}{
+		{"application/pdf", nil, true},
+		{"image/png", []string{"image/*"}, true},
+		{"image/png", []string{"application/pdf"}, false},
+		{"application/pdf", []string{"image/*", "application/pdf"}, true},
+		{"text/plain; charset=utf-8", []string{"text/plain"}, true},
+		{"not a type", []string{"text/plain"}, false},
+	}
+
+	for _, tc := range tests {
+		if got := ContentTypeAllowed(tc.contentType, tc.allowed); got != tc.expected {
+			t.Errorf("%s with %v: expected %v got %v", tc.contentType, tc.allowed, tc.expected, got)
+		}
+	}
+}
+
+func TestBaseUploadLimits(t *testing.T) {
+	defaults := []string{"image/*", "application/pdf"}
+
+	types, maxSize := BaseConfig{}.UploadLimits(defaults, 1000)
+	if len(types) != 2 || maxSize != 1000 {
+		t.Errorf("expected the defaults got %v %d", types, maxSize)
+	}
+
+	base := BaseConfig{AllowedUploadTypes: []string{"image/png"}, MaxUploadSize: 10}
+	types, maxSize = base.UploadLimits(defaults, 1000)
+	if len(types) != 1 || types[0] != "image/png" || maxSize != 10 {
+		t.Errorf("expected the base limits got %v %d", types, maxSize)
+	}
+
+	// a restrictive base rejects a type allowed by the defaults
+	if ContentTypeAllowed("application/pdf", types) {
+		t.Error("expected application/pdf to be rejected by the base")
+	}
+}
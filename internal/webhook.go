@@ -0,0 +1,33 @@
+package internal
+
+import "time"
+
+const (
+	WebhookCreate = "create"
+	WebhookUpdate = "update"
+	WebhookDelete = "delete"
+)
+
+// Webhook is an URL receiving a POST for each Event on the documents of a
+// collection of a base. The bulk writes, creating a list of documents and
+// updating or deleting the documents matching a filter, don't fire the
+// webhooks.
+type Webhook struct {
+	ID         string `json:"id"`
+	Collection string `json:"col"`
+	// Event is one of WebhookCreate, WebhookUpdate or WebhookDelete
+	Event string `json:"event"`
+	URL   string `json:"url"`
+	// Secret signs the deliveries, it's never returned once created
+	Secret string `json:"-"`
+	// Fields limits the delivered document to those fields, all fields
+	// when empty
+	Fields  []string  `json:"fields"`
+	Created time.Time `json:"created"`
+}
+
+// ValidWebhookEvent returns if event is a document event a webhook can be
+// registered for.
+func ValidWebhookEvent(event string) bool {
+	return event == WebhookCreate || event == WebhookUpdate || event == WebhookDelete
+}
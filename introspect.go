@@ -0,0 +1,120 @@
+package staticbackend
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+
+	"github.com/gbrlsnchs/jwt/v3"
+)
+
+// maxIntrospectBatch is the largest number of tokens introspected at once.
+const maxIntrospectBatch = 100
+
+// introspectRequest is sent by a gateway with either a single token, as in
+// RFC 7662, or a batch of tokens. ClientIP and ClientUserAgent are the ones
+// of the end client, they're required to validate the tokens of a base
+// binding its sessions.
+type introspectRequest struct {
+	Token           string   `json:"token"`
+	Tokens          []string `json:"tokens"`
+	ClientIP        string   `json:"clientIp"`
+	ClientUserAgent string   `json:"clientUserAgent"`
+}
+
+func (req *introspectRequest) Validate() error {
+	if len(req.Token) == 0 && len(req.Tokens) == 0 {
+		return errors.New("token or tokens is required")
+	} else if len(req.Tokens) > maxIntrospectBatch {
+		return errors.New("too many tokens to introspect at once")
+	}
+	return nil
+}
+
+// introspection describes a token, only Active is set for an invalid,
+// expired or revoked one.
+type introspection struct {
+	Active    bool   `json:"active"`
+	Subject   string `json:"sub,omitempty"`
+	Username  string `json:"username,omitempty"`
+	AccountID string `json:"accountId,omitempty"`
+	Role      *int   `json:"role,omitempty"`
+	// Scope is space separated, "user" for all users and "user root" for
+	// the root users
+	Scope          string `json:"scope,omitempty"`
+	TokenType      string `json:"token_type,omitempty"`
+	Expires        int64  `json:"exp,omitempty"`
+	IssuedAt       int64  `json:"iat,omitempty"`
+	ImpersonatedBy string `json:"impersonatedBy,omitempty"`
+}
+
+// introspect validates the tokens of the base for an API gateway. The
+// response is a single introspection when token is sent and an array in
+// the order of tokens for a batch.
+func (m *membership) introspect(w http.ResponseWriter, r *http.Request) {
+	var req introspectRequest
+	if err := decodeRequest(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if len(req.ClientIP) > 0 || len(req.ClientUserAgent) > 0 {
+		client := middleware.Client{IP: req.ClientIP, UserAgent: req.ClientUserAgent}
+		ctx = context.WithValue(ctx, middleware.ContextClient, client)
+	}
+
+	if len(req.Tokens) == 0 {
+		respond(w, http.StatusOK, m.introspectToken(ctx, req.Token, time.Now()))
+		return
+	}
+
+	results := make([]introspection, 0, len(req.Tokens))
+	for _, token := range req.Tokens {
+		results = append(results, m.introspectToken(ctx, token, time.Now()))
+	}
+	respond(w, http.StatusOK, results)
+}
+
+// introspectToken validates the JWT token with ValidateAuthKey, it's also
+// inactive once expired.
+func (m *membership) introspectToken(ctx context.Context, token string, now time.Time) introspection {
+	var pl internal.JWTPayload
+	if _, err := jwt.Verify([]byte(token), internal.HashSecret(), &pl); err != nil {
+		return introspection{}
+	} else if err := jwt.ExpirationTimeValidator(now)(&pl.Payload); err != nil {
+		return introspection{}
+	}
+
+	auth, err := middleware.ValidateAuthKey(datastore, m.volatile, ctx, token)
+	if err != nil {
+		return introspection{}
+	}
+
+	scope := "user"
+	if auth.Role >= middleware.RootRole {
+		scope = "user root"
+	}
+
+	res := introspection{
+		Active:         true,
+		Subject:        auth.UserID,
+		Username:       auth.Email,
+		AccountID:      auth.AccountID,
+		Role:           &auth.Role,
+		Scope:          scope,
+		TokenType:      "Bearer",
+		ImpersonatedBy: auth.ImpersonatedBy,
+	}
+	if pl.ExpirationTime != nil {
+		res.Expires = pl.ExpirationTime.Unix()
+	}
+	if pl.IssuedAt != nil {
+		res.IssuedAt = pl.IssuedAt.Unix()
+	}
+	return res
+}
@@ -0,0 +1,96 @@
+package staticbackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+
+	"github.com/gbrlsnchs/jwt/v3"
+)
+
+func TestIntrospect(t *testing.T) {
+	m := &membership{volatile: volatile}
+
+	tok, err := datastore.FindTokenByEmail(dbName, userEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid, user, err := m.createUser(dbName, tok.AccountID, "introspect-valid@test.com", userPassword, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revoked, revokedUser, err := m.createUser(dbName, tok.AccountID, "introspect-revoked@test.com", userPassword, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := datastore.SetUserToken(dbName, revokedUser.ID, datastore.NewID()); err != nil {
+		t.Fatal(err)
+	} else if err := middleware.AuthTokens(volatile).DeleteAuth(fmt.Sprintf("%s|%s", revokedUser.ID, revokedUser.Token)); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	expired, err := jwt.Sign(internal.JWTPayload{
+		Payload: jwt.Payload{
+			ExpirationTime: jwt.NumericDate(now.Add(-time.Minute)),
+			IssuedAt:       jwt.NumericDate(now.Add(-time.Hour)),
+		},
+		Token: fmt.Sprintf("%s|%s", user.ID, user.Token),
+	}, internal.HashSecret())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a single token is sent as a form like in RFC 7662
+	resp := dbReq(t, m.introspect, "POST", "/sudo/introspect", url.Values{"token": {string(valid)}}, true, true)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+	defer resp.Body.Close()
+
+	var single introspection
+	if err := json.NewDecoder(resp.Body).Decode(&single); err != nil {
+		t.Fatal(err)
+	} else if !single.Active || single.Subject != user.ID || single.Username != "introspect-valid@test.com" {
+		t.Errorf("expected the valid token to be active got %v", single)
+	} else if single.Role == nil || *single.Role != 0 || single.Scope != "user" || single.Expires <= now.Unix() {
+		t.Errorf("unexpected role, scope or expiry got %v", single)
+	}
+
+	batch := map[string][]string{"tokens": {string(valid), string(expired), string(revoked), "not-a-jwt"}}
+	resp = dbReq(t, m.introspect, "POST", "/sudo/introspect", batch, true)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+	defer resp.Body.Close()
+
+	var results []introspection
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	} else if len(results) != 4 {
+		t.Fatalf("expected 4 results got %d", len(results))
+	}
+
+	expected := []bool{true, false, false, false}
+	for i, res := range results {
+		if res.Active != expected[i] {
+			t.Errorf("token %d: expected active to be %t got %v", i, expected[i], res)
+		} else if !res.Active && (len(res.Subject) > 0 || res.Role != nil) {
+			t.Errorf("token %d: expected only active for an inactive token got %v", i, res)
+		}
+	}
+
+	resp = dbReq(t, m.introspect, "POST", "/sudo/introspect", map[string]string{}, true)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 without token got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,174 @@
+// Package jobs runs periodic work for every active base, i.e. removing the
+// expired documents or sending the trial reminders.
+package jobs
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/staticbackendhq/core/config"
+	"github.com/staticbackendhq/core/internal"
+)
+
+// Clock is the time source of a Scheduler, tests use a fake one.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Func is the work of a job for one base, ctx is done when the scheduler
+// stops.
+type Func func(ctx context.Context, base internal.BaseConfig) error
+
+// Job is a periodic work done for each active base.
+type Job struct {
+	// Name identifies the job in the logs and in DISABLED_JOBS
+	Name     string
+	Interval time.Duration
+	// Jitter is the maximum random delay added to each run so the bases
+	// are not all processed at the same time
+	Jitter time.Duration
+	Run    Func
+}
+
+// Scheduler runs the registered jobs for each active base. Each base has
+// its own schedule, a base is first processed when it's seen, after a
+// jitter, then every job interval.
+type Scheduler struct {
+	datastore internal.Persister
+	clock     Clock
+	jitter    func(max time.Duration) time.Duration
+
+	mu   sync.Mutex
+	jobs []Job
+	// next holds the next run of a job for a base, by job name and base ID
+	next map[string]map[string]time.Time
+}
+
+// NewScheduler returns a Scheduler using the system clock when clock is
+// nil.
+func NewScheduler(datastore internal.Persister, clock Clock) *Scheduler {
+	if clock == nil {
+		clock = systemClock{}
+	}
+
+	return &Scheduler{
+		datastore: datastore,
+		clock:     clock,
+		jitter:    randomJitter,
+		next:      make(map[string]map[string]time.Time),
+	}
+}
+
+// Register adds job to the scheduled jobs.
+func (s *Scheduler) Register(job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs = append(s.jobs, job)
+	s.next[job.Name] = make(map[string]time.Time)
+}
+
+// RunDue runs the jobs that are due for each active base. The runs are
+// sequential, a failing run is logged and does not prevent the others.
+func (s *Scheduler) RunDue(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bases, err := s.datastore.ListDatabases()
+	if err != nil {
+		return err
+	}
+
+	for _, job := range s.jobs {
+		if !config.JobEnabled(config.Current, job.Name) {
+			continue
+		}
+
+		for _, base := range bases {
+			if !base.IsActive {
+				continue
+			}
+
+			now := s.clock.Now()
+
+			next, ok := s.next[job.Name][base.ID]
+			if !ok {
+				next = now.Add(s.jitter(job.Jitter))
+				s.next[job.Name][base.ID] = next
+			}
+
+			if now.Before(next) {
+				continue
+			}
+
+			if err := job.Run(ctx, base); err != nil {
+				log.Printf("error running job %s for base %s: %v", job.Name, base.Name, err)
+			}
+
+			s.next[job.Name][base.ID] = now.Add(job.Interval + s.jitter(job.Jitter))
+		}
+	}
+
+	s.prune(bases)
+	return nil
+}
+
+// prune forgets the schedule of the bases that are no longer listed or
+// active, a reactivated base is scheduled again like a new one.
+func (s *Scheduler) prune(bases []internal.BaseConfig) {
+	active := make(map[string]bool)
+	for _, base := range bases {
+		if base.IsActive {
+			active[base.ID] = true
+		}
+	}
+
+	for _, next := range s.next {
+		for id := range next {
+			if !active[id] {
+				delete(next, id)
+			}
+		}
+	}
+}
+
+// HasJobs returns if at least one job is registered.
+func (s *Scheduler) HasJobs() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.jobs) > 0
+}
+
+// Start calls RunDue at each resolution until ctx is done.
+func (s *Scheduler) Start(ctx context.Context, resolution time.Duration) {
+	ticker := time.NewTicker(resolution)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.RunDue(ctx); err != nil {
+				log.Println("error running the scheduled jobs", err)
+			}
+		}
+	}
+}
+
+func randomJitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
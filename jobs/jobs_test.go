@@ -0,0 +1,208 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/cache"
+	"github.com/staticbackendhq/core/config"
+	"github.com/staticbackendhq/core/database/memory"
+	"github.com/staticbackendhq/core/internal"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newDatastore(t *testing.T) internal.Persister {
+	volatile := cache.NewDevCache()
+	datastore := memory.New(volatile.PublishDocument)
+
+	for _, b := range []internal.BaseConfig{
+		{Name: "activeone", IsActive: true},
+		{Name: "activetwo", IsActive: true},
+		{Name: "inactive", IsActive: false},
+	} {
+		if _, err := datastore.CreateBase(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return datastore
+}
+
+func TestSchedulerRunsJobForEachActiveBase(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewScheduler(newDatastore(t), clock)
+
+	runs := make(map[string]int)
+	s.Register(Job{
+		Name:     "counter",
+		Interval: time.Hour,
+		Run: func(ctx context.Context, base internal.BaseConfig) error {
+			runs[base.Name]++
+			return nil
+		},
+	})
+
+	steps := []struct {
+		advance  time.Duration
+		expected int
+	}{
+		{0, 1},
+		{30 * time.Minute, 1},
+		{30 * time.Minute, 2},
+		{59 * time.Minute, 2},
+		{time.Minute, 3},
+	}
+
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		if err := s.RunDue(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"activeone", "activetwo"} {
+			if runs[name] != step.expected {
+				t.Errorf("step %d: expected %s to run %d times got %d", i, name, step.expected, runs[name])
+			}
+		}
+		if runs["inactive"] != 0 {
+			t.Errorf("step %d: expected the inactive base to be skipped", i)
+		}
+	}
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewScheduler(newDatastore(t), clock)
+
+	// each base gets a distinct delay
+	delays := []time.Duration{10 * time.Minute, 20 * time.Minute}
+	s.jitter = func(max time.Duration) time.Duration {
+		d := delays[0]
+		delays = append(delays[1:], d)
+		return d
+	}
+
+	var runs int
+	s.Register(Job{
+		Name:     "jittered",
+		Interval: time.Hour,
+		Jitter:   30 * time.Minute,
+		Run: func(ctx context.Context, base internal.BaseConfig) error {
+			runs++
+			return nil
+		},
+	})
+
+	expected := []int{0, 1, 2}
+	for i, n := range expected {
+		if err := s.RunDue(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if runs != n {
+			t.Errorf("after %d minutes: expected %d runs got %d", i*10, n, runs)
+		}
+		clock.Advance(10 * time.Minute)
+	}
+}
+
+func TestSchedulerDisabledJobAndErrors(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.DisabledJobs = "disabled"
+
+	clock := &fakeClock{now: time.Now()}
+	s := NewScheduler(newDatastore(t), clock)
+
+	var disabled, failing int
+	s.Register(Job{
+		Name:     "disabled",
+		Interval: time.Minute,
+		Run: func(ctx context.Context, base internal.BaseConfig) error {
+			disabled++
+			return nil
+		},
+	})
+	s.Register(Job{
+		Name:     "failing",
+		Interval: time.Minute,
+		Run: func(ctx context.Context, base internal.BaseConfig) error {
+			failing++
+			return errors.New("unit test failure")
+		},
+	})
+
+	if err := s.RunDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if disabled != 0 {
+		t.Errorf("expected the disabled job not to run got %d runs", disabled)
+	} else if failing != 2 {
+		t.Errorf("expected a failing run not to stop the other bases got %d runs", failing)
+	}
+}
+
+// listedBases returns bases from ListDatabases so a test can remove one.
+type listedBases struct {
+	internal.Persister
+	bases []internal.BaseConfig
+}
+
+func (l *listedBases) ListDatabases() ([]internal.BaseConfig, error) {
+	return l.bases, nil
+}
+
+func TestSchedulerPrunesRemovedBases(t *testing.T) {
+	datastore := newDatastore(t)
+	bases, err := datastore.ListDatabases()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listed := &listedBases{Persister: datastore, bases: bases}
+	s := NewScheduler(listed, &fakeClock{now: time.Now()})
+	s.Register(Job{
+		Name:     "pruned",
+		Interval: time.Hour,
+		Run: func(ctx context.Context, base internal.BaseConfig) error {
+			return nil
+		},
+	})
+
+	if err := s.RunDue(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n := len(s.next["pruned"]); n != 2 {
+		t.Fatalf("expected the 2 active bases to be scheduled got %d", n)
+	}
+
+	var kept []internal.BaseConfig
+	for _, base := range bases {
+		if base.Name != "activeone" {
+			kept = append(kept, base)
+		}
+	}
+	listed.bases = kept
+
+	if err := s.RunDue(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n := len(s.next["pruned"]); n != 1 {
+		t.Errorf("expected the removed base to be pruned got %d scheduled bases", n)
+	}
+}
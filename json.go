@@ -1,13 +1,24 @@
 package staticbackend
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"io"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/staticbackendhq/core/config"
 )
 
+// envelope is the success response shape when the envelope is enabled.
+type envelope struct {
+	Data interface{} `json:"data"`
+}
+
 func respond(w http.ResponseWriter, code int, v interface{}) {
-	b, err := json.Marshal(v)
+	b, err := responseBody(v)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -18,6 +29,70 @@ func respond(w http.ResponseWriter, code int, v interface{}) {
 	w.Write(b)
 }
 
+// responseBody returns the JSON of v wrapped in the envelope if
+// RESPONSE_ENVELOPE is enabled.
+func responseBody(v interface{}) ([]byte, error) {
+	if strings.EqualFold(config.Current.ResponseEnvelope, "yes") {
+		v = envelope{Data: v}
+	}
+	return json.Marshal(v)
+}
+
+// respondCacheable responds v with a weak ETag, a hash of the body, as the
+// body may be compressed on the way out. A non-zero modified is sent as
+// Last-Modified. It responds 304 Not Modified when the conditional headers
+// of r match, If-None-Match takes precedence over If-Modified-Since.
+func respondCacheable(w http.ResponseWriter, r *http.Request, modified time.Time, v interface{}) {
+	b, err := responseBody(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(b)
+	etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+
+	// the responses depend on the caller and must be revalidated
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// notModified compares the If-None-Match of r with the weak comparison, or
+// without one, modified with the If-Modified-Since of r to the second.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); len(inm) > 0 {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if modified.IsZero() {
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
 func parseBody(body io.ReadCloser, v interface{}) error {
 	defer body.Close()
 	return json.NewDecoder(body).Decode(v)
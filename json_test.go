@@ -0,0 +1,40 @@
+package staticbackend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/staticbackendhq/core/config"
+)
+
+func TestRespondEnvelope(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, map[string]string{"name": "sb"})
+	})
+
+	body := func(h http.Handler) string {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return w.Body.String()
+	}
+
+	tests := []struct {
+		name     string
+		global   string
+		h        http.Handler
+		expected string
+	}{
+		{"raw by default", "", h, `{"name":"sb"}`},
+		{"global envelope", "yes", h, `{"data":{"name":"sb"}}`},
+	}
+
+	for _, tc := range tests {
+		config.Current.ResponseEnvelope = tc.global
+		if got := body(tc.h); got != tc.expected {
+			t.Errorf("%s: expected %s got %s", tc.name, tc.expected, got)
+		}
+	}
+}
@@ -15,7 +15,9 @@ import (
 	"github.com/staticbackendhq/core/database/mongo"
 	"github.com/staticbackendhq/core/database/postgresql"
 	"github.com/staticbackendhq/core/email"
+	"github.com/staticbackendhq/core/events"
 	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
 	"github.com/staticbackendhq/core/storage"
 )
 
@@ -41,6 +43,14 @@ var (
 
 func TestMain(m *testing.M) {
 	config.Current = config.LoadConfig()
+	// the webhook receivers of the tests listen on the loopback
+	config.Current.WebhookAllowPrivate = "yes"
+
+	settings, err := config.ParseSettings(config.Current)
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.Current.Settings = settings
 
 	volatile = cache.NewCache()
 
@@ -70,18 +80,26 @@ func TestMain(m *testing.M) {
 	} else {
 		emailer = email.Dev{}
 	}
+	events.Subscribe(events.AccountCreatedEvent, sendAccountCreatedEmail)
+	events.Subscribe(events.NewDeviceLoginEvent, sendNewDeviceLoginEmail)
+	events.Subscribe(events.DocumentChangedEvent, deliverWebhooks)
 
 	deleteAndSetupTestAccount()
 
 	hub := newHub(volatile)
 	go hub.run()
 
-	ws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		serveWs(hub, w, r)
-	}))
+	ws := httptest.NewServer(middleware.Chain(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serveWs(hub, w, r)
+		}),
+		middleware.RequireActiveBase(datastore, volatile),
+		middleware.RequireFeature(internal.FeatureRealtime),
+		checkRealtimeOrigin,
+	))
 	defer ws.Close()
 
-	wsURL = "ws" + strings.TrimPrefix(ws.URL, "http")
+	wsURL = "ws" + strings.TrimPrefix(ws.URL, "http") + "?sbpk=" + pubKey
 
 	funexec = &functions{datastore: datastore, dbName: dbName}
 
@@ -119,7 +137,7 @@ func deleteAndSetupTestAccount() {
 	pubKey = base.ID
 
 	m := &membership{volatile: volatile}
-	token, dbToken, err := m.createAccountAndUser(dbName, admEmail, password, 100)
+	token, dbToken, err := m.createAccountAndUser(base, admEmail, password, 100, "")
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -128,10 +146,22 @@ func deleteAndSetupTestAccount() {
 
 	rootToken = fmt.Sprintf("%s|%s|%s", dbToken.ID, dbToken.AccountID, dbToken.Token)
 
-	token, _, err = m.createUser(dbName, dbToken.AccountID, userEmail, userPassword, 0)
+	token, _, err = m.createUser(dbName, dbToken.AccountID, userEmail, userPassword, 0, "")
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	userToken = string(token)
 }
+
+// parseSettings sets the Settings of config.Current once a test changed
+// its values.
+func parseSettings(t *testing.T) {
+	t.Helper()
+
+	settings, err := config.ParseSettings(config.Current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Current.Settings = settings
+}
@@ -6,9 +6,14 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
+	"github.com/staticbackendhq/core/cache"
+	"github.com/staticbackendhq/core/config"
+	emailFuncs "github.com/staticbackendhq/core/email"
+	"github.com/staticbackendhq/core/events"
 	"github.com/staticbackendhq/core/internal"
 	"github.com/staticbackendhq/core/middleware"
 
@@ -17,6 +22,10 @@ import (
 	"github.com/gbrlsnchs/jwt/v3"
 )
 
+// ImpersonationDuration is how long a token minted via the impersonation
+// endpoint stays valid.
+const ImpersonationDuration = 1 * time.Hour
+
 type membership struct {
 	volatile internal.Volatilizer
 }
@@ -60,19 +69,109 @@ func (m *membership) login(w http.ResponseWriter, r *http.Request) {
 
 	tok, err := m.validateUserPassword(conf.Name, l.Email, l.Password)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), credentialsErrorStatus(err))
 		return
 	}
 
-	token := fmt.Sprintf("%s|%s", tok.ID, tok.Token)
+	jwtBytes, err := m.signIn(conf, tok, r)
+	if err != nil {
+		http.Error(w, err.Error(), credentialsErrorStatus(err))
+		return
+	}
 
-	// get their JWT
-	jwtBytes, err := m.getJWT(token)
+	respond(w, http.StatusOK, string(jwtBytes))
+}
+
+// tokenUser is the user a token was issued to.
+type tokenUser struct {
+	ID        string `json:"id"`
+	AccountID string `json:"accountId"`
+	Email     string `json:"email"`
+	Role      int    `json:"role"`
+}
+
+// issuedToken is a JWT with its expiry and user.
+type issuedToken struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+	User    tokenUser `json:"user"`
+}
+
+// loginToken signs in like login and returns the JWT with its expiry and
+// the user's info. Bad credentials are a 401 and an inactive base a 403,
+// see RequireActiveBase.
+func (m *membership) loginToken(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, "invalid StaticBackend key", http.StatusUnauthorized)
+		return
+	}
+
+	var l internal.Login
+	if err := parseBody(r.Body, &l); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tok, err := m.validateUserPassword(conf.Name, l.Email, l.Password)
+	if err != nil {
+		http.Error(w, err.Error(), credentialsErrorStatus(err))
+		return
+	}
+
+	jwtBytes, err := m.signIn(conf, tok, r)
 	if err != nil {
+		http.Error(w, err.Error(), credentialsErrorStatus(err))
+		return
+	}
+
+	var pl internal.JWTPayload
+	if _, err := jwt.Verify(jwtBytes, internal.HashSecret(), &pl); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	it := issuedToken{
+		Token:   string(jwtBytes),
+		Expires: pl.ExpirationTime.Time,
+		User: tokenUser{
+			ID:        tok.ID,
+			AccountID: tok.AccountID,
+			Email:     tok.Email,
+			Role:      tok.Role,
+		},
+	}
+	respond(w, http.StatusOK, it)
+}
+
+// errInvalidCredentials is returned by validateUserPassword for an unknown
+// email or a wrong password.
+var errInvalidCredentials = errors.New("invalid email/password")
+
+// credentialsErrorStatus returns a 401 for bad credentials and a 403 for a
+// user at their MAX_TOKENS_PER_USER, the other errors come from the
+// datastore.
+func credentialsErrorStatus(err error) int {
+	if errors.Is(err, errInvalidCredentials) {
+		return http.StatusUnauthorized
+	} else if errors.Is(err, internal.ErrTokenLimit) {
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// signIn returns the JWT of the user once their session is cached, the
+// login is recorded in their history.
+func (m *membership) signIn(conf internal.BaseConfig, tok internal.Token, r *http.Request) ([]byte, error) {
+	ut := internal.UserToken{ID: tok.ID, Token: tok.Token}
+	token := ut.Key()
+
+	// get their JWT
+	jwtBytes, err := m.getJWT(ut.String(), sessionOf(conf, r))
+	if err != nil {
+		return nil, err
+	}
+
 	auth := internal.Auth{
 		AccountID: tok.AccountID,
 		UserID:    tok.ID,
@@ -83,16 +182,433 @@ func (m *membership) login(w http.ResponseWriter, r *http.Request) {
 
 	//TODO: find a good way to find all occurences of those two
 	// and make them easily callable via a shared function
-	if err := m.volatile.SetTyped(token, auth); err != nil {
+	if err := middleware.AuthTokens(m.volatile).SetAuth(token, auth); err != nil {
+		return nil, err
+	}
+	if err := m.volatile.SetTyped("base:"+token, conf); err != nil {
+		return nil, err
+	}
+
+	if err := alertNewDeviceLogin(conf, tok, r); err != nil {
+		log.Println("error sending the new device login alert", err)
+	}
+
+	if err := recordLogin(conf.Name, tok.ID, r); err != nil {
+		log.Println("error recording login", err)
+	}
+
+	return jwtBytes, nil
+}
+
+// recordLogin adds the login to the history of the user, the history keeps
+// the LOGIN_HISTORY most recent logins.
+func recordLogin(dbName, userID string, r *http.Request) error {
+	keep := config.Current.Settings.LoginHistorySize
+	if keep == 0 {
+		return nil
+	}
+
+	ev := internal.LoginEvent{
+		UserID:    userID,
+		IP:        middleware.RemoteIP(r),
+		UserAgent: r.UserAgent(),
+		Created:   time.Now(),
+	}
+	return datastore.AddLoginEvent(dbName, ev, keep)
+}
+
+// alertNewDeviceLogin emits a NewDeviceLogin when LOGIN_ALERTS is enabled
+// and the user, having a login history, signs in from an IP address that's
+// not part of it. It must be called before the login is recorded.
+func alertNewDeviceLogin(conf internal.BaseConfig, tok internal.Token, r *http.Request) error {
+	if !strings.EqualFold(config.Current.LoginAlerts, "yes") {
+		return nil
+	}
+
+	history, err := datastore.ListLoginEvents(conf.Name, tok.ID)
+	if err != nil || len(history) == 0 {
+		// the first login of a user is not a new device
+		return err
+	}
+
+	ip := middleware.RemoteIP(r)
+	for _, ev := range history {
+		if ev.IP == ip {
+			return nil
+		}
+	}
+
+	enabled, err := datastore.LoginAlertsEnabled(conf.Name, tok.ID)
+	if err != nil || !enabled {
+		return err
+	}
+
+	return events.Emit(events.NewDeviceLogin{
+		Base:      conf.Name,
+		PublicKey: conf.ID,
+		Email:     tok.Email,
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+		Country:   r.Header.Get(countryHintHeader),
+		Time:      time.Now(),
+	})
+}
+
+var newDeviceLoginEmail = emailFuncs.Template{
+	Name:    "login-alert",
+	Subject: "New sign-in to your account",
+	HTML: `
+	<p>Hey there,</p>
+	<p>Your account was just used to sign in from a new device.</p>
+	<p>IP address: {{.IP}}<br />
+	Location: {{.Country}}<br />
+	Device: {{.UserAgent}}<br />
+	Time: {{.Time}}</p>
+	<p>If this was you, you can ignore this email. Otherwise change your 
+	password right away.</p>
+	`,
+}
+
+// sendNewDeviceLoginEmail notifies a user signing in from a new device.
+func sendNewDeviceLoginEmail(e events.Event) error {
+	ev := e.(events.NewDeviceLogin)
+
+	country := ev.Country
+	if len(country) == 0 {
+		country = "unknown"
+	}
+
+	data := map[string]string{
+		"IP":        ev.IP,
+		"Country":   country,
+		"UserAgent": ev.UserAgent,
+		"Time":      ev.Time.UTC().Format(time.RFC1123),
+	}
+
+	htmlBody, textBody, err := newDeviceLoginEmail.Render(data)
+	if err != nil {
+		return err
+	}
+
+	subject, fromName, err := mailBranding(newDeviceLoginEmail, ev.Base, data)
+	if err != nil {
+		return err
+	}
+
+	ed := internal.SendMailData{
+		From:     config.Current.FromEmail,
+		FromName: fromName,
+		To:       ev.Email,
+		Subject:  subject,
+		HTMLBody: htmlBody,
+		TextBody: textBody,
+		ReplyTo:  supportEmail(),
+	}
+	return emailer.Send(withMailDefaults(ed))
+}
+
+// loginAlerts returns or, on POST, sets if the current user receives the
+// new device login emails.
+func (m *membership) loginAlerts(w http.ResponseWriter, r *http.Request) {
+	conf, auth, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		data := new(struct {
+			Enabled bool `json:"enabled"`
+		})
+		if err := parseBody(r.Body, data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := datastore.SetLoginAlerts(conf.Name, auth.UserID, data.Enabled); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	enabled, err := datastore.LoginAlertsEnabled(conf.Name, auth.UserID)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if err := m.volatile.SetTyped("base:"+token, conf); err != nil {
+
+	respond(w, http.StatusOK, map[string]bool{"enabled": enabled})
+}
+
+// logins returns the recent logins of the current user, most recent first.
+func (m *membership) logins(w http.ResponseWriter, r *http.Request) {
+	conf, auth, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, err := datastore.ListLoginEvents(conf.Name, auth.UserID)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	respond(w, http.StatusOK, string(jwtBytes))
+	data := struct {
+		LastLogin *time.Time            `json:"lastLogin"`
+		Logins    []internal.LoginEvent `json:"logins"`
+	}{Logins: []internal.LoginEvent{}}
+
+	if len(events) > 0 {
+		data.LastLogin = &events[0].Created
+		data.Logins = events
+	}
+
+	respond(w, http.StatusOK, data)
+}
+
+// maxTokenLabel is the longest label a token can have.
+const maxTokenLabel = 64
+
+// tokenInfo is a token of the account as listed by tokens, the secret part
+// of the token is not included.
+type tokenInfo struct {
+	ID      string    `json:"id"`
+	Label   string    `json:"label"`
+	Email   string    `json:"email"`
+	Role    int       `json:"role"`
+	Created time.Time `json:"created"`
+}
+
+// tokens lists the tokens of the account of the current user with their
+// label so a specific one can be identified. The users below the account
+// admin role only list their own token.
+func (m *membership) tokens(w http.ResponseWriter, r *http.Request) {
+	conf, auth, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	toks, err := datastore.ListTokens(conf.Name, auth.AccountID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	list := make([]tokenInfo, 0, len(toks))
+	for _, tok := range toks {
+		if auth.Role < middleware.RootRole && tok.ID != auth.UserID {
+			continue
+		}
+
+		list = append(list, tokenInfo{
+			ID:      tok.ID,
+			Label:   tok.Label,
+			Email:   tok.Email,
+			Role:    tok.Role,
+			Created: tok.Created,
+		})
+	}
+
+	respond(w, http.StatusOK, list)
+}
+
+// meResponse is the identity returned by /me, the token is not included.
+type meResponse struct {
+	UserID         string `json:"userId"`
+	AccountID      string `json:"accountId"`
+	Email          string `json:"email"`
+	Role           int    `json:"role"`
+	Plan           int    `json:"plan"`
+	ImpersonatedBy string `json:"impersonatedBy,omitempty"`
+	Base           struct {
+		ID          string `json:"id"`
+		PublicKey   string `json:"publicKey"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"base"`
+}
+
+// me returns the identity of the authenticated user and the base it
+// belongs to.
+func (m *membership) me(w http.ResponseWriter, r *http.Request) {
+	conf, auth, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := meResponse{
+		UserID:         auth.UserID,
+		AccountID:      auth.AccountID,
+		Email:          auth.Email,
+		Role:           auth.Role,
+		Plan:           auth.Plan,
+		ImpersonatedBy: auth.ImpersonatedBy,
+	}
+	data.Base.ID = conf.ID
+	data.Base.PublicKey = conf.Key()
+	data.Base.Name = conf.Name
+	data.Base.DisplayName = conf.DisplayName
+
+	respond(w, http.StatusOK, data)
+}
+
+// emailChangeDuration is how long an email change confirmation link stays
+// valid.
+const emailChangeDuration = 24 * time.Hour
+
+var emailChangeEmail = emailFuncs.Template{
+	Name:    "email-change",
+	Subject: "Confirm your new email address",
+	HTML: `
+	<p>Hey there,</p>
+	<p>We received a request to change the email address of your account 
+	from {{.Email}} to this address.</p>
+	<p><a href="{{.Link}}">Confirm your new email address</a></p>
+	<p>This link expires in 24 hours. If you did not request this change you 
+	can ignore this email.</p>
+	`,
+}
+
+// changeEmail initiates the change of the email of the authenticated user,
+// a confirmation link is sent to the new address. The email is updated by
+// confirmEmailChange.
+func (m *membership) changeEmail(w http.ResponseWriter, r *http.Request) {
+	conf, auth, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := new(struct {
+		Email string `json:"email"`
+	})
+	if err := parseBody(r.Body, data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newEmail := internal.NormalizeEmail(data.Email)
+	if strings.Index(newEmail, "@") <= 0 {
+		http.Error(w, "invalid email", http.StatusBadRequest)
+		return
+	} else if newEmail == internal.NormalizeEmail(auth.Email) {
+		http.Error(w, "this is already your email", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := datastore.UserEmailExists(conf.Name, newEmail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if exists {
+		http.Error(w, internal.ErrEmailTaken.Error(), http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	pl := internal.EmailChangePayload{
+		Payload: jwt.Payload{
+			Issuer:         "StaticBackend",
+			ExpirationTime: jwt.NumericDate(now.Add(emailChangeDuration)),
+			IssuedAt:       jwt.NumericDate(now),
+			JWTID:          randStringRunes(32),
+		},
+		Base:     conf.Name,
+		TokenID:  auth.UserID,
+		Email:    auth.Email,
+		NewEmail: newEmail,
+	}
+
+	token, err := jwt.Sign(pl, internal.HashSecret())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the public key in the link resolves the base, see RequireActiveBase
+	link := config.Link(config.Current, "me/email/confirm", url.Values{
+		"sbpk":  {conf.Key()},
+		"token": {string(token)},
+	})
+
+	mailData := map[string]string{
+		"Email": auth.Email,
+		"Link":  link,
+	}
+
+	htmlBody, textBody, err := emailChangeEmail.Render(mailData)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	subject, fromName, err := mailBranding(emailChangeEmail, conf.Name, mailData)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ed := internal.SendMailData{
+		From:     config.Current.FromEmail,
+		FromName: fromName,
+		To:       newEmail,
+		Subject:  subject,
+		HTMLBody: htmlBody,
+		TextBody: textBody,
+		ReplyTo:  supportEmail(),
+	}
+	if err := emailer.Send(withMailDefaults(ed)); err != nil {
+		http.Error(w, err.Error(), mailErrorStatus(err))
+		return
+	}
+
+	respond(w, http.StatusOK, true)
+}
+
+// confirmEmailChange updates the email of the user once the link sent by
+// changeEmail is opened. The new email must still be available.
+func (m *membership) confirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var pl internal.EmailChangePayload
+	expValidator := jwt.ExpirationTimeValidator(time.Now())
+	validate := jwt.ValidatePayload(&pl.Payload, expValidator)
+	if _, err := jwt.Verify([]byte(r.URL.Query().Get("token")), internal.HashSecret(), &pl, validate); err != nil {
+		http.Error(w, "invalid or expired confirmation link", http.StatusBadRequest)
+		return
+	} else if pl.Base != conf.Name {
+		http.Error(w, "invalid confirmation link", http.StatusBadRequest)
+		return
+	}
+
+	tok, err := datastore.FindTokenByEmail(conf.Name, pl.Email)
+	if err != nil || tok.ID != pl.TokenID {
+		http.Error(w, "the email changed since this link was sent", http.StatusBadRequest)
+		return
+	}
+
+	if err := datastore.UserSetEmail(conf.Name, tok.ID, pl.NewEmail); errors.Is(err, internal.ErrEmailTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the cached Auth still has the previous email
+	token := internal.UserToken{ID: tok.ID, Token: tok.Token}.Key()
+	if err := middleware.AuthTokens(m.volatile).DeleteAuth(token); err != nil {
+		log.Println("error removing the cached auth after an email change", err)
+	}
+
+	respond(w, http.StatusOK, true)
 }
 
 func (m *membership) validateUserPassword(dbName, email, password string) (tok internal.Token, err error) {
@@ -100,11 +616,15 @@ func (m *membership) validateUserPassword(dbName, email, password string) (tok i
 
 	tok, err = datastore.FindTokenByEmail(dbName, email)
 	if err != nil {
+		// the backends report a missing user differently
+		if exists, existsErr := datastore.UserEmailExists(dbName, email); existsErr == nil && !exists {
+			err = errInvalidCredentials
+		}
 		return
 	}
 
 	if err = bcrypt.CompareHashAndPassword([]byte(tok.Password), []byte(password)); err != nil {
-		return tok, errors.New("invalid email/password")
+		return tok, errInvalidCredentials
 	}
 
 	return
@@ -125,6 +645,11 @@ func (m *membership) register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	l.Email = strings.ToLower(l.Email)
+	l.Label = strings.TrimSpace(l.Label)
+	if len(l.Label) > maxTokenLabel {
+		http.Error(w, fmt.Sprintf("the label must be at most %d characters", maxTokenLabel), http.StatusBadRequest)
+		return
+	}
 
 	exists, err := datastore.UserEmailExists(conf.Name, l.Email)
 	if err != nil {
@@ -135,12 +660,24 @@ func (m *membership) register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jwtBytes, tok, err := m.createAccountAndUser(conf.Name, l.Email, l.Password, 0)
-	if err != nil {
+	role := config.Current.Settings.DefaultUserRole
+
+	_, tok, err := m.createAccountAndUser(conf, l.Email, l.Password, role, l.Label)
+	if errors.Is(err, internal.ErrEmailTaken) {
+		http.Error(w, "invalid email", http.StatusBadRequest)
+		return
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// the JWT is bound to the client signing up
+	jwtBytes, err := m.getJWT(internal.UserToken{ID: tok.ID, Token: tok.Token}.String(), sessionOf(conf, r))
+	if err != nil {
+		http.Error(w, err.Error(), credentialsErrorStatus(err))
+		return
+	}
+
 	token := string(jwtBytes)
 
 	auth := internal.Auth{
@@ -151,7 +688,7 @@ func (m *membership) register(w http.ResponseWriter, r *http.Request) {
 		Token:     tok.Token,
 	}
 
-	if err := m.volatile.SetTyped(token, auth); err != nil {
+	if err := middleware.AuthTokens(m.volatile).SetAuth(token, auth); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -163,20 +700,89 @@ func (m *membership) register(w http.ResponseWriter, r *http.Request) {
 	respond(w, http.StatusOK, token)
 }
 
-func (m *membership) createAccountAndUser(dbName, email, password string, role int) ([]byte, internal.Token, error) {
-	acctID, err := datastore.CreateUserAccount(dbName, email)
+// createAccountAndUser creates the user and its account, label names its
+// token and can be empty. It's safe to
+// retry, i.e. after a timeout during signup: when the email is already
+// used by a user having the same password and role that user is returned,
+// otherwise it fails with internal.ErrEmailTaken.
+func (m *membership) createAccountAndUser(conf internal.BaseConfig, email, password string, role int, label string) ([]byte, internal.Token, error) {
+	email = internal.NormalizeEmail(email)
+
+	exists, err := datastore.UserEmailExists(conf.Name, email)
+	if err != nil {
+		return nil, internal.Token{}, err
+	} else if exists {
+		return m.existingUser(conf.Name, email, password, role)
+	}
+
+	acctID, err := datastore.CreateUserAccount(conf.Name, email)
 	if err != nil {
 		return nil, internal.Token{}, err
 	}
 
-	jwtBytes, tok, err := m.createUser(dbName, acctID, email, password, role)
+	jwtBytes, tok, err := m.createUser(conf.Name, acctID, email, password, role, label)
 	if err != nil {
 		return nil, internal.Token{}, err
 	}
+
+	// the admin user created with the base is not a signup
+	if role < middleware.RootRole {
+		if err := m.publishUserCreated(conf, tok); err != nil {
+			log.Println("error publishing user created event: ", err)
+		}
+	}
 	return jwtBytes, tok, nil
 }
 
-func (m *membership) createUser(dbName, accountID, email, password string, role int) ([]byte, internal.Token, error) {
+// existingUser returns the user having email when it was created with the
+// same password and role by a previous createAccountAndUser call.
+func (m *membership) existingUser(dbName, email, password string, role int) ([]byte, internal.Token, error) {
+	tok, err := datastore.FindTokenByEmail(dbName, email)
+	if err != nil {
+		return nil, internal.Token{}, err
+	} else if tok.Role != role {
+		return nil, internal.Token{}, internal.ErrEmailTaken
+	} else if err := bcrypt.CompareHashAndPassword([]byte(tok.Password), []byte(password)); err != nil {
+		return nil, internal.Token{}, internal.ErrEmailTaken
+	}
+
+	jwtBytes, err := signJWT(internal.UserToken{ID: tok.ID, Token: tok.Token}.String())
+	if err != nil {
+		return nil, internal.Token{}, err
+	}
+	return jwtBytes, tok, nil
+}
+
+// publishUserCreated sends a MsgTypeUserCreated event to the UserChannel of
+// the base and to the server-side functions triggered by it. The token is
+// only sent to the functions, see Command.ClientVisible.
+func (m *membership) publishUserCreated(conf internal.BaseConfig, tok internal.Token) error {
+	b, err := json.Marshal(internal.UserCreated{
+		ID:        tok.ID,
+		AccountID: tok.AccountID,
+		Email:     tok.Email,
+		Role:      tok.Role,
+	})
+	if err != nil {
+		return err
+	}
+
+	// the function runtime resolves the base from the token
+	token := internal.UserToken{ID: tok.ID, Token: tok.Token}.Key()
+	if err := m.volatile.SetTyped("base:"+token, conf); err != nil {
+		return err
+	}
+
+	msg := internal.Command{
+		Type:    internal.MsgTypeUserCreated,
+		Channel: internal.UserChannel(conf.ID),
+		Data:    string(b),
+		Token:   token,
+	}
+	return m.volatile.Publish(msg)
+}
+
+func (m *membership) createUser(dbName, accountID, email, password string, role int, label string) ([]byte, internal.Token, error) {
 	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, internal.Token{}, err
@@ -188,6 +794,7 @@ func (m *membership) createUser(dbName, accountID, email, password string, role
 		Token:     datastore.NewID(),
 		Password:  string(b),
 		Role:      role,
+		Label:     label,
 	}
 
 	tokID, err := datastore.CreateUserToken(dbName, tok)
@@ -197,10 +804,11 @@ func (m *membership) createUser(dbName, accountID, email, password string, role
 
 	tok.ID = tokID
 
-	token := fmt.Sprintf("%s|%s", tokID, tok.Token)
+	ut := internal.UserToken{ID: tokID, Token: tok.Token}
+	token := ut.Key()
 
-	// Get their JWT
-	jwtBytes, err := m.getJWT(token)
+	// Get their JWT, the clients get theirs from getJWT
+	jwtBytes, err := signJWT(ut.String())
 	if err != nil {
 		return nil, tok, err
 	}
@@ -212,7 +820,7 @@ func (m *membership) createUser(dbName, accountID, email, password string, role
 		Role:      role,
 		Token:     tok.Token,
 	}
-	if err := m.volatile.SetTyped(token, auth); err != nil {
+	if err := middleware.AuthTokens(m.volatile).SetAuth(token, auth); err != nil {
 		return nil, tok, err
 	}
 
@@ -307,6 +915,75 @@ func (m *membership) setRole(w http.ResponseWriter, r *http.Request) {
 	respond(w, http.StatusOK, true)
 }
 
+// promote gives the root role to the user with the email of the body.
+func (m *membership) promote(w http.ResponseWriter, r *http.Request) {
+	m.changeAdmin(w, r, true)
+}
+
+// demote moves the admin user with the email of the body back to the
+// default user role, the last admin of the base cannot be demoted.
+func (m *membership) demote(w http.ResponseWriter, r *http.Request) {
+	m.changeAdmin(w, r, false)
+}
+
+func (m *membership) changeAdmin(w http.ResponseWriter, r *http.Request, admin bool) {
+	conf, _, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, "invalid StaticBackend key", http.StatusUnauthorized)
+		return
+	}
+
+	var data = new(struct {
+		Email string `json:"email"`
+	})
+	if err := parseBody(r.Body, &data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tok, err := datastore.FindTokenByEmail(conf.Name, strings.ToLower(data.Email))
+	if err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	if err := m.setAdmin(conf.Name, tok, admin); errors.Is(err, internal.ErrLastAdmin) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, http.StatusOK, true)
+}
+
+// setAdmin gives tok the root role or the default user role. It returns
+// internal.ErrLastAdmin when tok is the only admin left.
+func (m *membership) setAdmin(dbName string, tok internal.Token, admin bool) error {
+	if admin == (tok.Role >= middleware.RootRole) {
+		return nil
+	}
+
+	if admin {
+		if err := datastore.SetUserRole(dbName, tok.Email, middleware.RootRole); err != nil {
+			return err
+		}
+	} else {
+		role := config.Current.Settings.DefaultUserRole
+		if err := datastore.DemoteUser(dbName, tok.Email, role, middleware.RootRole); err != nil {
+			return err
+		}
+	}
+
+	// the cached Auth still has the previous role
+	token := internal.UserToken{ID: tok.ID, Token: tok.Token}.Key()
+	if err := middleware.AuthTokens(m.volatile).DeleteAuth(token); err != nil {
+		log.Println("error removing the cached auth after a role change", err)
+	}
+	return nil
+}
+
 func (m *membership) setPassword(w http.ResponseWriter, r *http.Request) {
 	conf, a, err := middleware.Extract(r, true)
 	if err != nil || a.Role < 100 {
@@ -344,9 +1021,38 @@ func (m *membership) setPassword(w http.ResponseWriter, r *http.Request) {
 	respond(w, http.StatusOK, true)
 }
 
-func (m *membership) getJWT(token string) ([]byte, error) {
+// getJWT returns the JWT for token, session is the fingerprint of the
+// client it's bound to, see sessionOf. With MAX_TOKENS_PER_USER the JWT is
+// a session of the user, past the limit it fails with internal.ErrTokenLimit
+// or ends their oldest sessions, see TOKEN_LIMIT_POLICY.
+func (m *membership) getJWT(token, session string) ([]byte, error) {
+	pl := newJWTPayload(token, session)
+
+	if max := config.Current.Settings.MaxTokensPerUser; max > 0 {
+		ut, err := internal.ParseToken(token)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions := cache.NewSessionStore(m.volatile)
+		if err := sessions.Open(ut.Key(), pl.JWTID, pl.ExpirationTime.Time, max, config.Current.Settings.EvictTokens); err != nil {
+			return nil, err
+		}
+	}
+
+	return jwt.Sign(pl, internal.HashSecret())
+}
+
+// signJWT returns a JWT for token that's not a session of the user, it's
+// rejected while MAX_TOKENS_PER_USER is set. The JWTs sent to the clients
+// come from getJWT.
+func signJWT(token string) ([]byte, error) {
+	return jwt.Sign(newJWTPayload(token, ""), internal.HashSecret())
+}
+
+func newJWTPayload(token, session string) internal.JWTPayload {
 	now := time.Now()
-	pl := internal.JWTPayload{
+	return internal.JWTPayload{
 		Payload: jwt.Payload{
 			Issuer:         "StaticBackend",
 			ExpirationTime: jwt.NumericDate(now.Add(12 * time.Hour)),
@@ -354,11 +1060,34 @@ func (m *membership) getJWT(token string) ([]byte, error) {
 			IssuedAt:       jwt.NumericDate(now),
 			JWTID:          randStringRunes(32), // changed from primitive.NewObjectID
 		},
-		Token: token,
+		Token:   token,
+		Session: session,
 	}
+}
+
+// sessionOf returns the session fingerprint of the client of r, it's empty
+// unless the base conf binds its sessions.
+func sessionOf(conf internal.BaseConfig, r *http.Request) string {
+	return middleware.ClientOf(r).Fingerprint(conf.SessionBinding)
+}
 
-	return jwt.Sign(pl, internal.HashSecret)
+// getImpersonationJWT returns a short-lived JWT for token flagged as being
+// used by the root user rootEmail.
+func (m *membership) getImpersonationJWT(token, rootEmail, session string) ([]byte, error) {
+	now := time.Now()
+	pl := internal.JWTPayload{
+		Payload: jwt.Payload{
+			Issuer:         "StaticBackend",
+			ExpirationTime: jwt.NumericDate(now.Add(ImpersonationDuration)),
+			IssuedAt:       jwt.NumericDate(now),
+			JWTID:          randStringRunes(32),
+		},
+		Token:          token,
+		ImpersonatedBy: rootEmail,
+		Session:        session,
+	}
 
+	return jwt.Sign(pl, internal.HashSecret())
 }
 
 func (m *membership) sudoGetTokenFromAccountID(w http.ResponseWriter, r *http.Request) {
@@ -379,9 +1108,74 @@ func (m *membership) sudoGetTokenFromAccountID(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	token := fmt.Sprintf("%s|%s", tok.ID, tok.Token)
+	ut := internal.UserToken{ID: tok.ID, Token: tok.Token}
+	token := ut.Key()
+
+	jwtBytes, err := m.getJWT(ut.String(), sessionOf(conf, r))
+	if err != nil {
+		http.Error(w, err.Error(), credentialsErrorStatus(err))
+		return
+	}
+
+	auth := internal.Auth{
+		AccountID: tok.AccountID,
+		UserID:    tok.ID,
+		Email:     tok.Email,
+		Role:      tok.Role,
+		Token:     tok.Token,
+	}
+	if err := middleware.AuthTokens(m.volatile).SetAuth(token, auth); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, http.StatusOK, string(jwtBytes))
+}
 
-	jwtBytes, err := m.getJWT(token)
+// sudoImpersonate lets a root user obtain a token for another user of the
+// base. The resulting requests are flagged via Auth.ImpersonatedBy and the
+// impersonation is recorded, see Persister.ListImpersonations.
+func (m *membership) sudoImpersonate(w http.ResponseWriter, r *http.Request) {
+	conf, root, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var data = new(struct {
+		Email string `json:"email"`
+	})
+	if err := parseBody(r.Body, &data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data.Email = strings.ToLower(data.Email)
+
+	tok, err := datastore.FindTokenByEmail(conf.Name, data.Email)
+	if err != nil {
+		http.Error(w, "email not found", http.StatusNotFound)
+		return
+	}
+
+	// the impersonation is refused when it cannot be audited
+	now := time.Now()
+	imp := internal.Impersonation{
+		ImpersonatedBy: root.Email,
+		UserID:         tok.ID,
+		Email:          tok.Email,
+		Expires:        now.Add(ImpersonationDuration),
+		Created:        now,
+	}
+	if err := datastore.AddImpersonation(conf.Name, imp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ut := internal.UserToken{ID: tok.ID, Token: tok.Token}
+	token := ut.Key()
+
+	jwtBytes, err := m.getImpersonationJWT(ut.String(), root.Email, sessionOf(conf, r))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -394,7 +1188,11 @@ func (m *membership) sudoGetTokenFromAccountID(w http.ResponseWriter, r *http.Re
 		Role:      tok.Role,
 		Token:     tok.Token,
 	}
-	if err := m.volatile.SetTyped(token, auth); err != nil {
+	if err := middleware.AuthTokens(m.volatile).SetAuth(token, auth); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := m.volatile.SetTyped("base:"+token, conf); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
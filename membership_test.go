@@ -0,0 +1,797 @@
+package staticbackend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/config"
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+
+	"github.com/gbrlsnchs/jwt/v3"
+)
+
+func TestSudoImpersonate(t *testing.T) {
+	m := &membership{volatile: volatile}
+
+	data := new(struct {
+		Email string `json:"email"`
+	})
+	data.Email = userEmail
+
+	resp := dbReq(t, m.sudoImpersonate, "POST", "/sudo/impersonate", data, true)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+	defer resp.Body.Close()
+
+	var token string
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		t.Fatal(err)
+	}
+
+	recorded, err := datastore.ListImpersonations(dbName)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(recorded) == 0 || recorded[0].Email != userEmail || recorded[0].ImpersonatedBy != admEmail {
+		t.Errorf("expected the impersonation to be recorded got %v", recorded)
+	}
+
+	var auth internal.Auth
+	h := middleware.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, a, err := middleware.Extract(r, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		auth = a
+	}), middleware.WithDB(datastore, volatile), middleware.RequireAuth(datastore, volatile))
+
+	req := httptest.NewRequest("GET", "/db/tasks", nil)
+	req.Header.Set("SB-PUBLIC-KEY", pubKey)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, req)
+
+	if auth.Email != userEmail {
+		t.Errorf("expected auth email to be %s got %s", userEmail, auth.Email)
+	} else if auth.ImpersonatedBy != admEmail {
+		t.Errorf("expected impersonated by %s got %s", admEmail, auth.ImpersonatedBy)
+	} else if !auth.IsImpersonated() {
+		t.Errorf("expected auth to be flagged as impersonated")
+	}
+}
+
+func TestCreateAccountAndUserIdempotent(t *testing.T) {
+	conf, err := datastore.FindDatabase(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &publishRecorder{Volatilizer: volatile}
+	m := &membership{volatile: rec}
+
+	_, first, err := m.createAccountAndUser(conf, "retry-signup@test.com", userPassword, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a retry returns the same user without publishing it again
+	token, retried, err := m.createAccountAndUser(conf, "Retry-Signup@test.com", userPassword, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	} else if retried.ID != first.ID || retried.AccountID != first.AccountID || len(token) == 0 {
+		t.Errorf("expected the existing user %v got %v", first, retried)
+	} else if len(rec.msgs) != 1 {
+		t.Errorf("expected 1 user created event got %d", len(rec.msgs))
+	}
+
+	if _, _, err := m.createAccountAndUser(conf, "retry-signup@test.com", "another password", 0, ""); !errors.Is(err, internal.ErrEmailTaken) {
+		t.Errorf("expected ErrEmailTaken for another password got %v", err)
+	}
+	if _, _, err := m.createAccountAndUser(conf, "retry-signup@test.com", userPassword, 100, ""); !errors.Is(err, internal.ErrEmailTaken) {
+		t.Errorf("expected ErrEmailTaken for another role got %v", err)
+	}
+}
+
+type publishRecorder struct {
+	internal.Volatilizer
+	msgs []internal.Command
+}
+
+func (p *publishRecorder) Publish(msg internal.Command) error {
+	p.msgs = append(p.msgs, msg)
+	return nil
+}
+
+func TestCreateAccountAndUserPublishesUserCreated(t *testing.T) {
+	conf, err := datastore.FindDatabase(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &publishRecorder{Volatilizer: volatile}
+	m := &membership{volatile: rec}
+
+	_, tok, err := m.createAccountAndUser(conf, "signup-event@test.com", userPassword, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.msgs) != 1 {
+		t.Fatalf("expected 1 event got %d", len(rec.msgs))
+	}
+
+	msg := rec.msgs[0]
+	if msg.Type != internal.MsgTypeUserCreated || msg.Channel != internal.UserChannel(conf.ID) {
+		t.Errorf("unexpected event type %s on channel %s", msg.Type, msg.Channel)
+	}
+
+	var data internal.UserCreated
+	if err := json.Unmarshal([]byte(msg.Data), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := internal.UserCreated{ID: tok.ID, AccountID: tok.AccountID, Email: "signup-event@test.com", Role: 0}
+	if data != expected {
+		t.Errorf("expected payload %v got %v", expected, data)
+	}
+
+	// the admin user created with a base is not a signup
+	if _, _, err := m.createAccountAndUser(conf, "signup-admin@test.com", userPassword, 100, ""); err != nil {
+		t.Fatal(err)
+	} else if len(rec.msgs) != 1 {
+		t.Errorf("expected no event for the admin user, got %d events", len(rec.msgs))
+	}
+}
+
+func TestLoginHistory(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.LoginHistory = "2"
+	parseSettings(t)
+
+	m := &membership{volatile: volatile}
+
+	login := func() string {
+		b, err := json.Marshal(internal.Login{Email: userEmail, Password: userPassword})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest("POST", "/login", bytes.NewReader(b))
+		req.Header.Set("SB-PUBLIC-KEY", pubKey)
+		req.Header.Set("User-Agent", "login-history-test")
+		w := httptest.NewRecorder()
+
+		middleware.Chain(http.HandlerFunc(m.login), middleware.RequireActiveBase(datastore, volatile)).ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatal(w.Body.String())
+		}
+
+		var token string
+		if err := json.NewDecoder(w.Body).Decode(&token); err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	logins := func(token string) (lastLogin *time.Time, events []internal.LoginEvent) {
+		req := httptest.NewRequest("GET", "/account/logins", nil)
+		req.Header.Set("SB-PUBLIC-KEY", pubKey)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+
+		h := middleware.Chain(http.HandlerFunc(m.logins), middleware.RequireActiveBase(datastore, volatile), middleware.RequireAuth(datastore, volatile))
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatal(w.Body.String())
+		}
+
+		var data struct {
+			LastLogin *time.Time            `json:"lastLogin"`
+			Logins    []internal.LoginEvent `json:"logins"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&data); err != nil {
+			t.Fatal(err)
+		}
+		return data.LastLogin, data.Logins
+	}
+
+	token := login()
+	lastLogin, events := logins(token)
+	if len(events) == 0 || events[0].UserAgent != "login-history-test" {
+		t.Fatalf("expected the login to be recorded got %v", events)
+	} else if lastLogin == nil || !lastLogin.Equal(events[0].Created) {
+		t.Errorf("expected the last login to be the most recent entry got %v", lastLogin)
+	}
+
+	for i := 0; i < 3; i++ {
+		token = login()
+	}
+
+	if _, events := logins(token); len(events) != 2 {
+		t.Errorf("expected the history to be capped to 2 got %d", len(events))
+	}
+}
+
+func TestSessionBindingLogin(t *testing.T) {
+	base, err := datastore.FindDatabaseByKey(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := datastore.SetSessionBinding(base.ID, internal.SessionBindingUserAgent); err != nil {
+		t.Fatal(err)
+	}
+	middleware.Bases.Invalidate(pubKey)
+	defer func() {
+		datastore.SetSessionBinding(base.ID, internal.SessionBindingNone)
+		middleware.Bases.Invalidate(pubKey)
+	}()
+
+	m := &membership{volatile: volatile}
+
+	b, err := json.Marshal(internal.Login{Email: userEmail, Password: userPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/login", bytes.NewReader(b))
+	req.Header.Set("SB-PUBLIC-KEY", pubKey)
+	req.Header.Set("User-Agent", "bound-browser")
+	w := httptest.NewRecorder()
+
+	middleware.Chain(http.HandlerFunc(m.login), middleware.RequireActiveBase(datastore, volatile)).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatal(w.Body.String())
+	}
+
+	var token string
+	if err := json.NewDecoder(w.Body).Decode(&token); err != nil {
+		t.Fatal(err)
+	}
+
+	h := middleware.Chain(http.HandlerFunc(m.logins), middleware.RequireActiveBase(datastore, volatile), middleware.RequireAuth(datastore, volatile))
+
+	tests := []struct {
+		userAgent string
+		status    int
+	}{
+		{"bound-browser", http.StatusOK},
+		{"another-browser", http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", "/account/logins", nil)
+		req.Header.Set("SB-PUBLIC-KEY", pubKey)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("User-Agent", tc.userAgent)
+		w := httptest.NewRecorder()
+
+		h.ServeHTTP(w, req)
+		if w.Code != tc.status {
+			t.Errorf("%s: expected status %d got %d: %s", tc.userAgent, tc.status, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestMe(t *testing.T) {
+	m := &membership{volatile: volatile}
+
+	tok, err := datastore.FindTokenByEmail(dbName, admEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := dbReq(t, m.me, "GET", "/me", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	var me meResponse
+	if err := parseBody(resp.Body, &me); err != nil {
+		t.Fatal(err)
+	}
+
+	if me.UserID != tok.ID || me.AccountID != tok.AccountID {
+		t.Errorf("expected user %s of account %s got %s of %s", tok.ID, tok.AccountID, me.UserID, me.AccountID)
+	} else if me.Email != admEmail || me.Role != tok.Role {
+		t.Errorf("expected %s with role %d got %s with %d", admEmail, tok.Role, me.Email, me.Role)
+	} else if me.Base.Name != dbName || me.Base.PublicKey != pubKey {
+		t.Errorf("expected base %s with key %s got %v", dbName, pubKey, me.Base)
+	} else if len(me.ImpersonatedBy) > 0 {
+		t.Errorf("expected a normal session got impersonated by %s", me.ImpersonatedBy)
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	defer func(m internal.Mailer) { emailer = m }(emailer)
+
+	mm := &mockMailer{}
+	emailer = mm
+
+	m := &membership{volatile: volatile}
+
+	tok, err := datastore.FindTokenByEmail(dbName, userEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwtBytes, user, err := m.createUser(dbName, tok.AccountID, "change-me@test.com", userPassword, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(email string) *httptest.ResponseRecorder {
+		b, err := json.Marshal(map[string]string{"email": email})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest("POST", "/me/email", bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("SB-PUBLIC-KEY", pubKey)
+		req.Header.Set("Authorization", "Bearer "+string(jwtBytes))
+		w := httptest.NewRecorder()
+
+		h := middleware.Chain(http.HandlerFunc(m.changeEmail), middleware.RequireActiveBase(datastore, volatile), middleware.RequireAuth(datastore, volatile))
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	confirm := func(link string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", link, nil)
+		w := httptest.NewRecorder()
+
+		middleware.Chain(http.HandlerFunc(m.confirmEmailChange), middleware.RequireActiveBase(datastore, volatile)).ServeHTTP(w, req)
+		return w
+	}
+
+	// the new email is taken
+	if w := request(userEmail); w.Code != http.StatusConflict {
+		t.Errorf("expected status 409 for a taken email got %d: %s", w.Code, w.Body.String())
+	} else if len(mm.sent) > 0 {
+		t.Errorf("expected no email sent for a taken email")
+	}
+
+	// happy path, the email changes once the link is opened
+	if w := request("Changed@Test.com"); w.Code != http.StatusOK {
+		t.Fatal(w.Body.String())
+	} else if len(mm.sent) != 1 || mm.sent[0].To != "changed@test.com" {
+		t.Fatalf("expected the confirmation sent to the new email got %v", mm.sent)
+	}
+
+	matches := regexp.MustCompile(`href="([^"]+)"`).FindStringSubmatch(mm.sent[0].HTMLBody)
+	if len(matches) != 2 {
+		t.Fatalf("expected a confirmation link in %s", mm.sent[0].HTMLBody)
+	}
+	link := html.UnescapeString(matches[1])
+
+	if _, err := datastore.FindTokenByEmail(dbName, "change-me@test.com"); err != nil {
+		t.Errorf("expected the email to stay the same until confirmed: %v", err)
+	}
+
+	if w := confirm(link); w.Code != http.StatusOK {
+		t.Fatal(w.Body.String())
+	}
+
+	changed, err := datastore.FindTokenByEmail(dbName, "changed@test.com")
+	if err != nil {
+		t.Fatal(err)
+	} else if changed.ID != user.ID {
+		t.Errorf("expected user %s to have the new email got %s", user.ID, changed.ID)
+	}
+
+	// an expired confirmation is rejected
+	pl := internal.EmailChangePayload{
+		Payload: jwt.Payload{
+			ExpirationTime: jwt.NumericDate(time.Now().Add(-time.Minute)),
+			IssuedAt:       jwt.NumericDate(time.Now().Add(-emailChangeDuration)),
+		},
+		Base:     dbName,
+		TokenID:  user.ID,
+		Email:    "changed@test.com",
+		NewEmail: "expired@test.com",
+	}
+	expired, err := jwt.Sign(pl, internal.HashSecret())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w := confirm("/me/email/confirm?sbpk=" + pubKey + "&token=" + string(expired)); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an expired link got %d: %s", w.Code, w.Body.String())
+	} else if _, err := datastore.FindTokenByEmail(dbName, "expired@test.com"); err == nil {
+		t.Errorf("expected the email not to change with an expired link")
+	}
+}
+
+func TestNewDeviceLoginAlert(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+	defer func(m internal.Mailer) { emailer = m }(emailer)
+
+	config.Current.LoginAlerts = "yes"
+
+	mm := &mockMailer{}
+	emailer = mm
+
+	m := &membership{volatile: volatile}
+
+	tok, err := datastore.FindTokenByEmail(dbName, userEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwtBytes, _, err := m.createUser(dbName, tok.AccountID, "login-alerts@test.com", userPassword, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login := func(ip string) {
+		b, err := json.Marshal(internal.Login{Email: "login-alerts@test.com", Password: userPassword})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest("POST", "/login", bytes.NewReader(b))
+		req.Header.Set("SB-PUBLIC-KEY", pubKey)
+		req.Header.Set("CF-IPCountry", "CA")
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+
+		middleware.Chain(http.HandlerFunc(m.login), middleware.RequireActiveBase(datastore, volatile)).ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatal(w.Body.String())
+		}
+	}
+
+	// the first login is not a new device
+	login("10.1.0.1")
+	if len(mm.sent) != 0 {
+		t.Fatalf("expected no alert for the first login got %d", len(mm.sent))
+	}
+
+	login("10.1.0.2")
+	if len(mm.sent) != 1 {
+		t.Fatalf("expected an alert for a first-seen IP got %d", len(mm.sent))
+	} else if mm.sent[0].To != "login-alerts@test.com" || !strings.Contains(mm.sent[0].TextBody, "10.1.0.2") {
+		t.Errorf("unexpected alert %v", mm.sent[0])
+	}
+
+	login("10.1.0.1")
+	if len(mm.sent) != 1 {
+		t.Errorf("expected no alert for a known IP got %d", len(mm.sent))
+	}
+
+	req := httptest.NewRequest("POST", "/account/loginalerts", strings.NewReader(`{"enabled": false}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("SB-PUBLIC-KEY", pubKey)
+	req.Header.Set("Authorization", "Bearer "+string(jwtBytes))
+	w := httptest.NewRecorder()
+
+	h := middleware.Chain(http.HandlerFunc(m.loginAlerts), middleware.RequireActiveBase(datastore, volatile), middleware.RequireAuth(datastore, volatile))
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatal(w.Body.String())
+	} else if strings.TrimSpace(w.Body.String()) != `{"enabled":false}` {
+		t.Errorf("expected the alerts to be disabled got %s", w.Body.String())
+	}
+
+	login("10.1.0.3")
+	if len(mm.sent) != 1 {
+		t.Errorf("expected no alert once opted out got %d", len(mm.sent))
+	}
+}
+
+func TestRegisterDefaultUserRole(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.DefaultUserRole = "5"
+	parseSettings(t)
+
+	m := &membership{volatile: volatile}
+
+	// an elevated role sent by the client is ignored
+	data := map[string]interface{}{
+		"email":    "default-role@test.com",
+		"password": userPassword,
+		"role":     100,
+	}
+	resp := dbReq(t, m.register, "POST", "/register", data)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+	resp.Body.Close()
+
+	tok, err := datastore.FindTokenByEmail(dbName, "default-role@test.com")
+	if err != nil {
+		t.Fatal(err)
+	} else if tok.Role != 5 {
+		t.Errorf("expected the configured default role 5 got %d", tok.Role)
+	}
+}
+
+func TestPromoteDemote(t *testing.T) {
+	m := &membership{volatile: volatile}
+
+	data := map[string]string{"email": userEmail}
+
+	resp := dbReq(t, m.promote, "POST", "/sudo/promote", data, true)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+	resp.Body.Close()
+
+	if tok, err := datastore.FindTokenByEmail(dbName, userEmail); err != nil {
+		t.Fatal(err)
+	} else if tok.Role != middleware.RootRole {
+		t.Errorf("expected the promoted user to be root got %d", tok.Role)
+	}
+
+	resp = dbReq(t, m.demote, "POST", "/sudo/demote", data, true)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+	resp.Body.Close()
+
+	if tok, err := datastore.FindTokenByEmail(dbName, userEmail); err != nil {
+		t.Fatal(err)
+	} else if tok.Role != 0 {
+		t.Errorf("expected the demoted user to have the default role got %d", tok.Role)
+	}
+
+	resp = dbReq(t, m.promote, "POST", "/sudo/promote", map[string]string{"email": "nobody@test.com"}, true)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown user got %d", resp.StatusCode)
+	}
+}
+
+func TestDemoteLastAdmin(t *testing.T) {
+	cus, err := datastore.CreateCustomer(internal.Customer{Email: fmt.Sprintf("lastadmin-%d@test.com", time.Now().UnixNano())})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf, err := datastore.CreateBase(internal.BaseConfig{
+		CustomerID: cus.ID,
+		Name:       fmt.Sprintf("lastadmin%d", time.Now().UnixNano()),
+		IsActive:   true,
+		Created:    time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &membership{volatile: volatile}
+
+	_, first, err := m.createAccountAndUser(conf, "first-admin@test.com", userPassword, middleware.RootRole, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.setAdmin(conf.Name, first, false); !errors.Is(err, internal.ErrLastAdmin) {
+		t.Fatalf("expected internal.ErrLastAdmin got %v", err)
+	}
+
+	_, second, err := m.createAccountAndUser(conf, "second-admin@test.com", userPassword, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	} else if err := m.setAdmin(conf.Name, second, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.setAdmin(conf.Name, first, false); err != nil {
+		t.Fatalf("expected the first admin to be demoted once another admin exists got %v", err)
+	}
+
+	second, err = datastore.FindTokenByEmail(conf.Name, "second-admin@test.com")
+	if err != nil {
+		t.Fatal(err)
+	} else if err := m.setAdmin(conf.Name, second, false); !errors.Is(err, internal.ErrLastAdmin) {
+		t.Errorf("expected the remaining admin not to be demoted got %v", err)
+	}
+}
+
+func TestListAccountTokens(t *testing.T) {
+	conf, err := datastore.FindDatabase(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &membership{volatile: volatile}
+
+	token, owner, err := m.createAccountAndUser(conf, "token-labels@test.com", userPassword, middleware.RootRole, "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ciToken, ci, err := m.createUser(dbName, owner.AccountID, "token-labels-ci@test.com", userPassword, 0, "ci-deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(token []byte) []tokenInfo {
+		req := httptest.NewRequest("GET", "/account/tokens", nil)
+		req.Header.Set("SB-PUBLIC-KEY", pubKey)
+		req.Header.Set("Authorization", "Bearer "+string(token))
+		w := httptest.NewRecorder()
+
+		h := middleware.Chain(http.HandlerFunc(m.tokens), middleware.RequireActiveBase(datastore, volatile), middleware.RequireAuth(datastore, volatile))
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatal(w.Body.String())
+		} else if strings.Contains(w.Body.String(), owner.Token) {
+			t.Errorf("expected the token secrets to not be listed")
+		}
+
+		var toks []tokenInfo
+		if err := json.NewDecoder(w.Body).Decode(&toks); err != nil {
+			t.Fatal(err)
+		}
+		return toks
+	}
+
+	// the account admin lists all the tokens of the account
+	if toks := list(token); len(toks) != 2 {
+		t.Fatalf("expected 2 tokens got %d", len(toks))
+	} else if toks[0].ID != owner.ID || toks[0].Label != "laptop" || toks[1].Label != "ci-deploy" {
+		t.Errorf("unexpected tokens %v", toks)
+	}
+
+	// the other users only list their own
+	if toks := list(ciToken); len(toks) != 1 || toks[0].ID != ci.ID {
+		t.Errorf("expected only the user's own token got %v", toks)
+	}
+}
+
+func TestTokenLimit(t *testing.T) {
+	conf, err := datastore.FindDatabase(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	m := &membership{volatile: volatile}
+
+	email := "token-limit-" + datastore.NewID() + "@test.com"
+	if _, _, err := m.createAccountAndUser(conf, email, userPassword, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Current.MaxTokensPerUser = "2"
+	parseSettings(t)
+
+	login := func() *httptest.ResponseRecorder {
+		b, err := json.Marshal(internal.Login{Email: email, Password: userPassword})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest("POST", "/login/token", bytes.NewReader(b))
+		req.Header.Set("SB-PUBLIC-KEY", pubKey)
+		w := httptest.NewRecorder()
+
+		middleware.Chain(http.HandlerFunc(m.loginToken), middleware.RequireActiveBase(datastore, volatile)).ServeHTTP(w, req)
+		return w
+	}
+
+	valid := func(token string) bool {
+		ctx := context.WithValue(context.Background(), middleware.ContextBase, conf)
+		_, err := middleware.ValidateAuthKey(datastore, volatile, ctx, token)
+		return err == nil
+	}
+
+	var tokens []string
+	for i := 0; i < 2; i++ {
+		w := login()
+		if w.Code != http.StatusOK {
+			t.Fatal(w.Body.String())
+		}
+
+		var it issuedToken
+		if err := json.NewDecoder(w.Body).Decode(&it); err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, it.Token)
+	}
+
+	config.Current.TokenLimitPolicy = "reject"
+	parseSettings(t)
+	if w := login(); w.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 past the limit got %d: %s", w.Code, w.Body.String())
+	}
+
+	config.Current.TokenLimitPolicy = "evict"
+	parseSettings(t)
+	if w := login(); w.Code != http.StatusOK {
+		t.Fatal(w.Body.String())
+	}
+
+	if valid(tokens[0]) {
+		t.Errorf("expected the oldest session to be ended")
+	} else if !valid(tokens[1]) {
+		t.Errorf("expected the other session to be valid")
+	}
+
+	// ending a session keeps the user
+	if _, err := datastore.FindTokenByEmail(dbName, email); err != nil {
+		t.Errorf("expected the user to be kept got %v", err)
+	}
+}
+
+func TestLoginToken(t *testing.T) {
+	m := &membership{volatile: volatile}
+
+	login := func(key, email, password string) *httptest.ResponseRecorder {
+		b, err := json.Marshal(internal.Login{Email: email, Password: password})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest("POST", "/login/token", bytes.NewReader(b))
+		req.Header.Set("SB-PUBLIC-KEY", key)
+		w := httptest.NewRecorder()
+
+		middleware.Chain(http.HandlerFunc(m.loginToken), middleware.RequireActiveBase(datastore, volatile)).ServeHTTP(w, req)
+		return w
+	}
+
+	w := login(pubKey, strings.ToUpper(userEmail), userPassword)
+	if w.Code != http.StatusOK {
+		t.Fatal(w.Body.String())
+	}
+
+	var it issuedToken
+	if err := json.NewDecoder(w.Body).Decode(&it); err != nil {
+		t.Fatal(err)
+	}
+
+	var pl internal.JWTPayload
+	if _, err := jwt.Verify([]byte(it.Token), internal.HashSecret(), &pl); err != nil {
+		t.Fatalf("expected a valid JWT got %v", err)
+	} else if !it.Expires.Equal(pl.ExpirationTime.Time) || !it.Expires.After(time.Now()) {
+		t.Errorf("expected the expiry of the JWT got %v", it.Expires)
+	} else if it.User.Email != userEmail || len(it.User.ID) == 0 || len(it.User.AccountID) == 0 || it.User.Role != 0 {
+		t.Errorf("expected the user info got %+v", it.User)
+	}
+
+	if w := login(pubKey, userEmail, "wrong password"); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: expected status 401 got %d", w.Code)
+	}
+	if w := login(pubKey, "nobody-"+datastore.NewID()+"@test.com", userPassword); w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown email: expected status 401 got %d", w.Code)
+	}
+
+	cus, err := datastore.CreateCustomer(internal.Customer{Email: fmt.Sprintf("logintoken-%d@test.com", time.Now().UnixNano())})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inactive, err := datastore.CreateBase(internal.BaseConfig{
+		CustomerID: cus.ID,
+		Name:       fmt.Sprintf("logintoken%d", time.Now().UnixNano()),
+		IsActive:   false,
+		Created:    time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w := login(inactive.ID, userEmail, userPassword); w.Code != http.StatusForbidden {
+		t.Errorf("inactive account: expected status 403 got %d", w.Code)
+	} else if !strings.Contains(w.Body.String(), internal.ErrInactiveAccount.Error()) {
+		t.Errorf("expected the inactive account error got %s", w.Body.String())
+	}
+}
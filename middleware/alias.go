@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ResolveAliases rewrites the collection of the /db/{alias}/... and
+// /query/{alias} paths to the public collection of the alias in the base's
+// PublicAliases. It must run after RequireActiveBase and before RequireAuth
+// so anonymous requests are allowed on the collection the alias resolves
+// to.
+func ResolveAliases() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conf, err := BaseFromContext(r.Context())
+			if err != nil {
+				http.Error(w, "invalid StaticBackend key", http.StatusUnauthorized)
+				return
+			}
+
+			col, ok := conf.PublicAliases[collection(r.URL.Path)]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 3)
+			parts[1] = col
+
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = "/" + strings.Join(parts, "/")
+			r2.URL.RawPath = ""
+
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestResolveAliases(t *testing.T) {
+	var path string
+	var auth internal.Auth
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		auth, _ = r.Context().Value(ContextAuth).(internal.Auth)
+	}), ResolveAliases(), RequireAuth(nil, nil))
+
+	aliased := internal.BaseConfig{ID: "aliased", PublicAliases: map[string]string{"posts": "pub_posts"}}
+	other := internal.BaseConfig{ID: "other"}
+
+	tests := []struct {
+		name     string
+		conf     internal.BaseConfig
+		path     string
+		expected string
+		status   int
+	}{
+		{"list alias", aliased, "/db/posts", "/db/pub_posts", http.StatusOK},
+		{"get alias", aliased, "/db/posts/123", "/db/pub_posts/123", http.StatusOK},
+		{"query alias", aliased, "/query/posts", "/query/pub_posts", http.StatusOK},
+		{"public collection", aliased, "/db/pub_posts", "/db/pub_posts", http.StatusOK},
+		{"private collection", aliased, "/db/tasks", "", http.StatusUnauthorized},
+		{"alias of another base", other, "/db/posts", "", http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		path, auth = "", internal.Auth{}
+
+		req := httptest.NewRequest("GET", tc.path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), ContextBase, tc.conf))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != tc.status {
+			t.Errorf("%s: expected status %d got %d", tc.name, tc.status, w.Code)
+		} else if path != tc.expected {
+			t.Errorf("%s: expected path %s got %s", tc.name, tc.expected, path)
+		} else if tc.status == http.StatusOK && auth.AccountID != PublicAccountID {
+			t.Errorf("%s: expected the public auth got %v", tc.name, auth)
+		}
+	}
+}
@@ -2,10 +2,14 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/staticbackendhq/core/cache"
 	"github.com/staticbackendhq/core/internal"
 
 	"github.com/gbrlsnchs/jwt/v3"
@@ -13,20 +17,56 @@ import (
 
 const (
 	RootRole = 100
+
+	// PublicAccountID is the account of anonymous requests to public
+	// collections.
+	PublicAccountID = "public_repo_called"
+)
+
+var (
+	// ErrMissingPublicKey is returned when the request was not resolved to a
+	// base, the SB-PUBLIC-KEY header is missing.
+	ErrMissingPublicKey = errors.New("missing StaticBackend public key, set the SB-PUBLIC-KEY header")
+	// ErrInvalidToken is returned when the JWT in the Authorization header
+	// fails verification.
+	ErrInvalidToken = errors.New("invalid authentication token")
 )
 
+// APIKeyHeader is accepted as an alternative to the Authorization header,
+// it holds the token without the "Bearer " scheme. Empty disables it.
+var APIKeyHeader = "X-API-Key"
+
+// Tokens caches the Auth of validated tokens. When nil the shared cache is
+// used, see AuthTokens.
+var Tokens internal.TokenStore
+
+// AuthTokens returns the configured TokenStore or one backed by volatile.
+func AuthTokens(volatile internal.PubSuber) internal.TokenStore {
+	if Tokens != nil {
+		return Tokens
+	}
+	return cache.NewVolatileTokenStore(volatile)
+}
+
 func RequireAuth(datastore internal.Persister, volatile internal.PubSuber) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			key := r.Header.Get("Authorization")
-
-			if len(key) == 0 {
+			key, err := authToken(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			} else if len(key) == 0 {
 				// if they requested a public repo we let them continue
 				// to next security check.
 				if strings.HasPrefix(r.URL.Path, "/db/pub_") || strings.HasPrefix(r.URL.Path, "/query/pub_") {
+					if conf, err := BaseFromContext(r.Context()); err == nil && !conf.FeatureEnabled(internal.FeaturePublicCollections) {
+						http.Error(w, FeatureDisabled(internal.FeaturePublicCollections), http.StatusForbidden)
+						return
+					}
+
 					a := internal.Auth{
-						AccountID: "public_repo_called",
-						UserID:    "public_repo_called",
+						AccountID: PublicAccountID,
+						UserID:    PublicAccountID,
 						Email:     "",
 						Role:      0,
 						Token:     "pub",
@@ -41,21 +81,13 @@ func RequireAuth(datastore internal.Persister, volatile internal.PubSuber) Middl
 
 				http.Error(w, "missing authorization HTTP header", http.StatusUnauthorized)
 				return
-			} else if !strings.HasPrefix(key, "Bearer ") {
-				http.Error(w,
-					fmt.Sprintf("invalid authorization HTTP header, should be: Bearer your-token, but we got %s", key),
-					http.StatusBadRequest,
-				)
-				return
 			}
 
-			key = strings.Replace(key, "Bearer ", "", -1)
-
 			ctx := r.Context()
 
 			auth, err := ValidateAuthKey(datastore, volatile, ctx, key)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				http.Error(w, err.Error(), authErrorStatus(err))
 				return
 			}
 
@@ -66,30 +98,74 @@ func RequireAuth(datastore internal.Persister, volatile internal.PubSuber) Middl
 	}
 }
 
+// authToken returns the token from the "Authorization: Bearer" header or
+// from the APIKeyHeader. An empty token means none were sent.
+func authToken(r *http.Request) (string, error) {
+	if key := r.Header.Get("Authorization"); len(key) > 0 {
+		if !strings.HasPrefix(key, "Bearer ") {
+			return "", fmt.Errorf("invalid authorization HTTP header, should be: Bearer your-token, but we got %s", key)
+		}
+		return strings.TrimPrefix(key, "Bearer "), nil
+	}
+
+	if len(APIKeyHeader) > 0 {
+		return r.Header.Get(APIKeyHeader), nil
+	}
+	return "", nil
+}
+
+// authErrorStatus returns the HTTP status for a ValidateAuthKey error.
+func authErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrMissingPublicKey):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrInvalidToken):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusBadRequest
+	}
+}
+
 func ValidateAuthKey(datastore internal.Persister, volatile internal.PubSuber, ctx context.Context, key string) (internal.Auth, error) {
 	a := internal.Auth{}
 
+	conf, err := BaseFromContext(ctx)
+	if err != nil {
+		return a, ErrMissingPublicKey
+	}
+
 	var pl internal.JWTPayload
-	if _, err := jwt.Verify([]byte(key), internal.HashSecret, &pl); err != nil {
-		return a, fmt.Errorf("could not verify your authentication token: %s", err.Error())
+	if _, err := jwt.Verify([]byte(key), internal.HashSecret(), &pl); err != nil {
+		return a, fmt.Errorf("%w, could not verify it: %v", ErrInvalidToken, err)
 	}
 
-	conf, ok := ctx.Value(ContextBase).(internal.BaseConfig)
-	if !ok {
-		return a, fmt.Errorf("invalid StaticBackend public token")
+	// impersonation tokens are short-lived and must not outlive their expiration
+	if len(pl.ImpersonatedBy) > 0 {
+		if err := jwt.ExpirationTimeValidator(time.Now())(&pl.Payload); err != nil {
+			return a, fmt.Errorf("%w, impersonation token expired", ErrInvalidToken)
+		}
 	}
 
-	var auth internal.Auth
-	if err := volatile.GetTyped(pl.Token, &auth); err == nil {
-		return auth, nil
+	if !validSession(ctx, conf, pl) {
+		return a, fmt.Errorf("%w, it was issued to another client", ErrInvalidToken)
 	}
 
-	parts := strings.Split(key, "|")
-	if len(parts) != 2 {
-		return a, fmt.Errorf("invalid authentication token")
+	ut, err := internal.ParseToken(pl.Token)
+	if err != nil {
+		return a, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	} else if !openSession(volatile, ut.Key(), pl) {
+		return a, fmt.Errorf("%w, its session ended", ErrInvalidToken)
 	}
 
-	token, err := datastore.FindToken(conf.Name, parts[0], parts[1])
+	tokens := AuthTokens(volatile)
+	if auth, err := tokens.GetAuth(ut.Key()); err == nil {
+		atomic.AddInt64(&authCacheHits, 1)
+		auth.ImpersonatedBy = pl.ImpersonatedBy
+		return auth, nil
+	}
+	atomic.AddInt64(&authCacheMisses, 1)
+
+	token, err := datastore.FindToken(conf.Name, ut.ID, ut.Token)
 	if err != nil {
 		return a, fmt.Errorf("error retrieving your token: %s", err.Error())
 	}
@@ -107,48 +183,45 @@ func ValidateAuthKey(datastore internal.Persister, volatile internal.PubSuber, c
 		Token:     token.Token,
 		Plan:      cus.Plan,
 	}
-	if err := volatile.SetTyped(pl.Token, a); err != nil {
+	if err := tokens.SetAuth(ut.Key(), a); err != nil {
 		return a, err
 	}
 
 	// set base:token useful when executing pubsub event message / function
-	if err := volatile.SetTyped("base:"+pl.Token, conf); err != nil {
+	if err := volatile.SetTyped("base:"+ut.Key(), conf); err != nil {
 		return a, err
 	}
 
+	a.ImpersonatedBy = pl.ImpersonatedBy
 	return a, nil
 }
 
 func RequireRoot(datastore internal.Persister) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			key := r.Header.Get("Authorization")
+			key, err := authToken(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 
 			// we check if the token is in a cookie (used from UI)
 			if len(key) == 0 {
 				ck, err := r.Cookie("token")
 				if err == nil || ck != nil {
-					key = fmt.Sprintf("Bearer %s", ck.Value)
+					key = ck.Value
 				}
 			}
 
 			if len(key) == 0 {
 				http.Error(w, "missing authorization HTTP header", http.StatusUnauthorized)
 				return
-			} else if strings.HasPrefix(key, "Bearer ") == false {
-				http.Error(w,
-					fmt.Sprintf("invalid authorization HTTP header, should be: Bearer your-token, but we got %s", key),
-					http.StatusBadRequest,
-				)
-				return
 			}
 
-			key = strings.Replace(key, "Bearer ", "", -1)
-
 			ctx := r.Context()
-			conf, ok := ctx.Value(ContextBase).(internal.BaseConfig)
-			if !ok {
-				http.Error(w, "invalid StaticBackend public key", http.StatusBadRequest)
+			conf, err := BaseFromContext(ctx)
+			if err != nil {
+				http.Error(w, ErrMissingPublicKey.Error(), http.StatusBadRequest)
 				return
 			}
 
@@ -176,16 +249,12 @@ func RequireRoot(datastore internal.Persister) Middleware {
 func ValidateRootToken(datastore internal.Persister, base, token string) (internal.Token, error) {
 	tok := internal.Token{}
 
-	parts := strings.Split(token, "|")
-	if len(parts) != 3 {
-		return tok, fmt.Errorf("invalid root token")
+	rt, err := internal.ParseRootToken(token)
+	if err != nil {
+		return tok, fmt.Errorf("invalid root token: %v", err)
 	}
 
-	id := parts[0]
-	acctID := parts[1]
-	token = parts[2]
-
-	tok, err := datastore.FindRootToken(base, id, acctID, token)
+	tok, err = datastore.FindRootToken(base, rt.ID, rt.AccountID, rt.Token)
 	if err != nil {
 		return tok, err
 	} else if tok.Role < RootRole {
@@ -0,0 +1,380 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/cache"
+	"github.com/staticbackendhq/core/config"
+	"github.com/staticbackendhq/core/database/memory"
+	"github.com/staticbackendhq/core/internal"
+
+	"github.com/gbrlsnchs/jwt/v3"
+)
+
+func signToken(t *testing.T, token string) string {
+	now := time.Now()
+	pl := internal.JWTPayload{
+		Payload: jwt.Payload{
+			Issuer:         "StaticBackend",
+			ExpirationTime: jwt.NumericDate(now.Add(12 * time.Hour)),
+			IssuedAt:       jwt.NumericDate(now),
+		},
+		Token: token,
+	}
+
+	b, err := jwt.Sign(pl, internal.HashSecret())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestValidateAuthKeyUsesConfigSecret(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	volatile := cache.NewDevCache()
+	datastore := memory.New(volatile.PublishDocument)
+
+	conf := internal.BaseConfig{ID: "unittest", Name: "unittest", IsActive: true}
+	ctx := context.WithValue(context.Background(), ContextBase, conf)
+
+	token := "tokid|tokvalue"
+	auth := internal.Auth{
+		AccountID: "acctid",
+		UserID:    "tokid",
+		Email:     "unit@test.com",
+		Token:     "tokvalue",
+	}
+	if err := volatile.SetTyped(token, auth); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Current.JWTSecret = "first-secret-set-programmatically-in-test"
+	key := signToken(t, token)
+
+	a, err := ValidateAuthKey(datastore, volatile, ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	} else if a.Email != auth.Email {
+		t.Errorf("expected email %s got %s", auth.Email, a.Email)
+	}
+
+	// changing the secret must invalidate tokens signed with the old one
+	config.Current.JWTSecret = "second-secret-set-programmatically-in-test"
+	if _, err := ValidateAuthKey(datastore, volatile, ctx, key); err == nil {
+		t.Error("expected token signed with previous secret to be rejected")
+	}
+
+	key = signToken(t, token)
+	if _, err := ValidateAuthKey(datastore, volatile, ctx, key); err != nil {
+		t.Errorf("expected token signed with the new secret to be valid, got %v", err)
+	}
+}
+
+func TestValidateAuthKeyTokenStores(t *testing.T) {
+	defer func(ts internal.TokenStore) { Tokens = ts }(Tokens)
+
+	volatile := cache.NewDevCache()
+	datastore := memory.New(volatile.PublishDocument)
+
+	conf := internal.BaseConfig{ID: "unittest", Name: "unittest", IsActive: true}
+	ctx := context.WithValue(context.Background(), ContextBase, conf)
+
+	stores := map[string]internal.TokenStore{
+		"memory": cache.NewMemoryTokenStore(10),
+		"redis":  cache.NewVolatileTokenStore(cache.NewDevCache()),
+	}
+
+	for name, store := range stores {
+		Tokens = store
+
+		token := "tokid|" + name
+		auth := internal.Auth{
+			AccountID: "acctid",
+			UserID:    "tokid",
+			Email:     name + "@test.com",
+			Token:     name,
+		}
+
+		key := signToken(t, token)
+		if _, err := ValidateAuthKey(datastore, volatile, ctx, key); err == nil {
+			t.Errorf("%s: expected unknown token to be rejected", name)
+		}
+
+		if err := AuthTokens(volatile).SetAuth(token, auth); err != nil {
+			t.Fatal(err)
+		}
+
+		a, err := ValidateAuthKey(datastore, volatile, ctx, key)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if a.Email != auth.Email {
+			t.Errorf("%s: expected email %s got %s", name, auth.Email, a.Email)
+		}
+	}
+}
+
+func TestValidateAuthKeyTokenVersions(t *testing.T) {
+	volatile := cache.NewDevCache()
+	datastore := memory.New(volatile.PublishDocument)
+
+	conf := internal.BaseConfig{ID: "unittest", Name: "unittest", IsActive: true}
+	ctx := context.WithValue(context.Background(), ContextBase, conf)
+
+	ut := internal.UserToken{ID: "tokid", Token: "tokvalue"}
+	auth := internal.Auth{AccountID: "acctid", UserID: ut.ID, Email: "unit@test.com", Token: ut.Token}
+	if err := AuthTokens(volatile).SetAuth(ut.Key(), auth); err != nil {
+		t.Fatal(err)
+	}
+
+	// tokens issued before and after the migration share the cached auth
+	for _, version := range []int{internal.TokenV1, internal.TokenV2} {
+		key := signToken(t, ut.Format(version))
+
+		a, err := ValidateAuthKey(datastore, volatile, ctx, key)
+		if err != nil {
+			t.Errorf("version %d: %v", version, err)
+		} else if a.Email != auth.Email {
+			t.Errorf("version %d: expected email %s got %s", version, auth.Email, a.Email)
+		}
+	}
+}
+
+func TestRequireAuthSchemes(t *testing.T) {
+	defer func(ts internal.TokenStore) { Tokens = ts }(Tokens)
+	Tokens = cache.NewMemoryTokenStore(10)
+
+	volatile := cache.NewDevCache()
+	datastore := memory.New(volatile.PublishDocument)
+
+	conf := internal.BaseConfig{ID: "unittest", Name: "unittest", IsActive: true}
+
+	token := "tokid|schemes"
+	if err := Tokens.SetAuth(token, internal.Auth{Email: "schemes@test.com"}); err != nil {
+		t.Fatal(err)
+	}
+	key := signToken(t, token)
+
+	var got internal.Auth
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, auth, err := Extract(r, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = auth
+	}), RequireAuth(datastore, volatile))
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		status int
+	}{
+		{"bearer", "Authorization", "Bearer " + key, http.StatusOK},
+		{"api key header", APIKeyHeader, key, http.StatusOK},
+		{"wrong scheme", "Authorization", "Basic " + key, http.StatusBadRequest},
+		{"missing", "", "", http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		got = internal.Auth{}
+
+		req := httptest.NewRequest("GET", "/db/tasks", nil)
+		req = req.WithContext(context.WithValue(req.Context(), ContextBase, conf))
+		if len(tc.header) > 0 {
+			req.Header.Set(tc.header, tc.value)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != tc.status {
+			t.Errorf("%s: expected status %d got %d: %s", tc.name, tc.status, w.Code, w.Body.String())
+		} else if tc.status == http.StatusOK && got.Email != "schemes@test.com" {
+			t.Errorf("%s: expected auth in context got %v", tc.name, got)
+		}
+	}
+}
+
+func TestRequireAuthMissingBaseVsInvalidToken(t *testing.T) {
+	volatile := cache.NewDevCache()
+	datastore := memory.New(volatile.PublishDocument)
+
+	conf := internal.BaseConfig{ID: "unittest", Name: "unittest", IsActive: true}
+
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be reached")
+	}), RequireAuth(datastore, volatile))
+
+	tests := []struct {
+		name    string
+		withPK  bool
+		token   string
+		status  int
+		message string
+	}{
+		{"missing base", false, signToken(t, "tokid|tokvalue"), http.StatusBadRequest, ErrMissingPublicKey.Error()},
+		{"invalid token", true, "not-a-jwt", http.StatusUnauthorized, ErrInvalidToken.Error()},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", "/db/tasks", nil)
+		if tc.withPK {
+			req = req.WithContext(context.WithValue(req.Context(), ContextBase, conf))
+		}
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != tc.status {
+			t.Errorf("%s: expected status %d got %d", tc.name, tc.status, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), tc.message) {
+			t.Errorf("%s: expected message %q got %q", tc.name, tc.message, w.Body.String())
+		}
+	}
+}
+
+func TestValidateAuthKeySessionBinding(t *testing.T) {
+	defer func(ts internal.TokenStore) { Tokens = ts }(Tokens)
+	Tokens = cache.NewMemoryTokenStore(10)
+
+	volatile := cache.NewDevCache()
+	datastore := memory.New(volatile.PublishDocument)
+
+	token := "tokid|binding"
+	if err := Tokens.SetAuth(token, internal.Auth{Email: "binding@test.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	issuedTo := Client{IP: "10.0.0.1", UserAgent: "unit-test/1.0"}
+
+	sign := func(session string) string {
+		now := time.Now()
+		pl := internal.JWTPayload{
+			Payload: jwt.Payload{
+				ExpirationTime: jwt.NumericDate(now.Add(time.Hour)),
+				IssuedAt:       jwt.NumericDate(now),
+			},
+			Token:   token,
+			Session: session,
+		}
+		b, err := jwt.Sign(pl, internal.HashSecret())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	tests := []struct {
+		name    string
+		binding string
+		session string
+		client  Client
+		valid   bool
+	}{
+		{"no binding", internal.SessionBindingNone, "", Client{IP: "10.0.0.2"}, true},
+		{"same ip", internal.SessionBindingIP, issuedTo.Fingerprint(internal.SessionBindingIP), Client{IP: "10.0.0.1", UserAgent: "other"}, true},
+		{"other ip", internal.SessionBindingIP, issuedTo.Fingerprint(internal.SessionBindingIP), Client{IP: "10.0.0.2", UserAgent: issuedTo.UserAgent}, false},
+		{"same user-agent", internal.SessionBindingUserAgent, issuedTo.Fingerprint(internal.SessionBindingUserAgent), Client{IP: "10.0.0.2", UserAgent: issuedTo.UserAgent}, true},
+		{"other user-agent", internal.SessionBindingUserAgent, issuedTo.Fingerprint(internal.SessionBindingUserAgent), Client{IP: issuedTo.IP, UserAgent: "other"}, false},
+		{"same client", internal.SessionBindingBoth, issuedTo.Fingerprint(internal.SessionBindingBoth), issuedTo, true},
+		{"other client", internal.SessionBindingBoth, issuedTo.Fingerprint(internal.SessionBindingBoth), Client{IP: issuedTo.IP, UserAgent: "other"}, false},
+		{"unbound token", internal.SessionBindingIP, "", issuedTo, false},
+		{"binding changed", internal.SessionBindingBoth, issuedTo.Fingerprint(internal.SessionBindingIP), issuedTo, false},
+	}
+
+	for _, tc := range tests {
+		conf := internal.BaseConfig{ID: "unittest", Name: "unittest", IsActive: true, SessionBinding: tc.binding}
+		ctx := context.WithValue(context.Background(), ContextBase, conf)
+		ctx = context.WithValue(ctx, ContextClient, tc.client)
+
+		_, err := ValidateAuthKey(datastore, volatile, ctx, sign(tc.session))
+		if tc.valid && err != nil {
+			t.Errorf("%s: expected token to be valid got %v", tc.name, err)
+		} else if !tc.valid && !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken got %v", tc.name, err)
+		}
+	}
+}
+
+func TestRequireActiveBaseStoresClient(t *testing.T) {
+	volatile := cache.NewDevCache()
+	datastore := memory.New(volatile.PublishDocument)
+
+	base, err := datastore.CreateBase(internal.BaseConfig{Name: "clientbase", IsActive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Client
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = ClientFromContext(r.Context())
+	}), RequireActiveBase(datastore, volatile))
+
+	req := httptest.NewRequest("GET", "/db/tasks", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("User-Agent", "unit-test/1.0")
+	req.Header.Set("SB-PUBLIC-KEY", base.Key())
+
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got.IP != "10.0.0.1" || got.UserAgent != "unit-test/1.0" {
+		t.Errorf("expected client 10.0.0.1 unit-test/1.0 got %v", got)
+	}
+}
+
+func TestValidateAuthKeyTokenLimit(t *testing.T) {
+	defer func(ts internal.TokenStore) { Tokens = ts }(Tokens)
+	Tokens = cache.NewMemoryTokenStore(10)
+
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+	config.Current.Settings.MaxTokensPerUser = 1
+
+	volatile := cache.NewDevCache()
+	datastore := memory.New(volatile.PublishDocument)
+
+	token := "tokid|limit"
+	if err := Tokens.SetAuth(token, internal.Auth{Email: "limit@test.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expires := time.Now().Add(time.Hour)
+	sign := func(id string) string {
+		pl := internal.JWTPayload{
+			Payload: jwt.Payload{ExpirationTime: jwt.NumericDate(expires), JWTID: id},
+			Token:   token,
+		}
+		b, err := jwt.Sign(pl, internal.HashSecret())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	sessions := cache.NewSessionStore(volatile)
+	for _, id := range []string{"first", "second"} {
+		if err := sessions.Open(token, id, expires, 1, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conf := internal.BaseConfig{ID: "unittest", Name: "unittest", IsActive: true}
+	ctx := context.WithValue(context.Background(), ContextBase, conf)
+
+	if _, err := ValidateAuthKey(datastore, volatile, ctx, sign("second")); err != nil {
+		t.Errorf("expected the open session to be valid got %v", err)
+	}
+	for _, id := range []string{"first", "unknown"} {
+		if _, err := ValidateAuthKey(datastore, volatile, ctx, sign(id)); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken got %v", id, err)
+		}
+	}
+}
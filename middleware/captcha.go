@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+// CaptchaHeader holds the CAPTCHA response token of anonymous writes.
+const CaptchaHeader = "SB-CAPTCHA"
+
+// RequireCaptcha rejects anonymous writes to the listed collections unless
+// the request carries a CAPTCHA token accepted by verifier. It must run
+// after RequireAuth.
+func RequireCaptcha(verifier internal.CaptchaVerifier, collections []string) Middleware {
+	flagged := make(map[string]bool)
+	for _, col := range collections {
+		if col = strings.TrimSpace(col); len(col) > 0 {
+			flagged[col] = true
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead || !flagged[collection(r.URL.Path)] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			auth, ok := r.Context().Value(ContextAuth).(internal.Auth)
+			if !ok || auth.AccountID != PublicAccountID {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			valid, err := verifier.Verify(r.Header.Get(CaptchaHeader), RemoteIP(r))
+			if err != nil {
+				http.Error(w, "unable to verify the CAPTCHA: "+err.Error(), http.StatusServiceUnavailable)
+				return
+			} else if !valid {
+				http.Error(w, "missing or invalid CAPTCHA", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// collection returns the collection from a /db/{collection}/... path.
+func collection(p string) string {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// RemoteIP returns the IP address of the client of r.
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
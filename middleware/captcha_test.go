@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+type mockVerifier struct {
+	valid string
+}
+
+func (v mockVerifier) Verify(token, remoteIP string) (bool, error) {
+	return token == v.valid, nil
+}
+
+func TestRequireCaptcha(t *testing.T) {
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}), RequireCaptcha(mockVerifier{valid: "human"}, []string{"pub_contacts"}))
+
+	anonymous := internal.Auth{AccountID: PublicAccountID, UserID: PublicAccountID}
+	user := internal.Auth{AccountID: "acctid", UserID: "userid"}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		auth    internal.Auth
+		captcha string
+		status  int
+	}{
+		{"valid captcha", "POST", "/db/pub_contacts", anonymous, "human", http.StatusCreated},
+		{"invalid captcha", "POST", "/db/pub_contacts", anonymous, "bot", http.StatusForbidden},
+		{"missing captcha", "POST", "/db/pub_contacts", anonymous, "", http.StatusForbidden},
+		{"authenticated user", "POST", "/db/pub_contacts", user, "", http.StatusCreated},
+		{"read", "GET", "/db/pub_contacts", anonymous, "", http.StatusCreated},
+		{"not flagged", "POST", "/db/pub_other", anonymous, "", http.StatusCreated},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), ContextAuth, tc.auth))
+		if len(tc.captcha) > 0 {
+			req.Header.Set(CaptchaHeader, tc.captcha)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != tc.status {
+			t.Errorf("%s: expected status %d got %d: %s", tc.name, tc.status, w.Code, w.Body.String())
+		}
+	}
+}
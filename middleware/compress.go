@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Compress compresses the responses with gzip or deflate, negotiated with
+// the Accept-Encoding header, when their content type is one of types and
+// their body is at least minSize bytes. A response flushed before reaching
+// minSize, i.e. a stream, is compressed based on its content type only.
+func Compress(minSize int, types []string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+			if len(encoding) == 0 || len(r.Header.Get("Upgrade")) > 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				minSize:        minSize,
+				types:          types,
+				status:         http.StatusOK,
+			}
+			defer cw.Close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// acceptedEncoding returns gzip or deflate, the one having the highest
+// quality in the Accept-Encoding header, or empty when none are accepted.
+func acceptedEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			if f, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64); err == nil {
+				q = f
+			}
+		}
+
+		if name == "*" {
+			name = "gzip"
+		}
+
+		// gzip is preferred on equal quality
+		if (name == "gzip" && q > 0 && q >= bestQ) || (name == "deflate" && q > bestQ) {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the body until minSize bytes are written to know
+// if the response is compressed. The header is sent once it's decided.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	types    []string
+
+	status      int
+	wroteHeader bool
+	started     bool
+	hijacked    bool
+	buf         []byte
+	// zw is nil when the response is not compressed
+	zw io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+
+	if w.started {
+		if w.zw != nil {
+			return w.zw.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.minSize {
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// start sends the header, compressing the response when allowed and it's
+// eligible, then the buffered body.
+func (w *compressWriter) start(allowed bool) error {
+	w.started = true
+
+	h := w.Header()
+	if len(h.Get("Content-Type")) == 0 && len(w.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	if allowed && w.eligible() {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+
+		if w.encoding == "gzip" {
+			w.zw = gzip.NewWriter(w.ResponseWriter)
+		} else {
+			w.zw = zlib.NewWriter(w.ResponseWriter)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	} else if w.zw != nil {
+		_, err := w.zw.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+func (w *compressWriter) eligible() bool {
+	if w.status < http.StatusOK || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return false
+	} else if len(w.Header().Get("Content-Encoding")) > 0 {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	for _, t := range w.types {
+		if strings.EqualFold(t, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Flush starts the response when it's not yet started, a flushed response
+// is streamed so its final size is unknown.
+func (w *compressWriter) Flush() {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+		w.start(true)
+	}
+
+	if f, ok := w.zw.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack keeps the websocket upgrades working.
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response writer does not support hijacking")
+	}
+
+	w.hijacked = true
+	return h.Hijack()
+}
+
+// Close sends a response smaller than minSize uncompressed and ends the
+// compressed stream.
+func (w *compressWriter) Close() error {
+	if w.hijacked || !w.wroteHeader {
+		return nil
+	} else if !w.started {
+		return w.start(false)
+	} else if w.zw != nil {
+		return w.zw.Close()
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"name":"compress me"},`, 100)
+
+	tests := []struct {
+		name     string
+		accept   string
+		ctype    string
+		body     string
+		encoding string
+	}{
+		{"large json gzip", "gzip, deflate", "application/json", large, "gzip"},
+		{"large json deflate", "deflate, gzip;q=0.5", "application/json; charset=utf-8", large, "deflate"},
+		{"small json", "gzip", "application/json", `{"name":"small"}`, ""},
+		{"not allowed type", "gzip", "image/png", large, ""},
+		{"not accepted", "", "application/json", large, ""},
+		{"refused encoding", "gzip;q=0", "application/json", large, ""},
+	}
+
+	for _, tc := range tests {
+		h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tc.ctype)
+			// written in chunks to cross the threshold after the first
+			io.WriteString(w, tc.body[:len(tc.body)/2])
+			io.WriteString(w, tc.body[len(tc.body)/2:])
+		}), Compress(1024, []string{"application/json", "text/plain"}))
+
+		req := httptest.NewRequest("GET", "/", nil)
+		if len(tc.accept) > 0 {
+			req.Header.Set("Accept-Encoding", tc.accept)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if enc := w.Header().Get("Content-Encoding"); enc != tc.encoding {
+			t.Errorf("%s: expected encoding %q got %q", tc.name, tc.encoding, enc)
+			continue
+		}
+
+		var body io.Reader = w.Body
+		switch tc.encoding {
+		case "gzip":
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = zr
+		case "deflate":
+			zr, err := zlib.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = zr
+		}
+
+		b, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatal(err)
+		} else if string(b) != tc.body {
+			t.Errorf("%s: the body does not match the original", tc.name)
+		}
+	}
+}
+
+func TestCompressStream(t *testing.T) {
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		io.WriteString(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "data: second\n\n")
+	}), Compress(1024, []string{"text/plain"}))
+
+	// the events stream is not an allowed type, it's sent as is
+	req := httptest.NewRequest("GET", "/?type=text/event-stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if !w.Flushed {
+		t.Error("expected the flush to reach the underlying writer")
+	} else if len(w.Header().Get("Content-Encoding")) > 0 || w.Body.String() != "data: first\n\ndata: second\n\n" {
+		t.Errorf("expected the stream to be uncompressed got %q", w.Body.String())
+	}
+
+	// an allowed type flushed before the threshold is compressed
+	req = httptest.NewRequest("GET", "/?type=text/plain", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected the flushed stream to be compressed got %v", w.Header())
+	}
+
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := io.ReadAll(zr); err != nil {
+		t.Fatal(err)
+	} else if string(b) != "data: first\n\ndata: second\n\n" {
+		t.Errorf("unexpected stream body %q", b)
+	}
+}
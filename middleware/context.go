@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"errors"
 	"net/http"
 
@@ -12,13 +13,28 @@ type ContextKey int
 const (
 	ContextAuth ContextKey = iota
 	ContextBase
+	ContextClient
+	ContextCSRF
 )
 
-func Extract(r *http.Request, withAuth bool) (internal.BaseConfig, internal.Auth, error) {
-	ctx := r.Context()
+// ErrMissingBase is returned when the request context has no BaseConfig,
+// the handler is not behind RequireActiveBase.
+var ErrMissingBase = errors.New("could not find config")
+
+// BaseFromContext returns the BaseConfig stored by RequireActiveBase.
+func BaseFromContext(ctx context.Context) (internal.BaseConfig, error) {
 	conf, ok := ctx.Value(ContextBase).(internal.BaseConfig)
 	if !ok {
-		return internal.BaseConfig{}, internal.Auth{}, errors.New("could not find config")
+		return conf, ErrMissingBase
+	}
+	return conf, nil
+}
+
+func Extract(r *http.Request, withAuth bool) (internal.BaseConfig, internal.Auth, error) {
+	ctx := r.Context()
+	conf, err := BaseFromContext(ctx)
+	if err != nil {
+		return internal.BaseConfig{}, internal.Auth{}, err
 	}
 
 	auth, ok := ctx.Value(ContextAuth).(internal.Auth)
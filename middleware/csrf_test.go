@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(CSRFToken(r)))
+	})
+	h := Chain(ok, CSRF([]string{"https://www.example.com"}))
+
+	// a GET issues the token the forms must send back
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d", w.Code)
+	}
+
+	var ck *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == CSRFCookie {
+			ck = c
+		}
+	}
+	if ck == nil {
+		t.Fatal("expected the CSRF cookie to be set")
+	} else if w.Body.String() != ck.Value {
+		t.Fatalf("expected the handler token to match the cookie got %s", w.Body.String())
+	}
+
+	form := func(token string) *http.Request {
+		data := url.Values{"email": {"csrf@test.com"}}
+		if len(token) > 0 {
+			data.Set(CSRFField, token)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/account/init", strings.NewReader(data.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(ck)
+		return r
+	}
+
+	tests := []struct {
+		name   string
+		r      *http.Request
+		status int
+	}{
+		{"form without token", form(""), http.StatusForbidden},
+		{"form with invalid token", form(strings.Repeat("0", 64)), http.StatusForbidden},
+		{"form with token", form(ck.Value), http.StatusOK},
+		{"form from trusted origin", func() *http.Request {
+			r := form("")
+			r.Header.Set("Origin", "https://www.example.com")
+			return r
+		}(), http.StatusOK},
+		{"form from other origin", func() *http.Request {
+			r := form("")
+			r.Header.Set("Origin", "https://evil.example.com")
+			return r
+		}(), http.StatusForbidden},
+		{"token in header", func() *http.Request {
+			r := form("")
+			r.Header.Set(CSRFHeader, ck.Value)
+			return r
+		}(), http.StatusOK},
+		{"api token", func() *http.Request {
+			r := form("")
+			r.Header.Set("Authorization", "Bearer some-token")
+			return r
+		}(), http.StatusOK},
+		{"json body", func() *http.Request {
+			r := httptest.NewRequest(http.MethodPost, "/account/init", strings.NewReader(`{"email": "csrf@test.com"}`))
+			r.Header.Set("Content-Type", "application/json")
+			return r
+		}(), http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, tc.r)
+			if w.Code != tc.status {
+				t.Errorf("expected status %d got %d: %s", tc.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// RequireFeature rejects the requests with a 403 when the feature is turned
+// off for the base. It must run after RequireActiveBase.
+func RequireFeature(feature string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conf, err := BaseFromContext(r.Context())
+			if err != nil {
+				http.Error(w, "invalid StaticBackend key", http.StatusUnauthorized)
+				return
+			} else if !conf.FeatureEnabled(feature) {
+				http.Error(w, FeatureDisabled(feature), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// FeatureDisabled returns the error message of a disabled feature.
+func FeatureDisabled(feature string) string {
+	return fmt.Sprintf("the %s feature is disabled for this base", feature)
+}
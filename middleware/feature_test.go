@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/staticbackendhq/core/cache"
+	"github.com/staticbackendhq/core/database/memory"
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestRequireFeature(t *testing.T) {
+	volatile := cache.NewDevCache()
+	datastore := memory.New(volatile.PublishDocument)
+
+	bases := []internal.BaseConfig{
+		{ID: "featurepk", Name: "featurebase", IsActive: true},
+		{ID: "nofeaturepk", Name: "nofeaturebase", IsActive: true, Features: map[string]bool{
+			internal.FeatureRealtime:          false,
+			internal.FeaturePublicCollections: false,
+		}},
+	}
+	for _, base := range bases {
+		if _, err := datastore.CreateBase(base); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	realtime := Chain(ok, RequireActiveBase(datastore, volatile), RequireFeature(internal.FeatureRealtime))
+	functions := Chain(ok, RequireActiveBase(datastore, volatile), RequireFeature(internal.FeatureFunctions))
+	public := Chain(ok, RequireActiveBase(datastore, volatile), RequireAuth(datastore, volatile))
+
+	tests := []struct {
+		name   string
+		h      http.Handler
+		pk     string
+		path   string
+		status int
+	}{
+		{"realtime enabled", realtime, "featurepk", "/sse/connect", http.StatusOK},
+		{"realtime disabled", realtime, "nofeaturepk", "/sse/connect", http.StatusForbidden},
+		{"functions not set", functions, "nofeaturepk", "/fn/exec/", http.StatusOK},
+		{"public enabled", public, "featurepk", "/db/pub_posts", http.StatusOK},
+		{"public disabled", public, "nofeaturepk", "/db/pub_posts", http.StatusForbidden},
+		{"private unchanged", public, "nofeaturepk", "/db/posts", http.StatusUnauthorized},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		req.Header.Set("SB-PUBLIC-KEY", tc.pk)
+
+		w := httptest.NewRecorder()
+		tc.h.ServeHTTP(w, req)
+
+		if w.Code != tc.status {
+			t.Errorf("%s: expected status %d got %d: %s", tc.name, tc.status, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	redacted = "[REDACTED]"
+
+	// maxLoggedBody is the number of body bytes read for logging, the rest
+	// of the body is still passed to the handler.
+	maxLoggedBody = 4096
+)
+
+// DefaultSensitiveKeys are always redacted from the logged requests. Keys
+// match case-insensitively when they contain one of those values.
+var DefaultSensitiveKeys = []string{"password", "token", "secret"}
+
+// RequestLogger logs every request with its status and duration. The
+// Authorization and Cookie headers, plus any header, query string or body
+// field matching the sensitive keys are redacted before being written to out.
+func RequestLogger(out *log.Logger, sensitiveKeys ...string) Middleware {
+	keys := append([]string{}, DefaultSensitiveKeys...)
+	for _, k := range sensitiveKeys {
+		if k = strings.TrimSpace(k); len(k) > 0 {
+			keys = append(keys, strings.ToLower(k))
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			var body []byte
+			if r.Body != nil {
+				body, _ = io.ReadAll(io.LimitReader(r.Body, maxLoggedBody))
+				r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			}
+
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r)
+
+			out.Printf("[request] %s %s status=%d duration=%v headers=%s body=%s",
+				r.Method,
+				redactURL(r.URL, keys),
+				sw.status,
+				time.Since(start),
+				redactHeaders(r.Header, keys),
+				redactBody(r.Header.Get("Content-Type"), body, keys),
+			)
+		})
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// statusWriter captures the response status, it keeps the http.Flusher
+// behavior required by the SSE endpoints and the http.Hijacker one required
+// by the websocket upgrade.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	sw.status = status
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (sw *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := sw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response writer does not support hijacking")
+	}
+
+	// the upgrade response is written on the hijacked connection
+	sw.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+func isSensitive(key string, keys []string) bool {
+	key = strings.ToLower(key)
+	for _, k := range keys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactURL(u *url.URL, keys []string) string {
+	if len(u.RawQuery) == 0 {
+		return u.Path
+	}
+
+	qs := u.Query()
+	redactValues(qs, keys)
+	return u.Path + "?" + qs.Encode()
+}
+
+func redactValues(values url.Values, keys []string) {
+	for k := range values {
+		if isSensitive(k, keys) {
+			values[k] = []string{redacted}
+		}
+	}
+}
+
+func redactHeaders(h http.Header, keys []string) string {
+	var pairs []string
+	for k, v := range h {
+		val := strings.Join(v, ",")
+		switch {
+		case strings.EqualFold(k, "Authorization"), strings.EqualFold(k, "Cookie"):
+			val = redacted
+		case isSensitive(k, keys):
+			val = redacted
+		}
+		pairs = append(pairs, fmt.Sprintf("%s:%s", k, val))
+	}
+	return "{" + strings.Join(pairs, " ") + "}"
+}
+
+func redactBody(contentType string, body []byte, keys []string) string {
+	if len(body) == 0 {
+		return "-"
+	}
+
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		values, err := url.ParseQuery(string(body))
+		if err == nil {
+			redactValues(values, keys)
+			return values.Encode()
+		}
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		// we cannot tell what is sensitive in other formats
+		return fmt.Sprintf("[%d bytes]", len(body))
+	}
+
+	b, err := json.Marshal(redactJSON(v, keys))
+	if err != nil {
+		return fmt.Sprintf("[%d bytes]", len(body))
+	}
+	return string(b)
+}
+
+func redactJSON(v interface{}, keys []string) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if isSensitive(k, keys) {
+				val[k] = redacted
+			} else {
+				val[k] = redactJSON(child, keys)
+			}
+		}
+	case []interface{}:
+		for i, child := range val {
+			val[i] = redactJSON(child, keys)
+		}
+	}
+	return v
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRequestLoggerRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+
+	var received string
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received = string(b)
+		w.WriteHeader(http.StatusCreated)
+	}), RequestLogger(logger, "ssn"))
+
+	body := `{"email":"a@b.com","password":"super-secret-pw","profile":{"ssn":"123-45"}}`
+	req := httptest.NewRequest("POST", "/login?code=42&token=query-token", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer my-jwt-value")
+
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if received != body {
+		t.Errorf("expected handler to receive the full body got %s", received)
+	}
+
+	out := buf.String()
+	for _, secret := range []string{"my-jwt-value", "super-secret-pw", "query-token", "123-45"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("expected %q to be redacted from %s", secret, out)
+		}
+	}
+
+	for _, visible := range []string{"a@b.com", "code=42", "status=201"} {
+		if !strings.Contains(out, visible) {
+			t.Errorf("expected %q to be logged in %s", visible, out)
+		}
+	}
+}
+
+func TestRequestLoggerRedactsForm(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("password") != "form-pw" {
+			t.Errorf("expected handler to read the password")
+		}
+	}), RequestLogger(logger))
+
+	req := httptest.NewRequest("POST", "/ui/login", strings.NewReader("email=a%40b.com&password=form-pw"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if out := buf.String(); strings.Contains(out, "form-pw") {
+		t.Errorf("expected form password to be redacted from %s", out)
+	}
+}
+
+func TestRequestLoggerWebsocketUpgrade(t *testing.T) {
+	var buf bytes.Buffer
+	out := log.New(&buf, "", 0)
+
+	upgrader := websocket.Upgrader{}
+	h := RequestLogger(out)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if typ, msg, err := conn.ReadMessage(); err == nil {
+			conn.WriteMessage(typ, msg)
+		}
+	}))
+
+	// the request is logged once the websocket is closed
+	logged := make(chan bool)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+		close(logged)
+	}))
+	defer ts.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("expected the upgrade to go through the logger got %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("ping")); err != nil {
+		t.Fatal(err)
+	} else if _, msg, err := conn.ReadMessage(); err != nil || string(msg) != "ping" {
+		t.Errorf("expected the echoed message got %s %v", msg, err)
+	}
+
+	conn.Close()
+	<-logged
+
+	if !strings.Contains(buf.String(), "status=101") {
+		t.Errorf("expected the upgrade to be logged got %s", buf.String())
+	}
+}
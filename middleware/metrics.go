@@ -0,0 +1,32 @@
+package middleware
+
+import "sync/atomic"
+
+var authCacheHits, authCacheMisses int64
+
+// AuthCacheMetrics reports how the token cache used by ValidateAuthKey
+// performs.
+type AuthCacheMetrics struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+// evictionCounter is implemented by the TokenStore evicting tokens, the
+// shared cache relies on Redis' own eviction.
+type evictionCounter interface {
+	Evictions() int64
+}
+
+// AuthCacheStats returns the token cache counters since the process started.
+func AuthCacheStats() AuthCacheMetrics {
+	m := AuthCacheMetrics{
+		Hits:   atomic.LoadInt64(&authCacheHits),
+		Misses: atomic.LoadInt64(&authCacheMisses),
+	}
+
+	if ec, ok := Tokens.(evictionCounter); ok {
+		m.Evictions = ec.Evictions()
+	}
+	return m
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/staticbackendhq/core/cache"
+	"github.com/staticbackendhq/core/database/memory"
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestAuthCacheStats(t *testing.T) {
+	defer func(ts internal.TokenStore) { Tokens = ts }(Tokens)
+	Tokens = cache.NewMemoryTokenStore(1)
+
+	volatile := cache.NewDevCache()
+	datastore := memory.New(volatile.PublishDocument)
+
+	conf := internal.BaseConfig{ID: "unittest", Name: "unittest", IsActive: true}
+	ctx := context.WithValue(context.Background(), ContextBase, conf)
+
+	before := AuthCacheStats()
+
+	key := signToken(t, "tokid|metrics")
+	if _, err := ValidateAuthKey(datastore, volatile, ctx, key); err == nil {
+		t.Fatal("expected unknown token to be rejected")
+	}
+
+	if err := Tokens.SetAuth("tokid|metrics", internal.Auth{Email: "metrics@test.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := ValidateAuthKey(datastore, volatile, ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	after := AuthCacheStats()
+	if hits := after.Hits - before.Hits; hits != 3 {
+		t.Errorf("expected 3 hits got %d", hits)
+	}
+	if misses := after.Misses - before.Misses; misses != 1 {
+		t.Errorf("expected 1 miss got %d", misses)
+	}
+
+	// the store holds a single token, caching another one evicts the first
+	if err := Tokens.SetAuth("tokid|other", internal.Auth{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if evictions := AuthCacheStats().Evictions; evictions != 1 {
+		t.Errorf("expected 1 eviction got %d", evictions)
+	}
+}
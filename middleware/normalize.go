@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// NormalizePath canonicalizes the request path before it's routed by mux
+// so /db/posts/, /db//posts and /DB/posts reach the same handler and go
+// through the same auth checks as /db/posts. The dot segments and repeated
+// slashes are cleaned, the route segment, the first one, is lowercased and
+// the trailing slash is removed unless mux has a pattern ending with it for
+// the path, i.e. /ui/db/.
+//
+// It wraps mux so the routing and the prefix checks of the middlewares see
+// the normalized path.
+func NormalizePath(mux *http.ServeMux) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := normalizePath(mux, r)
+			if p == r.URL.Path {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = p
+			r2.URL.RawPath = ""
+
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
+
+func normalizePath(mux *http.ServeMux, r *http.Request) string {
+	trailing := strings.HasSuffix(r.URL.Path, "/")
+
+	p := path.Clean("/" + r.URL.Path)
+	if route, rest, found := strings.Cut(strings.TrimPrefix(p, "/"), "/"); found {
+		p = "/" + strings.ToLower(route) + "/" + rest
+	} else {
+		p = "/" + strings.ToLower(route)
+	}
+
+	if !trailing || p == "/" {
+		return p
+	}
+
+	// the pattern is registered with its trailing slash, i.e. /db/
+	if pattern(mux, r, p+"/") == p+"/" {
+		return p + "/"
+	}
+	return p
+}
+
+// pattern returns the pattern of mux routing a request to p.
+func pattern(mux *http.ServeMux, r *http.Request, p string) string {
+	u := *r.URL
+	u.Path = p
+	u.RawPath = ""
+
+	_, pattern := mux.Handler(&http.Request{Method: r.Method, Host: r.Host, URL: &u})
+	return pattern
+}
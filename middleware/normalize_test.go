@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/staticbackendhq/core/cache"
+	"github.com/staticbackendhq/core/database/memory"
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestNormalizePathRouting(t *testing.T) {
+	mux := http.NewServeMux()
+
+	route := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + " " + r.URL.Path))
+		})
+	}
+	mux.Handle("/db/", route("db"))
+	mux.Handle("/ui/db", route("cols"))
+	mux.Handle("/ui/db/", route("doc"))
+	mux.Handle("/account/logins", route("logins"))
+
+	h := Chain(mux, NormalizePath(mux))
+
+	tests := map[string]string{
+		"/db/posts":           "db /db/posts",
+		"/db/posts/":          "db /db/posts",
+		"/db//posts":          "db /db/posts",
+		"/DB/posts/":          "db /db/posts",
+		"/db/posts/./id/":     "db /db/posts/id",
+		"/db/":                "db /db/",
+		"/ui/db":              "cols /ui/db",
+		"/ui/db/":             "doc /ui/db/",
+		"/account/logins/":    "logins /account/logins",
+		"/Account/logins":     "logins /account/logins",
+		"/db/CaseKept/AbC123": "db /db/CaseKept/AbC123",
+	}
+	for p, expected := range tests {
+		req := httptest.NewRequest("GET", p, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200 got %d", p, w.Code)
+		} else if got := w.Body.String(); got != expected {
+			t.Errorf("%s: expected %q got %q", p, expected, got)
+		}
+	}
+}
+
+func TestNormalizePathAuth(t *testing.T) {
+	volatile := cache.NewDevCache()
+	datastore := memory.New(volatile.PublishDocument)
+
+	base := internal.BaseConfig{ID: "normalizepk", Name: "normalizebase", IsActive: true}
+	if _, err := datastore.CreateBase(base); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/db/", Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		RequireActiveBase(datastore, volatile), RequireAuth(datastore, volatile)))
+
+	h := Chain(mux, NormalizePath(mux))
+
+	tests := map[string]int{
+		"/db/pub_posts":   http.StatusOK,
+		"/db/pub_posts/":  http.StatusOK,
+		"/DB/pub_posts":   http.StatusOK,
+		"//db//pub_posts": http.StatusOK,
+		"/db/posts":       http.StatusUnauthorized,
+		"/db/posts/":      http.StatusUnauthorized,
+		"/DB//posts/":     http.StatusUnauthorized,
+		// a dot segment can't escape the public prefix check
+		"/db/pub_posts/../posts": http.StatusUnauthorized,
+	}
+	for p, expected := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.URL.Path = p
+		req.Header.Set("SB-PUBLIC-KEY", base.ID)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != expected {
+			t.Errorf("%s: expected status %d got %d", p, expected, w.Code)
+		}
+	}
+}
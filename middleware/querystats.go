@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/staticbackendhq/core/database/querycount"
+)
+
+const (
+	// QueryCountHeader is the number of datastore operations of the request
+	QueryCountHeader = "X-Query-Count"
+	// QueryTimeHeader is the total time of the datastore operations
+	QueryTimeHeader = "X-Query-Time"
+)
+
+// QueryStats adds the number and total time of the datastore operations
+// made by the request as response headers. The Stats are carried by the
+// request context, the operations are counted when the handlers use the
+// querycount.Persister bound to it with WithContext. The headers are set
+// when the response is written, the operations made after are not
+// included.
+func QueryStats() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(r.Header.Get("Upgrade")) > 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			stats := &querycount.Stats{}
+			ctx := querycount.NewContext(r.Context(), stats)
+
+			next.ServeHTTP(&queryStatsWriter{ResponseWriter: w, stats: stats}, r.WithContext(ctx))
+		})
+	}
+}
+
+// queryStatsWriter sets the query headers before the response headers are
+// sent.
+type queryStatsWriter struct {
+	http.ResponseWriter
+	stats       *querycount.Stats
+	wroteHeader bool
+}
+
+func (w *queryStatsWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		h := w.Header()
+		count, d := w.stats.Get()
+		h.Set(QueryCountHeader, strconv.Itoa(count))
+		h.Set(QueryTimeHeader, d.Round(time.Microsecond).String())
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *queryStatsWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *queryStatsWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/staticbackendhq/core/cache"
+	"github.com/staticbackendhq/core/database/memory"
+	"github.com/staticbackendhq/core/database/querycount"
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestQueryStats(t *testing.T) {
+	volatile := cache.NewDevCache()
+	datastore := querycount.New(memory.New(volatile.PublishDocument))
+
+	if _, err := datastore.CreateBase(internal.BaseConfig{ID: "qspk", Name: "qsbase"}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 3; i++ {
+			if _, err := datastore.WithContext(r.Context()).FindDatabase("qspk"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		w.Write([]byte("ok"))
+	}), QueryStats())
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if v := w.Header().Get(QueryCountHeader); v != "3" {
+		t.Errorf("expected 3 queries got %q", v)
+	} else if len(w.Header().Get(QueryTimeHeader)) == 0 {
+		t.Errorf("expected the query time header to be set")
+	}
+
+	// the operations are counted per request
+	h = Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}), QueryStats())
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if v := w.Header().Get(QueryCountHeader); v != "0" {
+		t.Errorf("expected no queries got %q", v)
+	}
+}
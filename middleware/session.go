@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/staticbackendhq/core/cache"
+	"github.com/staticbackendhq/core/config"
+	"github.com/staticbackendhq/core/internal"
+)
+
+// Client identifies the client of a request for the session binding.
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+// ClientOf returns the Client of r.
+func ClientOf(r *http.Request) Client {
+	return Client{IP: RemoteIP(r), UserAgent: r.UserAgent()}
+}
+
+// ClientFromContext returns the Client stored by RequireActiveBase.
+func ClientFromContext(ctx context.Context) (Client, bool) {
+	c, ok := ctx.Value(ContextClient).(Client)
+	return c, ok
+}
+
+// Fingerprint returns the internal.SessionFingerprint of c for binding.
+func (c Client) Fingerprint(binding string) string {
+	return internal.SessionFingerprint(binding, c.IP, c.UserAgent)
+}
+
+// validSession returns if the token payload pl was issued to the client of
+// ctx when the base conf binds its sessions.
+func validSession(ctx context.Context, conf internal.BaseConfig, pl internal.JWTPayload) bool {
+	if conf.SessionBinding == internal.SessionBindingNone {
+		return true
+	}
+
+	c, ok := ClientFromContext(ctx)
+	return ok && len(pl.Session) > 0 && pl.Session == c.Fingerprint(conf.SessionBinding)
+}
+
+// openSession returns if the JWT of pl is one of the sessions of the user of
+// key when MAX_TOKENS_PER_USER caps them, an evicted session is rejected.
+// The impersonation tokens are not sessions of the user.
+func openSession(volatile internal.PubSuber, key string, pl internal.JWTPayload) bool {
+	if config.Current.Settings.MaxTokensPerUser == 0 || len(pl.ImpersonatedBy) > 0 {
+		return true
+	}
+	return cache.NewSessionStore(volatile).Active(key, pl.JWTID)
+}
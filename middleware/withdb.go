@@ -2,59 +2,101 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"time"
 
+	"github.com/staticbackendhq/core/cache"
 	"github.com/staticbackendhq/core/internal"
 )
 
+// Bases caches the public key to BaseConfig resolution done by
+// RequireActiveBase.
+var Bases = cache.NewBaseCache(10000, 5*time.Minute)
+
+// WithDB is kept for compatibility, it's the same as RequireActiveBase.
 func WithDB(datastore internal.Persister, volatile internal.PubSuber) Middleware {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			key := r.Header.Get("SB-PUBLIC-KEY")
+	return RequireActiveBase(datastore, volatile)
+}
 
-			// we check in query string (used for SSE)
-			if len(key) == 0 {
-				key = r.URL.Query().Get("sbpk")
-			}
+// RequireActiveBase resolves the public key to its BaseConfig and stores it
+// in the request context. A missing public key returns a 401, an unknown one
+// a 404 and an inactive base a 403 with ErrInactiveAccount. Handlers after
+// this middleware can rely on BaseFromContext.
+func RequireActiveBase(datastore internal.Persister, volatile internal.PubSuber) Middleware {
+	return resolveBase(datastore, volatile, false)
+}
 
-			// we check in cookie (used via the UI)
-			if len(key) == 0 {
-				ck, err := r.Cookie("pk")
-				if err == nil || ck != nil {
-					key = ck.Value
-				}
-			}
+// AllowInactiveBase is RequireActiveBase letting the inactive bases through.
+// It's for the billing routes their owner uses to re-activate them.
+func AllowInactiveBase(datastore internal.Persister, volatile internal.PubSuber) Middleware {
+	return resolveBase(datastore, volatile, true)
+}
 
+func resolveBase(datastore internal.Persister, volatile internal.PubSuber, allowInactive bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := publicKey(r)
 			if len(key) == 0 {
-				http.Error(w, "invalid StaticBackend public key", http.StatusUnauthorized)
+				http.Error(w, "missing StaticBackend public key", http.StatusUnauthorized)
 				return
 			}
 
-			ctx := r.Context()
-
-			var conf internal.BaseConfig
-			if err := volatile.GetTyped(key, &conf); err == nil {
-				ctx = context.WithValue(ctx, ContextBase, conf)
-			} else {
-				// let's try to see if they are allow to use a database
-				conf, err = datastore.FindDatabase(key)
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				} else if !conf.IsActive {
-					http.Error(w, "your account is not inactive. Please contact us support@staticbackend.com", http.StatusUnauthorized)
-					return
-				}
-
-				if err := volatile.SetTyped(key, conf); err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-
-				ctx = context.WithValue(ctx, ContextBase, conf)
+			conf, err := findBase(datastore, volatile, key)
+			if errors.Is(err, internal.ErrBaseNotFound) {
+				http.Error(w, "unknown StaticBackend public key", http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			} else if !conf.IsActive && !allowInactive {
+				http.Error(w, internal.ErrInactiveAccount.Error(), http.StatusForbidden)
+				return
 			}
 
+			ctx := context.WithValue(r.Context(), ContextBase, conf)
+			// tokens bound to their client are validated against it
+			ctx = context.WithValue(ctx, ContextClient, ClientOf(r))
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+func publicKey(r *http.Request) string {
+	key := r.Header.Get("SB-PUBLIC-KEY")
+
+	// we check in query string (used for SSE)
+	if len(key) == 0 {
+		key = r.URL.Query().Get("sbpk")
+	}
+
+	// we check in cookie (used via the UI)
+	if len(key) == 0 {
+		ck, err := r.Cookie("pk")
+		if err == nil || ck != nil {
+			key = ck.Value
+		}
+	}
+	return key
+}
+
+func findBase(datastore internal.Persister, volatile internal.PubSuber, key string) (conf internal.BaseConfig, err error) {
+	if conf, ok := Bases.Get(key); ok {
+		return conf, nil
+	}
+
+	conf, err = datastore.FindDatabaseByKey(key)
+	if err != nil {
+		return
+	} else if !conf.IsActive || key != conf.Key() {
+		// inactive bases are not cached so a re-activation is picked up,
+		// neither are previous keys so they stop working after their grace
+		return
+	}
+
+	Bases.Set(key, conf)
+
+	// the public websocket resolves the base from the shared cache
+	err = volatile.SetTyped(key, conf)
+	return
+}
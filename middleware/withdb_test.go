@@ -0,0 +1,203 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/cache"
+	"github.com/staticbackendhq/core/database/memory"
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestRequireActiveBase(t *testing.T) {
+	volatile := cache.NewDevCache()
+	datastore := memory.New(volatile.PublishDocument)
+
+	bases := []internal.BaseConfig{
+		{ID: "activepk", Name: "activebase", IsActive: true},
+		{ID: "inactivepk", Name: "inactivebase", IsActive: false},
+	}
+	for _, base := range bases {
+		if _, err := datastore.CreateBase(base); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got internal.BaseConfig
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conf, err := BaseFromContext(r.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = conf
+	}), RequireActiveBase(datastore, volatile))
+
+	tests := []struct {
+		pk     string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"unknownpk", http.StatusNotFound},
+		{"inactivepk", http.StatusForbidden},
+		{"activepk", http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", "/db/tasks", nil)
+		req.Header.Set("SB-PUBLIC-KEY", tc.pk)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != tc.status {
+			t.Errorf("pk %q: expected status %d got %d: %s", tc.pk, tc.status, w.Code, w.Body.String())
+		}
+	}
+
+	if got.Name != "activebase" {
+		t.Errorf("expected active base in context got %v", got)
+	}
+}
+
+type countingPersister struct {
+	internal.Persister
+	finds int
+}
+
+func (p *countingPersister) FindDatabaseByKey(key string) (internal.BaseConfig, error) {
+	p.finds++
+	return p.Persister.FindDatabaseByKey(key)
+}
+
+func TestRequireActiveBaseCache(t *testing.T) {
+	defer func(c *cache.BaseCache) { Bases = c }(Bases)
+	Bases = cache.NewBaseCache(100, time.Hour)
+
+	volatile := cache.NewDevCache()
+	datastore := &countingPersister{Persister: memory.New(volatile.PublishDocument)}
+
+	base := internal.BaseConfig{ID: "cachedpk", CustomerID: "cachedcus", Name: "cachedbase", IsActive: true}
+	if _, err := datastore.CreateBase(base); err != nil {
+		t.Fatal(err)
+	}
+
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), RequireActiveBase(datastore, volatile))
+
+	call := func() {
+		req := httptest.NewRequest("GET", "/db/tasks", nil)
+		req.Header.Set("SB-PUBLIC-KEY", base.ID)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200 got %d", w.Code)
+		}
+	}
+
+	call()
+	call()
+	if datastore.finds != 1 {
+		t.Errorf("expected cache hit to avoid datastore call, got %d calls", datastore.finds)
+	}
+
+	Bases.InvalidateCustomer(base.CustomerID)
+
+	call()
+	if datastore.finds != 2 {
+		t.Errorf("expected invalidation to fetch the base again, got %d calls", datastore.finds)
+	}
+}
+
+func TestRequireActiveBaseRotatedKey(t *testing.T) {
+	defer func(c *cache.BaseCache) { Bases = c }(Bases)
+	Bases = cache.NewBaseCache(100, time.Hour)
+
+	volatile := cache.NewDevCache()
+	datastore := memory.New(volatile.PublishDocument)
+
+	base := internal.BaseConfig{ID: "rotatedpk", Name: "rotatedbase", IsActive: true}
+	if _, err := datastore.CreateBase(base); err != nil {
+		t.Fatal(err)
+	}
+
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), RequireActiveBase(datastore, volatile))
+
+	status := func(pk string) int {
+		req := httptest.NewRequest("GET", "/db/tasks", nil)
+		req.Header.Set("SB-PUBLIC-KEY", pk)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := status(base.ID); code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d", code)
+	}
+
+	// the old key stays valid during the grace period
+	if err := datastore.RotatePublicKey(base.ID, "newpk", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	Bases.Invalidate(base.ID)
+
+	if code := status("newpk"); code != http.StatusOK {
+		t.Errorf("new key: expected status 200 got %d", code)
+	}
+	if code := status(base.ID); code != http.StatusOK {
+		t.Errorf("old key in grace period: expected status 200 got %d", code)
+	}
+
+	// the previous key is rejected once its grace period is over
+	if err := datastore.RotatePublicKey(base.ID, "newerpk", time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	Bases.Invalidate("newpk")
+
+	if code := status("newerpk"); code != http.StatusOK {
+		t.Errorf("newer key: expected status 200 got %d", code)
+	}
+	for _, pk := range []string{base.ID, "newpk"} {
+		if code := status(pk); code != http.StatusNotFound {
+			t.Errorf("%s after grace period: expected status 404 got %d", pk, code)
+		}
+	}
+}
+
+func TestInactiveBaseBillingOnly(t *testing.T) {
+	volatile := cache.NewDevCache()
+	datastore := memory.New(volatile.PublishDocument)
+
+	base := internal.BaseConfig{ID: "unpaidpk", Name: "unpaidbase", IsActive: false}
+	if _, err := datastore.CreateBase(base); err != nil {
+		t.Fatal(err)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	mux := http.NewServeMux()
+	mux.Handle("/db/", Chain(ok, RequireActiveBase(datastore, volatile)))
+	mux.Handle("/fn/exec/", Chain(ok, RequireActiveBase(datastore, volatile)))
+	mux.Handle("/account/portal", Chain(ok, AllowInactiveBase(datastore, volatile)))
+
+	for _, p := range []string{"/db/tasks", "/fn/exec/", "/account/portal"} {
+		req := httptest.NewRequest("GET", p, nil)
+		req.Header.Set("SB-PUBLIC-KEY", base.ID)
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		if p == "/account/portal" {
+			if w.Code != http.StatusOK {
+				t.Errorf("%s: expected the billing path to accept an inactive base got %d", p, w.Code)
+			}
+		} else if w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status 403 got %d", p, w.Code)
+		} else if !strings.Contains(w.Body.String(), internal.ErrInactiveAccount.Error()) {
+			t.Errorf("%s: expected the inactive account error got %s", p, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package staticbackend
+
+import (
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/staticbackendhq/core/cache"
+	"github.com/staticbackendhq/core/config"
+	emailFuncs "github.com/staticbackendhq/core/email"
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+)
+
+var loginCodeEmail = emailFuncs.Template{
+	Name:    "login-code",
+	Subject: "Your sign-in code",
+	HTML: `
+	<p>Hey there,</p>
+	<p>Use this code to sign in to your account:</p>
+	<p><strong>{{.Code}}</strong></p>
+	<p>This code expires in {{.Expires}} and can only be used once. If you
+	did not request it you can ignore this email.</p>
+	`,
+}
+
+// otpLimiter counts the login codes requested and the verification attempts
+// per email.
+var otpLimiter = cache.NewRateLimiter(100000)
+
+// allowLoginCode returns if the action, "send" or "verify", is allowed for
+// the email of the base, see EMAIL_OTP_RATE_LIMIT.
+func allowLoginCode(action, dbName, email string) bool {
+	limit := config.Current.Settings.EmailOTPRateLimit
+	return otpLimiter.Allow(action+":"+dbName+":"+email, limit.Limit, limit.Window)
+}
+
+// emailOTPEnabled returns if the password-less login is enabled, see
+// EMAIL_OTP.
+func emailOTPEnabled() bool {
+	return strings.EqualFold(config.Current.EmailOTP, "yes")
+}
+
+// newLoginCode returns a random 6 digits code.
+func newLoginCode() (string, error) {
+	n, err := crand.Int(randSource, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// loginCodeHash is the stored form of the login code of a user.
+func loginCodeHash(userID, code string) string {
+	mac := hmac.New(sha256.New, []byte(config.Current.JWTSecret))
+	mac.Write([]byte(userID + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// requestLoginCode emails a single-use login code to the user, it replaces
+// the code they might have requested before. The response is the same
+// whether the email is a user of the base or not.
+func (m *membership) requestLoginCode(w http.ResponseWriter, r *http.Request) {
+	if !emailOTPEnabled() {
+		http.Error(w, "login codes are disabled", http.StatusNotFound)
+		return
+	}
+
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, "invalid StaticBackend key", http.StatusUnauthorized)
+		return
+	}
+
+	data := new(struct {
+		Email string `json:"email"`
+	})
+	if err := parseBody(r.Body, data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	email := internal.NormalizeEmail(data.Email)
+	if strings.Index(email, "@") <= 0 {
+		http.Error(w, "invalid email", http.StatusBadRequest)
+		return
+	} else if !allowLoginCode("send", conf.Name, email) {
+		http.Error(w, "too many login codes requested, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	tok, err := datastore.FindTokenByEmail(conf.Name, email)
+	if err != nil {
+		respond(w, http.StatusOK, true)
+		return
+	}
+
+	code, err := newLoginCode()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ttl := config.Current.Settings.EmailOTPTTL
+
+	lc := internal.LoginCode{
+		UserID:  tok.ID,
+		Hash:    loginCodeHash(tok.ID, code),
+		Expires: time.Now().Add(ttl),
+	}
+	if err := datastore.SetLoginCode(conf.Name, lc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	mailData := map[string]string{
+		"Email":   tok.Email,
+		"Code":    code,
+		"Expires": ttl.String(),
+	}
+
+	htmlBody, textBody, err := loginCodeEmail.Render(mailData)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	subject, fromName, err := mailBranding(loginCodeEmail, conf.Name, mailData)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ed := internal.SendMailData{
+		From:     config.Current.FromEmail,
+		FromName: fromName,
+		To:       tok.Email,
+		Subject:  subject,
+		HTMLBody: htmlBody,
+		TextBody: textBody,
+		ReplyTo:  supportEmail(),
+	}
+	if err := emailer.Send(withMailDefaults(ed)); errors.Is(err, emailFuncs.ErrRecipientThrottled) {
+		// the same response as an unknown email, a 429 would reveal that
+		// the email has an account
+		respond(w, http.StatusOK, true)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, http.StatusOK, true)
+}
+
+// loginWithCode exchanges a login code sent by requestLoginCode for the
+// user's JWT. A code is used once, even when the sign in fails afterwards.
+func (m *membership) loginWithCode(w http.ResponseWriter, r *http.Request) {
+	if !emailOTPEnabled() {
+		http.Error(w, "login codes are disabled", http.StatusNotFound)
+		return
+	}
+
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, "invalid StaticBackend key", http.StatusUnauthorized)
+		return
+	}
+
+	data := new(struct {
+		Email string `json:"email"`
+		Code  string `json:"code"`
+	})
+	if err := parseBody(r.Body, data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	email := internal.NormalizeEmail(data.Email)
+	if !allowLoginCode("verify", conf.Name, email) {
+		http.Error(w, "too many attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	tok, err := datastore.FindTokenByEmail(conf.Name, email)
+	if err != nil {
+		http.Error(w, internal.ErrInvalidLoginCode.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	hash := loginCodeHash(tok.ID, strings.TrimSpace(data.Code))
+	if err := datastore.UseLoginCode(conf.Name, tok.ID, hash, time.Now()); errors.Is(err, internal.ErrInvalidLoginCode) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jwtBytes, err := m.signIn(conf, tok, r)
+	if err != nil {
+		http.Error(w, err.Error(), credentialsErrorStatus(err))
+		return
+	}
+
+	respond(w, http.StatusOK, string(jwtBytes))
+}
@@ -0,0 +1,165 @@
+package staticbackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/cache"
+	"github.com/staticbackendhq/core/config"
+	"github.com/staticbackendhq/core/email"
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+)
+
+func otpReq(t *testing.T, hf http.HandlerFunc, v interface{}) *httptest.ResponseRecorder {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/login/code", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("SB-PUBLIC-KEY", pubKey)
+
+	w := httptest.NewRecorder()
+	middleware.Chain(hf, middleware.RequireActiveBase(datastore, volatile)).ServeHTTP(w, req)
+	return w
+}
+
+func setupEmailOTP(t *testing.T, email string) (*membership, *mockMailer, internal.Token) {
+	t.Cleanup(func(c config.AppConfig, m internal.Mailer, l *cache.RateLimiter) func() {
+		return func() {
+			config.Current, emailer, otpLimiter = c, m, l
+		}
+	}(config.Current, emailer, otpLimiter))
+
+	config.Current.EmailOTP = "yes"
+	otpLimiter = cache.NewRateLimiter(100)
+
+	mm := &mockMailer{}
+	emailer = mm
+
+	m := &membership{volatile: volatile}
+
+	tok, err := datastore.FindTokenByEmail(dbName, userEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, user, err := m.createUser(dbName, tok.AccountID, email, userPassword, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, mm, user
+}
+
+func TestLoginWithCode(t *testing.T) {
+	m, mm, _ := setupEmailOTP(t, "otp@test.com")
+
+	if w := otpReq(t, m.requestLoginCode, map[string]string{"email": "OTP@test.com"}); w.Code != http.StatusOK {
+		t.Fatal(w.Body.String())
+	} else if len(mm.sent) != 1 || mm.sent[0].To != "otp@test.com" {
+		t.Fatalf("expected the code sent to the user got %v", mm.sent)
+	}
+
+	code := regexp.MustCompile(`\d{6}`).FindString(mm.sent[0].TextBody)
+	if len(code) == 0 {
+		t.Fatalf("expected a code in %s", mm.sent[0].TextBody)
+	}
+
+	verify := map[string]string{"email": "otp@test.com", "code": code}
+
+	w := otpReq(t, m.loginWithCode, verify)
+	if w.Code != http.StatusOK {
+		t.Fatal(w.Body.String())
+	}
+
+	var jwtToken string
+	if err := json.NewDecoder(w.Body).Decode(&jwtToken); err != nil {
+		t.Fatal(err)
+	} else if len(jwtToken) == 0 {
+		t.Fatal("expected a JWT")
+	}
+
+	// the code is single-use
+	if w := otpReq(t, m.loginWithCode, verify); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 for a reused code got %d", w.Code)
+	}
+
+	// an unknown email gets the same response without any email sent
+	if w := otpReq(t, m.requestLoginCode, map[string]string{"email": "nobody@test.com"}); w.Code != http.StatusOK {
+		t.Errorf("expected status 200 for an unknown email got %d", w.Code)
+	} else if len(mm.sent) != 1 {
+		t.Errorf("expected no email sent to an unknown email got %d", len(mm.sent))
+	}
+}
+
+func TestLoginWithExpiredCode(t *testing.T) {
+	m, _, user := setupEmailOTP(t, "otp-expired@test.com")
+
+	code := internal.LoginCode{
+		UserID:  user.ID,
+		Hash:    loginCodeHash(user.ID, "123456"),
+		Expires: time.Now().Add(-time.Second),
+	}
+	if err := datastore.SetLoginCode(dbName, code); err != nil {
+		t.Fatal(err)
+	}
+
+	w := otpReq(t, m.loginWithCode, map[string]string{"email": "otp-expired@test.com", "code": "123456"})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 for an expired code got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestLoginCodeRateLimit(t *testing.T) {
+	m, mm, _ := setupEmailOTP(t, "otp-limit@test.com")
+	config.Current.EmailOTPRateLimit = "2/1h"
+	parseSettings(t)
+
+	for i := 0; i < 2; i++ {
+		if w := otpReq(t, m.requestLoginCode, map[string]string{"email": "otp-limit@test.com"}); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected status 200 got %d", i+1, w.Code)
+		}
+	}
+	if w := otpReq(t, m.requestLoginCode, map[string]string{"email": "otp-limit@test.com"}); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status 429 past the limit got %d", w.Code)
+	} else if len(mm.sent) != 2 {
+		t.Errorf("expected 2 codes sent got %d", len(mm.sent))
+	}
+
+	for i := 0; i < 2; i++ {
+		otpReq(t, m.loginWithCode, map[string]string{"email": "otp-limit@test.com", "code": "000000"})
+	}
+	if w := otpReq(t, m.loginWithCode, map[string]string{"email": "otp-limit@test.com", "code": "000000"}); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status 429 past the attempts limit got %d", w.Code)
+	}
+}
+
+func TestLoginCodeRecipientThrottled(t *testing.T) {
+	m, mm, _ := setupEmailOTP(t, "otp-throttled@test.com")
+	emailer = email.NewThrottled(mm, 1, time.Hour)
+
+	// a throttled recipient gets the response of an unknown email
+	for _, addr := range []string{"otp-throttled@test.com", "otp-throttled@test.com", "otp-unknown@test.com"} {
+		if w := otpReq(t, m.requestLoginCode, map[string]string{"email": addr}); w.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200 got %d", addr, w.Code)
+		}
+	}
+
+	if len(mm.sent) != 1 {
+		t.Errorf("expected one code sent got %d", len(mm.sent))
+	}
+}
+
+func TestLoginCodeDisabled(t *testing.T) {
+	m := &membership{volatile: volatile}
+	if w := otpReq(t, m.requestLoginCode, map[string]string{"email": userEmail}); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 when disabled got %d", w.Code)
+	}
+}
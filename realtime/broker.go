@@ -192,7 +192,7 @@ func (b *Broker) getTargets(msg internal.Command) (sockets []chan internal.Comma
 		subs = append(subs, closesub)
 		b.subscriptions[msg.SID] = subs
 
-		go b.pubsub.Subscribe(sender, msg.Token, msg.Data, closesub)
+		go b.pubsub.Subscribe(sender, msg.Token, msg.Data, msg.Resume, closesub)
 
 		joinedMsg := internal.Command{
 			Type:    internal.MsgTypeJoined,
@@ -0,0 +1,61 @@
+package realtime
+
+import "sync"
+
+// Connections counts the open realtime connections per base, SSE and
+// websocket alike.
+type Connections struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// NewConnections returns an empty Connections.
+func NewConnections() *Connections {
+	return &Connections{counts: make(map[string]int)}
+}
+
+// Open counts a new connection of base. It returns false without counting
+// it when base already has limit connections, a zero limit means no limit.
+func (c *Connections) Open(base string, limit int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if limit > 0 && c.counts[base] >= limit {
+		return false
+	}
+
+	c.counts[base]++
+	return true
+}
+
+// Close removes a connection of base counted by Open.
+func (c *Connections) Close(base string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts[base] <= 1 {
+		delete(c.counts, base)
+		return
+	}
+	c.counts[base]--
+}
+
+// Count returns the open connections of base.
+func (c *Connections) Count(base string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.counts[base]
+}
+
+// Total returns the open connections of all bases.
+func (c *Connections) Total() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	total := 0
+	for _, n := range c.counts {
+		total += n
+	}
+	return total
+}
@@ -0,0 +1,32 @@
+package realtime
+
+import "testing"
+
+func TestConnections(t *testing.T) {
+	c := NewConnections()
+
+	for i := 0; i < 2; i++ {
+		if !c.Open("base1", 2) {
+			t.Fatalf("expected connection %d to be under the limit", i+1)
+		}
+	}
+
+	if c.Open("base1", 2) {
+		t.Errorf("expected the 3rd connection to be refused")
+	} else if !c.Open("base2", 2) {
+		t.Errorf("expected another base to have its own limit")
+	} else if n := c.Count("base1"); n != 2 {
+		t.Errorf("expected the refused connection not to be counted got %d", n)
+	}
+
+	c.Close("base1")
+	if !c.Open("base1", 2) {
+		t.Errorf("expected a closed connection to free its slot")
+	}
+
+	if !c.Open("base3", 0) {
+		t.Errorf("expected a zero limit to allow all connections")
+	} else if n := c.Total(); n != 4 {
+		t.Errorf("expected 4 open connections got %d", n)
+	}
+}
@@ -0,0 +1,352 @@
+package staticbackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/config"
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRealtimeResume(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.RealtimeHistory = "10"
+	parseSettings(t)
+
+	channel := "resume-" + datastore.NewID()
+
+	publish := func(data string) {
+		msg := internal.Command{Type: internal.MsgTypeChanIn, Channel: channel, Data: data}
+		if err := volatile.Publish(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	receive := func(send chan internal.Command) internal.Command {
+		select {
+		case msg := <-send:
+			return msg
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for a message")
+		}
+		return internal.Command{}
+	}
+
+	send := make(chan internal.Command, 10)
+	closeSub := make(chan bool)
+	go volatile.Subscribe(send, "", channel, "", closeSub)
+
+	if msg := receive(send); msg.Type != internal.MsgTypeResume || len(msg.Resume) == 0 {
+		t.Fatalf("expected a resume position once subscribed got %v", msg)
+	}
+
+	publish("1")
+	publish("2")
+
+	var last string
+	for _, expected := range []string{"1", "2"} {
+		msg := receive(send)
+		if msg.Data != expected || len(msg.Resume) == 0 {
+			t.Fatalf("expected message %s with its position got %v", expected, msg)
+		}
+		last = msg.Resume
+	}
+
+	// 3 and 4 are published while the client is disconnected
+	closeSub <- true
+	publish("3")
+	publish("4")
+
+	send = make(chan internal.Command, 10)
+	closeSub = make(chan bool)
+	defer close(closeSub)
+	go volatile.Subscribe(send, "", channel, last, closeSub)
+
+	var got []string
+	for msg := receive(send); msg.Type != internal.MsgTypeResume; msg = receive(send) {
+		got = append(got, msg.Data)
+	}
+
+	publish("5")
+	got = append(got, receive(send).Data)
+
+	if s := strings.Join(got, ","); s != "3,4,5" {
+		t.Errorf("expected 3,4,5 after resuming got %s", s)
+	}
+
+	select {
+	case msg := <-send:
+		t.Errorf("expected no duplicate got %v", msg)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestRealtimeOriginSSE(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.RealtimeCheckOrigin = "yes"
+
+	h := middleware.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), middleware.RequireActiveBase(datastore, volatile), checkRealtimeOrigin)
+
+	tests := []struct {
+		origin string
+		status int
+	}{
+		{"http://localhost:3000", http.StatusOK},
+		{"", http.StatusOK},
+		{"https://evil.example.com", http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", "/sse/connect", nil)
+		req.Header.Set("SB-PUBLIC-KEY", pubKey)
+		if len(tc.origin) > 0 {
+			req.Header.Set("Origin", tc.origin)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tc.status {
+			t.Errorf("%q: expected status %d got %d", tc.origin, tc.status, w.Code)
+		}
+	}
+}
+
+func TestRealtimeOriginWebsocket(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.RealtimeCheckOrigin = "yes"
+
+	tests := []struct {
+		origin string
+		status int
+	}{
+		{"http://localhost:3000", http.StatusSwitchingProtocols},
+		{"https://evil.example.com", http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		header := http.Header{}
+		header.Set("Origin", tc.origin)
+
+		conn, resp, err := websocket.DefaultDialer.Dial(wsURL, header)
+		if err == nil {
+			conn.Close()
+		}
+
+		if resp == nil {
+			t.Fatalf("%q: %v", tc.origin, err)
+		} else if resp.StatusCode != tc.status {
+			t.Errorf("%q: expected status %d got %d", tc.origin, tc.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestRealtimeWebsocketPublicKey(t *testing.T) {
+	tests := []struct {
+		url    string
+		status int
+	}{
+		{strings.Split(wsURL, "?")[0], http.StatusUnauthorized},
+		{strings.Split(wsURL, "?")[0] + "?sbpk=" + datastore.NewID(), http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		conn, resp, err := websocket.DefaultDialer.Dial(tc.url, nil)
+		if err == nil {
+			conn.Close()
+			t.Errorf("%s: expected the handshake to be refused", tc.url)
+			continue
+		}
+
+		if resp == nil {
+			t.Fatalf("%s: %v", tc.url, err)
+		} else if resp.StatusCode != tc.status {
+			t.Errorf("%s: expected status %d got %d", tc.url, tc.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestRealtimeUserChannelUnauthenticated(t *testing.T) {
+	conf, err := datastore.FindDatabase(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var init internal.Command
+	if err := conn.ReadJSON(&init); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, channel := range []string{internal.UserChannelPrefix, internal.UserChannel(conf.ID)} {
+		msg := internal.Command{SID: init.Data, Type: internal.MsgTypeJoin, Data: channel}
+		if err := conn.WriteJSON(msg); err != nil {
+			t.Fatal(err)
+		}
+
+		var reply internal.Command
+		if err := conn.ReadJSON(&reply); err != nil {
+			t.Fatal(err)
+		} else if reply.Type != internal.MsgTypeError {
+			t.Errorf("expected joining %s to be refused got %v", channel, reply)
+		}
+	}
+
+	m := &membership{volatile: volatile}
+	if _, _, err := m.createAccountAndUser(conf, "user-channel-"+datastore.NewID()+"@test.com", userPassword, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+
+	var msg internal.Command
+	if err := conn.ReadJSON(&msg); err == nil {
+		t.Errorf("expected nothing for an unauthenticated socket got %v", msg)
+	}
+}
+
+func TestRealtimeSessionBinding(t *testing.T) {
+	base, err := datastore.FindDatabaseByKey(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := datastore.SetSessionBinding(base.ID, internal.SessionBindingUserAgent); err != nil {
+		t.Fatal(err)
+	}
+	middleware.Bases.Invalidate(pubKey)
+
+	tok, err := datastore.FindTokenByEmail(dbName, userEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := internal.UserToken{ID: tok.ID, Token: tok.Token}.Key()
+
+	defer func() {
+		datastore.SetSessionBinding(base.ID, internal.SessionBindingNone)
+		middleware.Bases.Invalidate(pubKey)
+		// the base cached by the login is bound
+		base.SessionBinding = internal.SessionBindingNone
+		volatile.SetTyped("base:"+key, base)
+	}()
+
+	m := &membership{volatile: volatile}
+
+	b, err := json.Marshal(internal.Login{Email: userEmail, Password: userPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/login", bytes.NewReader(b))
+	req.Header.Set("SB-PUBLIC-KEY", pubKey)
+	req.Header.Set("User-Agent", "bound-browser")
+	w := httptest.NewRecorder()
+
+	middleware.Chain(http.HandlerFunc(m.login), middleware.RequireActiveBase(datastore, volatile)).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatal(w.Body.String())
+	}
+
+	var token string
+	if err := json.NewDecoder(w.Body).Decode(&token); err != nil {
+		t.Fatal(err)
+	}
+
+	auth := func(userAgent string) internal.Command {
+		header := http.Header{}
+		header.Set("User-Agent", userAgent)
+
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+		var init internal.Command
+		if err := conn.ReadJSON(&init); err != nil {
+			t.Fatal(err)
+		}
+
+		msg := internal.Command{SID: init.Data, Type: internal.MsgTypeAuth, Data: token}
+		if err := conn.WriteJSON(msg); err != nil {
+			t.Fatal(err)
+		}
+
+		var reply internal.Command
+		if err := conn.ReadJSON(&reply); err != nil {
+			t.Fatal(err)
+		}
+		return reply
+	}
+
+	if reply := auth("bound-browser"); reply.Type != internal.MsgTypeToken {
+		t.Errorf("expected the bound client to authenticate got %v", reply)
+	}
+	if reply := auth("another-browser"); reply.Type != internal.MsgTypeError {
+		t.Errorf("expected the token to be refused for another client got %v", reply)
+	}
+}
+
+func TestRealtimeWebsocketConnectionLimit(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	conf, err := datastore.FindDatabase(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the sockets of the other tests are released once the hub unregisters
+	// them
+	for deadline := time.Now().Add(2 * time.Second); realtimeConnections.Count(conf.ID) > 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected no open connection got %d", realtimeConnections.Count(conf.ID))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	config.Current.MaxRealtimeConnections = "default:1"
+	parseSettings(t)
+
+	// the connections are counted at the handshake, before authenticating
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if extra, resp, err := websocket.DefaultDialer.Dial(wsURL, nil); err == nil {
+		extra.Close()
+		t.Error("expected the connection past the limit to be refused")
+	} else if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected status 429 past the limit got %v", err)
+	}
+
+	conn.Close()
+
+	for deadline := time.Now().Add(2 * time.Second); realtimeConnections.Count(conf.ID) > 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the closed socket to be released")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
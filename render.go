@@ -9,6 +9,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/staticbackendhq/core/middleware"
 )
 
 var (
@@ -65,6 +67,8 @@ type ViewData struct {
 	ActiveMenu string
 	Flash      *Flash
 	Data       interface{}
+	// CSRFToken the forms include in a csrf_token field
+	CSRFToken string
 }
 
 func render(w http.ResponseWriter, r *http.Request, view string, data interface{}, flash *Flash) {
@@ -76,6 +80,7 @@ func renderWithMenu(w http.ResponseWriter, r *http.Request, view string, data in
 		ActiveMenu: menu,
 		Data:       data,
 		Flash:      flash,
+		CSRFToken:  middleware.CSRFToken(r),
 	}
 
 	tmpl, ok := views[view]
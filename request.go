@@ -0,0 +1,131 @@
+package staticbackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// validator is implemented by the request structs checking their values
+// once decoded.
+type validator interface {
+	Validate() error
+}
+
+// decodeRequest decodes r into the struct pointed by v based on the request
+// content type: a JSON body, an url-encoded or multipart form, or the query
+// string when there's none. Form and query values are matched to the
+// fields by their json tag so the same struct is used for all of them.
+func decodeRequest(r *http.Request, v interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "application/json":
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+			return fmt.Errorf("invalid JSON body: %w", err)
+		}
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return err
+		} else if err := decodeValues(r.Form, v); err != nil {
+			return err
+		}
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			return err
+		} else if err := decodeValues(r.Form, v); err != nil {
+			return err
+		}
+	default:
+		if err := decodeValues(r.URL.Query(), v); err != nil {
+			return err
+		}
+	}
+
+	if val, ok := v.(validator); ok {
+		return val.Validate()
+	}
+	return nil
+}
+
+// decodeValues sets the fields of the struct pointed by v from values. The
+// supported field types are strings, booleans, numbers and string slices.
+func decodeValues(values url.Values, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot decode values into %T", v)
+	}
+
+	rv = rv.Elem()
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if len(f.PkgPath) > 0 {
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		} else if len(name) == 0 {
+			name = f.Name
+		}
+
+		vals, ok := values[name]
+		if !ok || len(vals) == 0 {
+			continue
+		}
+
+		if err := setValue(rv.Field(i), vals); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setValue(field reflect.Value, vals []string) error {
+	s := vals[0]
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(n)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", field.Type())
+		}
+		field.Set(reflect.ValueOf(append([]string(nil), vals...)).Convert(field.Type()))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package staticbackend
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type decodeTestRequest struct {
+	Name   string   `json:"name"`
+	Age    int      `json:"age"`
+	Active bool     `json:"active"`
+	Tags   []string `json:"tags"`
+}
+
+func (req *decodeTestRequest) Validate() error {
+	if len(req.Name) == 0 {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func TestDecodeRequest(t *testing.T) {
+	expected := decodeTestRequest{Name: "dominic", Age: 42, Active: true, Tags: []string{"a", "b"}}
+
+	values := url.Values{}
+	values.Set("name", "dominic")
+	values.Set("age", "42")
+	values.Set("active", "true")
+	values["tags"] = []string{"a", "b"}
+
+	var multipartBody bytes.Buffer
+	mw := multipart.NewWriter(&multipartBody)
+	for k, vals := range values {
+		for _, v := range vals {
+			mw.WriteField(k, v)
+		}
+	}
+	mw.Close()
+
+	jsonReq := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"dominic","age":42,"active":true,"tags":["a","b"]}`))
+	jsonReq.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	formReq := httptest.NewRequest("POST", "/", strings.NewReader(values.Encode()))
+	formReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	multipartReq := httptest.NewRequest("POST", "/", &multipartBody)
+	multipartReq.Header.Set("Content-Type", mw.FormDataContentType())
+
+	queryReq := httptest.NewRequest("GET", "/?"+values.Encode(), nil)
+
+	requests := map[string]*http.Request{
+		"json":      jsonReq,
+		"form":      formReq,
+		"multipart": multipartReq,
+		"query":     queryReq,
+	}
+
+	for kind, r := range requests {
+		var req decodeTestRequest
+		if err := decodeRequest(r, &req); err != nil {
+			t.Errorf("%s: %v", kind, err)
+		} else if req.Name != expected.Name || req.Age != expected.Age || req.Active != expected.Active || strings.Join(req.Tags, ",") != "a,b" {
+			t.Errorf("%s: expected %v got %v", kind, expected, req)
+		}
+	}
+}
+
+func TestDecodeRequestErrors(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?name=dominic&age=old", nil)
+	if err := decodeRequest(r, &decodeTestRequest{}); err == nil {
+		t.Errorf("expected an error for an invalid number")
+	}
+
+	r = httptest.NewRequest("GET", "/?age=42", nil)
+	if err := decodeRequest(r, &decodeTestRequest{}); err == nil || err.Error() != "name is required" {
+		t.Errorf("expected the validation error got %v", err)
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader("{"))
+	r.Header.Set("Content-Type", "application/json")
+	if err := decodeRequest(r, &decodeTestRequest{}); err == nil {
+		t.Errorf("expected an error for an invalid JSON body")
+	}
+}
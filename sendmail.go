@@ -1,9 +1,13 @@
 package staticbackend
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"sort"
 
+	"github.com/staticbackendhq/core/config"
 	"github.com/staticbackendhq/core/email"
 	"github.com/staticbackendhq/core/internal"
 	"github.com/staticbackendhq/core/middleware"
@@ -26,8 +30,8 @@ func sudoSendMail(w http.ResponseWriter, r *http.Request) {
 		data.HTMLBody = data.TextBody
 	}
 
-	if err := emailer.Send(data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := emailer.Send(withMailDefaults(data)); err != nil {
+		http.Error(w, err.Error(), mailErrorStatus(err))
 		return
 	}
 
@@ -44,3 +48,212 @@ func sudoSendMail(w http.ResponseWriter, r *http.Request) {
 
 	respond(w, http.StatusOK, true)
 }
+
+// sudoSendTestMail sends a test email to the ?to= address to verify the
+// email provider configuration.
+func sudoSendTestMail(w http.ResponseWriter, r *http.Request) {
+	to := r.URL.Query().Get("to")
+	if len(to) == 0 {
+		http.Error(w, "missing to parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := sendTestEmail(emailer, to); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, http.StatusOK, true)
+}
+
+// SendTestEmail sends a test email to the to address using the email
+// provider of c, it's used by the CLI to verify the configuration.
+func SendTestEmail(c config.AppConfig, to string) error {
+	settings, err := config.ParseSettings(c)
+	if err != nil {
+		return err
+	}
+
+	c.Settings = settings
+	config.Current = c
+	return sendTestEmail(newMailer(c.MailProvider), to)
+}
+
+func sendTestEmail(m internal.Mailer, to string) error {
+	if err := m.Ping(); err != nil {
+		return fmt.Errorf("email provider is unreachable: %w", err)
+	}
+
+	body := "<p>This is a test email from your StaticBackend instance.</p>"
+
+	data := internal.SendMailData{
+		From:     config.Current.FromEmail,
+		FromName: config.Current.FromName,
+		To:       to,
+		Subject:  "StaticBackend test email",
+		HTMLBody: body,
+		TextBody: email.StripHTML(body),
+	}
+	return m.Send(withMailDefaults(data))
+}
+
+// previewEmail is an email sudoPreviewMail renders with its sample data.
+type previewEmail struct {
+	template email.Template
+	sample   map[string]string
+}
+
+// previewEmails are the emails sent by the server keyed by their Name.
+var previewEmails = map[string]previewEmail{
+	accountCreatedEmail.Name: {accountCreatedEmail, map[string]string{
+		"PublicKey": "pk_sample",
+		"Email":     "user@example.com",
+		"Password":  "sample-password",
+		"RootToken": "account|user|root-token",
+	}},
+	newDeviceLoginEmail.Name: {newDeviceLoginEmail, map[string]string{
+		"IP":        "203.0.113.10",
+		"Country":   "CA",
+		"UserAgent": "Mozilla/5.0 (X11; Linux x86_64) Firefox/115.0",
+		"Time":      "Mon, 02 Jan 2006 15:04:05 UTC",
+	}},
+	emailChangeEmail.Name: {emailChangeEmail, map[string]string{
+		"Email": "user@example.com",
+		"Link":  "https://example.com/me/email/confirm?token=sample",
+	}},
+	loginCodeEmail.Name: {loginCodeEmail, map[string]string{
+		"Email":   "user@example.com",
+		"Code":    "123456",
+		"Expires": "10m0s",
+	}},
+}
+
+type emailPreview struct {
+	Name     string `json:"name"`
+	Subject  string `json:"subject"`
+	FromName string `json:"fromName"`
+	HTMLBody string `json:"htmlBody"`
+	TextBody string `json:"textBody"`
+}
+
+// sudoPreviewMail renders an email of the server without sending it, the
+// supplied data replaces the sample values. The subject and from-name are
+// the ones of the base, see EMAIL_SUBJECTS and EMAIL_FROM_NAMES.
+func sudoPreviewMail(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var data struct {
+		Name string            `json:"name"`
+		Data map[string]string `json:"data"`
+	}
+	if err := parseBody(r.Body, &data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pe, ok := previewEmails[data.Name]
+	if !ok {
+		var names []string
+		for name := range previewEmails {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		msg := fmt.Sprintf("unknown email %q, use one of %v", data.Name, names)
+		http.Error(w, msg, http.StatusNotFound)
+		return
+	}
+
+	values := make(map[string]string)
+	for k, v := range pe.sample {
+		values[k] = v
+	}
+	for k, v := range data.Data {
+		values[k] = v
+	}
+
+	htmlBody, textBody, err := pe.template.Render(values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	subject, fromName, err := mailBranding(pe.template, conf.Name, values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	preview := emailPreview{
+		Name:     pe.template.Name,
+		Subject:  subject,
+		FromName: fromName,
+		HTMLBody: htmlBody,
+		TextBody: textBody,
+	}
+	respond(w, http.StatusOK, preview)
+}
+
+// mailErrorStatus returns the status of a failed send, a 429 when the
+// recipient is throttled.
+func mailErrorStatus(err error) int {
+	if errors.Is(err, email.ErrRecipientThrottled) {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+// mailBranding returns the subject and from-name of the email t sent for
+// the base dbName from EMAIL_SUBJECTS and EMAIL_FROM_NAMES, the Subject of
+// t and FROM_NAME otherwise. The subject is executed with data, its Base
+// key is set to dbName.
+func mailBranding(t email.Template, dbName string, data map[string]string) (subject, fromName string, err error) {
+	subjects, fromNames := config.Current.Settings.EmailSubjects, config.Current.Settings.EmailFromNames
+
+	subject = t.Subject
+	if v, ok := brandingValue(subjects, dbName+"/"+t.Name, t.Name); ok {
+		subject = v
+	}
+
+	fromName = config.Current.FromName
+	if v, ok := brandingValue(fromNames, dbName+"/"+t.Name, dbName, t.Name); ok {
+		fromName = v
+	}
+
+	data["Base"] = dbName
+	subject, err = email.RenderSubject(subject, data)
+	return
+}
+
+// brandingValue returns the value of the first of keys having one.
+func brandingValue(entries map[string]string, keys ...string) (string, bool) {
+	for _, key := range keys {
+		if v, ok := entries[key]; ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// withMailDefaults sets the return-path and headers from the config when
+// they are not already set.
+func withMailDefaults(data internal.SendMailData) internal.SendMailData {
+	if len(data.ReturnPath) == 0 {
+		data.ReturnPath = config.Current.MailReturnPath
+	}
+
+	headers := config.Current.Settings.MailHeaders
+	if len(headers) > 0 && data.Headers == nil {
+		data.Headers = make(map[string]string)
+	}
+	for k, v := range headers {
+		if _, ok := data.Headers[k]; !ok {
+			data.Headers[k] = v
+		}
+	}
+	return data
+}
@@ -1,9 +1,15 @@
 package staticbackend
 
 import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/staticbackendhq/core/config"
+	"github.com/staticbackendhq/core/email"
 	"github.com/staticbackendhq/core/internal"
 )
 
@@ -22,3 +28,153 @@ func Test_Sendmail(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+type mockMailer struct {
+	pingErr error
+	sent    []internal.SendMailData
+}
+
+func (m *mockMailer) Send(data internal.SendMailData) error {
+	m.sent = append(m.sent, data)
+	return nil
+}
+
+func (m *mockMailer) Ping() error {
+	return m.pingErr
+}
+
+func TestPingEmailProvider(t *testing.T) {
+	defer func(m internal.Mailer) { emailer = m }(emailer)
+
+	emailer = &mockMailer{}
+
+	w := httptest.NewRecorder()
+	ping(w, httptest.NewRequest("GET", "/ping", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("reachable: expected status 200 got %d", w.Code)
+	}
+
+	emailer = &mockMailer{pingErr: errors.New("unreachable")}
+
+	w = httptest.NewRecorder()
+	ping(w, httptest.NewRequest("GET", "/ping", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("unreachable: expected status 500 got %d", w.Code)
+	} else if !strings.Contains(w.Body.String(), "email provider") {
+		t.Errorf("expected email provider to be named in %q", w.Body.String())
+	}
+}
+
+func TestSendTestEmail(t *testing.T) {
+	m := &mockMailer{}
+	if err := sendTestEmail(m, "test@example.com"); err != nil {
+		t.Fatal(err)
+	} else if len(m.sent) != 1 || m.sent[0].To != "test@example.com" {
+		t.Errorf("expected one test email to test@example.com got %v", m.sent)
+	}
+
+	m = &mockMailer{pingErr: errors.New("unreachable")}
+	if err := sendTestEmail(m, "test@example.com"); err == nil {
+		t.Errorf("expected an error when the provider is unreachable")
+	} else if len(m.sent) != 0 {
+		t.Errorf("expected no email sent when the provider is unreachable")
+	}
+}
+
+func TestSendTestEmailMailDefaults(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.MailReturnPath = "bounces@test.com"
+	config.Current.MailHeaders = "X-Campaign:unittest"
+	parseSettings(t)
+
+	m := &mockMailer{}
+	if err := sendTestEmail(m, "unit@test.com"); err != nil {
+		t.Fatal(err)
+	} else if len(m.sent) != 1 {
+		t.Fatalf("expected 1 email sent got %d", len(m.sent))
+	}
+
+	sent := m.sent[0]
+	if sent.ReturnPath != "bounces@test.com" {
+		t.Errorf("expected return-path bounces@test.com got %s", sent.ReturnPath)
+	} else if sent.Headers["X-Campaign"] != "unittest" {
+		t.Errorf("expected X-Campaign header got %v", sent.Headers)
+	}
+}
+
+func TestPreviewMail(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+	defer func(m internal.Mailer) { emailer = m }(emailer)
+
+	mm := &mockMailer{}
+	emailer = mm
+
+	config.Current.EmailSubjects = "login-code=Your code {{.Code}}"
+	parseSettings(t)
+
+	data := map[string]interface{}{
+		"name": "login-code",
+		"data": map[string]string{"Code": "987654"},
+	}
+	resp := dbReq(t, sudoPreviewMail, "POST", "/sudo/sendmail/preview", data, true)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	var preview emailPreview
+	if err := parseBody(resp.Body, &preview); err != nil {
+		t.Fatal(err)
+	}
+
+	if preview.Subject != "Your code 987654" {
+		t.Errorf("expected the subject to use the supplied code got %q", preview.Subject)
+	} else if !strings.Contains(preview.HTMLBody, "<strong>987654</strong>") {
+		t.Errorf("expected the HTML to use the supplied code got %q", preview.HTMLBody)
+	} else if !strings.Contains(preview.TextBody, "987654") || strings.Contains(preview.TextBody, "<strong>") {
+		t.Errorf("expected the text body to use the supplied code got %q", preview.TextBody)
+	} else if !strings.Contains(preview.HTMLBody, "10m0s") {
+		t.Errorf("expected the sample value for the missing data got %q", preview.HTMLBody)
+	} else if len(mm.sent) != 0 {
+		t.Errorf("expected no email sent got %d", len(mm.sent))
+	}
+
+	data["name"] = "unknown"
+	resp2 := dbReq(t, sudoPreviewMail, "POST", "/sudo/sendmail/preview", data, true)
+	defer resp2.Body.Close()
+
+	if resp2.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown email got %d", resp2.StatusCode)
+	}
+}
+
+func TestSendMailRecipientThrottled(t *testing.T) {
+	defer func(m internal.Mailer) { emailer = m }(emailer)
+
+	mm := &mockMailer{}
+	emailer = email.NewThrottled(mm, 1, time.Hour)
+
+	data := internal.SendMailData{
+		To:      "throttled-" + datastore.NewID() + "@example.com",
+		Subject: "reset your password",
+		Body:    "<p>reset</p>",
+	}
+
+	resp := dbReq(t, sudoSendMail, "POST", "/sudo/sendmail", data, true)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	resp2 := dbReq(t, sudoSendMail, "POST", "/sudo/sendmail", data, true)
+	defer resp2.Body.Close()
+
+	if resp2.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected status 429 for a repeated send got %d", resp2.StatusCode)
+	} else if len(mm.sent) != 1 {
+		t.Errorf("expected one email sent got %d", len(mm.sent))
+	}
+}
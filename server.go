@@ -15,18 +15,22 @@ import (
 	"time"
 
 	"github.com/staticbackendhq/core/cache"
+	"github.com/staticbackendhq/core/captcha"
 	"github.com/staticbackendhq/core/config"
 	"github.com/staticbackendhq/core/database/memory"
 	"github.com/staticbackendhq/core/database/mongo"
 	"github.com/staticbackendhq/core/database/postgresql"
+	"github.com/staticbackendhq/core/database/querycount"
+	"github.com/staticbackendhq/core/database/slowquery"
 	"github.com/staticbackendhq/core/email"
+	"github.com/staticbackendhq/core/events"
 	"github.com/staticbackendhq/core/function"
 	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/jobs"
 	"github.com/staticbackendhq/core/middleware"
 	"github.com/staticbackendhq/core/realtime"
 	"github.com/staticbackendhq/core/storage"
 
-	"github.com/stripe/stripe-go/v72"
 	mongodrv "go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -36,8 +40,8 @@ import (
 )
 
 const (
-	AppEnvDev  = "dev"
-	AppEnvProd = "prod"
+	AppEnvDev  = config.AppEnvDev
+	AppEnvProd = config.AppEnvProd
 )
 
 var (
@@ -47,11 +51,24 @@ var (
 	storer    internal.Storer
 )
 
+// store returns the datastore counting its operations in the query stats
+// of r when DEBUG_QUERY_HEADERS is enabled, see middleware.QueryStats.
+func store(r *http.Request) internal.Persister {
+	if qc, ok := datastore.(*querycount.Persister); ok {
+		return qc.WithContext(r.Context())
+	}
+	return datastore
+}
+
 // Start starts the web server and all dependencies services
 func Start(c config.AppConfig) {
+	if err := config.Validate(&c); err != nil {
+		log.Fatal(err)
+	}
+
 	config.Current = c
 
-	stripe.Key = config.Current.StripeKey
+	initStripe(config.Current)
 
 	if err := loadTemplates(); err != nil {
 		// if we're running from the CLI, no need to load templates
@@ -61,6 +78,7 @@ func Start(c config.AppConfig) {
 	}
 
 	initServices(c.DatabaseURL)
+	runBaseMigrations()
 
 	// websockets
 	hub := newHub(volatile)
@@ -80,7 +98,7 @@ func Start(c config.AppConfig) {
 				Token:     key,
 			}
 
-			if err := volatile.SetTyped(key, a); err != nil {
+			if err := middleware.AuthTokens(volatile).SetAuth(key, a); err != nil {
 				return key, err
 			}
 
@@ -93,13 +111,13 @@ func Start(c config.AppConfig) {
 		}
 
 		// set base:token useful when executing pubsub event message / function
-		conf, ok := ctx.Value(middleware.ContextBase).(internal.BaseConfig)
-		if !ok {
-			return "", errors.New("could not find base config")
+		conf, err := middleware.BaseFromContext(ctx)
+		if err != nil {
+			return "", err
 		}
 
 		//TODO: Lots of repetition of this, needs to be refactor
-		if err := volatile.SetTyped(key, auth); err != nil {
+		if err := middleware.AuthTokens(volatile).SetAuth(key, auth); err != nil {
 			return "", err
 		}
 		if err := volatile.SetTyped("base:"+key, conf); err != nil {
@@ -119,40 +137,91 @@ func Start(c config.AppConfig) {
 
 	pubWithDB := []middleware.Middleware{
 		middleware.Cors(),
-		middleware.WithDB(datastore, volatile),
+		middleware.RequireActiveBase(datastore, volatile),
 	}
 
 	stdAuth := []middleware.Middleware{
 		middleware.Cors(),
-		middleware.WithDB(datastore, volatile),
+		middleware.RequireActiveBase(datastore, volatile),
 		middleware.RequireAuth(datastore, volatile),
 	}
 
 	stdRoot := []middleware.Middleware{
-		middleware.WithDB(datastore, volatile),
+		middleware.RequireActiveBase(datastore, volatile),
 		middleware.RequireRoot(datastore),
 	}
 
+	billingRoot := []middleware.Middleware{
+		middleware.AllowInactiveBase(datastore, volatile),
+		middleware.RequireRoot(datastore),
+	}
+
+	dbAuth := stdAuth
+	if len(c.CaptchaCollections) > 0 {
+		dbAuth = []middleware.Middleware{
+			middleware.Cors(),
+			middleware.RequireActiveBase(datastore, volatile),
+			middleware.RequireAuth(datastore, volatile),
+			middleware.RequireCaptcha(newCaptchaVerifier(c), strings.Split(c.CaptchaCollections, ",")),
+		}
+	}
+
+	// the aliases of the base are resolved between RequireActiveBase and
+	// RequireAuth, the first two middlewares of stdAuth and dbAuth
+	withAliases := func(mws []middleware.Middleware) []middleware.Middleware {
+		aliased := append([]middleware.Middleware{}, mws[:2]...)
+		aliased = append(aliased, middleware.ResolveAliases())
+		return append(aliased, mws[2:]...)
+	}
+	withFeature := func(mws []middleware.Middleware, feature string) []middleware.Middleware {
+		return append(append([]middleware.Middleware{}, mws...), middleware.RequireFeature(feature))
+	}
+	withCSRF := func(mws []middleware.Middleware) []middleware.Middleware {
+		if !strings.EqualFold(c.CSRFProtection, "yes") {
+			return mws
+		}
+		return append(append([]middleware.Middleware{}, mws...), middleware.CSRF(c.Settings.CSRFTrustedOrigins))
+	}
+
 	m := &membership{volatile: volatile}
 
 	http.Handle("/login", middleware.Chain(http.HandlerFunc(m.login), pubWithDB...))
+	http.Handle("/login/token", middleware.Chain(http.HandlerFunc(m.loginToken), pubWithDB...))
+	http.Handle("/login/code", middleware.Chain(http.HandlerFunc(m.requestLoginCode), pubWithDB...))
+	http.Handle("/login/code/verify", middleware.Chain(http.HandlerFunc(m.loginWithCode), pubWithDB...))
 	http.Handle("/register", middleware.Chain(http.HandlerFunc(m.register), pubWithDB...))
 	http.Handle("/email", middleware.Chain(http.HandlerFunc(m.emailExists), pubWithDB...))
 	http.Handle("/password/resetcode", middleware.Chain(http.HandlerFunc(m.setResetCode), stdRoot...))
 	http.Handle("/password/reset", middleware.Chain(http.HandlerFunc(m.resetPassword), pubWithDB...))
+	http.Handle("/account/logins", middleware.Chain(http.HandlerFunc(m.logins), stdAuth...))
+	http.Handle("/account/tokens", middleware.Chain(http.HandlerFunc(m.tokens), stdAuth...))
+	http.Handle("/account/loginalerts", middleware.Chain(http.HandlerFunc(m.loginAlerts), stdAuth...))
+	http.Handle("/me", middleware.Chain(http.HandlerFunc(m.me), stdAuth...))
+	http.Handle("/me/email", middleware.Chain(http.HandlerFunc(m.changeEmail), stdAuth...))
+	http.Handle("/me/email/confirm", middleware.Chain(http.HandlerFunc(m.confirmEmailChange), pubWithDB...))
 	//http.Handle("/setrole", chain(http.HandlerFunc(setRole), withDB))
 
 	http.Handle("/sudogettoken/", middleware.Chain(http.HandlerFunc(m.sudoGetTokenFromAccountID), stdRoot...))
+	http.Handle("/sudo/impersonate", middleware.Chain(http.HandlerFunc(m.sudoImpersonate), stdRoot...))
+	http.Handle("/sudo/promote", middleware.Chain(http.HandlerFunc(m.promote), stdRoot...))
+	http.Handle("/sudo/demote", middleware.Chain(http.HandlerFunc(m.demote), stdRoot...))
+	http.Handle("/sudo/devices", middleware.Chain(http.HandlerFunc(m.provisionDevices), stdRoot...))
+	http.Handle("/sudo/introspect", middleware.Chain(http.HandlerFunc(m.introspect), stdRoot...))
 
 	// database routes
-	http.Handle("/db/", middleware.Chain(http.HandlerFunc(database.dbreq), stdAuth...))
-	http.Handle("/query/", middleware.Chain(http.HandlerFunc(database.query), stdAuth...))
+	http.Handle("/db/", middleware.Chain(http.HandlerFunc(database.dbreq), withAliases(dbAuth)...))
+	http.Handle("/query/", middleware.Chain(http.HandlerFunc(database.query), withAliases(stdAuth)...))
 	http.Handle("/inc/", middleware.Chain(http.HandlerFunc(database.increase), stdAuth...))
 	http.Handle("/sudoquery/", middleware.Chain(http.HandlerFunc(database.query), stdRoot...))
+	http.Handle("/sudoexplain/", middleware.Chain(http.HandlerFunc(database.explain), stdRoot...))
 	http.Handle("/sudolistall/", middleware.Chain(http.HandlerFunc(database.listCollections), stdRoot...))
+	http.Handle("/sudo/collections", middleware.Chain(http.HandlerFunc(database.collections), stdRoot...))
+	http.Handle("/sudo/stats", middleware.Chain(http.HandlerFunc(database.stats), stdRoot...))
+	http.Handle("/sudo/collection", middleware.Chain(http.HandlerFunc(database.dropCollection), stdRoot...))
 	http.Handle("/sudo/index", middleware.Chain(http.HandlerFunc(database.index), stdRoot...))
 	http.Handle("/sudo/", middleware.Chain(http.HandlerFunc(database.dbreq), stdRoot...))
 	http.Handle("/newid", middleware.Chain(http.HandlerFunc(database.newID), stdAuth...))
+	http.Handle("/collections", middleware.Chain(http.HandlerFunc(database.collections), stdAuth...))
 
 	// forms routes
 	http.Handle("/postform/", middleware.Chain(http.HandlerFunc(submitForm), pubWithDB...))
@@ -161,28 +230,57 @@ func Start(c config.AppConfig) {
 	// storage
 	http.Handle("/storage/upload", middleware.Chain(http.HandlerFunc(upload), stdAuth...))
 	http.Handle("/sudostorage/delete", middleware.Chain(http.HandlerFunc(deleteFile), stdRoot...))
+	http.Handle("/sudostorage/limits", middleware.Chain(http.HandlerFunc(sudoUploadLimits), stdRoot...))
 
 	// sudo actions
 	http.Handle("/sudo/sendmail", middleware.Chain(http.HandlerFunc(sudoSendMail), stdRoot...))
+	http.Handle("/sudo/sendmail/test", middleware.Chain(http.HandlerFunc(sudoSendTestMail), stdRoot...))
+	http.Handle("/sudo/sendmail/preview", middleware.Chain(http.HandlerFunc(sudoPreviewMail), stdRoot...))
 	http.Handle("/sudo/cache", middleware.Chain(http.HandlerFunc(sudoCache), stdRoot...))
+	http.Handle("/sudo/realtime", middleware.Chain(http.HandlerFunc(realtimeStats), stdRoot...))
+	http.Handle("/sudo/webhooks", middleware.Chain(http.HandlerFunc(webhooks), stdRoot...))
 
 	// account
 	acct := &accounts{membership: m}
-	http.Handle("/account/init", middleware.Chain(http.HandlerFunc(acct.create), stdPub...))
+	http.Handle("/account/init", middleware.Chain(http.HandlerFunc(acct.create), withCSRF(stdPub)...))
 	http.Handle("/account/auth", middleware.Chain(http.HandlerFunc(acct.auth), stdRoot...))
-	http.Handle("/account/portal", middleware.Chain(http.HandlerFunc(acct.portal), stdRoot...))
+	http.Handle("/account/info", middleware.Chain(http.HandlerFunc(acct.info), stdRoot...))
+	http.Handle("/account/rename", middleware.Chain(http.HandlerFunc(acct.rename), stdRoot...))
+	http.Handle("/account/sessionbinding", middleware.Chain(http.HandlerFunc(acct.sessionBinding), stdRoot...))
+	http.Handle("/account/features", middleware.Chain(http.HandlerFunc(acct.features), stdRoot...))
+	http.Handle("/account/aliases", middleware.Chain(http.HandlerFunc(acct.publicAliases), stdRoot...))
+	http.Handle("/account/rotatekey", middleware.Chain(http.HandlerFunc(acct.rotateKey), stdRoot...))
+	http.Handle("/account/rotatetoken", middleware.Chain(http.HandlerFunc(acct.rotateRootToken), stdRoot...))
+	// the billing portal is where the owner of an inactive base fixes its payment
+	http.Handle("/account/portal", middleware.Chain(http.HandlerFunc(acct.portal), billingRoot...))
+	http.HandleFunc("/account/billing", acct.billingDone)
+	http.Handle("/account/plan", middleware.Chain(http.HandlerFunc(acct.changePlan), stdRoot...))
 
 	// stripe webhooks
 	swh := stripeWebhook{}
 	http.HandleFunc("/stripe", swh.process)
 
 	http.HandleFunc("/ping", ping)
-
-	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		serveWs(hub, w, r)
-	})
-
-	http.Handle("/sse/connect", middleware.Chain(http.HandlerFunc(b.Accept), pubWithDB...))
+	http.Handle("/verifykey", middleware.Chain(http.HandlerFunc(verifyKey), pubWithDB...))
+	http.HandleFunc("/metrics", metrics)
+
+	http.Handle("/ws", middleware.Chain(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serveWs(hub, w, r)
+		}),
+		middleware.RequireActiveBase(datastore, volatile),
+		middleware.RequireFeature(internal.FeatureRealtime),
+		checkRealtimeOrigin,
+	))
+
+	http.Handle("/sse/connect", middleware.Chain(
+		http.HandlerFunc(b.Accept),
+		middleware.Cors(),
+		middleware.RequireActiveBase(datastore, volatile),
+		middleware.RequireFeature(internal.FeatureRealtime),
+		checkRealtimeOrigin,
+		limitRealtimeConnections,
+	))
 	receiveMessage := func(w http.ResponseWriter, r *http.Request) {
 		var msg internal.Command
 		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
@@ -194,17 +292,18 @@ func Start(c config.AppConfig) {
 
 		respond(w, http.StatusOK, true)
 	}
-	http.Handle("/sse/msg", middleware.Chain(http.HandlerFunc(receiveMessage), pubWithDB...))
+	http.Handle("/sse/msg", middleware.Chain(http.HandlerFunc(receiveMessage), withFeature(pubWithDB, internal.FeatureRealtime)...))
 
 	// server-side functions
 	f := &functions{datastore: datastore}
-	http.Handle("/fn/add", middleware.Chain(http.HandlerFunc(f.add), stdRoot...))
-	http.Handle("/fn/update", middleware.Chain(http.HandlerFunc(f.update), stdRoot...))
-	http.Handle("/fn/delete/", middleware.Chain(http.HandlerFunc(f.del), stdRoot...))
-	http.Handle("/fn/del/", middleware.Chain(http.HandlerFunc(f.del), stdRoot...))
-	http.Handle("/fn/info/", middleware.Chain(http.HandlerFunc(f.info), stdRoot...))
-	http.Handle("/fn/exec/", middleware.Chain(http.HandlerFunc(f.exec), stdAuth...))
-	http.Handle("/fn", middleware.Chain(http.HandlerFunc(f.list), stdRoot...))
+	fnRoot := withFeature(stdRoot, internal.FeatureFunctions)
+	http.Handle("/fn/add", middleware.Chain(http.HandlerFunc(f.add), fnRoot...))
+	http.Handle("/fn/update", middleware.Chain(http.HandlerFunc(f.update), fnRoot...))
+	http.Handle("/fn/delete/", middleware.Chain(http.HandlerFunc(f.del), fnRoot...))
+	http.Handle("/fn/del/", middleware.Chain(http.HandlerFunc(f.del), fnRoot...))
+	http.Handle("/fn/info/", middleware.Chain(http.HandlerFunc(f.info), fnRoot...))
+	http.Handle("/fn/exec/", middleware.Chain(http.HandlerFunc(f.exec), withFeature(stdAuth, internal.FeatureFunctions)...))
+	http.Handle("/fn", middleware.Chain(http.HandlerFunc(f.list), fnRoot...))
 
 	// extras routes
 	ex := &extras{}
@@ -214,19 +313,21 @@ func Start(c config.AppConfig) {
 
 	// ui routes
 	webUI := ui{}
-	http.HandleFunc("/ui/login", webUI.auth)
-	http.Handle("/ui/db", middleware.Chain(http.HandlerFunc(webUI.dbCols), stdRoot...))
-	http.Handle("/ui/db/save", middleware.Chain(http.HandlerFunc(webUI.dbSave), stdRoot...))
-	http.Handle("/ui/db/del/", middleware.Chain(http.HandlerFunc(webUI.dbDel), stdRoot...))
-	http.Handle("/ui/db/", middleware.Chain(http.HandlerFunc(webUI.dbDoc), stdRoot...))
-	http.Handle("/ui/fn/new", middleware.Chain(http.HandlerFunc(webUI.fnNew), stdRoot...))
-	http.Handle("/ui/fn/save", middleware.Chain(http.HandlerFunc(webUI.fnSave), stdRoot...))
-	http.Handle("/ui/fn/del/", middleware.Chain(http.HandlerFunc(webUI.fnDel), stdRoot...))
-	http.Handle("/ui/fn/", middleware.Chain(http.HandlerFunc(webUI.fnEdit), stdRoot...))
-	http.Handle("/ui/fn", middleware.Chain(http.HandlerFunc(webUI.fnList), stdRoot...))
-	http.Handle("/ui/forms", middleware.Chain(http.HandlerFunc(webUI.forms), stdRoot...))
-	http.Handle("/ui/forms/del/", middleware.Chain(http.HandlerFunc(webUI.formDel), stdRoot...))
-	http.HandleFunc("/", webUI.login)
+	uiPub := withCSRF(nil)
+	uiRoot := withCSRF(stdRoot)
+	http.Handle("/ui/login", middleware.Chain(http.HandlerFunc(webUI.auth), uiPub...))
+	http.Handle("/ui/db", middleware.Chain(http.HandlerFunc(webUI.dbCols), uiRoot...))
+	http.Handle("/ui/db/save", middleware.Chain(http.HandlerFunc(webUI.dbSave), uiRoot...))
+	http.Handle("/ui/db/del/", middleware.Chain(http.HandlerFunc(webUI.dbDel), uiRoot...))
+	http.Handle("/ui/db/", middleware.Chain(http.HandlerFunc(webUI.dbDoc), uiRoot...))
+	http.Handle("/ui/fn/new", middleware.Chain(http.HandlerFunc(webUI.fnNew), uiRoot...))
+	http.Handle("/ui/fn/save", middleware.Chain(http.HandlerFunc(webUI.fnSave), uiRoot...))
+	http.Handle("/ui/fn/del/", middleware.Chain(http.HandlerFunc(webUI.fnDel), uiRoot...))
+	http.Handle("/ui/fn/", middleware.Chain(http.HandlerFunc(webUI.fnEdit), uiRoot...))
+	http.Handle("/ui/fn", middleware.Chain(http.HandlerFunc(webUI.fnList), uiRoot...))
+	http.Handle("/ui/forms", middleware.Chain(http.HandlerFunc(webUI.forms), uiRoot...))
+	http.Handle("/ui/forms/del/", middleware.Chain(http.HandlerFunc(webUI.formDel), uiRoot...))
+	http.Handle("/", middleware.Chain(http.HandlerFunc(webUI.login), uiPub...))
 
 	// graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
@@ -240,10 +341,39 @@ func Start(c config.AppConfig) {
 		cancel()
 	}()
 
+	// periodic work done for each active base
+	scheduler := jobs.NewScheduler(datastore, nil)
+	if len(c.Settings.CollectionTTLs) > 0 {
+		scheduler.Register(ttlSweepJob)
+	}
+	if scheduler.HasJobs() {
+		go scheduler.Start(ctx, 10*time.Second)
+	}
+
 	httpsvr := &http.Server{
 		Addr: ":" + c.Port,
 	}
 
+	var handler http.Handler = http.DefaultServeMux
+	if strings.EqualFold(c.NormalizePaths, "yes") {
+		handler = middleware.Chain(handler, middleware.NormalizePath(http.DefaultServeMux))
+	}
+
+	if strings.EqualFold(c.Compression, "yes") {
+		handler = middleware.Chain(handler, middleware.Compress(c.Settings.CompressionMinSize, c.Settings.CompressionTypes))
+	}
+
+	if strings.EqualFold(c.DebugQueryHeaders, "yes") {
+		handler = middleware.Chain(handler, middleware.QueryStats())
+	}
+
+	if strings.EqualFold(c.RequestLogging, "yes") {
+		logger := log.New(os.Stdout, "", log.LstdFlags)
+		sensitive := append(strings.Split(c.LogSensitiveKeys, ","), middleware.APIKeyHeader)
+		handler = middleware.Chain(handler, middleware.RequestLogger(logger, sensitive...))
+	}
+	httpsvr.Handler = handler
+
 	g, gCtx := errgroup.WithContext(ctx)
 	g.Go(func() error {
 		return httpsvr.ListenAndServe()
@@ -284,13 +414,31 @@ func initServices(dbHost string) {
 		datastore = postgresql.New(cl, volatile.PublishDocument, "./sql/")
 	}
 
-	mp := config.Current.MailProvider
-	if strings.EqualFold(mp, internal.MailProviderSES) {
-		emailer = email.AWSSES{}
-	} else {
-		emailer = email.Dev{}
+	if threshold := config.Current.Settings.SlowQueryThreshold; threshold > 0 {
+		datastore = slowquery.New(datastore, threshold)
+	}
+
+	// outermost so the handlers can bind it to the request, see store
+	if strings.EqualFold(config.Current.DebugQueryHeaders, "yes") {
+		datastore = querycount.New(datastore)
 	}
 
+	if strings.EqualFold(config.Current.TokenCache, config.TokenCacheMemory) {
+		middleware.Tokens = cache.NewMemoryTokenStore(100000)
+	}
+
+	if len(config.Current.APIKeyHeader) > 0 {
+		middleware.APIKeyHeader = config.Current.APIKeyHeader
+	}
+
+	emailer = newMailer(config.Current.MailProvider)
+	if limit := config.Current.Settings.EmailRecipientRateLimit; limit.Limit > 0 {
+		emailer = email.NewThrottled(emailer, limit.Limit, limit.Window)
+	}
+	events.Subscribe(events.AccountCreatedEvent, sendAccountCreatedEmail)
+	events.Subscribe(events.NewDeviceLoginEvent, sendNewDeviceLoginEmail)
+	events.Subscribe(events.DocumentChangedEvent, deliverWebhooks)
+
 	sp := config.Current.StorageProvider
 	if strings.EqualFold(sp, internal.StorageProviderS3) {
 		storer = storage.S3{}
@@ -300,41 +448,81 @@ func initServices(dbHost string) {
 
 	sub := &function.Subscriber{}
 	sub.PubSub = volatile
-	sub.GetExecEnv = func(token string) (function.ExecutionEnvironment, error) {
-		var exe function.ExecutionEnvironment
-
-		var conf internal.BaseConfig
-		// for public websocket (experimental)
-		if strings.HasPrefix(token, "__tmp__experimental_public") {
-			pk := strings.Replace(token, "__tmp__experimental_public_", "", -1)
-			pairs := strings.Split(pk, "_")
-			fmt.Println("checking for base in cache: ", pairs[0])
-			if err := volatile.GetTyped(pairs[0], &conf); err != nil {
-				log.Println("cannot find base for public websocket")
-				return exe, err
-			}
-		} else if err := volatile.GetTyped("base:"+token, &conf); err != nil {
-			log.Println("cannot find base")
-			return exe, err
-		}
+	sub.GetExecEnv = execEnv
+
+	// start system events subscriber
+	go sub.Start()
+}
 
-		var auth internal.Auth
-		if err := volatile.GetTyped(token, &auth); err != nil {
-			log.Println("cannot find auth")
+// execEnv returns the environment a function runs in for the session token.
+// The cached base only identifies the base, its features are read from the
+// datastore as they may have changed since the token was cached.
+func execEnv(token string) (function.ExecutionEnvironment, error) {
+	var exe function.ExecutionEnvironment
+
+	var conf internal.BaseConfig
+	// for public websocket (experimental)
+	if strings.HasPrefix(token, "__tmp__experimental_public") {
+		pk := strings.Replace(token, "__tmp__experimental_public_", "", -1)
+		pairs := strings.Split(pk, "_")
+		fmt.Println("checking for base in cache: ", pairs[0])
+		if previousKeyExpired(volatile, pairs[0]) {
+			return exe, internal.ErrBaseNotFound
+		} else if err := volatile.GetTyped(pairs[0], &conf); err != nil {
+			log.Println("cannot find base for public websocket")
 			return exe, err
 		}
+	} else if err := volatile.GetTyped("base:"+token, &conf); err != nil {
+		log.Println("cannot find base")
+		return exe, err
+	}
 
-		exe.Auth = auth
-		exe.BaseName = conf.Name
-		exe.DataStore = datastore
-		exe.Volatile = volatile
+	conf, err := datastore.FindDatabase(conf.ID)
+	if err != nil {
+		return exe, err
+	} else if !conf.IsActive {
+		return exe, internal.ErrBaseNotFound
+	}
 
-		return exe, nil
+	if !conf.FeatureEnabled(internal.FeatureFunctions) {
+		return exe, errors.New(middleware.FeatureDisabled(internal.FeatureFunctions))
 	}
 
-	// start system events subscriber
-	go sub.Start()
+	auth, err := middleware.AuthTokens(volatile).GetAuth(token)
+	if err != nil {
+		log.Println("cannot find auth")
+		return exe, err
+	}
+
+	exe.Auth = auth
+	exe.BaseName = conf.Name
+	exe.DataStore = datastore
+	exe.Volatile = volatile
+
+	return exe, nil
+}
+
+// runBaseMigrations applies the datastore migrations the existing bases
+// have not received yet.
+func runBaseMigrations() {
+	bases, err := datastore.ListDatabases()
+	if err != nil {
+		log.Fatal("error listing the bases to migrate: ", err)
+	}
+
+	names := make([]string, 0, len(bases))
+	for _, base := range bases {
+		names = append(names, base.Name)
+	}
+
+	ran, err := internal.RunBaseMigrations(datastore, names, datastore.BaseMigrations())
+	if err != nil {
+		log.Fatal("error migrating the bases: ", err)
+	} else if ran > 0 {
+		log.Printf("applied %d base migration(s)", ran)
+	}
 }
+
 func openMongoDatabase(dbHost string) (*mongodrv.Client, error) {
 	uri := dbHost
 
@@ -365,14 +553,62 @@ func openPGDatabase(dbHost string) (*sql.DB, error) {
 	return dbConn, nil
 }
 
+func newMailer(provider string) internal.Mailer {
+	if strings.EqualFold(provider, internal.MailProviderSES) {
+		return email.AWSSES{}
+	}
+	return email.Dev{}
+}
+
+func newCaptchaVerifier(c config.AppConfig) internal.CaptchaVerifier {
+	if strings.EqualFold(c.CaptchaProvider, internal.CaptchaProviderHCaptcha) {
+		return captcha.NewHCaptcha(c.CaptchaSecret)
+	}
+	return captcha.NewReCaptcha(c.CaptchaSecret)
+}
+
 func ping(w http.ResponseWriter, r *http.Request) {
 	if err := datastore.Ping(); err != nil {
 		http.Error(w, "connection failed to database, I'm down.", http.StatusInternalServerError)
 		return
 	}
+
+	if err := emailer.Ping(); err != nil {
+		log.Println("email provider ping failed: ", err)
+		http.Error(w, "connection failed to email provider, I'm down.", http.StatusInternalServerError)
+		return
+	}
 	respond(w, http.StatusOK, true)
 }
 
+// publicKeyInfo is the minimal base info returned when verifying a public
+// key.
+type publicKeyInfo struct {
+	Valid       bool      `json:"valid"`
+	DisplayName string    `json:"displayName"`
+	Created     time.Time `json:"created"`
+}
+
+// verifyKey lets the client apps confirm their public key before
+// authenticating a user. RequireActiveBase already refused a missing,
+// unknown or inactive key.
+func verifyKey(w http.ResponseWriter, r *http.Request) {
+	conf, err := middleware.BaseFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "invalid StaticBackend key", http.StatusUnauthorized)
+		return
+	}
+
+	respond(w, http.StatusOK, publicKeyInfo{Valid: true, DisplayName: conf.DisplayName, Created: conf.Created})
+}
+
+func metrics(w http.ResponseWriter, r *http.Request) {
+	respond(w, http.StatusOK, map[string]interface{}{
+		"authCache":           middleware.AuthCacheStats(),
+		"realtimeConnections": realtimeConnections.Total(),
+	})
+}
+
 func sudoCache(w http.ResponseWriter, r *http.Request) {
 	conf, _, err := middleware.Extract(r, false)
 	if err != nil {
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -50,6 +51,14 @@ type Socket struct {
 
 	// unique socket identifier
 	id string
+
+	// base of the public key of the handshake, the socket authenticates
+	// with a token of this base
+	base internal.BaseConfig
+
+	// client of the handshake, the tokens bound to another client are
+	// refused, see SessionBinding
+	client middleware.Client
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -108,10 +117,22 @@ func (c *Socket) writePump() {
 	}
 }
 
-// serveWs handles websocket requests from the peer.
+// serveWs handles websocket requests from the peer. The base is resolved
+// from the public key and the origin checked before the upgrade, see
+// checkRealtimeOrigin. The connection is counted in the realtime connections
+// of the base until the hub unregisters the socket.
 func serveWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	conf, err := middleware.BaseFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "invalid StaticBackend key", http.StatusUnauthorized)
+		return
+	} else if !openRealtimeConnection(w, conf) {
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		realtimeConnections.Close(conf.ID)
 		log.Println(err)
 		return
 	}
@@ -119,7 +140,14 @@ func serveWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		log.Println(err)
 	}
-	sck := &Socket{hub: hub, conn: conn, send: make(chan internal.Command), id: id.String()}
+	sck := &Socket{
+		hub:    hub,
+		conn:   conn,
+		send:   make(chan internal.Command),
+		id:     id.String(),
+		base:   conf,
+		client: middleware.ClientOf(r),
+	}
 	sck.hub.register <- sck
 
 	// Allow collection of memory referenced by the caller by doing all work in
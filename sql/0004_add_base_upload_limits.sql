@@ -0,0 +1,3 @@
+ALTER TABLE sb.apps
+ADD COLUMN allowed_upload_types TEXT[] NOT NULL DEFAULT '{}',
+ADD COLUMN max_upload_size BIGINT NOT NULL DEFAULT 0;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE sb.apps
+ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
\ No newline at end of file
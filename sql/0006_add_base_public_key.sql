@@ -0,0 +1,4 @@
+ALTER TABLE sb.apps
+ADD COLUMN public_key TEXT NOT NULL DEFAULT '',
+ADD COLUMN previous_public_key TEXT NOT NULL DEFAULT '',
+ADD COLUMN previous_key_expires timestamp NOT NULL DEFAULT 'epoch';
\ No newline at end of file
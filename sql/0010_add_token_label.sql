@@ -0,0 +1,11 @@
+-- the tokens of the existing bases get an optional label
+DO $$
+DECLARE
+	base RECORD;
+BEGIN
+	FOR base IN SELECT name FROM sb.apps LOOP
+		IF to_regclass(quote_ident(base.name) || '.sb_tokens') IS NOT NULL THEN
+			EXECUTE format('ALTER TABLE %I.sb_tokens ADD COLUMN IF NOT EXISTS label TEXT NOT NULL DEFAULT ''''', base.name);
+		END IF;
+	END LOOP;
+END $$;
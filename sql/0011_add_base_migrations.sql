@@ -0,0 +1,7 @@
+-- the per-base migrations applied at startup
+CREATE TABLE IF NOT EXISTS sb.base_migrations (
+	name TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	applied timestamp NOT NULL,
+	PRIMARY KEY (name, version)
+);
@@ -2,10 +2,15 @@ package staticbackend
 
 import (
 	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/staticbackendhq/core/config"
 	"github.com/staticbackendhq/core/internal"
 	"github.com/staticbackendhq/core/middleware"
 )
@@ -16,7 +21,7 @@ func upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	config, auth, err := middleware.Extract(r, true)
+	conf, auth, err := middleware.Extract(r, true)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -28,13 +33,24 @@ func upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	allowedTypes, maxSize := conf.UploadLimits(config.Current.Settings.UploadAllowedTypes, config.Current.Settings.UploadMaxSize)
+
 	// check for file size
 	// TODO: This should be based on current plan
-	if h.Size/(1000*1000) > 150 {
+	if h.Size > maxSize {
 		http.Error(w, "file size exeeded your limit", http.StatusBadRequest)
 		return
 	}
 
+	contentType, err := uploadContentType(file, h.Filename)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !internal.ContentTypeAllowed(contentType, allowedTypes) {
+		http.Error(w, fmt.Sprintf("file type %s is not allowed", contentType), http.StatusUnsupportedMediaType)
+		return
+	}
+
 	ext := filepath.Ext(h.Filename)
 
 	//TODO: Remove all but a-zA-Z/ from name
@@ -45,7 +61,7 @@ func upload(w http.ResponseWriter, r *http.Request) {
 	}
 
 	fileKey := fmt.Sprintf("%s/%s/%s%s",
-		config.Name,
+		conf.Name,
 		auth.AccountID,
 		name,
 		ext,
@@ -66,7 +82,7 @@ func upload(w http.ResponseWriter, r *http.Request) {
 		Uploaded:  time.Now(),
 	}
 
-	newID, err := datastore.AddFile(config.Name, f)
+	newID, err := datastore.AddFile(conf.Name, f)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -82,6 +98,94 @@ func upload(w http.ResponseWriter, r *http.Request) {
 	respond(w, http.StatusOK, data)
 }
 
+// uploadContentType returns the MIME type detected from the content of the
+// file. The type sent by the client is ignored, it could claim an allowed
+// type for any content. The extension of filename only refines the
+// generic types the sniffer returns for the formats it cannot identify,
+// see refinedContentTypes.
+func uploadContentType(file multipart.File, filename string) (string, error) {
+	buf := make([]byte, 512)
+	n, err := file.Read(buf)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	sniffed := http.DetectContentType(buf[:n])
+
+	mt, _, err := mime.ParseMediaType(sniffed)
+	if err != nil {
+		return sniffed, nil
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	if refined, ok := refinedContentTypes[mt][ext]; ok {
+		return refined, nil
+	}
+	return sniffed, nil
+}
+
+// refinedContentTypes are the types of the files the sniffer sees as a
+// generic type, by sniffed type and extension. JSON and SVG are text and
+// the Office documents are zip archives.
+var refinedContentTypes = map[string]map[string]string{
+	"text/plain": {
+		".json": "application/json",
+		".csv":  "text/csv",
+		".svg":  "image/svg+xml",
+	},
+	"text/xml": {
+		".svg": "image/svg+xml",
+	},
+	"application/zip": {
+		".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	},
+}
+
+func sudoUploadLimits(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := new(struct {
+		AllowedTypes []string `json:"allowedTypes"`
+		MaxSize      int64    `json:"maxSize"`
+	})
+
+	if r.Method == http.MethodGet {
+		data.AllowedTypes, data.MaxSize = conf.AllowedUploadTypes, conf.MaxUploadSize
+		respond(w, http.StatusOK, data)
+		return
+	} else if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := parseBody(r.Body, data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if data.MaxSize < 0 {
+		http.Error(w, "maxSize cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	if err := datastore.SetUploadLimits(conf.ID, data.AllowedTypes, data.MaxSize); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	middleware.Bases.Invalidate(conf.Key())
+
+	respond(w, http.StatusOK, true)
+}
+
 func deleteFile(w http.ResponseWriter, r *http.Request) {
 	config, _, err := middleware.Extract(r, false)
 	if err != nil {
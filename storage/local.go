@@ -28,6 +28,10 @@ func (Local) Save(data internal.UploadFileData) (string, error) {
 		return "", err
 	}
 
+	if len(config.Current.LocalStorageURL) == 0 {
+		return config.Link(config.Current, "tmp/"+data.FileKey, nil), nil
+	}
+
 	url := fmt.Sprintf("%s/tmp/%s", config.Current.LocalStorageURL, data.FileKey)
 	return url, nil
 }
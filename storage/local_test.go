@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/staticbackendhq/core/config"
 	"github.com/staticbackendhq/core/internal"
 )
 
@@ -22,3 +23,17 @@ func TestLocalSave(t *testing.T) {
 		fmt.Errorf("expected ~/tmp/unit/test/file.txt got %s", url)
 	}
 }
+
+func TestLocalSaveUsesPublicURL(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+	config.Current.LocalStorageURL = ""
+	config.Current.PublicURL = "https://files.example.com"
+
+	data := internal.UploadFileData{FileKey: "unit/public.txt", File: bytes.NewReader([]byte("unit test"))}
+	url, err := Local{}.Save(data)
+	if err != nil {
+		t.Fatal(err)
+	} else if url != "https://files.example.com/tmp/unit/public.txt" {
+		t.Errorf("expected file url on the public url got %s", url)
+	}
+}
@@ -0,0 +1,115 @@
+package staticbackend
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+)
+
+func TestUploadRejectsTypeNotAllowedByBase(t *testing.T) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", `form-data; name="file"; filename="doc.pdf"`)
+	h.Set("Content-Type", "application/pdf")
+	part, err := mw.CreatePart(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write([]byte("%PDF-1.4 fake")); err != nil {
+		t.Fatal(err)
+	}
+	mw.Close()
+
+	// the global default allows all types, this base only accepts images
+	base := internal.BaseConfig{ID: pubKey, Name: dbName, AllowedUploadTypes: []string{"image/*"}}
+
+	req := httptest.NewRequest("POST", "/storage/upload", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	ctx := context.WithValue(req.Context(), middleware.ContextBase, base)
+	ctx = context.WithValue(ctx, middleware.ContextAuth, internal.Auth{AccountID: "acctid", UserID: "userid"})
+
+	w := httptest.NewRecorder()
+	upload(w, req.WithContext(ctx))
+
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected status %d got %d: %s", http.StatusUnsupportedMediaType, w.Code, w.Body.String())
+	}
+}
+
+func TestUploadSniffsContentType(t *testing.T) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	// the client claims an image for a HTML document
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", `form-data; name="file"; filename="avatar.png"`)
+	h.Set("Content-Type", "image/png")
+	part, err := mw.CreatePart(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write([]byte("<html><script>alert(1)</script></html>")); err != nil {
+		t.Fatal(err)
+	}
+	mw.Close()
+
+	base := internal.BaseConfig{ID: pubKey, Name: dbName, AllowedUploadTypes: []string{"image/*"}}
+
+	req := httptest.NewRequest("POST", "/storage/upload", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	ctx := context.WithValue(req.Context(), middleware.ContextBase, base)
+	ctx = context.WithValue(ctx, middleware.ContextAuth, internal.Auth{AccountID: "acctid", UserID: "userid"})
+
+	w := httptest.NewRecorder()
+	upload(w, req.WithContext(ctx))
+
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected status %d got %d: %s", http.StatusUnsupportedMediaType, w.Code, w.Body.String())
+	}
+}
+
+// memFile is an in-memory multipart.File.
+type memFile struct {
+	*bytes.Reader
+}
+
+func (memFile) Close() error {
+	return nil
+}
+
+func TestUploadContentType(t *testing.T) {
+	tests := []struct {
+		filename string
+		content  string
+		expected string
+	}{
+		{"data.json", `{"name": "json"}`, "application/json"},
+		{"logo.svg", `<svg xmlns="http://www.w3.org/2000/svg"></svg>`, "image/svg+xml"},
+		{"logo.svg", `<?xml version="1.0"?><svg></svg>`, "image/svg+xml"},
+		{"report.docx", "PK\x03\x04\x14\x00\x06\x00", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"notes.txt", "plain notes", "text/plain; charset=utf-8"},
+		// the extension does not change a type the sniffer identified
+		{"data.json", "<html><script>alert(1)</script></html>", "text/html; charset=utf-8"},
+		{"logo.svg", "\x89PNG\r\n\x1a\n", "image/png"},
+	}
+
+	for _, tc := range tests {
+		ct, err := uploadContentType(memFile{bytes.NewReader([]byte(tc.content))}, tc.filename)
+		if err != nil {
+			t.Fatal(err)
+		} else if ct != tc.expected {
+			t.Errorf("%s: expected %s got %s", tc.filename, tc.expected, ct)
+		}
+	}
+}
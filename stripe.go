@@ -7,16 +7,61 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/staticbackendhq/core/config"
 	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
 	"github.com/stripe/stripe-go/v72"
 	"github.com/stripe/stripe-go/v72/webhook"
 )
 
 // TODO: Implement better logging mechanism than std output
 
+// stripeAPIVersion returns the pinned Stripe API version, the one the
+// Stripe library objects are generated for by default.
+func stripeAPIVersion(c config.AppConfig) string {
+	if len(c.StripeAPIVersion) > 0 {
+		return c.StripeAPIVersion
+	}
+	return stripe.APIVersion
+}
+
+// stripeVersionTransport sets the Stripe-Version header of the API
+// requests, the library always sends its own version.
+type stripeVersionTransport struct {
+	version string
+	next    http.RoundTripper
+}
+
+func (t *stripeVersionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Stripe-Version", t.version)
+	return t.next.RoundTrip(req)
+}
+
+// newStripeBackend returns the Stripe API backend using version, url
+// overrides the Stripe API URL when not nil.
+func newStripeBackend(version string, url *string) stripe.Backend {
+	httpClient := &http.Client{
+		Timeout:   80 * time.Second,
+		Transport: &stripeVersionTransport{version: version, next: http.DefaultTransport},
+	}
+
+	return stripe.GetBackendWithConfig(stripe.APIBackend, &stripe.BackendConfig{
+		HTTPClient: httpClient,
+		URL:        url,
+	})
+}
+
+// initStripe sets the Stripe key and pins the API version of the requests
+// made to Stripe.
+func initStripe(c config.AppConfig) {
+	stripe.Key = c.StripeKey
+	stripe.SetBackend(stripe.APIBackend, newStripeBackend(stripeAPIVersion(c), nil))
+}
+
 type stripeWebhook struct{}
 
 func (wh *stripeWebhook) process(w http.ResponseWriter, r *http.Request) {
@@ -40,6 +85,10 @@ func (wh *stripeWebhook) process(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if v := stripeAPIVersion(config.Current); event.APIVersion != v {
+		fmt.Printf("STRIPE WARNING: event %s uses API version %s, expected %s\n", event.ID, event.APIVersion, v)
+	}
+
 	if event.Type == "customer.subscription.updated" {
 		var sub stripe.Subscription
 		err := json.Unmarshal(event.Data.Raw, &sub)
@@ -98,6 +147,8 @@ func (wh *stripeWebhook) handleSubChanged(sub stripe.Subscription) {
 			fmt.Println("STRIPE ERROR (update cus plan): ", err)
 			return
 		}
+
+		middleware.Bases.InvalidateCustomer(cus.ID)
 	}
 }
 
@@ -115,7 +166,10 @@ func (wh *stripeWebhook) handleSubCancelled(sub stripe.Subscription) {
 
 	if err := datastore.ChangeCustomerPlan(cus.ID, internal.PlanIdea); err != nil {
 		fmt.Println("STRIPE ERROR (update cus plan): ", err)
+		return
 	}
+
+	middleware.Bases.InvalidateCustomer(cus.ID)
 }
 
 func (wh *stripeWebhook) handlePaymentMethodAttached(pm stripe.PaymentMethod) {
@@ -134,9 +188,69 @@ func (wh *stripeWebhook) handlePaymentMethodAttached(pm stripe.PaymentMethod) {
 	if err := datastore.ActivateCustomer(cus.ID, true); err != nil {
 		fmt.Println("STRIPE ERROR (activate cus): ", stripeID, err)
 	}
+
+	middleware.Bases.InvalidateCustomer(cus.ID)
+}
+
+// planNames are the plans a customer can subscribe to.
+var planNames = map[string]int{
+	"idea":     internal.PlanIdea,
+	"launch":   internal.PleanLaunch,
+	"traction": internal.PlanTraction,
+	"growth":   internal.PlanGrowth,
+}
+
+// countryHintHeader is the request country set by Cloudflare, other CDNs
+// and proxies can be configured to add it.
+const countryHintHeader = "CF-IPCountry"
+
+// requestCurrency returns the currency of the prices used for r: the
+// currency parameter when set, otherwise the currency of the country hinted
+// by the request. Empty means the default prices.
+func requestCurrency(r *http.Request, param string) string {
+	if len(param) > 0 {
+		return strings.ToLower(param)
+	}
+
+	return config.Current.Settings.CountryCurrencies[strings.ToUpper(r.Header.Get(countryHintHeader))]
+}
+
+// planPriceID returns the Stripe price of plan in currency, the default
+// price of the plan is used when there's none for the currency. It's empty
+// when not configured.
+func planPriceID(plan int, currency string) string {
+	prices := config.Current.Settings.PlanPrices
+	for name, p := range planNames {
+		if p != plan {
+			continue
+		} else if id, ok := prices[name][strings.ToLower(currency)]; ok {
+			return id
+		}
+	}
+
+	switch plan {
+	case internal.PlanIdea:
+		return config.Current.StripePriceIDIdea
+	case internal.PleanLaunch:
+		return config.Current.StripePriceIDLaunch
+	case internal.PlanTraction:
+		return config.Current.StripePriceIDTraction
+	case internal.PlanGrowth:
+		return config.Current.StripePriceIDGrowth
+	default:
+		return ""
+	}
 }
 
 func (wh *stripeWebhook) priceToLevel(priceID string) int {
+	for name, byCurrency := range config.Current.Settings.PlanPrices {
+		for _, id := range byCurrency {
+			if plan, ok := planNames[name]; ok && id == priceID {
+				return plan
+			}
+		}
+	}
+
 	switch priceID {
 	case config.Current.StripePriceIDIdea:
 		return internal.PlanIdea
@@ -0,0 +1,72 @@
+package staticbackend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/staticbackendhq/core/config"
+	"github.com/staticbackendhq/core/internal"
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/customer"
+)
+
+func TestStripeAPIVersion(t *testing.T) {
+	var version string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version = r.Header.Get("Stripe-Version")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "cus_test", "object": "customer"}`))
+	}))
+	defer srv.Close()
+
+	if v := stripeAPIVersion(config.AppConfig{}); v != stripe.APIVersion {
+		t.Errorf("expected the library version %s by default got %s", stripe.APIVersion, v)
+	}
+
+	pinned := stripeAPIVersion(config.AppConfig{StripeAPIVersion: "2022-11-15"})
+
+	sc := customer.Client{B: newStripeBackend(pinned, stripe.String(srv.URL)), Key: "sk_test_123"}
+	if _, err := sc.New(&stripe.CustomerParams{Email: stripe.String("version@test.com")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if version != "2022-11-15" {
+		t.Errorf("expected Stripe-Version 2022-11-15 got %s", version)
+	}
+}
+
+func TestPlanPriceCurrency(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+
+	config.Current.StripePriceIDIdea = "price_idea"
+	config.Current.StripePriceIDLaunch = "price_launch"
+	config.Current.StripePriceCurrencies = "idea:eur:price_idea_eur"
+	config.Current.StripeCountryCurrencies = "FR:eur"
+	parseSettings(t)
+
+	if id := planPriceID(internal.PlanIdea, "EUR"); id != "price_idea_eur" {
+		t.Errorf("expected the eur price got %s", id)
+	} else if id := planPriceID(internal.PlanIdea, ""); id != "price_idea" {
+		t.Errorf("expected the default price got %s", id)
+	} else if id := planPriceID(internal.PleanLaunch, "eur"); id != "price_launch" {
+		t.Errorf("expected the default launch price got %s", id)
+	}
+
+	wh := &stripeWebhook{}
+	if plan := wh.priceToLevel("price_idea_eur"); plan != internal.PlanIdea {
+		t.Errorf("expected the eur price to be the idea plan got %d", plan)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if c := requestCurrency(r, ""); c != "" {
+		t.Errorf("expected the default currency got %s", c)
+	}
+
+	r.Header.Set("CF-IPCountry", "fr")
+	if c := requestCurrency(r, ""); c != "eur" {
+		t.Errorf("expected the country currency got %s", c)
+	} else if c := requestCurrency(r, "GBP"); c != "gbp" {
+		t.Errorf("expected the requested currency got %s", c)
+	}
+}
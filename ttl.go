@@ -0,0 +1,144 @@
+package staticbackend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/staticbackendhq/core/config"
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/jobs"
+)
+
+// collectionTTL returns the TTL configured for col.
+func collectionTTL(col string) (config.TTL, bool) {
+	ttls := config.Current.Settings.CollectionTTLs
+	if ttl, ok := ttls[col]; ok {
+		return ttl, true
+	}
+	ttl, ok := ttls[internal.CleanCollectionName(col)]
+	return ttl, ok
+}
+
+// expiryLayout is the fixed UTC layout the TTL field is stored with so the
+// backends can compare it as a string.
+const expiryLayout = "2006-01-02T15:04:05Z"
+
+var errInvalidExpiry = errors.New("the expiry field must be an RFC 3339 timestamp")
+
+// expiryCutoff returns the timestamp before which the documents of a
+// collection having ttl are expired, in the layout of the TTL field.
+func expiryCutoff(ttl config.TTL, now time.Time) string {
+	return now.Add(-ttl.Duration).UTC().Format(expiryLayout)
+}
+
+// normalizeExpiry rewrites the TTL field of doc, when set, in UTC with
+// expiryLayout. A timestamp with an offset or fractional seconds would not
+// compare correctly as a string.
+func normalizeExpiry(col string, doc map[string]interface{}) error {
+	ttl, ok := collectionTTL(col)
+	if !ok {
+		return nil
+	}
+
+	// a patch can set the nested field with its dot path as the key
+	v, ok := doc[ttl.Field]
+	if !ok {
+		if v, ok = internal.GetPath(doc, ttl.Field); !ok {
+			return nil
+		}
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return errInvalidExpiry
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return errInvalidExpiry
+	}
+
+	if _, ok := doc[ttl.Field]; ok {
+		doc[ttl.Field] = t.UTC().Format(expiryLayout)
+	} else {
+		internal.SetPath(doc, ttl.Field, t.UTC().Format(expiryLayout))
+	}
+	return nil
+}
+
+// liveClause returns the query clause excluding the expired documents of
+// col, false when col has no TTL.
+func liveClause(col string, now time.Time) ([]interface{}, bool) {
+	ttl, ok := collectionTTL(col)
+	if !ok {
+		return nil, false
+	}
+	return []interface{}{ttl.Field, ">", expiryCutoff(ttl, now)}, true
+}
+
+// isExpired returns if doc is expired and waiting to be removed.
+func isExpired(col string, doc map[string]interface{}, now time.Time) bool {
+	ttl, ok := collectionTTL(col)
+	if !ok {
+		return false
+	}
+
+	v, _ := internal.GetPath(doc, ttl.Field)
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	return err == nil && !t.After(now.Add(-ttl.Duration))
+}
+
+// sweepExpired removes the expired documents of the collections having a
+// TTL in every base.
+func sweepExpired(now time.Time) error {
+	bases, err := datastore.ListDatabases()
+	if err != nil {
+		return err
+	}
+
+	for _, base := range bases {
+		if err := sweepBaseExpired(base.Name, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sweepBaseExpired removes the expired documents of the collections having
+// a TTL in the base dbName.
+func sweepBaseExpired(dbName string, now time.Time) error {
+	cols, err := datastore.ListCollections(dbName)
+	if err != nil {
+		return err
+	}
+
+	for _, col := range cols {
+		ttl, ok := collectionTTL(col)
+		if !ok {
+			continue
+		}
+
+		if _, err := datastore.DeleteExpired(dbName, col, ttl.Field, now.Add(-ttl.Duration)); err != nil {
+			return fmt.Errorf("error removing expired documents of %s.%s: %w", dbName, col, err)
+		}
+	}
+	return nil
+}
+
+// ttlSweepJob removes the expired documents of each active base every
+// minute.
+var ttlSweepJob = jobs.Job{
+	Name:     "ttl-sweep",
+	Interval: time.Minute,
+	Jitter:   10 * time.Second,
+	Run: func(ctx context.Context, base internal.BaseConfig) error {
+		return sweepBaseExpired(base.Name, time.Now())
+	},
+}
@@ -40,15 +40,24 @@ func (ui) createApp(w http.ResponseWriter, r *http.Request) {
 }
 
 func (ui) auth(w http.ResponseWriter, r *http.Request) {
-	r.ParseForm()
+	var creds struct {
+		PublicKey string `json:"pk"`
+		Token     string `json:"token"`
+	}
+	if err := decodeRequest(r, &creds); err != nil {
+		render(w, r, "login.html", nil, &Flash{Type: "danger", Message: err.Error()})
+		return
+	}
 
-	pk := r.Form.Get("pk")
-	token := r.Form.Get("token")
+	pk, token := creds.PublicKey, creds.Token
 
-	conf, err := datastore.FindDatabase(pk)
+	conf, err := datastore.FindDatabaseByKey(pk)
 	if err != nil {
 		render(w, r, "login.html", nil, &Flash{Type: "danger", Message: "This app does not exists"})
 		return
+	} else if !conf.IsActive {
+		render(w, r, "login.html", nil, &Flash{Type: "danger", Message: internal.ErrInactiveAccount.Error()})
+		return
 	}
 
 	if _, err := middleware.ValidateRootToken(datastore, conf.Name, token); err != nil {
@@ -108,10 +117,9 @@ func (x *ui) dbCols(w http.ResponseWriter, r *http.Request) {
 	col := names[0]
 
 	params := internal.ListParams{
-		Page:           1,
-		Size:           50,
-		SortDescending: true,
-		SortBy:         "id",
+		Page: 1,
+		Size: 50,
+		Sort: []internal.SortField{{Field: internal.SortFieldID, Descending: true}},
 	}
 
 	filter := make(map[string]interface{})
@@ -121,8 +129,19 @@ func (x *ui) dbCols(w http.ResponseWriter, r *http.Request) {
 		r.ParseForm()
 
 		col = r.Form.Get("col")
-		params.SortBy = r.Form.Get("sortby")
-		params.SortDescending = r.Form.Get("desc") == "1"
+		sortBy := r.Form.Get("sortby")
+		if len(sortBy) == 0 {
+			sortBy = internal.SortFieldID
+		}
+
+		sort, err := internal.ParseSort(sortBy)
+		if err != nil {
+			renderErr(w, r, err)
+			return
+		}
+
+		sort[0].Descending = r.Form.Get("desc") == "1"
+		params.Sort = sort
 
 		query := r.Form.Get("query")
 		if len(query) > 0 {
@@ -163,8 +182,8 @@ func (x *ui) dbCols(w http.ResponseWriter, r *http.Request) {
 	data.Collections = names
 	data.Columns = columns
 	data.Docs = list.Results
-	data.SortBy = params.SortBy
-	if params.SortDescending {
+	data.SortBy = params.Sort[0].Field
+	if params.Sort[0].Descending {
 		data.SortDescending = "1"
 	} else {
 		data.SortDescending = "0"
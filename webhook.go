@@ -0,0 +1,353 @@
+package staticbackend
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/staticbackendhq/core/cache"
+	"github.com/staticbackendhq/core/config"
+	"github.com/staticbackendhq/core/events"
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+)
+
+const (
+	webhookEventHeader     = "SB-Webhook-Event"
+	webhookSignatureHeader = "SB-Signature"
+)
+
+// webhookClient delivers the webhooks, a slow receiver must not hold a
+// delivery worker forever. Its dialer checks the destination again once
+// the host is resolved, see webhookDialControl.
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{Timeout: 5 * time.Second, Control: webhookDialControl}).DialContext,
+	},
+}
+
+// webhookCache holds the webhooks of the bases, they're needed on every
+// document write.
+var webhookCache = cache.NewWebhookCache(time.Minute)
+
+// webhookJob is a pending delivery of a webhook.
+type webhookJob struct {
+	wh internal.Webhook
+	ev events.DocumentChanged
+}
+
+const (
+	// webhookWorkers is how many deliveries are made at the same time
+	webhookWorkers = 8
+	// webhookQueueSize is how many deliveries can be pending, the ones
+	// above are dropped
+	webhookQueueSize = 1000
+)
+
+var (
+	webhookQueue       = make(chan webhookJob, webhookQueueSize)
+	startWebhookWorker sync.Once
+	// webhookRetries are the delays before retrying a failed delivery
+	webhookRetries = []time.Duration{time.Second, 5 * time.Second}
+)
+
+var errWebhookDestination = errors.New("webhooks cannot be delivered to a loopback, link-local or private address")
+
+// webhookPayload is the body POSTed to a webhook.
+type webhookPayload struct {
+	Event      string                 `json:"event"`
+	Collection string                 `json:"col"`
+	ID         string                 `json:"id"`
+	Document   map[string]interface{} `json:"doc"`
+	Sent       time.Time              `json:"sent"`
+}
+
+// webhooks lists the webhooks of the base on GET, registers one on POST and
+// removes the one with the id parameter on DELETE.
+func webhooks(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, "invalid StaticBackend key", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		list, err := datastore.ListWebhooks(conf.Name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if list == nil {
+			list = []internal.Webhook{}
+		}
+
+		respond(w, http.StatusOK, list)
+	case http.MethodPost:
+		data := new(struct {
+			Collection string   `json:"col"`
+			Event      string   `json:"event"`
+			URL        string   `json:"url"`
+			Secret     string   `json:"secret"`
+			Fields     []string `json:"fields"`
+		})
+		if err := internal.DecodeJSON(r.Body, data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		wh := internal.Webhook{
+			Collection: data.Collection,
+			Event:      strings.ToLower(data.Event),
+			URL:        data.URL,
+			Secret:     data.Secret,
+			Fields:     data.Fields,
+		}
+		if err := validateWebhook(wh); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		id, err := datastore.AddWebhook(conf.Name, wh)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		webhookCache.Invalidate(conf.Name)
+
+		respond(w, http.StatusCreated, id)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if len(id) == 0 {
+			http.Error(w, "missing id parameter", http.StatusBadRequest)
+			return
+		}
+
+		if err := datastore.DeleteWebhook(conf.Name, id); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		webhookCache.Invalidate(conf.Name)
+
+		respond(w, http.StatusOK, true)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func validateWebhook(wh internal.Webhook) error {
+	if len(wh.Collection) == 0 {
+		return fmt.Errorf("missing col")
+	} else if strings.HasPrefix(wh.Collection, "sb_") {
+		return fmt.Errorf("webhooks cannot be registered on system collections")
+	} else if !internal.ValidWebhookEvent(wh.Event) {
+		return fmt.Errorf("invalid event %q, expected create, update or delete", wh.Event)
+	}
+
+	u, err := url.Parse(wh.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return fmt.Errorf("invalid url %q, an absolute http(s) URL is expected", wh.URL)
+	} else if err := checkWebhookHost(u.Hostname()); err != nil {
+		return err
+	}
+
+	for _, field := range wh.Fields {
+		if !internal.ValidFieldPath(field) {
+			return fmt.Errorf("selecting field %q is not allowed", field)
+		}
+	}
+	return nil
+}
+
+// emitDocumentChanged emits the change of a document for the webhooks, a
+// failure is logged since the write already succeeded.
+func emitDocumentChanged(dbName, col, action, id string, doc map[string]interface{}) {
+	ev := events.DocumentChanged{
+		Base:       dbName,
+		Collection: col,
+		Action:     action,
+		ID:         id,
+		Document:   doc,
+	}
+	if err := events.Emit(ev); err != nil {
+		log.Println("error emitting document changed event", err)
+	}
+}
+
+// checkWebhookHost refuses the hosts resolving to an address a tenant must
+// not reach, unless WEBHOOK_ALLOW_PRIVATE is enabled.
+func checkWebhookHost(host string) error {
+	if strings.EqualFold(config.Current.WebhookAllowPrivate, "yes") {
+		return nil
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return fmt.Errorf("cannot resolve the webhook host %q", host)
+	}
+
+	for _, ip := range ips {
+		if !publicIP(ip) {
+			return errWebhookDestination
+		}
+	}
+	return nil
+}
+
+// webhookDialControl refuses to connect to an address checkWebhookHost
+// refuses, the host could resolve to another address since it was
+// registered.
+func webhookDialControl(network, address string, c syscall.RawConn) error {
+	if strings.EqualFold(config.Current.WebhookAllowPrivate, "yes") {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	} else if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return errWebhookDestination
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, RFC 6598.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP returns false for the loopback, link-local (i.e. the cloud
+// metadata endpoints), private and unspecified addresses.
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified() &&
+		!sharedAddressSpace.Contains(ip)
+}
+
+// listWebhooks returns the webhooks of the base dbName from webhookCache.
+func listWebhooks(dbName string) ([]internal.Webhook, error) {
+	if list, ok := webhookCache.Get(dbName); ok {
+		return list, nil
+	}
+
+	list, err := datastore.ListWebhooks(dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	webhookCache.Set(dbName, list)
+	return list, nil
+}
+
+// deliverWebhooks queues the changed document for the webhooks registered
+// for its collection and action. The deliveries are made by a fixed number
+// of workers so a write is not slowed by the receivers, see webhookWorker.
+func deliverWebhooks(e events.Event) error {
+	ev := e.(events.DocumentChanged)
+
+	list, err := listWebhooks(ev.Base)
+	if err != nil {
+		return err
+	}
+
+	startWebhookWorker.Do(func() {
+		for i := 0; i < webhookWorkers; i++ {
+			go webhookWorker()
+		}
+	})
+
+	for _, wh := range list {
+		if wh.Collection != ev.Collection || wh.Event != ev.Action {
+			continue
+		}
+
+		select {
+		case webhookQueue <- webhookJob{wh: wh, ev: ev}:
+		default:
+			log.Printf("webhook queue full, dropping the delivery of %s to %s", wh.ID, wh.URL)
+		}
+	}
+	return nil
+}
+
+// webhookWorker delivers the queued webhooks, a failed delivery is retried
+// after each of webhookRetries.
+func webhookWorker() {
+	for job := range webhookQueue {
+		err := deliverWebhook(job.wh, job.ev)
+		for _, delay := range webhookRetries {
+			if err == nil || errors.Is(err, errWebhookDestination) {
+				break
+			}
+
+			time.Sleep(delay)
+			err = deliverWebhook(job.wh, job.ev)
+		}
+
+		if err != nil {
+			log.Printf("error delivering webhook %s to %s: %v", job.wh.ID, job.wh.URL, err)
+		}
+	}
+}
+
+// deliverWebhook POSTs ev to wh. The document is the one returned to the
+// writer, which passed its permissions, narrowed to the webhook's fields.
+func deliverWebhook(wh internal.Webhook, ev events.DocumentChanged) error {
+	b, err := json.Marshal(webhookPayload{
+		Event:      ev.Action,
+		Collection: ev.Collection,
+		ID:         ev.ID,
+		Document:   internal.Project(ev.Document, wh.Fields),
+		Sent:       time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, ev.Action)
+	if len(wh.Secret) > 0 {
+		req.Header.Set(webhookSignatureHeader, signWebhook(wh.Secret, b))
+	}
+
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// signWebhook returns the hex HMAC-SHA256 of body keyed with secret so a
+// receiver can verify a delivery comes from the server.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,213 @@
+package staticbackend
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/config"
+)
+
+type webhookDelivery struct {
+	path      string
+	signature string
+	payload   webhookPayload
+}
+
+func addTestWebhook(t *testing.T, col, event, url string, fields []string) string {
+	data := map[string]interface{}{
+		"col":    col,
+		"event":  event,
+		"url":    url,
+		"secret": "wh-secret",
+		"fields": fields,
+	}
+	resp := dbReq(t, webhooks, "POST", "/sudo/webhooks", data, true)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+	defer resp.Body.Close()
+
+	var id string
+	if err := json.NewDecoder(resp.Body).Decode(&id); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		resp := dbReq(t, webhooks, "DELETE", "/sudo/webhooks?id="+id, nil, true)
+		resp.Body.Close()
+	})
+	return id
+}
+
+func TestWebhookCollectionScope(t *testing.T) {
+	deliveries := make(chan webhookDelivery, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+
+		var payload webhookPayload
+		if err := json.Unmarshal(b, &payload); err != nil {
+			t.Error(err)
+		}
+
+		if sig := r.Header.Get(webhookSignatureHeader); sig != signWebhook("wh-secret", b) {
+			t.Errorf("expected a valid signature got %s", sig)
+		}
+
+		deliveries <- webhookDelivery{path: r.URL.Path, payload: payload}
+	}))
+	defer receiver.Close()
+
+	addTestWebhook(t, "whcola", "create", receiver.URL+"/a", []string{"title"})
+	addTestWebhook(t, "whcolb", "create", receiver.URL+"/b", nil)
+	addTestWebhook(t, "whcola", "delete", receiver.URL+"/a-deleted", nil)
+
+	task := map[string]interface{}{"title": "webhook", "done": false}
+	resp := dbReq(t, database.add, "POST", "/db/whcola", task)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+	resp.Body.Close()
+
+	select {
+	case d := <-deliveries:
+		if d.path != "/a" {
+			t.Fatalf("expected collection A's create webhook got %s", d.path)
+		} else if d.payload.Event != "create" || d.payload.Collection != "whcola" {
+			t.Errorf("expected a create on whcola got %s on %s", d.payload.Event, d.payload.Collection)
+		} else if d.payload.Document["title"] != "webhook" || d.payload.Document["id"] != d.payload.ID {
+			t.Errorf("expected the created document got %v", d.payload.Document)
+		} else if _, ok := d.payload.Document["done"]; ok {
+			t.Errorf("expected the document to be limited to the webhook's fields got %v", d.payload.Document)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the webhook delivery")
+	}
+
+	select {
+	case d := <-deliveries:
+		t.Errorf("expected only collection A's create webhook to fire got %s", d.path)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestWebhookValidation(t *testing.T) {
+	invalid := []map[string]interface{}{
+		{"col": "", "event": "create", "url": "https://example.com"},
+		{"col": "sb_tokens", "event": "create", "url": "https://example.com"},
+		{"col": "tasks", "event": "read", "url": "https://example.com"},
+		{"col": "tasks", "event": "create", "url": "/relative"},
+	}
+	for _, data := range invalid {
+		resp := dbReq(t, webhooks, "POST", "/sudo/webhooks", data, true)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected %v to be refused got status %d", data, resp.StatusCode)
+		}
+	}
+
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+	config.Current.WebhookAllowPrivate = ""
+
+	private := []string{"http://127.0.0.1:8099/hook", "http://169.254.169.254/latest/meta-data", "http://10.0.0.1/hook", "http://[::1]/hook", "http://localhost/hook"}
+	for _, u := range private {
+		data := map[string]interface{}{"col": "tasks", "event": "create", "url": u}
+		resp := dbReq(t, webhooks, "POST", "/sudo/webhooks", data, true)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected %s to be refused got status %d", u, resp.StatusCode)
+		}
+	}
+}
+
+func TestWebhookDialControl(t *testing.T) {
+	defer func(c config.AppConfig) { config.Current = c }(config.Current)
+	config.Current.WebhookAllowPrivate = ""
+
+	for _, addr := range []string{"127.0.0.1:80", "169.254.169.254:80", "192.168.1.10:443", "[::1]:80", "100.64.0.1:80"} {
+		if err := webhookDialControl("tcp", addr, nil); !errors.Is(err, errWebhookDestination) {
+			t.Errorf("expected %s to be refused got %v", addr, err)
+		}
+	}
+
+	if err := webhookDialControl("tcp", "93.184.216.34:443", nil); err != nil {
+		t.Errorf("expected a public address to be allowed got %v", err)
+	}
+}
+
+func TestWebhookIncreaseAndBulkWrites(t *testing.T) {
+	deliveries := make(chan webhookDelivery, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+
+		deliveries <- webhookDelivery{path: r.URL.Path, payload: payload}
+	}))
+	defer receiver.Close()
+
+	task := map[string]interface{}{"title": "bulk", "count": 1}
+	resp := dbReq(t, database.add, "POST", "/db/whbulk", task)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	var created map[string]interface{}
+	if err := parseBody(resp.Body, &created); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := created["id"].(string)
+
+	addTestWebhook(t, "whbulk", "create", receiver.URL+"/created", nil)
+	addTestWebhook(t, "whbulk", "update", receiver.URL+"/updated", nil)
+	addTestWebhook(t, "whbulk", "delete", receiver.URL+"/deleted", nil)
+
+	inc := map[string]interface{}{"field": "count", "range": 2}
+	resp = dbReq(t, database.increase, "PUT", "/inc/whbulk/"+id, inc)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+	resp.Body.Close()
+
+	select {
+	case d := <-deliveries:
+		if d.path != "/updated" || d.payload.ID != id {
+			t.Fatalf("expected the update webhook of %s got %s for %s", id, d.path, d.payload.ID)
+		} else if count, _ := d.payload.Document["count"].(float64); count != 3 {
+			t.Errorf("expected the increased document got %v", d.payload.Document)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the webhook delivery")
+	}
+
+	// the bulk writes don't fire the webhooks
+	resp = dbReq(t, database.dbreq, "POST", "/db/whbulk?bulk=1", []interface{}{task, task})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+	resp.Body.Close()
+
+	update := map[string]interface{}{"update": map[string]interface{}{"title": "bulk updated"}}
+	resp = dbReq(t, database.dbreq, "PUT", "/db/whbulk?bulk=1&all=true", update)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+	resp.Body.Close()
+
+	resp = dbReq(t, database.dbreq, "DELETE", "/db/whbulk?bulk=1&all=true", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+	resp.Body.Close()
+
+	select {
+	case d := <-deliveries:
+		t.Errorf("expected the bulk writes not to fire the webhooks got %s", d.path)
+	case <-time.After(500 * time.Millisecond):
+	}
+}